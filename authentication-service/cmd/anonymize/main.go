@@ -0,0 +1,86 @@
+// Command anonymize refreshes a staging schema with the users of production.
+// Emails, names, passwords and tokens are replaced by stand-ins derived from
+// a key, so the same production user always becomes the same staging user and
+// staging holds no personal data. Roles and timestamps are kept as they are.
+//
+//	anonymize -source "$PROD_DSN" -target "$STAGING_DSN" -schema staging
+//
+// The previous content of the schema is replaced, in one transaction.
+package main
+
+import (
+	"authentication/data"
+	"context"
+	"database/sql"
+	"flag"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+func main() {
+	source := flag.String("source", os.Getenv("DSN"), "Postgres DSN of the production users")
+	target := flag.String("target", os.Getenv("STAGING_DSN"), "Postgres DSN of the staging database, the source database by default")
+	schema := flag.String("schema", "staging", "schema the anonymized users are copied into")
+	key := flag.String("key", os.Getenv("ANONYMIZE_KEY"), "secret the stand-ins are derived from, keep it to get the same stand-ins on every refresh")
+	domain := flag.String("domain", "example.com", "email domain of the anonymized users")
+	password := flag.String("password", "verysecret", "password of every anonymized user")
+	timeout := flag.Duration("timeout", time.Hour, "time the copy may take")
+	flag.Parse()
+
+	if *source == "" {
+		log.Fatal("no source DSN, set -source or DSN")
+	}
+	if *target == "" {
+		*target = *source
+	}
+
+	anonymizer, err := data.NewAnonymizer(*key, *domain, *password)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	src := openDB(*source)
+	defer src.Close()
+
+	dst := src
+	if *target != *source {
+		dst = openDB(*target)
+		defer dst.Close()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	start := time.Now()
+	report, err := anonymizer.Copy(ctx, src, dst, *schema)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tables := make([]string, 0, len(report.Tables))
+	for table := range report.Tables {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	for _, table := range tables {
+		log.Printf("%s.%s: %d rows", report.Schema, table, report.Tables[table])
+	}
+	log.Printf("Anonymized users copied into %s in %s", report.Schema, time.Since(start).Round(time.Millisecond))
+}
+
+func openDB(dsn string) *sql.DB {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := db.Ping(); err != nil {
+		log.Fatal(err)
+	}
+
+	return db
+}
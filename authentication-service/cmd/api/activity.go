@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// activeUsersKey is the Redis sorted set of the users that logged in, scored
+// by the time of their last login
+const activeUsersKey = "active:users"
+
+// activeWindows are the periods active users are counted over, the longest
+// one bounds how long a login is kept
+var activeWindows = []struct {
+	name   string
+	period time.Duration
+}{
+	{"5m", 5 * time.Minute},
+	{"15m", 15 * time.Minute},
+	{"1h", time.Hour},
+	{"24h", 24 * time.Hour},
+}
+
+// recordLogin marks the user as active. Every replica writes to the same set,
+// so the counts cover the whole service.
+func (app *Config) recordLogin(ctx context.Context, userID int) {
+	if app.Redis == nil {
+		return
+	}
+
+	now := time.Now()
+	oldest := now.Add(-activeWindows[len(activeWindows)-1].period)
+
+	_, err := app.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, activeUsersKey, redis.Z{Score: float64(now.Unix()), Member: strconv.Itoa(userID)})
+		pipe.ZRemRangeByScore(ctx, activeUsersKey, "-inf", "("+strconv.FormatInt(oldest.Unix(), 10))
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error recording the login of user %d: %v", userID, err)
+	}
+}
+
+// activeUsers counts the users that logged in during each window
+func (app *Config) activeUsers(ctx context.Context) (map[string]int64, error) {
+	if app.Redis == nil {
+		return nil, errors.New("active users are counted in Redis, REDIS_ADDR is not set")
+	}
+
+	now := time.Now()
+	counts := make([]*redis.IntCmd, len(activeWindows))
+
+	_, err := app.Redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, w := range activeWindows {
+			counts[i] = pipe.ZCount(ctx, activeUsersKey, strconv.FormatInt(now.Add(-w.period).Unix(), 10), "+inf")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	active := make(map[string]int64, len(activeWindows))
+	for i, w := range activeWindows {
+		active[w.name] = counts[i].Val()
+	}
+
+	return active, nil
+}
+
+// publishActiveUsers adds the active user counts to /debug/vars
+func (app *Config) publishActiveUsers() {
+	expvar.Publish("active_users", expvar.Func(func() any {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		active, err := app.activeUsers(ctx)
+		if err != nil {
+			return nil
+		}
+		return active
+	}))
+}
+
+// ActiveUsers counts the users that logged in during the last 5 minutes,
+// 15 minutes, hour and day, for capacity planning
+func (app *Config) ActiveUsers(w http.ResponseWriter, r *http.Request) {
+	active, err := app.activeUsers(r.Context())
+	if err != nil {
+		app.errorJson(w, err, http.StatusServiceUnavailable)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: "active users",
+		Data:    active,
+	})
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"authentication/data"
+	"context"
+	v1 "contracts/v1"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+type BulkPayload struct {
+	Operation string `json:"operation"`
+	IDs       []int  `json:"ids"`
+	Role      string `json:"role,omitempty"`
+}
+
+// bulkEvents names the event emitted for every user a bulk operation changed
+var bulkEvents = map[string]string{
+	data.BulkActivate:   "user.activated",
+	data.BulkDeactivate: "user.deactivated",
+	data.BulkDelete:     "user.deleted",
+	data.BulkAssignRole: "user.role_assigned",
+}
+
+// BulkUsers activates, deactivates, deletes or assigns a role to a list of
+// users in one transaction and reports the result for each of them. With
+// ?async=true it answers right away with a job to poll.
+func (app *Config) BulkUsers(w http.ResponseWriter, r *http.Request) {
+	var requestPayload BulkPayload
+
+	err := app.readJson(w, r, &requestPayload)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	err = data.CheckBulk(requestPayload.Operation, requestPayload.IDs, requestPayload.Role)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	if r.URL.Query().Get("async") == "true" {
+		app.startBulkJob(w, requestPayload, adminIdentity(r))
+		return
+	}
+
+	results, err := app.Models.UserAdmin.Bulk(requestPayload.Operation, requestPayload.IDs, requestPayload.Role, nil)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	go app.emitBulkEvents(requestPayload, results, adminIdentity(r))
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: fmt.Sprintf("%s applied", requestPayload.Operation),
+		Data:    results,
+	})
+}
+
+func (app *Config) startBulkJob(w http.ResponseWriter, payload BulkPayload, actor string) {
+	job, err := app.Models.Job.Start("users_bulk_"+payload.Operation, func(ctx context.Context, progress data.ProgressFunc) (any, error) {
+		results, err := app.Models.UserAdmin.Bulk(payload.Operation, payload.IDs, payload.Role, progress)
+		if err != nil {
+			return nil, err
+		}
+
+		app.emitBulkEvents(payload, results, actor)
+
+		return results, nil
+	})
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJson(w, http.StatusAccepted, jsonReponse{
+		Error:   false,
+		Message: fmt.Sprintf("%s started", payload.Operation),
+		Data:    job,
+	})
+}
+
+// bulkNotification is sent to the streams of the users a bulk operation
+// changed, deleted users get none
+func bulkNotification(payload BulkPayload) string {
+	switch payload.Operation {
+	case data.BulkActivate:
+		return "Your account was activated"
+	case data.BulkDeactivate:
+		return "Your account was deactivated"
+	case data.BulkAssignRole:
+		return fmt.Sprintf("You were given the %s role", payload.Role)
+	}
+	return ""
+}
+
+// emitBulkEvents records one event per changed user once the transaction is
+// committed. The logger forgets the entries of deleted users, their events are
+// not linked to them so that they do not outlive the forget.
+func (app *Config) emitBulkEvents(payload BulkPayload, results []data.BulkResult, actor string) {
+	event := bulkEvents[payload.Operation]
+
+	for _, result := range results {
+		if result.Status != data.BulkOK {
+			continue
+		}
+
+		if payload.Operation == data.BulkDelete {
+			if err := app.logRequest(event, fmt.Sprintf("a user was deleted by %s", actor)); err != nil {
+				log.Printf("Error emitting %s: %v", event, err)
+			}
+			if err := app.forgetUserLogs(result.ID, actor); err != nil {
+				log.Printf("Error forgetting the logs of user %d: %v", result.ID, err)
+			}
+			continue
+		}
+
+		detail := fmt.Sprintf("user %d", result.ID)
+		if payload.Operation == data.BulkAssignRole {
+			detail = fmt.Sprintf("user %d role %s", result.ID, payload.Role)
+		}
+
+		if err := app.logUserRequest(event, detail, result.ID); err != nil {
+			log.Printf("Error emitting %s for user %d: %v", event, result.ID, err)
+		}
+
+		if message := bulkNotification(payload); message != "" {
+			app.publishEvent(fmt.Sprintf("user:%d", result.ID), "notification", v1.Notification{
+				UserID:  result.ID,
+				Title:   "Account updated",
+				Message: message,
+			})
+		}
+	}
+}
+
+// GetJob returns the status and progress of a job
+func (app *Config) GetJob(w http.ResponseWriter, r *http.Request) {
+	job, err := app.Models.Job.Get(chi.URLParam(r, "id"))
+	if err != nil {
+		if errors.Is(err, data.ErrJobNotFound) {
+			app.errorJson(w, err, http.StatusNotFound)
+			return
+		}
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: job.Status,
+		Data:    job,
+	})
+}
+
+// failInterruptedJobs fails the jobs of replicas that stopped, at start and
+// then at every interval. Every replica runs it, a job only fails once.
+func (app *Config) failInterruptedJobs(interval time.Duration) {
+	for {
+		if err := app.Models.Job.FailInterrupted(); err != nil {
+			log.Println("Error failing interrupted jobs:", err)
+		}
+		time.Sleep(interval)
+	}
+}
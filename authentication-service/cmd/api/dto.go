@@ -0,0 +1,22 @@
+package main
+
+import (
+	"authentication/data"
+	v1 "contracts/v1"
+)
+
+// Handlers answer with the types of the contracts module instead of the data
+// models, so that a change to a model cannot rename a field clients rely on.
+
+func newUserV1(u *data.User) v1.User {
+	return v1.User{
+		ID:        u.ID,
+		Email:     u.Email,
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+		Active:    u.Active,
+		CreatedAt: u.CreatedAt,
+		UpdatedAt: u.UpdatedAt,
+		Roles:     u.Roles,
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"authentication/data"
+	v1 "contracts/v1"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+type ElevationPayload struct {
+	UserID   int    `json:"user_id"`
+	Role     string `json:"role"`
+	Duration string `json:"duration"`
+	Reason   string `json:"reason"`
+}
+
+// RequestElevation records a request for a role held for a limited time,
+// e.g. {"user_id": 1, "role": "support", "duration": "2h", ...}, on behalf of
+// the calling admin, see adminIdentity. It grants nothing until another admin
+// approves it.
+func (app *Config) RequestElevation(w http.ResponseWriter, r *http.Request) {
+	var requestPayload ElevationPayload
+
+	err := app.readJson(w, r, &requestPayload)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	duration, err := time.ParseDuration(requestPayload.Duration)
+	if err != nil {
+		app.errorJson(w, errors.New("duration must be a duration like 30m or 2h"))
+		return
+	}
+
+	elevation, err := app.Models.UserAdmin.RequestElevation(requestPayload.UserID, requestPayload.Role, requestPayload.Reason, duration, adminIdentity(r))
+	if errors.Is(err, data.ErrUserNotFound) {
+		app.errorJson(w, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	app.writeJson(w, http.StatusCreated, jsonReponse{
+		Error:   false,
+		Message: "elevation requested",
+		Data:    elevation,
+	})
+}
+
+// ListElevations returns the latest elevations, filtered by ?status=
+func (app *Config) ListElevations(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 1000 {
+			app.errorJson(w, errors.New("limit must be between 1 and 1000"))
+			return
+		}
+		limit = n
+	}
+
+	elevations, err := app.Models.UserAdmin.Elevations(r.URL.Query().Get("status"), limit)
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: "elevations",
+		Data:    elevations,
+	})
+}
+
+// GetElevation returns one elevation
+func (app *Config) GetElevation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJson(w, errors.New("invalid elevation id"))
+		return
+	}
+
+	elevation, err := app.Models.UserAdmin.GetElevation(id)
+	if err != nil {
+		app.elevationError(w, err)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: elevation.Status,
+		Data:    elevation,
+	})
+}
+
+// ApproveElevation grants the role of a pending elevation for its duration.
+// The calling admin is the approver and can not be the requester, so the
+// shared admin key can not approve what it requested: approvals need an admin
+// signed in with their own token.
+func (app *Config) ApproveElevation(w http.ResponseWriter, r *http.Request) {
+	app.decideElevation(w, r, true)
+}
+
+// DenyElevation closes a pending elevation without granting the role
+func (app *Config) DenyElevation(w http.ResponseWriter, r *http.Request) {
+	app.decideElevation(w, r, false)
+}
+
+func (app *Config) decideElevation(w http.ResponseWriter, r *http.Request, approve bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJson(w, errors.New("invalid elevation id"))
+		return
+	}
+
+	approver := adminIdentity(r)
+
+	var elevation *data.Elevation
+	if approve {
+		elevation, err = app.Models.UserAdmin.ApproveElevation(id, approver)
+	} else {
+		elevation, err = app.Models.UserAdmin.DenyElevation(id, approver)
+	}
+	if err != nil {
+		app.elevationError(w, err)
+		return
+	}
+
+	if approve {
+		detail := fmt.Sprintf("user %d role %s until %s, approved by %s", elevation.UserID, elevation.Role, elevation.ExpiresAt.Format(time.RFC3339), elevation.DecidedBy)
+		if err := app.logUserRequest("user.role_elevated", detail, elevation.UserID); err != nil {
+			log.Printf("Error emitting user.role_elevated for user %d: %v", elevation.UserID, err)
+		}
+
+		app.publishEvent(fmt.Sprintf("user:%d", elevation.UserID), "notification", v1.Notification{
+			UserID:  elevation.UserID,
+			Title:   "Role granted",
+			Message: fmt.Sprintf("You hold the %s role until %s", elevation.Role, elevation.ExpiresAt.Format(time.RFC3339)),
+		})
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: "elevation " + elevation.Status,
+		Data:    elevation,
+	})
+}
+
+// RevokeElevation takes the role of an approved elevation back before it expires
+func (app *Config) RevokeElevation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJson(w, errors.New("invalid elevation id"))
+		return
+	}
+
+	elevation, err := app.Models.UserAdmin.RevokeElevation(id)
+	if err != nil {
+		app.elevationError(w, err)
+		return
+	}
+
+	detail := fmt.Sprintf("user %d role %s revoked", elevation.UserID, elevation.Role)
+	if err := app.logUserRequest("user.role_revoked", detail, elevation.UserID); err != nil {
+		log.Printf("Error emitting user.role_revoked for user %d: %v", elevation.UserID, err)
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: "elevation revoked",
+		Data:    elevation,
+	})
+}
+
+func (app *Config) elevationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, data.ErrElevationNotFound):
+		app.errorJson(w, err, http.StatusNotFound)
+	case errors.Is(err, data.ErrElevationState):
+		app.errorJson(w, err, http.StatusConflict)
+	case errors.Is(err, data.ErrSelfApproval):
+		app.errorJson(w, err, http.StatusForbidden)
+	default:
+		app.errorJson(w, err)
+	}
+}
+
+// revokeExpiredRoles takes back the time-boxed roles whose time is up at every interval
+func (app *Config) revokeExpiredRoles(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		expired, err := app.Models.UserAdmin.RevokeExpiredRoles()
+		if err != nil {
+			log.Println("Error revoking expired roles:", err)
+			continue
+		}
+
+		for _, role := range expired {
+			detail := fmt.Sprintf("user %d role %s expired", role.UserID, role.Role)
+			if err := app.logUserRequest("user.role_expired", detail, role.UserID); err != nil {
+				log.Printf("Error emitting user.role_expired for user %d: %v", role.UserID, err)
+			}
+
+			app.publishEvent(fmt.Sprintf("user:%d", role.UserID), "notification", v1.Notification{
+				UserID:  role.UserID,
+				Title:   "Role expired",
+				Message: fmt.Sprintf("Your %s role has expired", role.Role),
+			})
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"contracts/eventschema"
+	"contracts/keystore"
+	"contracts/signing"
+	v1 "contracts/v1"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// publishEvent sends an event to the broker's event streams through Redis,
+// signed with the current event key. It does nothing when no Redis is
+// configured.
+func (app *Config) publishEvent(topic, eventType string, data any) {
+	if app.Redis == nil {
+		return
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		log.Println("Error encoding event:", err)
+		return
+	}
+
+	// the id is set even without a signing key, the logger stores events by it
+	e := v1.Event{ID: signing.NewID(), Topic: topic, Type: eventType, Data: raw, Schema: eventschema.Events.Current(eventType), Version: version}
+	if key, err := app.Keys.Signing(keystore.PurposeEvents); err == nil {
+		signing.SignEvent(&e, key)
+	}
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		log.Println("Error encoding event:", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := app.Redis.Publish(ctx, "events:"+topic, payload).Err(); err != nil {
+		log.Println("Error publishing event:", err)
+	}
+}
+
+func newRedis(addr string) *redis.Client {
+	if addr == "" {
+		return nil
+	}
+	return redis.NewClient(&redis.Options{Addr: addr})
+}
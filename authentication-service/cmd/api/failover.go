@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// failbackCheckInterval is how often the primary is probed while running on a standby
+const failbackCheckInterval = 10 * time.Second
+
+// failoverConnector dials the primary Postgres and falls over to the standbys, in
+// order, when the primary refuses connections. database/sql asks it for a new
+// connection whenever a pooled one breaks, so failover happens per connection.
+type failoverConnector struct {
+	connectors []*pq.Connector
+
+	mu     sync.Mutex
+	active int
+}
+
+// splitDSNs returns the primary DSN followed by the standbys, which are separated by |
+func splitDSNs(primary, standbys string) []string {
+	dsns := []string{primary}
+
+	for _, dsn := range strings.Split(standbys, "|") {
+		if dsn = strings.TrimSpace(dsn); dsn != "" {
+			dsns = append(dsns, dsn)
+		}
+	}
+
+	return dsns
+}
+
+func newFailoverConnector(dsns []string) (*failoverConnector, error) {
+	c := &failoverConnector{}
+
+	for _, dsn := range dsns {
+		connector, err := pq.NewConnector(dsn)
+		if err != nil {
+			return nil, err
+		}
+		c.connectors = append(c.connectors, connector)
+	}
+
+	return c, nil
+}
+
+// Connect tries the active server first and then every other one in order
+func (c *failoverConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	c.mu.Lock()
+	start := c.active
+	c.mu.Unlock()
+
+	var errs []error
+
+	for i := 0; i < len(c.connectors); i++ {
+		idx := (start + i) % len(c.connectors)
+
+		conn, err := c.connectors[idx].Connect(ctx)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if idx != start {
+			c.switchTo(idx)
+		}
+
+		return conn, nil
+	}
+
+	return nil, errors.Join(errs...)
+}
+
+func (c *failoverConnector) Driver() driver.Driver {
+	return &pq.Driver{}
+}
+
+func (c *failoverConnector) switchTo(idx int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.active == idx {
+		return
+	}
+
+	if idx == 0 {
+		log.Println("Postgres primary is back, failing back")
+	} else {
+		log.Printf("Postgres server %d unavailable, failing over to standby %d", c.active, idx)
+	}
+
+	c.active = idx
+}
+
+// probePrimary runs while the service is alive and fails back to the primary as
+// soon as it accepts connections again. Idle connections to the standby are
+// dropped right away, busy ones expire through the pool's max lifetime.
+func (c *failoverConnector) probePrimary(db *sql.DB) {
+	ticker := time.NewTicker(failbackCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		c.mu.Lock()
+		active := c.active
+		c.mu.Unlock()
+
+		if active == 0 {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		conn, err := c.connectors[0].Connect(ctx)
+		cancel()
+
+		if err != nil {
+			continue
+		}
+		conn.Close()
+
+		c.switchTo(0)
+
+		db.SetMaxIdleConns(0)
+		db.SetMaxIdleConns(2)
+	}
+}
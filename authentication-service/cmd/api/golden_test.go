@@ -0,0 +1,899 @@
+package main
+
+import (
+	"authentication/data"
+	"bytes"
+	"context"
+	"contracts/failover"
+	"contracts/lifecycle"
+	"contracts/token"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// update rewrites the golden files with the answers of the handlers:
+//
+//	go test ./cmd/api -run TestGolden -update
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// goldenAdminKey is the X-Admin-Key of the golden app
+const goldenAdminKey = "test-admin-key"
+
+// goldenCase is one request through the routes of the service, its answer is
+// compared with testdata/<name>.golden.json. Paths and bodies may refer to
+// the vars of setup as $name.
+type goldenCase struct {
+	name   string
+	method string
+	path   string
+	body   string
+	header map[string]string
+	// as is who sends the request: "admin" with the admin key, "user" and
+	// "root" with the bearer token of ada@example.com and of the admin user
+	as     string
+	setup  func(t *testing.T, app *testApp, vars map[string]string)
+	status int
+	// keysOnly keeps the names of the top-level fields of the body, for
+	// answers whose values change at every run
+	keysOnly bool
+}
+
+// golden is what is compared of an answer
+type golden struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    any               `json:"body,omitempty"`
+}
+
+// goldenHeaders are the headers kept in the golden files
+var goldenHeaders = []string{"Content-Type", "Deprecation", "Location", "WWW-Authenticate"}
+
+// volatileFields are replaced in the golden files, their values change at
+// every run. String ids are random, number ids are not.
+var volatileFields = map[string]bool{
+	"active_from": true, "build_time": true, "captured_at": true, "commit": true,
+	"created_at": true, "decided_at": true, "exp": true, "expires_at": true,
+	"finished_at": true, "first_clicked_at": true, "first_opened_at": true,
+	"go_version": true, "iat": true, "jti": true, "last_failed_at": true,
+	"locked_until": true, "message_id": true, "refresh_expires_at": true,
+	"refresh_token": true, "refreshed_at": true, "retry_after": true,
+	"signed_in_at": true, "token": true, "updated_at": true,
+}
+
+// timestamps finds the times written into messages
+var timestamps = regexp.MustCompile(`\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d(\.\d+)?(Z|[+-]\d\d:\d\d)`)
+
+// newGoldenApp is the test app with every optional part of the service
+// switched on: ada@example.com (1), root@example.com (2) holding the admin
+// role and the deactivated grace@example.com (3), dry-run mail with tracking
+// and replies, and a logger that takes every call
+func newGoldenApp(t *testing.T) *testApp {
+	t.Setenv("DRAIN_DELAY", "0s")
+
+	app := newTestApp(t)
+	app.AdminKey = goldenAdminKey
+	app.Lifecycle = lifecycle.New()
+	app.Lifecycle.AdminKey = goldenAdminKey
+	app.Models.UserAdmin = newScriptedUserAdmin(app.Models.User)
+
+	app.MailCapture = &captureMailer{}
+	app.Mail = newMailQueue(app.MailCapture, 1, 1, 16)
+	app.MailTracking = newMailTracker(true, "https://auth.example.com")
+	app.MailInbound = newMailInbound("inbound-secret", "mail.example.com")
+	app.PasswordResetURL = "https://app.example.com/reset"
+
+	logger := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/users/merge":
+			w.WriteHeader(http.StatusNoContent)
+		case strings.HasSuffix(r.URL.Path, "/forget"):
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(logger.Close)
+	app.Logger = failover.MustNew("logger-service", logger.URL, "")
+	app.LoggerKey = "logger-admin-key"
+
+	app.GroupRoles = map[string][]string{"engineering": {data.RoleAdmin}}
+
+	for _, user := range []data.User{
+		{Email: "ada@example.com", FirstName: "Ada", LastName: "Lovelace", Password: "correct horse", Active: true},
+		{Email: "root@example.com", FirstName: "Root", LastName: "Admin", Password: "correct horse", Active: true},
+		{Email: "grace@example.com", FirstName: "Grace", LastName: "Hopper", Password: "correct horse"},
+	} {
+		if _, err := app.Models.User.Insert(user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := app.Models.User.AssignRole(2, data.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+
+	return app
+}
+
+// bearer returns an access token of a user
+func (app *testApp) bearer(t *testing.T, userID int, email string) string {
+	t.Helper()
+
+	raw, _, err := app.Tokens.Issue(token.Claims{Subject: strconv.Itoa(userID), Email: email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+// do sends a request through the routes of the service
+func (app *testApp) do(t *testing.T, c goldenCase, vars map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	expand := func(s string) string {
+		return os.Expand(s, func(name string) string { return vars[name] })
+	}
+
+	var body *strings.Reader
+	if c.body != "" {
+		body = strings.NewReader(expand(c.body))
+	} else {
+		body = strings.NewReader("")
+	}
+
+	r := httptest.NewRequest(c.method, expand(c.path), body)
+	r.RemoteAddr = "192.0.2.1:1234"
+	if c.body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	for name, value := range c.header {
+		r.Header.Set(name, expand(value))
+	}
+
+	switch c.as {
+	case "admin":
+		r.Header.Set("X-Admin-Key", goldenAdminKey)
+	case "user":
+		r.Header.Set("Authorization", "Bearer "+app.bearer(t, 1, "ada@example.com"))
+	case "root":
+		r.Header.Set("Authorization", "Bearer "+app.bearer(t, 2, "root@example.com"))
+	}
+
+	w := httptest.NewRecorder()
+	app.routes().ServeHTTP(w, r)
+	return w
+}
+
+// record turns an answer into what the golden file holds, the values of vars
+// are written back as $name
+func record(t *testing.T, c goldenCase, w *httptest.ResponseRecorder, vars map[string]string) golden {
+	t.Helper()
+
+	g := golden{Status: w.Code}
+
+	var names []string
+	for name, value := range vars {
+		names = append(names, value, "$"+name)
+	}
+	n := normalizer{vars: strings.NewReplacer(names...)}
+
+	for _, name := range goldenHeaders {
+		if v := w.Header().Get(name); v != "" {
+			if g.Headers == nil {
+				g.Headers = make(map[string]string)
+			}
+			g.Headers[name] = n.vars.Replace(v)
+		}
+	}
+
+	contentType := w.Header().Get("Content-Type")
+	switch {
+	case w.Body.Len() == 0:
+	case strings.Contains(contentType, "json"):
+		var body any
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: %v", w.Body, err)
+		}
+		if c.keysOnly {
+			var keys []string
+			for key := range body.(map[string]any) {
+				keys = append(keys, key)
+			}
+			slices.Sort(keys)
+			g.Body = keys
+		} else {
+			g.Body = n.normalize("", body)
+		}
+	case strings.HasPrefix(contentType, "text/"):
+		g.Body = n.text(w.Body.String())
+	default:
+		g.Body = fmt.Sprintf("<%d bytes>", w.Body.Len())
+	}
+
+	return g
+}
+
+// normalizer takes out of an answer what changes at every run
+type normalizer struct {
+	vars *strings.Replacer
+}
+
+// normalize replaces the values of volatileFields, and the times and vars in
+// strings
+func (n normalizer) normalize(key string, v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, field := range v {
+			v[k] = n.normalize(k, field)
+		}
+		return v
+	case []any:
+		for i, item := range v {
+			v[i] = n.normalize("", item)
+		}
+		return v
+	case string:
+		if v != "" && (volatileFields[key] || key == "id") {
+			return "<" + key + ">"
+		}
+		return n.text(v)
+	case float64:
+		if volatileFields[key] {
+			return "<" + key + ">"
+		}
+	}
+	return v
+}
+
+func (n normalizer) text(s string) string {
+	return timestamps.ReplaceAllString(n.vars.Replace(s), "<time>")
+}
+
+// checkGolden compares an answer with its golden file, or writes the file
+// with -update
+func checkGolden(t *testing.T, name string, g golden) {
+	t.Helper()
+
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(g); err != nil {
+		t.Fatal(err)
+	}
+	got := b.Bytes()
+
+	path := filepath.Join("testdata", name+".golden.json")
+	if *update {
+		if err := os.MkdirAll("testdata", 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v, run with -update to create it", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("answer differs from %s, run with -update if the change is intended\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+func TestGolden(t *testing.T) {
+	names := make(map[string]bool)
+	for _, c := range goldenCases {
+		if names[c.name] {
+			t.Fatalf("two cases are named %s", c.name)
+		}
+		names[c.name] = true
+
+		t.Run(c.name, func(t *testing.T) {
+			app := newGoldenApp(t)
+
+			vars := make(map[string]string)
+			if c.setup != nil {
+				c.setup(t, app, vars)
+			}
+
+			w := app.do(t, c, vars)
+			if w.Code != c.status {
+				t.Errorf("%s %s answered %d, want %d: %s", c.method, c.path, w.Code, c.status, w.Body)
+			}
+
+			checkGolden(t, c.name, record(t, c, w, vars))
+		})
+	}
+}
+
+// TestGoldenCoversRoutes makes sure every route has a case
+func TestGoldenCoversRoutes(t *testing.T) {
+	app := &Config{}
+
+	// each route answers with its pattern, to find the route of a case
+	patterns := chi.NewRouter()
+	for _, rt := range app.routeTable() {
+		patterns.MethodFunc(rt.method, rt.path, func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, chi.RouteContext(r.Context()).RoutePattern())
+		})
+	}
+
+	covered := make(map[string]bool)
+	for _, c := range goldenCases {
+		w := httptest.NewRecorder()
+		patterns.ServeHTTP(w, httptest.NewRequest(c.method, os.Expand(c.path, func(string) string { return "x" }), nil))
+		covered[c.method+" "+w.Body.String()] = true
+	}
+
+	for _, rt := range app.routeTable() {
+		if !covered[rt.method+" "+rt.path] {
+			t.Errorf("no golden case for %s %s", rt.method, rt.path)
+		}
+	}
+}
+
+// setups shared by the cases
+
+func withSession(t *testing.T, app *testApp, vars map[string]string) {
+	raw, _, err := app.Models.RefreshToken.Issue(1, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars["refresh"] = raw
+}
+
+func withLock(t *testing.T, app *testApp, vars map[string]string) {
+	for range 3 {
+		if _, err := app.Models.AccountLock.Failed(1, "192.0.2.7"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func withFailure(t *testing.T, app *testApp, vars map[string]string) {
+	if _, err := app.Models.AccountLock.Failed(1, "192.0.2.7"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func withReset(t *testing.T, app *testApp, vars map[string]string) {
+	raw, _, err := app.Models.PasswordReset.Issue(1, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars["reset"] = raw
+}
+
+// withVersions stores two versions of the password reset mail
+func withVersions(t *testing.T, app *testApp, vars map[string]string) {
+	for i := 1; i <= 2; i++ {
+		text := fmt.Sprintf("{{define \"subject\"}}Reset your password (v%d){{end}}Hello {{.Name}}, open {{.Link}} before {{.ExpiresAt}}.\n", i)
+		if _, err := app.Models.MailTemplate.CreateVersion("password_reset", text, "", "root@example.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// withRollout sends version 1 and version 2 to a tenth of the recipients
+func withRollout(t *testing.T, app *testApp, vars map[string]string) {
+	withVersions(t, app, vars)
+	err := app.Models.MailTemplate.SetRollout(&data.MailTemplateRollout{Template: "password_reset", Stable: 1, Candidate: 2, Percent: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func withTrackedMail(t *testing.T, app *testApp, vars map[string]string) {
+	id, err := app.Models.MailMessage.Track(1, "password_reset", []string{"https://app.example.com/help"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars["message"] = id
+}
+
+func withThread(t *testing.T, app *testApp, vars map[string]string) {
+	id, err := app.Models.MailThread.Start(1, "password_reset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars["thread"] = id
+}
+
+func withCapturedMail(t *testing.T, app *testApp, vars map[string]string) {
+	err := app.MailCapture.Send(context.Background(), mail{To: "ada@example.com", Subject: "Reset your password", Text: "Hello Ada"})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func withoutCapture(t *testing.T, app *testApp, vars map[string]string) {
+	app.MailCapture = nil
+}
+
+func withJob(t *testing.T, app *testApp, vars map[string]string) {
+	job, err := app.Models.Job.Start("users_bulk_activate", func(ctx context.Context, progress data.ProgressFunc) (any, error) {
+		progress(50, "half way")
+		return []data.BulkResult{{ID: 1, Status: data.BulkOK}}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars["job"] = job.ID
+}
+
+func withRole(t *testing.T, app *testApp, vars map[string]string) {
+	_, err := app.Models.Role.Insert(data.Role{Name: "support", Description: "Answers tickets", Permissions: []string{"users:read"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func withSupport(t *testing.T, app *testApp, vars map[string]string) {
+	withRole(t, app, vars)
+	if err := app.Models.User.AssignRole(1, "support"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// inboundReply is a reply of ada@example.com to the thread in $thread
+const inboundReply = "From: Ada Lovelace <ada@example.com>\r\n" +
+	"To: reply@mail.example.com\r\n" +
+	"Subject: Re: Reset your password\r\n" +
+	"Message-ID: <reply-1@example.com>\r\n" +
+	"In-Reply-To: <$thread@mail.example.com>\r\n" +
+	"Content-Type: text/plain; charset=UTF-8\r\n" +
+	"\r\n" +
+	"Yes, that was me.\r\n" +
+	"\r\n" +
+	"> Hello Ada\r\n"
+
+var inboundSecret = map[string]string{"Authorization": "Bearer inbound-secret", "Content-Type": "message/rfc822"}
+
+var goldenCases = []goldenCase{
+	{name: "version", method: "GET", path: "/version", status: 200},
+
+	{name: "livez", method: "GET", path: "/livez", status: 200},
+	{name: "healthz", method: "GET", path: "/healthz", status: 200},
+	{name: "healthz_dependency_down", method: "GET", path: "/healthz", status: 503,
+		setup: func(t *testing.T, app *testApp, vars map[string]string) {
+			app.Lifecycle.AddCheck("postgres", func(context.Context) error { return errors.New("connection refused") })
+		}},
+	{name: "readyz", method: "GET", path: "/readyz", status: 200},
+	{name: "readyz_draining", method: "GET", path: "/readyz", status: 503,
+		setup: func(t *testing.T, app *testApp, vars map[string]string) {
+			r := httptest.NewRequest("POST", "/drain", nil)
+			r.Header.Set("X-Admin-Key", goldenAdminKey)
+			app.Lifecycle.Drain(httptest.NewRecorder(), r)
+		}},
+	{name: "drain", method: "POST", path: "/drain", header: map[string]string{"X-Admin-Key": goldenAdminKey}, status: 200},
+	{name: "drain_forbidden", method: "POST", path: "/drain", status: 403},
+
+	{name: "loglevel_get", method: "GET", path: "/admin/loglevel", as: "admin", status: 200},
+	{name: "loglevel_get_without_key", method: "GET", path: "/admin/loglevel", status: 403},
+	{name: "loglevel_get_wrong_key", method: "GET", path: "/admin/loglevel", header: map[string]string{"X-Admin-Key": "guess"}, status: 403},
+	{name: "loglevel_get_as_admin_user", method: "GET", path: "/admin/loglevel", as: "root", status: 200},
+	{name: "loglevel_get_as_user", method: "GET", path: "/admin/loglevel", as: "user", status: 403},
+	{name: "loglevel_set", method: "PUT", path: "/admin/loglevel", as: "admin", body: `{"level": "info"}`, status: 200},
+	{name: "loglevel_set_invalid", method: "PUT", path: "/admin/loglevel", as: "admin", body: `{"level": "loud"}`, status: 400},
+
+	{name: "debug_vars", method: "GET", path: "/debug/vars", as: "admin", status: 200, keysOnly: true},
+	{name: "debug_vars_as_user", method: "GET", path: "/debug/vars", as: "user", status: 403},
+
+	// counted in Redis, which the tests run without
+	{name: "active_users_without_redis", method: "GET", path: "/admin/metrics/active-users", as: "admin", status: 503},
+
+	{name: "authenticate", method: "POST", path: "/authenticate", body: `{"email": "ada@example.com", "password": "correct horse"}`, status: 202},
+	{name: "authenticate_wrong_password", method: "POST", path: "/authenticate", body: `{"email": "ada@example.com", "password": "wrong"}`, status: 400},
+	{name: "authenticate_unknown_email", method: "POST", path: "/authenticate", body: `{"email": "nobody@example.com", "password": "wrong"}`, status: 400},
+	{name: "authenticate_inactive", method: "POST", path: "/authenticate", body: `{"email": "grace@example.com", "password": "correct horse"}`, status: 403},
+	{name: "authenticate_locked", method: "POST", path: "/authenticate", body: `{"email": "ada@example.com", "password": "correct horse"}`, setup: withLock, status: 423},
+	{name: "authenticate_locks", method: "POST", path: "/authenticate", body: `{"email": "ada@example.com", "password": "wrong"}`,
+		setup: func(t *testing.T, app *testApp, vars map[string]string) {
+			withFailure(t, app, vars)
+			withFailure(t, app, vars)
+		}, status: 423},
+	{name: "authenticate_bad_json", method: "POST", path: "/authenticate", body: `{"email": "ada@example.com", "pass": "x"}`, status: 400},
+
+	{name: "register", method: "POST", path: "/register", body: `{"email": "alan@example.com", "password": "correct horse", "first_name": "Alan", "last_name": "Turing", "active": true}`, status: 202},
+	{name: "register_email_taken", method: "POST", path: "/register", body: `{"email": "ada@example.com", "password": "correct horse"}`, status: 409},
+	{name: "register_empty_body", method: "POST", path: "/register", status: 400},
+
+	{name: "validate_token", method: "POST", path: "/v1/token/validate", as: "user", status: 200},
+	{name: "validate_token_missing", method: "POST", path: "/v1/token/validate", status: 400},
+	{name: "validate_token_invalid", method: "POST", path: "/v1/token/validate", body: `{"token": "not.a.token"}`, status: 401},
+
+	{name: "refresh", method: "POST", path: "/refresh", body: `{"refresh_token": "$refresh"}`, setup: withSession, status: 200},
+	{name: "refresh_missing_token", method: "POST", path: "/refresh", body: `{}`, status: 400},
+	{name: "refresh_invalid_token", method: "POST", path: "/refresh", body: `{"refresh_token": "unknown"}`, status: 401},
+	{name: "refresh_locked", method: "POST", path: "/refresh", body: `{"refresh_token": "$refresh"}`,
+		setup: func(t *testing.T, app *testApp, vars map[string]string) {
+			withSession(t, app, vars)
+			withLock(t, app, vars)
+		}, status: 423},
+
+	{name: "logout", method: "POST", path: "/logout", body: `{"refresh_token": "$refresh"}`, setup: withSession, status: 200},
+	{name: "logout_all", method: "POST", path: "/logout", body: `{"refresh_token": "$refresh", "all": true}`, setup: withSession, status: 200},
+	{name: "logout_invalid_token", method: "POST", path: "/logout", body: `{"refresh_token": "unknown"}`, status: 401},
+	{name: "logout_missing_token", method: "POST", path: "/logout", body: `{}`, status: 400},
+
+	{name: "password_forgot", method: "POST", path: "/password/forgot", body: `{"email": "ada@example.com"}`, status: 202},
+	{name: "password_forgot_unknown_email", method: "POST", path: "/password/forgot", body: `{"email": "nobody@example.com"}`, status: 202},
+	{name: "password_forgot_missing_email", method: "POST", path: "/password/forgot", body: `{}`, status: 400},
+
+	{name: "password_reset", method: "POST", path: "/password/reset", body: `{"token": "$reset", "password": "a new password"}`, setup: withReset, status: 200},
+	{name: "password_reset_invalid_token", method: "POST", path: "/password/reset", body: `{"token": "unknown", "password": "a new password"}`, status: 400},
+	{name: "password_reset_short_password", method: "POST", path: "/password/reset", body: `{"token": "$reset", "password": "short"}`, setup: withReset, status: 400},
+
+	{name: "me", method: "GET", path: "/v1/me", as: "user", status: 200},
+	{name: "me_admin", method: "GET", path: "/v1/me", as: "root", status: 200},
+	{name: "me_without_token", method: "GET", path: "/v1/me", status: 401},
+	{name: "me_invalid_token", method: "GET", path: "/v1/me", header: map[string]string{"Authorization": "Bearer not.a.token"}, status: 401},
+
+	{name: "security", method: "GET", path: "/users/me/security", as: "user",
+		setup: func(t *testing.T, app *testApp, vars map[string]string) {
+			withSession(t, app, vars)
+			withFailure(t, app, vars)
+		}, status: 200},
+	{name: "security_locked", method: "GET", path: "/users/me/security", as: "user", setup: withLock, status: 200},
+	{name: "security_without_token", method: "GET", path: "/users/me/security", status: 401},
+
+	{name: "mail_preview", method: "POST", path: "/mail/preview", as: "admin",
+		body: `{"template": "password_reset", "to": "ada@example.com", "data": {"Name": "Ada", "Link": "https://app.example.com/reset?token=x", "ExpiresAt": "soon"}}`, status: 200},
+	{name: "mail_preview_version", method: "POST", path: "/mail/preview", as: "admin", setup: withVersions,
+		body: `{"template": "password_reset", "version": 2, "data": {"Name": "Ada", "Link": "https://app.example.com/reset?token=x", "ExpiresAt": "soon"}}`, status: 200},
+	{name: "mail_preview_missing_template", method: "POST", path: "/mail/preview", as: "admin", body: `{"data": {}}`, status: 400},
+	{name: "mail_preview_unknown_template", method: "POST", path: "/mail/preview", as: "admin", body: `{"template": "welcome", "data": {}}`, status: 422},
+	{name: "mail_preview_missing_variable", method: "POST", path: "/mail/preview", as: "admin", body: `{"template": "password_reset", "data": {"Name": "Ada"}}`, status: 422},
+	{name: "mail_preview_unknown_version", method: "POST", path: "/mail/preview", as: "admin", body: `{"template": "password_reset", "version": 7, "data": {}}`, status: 404},
+
+	{name: "mail_captured", method: "GET", path: "/admin/mail/captured", as: "admin", setup: withCapturedMail, status: 200},
+	{name: "mail_captured_not_dry_run", method: "GET", path: "/admin/mail/captured", as: "admin", setup: withoutCapture, status: 404},
+	{name: "mail_captured_clear", method: "DELETE", path: "/admin/mail/captured", as: "admin", setup: withCapturedMail, status: 204},
+	{name: "mail_captured_clear_not_dry_run", method: "DELETE", path: "/admin/mail/captured", as: "admin", setup: withoutCapture, status: 404},
+
+	{name: "mail_templates", method: "GET", path: "/admin/mail/templates", as: "admin", setup: withRollout, status: 200},
+	{name: "mail_template", method: "GET", path: "/admin/mail/templates/password_reset", as: "admin", setup: withRollout, status: 200},
+	{name: "mail_template_unknown", method: "GET", path: "/admin/mail/templates/welcome", as: "admin", status: 404},
+	{name: "mail_template_delete", method: "DELETE", path: "/admin/mail/templates/password_reset", as: "admin", setup: withRollout, status: 200},
+	{name: "mail_template_delete_no_versions", method: "DELETE", path: "/admin/mail/templates/password_reset", as: "admin", status: 404},
+	{name: "mail_template_version_create", method: "POST", path: "/admin/mail/templates/password_reset/versions", as: "admin",
+		body: `{"text": "{{define \"subject\"}}Reset{{end}}Hello {{.Name}}, {{.Link}}", "html": "<p>Hello {{.Name}}</p>"}`, status: 201},
+	{name: "mail_template_version_create_no_subject", method: "POST", path: "/admin/mail/templates/password_reset/versions", as: "admin",
+		body: `{"text": "Hello {{.Name}}"}`, status: 422},
+	{name: "mail_template_version_create_unknown", method: "POST", path: "/admin/mail/templates/welcome/versions", as: "admin",
+		body: `{"text": "{{define \"subject\"}}Hi{{end}}"}`, status: 404},
+	{name: "mail_template_version", method: "GET", path: "/admin/mail/templates/password_reset/versions/2", as: "admin", setup: withVersions, status: 200},
+	{name: "mail_template_version_not_found", method: "GET", path: "/admin/mail/templates/password_reset/versions/3", as: "admin", setup: withVersions, status: 404},
+	{name: "mail_template_version_invalid", method: "GET", path: "/admin/mail/templates/password_reset/versions/latest", as: "admin", status: 404},
+	{name: "mail_template_version_delete", method: "DELETE", path: "/admin/mail/templates/password_reset/versions/2", as: "admin", setup: withVersions, status: 200},
+	{name: "mail_template_version_delete_in_use", method: "DELETE", path: "/admin/mail/templates/password_reset/versions/2", as: "admin", setup: withRollout, status: 409},
+	{name: "mail_template_version_delete_not_found", method: "DELETE", path: "/admin/mail/templates/password_reset/versions/3", as: "admin", setup: withVersions, status: 404},
+	{name: "mail_template_rollout", method: "PUT", path: "/admin/mail/templates/password_reset/rollout", as: "admin", setup: withVersions,
+		body: `{"stable_version": 1, "candidate_version": 2, "percent": 25}`, status: 200},
+	{name: "mail_template_rollout_complete", method: "PUT", path: "/admin/mail/templates/password_reset/rollout", as: "admin", setup: withRollout,
+		body: `{"candidate_version": 2, "percent": 100}`, status: 200},
+	{name: "mail_template_rollout_unknown_version", method: "PUT", path: "/admin/mail/templates/password_reset/rollout", as: "admin", setup: withVersions,
+		body: `{"candidate_version": 5, "percent": 25}`, status: 404},
+	{name: "mail_template_rollout_invalid_percent", method: "PUT", path: "/admin/mail/templates/password_reset/rollout", as: "admin",
+		body: `{"candidate_version": 2, "percent": 101}`, status: 400},
+	{name: "mail_template_rollback", method: "POST", path: "/admin/mail/templates/password_reset/rollback", as: "admin", setup: withRollout, status: 200},
+	{name: "mail_template_rollback_no_candidate", method: "POST", path: "/admin/mail/templates/password_reset/rollback", as: "admin", setup: withVersions, status: 409},
+
+	{name: "mail_opened", method: "GET", path: "/mail/t/$message/o", setup: withTrackedMail, status: 200},
+	{name: "mail_opened_unknown", method: "GET", path: "/mail/t/unknown/o", status: 200},
+	{name: "mail_clicked", method: "GET", path: "/mail/t/$message/c/0", setup: withTrackedMail, status: 302},
+	{name: "mail_clicked_unknown_link", method: "GET", path: "/mail/t/$message/c/1", setup: withTrackedMail, status: 404},
+	{name: "mail_clicked_invalid_link", method: "GET", path: "/mail/t/$message/c/first", setup: withTrackedMail, status: 404},
+	{name: "mail_message", method: "GET", path: "/admin/mail/messages/$message", as: "admin",
+		setup: func(t *testing.T, app *testApp, vars map[string]string) {
+			withTrackedMail(t, app, vars)
+			app.Models.MailMessage.Opened(vars["message"])
+			app.Models.MailMessage.Clicked(vars["message"])
+		}, status: 200},
+	{name: "mail_message_not_found", method: "GET", path: "/admin/mail/messages/unknown", as: "admin", status: 404},
+	{name: "mail_tracking", method: "GET", path: "/v1/me/mail-tracking", as: "user", status: 200},
+	{name: "mail_tracking_without_token", method: "GET", path: "/v1/me/mail-tracking", status: 401},
+	{name: "mail_tracking_set", method: "PUT", path: "/v1/me/mail-tracking", as: "user", body: `{"allowed": false}`, status: 200},
+	{name: "mail_tracking_set_missing", method: "PUT", path: "/v1/me/mail-tracking", as: "user", body: `{}`, status: 400},
+
+	{name: "mail_inbound", method: "POST", path: "/mail/inbound", header: inboundSecret, body: inboundReply, setup: withThread, status: 200},
+	{name: "mail_inbound_unknown_thread", method: "POST", path: "/mail/inbound", header: inboundSecret, body: inboundReply,
+		setup: func(t *testing.T, app *testApp, vars map[string]string) { vars["thread"] = "unknown" }, status: 200},
+	{name: "mail_inbound_other_sender", method: "POST", path: "/mail/inbound", header: inboundSecret,
+		body: strings.Replace(inboundReply, "ada@example.com", "eve@example.com", 1), setup: withThread, status: 200},
+	{name: "mail_inbound_invalid_mail", method: "POST", path: "/mail/inbound", header: inboundSecret, body: "Subject: no sender\r\n\r\nhi\r\n", status: 400},
+	{name: "mail_inbound_wrong_secret", method: "POST", path: "/mail/inbound", header: map[string]string{"Authorization": "Bearer guess"}, body: inboundReply, status: 401},
+	{name: "mail_inbound_disabled", method: "POST", path: "/mail/inbound", header: inboundSecret, body: inboundReply,
+		setup: func(t *testing.T, app *testApp, vars map[string]string) { app.MailInbound = nil }, status: 404},
+
+	{name: "users", method: "GET", path: "/admin/users", as: "admin", status: 200},
+	{name: "users_search", method: "GET", path: "/admin/users?q=ada&active=true&sort=-email&per_page=10", as: "admin", status: 200},
+	{name: "users_invalid_active", method: "GET", path: "/admin/users?active=maybe", as: "admin", status: 400},
+	{name: "users_invalid_page", method: "GET", path: "/admin/users?page=first", as: "admin", status: 400},
+	{name: "users_invalid_sort", method: "GET", path: "/admin/users?sort=password", as: "admin", status: 400},
+	{name: "user", method: "GET", path: "/admin/users/1", as: "admin", status: 200},
+	{name: "user_not_found", method: "GET", path: "/admin/users/404", as: "admin", status: 404},
+	{name: "user_invalid_id", method: "GET", path: "/admin/users/ada", as: "admin", status: 400},
+	{name: "user_update", method: "PATCH", path: "/admin/users/1", as: "admin", body: `{"first_name": "Augusta", "active": false}`, status: 200},
+	{name: "user_update_nothing", method: "PATCH", path: "/admin/users/1", as: "admin", body: `{}`, status: 400},
+	{name: "user_update_invalid_email", method: "PATCH", path: "/admin/users/1", as: "admin", body: `{"email": "ada at example"}`, status: 400},
+	{name: "user_update_email_taken", method: "PATCH", path: "/admin/users/1", as: "admin", body: `{"email": "root@example.com"}`, status: 409},
+	{name: "user_update_not_found", method: "PATCH", path: "/admin/users/404", as: "admin", body: `{"first_name": "Nobody"}`, status: 404},
+	{name: "user_delete", method: "DELETE", path: "/admin/users/1", as: "admin", status: 204},
+	{name: "user_delete_logger_refused", method: "DELETE", path: "/admin/users/1", as: "admin",
+		setup: func(t *testing.T, app *testApp, vars map[string]string) { app.LoggerKey = "" }, status: 200},
+	{name: "user_delete_not_found", method: "DELETE", path: "/admin/users/404", as: "admin", status: 404},
+
+	{name: "roles", method: "GET", path: "/admin/roles", as: "admin", setup: withRole, status: 200},
+	{name: "role_create", method: "POST", path: "/admin/roles", as: "admin", body: `{"name": "support", "description": "Answers tickets", "permissions": ["users:read"]}`, status: 201},
+	{name: "role_create_exists", method: "POST", path: "/admin/roles", as: "admin", body: `{"name": "admin", "permissions": []}`, status: 409},
+	{name: "role_create_invalid_name", method: "POST", path: "/admin/roles", as: "admin", body: `{"name": "Support Team"}`, status: 400},
+	{name: "role", method: "GET", path: "/admin/roles/admin", as: "admin", status: 200},
+	{name: "role_not_found", method: "GET", path: "/admin/roles/support", as: "admin", status: 404},
+	{name: "role_update", method: "PUT", path: "/admin/roles/support", as: "admin", setup: withRole, body: `{"description": "Reads users", "permissions": ["users:read", "logs:read"]}`, status: 200},
+	{name: "role_update_not_found", method: "PUT", path: "/admin/roles/support", as: "admin", body: `{"description": "Reads users"}`, status: 404},
+	{name: "role_delete", method: "DELETE", path: "/admin/roles/support", as: "admin", setup: withSupport, status: 204},
+	{name: "role_delete_builtin", method: "DELETE", path: "/admin/roles/admin", as: "admin", status: 409},
+	{name: "role_delete_not_found", method: "DELETE", path: "/admin/roles/support", as: "admin", status: 404},
+	{name: "user_roles", method: "GET", path: "/admin/users/1/roles", as: "admin", setup: withSupport, status: 200},
+	{name: "user_roles_invalid_id", method: "GET", path: "/admin/users/ada/roles", as: "admin", status: 400},
+	{name: "user_role_assign", method: "PUT", path: "/admin/users/1/roles/support", as: "admin", setup: withRole, status: 200},
+	{name: "user_role_assign_unknown_role", method: "PUT", path: "/admin/users/1/roles/support", as: "admin", status: 404},
+	{name: "user_role_assign_unknown_user", method: "PUT", path: "/admin/users/404/roles/user", as: "admin", status: 404},
+	{name: "user_role_revoke", method: "DELETE", path: "/admin/users/1/roles/support", as: "admin", setup: withSupport, status: 200},
+	{name: "user_role_revoke_not_held", method: "DELETE", path: "/admin/users/1/roles/admin", as: "admin", status: 404},
+	{name: "roles_sync", method: "POST", path: "/admin/roles/sync", as: "admin",
+		body: `[{"email": "ada@example.com", "groups": ["engineering"]}, {"email": "alan@example.com", "groups": ["sales"]}]`, status: 200},
+	{name: "roles_sync_dry_run", method: "POST", path: "/admin/roles/sync?dry_run=true", as: "admin",
+		body: `[{"email": "ada@example.com", "groups": ["engineering"]}]`, status: 200},
+	{name: "roles_sync_csv", method: "POST", path: "/admin/roles/sync", as: "admin", header: map[string]string{"Content-Type": "text/csv"},
+		body: "email,group\nada@example.com,engineering\n", status: 200},
+	{name: "roles_sync_too_many_revokes", method: "POST", path: "/admin/roles/sync", as: "admin", body: `[]`,
+		setup: func(t *testing.T, app *testApp, vars map[string]string) { app.GroupSyncMaxRevoke = 1 }, status: 422},
+	{name: "roles_sync_unmapped", method: "POST", path: "/admin/roles/sync", as: "admin", body: `[]`,
+		setup: func(t *testing.T, app *testApp, vars map[string]string) { app.GroupRoles = nil }, status: 409},
+	{name: "roles_sync_bad_body", method: "POST", path: "/admin/roles/sync", as: "admin", body: `{"email": "ada@example.com"}`, status: 400},
+
+	{name: "lock", method: "GET", path: "/admin/users/1/lock", as: "admin", setup: withLock, status: 200},
+	{name: "lock_not_locked", method: "GET", path: "/admin/users/1/lock", as: "admin", setup: withFailure, status: 200},
+	{name: "lock_invalid_id", method: "GET", path: "/admin/users/ada/lock", as: "admin", status: 400},
+	{name: "unlock", method: "DELETE", path: "/admin/users/1/lock", as: "admin", setup: withLock, status: 204},
+	{name: "unlock_not_locked", method: "DELETE", path: "/admin/users/1/lock", as: "admin", status: 404},
+	{name: "unlock_unknown_user", method: "DELETE", path: "/admin/users/404/lock", as: "admin", status: 404},
+
+	{name: "users_bulk", method: "POST", path: "/admin/users/bulk", as: "admin", body: `{"operation": "deactivate", "ids": [1, 404]}`, status: 200},
+	{name: "users_bulk_async", method: "POST", path: "/admin/users/bulk?async=true", as: "admin", body: `{"operation": "assign_role", "ids": [1], "role": "admin"}`, status: 202},
+	{name: "users_bulk_unknown_operation", method: "POST", path: "/admin/users/bulk", as: "admin", body: `{"operation": "promote", "ids": [1]}`, status: 400},
+	{name: "users_bulk_missing_role", method: "POST", path: "/admin/users/bulk", as: "admin", body: `{"operation": "assign_role", "ids": [1]}`, status: 400},
+	{name: "job", method: "GET", path: "/jobs/$job", as: "admin", setup: withJob, status: 200},
+	{name: "job_not_found", method: "GET", path: "/jobs/unknown", as: "admin", status: 404},
+
+	{name: "users_merge", method: "POST", path: "/admin/users/merge", as: "admin", body: `{"source_id": 3, "target_id": 1, "actor": "root@example.com"}`, status: 200},
+	{name: "users_merge_dry_run", method: "POST", path: "/admin/users/merge", as: "admin", body: `{"source_id": 3, "target_id": 1, "dry_run": true}`, status: 200},
+	{name: "users_merge_missing_ids", method: "POST", path: "/admin/users/merge", as: "admin", body: `{"source_id": 3}`, status: 400},
+	{name: "users_merge_not_found", method: "POST", path: "/admin/users/merge", as: "admin", body: `{"source_id": 404, "target_id": 1}`, status: 404},
+	{name: "users_merge_same_user", method: "POST", path: "/admin/users/merge", as: "admin", body: `{"source_id": 1, "target_id": 1}`, status: 400},
+	{name: "users_merges", method: "GET", path: "/admin/users/merges", as: "admin", status: 200},
+	{name: "users_merges_invalid_limit", method: "GET", path: "/admin/users/merges?limit=5000", as: "admin", status: 400},
+
+	{name: "elevation_request", method: "POST", path: "/admin/elevations", as: "root", body: `{"user_id": 1, "role": "admin", "duration": "2h", "reason": "incident 42"}`, status: 201},
+	{name: "elevation_request_invalid_duration", method: "POST", path: "/admin/elevations", as: "admin", body: `{"user_id": 1, "role": "admin", "duration": "two hours", "reason": "incident 42"}`, status: 400},
+	{name: "elevation_request_missing_reason", method: "POST", path: "/admin/elevations", as: "admin", body: `{"user_id": 1, "role": "admin", "duration": "2h"}`, status: 400},
+	{name: "elevation_request_unknown_user", method: "POST", path: "/admin/elevations", as: "admin", body: `{"user_id": 404, "role": "admin", "duration": "2h", "reason": "incident 42"}`, status: 404},
+	{name: "elevations", method: "GET", path: "/admin/elevations", as: "admin", status: 200},
+	{name: "elevations_pending", method: "GET", path: "/admin/elevations?status=pending", as: "admin", status: 200},
+	{name: "elevations_invalid_limit", method: "GET", path: "/admin/elevations?limit=0", as: "admin", status: 400},
+	{name: "elevation", method: "GET", path: "/admin/elevations/1", as: "admin", status: 200},
+	{name: "elevation_not_found", method: "GET", path: "/admin/elevations/404", as: "admin", status: 404},
+	{name: "elevation_invalid_id", method: "GET", path: "/admin/elevations/first", as: "admin", status: 400},
+	{name: "elevation_approve", method: "POST", path: "/admin/elevations/1/approve", as: "root", status: 200},
+	{name: "elevation_approve_own_request", method: "POST", path: "/admin/elevations/3/approve", as: "admin", status: 403},
+	{name: "elevation_approve_decided", method: "POST", path: "/admin/elevations/2/approve", as: "root", status: 409},
+	{name: "elevation_approve_not_found", method: "POST", path: "/admin/elevations/404/approve", as: "root", status: 404},
+	{name: "elevation_deny", method: "POST", path: "/admin/elevations/1/deny", as: "root", status: 200},
+	{name: "elevation_deny_decided", method: "POST", path: "/admin/elevations/2/deny", as: "root", status: 409},
+	{name: "elevation_revoke", method: "POST", path: "/admin/elevations/2/revoke", as: "admin", status: 200},
+	{name: "elevation_revoke_pending", method: "POST", path: "/admin/elevations/1/revoke", as: "admin", status: 409},
+	{name: "elevation_revoke_invalid_id", method: "POST", path: "/admin/elevations/first/revoke", as: "admin", status: 400},
+
+	{name: "keys", method: "GET", path: "/admin/keys", as: "admin", status: 200},
+	{name: "key_revoke", method: "POST", path: "/admin/keys/leaked-key/revoke", as: "admin", status: 200},
+	{name: "key_revoke_as_user", method: "POST", path: "/admin/keys/leaked-key/revoke", as: "user", status: 403},
+}
+
+// scriptedUserAdmin stands in for PostgresUserAdmin, whose transactions the
+// memory repositories do not cover. It answers from fixed records and the
+// users it is given: elevation 1 is pending, 2 approved and 3 was requested
+// with the shared admin key.
+type scriptedUserAdmin struct {
+	users data.UserRepository
+
+	elevations map[int]*data.Elevation
+}
+
+func newScriptedUserAdmin(users data.UserRepository) *scriptedUserAdmin {
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	expires := at.Add(2 * time.Hour)
+
+	return &scriptedUserAdmin{
+		users: users,
+		elevations: map[int]*data.Elevation{
+			1: {ID: 1, UserID: 1, Role: data.RoleAdmin, Reason: "incident 41", Duration: 7200, Status: data.ElevationPending, RequestedBy: "lead@example.com", CreatedAt: at},
+			2: {ID: 2, UserID: 1, Role: data.RoleAdmin, Reason: "incident 40", Duration: 7200, Status: data.ElevationApproved, RequestedBy: "lead@example.com", DecidedBy: "root@example.com", CreatedAt: at, DecidedAt: &at, ExpiresAt: &expires},
+			3: {ID: 3, UserID: 1, Role: data.RoleAdmin, Reason: "incident 39", Duration: 7200, Status: data.ElevationPending, RequestedBy: "admin-key", CreatedAt: at},
+		},
+	}
+}
+
+func (a *scriptedUserAdmin) Bulk(operation string, ids []int, role string, progress data.ProgressFunc) ([]data.BulkResult, error) {
+	results := make([]data.BulkResult, 0, len(ids))
+	for _, id := range ids {
+		status := data.BulkOK
+		if _, err := a.users.GetOne(id); err != nil {
+			status = data.BulkNotFound
+		}
+		results = append(results, data.BulkResult{ID: id, Status: status})
+	}
+	return results, nil
+}
+
+func (a *scriptedUserAdmin) Merge(sourceID, targetID int, actor string, dryRun bool) (*data.MergeResult, error) {
+	if sourceID == targetID {
+		return nil, errors.New("can not merge a user into itself")
+	}
+
+	source, err := a.users.GetOne(sourceID)
+	if err != nil {
+		return nil, err
+	}
+	target, err := a.users.GetOne(targetID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &data.MergeResult{
+		SourceID:     source.ID,
+		TargetID:     target.ID,
+		SourceEmail:  source.Email,
+		TargetEmail:  target.Email,
+		RolesMoved:   []string{},
+		FieldsFilled: []string{},
+		Activated:    !target.Active && source.Active,
+		DryRun:       dryRun,
+	}
+	if !dryRun {
+		result.MergeID = 1
+	}
+	return result, nil
+}
+
+func (a *scriptedUserAdmin) Merges(limit int) ([]data.UserMerge, error) {
+	return []data.UserMerge{{
+		ID: 1, SourceID: 4, TargetID: 1, SourceEmail: "ada@old.example.com", TargetEmail: "ada@example.com",
+		Actor: "root@example.com", Details: json.RawMessage(`{"roles_moved":[]}`), CreatedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	}}, nil
+}
+
+// SyncRoles assigns the mapped roles to the known members and revokes nothing.
+// An empty directory would revoke the admin role of root@example.com, which
+// maxRevoke above zero refuses.
+func (a *scriptedUserAdmin) SyncRoles(members []data.GroupMembership, groupRoles map[string][]string, maxRevoke int, dryRun bool) (*data.RoleSyncReport, error) {
+	if len(members) == 0 && maxRevoke > 0 {
+		return nil, fmt.Errorf("%w: 2 revokes, at most %d allowed", data.ErrRoleSyncGuard, maxRevoke)
+	}
+
+	report := &data.RoleSyncReport{DryRun: dryRun, Assigned: []data.RoleSyncChange{}, Revoked: []data.RoleSyncChange{}, UnknownUsers: []string{}, UnmappedGroups: []string{}}
+	for _, member := range members {
+		user, err := a.users.GetByEmail(member.Email)
+		if err != nil {
+			report.UnknownUsers = append(report.UnknownUsers, member.Email)
+			continue
+		}
+		for _, group := range member.Groups {
+			roles, ok := groupRoles[group]
+			if !ok {
+				report.UnmappedGroups = append(report.UnmappedGroups, group)
+				continue
+			}
+			for _, role := range roles {
+				report.Assigned = append(report.Assigned, data.RoleSyncChange{UserID: user.ID, Email: user.Email, Role: role})
+			}
+		}
+	}
+	return report, nil
+}
+
+func (a *scriptedUserAdmin) RequestElevation(userID int, role, reason string, duration time.Duration, requestedBy string) (*data.Elevation, error) {
+	if reason == "" {
+		return nil, errors.New("a reason is required")
+	}
+	if _, err := a.users.GetOne(userID); err != nil {
+		return nil, err
+	}
+
+	return &data.Elevation{
+		ID: 4, UserID: userID, Role: role, Reason: reason, Duration: int(duration / time.Second),
+		Status: data.ElevationPending, RequestedBy: requestedBy, CreatedAt: time.Now(),
+	}, nil
+}
+
+func (a *scriptedUserAdmin) GetElevation(id int) (*data.Elevation, error) {
+	e, ok := a.elevations[id]
+	if !ok {
+		return nil, data.ErrElevationNotFound
+	}
+	c := *e
+	return &c, nil
+}
+
+func (a *scriptedUserAdmin) Elevations(status string, limit int) ([]*data.Elevation, error) {
+	elevations := []*data.Elevation{}
+	for id := 1; id <= len(a.elevations); id++ {
+		if e := a.elevations[id]; status == "" || e.Status == status {
+			elevations = append(elevations, e)
+		}
+	}
+	return elevations, nil
+}
+
+func (a *scriptedUserAdmin) ApproveElevation(id int, approver string) (*data.Elevation, error) {
+	return a.decide(id, approver, data.ElevationApproved)
+}
+
+func (a *scriptedUserAdmin) DenyElevation(id int, approver string) (*data.Elevation, error) {
+	return a.decide(id, approver, data.ElevationDenied)
+}
+
+func (a *scriptedUserAdmin) decide(id int, approver, status string) (*data.Elevation, error) {
+	e, err := a.GetElevation(id)
+	if err != nil {
+		return nil, err
+	}
+	if e.Status != data.ElevationPending {
+		return nil, data.ErrElevationState
+	}
+	if e.RequestedBy == approver {
+		return nil, data.ErrSelfApproval
+	}
+
+	now := time.Now()
+	e.Status, e.DecidedBy, e.DecidedAt = status, approver, &now
+	if status == data.ElevationApproved {
+		expires := now.Add(time.Duration(e.Duration) * time.Second)
+		e.ExpiresAt = &expires
+	}
+	return e, nil
+}
+
+func (a *scriptedUserAdmin) RevokeElevation(id int) (*data.Elevation, error) {
+	e, err := a.GetElevation(id)
+	if err != nil {
+		return nil, err
+	}
+	if e.Status != data.ElevationApproved {
+		return nil, data.ErrElevationState
+	}
+
+	e.Status = data.ElevationRevoked
+	return e, nil
+}
+
+func (a *scriptedUserAdmin) RevokeExpiredRoles() ([]data.ExpiredRole, error) {
+	return nil, nil
+}
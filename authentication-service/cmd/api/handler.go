@@ -2,19 +2,18 @@ package main
 
 import (
 	"authentication/data"
-	"bytes"
-	"encoding/json"
+	"context"
+	v1 "contracts/v1"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 func (app *Config) Authenticate(w http.ResponseWriter, r *http.Request) {
-	var requestPayload struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
+	var requestPayload v1.AuthRequest
 
 	err := app.readJson(w, r, &requestPayload)
 	if err != nil {
@@ -22,72 +21,124 @@ func (app *Config) Authenticate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// accounts and addresses with recent failures wait longer and longer
+	throttle := app.loginThrottle(r, requestPayload.Email)
+	if ok, retry := throttle.wait(r.Context()); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(retry/time.Second)+1))
+		app.errorJson(w, errors.New("too many failed logins, try again later"), http.StatusTooManyRequests)
+		return
+	}
+
 	//validate the user against the database
 	user, err := app.Models.User.GetByEmail(requestPayload.Email)
 
 	if err != nil {
+		throttle.failed(r.Context())
 		app.errorJson(w, errors.New("Invalid credentials 1"), http.StatusBadRequest)
 		return
 	}
 
-	//log authenticate
-	err = app.logRequest("authentication", fmt.Sprintf("%s logged in", user.Email))
-
-	if err != nil {
-		app.errorJson(w, err)
+	// locked accounts are refused before their password is checked
+	lock, err := app.Models.AccountLock.Get(user.ID)
+	if err == nil {
+		app.lockedJson(w, lock)
+		return
+	}
+	if !errors.Is(err, data.ErrNotLocked) {
+		app.errorJson(w, err, http.StatusInternalServerError)
 		return
 	}
 
 	valid, err := user.PasswordMatches(requestPayload.Password)
 
+	if errors.Is(err, data.ErrHasherBusy) {
+		app.busyJson(w, err)
+		return
+	}
+
 	if err != nil || !valid {
+		throttle.failed(r.Context())
+
+		lock, err := app.Models.AccountLock.Failed(user.ID, throttle.ip)
+		if err != nil {
+			log.Println("Error recording the failed login:", err)
+		}
+		if lock != nil {
+			app.logLock(user, lock)
+			app.lockedJson(w, lock)
+			return
+		}
+
 		app.errorJson(w, errors.New("Invalid credentials 2"), http.StatusBadRequest)
+		return
+	}
+
+	// deactivated accounts are told so only once the password matched
+	if !user.Active {
+		app.errorJson(w, errAccountInactive, http.StatusForbidden)
+		return
+	}
+
+	throttle.succeeded(r.Context())
+	if err := app.Models.AccountLock.Succeeded(user.ID); err != nil {
+		log.Println("Error clearing the failed logins:", err)
+	}
+	app.recordLogin(r.Context(), user.ID)
+
+	// only a required logger fails the login, see LogDelivery
+	if err := app.logUserRequest("authentication", fmt.Sprintf("%s logged in", user.Email), user.ID); err != nil {
+		app.errorJson(w, err, http.StatusServiceUnavailable)
+		return
+	}
+
+	response := v1.AuthResponse{User: newUserV1(user)}
+
+	if app.Tokens.Enabled() {
+		if err := app.accessToken(user, &response); err != nil {
+			app.errorJson(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		refresh, issued, err := app.Models.RefreshToken.Issue(user.ID, app.RefreshTTL)
+		if err != nil {
+			app.errorJson(w, err, http.StatusInternalServerError)
+			return
+		}
+		response.RefreshToken, response.RefreshExpiresAt = refresh, &issued.ExpiresAt
 	}
 
 	payload := jsonReponse{
 		Error:   false,
 		Message: fmt.Sprintf("Logged in user %s", user.Email),
-		Data:    user,
+		Data:    response,
 	}
 
 	app.writeJson(w, http.StatusAccepted, payload)
 }
 
 func (app *Config) logRequest(name, data string) error {
-	var entry struct {
-		Name string `json:"name"`
-		Data string `json:"data"`
-	}
+	return app.logUserRequest(name, data, 0)
+}
+
+// logUserRequest logs an entry linked to a user account, listed with the
+// user's entries by the logger and unlinked when DeleteUser has it forget
+// them. Under the best-effort LOG_POLICY it never fails, entries the logger did
+// not take are queued.
+func (app *Config) logUserRequest(name, data string, userID int) error {
+	var entry v1.LogEntry
 
 	entry.Name = name
 	entry.Data = data
-
-	jsonData, _ := json.MarshalIndent(entry, "", "\t")
-	logServiceURL := "http://logger-service/log"
-
-	request, err := http.NewRequest("POST", logServiceURL, bytes.NewBuffer(jsonData))
-
-	if err != nil {
-		return err
+	entry.Version = version
+	if userID > 0 {
+		entry.UserID = strconv.Itoa(userID)
 	}
 
-	client := &http.Client{}
-	_, err = client.Do(request)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return app.LogDelivery.Do(context.Background(), entry)
 }
 
 func (app *Config) Register(w http.ResponseWriter, r *http.Request) {
-	var requestPayload struct {
-		Email     string `json:"email"`
-		Password  string `json:"password"`
-		FirstName string `json:"firstname"`
-		LastName  string `json:"lastname"`
-		Active    bool   `json:"active"`
-	}
+	var requestPayload v1.RegisterRequest
 
 	err := app.readJson(w, r, &requestPayload)
 	if err != nil {
@@ -103,6 +154,14 @@ func (app *Config) Register(w http.ResponseWriter, r *http.Request) {
 	newUser.Active = requestPayload.Active
 
 	userID, err := app.Models.User.Insert(newUser)
+	if errors.Is(err, data.ErrHasherBusy) {
+		app.busyJson(w, err)
+		return
+	}
+	if errors.Is(err, data.ErrEmailTaken) {
+		app.errorJson(w, err, http.StatusConflict)
+		return
+	}
 	if err != nil {
 		log.Printf("Error inserting user into database: %v", err) // Log chi tiết lỗi
 		app.errorJson(w, errors.New("Unable to insert user into database"), http.StatusInternalServerError)
@@ -118,7 +177,12 @@ func (app *Config) Register(w http.ResponseWriter, r *http.Request) {
 	payload := jsonReponse{
 		Error:   false,
 		Message: fmt.Sprintf("User %s successfully registered", user.Email),
-		Data:    user,
+		Data:    newUserV1(user),
+	}
+
+	// firstname and lastname still work, but callers should move on
+	if requestPayload.Legacy {
+		w.Header().Set("Deprecation", "true")
 	}
 
 	app.writeJson(w, http.StatusAccepted, payload)
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"authentication/data"
+	"bytes"
+	"context"
+	"contracts/keystore"
+	"contracts/policy"
+	"contracts/token"
+	v1 "contracts/v1"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testApp is the service on the in-memory repositories, with access tokens
+// and a logger that keeps the entries
+type testApp struct {
+	*Config
+
+	mu      sync.Mutex
+	entries []v1.LogEntry
+}
+
+func newTestApp(t *testing.T) *testApp {
+	data.ConfigureHasher(0, 0, bcrypt.MinCost)
+	data.ConfigureLockout(3, time.Minute, time.Minute)
+	t.Cleanup(func() {
+		data.ConfigureHasher(0, 0, 0)
+		data.ConfigureLockout(0, 0, 0)
+	})
+
+	keys := keystore.New()
+	keys.AddSecrets(keystore.PurposeTokens, []string{"test-token-secret"})
+
+	users := data.NewMemoryUsers()
+	tokens := data.NewMemoryRefreshTokens()
+
+	app := &testApp{}
+	app.Config = &Config{
+		Models: data.Models{
+			User:          users,
+			Job:           data.NewMemoryJobs(),
+			RefreshToken:  tokens,
+			PasswordReset: data.NewMemoryPasswordResets(users, tokens),
+			AccountLock:   data.NewMemoryAccountLocks(),
+			Role:          data.NewMemoryRoles(users),
+			MailMessage:   data.NewMemoryMailMessages(),
+			MailThread:    data.NewMemoryMailThreads(),
+			MailTemplate:  data.NewMemoryMailTemplates(),
+		},
+		Keys:     keys,
+		Tokens:   token.Issuer{Keys: keys, Name: tokenIssuer, TTL: time.Minute},
+		Verifier: token.Verifier{Keys: keys, Issuer: tokenIssuer},
+	}
+	app.LogDelivery = policy.New("logger-service", policy.Required, 0, func(ctx context.Context, entry v1.LogEntry) error {
+		app.mu.Lock()
+		defer app.mu.Unlock()
+		app.entries = append(app.entries, entry)
+		return nil
+	})
+
+	return app
+}
+
+// call serves r with handler and decodes the data of the answer into out
+func call(t *testing.T, handler http.HandlerFunc, r *http.Request, out any) *httptest.ResponseRecorder {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	if out != nil {
+		response := v1.Response[json.RawMessage]{}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%s: %v", w.Body, err)
+		}
+		if len(response.Data) > 0 {
+			if err := json.Unmarshal(response.Data, out); err != nil {
+				t.Fatalf("%s: %v", response.Data, err)
+			}
+		}
+	}
+
+	return w
+}
+
+func post(t *testing.T, body any) *http.Request {
+	t.Helper()
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("POST", "/", bytes.NewReader(b))
+	r.RemoteAddr = "192.0.2.1:1234"
+	return r
+}
+
+func (app *testApp) register(t *testing.T, email, password string) v1.AuthResponse {
+	t.Helper()
+
+	var registered v1.AuthResponse
+	w := call(t, app.Register, post(t, v1.RegisterRequest{Email: email, Password: password, Active: true}), &registered)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Register answered %d: %s", w.Code, w.Body)
+	}
+	return registered
+}
+
+func TestRegisterAuthenticate(t *testing.T) {
+	app := newTestApp(t)
+	app.register(t, "ada@example.com", "correct horse")
+
+	w := call(t, app.Register, post(t, v1.RegisterRequest{Email: "ada@example.com", Password: "other"}), nil)
+	if w.Code != http.StatusConflict {
+		t.Errorf("second Register answered %d, want 409", w.Code)
+	}
+
+	var auth v1.AuthResponse
+	w = call(t, app.Authenticate, post(t, v1.AuthRequest{Email: "ada@example.com", Password: "correct horse"}), &auth)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Authenticate answered %d: %s", w.Code, w.Body)
+	}
+	if auth.Email != "ada@example.com" || auth.RefreshToken == "" {
+		t.Errorf("got %+v", auth)
+	}
+
+	claims, err := app.Verifier.Verify(auth.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Email != "ada@example.com" {
+		t.Errorf("token of %s", claims.Email)
+	}
+
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	if len(app.entries) == 0 || app.entries[len(app.entries)-1].UserID != claims.Subject {
+		t.Errorf("login not logged for user %s: %+v", claims.Subject, app.entries)
+	}
+}
+
+func TestAuthenticateLocksAccount(t *testing.T) {
+	app := newTestApp(t)
+	app.register(t, "ada@example.com", "correct horse")
+
+	codes := []int{}
+	for range 4 {
+		w := call(t, app.Authenticate, post(t, v1.AuthRequest{Email: "ada@example.com", Password: "wrong"}), nil)
+		codes = append(codes, w.Code)
+	}
+
+	want := []int{http.StatusBadRequest, http.StatusBadRequest, http.StatusLocked, http.StatusLocked}
+	for i := range want {
+		if codes[i] != want[i] {
+			t.Fatalf("got %v, want %v", codes, want)
+		}
+	}
+
+	// the right password does not open a locked account
+	w := call(t, app.Authenticate, post(t, v1.AuthRequest{Email: "ada@example.com", Password: "correct horse"}), nil)
+	if w.Code != http.StatusLocked || w.Header().Get("Retry-After") == "" {
+		t.Errorf("locked login answered %d", w.Code)
+	}
+}
+
+func TestRefreshRotates(t *testing.T) {
+	app := newTestApp(t)
+	app.register(t, "ada@example.com", "correct horse")
+
+	var auth v1.AuthResponse
+	call(t, app.Authenticate, post(t, v1.AuthRequest{Email: "ada@example.com", Password: "correct horse"}), &auth)
+
+	var refreshed v1.AuthResponse
+	w := call(t, app.Refresh, post(t, v1.RefreshRequest{RefreshToken: auth.RefreshToken}), &refreshed)
+	if w.Code != http.StatusOK || refreshed.RefreshToken == "" || refreshed.RefreshToken == auth.RefreshToken {
+		t.Fatalf("Refresh answered %d: %s", w.Code, w.Body)
+	}
+
+	// using the first token again revokes the session, the new one included
+	w = call(t, app.Refresh, post(t, v1.RefreshRequest{RefreshToken: auth.RefreshToken}), nil)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("reused token answered %d", w.Code)
+	}
+	w = call(t, app.Refresh, post(t, v1.RefreshRequest{RefreshToken: refreshed.RefreshToken}), nil)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("token of a revoked session answered %d", w.Code)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	app := newTestApp(t)
+	app.register(t, "ada@example.com", "correct horse")
+
+	var first, second v1.AuthResponse
+	call(t, app.Authenticate, post(t, v1.AuthRequest{Email: "ada@example.com", Password: "correct horse"}), &first)
+	call(t, app.Authenticate, post(t, v1.AuthRequest{Email: "ada@example.com", Password: "correct horse"}), &second)
+
+	w := call(t, app.Logout, post(t, v1.LogoutRequest{RefreshToken: first.RefreshToken}), nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Logout answered %d: %s", w.Code, w.Body)
+	}
+
+	if w := call(t, app.Refresh, post(t, v1.RefreshRequest{RefreshToken: first.RefreshToken}), nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("logged out token answered %d", w.Code)
+	}
+	if w := call(t, app.Refresh, post(t, v1.RefreshRequest{RefreshToken: second.RefreshToken}), nil); w.Code != http.StatusOK {
+		t.Errorf("token of the other session answered %d", w.Code)
+	}
+}
+
+func TestDeactivateRevokesSessions(t *testing.T) {
+	app := newTestApp(t)
+	registered := app.register(t, "ada@example.com", "correct horse")
+
+	var auth v1.AuthResponse
+	call(t, app.Authenticate, post(t, v1.AuthRequest{Email: "ada@example.com", Password: "correct horse"}), &auth)
+
+	active := false
+	r := post(t, v1.UserPatch{Active: &active})
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", "1")
+	r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+
+	var updated v1.User
+	w := call(t, app.UpdateUser, r, &updated)
+	if w.Code != http.StatusOK || updated.Active {
+		t.Fatalf("UpdateUser answered %d: %s", w.Code, w.Body)
+	}
+	if registered.ID != 1 {
+		t.Fatalf("registered user %d", registered.ID)
+	}
+
+	if w := call(t, app.Refresh, post(t, v1.RefreshRequest{RefreshToken: auth.RefreshToken}), nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("token of a deactivated user answered %d", w.Code)
+	}
+	if w := call(t, app.Authenticate, post(t, v1.AuthRequest{Email: "ada@example.com", Password: "correct horse"}), nil); w.Code != http.StatusForbidden {
+		t.Errorf("login of a deactivated user answered %d", w.Code)
+	}
+}
+
+func TestSecurityCenter(t *testing.T) {
+	app := newTestApp(t)
+	registered := app.register(t, "ada@example.com", "correct horse")
+
+	var first, second, refreshed v1.AuthResponse
+	call(t, app.Authenticate, post(t, v1.AuthRequest{Email: "ada@example.com", Password: "correct horse"}), &first)
+	call(t, app.Authenticate, post(t, v1.AuthRequest{Email: "ada@example.com", Password: "correct horse"}), &second)
+	call(t, app.Authenticate, post(t, v1.AuthRequest{Email: "ada@example.com", Password: "wrong"}), nil)
+	call(t, app.Logout, post(t, v1.LogoutRequest{RefreshToken: first.RefreshToken}), nil)
+	call(t, app.Refresh, post(t, v1.RefreshRequest{RefreshToken: second.RefreshToken}), &refreshed)
+
+	r := httptest.NewRequest("GET", "/users/me/security", nil)
+	r = r.WithContext(context.WithValue(r.Context(), callerKey{}, &caller{UserID: registered.ID, Email: registered.Email}))
+
+	var security struct {
+		Sessions     []data.Session       `json:"sessions"`
+		SignIns      []data.SignIn        `json:"sign_ins"`
+		FailedLogins []data.LoginFailures `json:"failed_logins"`
+	}
+	w := call(t, app.SecurityCenter, r, &security)
+	if w.Code != http.StatusOK {
+		t.Fatalf("SecurityCenter answered %d: %s", w.Code, w.Body)
+	}
+
+	// the session of the registration, if it opened one, and the refreshed
+	// login; the logged out one is gone
+	want := 1
+	if registered.RefreshToken != "" {
+		want++
+	}
+	if len(security.Sessions) != want {
+		t.Fatalf("got %d sessions, want %d: %+v", len(security.Sessions), want, security.Sessions)
+	}
+	for _, s := range security.Sessions {
+		if !s.ExpiresAt.After(time.Now()) || s.RefreshedAt.Before(s.SignedInAt) {
+			t.Errorf("session %+v", s)
+		}
+	}
+
+	// both logins and the registration, if it opened a session, the logged
+	// out one no longer active
+	active := 0
+	for _, s := range security.SignIns {
+		if s.Active {
+			active++
+		}
+	}
+	if len(security.SignIns) != want+1 || active != want {
+		t.Errorf("sign-ins %+v", security.SignIns)
+	}
+
+	if len(security.FailedLogins) != 1 || security.FailedLogins[0].Failures != 1 {
+		t.Errorf("failed logins %+v", security.FailedLogins)
+	}
+}
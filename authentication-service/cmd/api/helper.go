@@ -1,10 +1,13 @@
 package main
 
 import (
+	"contracts/negotiate"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"strings"
 )
 
 type jsonReponse struct {
@@ -13,45 +16,72 @@ type jsonReponse struct {
 	Data    any    `json:"data,omitempty"`
 }
 
+// defaultMaxBodyBytes is the request body limit when MAX_BODY_BYTES is not set
+const defaultMaxBodyBytes = 1048576 // one mega byte
+
+// readJson decodes a single JSON value from the request body into data. Unknown
+// fields, trailing values and bodies over the size limit are rejected with an
+// error that says what is wrong and where.
 func (app *Config) readJson(w http.ResponseWriter, r *http.Request, data any) error {
-	maxBytes := 1048576 // one mega byte
+	maxBytes := app.MaxBodyBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxBodyBytes
+	}
 
-	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
 
 	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
 	err := dec.Decode(data)
 	if err != nil {
-		return err
+		return decodeError(err)
 	}
 
 	err = dec.Decode(&struct{}{})
 	if err != io.EOF {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return decodeError(err)
+		}
 		return errors.New("Body must have only a single JSON value")
 	}
 	return nil
 }
 
-func (app *Config) writeJson(w http.ResponseWriter, status int, data any, headers ...http.Header) error {
-	out, err := json.Marshal(data)
-	if err != nil {
-		return err
-	}
+// decodeError turns the errors of encoding/json into messages for the caller
+func decodeError(err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var maxErr *http.MaxBytesError
 
-	if len(headers) > 0 {
-		for key, value := range headers[0] {
-			w.Header()[key] = value
+	switch {
+	case errors.As(err, &syntaxErr):
+		return fmt.Errorf("Body contains badly-formed JSON at character %d", syntaxErr.Offset)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return errors.New("Body contains badly-formed JSON")
+	case errors.As(err, &typeErr):
+		if typeErr.Field != "" {
+			return fmt.Errorf("Body contains %s for field %q, expected %s", typeErr.Value, typeErr.Field, typeErr.Type)
 		}
+		return fmt.Errorf("Body contains %s at character %d, expected %s", typeErr.Value, typeErr.Offset, typeErr.Type)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return fmt.Errorf("Body contains unknown field %s", strings.TrimPrefix(err.Error(), "json: unknown field "))
+	case errors.Is(err, io.EOF):
+		return errors.New("Body must not be empty")
+	case errors.As(err, &maxErr):
+		return fmt.Errorf("Body must not be larger than %d bytes", maxErr.Limit)
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	_, err = w.Write(out)
-	if err != nil {
-		return err
-	}
+	return err
+}
 
-	return nil
+// writeJson writes data as JSON, or as XML or MessagePack when the negotiate
+// middleware found that the client prefers them
+func (app *Config) writeJson(w http.ResponseWriter, status int, data any, headers ...http.Header) error {
+	return negotiate.Write(w, status, data, headers...)
 }
+
 func (app *Config) errorJson(w http.ResponseWriter, err error, status ...int) error {
 
 	statusCode := http.StatusBadRequest
@@ -66,3 +96,9 @@ func (app *Config) errorJson(w http.ResponseWriter, err error, status ...int) er
 
 	return app.writeJson(w, statusCode, payload)
 }
+
+// busyJson tells the caller the service is saturated and when to try again
+func (app *Config) busyJson(w http.ResponseWriter, err error) error {
+	w.Header().Set("Retry-After", "1")
+	return app.errorJson(w, err, http.StatusServiceUnavailable)
+}
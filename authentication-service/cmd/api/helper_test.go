@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	v1 "contracts/v1"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReadJson(t *testing.T) {
+	app := Config{MaxBodyBytes: 64}
+
+	tests := []struct {
+		name, body, err string
+	}{
+		{"valid", `{"email":"a@example.com","password":"secret"}`, ""},
+		{"unknown field", `{"email":"a@example.com","admin":true}`, `Body contains unknown field "admin"`},
+		{"two values", `{"email":"a@example.com"}{}`, "Body must have only a single JSON value"},
+		{"badly formed", `{"email":`, "Body contains badly-formed JSON"},
+		{"wrong type", `{"email":1}`, `Body contains number for field "email", expected string`},
+		{"too large", `{"email":"` + strings.Repeat("a", 64) + `"}`, "Body must not be larger than 64 bytes"},
+		{"empty", ``, "Body must not be empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+			var payload v1.AuthRequest
+
+			err := app.readJson(httptest.NewRecorder(), r, &payload)
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.err != "" && (err == nil || err.Error() != tt.err):
+				t.Fatalf("got error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func BenchmarkReadJson(b *testing.B) {
+	app := Config{}
+	body := []byte(`{"email":"ada@example.com","password":"correct horse battery staple","first_name":"Ada","last_name":"Lovelace","active":true}`)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r := httptest.NewRequest("POST", "/register", bytes.NewReader(body))
+		var payload v1.RegisterRequest
+		if err := app.readJson(httptest.NewRecorder(), r, &payload); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWriteJson(b *testing.B) {
+	app := Config{}
+	payload := jsonReponse{
+		Error:   false,
+		Message: "Logged in user ada@example.com",
+		Data:    v1.User{ID: 1, Email: "ada@example.com", FirstName: "Ada", LastName: "Lovelace", Active: true},
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := app.writeJson(httptest.NewRecorder(), http.StatusAccepted, payload); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// FuzzReadJson feeds readJson arbitrary bodies: it must not panic, errors must
+// have a message for the caller, and what it accepts must read back the same
+// once encoded again
+func FuzzReadJson(f *testing.F) {
+	app := Config{MaxBodyBytes: 4096}
+
+	f.Add(`{"email":"ada@example.com","password":"secret","first_name":"Ada","last_name":"Lovelace","active":true}`)
+	f.Add(`{"firstname":"Ada","lastname":"Lovelace"}`)
+	f.Add(`{"email":"é😀"}`)
+	f.Add(`{"active":"yes"}`)
+	f.Add(`[]`)
+	f.Add(`null`)
+	f.Add(`{} {}`)
+
+	f.Fuzz(func(t *testing.T, body string) {
+		var first v1.RegisterRequest
+		r := httptest.NewRequest("POST", "/register", strings.NewReader(body))
+		if err := app.readJson(httptest.NewRecorder(), r, &first); err != nil {
+			if err.Error() == "" {
+				t.Fatalf("empty error for %q", body)
+			}
+			return
+		}
+
+		encoded, err := json.Marshal(first)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var second v1.RegisterRequest
+		r = httptest.NewRequest("POST", "/register", bytes.NewReader(encoded))
+		if err := app.readJson(httptest.NewRecorder(), r, &second); err != nil {
+			t.Fatalf("reading %s back: %v", encoded, err)
+		}
+		// the legacy field names are not written back
+		first.Legacy = false
+		if first != second {
+			t.Fatalf("%q read as %+v, then as %+v", body, first, second)
+		}
+	})
+}
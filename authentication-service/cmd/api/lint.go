@@ -0,0 +1,51 @@
+package main
+
+import (
+	"contracts/configlint"
+	"contracts/keystore"
+	"os"
+)
+
+// lintConfig looks for insecure settings of the authentication service, see
+// configlint
+func lintConfig(keys *keystore.Store) *configlint.Lint {
+	var lint configlint.Lint
+
+	for i, dsn := range splitDSNs(os.Getenv("DSN"), os.Getenv("STANDBY_DSNS")) {
+		if i == 0 {
+			lint.PostgresDSN("DSN", dsn)
+		} else {
+			lint.PostgresDSN("STANDBY_DSNS", dsn)
+		}
+	}
+
+	lint.Secret("ADMIN_API_KEY", os.Getenv("ADMIN_API_KEY"))
+	lint.Secret("LOG_INGEST_TOKEN", os.Getenv("LOG_INGEST_TOKEN"))
+	if v := os.Getenv("LOGGER_ADMIN_KEY"); v != "" {
+		lint.Secret("LOGGER_ADMIN_KEY", v)
+	} else {
+		lint.Add("LOGGER_ADMIN_KEY", "no logger admin key, the log entries of deleted users are not forgotten")
+	}
+	lint.LogLevel("LOG_LEVEL", os.Getenv("LOG_LEVEL"))
+
+	if v := os.Getenv("EVENT_SIGNING_KEYS"); v != "" {
+		lint.Secret("EVENT_SIGNING_KEYS", v)
+	} else if !keys.Has(keystore.PurposeEvents) {
+		lint.Add("EVENT_SIGNING_KEYS", "no event keys, published events are not signed")
+	}
+
+	if v := os.Getenv("TOKEN_SIGNING_KEY"); v != "" {
+		lint.Secret("TOKEN_SIGNING_KEY", v)
+	} else if !keys.Has(keystore.PurposeTokens) {
+		lint.Add("TOKEN_SIGNING_KEY", "no token keys, logins return no access token")
+	}
+
+	if os.Getenv("SMTP_HOST") == "" {
+		lint.Add("SMTP_HOST", "no mail server, password reset links are not sent")
+	} else if v := os.Getenv("SMTP_PASSWORD"); v != "" {
+		lint.Secret("SMTP_PASSWORD", v)
+	}
+	lint.HTTPS("PASSWORD_RESET_URL", os.Getenv("PASSWORD_RESET_URL"))
+
+	return &lint
+}
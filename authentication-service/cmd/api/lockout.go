@@ -0,0 +1,117 @@
+package main
+
+import (
+	"authentication/data"
+	v1 "contracts/v1"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+var (
+	// errAccountLocked refuses the tokens of locked accounts, see lockedJson
+	errAccountLocked = errors.New("account locked")
+	// errAccountInactive refuses the logins and tokens of deactivated accounts
+	errAccountInactive = errors.New("account is deactivated")
+)
+
+// lockedJson refuses a login of a locked account and says until when
+func (app *Config) lockedJson(w http.ResponseWriter, lock *data.AccountLock) {
+	retry := int(time.Until(lock.LockedUntil)/time.Second) + 1
+
+	w.Header().Set("Retry-After", strconv.Itoa(retry))
+	app.writeJson(w, http.StatusLocked, jsonReponse{
+		Error:   true,
+		Message: fmt.Sprintf("account locked after too many failed logins, try again after %s", lock.LockedUntil.UTC().Format(time.RFC3339)),
+		Data: v1.LockedResponse{
+			LockedUntil: lock.LockedUntil,
+			RetryAfter:  retry,
+		},
+	})
+}
+
+func (app *Config) logLock(user *data.User, lock *data.AccountLock) {
+	message := fmt.Sprintf("%s locked until %s after %d failed logins", user.Email, lock.LockedUntil.UTC().Format(time.RFC3339), lock.Failures)
+	if err := app.logUserRequest("authentication", message, user.ID); err != nil {
+		log.Println("Error logging the account lock:", err)
+	}
+}
+
+// GetAccountLock returns the lock of an account, if any, and its recent failed
+// logins by address
+func (app *Config) GetAccountLock(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJson(w, errors.New("invalid user id"))
+		return
+	}
+
+	lock, err := app.Models.AccountLock.Get(userID)
+	if err != nil && !errors.Is(err, data.ErrNotLocked) {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	failures, err := app.Models.AccountLock.RecentFailures(userID)
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	message := "not locked"
+	if lock != nil {
+		message = "locked until " + lock.LockedUntil.UTC().Format(time.RFC3339)
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: message,
+		Data: map[string]any{
+			"user_id":  userID,
+			"locked":   lock != nil,
+			"lock":     lock,
+			"failures": failures,
+		},
+	})
+}
+
+// UnlockAccount lifts the lock of an account and forgets its failed logins,
+// including the delays of the login throttle
+func (app *Config) UnlockAccount(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJson(w, errors.New("invalid user id"))
+		return
+	}
+
+	user, err := app.Models.User.GetOne(userID)
+	if err != nil {
+		app.errorJson(w, data.ErrUserNotFound, http.StatusNotFound)
+		return
+	}
+
+	err = app.Models.AccountLock.Unlock(userID)
+	if errors.Is(err, data.ErrNotLocked) {
+		app.errorJson(w, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if app.Redis != nil {
+		app.Redis.Del(r.Context(), accountKey(user.Email))
+	}
+
+	if err := app.logUserRequest("authentication", fmt.Sprintf("%s unlocked", user.Email), userID); err != nil {
+		log.Println("Error logging the account unlock:", err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
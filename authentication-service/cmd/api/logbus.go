@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	v1 "contracts/v1"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// errLogBusDown is returned while the log bus has no connection
+var errLogBusDown = errors.New("log bus is not connected")
+
+// logBus publishes log entries to the logs exchange of RabbitMQ, so logging
+// does not wait for the logger. It connects in the background and again
+// whenever the connection drops; entries published while it is down go the
+// synchronous way, see logShipper.
+type logBus struct {
+	url string
+
+	mu     sync.Mutex
+	conn   *amqp.Connection
+	ch     *amqp.Channel
+	closed bool
+}
+
+// newLogBus connects to the RabbitMQ server at url, nil when url is empty
+func newLogBus(url string) *logBus {
+	if url == "" {
+		return nil
+	}
+
+	b := &logBus{url: url}
+	go b.connect()
+
+	return b
+}
+
+// connect keeps a channel open, waiting longer after each failed attempt up
+// to half a minute
+func (b *logBus) connect() {
+	backoff := time.Second
+
+	for {
+		b.mu.Lock()
+		closed := b.closed
+		b.mu.Unlock()
+		if closed {
+			return
+		}
+
+		conn, err := amqp.Dial(b.url)
+		if err == nil {
+			var ch *amqp.Channel
+			ch, err = conn.Channel()
+			if err == nil {
+				err = ch.ExchangeDeclare(v1.LogExchange, "topic", true, false, false, false, nil)
+			}
+			if err != nil {
+				conn.Close()
+			} else {
+				lost := conn.NotifyClose(make(chan *amqp.Error, 1))
+
+				b.mu.Lock()
+				if b.closed {
+					b.mu.Unlock()
+					conn.Close()
+					return
+				}
+				b.conn, b.ch = conn, ch
+				b.mu.Unlock()
+
+				log.Println("Connected to the log bus")
+				backoff = time.Second
+
+				// nil when the bus was closed
+				if reason := <-lost; reason != nil {
+					log.Println("Lost the log bus:", reason)
+				}
+
+				b.mu.Lock()
+				b.conn, b.ch = nil, nil
+				b.mu.Unlock()
+				continue
+			}
+		}
+
+		log.Printf("Error connecting to the log bus, retrying in %s: %v", backoff, err)
+		time.Sleep(backoff)
+		backoff = min(2*backoff, 30*time.Second)
+	}
+}
+
+// Publish sends an entry to the exchange as a persistent message, it does not
+// wait for the logger
+func (b *logBus) Publish(ctx context.Context, entry v1.LogEntry) error {
+	b.mu.Lock()
+	ch := b.ch
+	b.mu.Unlock()
+
+	if ch == nil {
+		return errLogBusDown
+	}
+
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	return ch.PublishWithContext(ctx, v1.LogExchange, v1.LogRoutingKey(entry.Name), false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Timestamp:    time.Now(),
+		AppId:        "authentication",
+		Body:         body,
+	})
+}
+
+// close closes the channel and the connection, entries published afterwards
+// go the synchronous way
+func (b *logBus) close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	if b.conn == nil {
+		return nil
+	}
+
+	b.ch.Close()
+	err := b.conn.Close()
+	b.conn, b.ch = nil, nil
+	return err
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"contracts/failover"
+	"contracts/logpb"
+	v1 "contracts/v1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// logShipper sends the log entries of the service to logger-service: through
+// the log bus when there is one, else over one reused gRPC connection, and over
+// HTTP while gRPC is unavailable or when no gRPC address is configured
+type logShipper struct {
+	token  string
+	logger *failover.Endpoint
+	http   *http.Client
+
+	// bus is nil without RABBITMQ_URL
+	bus *logBus
+
+	// client is nil without a gRPC address
+	client logpb.LogServiceClient
+
+	// timeout bounds each call, retries is how often a call the logger
+	// refused without storing the entry is tried again
+	timeout time.Duration
+	retries int
+}
+
+// newLogShipper returns a shipper for the logger at grpcAddr, with the HTTP API
+// of logger as the fallback. The connection is made on the first entry and kept.
+func newLogShipper(grpcAddr string, logger *failover.Endpoint, token string) *logShipper {
+	s := &logShipper{
+		token:   token,
+		logger:  logger,
+		http:    &http.Client{Timeout: 5 * time.Second},
+		timeout: 2 * time.Second,
+		retries: 2,
+	}
+
+	if grpcAddr == "" {
+		return s
+	}
+
+	conn, err := grpc.NewClient(grpcAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Printf("Error setting up the gRPC client of %s, logging over HTTP: %v", grpcAddr, err)
+		return s
+	}
+	s.client = logpb.NewLogServiceClient(conn)
+
+	return s
+}
+
+// Ship sends one entry, directly to the logger while the log bus is down.
+// Calls the logger answered Unavailable or ResourceExhausted never stored the
+// entry and are retried; once retries are used up on an unavailable logger
+// the entry goes over HTTP. Other failures are returned, sending them again
+// could store the entry twice.
+func (s *logShipper) Ship(ctx context.Context, entry v1.LogEntry) error {
+	if s.bus != nil {
+		err := s.bus.Publish(ctx, entry)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, errLogBusDown) {
+			log.Println("Error publishing to the log bus, logging directly:", err)
+		}
+	}
+
+	if s.client == nil {
+		return s.post(ctx, entry)
+	}
+
+	err := s.write(ctx, entry)
+	if status.Code(err) == codes.Unavailable {
+		return s.post(ctx, entry)
+	}
+
+	return err
+}
+
+func (s *logShipper) write(ctx context.Context, entry v1.LogEntry) error {
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+s.token)
+
+	req := &logpb.LogEntry{
+		Name:    entry.Name,
+		Data:    entry.Data,
+		TraceId: entry.TraceID,
+		SpanId:  entry.SpanID,
+		Level:   entry.Level,
+		Stack:   entry.Stack,
+		UserId:  entry.UserID,
+		Version: entry.Version,
+		Service: entry.Service,
+		Fields:  entry.Fields,
+	}
+
+	backoff := 100 * time.Millisecond
+
+	for attempt := 0; ; attempt++ {
+		callCtx, cancel := context.WithTimeout(ctx, s.timeout)
+		_, err := s.client.WriteLog(callCtx, req)
+		cancel()
+
+		code := status.Code(err)
+		if err == nil || attempt == s.retries || (code != codes.Unavailable && code != codes.ResourceExhausted) {
+			return err
+		}
+
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// post sends an entry to POST /log and checks that the logger took it
+func (s *logShipper) post(ctx context.Context, entry v1.LogEntry) error {
+	jsonData, _ := json.Marshal(entry)
+
+	request, err := http.NewRequestWithContext(ctx, "POST", "/log", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "Bearer "+s.token)
+
+	response, err := s.logger.Do(s.http, request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return fmt.Errorf("logger answered %s: %s", response.Status, bytes.TrimSpace(body))
+	}
+	io.Copy(io.Discard, response.Body)
+
+	return nil
+}
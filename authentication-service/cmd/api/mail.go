@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// mailer sends the mails of the service, such as the password reset links
+type mailer interface {
+	Send(ctx context.Context, m mail) error
+}
+
+// newMailer returns a mailer for the SMTP server in SMTP_HOST, or one that only
+// logs when no server is configured
+func newMailer() mailer {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		log.Println("SMTP_HOST is not set, mails are not sent")
+		return logMailer{}
+	}
+
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "no-reply@" + host
+	}
+
+	poolSize, _ := strconv.Atoi(os.Getenv("SMTP_POOL_SIZE"))
+	maxSends, _ := strconv.Atoi(os.Getenv("SMTP_MAX_CONCURRENT"))
+	idleTimeout, _ := time.ParseDuration(os.Getenv("SMTP_IDLE_TIMEOUT"))
+
+	m := newSMTPMailer(host, port, from, poolSize, maxSends, idleTimeout)
+	if user := os.Getenv("SMTP_USER"); user != "" {
+		m.auth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASSWORD"), host)
+	}
+
+	return m
+}
+
+// smtpMailer sends plain text mails through one SMTP server. Connections are
+// authenticated once and kept for the next mails; at most maxSends mails are
+// sent at the same time, so the provider does not throttle the service.
+type smtpMailer struct {
+	host string
+	addr string
+	from string
+	auth smtp.Auth
+
+	// idle holds the connections waiting for a mail, the oldest first
+	idle chan *smtpConn
+	// sends holds a token per mail being sent
+	sends chan struct{}
+	// idleTimeout is how long a connection is kept unused, servers drop
+	// connections idle for a few minutes
+	idleTimeout time.Duration
+}
+
+// smtpConn is a connection of the pool
+type smtpConn struct {
+	conn     net.Conn
+	client   *smtp.Client
+	lastUsed time.Time
+}
+
+// newSMTPMailer returns a mailer keeping up to poolSize idle connections and
+// sending at most maxSends mails at once. Zero values keep the defaults of 2
+// idle connections, 4 sends and one minute of idle time.
+func newSMTPMailer(host, port, from string, poolSize, maxSends int, idleTimeout time.Duration) *smtpMailer {
+	if poolSize <= 0 {
+		poolSize = 2
+	}
+	if maxSends <= 0 {
+		maxSends = 4
+	}
+	if idleTimeout <= 0 {
+		idleTimeout = time.Minute
+	}
+
+	return &smtpMailer{
+		host:        host,
+		addr:        net.JoinHostPort(host, port),
+		from:        from,
+		idle:        make(chan *smtpConn, poolSize),
+		sends:       make(chan struct{}, maxSends),
+		idleTimeout: idleTimeout,
+	}
+}
+
+func (m *smtpMailer) Send(ctx context.Context, message mail) error {
+	msg, err := message.encode(m.from)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case m.sends <- struct{}{}:
+		defer func() { <-m.sends }()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	c, err := m.get(ctx)
+	if err != nil {
+		return err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		c.conn.SetDeadline(deadline)
+	}
+
+	if err := c.send(m.from, message.To, msg); err != nil {
+		// a refused mail leaves the session usable, anything else is not reused
+		var reply *textproto.Error
+		if errors.As(err, &reply) && c.client.Reset() == nil {
+			m.put(c)
+		} else {
+			c.client.Close()
+		}
+		return err
+	}
+
+	m.put(c)
+	return nil
+}
+
+// get returns an idle connection that still answers, or a new one
+func (m *smtpMailer) get(ctx context.Context) (*smtpConn, error) {
+	for {
+		select {
+		case c := <-m.idle:
+			if time.Since(c.lastUsed) > m.idleTimeout {
+				c.client.Close()
+				continue
+			}
+
+			c.conn.SetDeadline(time.Now().Add(5 * time.Second))
+			if err := c.client.Noop(); err != nil {
+				c.client.Close()
+				continue
+			}
+			return c, nil
+		default:
+			return m.dial(ctx)
+		}
+	}
+}
+
+// put keeps a connection for the next mail, or closes it when the pool is full
+func (m *smtpMailer) put(c *smtpConn) {
+	c.conn.SetDeadline(time.Time{})
+	c.lastUsed = time.Now()
+
+	select {
+	case m.idle <- c:
+	default:
+		c.client.Quit()
+	}
+}
+
+// dial opens a connection, with STARTTLS when the server offers it, and
+// authenticates it the way smtp.SendMail does
+func (m *smtpMailer) dial(ctx context.Context) (*smtpConn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", m.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if err := m.hello(client); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return &smtpConn{conn: conn, client: client}, nil
+}
+
+func (m *smtpMailer) hello(client *smtp.Client) error {
+	if err := client.Hello("localhost"); err != nil {
+		return err
+	}
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: m.host}); err != nil {
+			return err
+		}
+	}
+
+	if m.auth != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("smtp: server does not support AUTH")
+		}
+		if err := client.Auth(m.auth); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// send sends one mail on the session and leaves it ready for the next
+func (c *smtpConn) send(from, to, msg string) error {
+	if err := c.client.Mail(from); err != nil {
+		return err
+	}
+	if err := c.client.Rcpt(to); err != nil {
+		return err
+	}
+
+	w, err := c.client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, msg); err != nil {
+		return err
+	}
+
+	return w.Close()
+}
+
+// encode returns the message as sent, with the HTML as an alternative to the
+// text when there is one
+func (m mail) encode(from string) (string, error) {
+	if strings.ContainsAny(m.To+m.Subject+m.MessageID, "\r\n") {
+		return "", fmt.Errorf("invalid mail header")
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", m.To)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	if m.MessageID != "" {
+		fmt.Fprintf(&msg, "Message-ID: <%s>\r\n", m.MessageID)
+	}
+	msg.WriteString("MIME-Version: 1.0\r\n")
+
+	if m.HTML == "" {
+		msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+		msg.WriteString(crlf(m.Text))
+		return msg.String(), nil
+	}
+
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=UTF-8", m.Text},
+		{"text/html; charset=UTF-8", m.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType}})
+		if err != nil {
+			return "", err
+		}
+		if _, err := io.WriteString(w, crlf(part.content)); err != nil {
+			return "", err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return "", err
+	}
+
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", parts.Boundary())
+	msg.Write(body.Bytes())
+
+	return msg.String(), nil
+}
+
+// crlf turns the line ends of s into those of a mail
+func crlf(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\n", "\r\n")
+}
+
+// logMailer stands in for a mail server in development, it never logs the body
+// since that holds secrets such as reset tokens
+type logMailer struct{}
+
+func (logMailer) Send(_ context.Context, m mail) error {
+	log.Printf("Not sending mail %q to %s, no SMTP server is configured", m.Subject, m.To)
+	return nil
+}
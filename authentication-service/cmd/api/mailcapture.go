@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// capturedMailKey is the Redis list of the mails captured in dry-run mode,
+// shared by the replicas
+const capturedMailKey = "mail:captured"
+
+// maxCapturedMail is how many captured mails are kept, the oldest go first
+const maxCapturedMail = 200
+
+// capturedMail is a mail kept instead of being sent
+type capturedMail struct {
+	mail
+	CapturedAt time.Time `json:"captured_at"`
+}
+
+// captureMailer is the mailer of dry-run mode, MAIL_DRY_RUN=true. It keeps
+// every mail in Redis, or in memory without Redis, for GET /admin/mail/captured
+// instead of sending it, so staging never mails real users.
+type captureMailer struct {
+	rdb *redis.Client
+
+	mu     sync.Mutex
+	memory []capturedMail
+}
+
+func newCaptureMailer(rdb *redis.Client) *captureMailer {
+	log.Println("MAIL_DRY_RUN is set, mails are captured and not sent")
+	return &captureMailer{rdb: rdb}
+}
+
+func (c *captureMailer) Send(ctx context.Context, m mail) error {
+	captured := capturedMail{mail: m, CapturedAt: time.Now().UTC()}
+
+	if c.rdb == nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		c.memory = append(c.memory, captured)
+		if len(c.memory) > maxCapturedMail {
+			c.memory = c.memory[len(c.memory)-maxCapturedMail:]
+		}
+		return nil
+	}
+
+	raw, err := json.Marshal(captured)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(ctx, capturedMailKey, raw)
+		pipe.LTrim(ctx, capturedMailKey, 0, maxCapturedMail-1)
+		return nil
+	})
+	return err
+}
+
+// list returns the captured mails, the newest first
+func (c *captureMailer) list(ctx context.Context) ([]capturedMail, error) {
+	if c.rdb == nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		mails := make([]capturedMail, 0, len(c.memory))
+		for i := len(c.memory) - 1; i >= 0; i-- {
+			mails = append(mails, c.memory[i])
+		}
+		return mails, nil
+	}
+
+	raws, err := c.rdb.LRange(ctx, capturedMailKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	mails := make([]capturedMail, 0, len(raws))
+	for _, raw := range raws {
+		var m capturedMail
+		if err := json.Unmarshal([]byte(raw), &m); err != nil {
+			continue
+		}
+		mails = append(mails, m)
+	}
+	return mails, nil
+}
+
+func (c *captureMailer) clear(ctx context.Context) error {
+	if c.rdb == nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		c.memory = nil
+		return nil
+	}
+
+	return c.rdb.Del(ctx, capturedMailKey).Err()
+}
+
+// ListCapturedMail returns the mails captured in dry-run mode, the newest first
+func (app *Config) ListCapturedMail(w http.ResponseWriter, r *http.Request) {
+	if app.MailCapture == nil {
+		app.errorJson(w, fmt.Errorf("mail is sent, MAIL_DRY_RUN is not set"), http.StatusNotFound)
+		return
+	}
+
+	mails, err := app.MailCapture.list(r.Context())
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: fmt.Sprintf("%d captured mails", len(mails)),
+		Data:    mails,
+	})
+}
+
+// ClearCapturedMail forgets the mails captured in dry-run mode
+func (app *Config) ClearCapturedMail(w http.ResponseWriter, r *http.Request) {
+	if app.MailCapture == nil {
+		app.errorJson(w, fmt.Errorf("mail is sent, MAIL_DRY_RUN is not set"), http.StatusNotFound)
+		return
+	}
+
+	if err := app.MailCapture.clear(r.Context()); err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
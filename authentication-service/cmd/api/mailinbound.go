@@ -0,0 +1,286 @@
+package main
+
+import (
+	"authentication/data"
+	"bufio"
+	"contracts/token"
+	v1 "contracts/v1"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	netmail "net/mail"
+	"regexp"
+	"strings"
+)
+
+// maxInboundMailBytes bounds the raw mails posted to the inbound webhook
+const maxInboundMailBytes = 10 << 20
+
+// messageIDs finds the ids in In-Reply-To and References headers
+var messageIDs = regexp.MustCompile(`<([^<>@\s]+)@([^<>\s]+)>`)
+
+// mailInbound receives the replies to the mails of the service. The mail
+// provider, or a forwarder reading the reply mailbox over IMAP, posts each
+// raw mail to /mail/inbound with MAIL_INBOUND_SECRET as bearer token. Sent
+// mails get a Message-ID in domain, replies are matched to them by it.
+type mailInbound struct {
+	secret string
+	domain string
+}
+
+// newMailInbound returns the inbound settings, nil when MAIL_INBOUND_SECRET is
+// not set and replies are not handled
+func newMailInbound(secret, domain string) *mailInbound {
+	if secret == "" {
+		return nil
+	}
+	if domain == "" {
+		domain = "localhost"
+	}
+
+	return &mailInbound{secret: secret, domain: domain}
+}
+
+// startMailThread returns the Message-ID of a new thread for a mail to user,
+// empty when replies are not handled or the thread can not be stored
+func (app *Config) startMailThread(template string, user *data.User) string {
+	if app.MailInbound == nil {
+		return ""
+	}
+
+	id, err := app.Models.MailThread.Start(user.ID, template)
+	if err != nil {
+		log.Printf("Error starting a thread for %s mail of user %d: %v", template, user.ID, err)
+		return ""
+	}
+
+	return id + "@" + app.MailInbound.domain
+}
+
+// inboundMail is what a reply is matched and handled by
+type inboundMail struct {
+	MessageID string
+	From      string
+	Subject   string
+	Text      string
+
+	// ThreadIDs are the threads of the service the mail refers to, the
+	// one it answers first
+	ThreadIDs []string
+}
+
+type inboundMailResponse struct {
+	ThreadID string `json:"thread_id,omitempty"`
+	Handled  bool   `json:"handled"`
+}
+
+// InboundMail handles a reply to a mail of the service and publishes it as a
+// "mail.replied" event, for consumers such as "reply to verify". Mails that
+// answer no known thread, or not from the address the thread was mailed to,
+// are accepted and dropped so the provider does not deliver them again.
+func (app *Config) InboundMail(w http.ResponseWriter, r *http.Request) {
+	if app.MailInbound == nil {
+		app.errorJson(w, errors.New("inbound mail is not enabled"), http.StatusNotFound)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(token.FromRequest(r)), []byte(app.MailInbound.secret)) != 1 {
+		app.errorJson(w, errors.New("invalid inbound mail secret"), http.StatusUnauthorized)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxInboundMailBytes)
+
+	in, err := parseInboundMail(r.Body, app.MailInbound.domain)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	thread, err := app.findMailThread(in.ThreadIDs)
+	if errors.Is(err, data.ErrMailThreadNotFound) {
+		app.dropInboundMail(w, in, "not a reply to a mail of the service")
+		return
+	}
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	user, err := app.Models.User.GetOne(thread.UserID)
+	if errors.Is(err, data.ErrUserNotFound) {
+		app.dropInboundMail(w, in, "user of the thread is gone")
+		return
+	}
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+	if !strings.EqualFold(user.Email, in.From) {
+		app.dropInboundMail(w, in, fmt.Sprintf("sender is not the recipient of thread %s", thread.ID))
+		return
+	}
+
+	recorded, err := app.Models.MailThread.RecordReply(in.MessageID, thread)
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+	if recorded {
+		app.publishEvent("mail", "mail.replied", v1.MailReply{
+			ThreadID: thread.ID,
+			UserID:   thread.UserID,
+			Template: thread.Template,
+			From:     in.From,
+			Subject:  in.Subject,
+			Text:     in.Text,
+		})
+
+		if err := app.logUserRequest("mail.replied", fmt.Sprintf("reply to %s mail", thread.Template), thread.UserID); err != nil {
+			log.Println("Error logging mail reply:", err)
+		}
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: "reply handled",
+		Data:    inboundMailResponse{ThreadID: thread.ID, Handled: true},
+	})
+}
+
+// findMailThread returns the first known thread of ids
+func (app *Config) findMailThread(ids []string) (*data.MailThread, error) {
+	for _, id := range ids {
+		thread, err := app.Models.MailThread.Get(id)
+		if errors.Is(err, data.ErrMailThreadNotFound) {
+			continue
+		}
+		return thread, err
+	}
+
+	return nil, data.ErrMailThreadNotFound
+}
+
+func (app *Config) dropInboundMail(w http.ResponseWriter, in *inboundMail, reason string) {
+	log.Printf("Dropped inbound mail %s: %s", in.MessageID, reason)
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: reason,
+		Data:    inboundMailResponse{Handled: false},
+	})
+}
+
+// parseInboundMail reads a raw mail and the threads in domain it refers to
+func parseInboundMail(r io.Reader, domain string) (*inboundMail, error) {
+	msg, err := netmail.ReadMessage(bufio.NewReader(r))
+	if err != nil {
+		return nil, fmt.Errorf("invalid mail: %w", err)
+	}
+
+	from, err := msg.Header.AddressList("From")
+	if err != nil || len(from) == 0 {
+		return nil, errors.New("invalid mail: missing From")
+	}
+
+	messageID := strings.Trim(strings.TrimSpace(msg.Header.Get("Message-ID")), "<>")
+	if messageID == "" {
+		return nil, errors.New("invalid mail: missing Message-ID")
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+
+	text, err := plainText(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mail body: %w", err)
+	}
+
+	in := &inboundMail{
+		MessageID: messageID,
+		From:      from[0].Address,
+		Subject:   subject,
+		Text:      stripQuoted(text),
+	}
+
+	for _, header := range []string{"In-Reply-To", "References"} {
+		for _, match := range messageIDs.FindAllStringSubmatch(msg.Header.Get(header), -1) {
+			if strings.EqualFold(match[2], domain) {
+				in.ThreadIDs = append(in.ThreadIDs, match[1])
+			}
+		}
+	}
+
+	return in, nil
+}
+
+// plainText returns the first text/plain part of a body, empty when it has
+// none. Parts of multipart bodies are decoded by the multipart reader.
+func plainText(contentType, encoding string, body io.Reader) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		parts := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := parts.NextPart()
+			if err == io.EOF {
+				return "", nil
+			}
+			if err != nil {
+				return "", err
+			}
+
+			text, err := plainText(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part)
+			if err != nil || text != "" {
+				return text, err
+			}
+		}
+	}
+
+	if mediaType != "text/plain" {
+		return "", nil
+	}
+
+	switch strings.ToLower(encoding) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// stripQuoted returns the text of a reply above the mail it quotes
+func stripQuoted(text string) string {
+	var lines []string
+
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, ">") || trimmed == "-----Original Message-----" {
+			break
+		}
+		if strings.HasPrefix(trimmed, "On ") && strings.HasSuffix(trimmed, "wrote:") {
+			break
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
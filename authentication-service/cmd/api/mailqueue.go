@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"log"
+	"time"
+)
+
+// mail priorities. Transactional mail, such as password reset links, has
+// workers of its own so it is never stuck behind bulk mail.
+const (
+	mailTransactional = "transactional"
+	mailBulk          = "bulk"
+)
+
+// errMailQueueFull is returned when the queue of a priority can take no more
+var errMailQueueFull = errors.New("mail queue is full")
+
+// mail is one message, sent as plain text or with an HTML alternative
+type mail struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	HTML    string `json:"html,omitempty"`
+
+	// MessageID is the Message-ID of mails that replies are matched to,
+	// without the angle brackets
+	MessageID string `json:"message_id,omitempty"`
+}
+
+// mailStats counts the mails of each priority, on /debug/vars
+var mailStats = expvar.NewMap("mail")
+
+// mailQueue sends mail in the background from one queue per priority. Of its
+// workers, the bulk ones take from both queues and the others only from the
+// transactional queue, so bulk mail can use at most its share of the workers
+// while transactional mail can use them all. Queued mail is lost when the
+// service stops.
+type mailQueue struct {
+	mailer        mailer
+	transactional chan mail
+	bulk          chan mail
+
+	// timeout bounds the sending of one mail
+	timeout time.Duration
+}
+
+// newMailQueue starts workers sending through m, bulkWorkers of them also
+// sending bulk mail. Each priority queues up to size mails.
+func newMailQueue(m mailer, workers, bulkWorkers, size int) *mailQueue {
+	if workers <= 0 {
+		workers = 4
+	}
+	if bulkWorkers <= 0 {
+		bulkWorkers = 1
+	}
+	// one worker is always kept for transactional mail
+	bulkWorkers = min(bulkWorkers, max(workers-1, 1))
+	if size <= 0 {
+		size = 256
+	}
+
+	q := &mailQueue{
+		mailer:        m,
+		transactional: make(chan mail, size),
+		bulk:          make(chan mail, size),
+		timeout:       30 * time.Second,
+	}
+
+	for i := 0; i < workers; i++ {
+		go q.work(i < bulkWorkers)
+	}
+
+	return q
+}
+
+// Enqueue queues a mail of a priority without waiting for it to be sent
+func (q *mailQueue) Enqueue(priority string, m mail) error {
+	queue := q.transactional
+	if priority == mailBulk {
+		queue = q.bulk
+	}
+
+	select {
+	case queue <- m:
+		mailStats.Add(priority+"_queued", 1)
+		return nil
+	default:
+		mailStats.Add(priority+"_dropped", 1)
+		return errMailQueueFull
+	}
+}
+
+func (q *mailQueue) work(bulk bool) {
+	for {
+		if !bulk {
+			q.send(mailTransactional, <-q.transactional)
+			continue
+		}
+
+		// transactional mail first, bulk mail when there is none
+		select {
+		case m := <-q.transactional:
+			q.send(mailTransactional, m)
+			continue
+		default:
+		}
+
+		select {
+		case m := <-q.transactional:
+			q.send(mailTransactional, m)
+		case m := <-q.bulk:
+			q.send(mailBulk, m)
+		}
+	}
+}
+
+func (q *mailQueue) send(priority string, m mail) {
+	ctx, cancel := context.WithTimeout(context.Background(), q.timeout)
+	defer cancel()
+
+	if err := q.mailer.Send(ctx, m); err != nil {
+		mailStats.Add(priority+"_failed", 1)
+		log.Printf("Error sending %s mail %q to %s: %v", priority, m.Subject, m.To, err)
+		return
+	}
+
+	mailStats.Add(priority+"_sent", 1)
+}
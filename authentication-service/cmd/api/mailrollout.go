@@ -0,0 +1,312 @@
+package main
+
+import (
+	"authentication/data"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/go-chi/chi"
+)
+
+type MailTemplateVersionPayload struct {
+	Text string `json:"text"`
+	HTML string `json:"html,omitempty"`
+}
+
+type MailTemplateRolloutPayload struct {
+	StableVersion    *int `json:"stable_version"`
+	CandidateVersion int  `json:"candidate_version"`
+	Percent          int  `json:"percent"`
+}
+
+type mailTemplateResponse struct {
+	Rollout  *data.MailTemplateRollout   `json:"rollout"`
+	Versions []*data.MailTemplateVersion `json:"versions,omitempty"`
+}
+
+// ListMailTemplates returns the rollout of every built-in template
+func (app *Config) ListMailTemplates(w http.ResponseWriter, r *http.Request) {
+	rollouts, err := app.Models.MailTemplate.Rollouts()
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	byName := make(map[string]*data.MailTemplateRollout)
+	for _, rollout := range rollouts {
+		byName[rollout.Template] = rollout
+	}
+
+	names := make([]string, 0, len(mailTemplates))
+	for name := range mailTemplates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	templates := make([]*data.MailTemplateRollout, 0, len(names))
+	for _, name := range names {
+		rollout, ok := byName[name]
+		if !ok {
+			rollout = &data.MailTemplateRollout{Template: name}
+		}
+		templates = append(templates, rollout)
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: fmt.Sprintf("%d mail templates", len(templates)),
+		Data:    templates,
+	})
+}
+
+// GetMailTemplate returns the rollout and the stored versions of a template
+func (app *Config) GetMailTemplate(w http.ResponseWriter, r *http.Request) {
+	name, ok := app.mailTemplateName(w, r)
+	if !ok {
+		return
+	}
+
+	rollout, err := app.Models.MailTemplate.Rollout(name)
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	versions, err := app.Models.MailTemplate.Versions(name)
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: name,
+		Data:    mailTemplateResponse{Rollout: rollout, Versions: versions},
+	})
+}
+
+// DeleteMailTemplate deletes the stored versions of a template, the built-in
+// one is sent again
+func (app *Config) DeleteMailTemplate(w http.ResponseWriter, r *http.Request) {
+	name, ok := app.mailTemplateName(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.Models.MailTemplate.Delete(name); err != nil {
+		app.mailTemplateError(w, err)
+		return
+	}
+
+	app.logTemplateChange(r, fmt.Sprintf("mail template %s reset to the built-in version", name))
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: fmt.Sprintf("mail template %s reset", name),
+	})
+}
+
+// CreateMailTemplateVersion stores a new version of a template. It is only
+// sent once it is rolled out.
+func (app *Config) CreateMailTemplateVersion(w http.ResponseWriter, r *http.Request) {
+	name, ok := app.mailTemplateName(w, r)
+	if !ok {
+		return
+	}
+
+	var requestPayload MailTemplateVersionPayload
+	if err := app.readJson(w, r, &requestPayload); err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	// a version that does not parse is refused here, not at the next send
+	if _, err := parseMailTemplate(name, requestPayload.Text, requestPayload.HTML); err != nil {
+		app.errorJson(w, err, http.StatusUnprocessableEntity)
+		return
+	}
+
+	version, err := app.Models.MailTemplate.CreateVersion(name, requestPayload.Text, requestPayload.HTML, adminIdentity(r))
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.logTemplateChange(r, fmt.Sprintf("mail template %s version %d created", name, version.Version))
+
+	app.writeJson(w, http.StatusCreated, jsonReponse{
+		Error:   false,
+		Message: fmt.Sprintf("mail template %s version %d created", name, version.Version),
+		Data:    version,
+	})
+}
+
+// GetMailTemplateVersion returns one stored version of a template
+func (app *Config) GetMailTemplateVersion(w http.ResponseWriter, r *http.Request) {
+	name, version, ok := app.mailTemplateVersion(w, r)
+	if !ok {
+		return
+	}
+
+	v, err := app.Models.MailTemplate.Version(name, version)
+	if err != nil {
+		app.mailTemplateError(w, err)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: fmt.Sprintf("mail template %s version %d", name, version),
+		Data:    v,
+	})
+}
+
+// DeleteMailTemplateVersion deletes a stored version that is not rolled out
+func (app *Config) DeleteMailTemplateVersion(w http.ResponseWriter, r *http.Request) {
+	name, version, ok := app.mailTemplateVersion(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.Models.MailTemplate.DeleteVersion(name, version); err != nil {
+		app.mailTemplateError(w, err)
+		return
+	}
+
+	app.logTemplateChange(r, fmt.Sprintf("mail template %s version %d deleted", name, version))
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: fmt.Sprintf("mail template %s version %d deleted", name, version),
+	})
+}
+
+// SetMailTemplateRollout publishes a candidate version to a percentage of the
+// recipients. At 100 percent the candidate becomes the stable version.
+// Leaving stable_version out keeps the current one.
+func (app *Config) SetMailTemplateRollout(w http.ResponseWriter, r *http.Request) {
+	name, ok := app.mailTemplateName(w, r)
+	if !ok {
+		return
+	}
+
+	var requestPayload MailTemplateRolloutPayload
+	if err := app.readJson(w, r, &requestPayload); err != nil {
+		app.errorJson(w, err)
+		return
+	}
+	if requestPayload.Percent < 0 || requestPayload.Percent > 100 {
+		app.errorJson(w, errors.New("percent must be between 0 and 100"))
+		return
+	}
+
+	rollout, err := app.Models.MailTemplate.Rollout(name)
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if requestPayload.StableVersion != nil {
+		rollout.Stable = *requestPayload.StableVersion
+	}
+	rollout.Candidate, rollout.Percent = requestPayload.CandidateVersion, requestPayload.Percent
+
+	switch {
+	case rollout.Candidate == 0:
+		rollout.Percent = 0
+	case rollout.Percent == 100:
+		rollout.Stable, rollout.Candidate, rollout.Percent = rollout.Candidate, 0, 0
+	}
+
+	app.saveRollout(w, r, rollout)
+}
+
+// RollbackMailTemplate stops sending the candidate version of a template at
+// once, every recipient gets the stable version again
+func (app *Config) RollbackMailTemplate(w http.ResponseWriter, r *http.Request) {
+	name, ok := app.mailTemplateName(w, r)
+	if !ok {
+		return
+	}
+
+	rollout, err := app.Models.MailTemplate.Rollout(name)
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+	if rollout.Candidate == 0 {
+		app.errorJson(w, fmt.Errorf("mail template %s has no candidate version to roll back", name), http.StatusConflict)
+		return
+	}
+
+	rollout.Candidate, rollout.Percent = 0, 0
+
+	app.saveRollout(w, r, rollout)
+}
+
+func (app *Config) saveRollout(w http.ResponseWriter, r *http.Request, rollout *data.MailTemplateRollout) {
+	if err := app.Models.MailTemplate.SetRollout(rollout); err != nil {
+		app.mailTemplateError(w, err)
+		return
+	}
+
+	message := fmt.Sprintf("mail template %s sends version %d", rollout.Template, rollout.Stable)
+	if rollout.Candidate > 0 {
+		message += fmt.Sprintf(", version %d to %d%%", rollout.Candidate, rollout.Percent)
+	}
+
+	app.logTemplateChange(r, message)
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: message,
+		Data:    rollout,
+	})
+}
+
+// mailTemplateName returns the template of a request, only built-in templates
+// are sent and so only they have versions
+func (app *Config) mailTemplateName(w http.ResponseWriter, r *http.Request) (string, bool) {
+	name := chi.URLParam(r, "name")
+	if _, ok := mailTemplates[name]; !ok {
+		app.errorJson(w, fmt.Errorf("unknown mail template %q", name), http.StatusNotFound)
+		return "", false
+	}
+	return name, true
+}
+
+func (app *Config) mailTemplateVersion(w http.ResponseWriter, r *http.Request) (string, int, bool) {
+	name, ok := app.mailTemplateName(w, r)
+	if !ok {
+		return "", 0, false
+	}
+
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil || version < 1 {
+		app.errorJson(w, data.ErrTemplateVersionNotFound, http.StatusNotFound)
+		return "", 0, false
+	}
+
+	return name, version, true
+}
+
+func (app *Config) logTemplateChange(r *http.Request, message string) {
+	if err := app.logRequest("mail.template", message+" by "+adminIdentity(r)); err != nil {
+		log.Println("Error logging mail template change:", err)
+	}
+}
+
+func (app *Config) mailTemplateError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, data.ErrTemplateVersionNotFound):
+		app.errorJson(w, err, http.StatusNotFound)
+	case errors.Is(err, data.ErrTemplateVersionInUse):
+		app.errorJson(w, err, http.StatusConflict)
+	default:
+		app.errorJson(w, err, http.StatusInternalServerError)
+	}
+}
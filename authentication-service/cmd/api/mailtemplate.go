@@ -0,0 +1,228 @@
+package main
+
+import (
+	"authentication/data"
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	htmltemplate "html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+)
+
+// mailTemplateFS holds the mail templates, <name>.txt and optionally
+// <name>.html. The text template defines the "subject" template.
+//
+//go:embed templates/mail
+var mailTemplateFS embed.FS
+
+// mailTemplates are parsed once, missing variables are an error so a preview
+// shows them instead of sending "<no value>"
+var mailTemplates = parseMailTemplates()
+
+type mailTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+func parseMailTemplates() map[string]*mailTemplate {
+	templates := make(map[string]*mailTemplate)
+
+	files, err := fs.Glob(mailTemplateFS, "templates/mail/*.txt")
+	if err != nil {
+		panic(err)
+	}
+
+	for _, file := range files {
+		name := strings.TrimSuffix(path.Base(file), ".txt")
+
+		text, err := fs.ReadFile(mailTemplateFS, file)
+		if err != nil {
+			panic(err)
+		}
+
+		html, err := fs.ReadFile(mailTemplateFS, strings.TrimSuffix(file, ".txt")+".html")
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			panic(err)
+		}
+
+		t, err := parseMailTemplate(name, string(text), string(html))
+		if err != nil {
+			panic(err)
+		}
+
+		templates[name] = t
+	}
+
+	return templates
+}
+
+// parseMailTemplate parses the text of a template, which defines the
+// "subject" template, and its HTML, empty for text only mails
+func parseMailTemplate(name, text, html string) (*mailTemplate, error) {
+	t := &mailTemplate{}
+
+	var err error
+	t.text, err = texttemplate.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if t.text.Lookup("subject") == nil {
+		return nil, fmt.Errorf("mail template %s defines no subject", name)
+	}
+
+	if html != "" {
+		t.html, err = htmltemplate.New(name).Option("missingkey=error").Parse(html)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return t, nil
+}
+
+// renderMail renders a built-in mail template for to with vars
+func renderMail(name, to string, vars map[string]any) (mail, error) {
+	t, ok := mailTemplates[name]
+	if !ok {
+		return mail{}, fmt.Errorf("unknown mail template %q", name)
+	}
+
+	return t.render(to, vars)
+}
+
+func (t *mailTemplate) render(to string, vars map[string]any) (mail, error) {
+	m := mail{To: to}
+	var b bytes.Buffer
+
+	if err := t.text.ExecuteTemplate(&b, "subject", vars); err != nil {
+		return mail{}, err
+	}
+	m.Subject = strings.TrimSpace(b.String())
+
+	b.Reset()
+	if err := t.text.Execute(&b, vars); err != nil {
+		return mail{}, err
+	}
+	m.Text = b.String()
+
+	if t.html != nil {
+		b.Reset()
+		if err := t.html.Execute(&b, vars); err != nil {
+			return mail{}, err
+		}
+		m.HTML = b.String()
+	}
+
+	return m, nil
+}
+
+// renderRolledOut renders the version of a template rolled out to to: the
+// candidate for its share of the recipients, the stable version for the
+// others. A version that can not be read or rendered falls back to the
+// built-in template, mails are never held up by a broken rollout.
+func (app *Config) renderRolledOut(name, to string, vars map[string]any) (mail, error) {
+	rollout, err := app.Models.MailTemplate.Rollout(name)
+	if err != nil {
+		log.Printf("Error reading the rollout of mail template %s: %v", name, err)
+		return renderMail(name, to, vars)
+	}
+
+	version := rollout.Stable
+	if rollout.Candidate > 0 && rolloutBucket(name, to) < rollout.Percent {
+		version = rollout.Candidate
+	}
+	if version == 0 {
+		return renderMail(name, to, vars)
+	}
+
+	m, err := app.renderVersion(name, version, to, vars)
+	if err != nil {
+		log.Printf("Error rendering version %d of mail template %s, sending the built-in one: %v", version, name, err)
+		return renderMail(name, to, vars)
+	}
+
+	return m, nil
+}
+
+// renderVersion renders a stored version of a template, version 0 is the
+// built-in one
+func (app *Config) renderVersion(name string, version int, to string, vars map[string]any) (mail, error) {
+	if version == 0 {
+		return renderMail(name, to, vars)
+	}
+
+	v, err := app.Models.MailTemplate.Version(name, version)
+	if err != nil {
+		return mail{}, err
+	}
+
+	t, err := parseMailTemplate(name, v.Text, v.HTML)
+	if err != nil {
+		return mail{}, err
+	}
+
+	return t.render(to, vars)
+}
+
+// rolloutBucket places a recipient of a template in one of 100 buckets, the
+// same one at every send so a user keeps getting the same version
+func rolloutBucket(name, to string) int {
+	h := fnv.New32a()
+	h.Write([]byte(name + "\x00" + strings.ToLower(to)))
+	return int(h.Sum32() % 100)
+}
+
+type MailPreviewPayload struct {
+	Template string         `json:"template"`
+	Version  int            `json:"version,omitempty"`
+	To       string         `json:"to,omitempty"`
+	Data     map[string]any `json:"data"`
+}
+
+// PreviewMail renders a mail template, the built-in one or a stored version,
+// with the given variables and returns the subject, text and HTML without
+// sending anything
+func (app *Config) PreviewMail(w http.ResponseWriter, r *http.Request) {
+	var requestPayload MailPreviewPayload
+
+	if err := app.readJson(w, r, &requestPayload); err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	if requestPayload.Template == "" {
+		names := make([]string, 0, len(mailTemplates))
+		for name := range mailTemplates {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		app.errorJson(w, fmt.Errorf("missing template, one of %s", strings.Join(names, ", ")))
+		return
+	}
+
+	// unknown templates and versions, and missing variables
+	m, err := app.renderVersion(requestPayload.Template, requestPayload.Version, requestPayload.To, requestPayload.Data)
+	if errors.Is(err, data.ErrTemplateVersionNotFound) {
+		app.errorJson(w, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJson(w, err, http.StatusUnprocessableEntity)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: m.Subject,
+		Data:    m,
+	})
+}
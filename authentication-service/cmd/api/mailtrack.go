@@ -0,0 +1,261 @@
+package main
+
+import (
+	"authentication/data"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi"
+)
+
+// trackingPixel is a transparent 1x1 GIF
+var trackingPixel, _ = base64.StdEncoding.DecodeString("R0lGODlhAQABAIAAAAAAAP///yH5BAEAAAAALAAAAAABAAEAAAIBRAA7")
+
+var (
+	anchorTag  = regexp.MustCompile(`(?i)<a\s[^>]*>`)
+	anchorHref = regexp.MustCompile(`(?i)\shref="([^"]*)"`)
+)
+
+// mailTracker adds an open pixel and wrapped links to the HTML of mails, with
+// MAIL_TRACKING=true. The pixel and the redirects are served under baseURL,
+// MAIL_TRACKING_URL, which has to reach /mail/t of this service.
+type mailTracker struct {
+	baseURL string
+}
+
+// newMailTracker returns the tracker of MAIL_TRACKING, nil when tracking is off
+func newMailTracker(enabled bool, baseURL string) *mailTracker {
+	if !enabled {
+		return nil
+	}
+	if baseURL == "" {
+		log.Println("MAIL_TRACKING is set without MAIL_TRACKING_URL, mails are not tracked")
+		return nil
+	}
+
+	return &mailTracker{baseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+// renderUserMail renders the version of a mail template rolled out to a user,
+// with a Message-ID that replies are matched to, and tracks the mail unless
+// tracking is off or the user opted out of it
+func (app *Config) renderUserMail(name string, user *data.User, vars map[string]any) (mail, error) {
+	m, err := app.renderRolledOut(name, user.Email, vars)
+	if err != nil {
+		return mail{}, err
+	}
+
+	m.MessageID = app.startMailThread(name, user)
+
+	if app.MailTracking == nil || m.HTML == "" {
+		return m, nil
+	}
+
+	// a mail that can not be tracked is sent untracked
+	allowed, err := app.Models.MailMessage.TrackingAllowed(user.ID)
+	if err != nil {
+		log.Printf("Error reading the mail tracking setting of user %d: %v", user.ID, err)
+		return m, nil
+	}
+	if !allowed {
+		return m, nil
+	}
+
+	links := trackableLinks(m.HTML)
+
+	id, err := app.Models.MailMessage.Track(user.ID, name, links)
+	if err != nil {
+		log.Printf("Error tracking %s mail of user %d: %v", name, user.ID, err)
+		return m, nil
+	}
+
+	m.HTML = app.MailTracking.rewrite(m.HTML, id)
+
+	return m, nil
+}
+
+// trackableLinks returns the http(s) links of an HTML mail that get wrapped, in
+// order. Links marked data-notrack, such as those carrying secrets, are left as
+// they are and never stored.
+func trackableLinks(body string) []string {
+	var links []string
+
+	for _, tag := range anchorTag.FindAllString(body, -1) {
+		if target, ok := trackableHref(tag); ok {
+			links = append(links, target)
+		}
+	}
+
+	return links
+}
+
+func trackableHref(tag string) (string, bool) {
+	if strings.Contains(strings.ToLower(tag), "data-notrack") {
+		return "", false
+	}
+
+	match := anchorHref.FindStringSubmatch(tag)
+	if match == nil {
+		return "", false
+	}
+
+	target := html.UnescapeString(match[1])
+	lower := strings.ToLower(target)
+	if !strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "https://") {
+		return "", false
+	}
+
+	return target, true
+}
+
+// rewrite points the trackable links of an HTML mail at the redirect endpoint
+// and adds the open pixel, in the order trackableLinks returned them
+func (t *mailTracker) rewrite(body, id string) string {
+	n := 0
+	body = anchorTag.ReplaceAllStringFunc(body, func(tag string) string {
+		if _, ok := trackableHref(tag); !ok {
+			return tag
+		}
+
+		href := fmt.Sprintf(` href="%s/mail/t/%s/c/%d"`, t.baseURL, id, n)
+		n++
+		return anchorHref.ReplaceAllLiteralString(tag, href)
+	})
+
+	pixel := fmt.Sprintf(`<img src="%s/mail/t/%s/o" width="1" height="1" alt="" style="display:none">`, t.baseURL, id)
+	if i := strings.LastIndex(strings.ToLower(body), "</body>"); i >= 0 {
+		return body[:i] + pixel + body[i:]
+	}
+	return body + pixel
+}
+
+// doNotTrack tells if the client asked not to be tracked, with DNT or Global
+// Privacy Control
+func doNotTrack(r *http.Request) bool {
+	return r.Header.Get("DNT") == "1" || r.Header.Get("Sec-GPC") == "1"
+}
+
+// MailOpened serves the open pixel of a tracked mail and counts the open.
+// Unknown mails get the pixel too, so ids can not be probed.
+func (app *Config) MailOpened(w http.ResponseWriter, r *http.Request) {
+	if !doNotTrack(r) {
+		err := app.Models.MailMessage.Opened(chi.URLParam(r, "id"))
+		if err != nil && !errors.Is(err, data.ErrMailMessageNotFound) {
+			log.Printf("Error counting a mail open: %v", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "image/gif")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(trackingPixel)
+}
+
+// MailClicked redirects a wrapped link of a tracked mail to its target and
+// counts the click. Only targets stored with the mail are redirected to.
+func (app *Config) MailClicked(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	n, err := strconv.Atoi(chi.URLParam(r, "n"))
+	if err != nil {
+		app.errorJson(w, data.ErrMailMessageNotFound, http.StatusNotFound)
+		return
+	}
+
+	target, err := app.Models.MailMessage.Link(id, n)
+	if errors.Is(err, data.ErrMailMessageNotFound) {
+		app.errorJson(w, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if !doNotTrack(r) {
+		if err := app.Models.MailMessage.Clicked(id); err != nil {
+			log.Printf("Error counting a mail click: %v", err)
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// GetMailMessage returns the opens and clicks of a tracked mail
+func (app *Config) GetMailMessage(w http.ResponseWriter, r *http.Request) {
+	msg, err := app.Models.MailMessage.Get(chi.URLParam(r, "id"))
+	if errors.Is(err, data.ErrMailMessageNotFound) {
+		app.errorJson(w, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: fmt.Sprintf("%d opens, %d clicks", msg.Opens, msg.Clicks),
+		Data:    msg,
+	})
+}
+
+type MailTrackingPayload struct {
+	Allowed *bool `json:"allowed"`
+}
+
+type mailTrackingResponse struct {
+	Allowed bool `json:"allowed"`
+}
+
+// GetMailTracking tells the caller whether their mails are tracked
+func (app *Config) GetMailTracking(w http.ResponseWriter, r *http.Request) {
+	c, _ := callerFromContext(r.Context())
+
+	allowed, err := app.Models.MailMessage.TrackingAllowed(c.UserID)
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: "mail tracking setting",
+		Data:    mailTrackingResponse{Allowed: allowed},
+	})
+}
+
+// SetMailTracking opts the caller in or out of mail tracking. It applies to
+// the mails rendered from then on.
+func (app *Config) SetMailTracking(w http.ResponseWriter, r *http.Request) {
+	c, _ := callerFromContext(r.Context())
+
+	var requestPayload MailTrackingPayload
+	if err := app.readJson(w, r, &requestPayload); err != nil {
+		app.errorJson(w, err)
+		return
+	}
+	if requestPayload.Allowed == nil {
+		app.errorJson(w, errors.New("missing allowed"))
+		return
+	}
+
+	if err := app.Models.MailMessage.SetTracking(c.UserID, *requestPayload.Allowed); err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: "mail tracking setting changed",
+		Data:    mailTrackingResponse{Allowed: *requestPayload.Allowed},
+	})
+}
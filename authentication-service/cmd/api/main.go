@@ -2,6 +2,15 @@ package main
 
 import (
 	"authentication/data"
+	"context"
+	"contracts/config"
+	"contracts/failover"
+	"contracts/keystore"
+	"contracts/lifecycle"
+	"contracts/loglevel"
+	"contracts/policy"
+	"contracts/token"
+	v1 "contracts/v1"
 	"database/sql"
 	"fmt"
 	"log"
@@ -10,36 +19,287 @@ import (
 	"time"
 
 	_ "github.com/lib/pq"
+	"github.com/redis/go-redis/v9"
 
 	_ "github.com/jackc/pgconn"
 	_ "github.com/jackc/pgx/v4"
 	_ "github.com/jackc/pgx/v4/stdlib"
 )
 
-const webPort = "80"
+// tokenIssuer is the iss claim of the access tokens of this service
+const tokenIssuer = "authentication-service"
 
 var counts int64
 
 type Config struct {
-	DB     *sql.DB
-	Models data.Models
+	DB       *sql.DB
+	Models   data.Models
+	LogToken string
+	AdminKey string
+	Redis    *redis.Client
+
+	// Keys holds the event and token signing keys
+	Keys *keystore.Store
+
+	// Logger is the logger service, see newEndpoint; LoggerKey is its admin
+	// key, for the forget calls of deleted accounts
+	Logger    *failover.Endpoint
+	LoggerKey string
+
+	// Tokens issues the access tokens of logged in users, Verifier checks them
+	Tokens   token.Issuer
+	Verifier token.Verifier
+
+	// RefreshTTL is how long the refresh tokens handed out with them are valid
+	RefreshTTL time.Duration
+
+	// Mail sends the password reset tokens, valid for PasswordResetTTL and
+	// appended to PasswordResetURL
+	Mail             *mailQueue
+	PasswordResetTTL time.Duration
+	PasswordResetURL string
+
+	// MailCapture keeps the mails instead of sending them in dry-run mode,
+	// nil otherwise
+	MailCapture *captureMailer
+
+	// MailTracking adds open pixels and wrapped links to HTML mails, nil
+	// when tracking is off
+	MailTracking *mailTracker
+
+	// MailInbound takes the replies to mails, nil when they are not handled
+	MailInbound *mailInbound
+
+	// Logs ships the log entries to logger-service
+	Logs *logShipper
+	// LogDelivery ships entries through Logs under the LOG_POLICY, by default
+	// entries the logger did not take are queued
+	LogDelivery *policy.Dependency[v1.LogEntry]
+
+	Lifecycle *lifecycle.Lifecycle
+
+	// MaxBodyBytes limits the JSON request bodies read by readJson
+	MaxBodyBytes int64
+
+	// RequestTimeout bounds the routes that set no timeout of their own
+	RequestTimeout time.Duration
+
+	// GroupRoles maps directory groups to the roles their members hold, a
+	// sync revokes at most GroupSyncMaxRevoke of them
+	GroupRoles         map[string][]string
+	GroupSyncMaxRevoke int
+	// GroupSyncURL is the directory membership pulled by the scheduled sync,
+	// read with GroupSyncToken
+	GroupSyncURL   string
+	GroupSyncToken string
 }
 
 func main() {
+	// every setting is an environment variable or a flag named after it,
+	// -dsn for DSN
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Panic(err)
+	}
+
+	loglevel.Setup(cfg.String("LOG_LEVEL", ""))
+
 	log.Println("Starting authentication service")
 
+	// PORT is where the API listens, 80 by default
+	webPort := cfg.Port("PORT", "80")
+	dsns := splitDSNs(cfg.DSN("DSN", ""), cfg.String("STANDBY_DSNS", ""))
+	if err := cfg.Err(); err != nil {
+		log.Panicf("Invalid configuration:\n%v", err)
+	}
+
+	keys, err := openKeystore()
+	if err != nil {
+		log.Panic(err)
+	}
+
+	// insecure settings stop the service in production
+	lintConfig(keys).Enforce("authentication")
+
 	//TODO connect to db
 
-	conn := connectToDB()
+	conn := connectToDB(dsns)
 	if conn == nil {
 		log.Panic("Can't connect to Postgres!")
 	}
 
+	// bounded bcrypt pool, cost and sizes come from the environment
+	data.ConfigureHasher(cfg.Int("HASH_WORKERS", 0), cfg.Int("HASH_QUEUE", 0), cfg.Int("BCRYPT_COST", 0))
+
+	// accounts are locked after LOCKOUT_THRESHOLD failed logins within
+	// LOCKOUT_WINDOW, for LOCKOUT_DURATION; a negative threshold never locks
+	data.ConfigureLockout(
+		cfg.Int("LOCKOUT_THRESHOLD", 0),
+		cfg.Duration("LOCKOUT_WINDOW", 0, time.Second),
+		cfg.Duration("LOCKOUT_DURATION", 0, time.Second),
+	)
+
 	// set up config
 
+	pg := data.NewPostgres(conn)
+
 	app := Config{
-		DB:     conn,
-		Models: data.New(conn),
+		DB:       conn,
+		Models:   data.New(pg),
+		LogToken: cfg.String("LOG_INGEST_TOKEN", ""),
+		AdminKey: cfg.String("ADMIN_API_KEY", ""),
+		Redis:    newRedis(cfg.Addr("REDIS_ADDR", "")),
+		Keys:     keys,
+	}
+
+	// the logger may have a secondary deployment the calls fail over to, e.g.
+	// LOGGER_SECONDARY_URL=https://logs.dr.example.com
+	app.Logger = app.newEndpoint(cfg, "logger-service", "LOGGER", "http://logger-service")
+	app.LoggerKey = cfg.String("LOGGER_ADMIN_KEY", "")
+
+	// entries go to the logger over gRPC at LOG_GRPC_ADDR, over HTTP without it
+	app.Logs = newLogShipper(cfg.Addr("LOG_GRPC_ADDR", ""), app.Logger, app.LogToken)
+	// with RABBITMQ_URL entries are published to the logs exchange instead,
+	// logins do not wait for the logger
+	app.Logs.bus = newLogBus(cfg.URL("RABBITMQ_URL", "", "amqp", "amqps"))
+
+	// LOG_POLICY=required fails the requests whose entry could not be
+	// shipped; best-effort, the default, queues up to LOG_QUEUE_SIZE entries
+	// while the logger is down and ships them once it is back
+	logPolicy, err := policy.ParseMode(cfg.String("LOG_POLICY", ""), policy.BestEffort)
+	if err != nil {
+		log.Panic(err)
+	}
+	app.LogDelivery = policy.New("logger-service", logPolicy, cfg.Int("LOG_QUEUE_SIZE", 0), app.Logs.Ship)
+	go app.LogDelivery.Run(context.Background())
+
+	// access tokens handed out on login, valid for TOKEN_TTL
+	tokenTTL := cfg.Duration("TOKEN_TTL", token.DefaultTTL, time.Second)
+	app.Tokens = token.Issuer{Keys: keys, Name: tokenIssuer, TTL: tokenTTL}
+	app.Verifier = token.Verifier{Keys: keys, Issuer: tokenIssuer, Leeway: 30 * time.Second}
+
+	// refresh tokens trade for new access tokens until REFRESH_TOKEN_TTL
+	app.RefreshTTL = cfg.Duration("REFRESH_TOKEN_TTL", data.DefaultRefreshTTL, time.Second)
+
+	// forgotten passwords are reset with a token mailed to the user
+	// MAIL_BULK_WORKERS of the MAIL_WORKERS also send bulk mail, the others
+	// only transactional mail
+	mailWorkers := cfg.Int("MAIL_WORKERS", 0)
+	mailBulkWorkers := cfg.Int("MAIL_BULK_WORKERS", 0)
+	mailQueueSize := cfg.Int("MAIL_QUEUE", 0)
+	// MAIL_DRY_RUN captures every mail instead, for staging
+	var sender mailer
+	if cfg.Bool("MAIL_DRY_RUN", false) {
+		app.MailCapture = newCaptureMailer(app.Redis)
+		sender = app.MailCapture
+	} else {
+		sender = newMailer()
+	}
+	app.Mail = newMailQueue(sender, mailWorkers, mailBulkWorkers, mailQueueSize)
+
+	// MAIL_TRACKING tracks opens and clicks of HTML mails, except for users
+	// who opted out; MAIL_TRACKING_URL is where clients reach /mail/t
+	app.MailTracking = newMailTracker(cfg.Bool("MAIL_TRACKING", false), cfg.URL("MAIL_TRACKING_URL", "", "http", "https"))
+	// MAIL_INBOUND_SECRET lets the mail provider post replies to /mail/inbound,
+	// matched by Message-IDs in MAIL_INBOUND_DOMAIN
+	app.MailInbound = newMailInbound(cfg.String("MAIL_INBOUND_SECRET", ""), cfg.String("MAIL_INBOUND_DOMAIN", ""))
+	app.PasswordResetURL = cfg.URL("PASSWORD_RESET_URL", "", "http", "https")
+	app.PasswordResetTTL = cfg.Duration("PASSWORD_RESET_TTL", data.DefaultPasswordResetTTL, time.Minute)
+
+	// key revocations made on any service
+	go watchRevocations(app.Redis, keys)
+
+	// logins are counted across the replicas for the active user gauges
+	app.publishActiveUsers()
+
+	// MAX_BODY_BYTES overrides the one mega byte limit of JSON request bodies
+	app.MaxBodyBytes = cfg.Int64("MAX_BODY_BYTES", 0)
+
+	// REQUEST_TIMEOUT overrides the ten seconds routes get unless they set
+	// a timeout of their own
+	app.RequestTimeout = cfg.Duration("REQUEST_TIMEOUT", 10*time.Second, time.Millisecond)
+
+	// job progress is streamed to clients by the broker
+	data.SetJobPublisher(func(job *data.Job) {
+		app.publishEvent("job:"+job.ID, "job", job)
+	})
+
+	// per-query timeouts and slow query logging
+	timeouts, err := data.ParseQueryTimeouts(cfg.String("DB_QUERY_TIMEOUTS", ""))
+	if err != nil {
+		log.Panic(err)
+	}
+	slowMs := cfg.Int("DB_SLOW_QUERY_MS", 0)
+	data.ConfigureQueries(timeouts, time.Duration(slowMs)*time.Millisecond)
+
+	// create missing tables before the queries on them are prepared
+	if err := pg.EnsureSchema(); err != nil {
+		log.Panic(err)
+	}
+
+	// prepare the login and registration queries once
+	if err := pg.PrepareStatements(); err != nil {
+		log.Panic(err)
+	}
+
+	// dead man's switch, the logger alerts when the heartbeats stop
+	heartbeatInterval := cfg.Duration("HEARTBEAT_INTERVAL", 30*time.Second, time.Second)
+
+	// elevated roles are taken back once their time is up
+	revokeInterval := cfg.Duration("ROLE_REVOKE_INTERVAL", time.Minute, time.Second)
+
+	// GROUP_ROLE_MAP maps directory groups to roles, {"group": ["role"]};
+	// a sync refuses to revoke more than GROUP_SYNC_MAX_REVOKE of them, 100
+	// by default, 0 lifts the limit
+	app.GroupRoles, err = parseGroupRoles(cfg.String("GROUP_ROLE_MAP", ""))
+	if err != nil {
+		log.Panic(err)
+	}
+	app.GroupSyncMaxRevoke = cfg.Int("GROUP_SYNC_MAX_REVOKE", 100)
+	// with GROUP_SYNC_URL the membership is pulled from the directory every
+	// GROUP_SYNC_INTERVAL, a day by default, with the GROUP_SYNC_TOKEN bearer
+	app.GroupSyncURL = cfg.URL("GROUP_SYNC_URL", "", "http", "https")
+	app.GroupSyncToken = cfg.String("GROUP_SYNC_TOKEN", "")
+	syncInterval := cfg.Duration("GROUP_SYNC_INTERVAL", 24*time.Hour, time.Minute)
+
+	// settings that are set but invalid stop the service before it serves
+	if err := cfg.Err(); err != nil {
+		log.Panicf("Invalid configuration:\n%v", err)
+	}
+
+	go app.sendHeartbeats(heartbeatInterval)
+	go app.revokeExpiredRoles(revokeInterval)
+	if app.GroupSyncURL != "" && len(app.GroupRoles) > 0 {
+		go app.syncRolesFromDirectory(syncInterval)
+	}
+
+	// jobs of replicas that stopped while running them can not finish anymore
+	go app.failInterruptedJobs(time.Minute)
+
+	// probes, the preStop drain and the shutdown, see lifecycle
+	app.Lifecycle = lifecycle.New()
+	app.Lifecycle.AdminKey = app.AdminKey
+	app.Lifecycle.AddCheck("postgres", conn.PingContext)
+	app.Lifecycle.OnShutdown("postgres", func(context.Context) error {
+		return conn.Close()
+	})
+	if app.Redis != nil {
+		app.Lifecycle.AddCheck("redis", func(ctx context.Context) error {
+			return app.Redis.Ping(ctx).Err()
+		})
+		app.Lifecycle.OnShutdown("redis", func(context.Context) error {
+			return app.Redis.Close()
+		})
+	}
+	if app.Logs.bus != nil {
+		app.Lifecycle.OnShutdown("log bus", func(context.Context) error {
+			return app.Logs.bus.close()
+		})
+	}
+	// entries queued while the logger was down get a last chance
+	app.Lifecycle.OnShutdown("log queue", app.flushLogs)
+	if pod := app.Lifecycle.Pod; pod != nil {
+		log.Printf("Running as pod %s/%s on node %s", pod.Namespace, pod.Name, pod.Node)
 	}
 
 	srv := &http.Server{
@@ -47,32 +307,54 @@ func main() {
 		Handler: app.routes(),
 	}
 
-	err := srv.ListenAndServe()
-
-	if err != nil {
+	if err := app.Lifecycle.Serve(srv); err != nil {
 		log.Panic(err)
 	}
 }
 
-func openDB(dsn string) (*sql.DB, error) {
-	db, err := sql.Open("postgres", dsn) // Đúng driver
+// flushLogs waits until the queued log entries are shipped or ctx is done
+func (app *Config) flushLogs(ctx context.Context) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for app.LogDelivery.Pending() > 0 {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d log entries not shipped", app.LogDelivery.Pending())
+		case <-ticker.C:
+		}
+	}
+
+	return nil
+}
+
+func openDB(dsns []string) (*sql.DB, error) {
+	connector, err := newFailoverConnector(dsns) // Đúng driver, có failover sang standby
 	if err != nil {
 		return nil, err
 	}
 
+	db := sql.OpenDB(connector)
+
 	err = db.Ping()
 	if err != nil {
+		db.Close()
 		return nil, err
 	}
 
+	// connections to a standby are recycled so a recovered primary takes over again
+	db.SetConnMaxLifetime(time.Minute)
+
+	if len(dsns) > 1 {
+		go connector.probePrimary(db)
+	}
+
 	return db, nil
 }
 
-func connectToDB() *sql.DB {
-	dsn := os.Getenv("DSN")
-
+func connectToDB(dsns []string) *sql.DB {
 	for {
-		connection, err := openDB(dsn)
+		connection, err := openDB(dsns)
 
 		if err != nil {
 			log.Printf("Postgres not yet ready ...")
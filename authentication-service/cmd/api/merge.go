@@ -0,0 +1,154 @@
+package main
+
+import (
+	"authentication/data"
+	"bytes"
+	v1 "contracts/v1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type MergePayload struct {
+	SourceID int    `json:"source_id"`
+	TargetID int    `json:"target_id"`
+	DryRun   bool   `json:"dry_run"`
+	Actor    string `json:"actor"`
+}
+
+// mergeResponse is a merge and how the services holding references to the
+// merged account were told about it
+type mergeResponse struct {
+	*data.MergeResult
+	Downstream map[string]string `json:"downstream,omitempty"`
+}
+
+// MergeUsers merges the account source_id into target_id, for people who
+// signed up twice. With dry_run it only reports what the merge would do.
+func (app *Config) MergeUsers(w http.ResponseWriter, r *http.Request) {
+	var requestPayload MergePayload
+
+	err := app.readJson(w, r, &requestPayload)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	if requestPayload.SourceID <= 0 || requestPayload.TargetID <= 0 {
+		app.errorJson(w, errors.New("source_id and target_id are required"))
+		return
+	}
+	if requestPayload.Actor == "" {
+		requestPayload.Actor = "admin"
+	}
+
+	result, err := app.Models.UserAdmin.Merge(requestPayload.SourceID, requestPayload.TargetID, requestPayload.Actor, requestPayload.DryRun)
+	if errors.Is(err, data.ErrUserNotFound) {
+		app.errorJson(w, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	if result.DryRun {
+		app.writeJson(w, http.StatusOK, jsonReponse{
+			Error:   false,
+			Message: "merge plan",
+			Data:    mergeResponse{MergeResult: result},
+		})
+		return
+	}
+
+	downstream := app.propagateMerge(result)
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: fmt.Sprintf("user %d merged into user %d", result.SourceID, result.TargetID),
+		Data:    mergeResponse{MergeResult: result, Downstream: downstream},
+	})
+}
+
+// propagateMerge points the references other services keep to the merged
+// account at the account it was merged into. The merge is committed by then,
+// so failures are reported for a retry instead of undoing it.
+func (app *Config) propagateMerge(result *data.MergeResult) map[string]string {
+	downstream := map[string]string{"logger": "ok"}
+
+	err := app.linkUserLogs(result.SourceID, result.TargetID)
+	if err != nil {
+		log.Printf("Error linking the logs of user %d to user %d: %v", result.SourceID, result.TargetID, err)
+		downstream["logger"] = err.Error()
+	}
+
+	detail := fmt.Sprintf("user %d (%s) merged into user %d", result.SourceID, result.SourceEmail, result.TargetID)
+	if err := app.logUserRequest("user.merged", detail, result.TargetID); err != nil {
+		log.Printf("Error emitting user.merged for user %d: %v", result.TargetID, err)
+	}
+
+	app.publishEvent(fmt.Sprintf("user:%d", result.TargetID), "notification", v1.Notification{
+		UserID:  result.TargetID,
+		Title:   "Account updated",
+		Message: fmt.Sprintf("Your account %s was merged into this one", result.SourceEmail),
+	})
+
+	return downstream
+}
+
+// linkUserLogs asks the logger service to list the entries of a merged account
+// under the account it was merged into
+func (app *Config) linkUserLogs(from, to int) error {
+	jsonData, _ := json.Marshal(v1.UserMerge{From: strconv.Itoa(from), To: strconv.Itoa(to)})
+
+	request, err := http.NewRequest("POST", "/users/merge", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "Bearer "+app.LogToken)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	response, err := app.Logger.Do(client, request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("logger service answered %d", response.StatusCode)
+	}
+
+	return nil
+}
+
+// ListMerges returns the merge audit trail, latest first
+func (app *Config) ListMerges(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 1000 {
+			app.errorJson(w, errors.New("limit must be between 1 and 1000"))
+			return
+		}
+		limit = n
+	}
+
+	merges, err := app.Models.UserAdmin.Merges(limit)
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: "user merges",
+		Data:    merges,
+	})
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds of the latency histogram sent to the
+// logger, which computes the SLOs. Keep them in sync with the logger.
+var latencyBuckets = []time.Duration{
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+}
+
+// RequestStats counts requests since the last heartbeat. Buckets has one more
+// entry than latencyBuckets for requests slower than the last bound.
+type RequestStats struct {
+	Total   int64   `json:"total"`
+	Errors  int64   `json:"errors"`
+	Buckets []int64 `json:"buckets"`
+}
+
+type requestCounter struct {
+	mu    sync.Mutex
+	stats RequestStats
+}
+
+var requests = &requestCounter{}
+
+func (c *requestCounter) observe(status int, elapsed time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stats.Buckets == nil {
+		c.stats.Buckets = make([]int64, len(latencyBuckets)+1)
+	}
+
+	c.stats.Total++
+	if status >= 500 {
+		c.stats.Errors++
+	}
+
+	i := 0
+	for i < len(latencyBuckets) && elapsed > latencyBuckets[i] {
+		i++
+	}
+	c.stats.Buckets[i]++
+}
+
+// take returns the counts and starts over
+func (c *requestCounter) take() RequestStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	c.stats = RequestStats{}
+
+	return stats
+}
+
+// restore adds counts back that could not be delivered
+func (c *requestCounter) restore(stats RequestStats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stats.Buckets == nil {
+		c.stats.Buckets = make([]int64, len(latencyBuckets)+1)
+	}
+
+	c.stats.Total += stats.Total
+	c.stats.Errors += stats.Errors
+	for i, n := range stats.Buckets {
+		if i < len(c.stats.Buckets) {
+			c.stats.Buckets[i] += n
+		}
+	}
+}
+
+// statusRecorder remembers the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// countRequests feeds every request into the SLO counts
+func countRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		requests.observe(rec.status, time.Since(start))
+	})
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"authentication/data"
+	"contracts/token"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+)
+
+// requireAdmin only lets requests through that carry the admin key in the
+// X-Admin-Key header, or the bearer token of a user with the admin role. When
+// no admin key is configured only admin users get through.
+func (app *Config) requireAdmin(next http.Handler) http.Handler {
+	asUser := app.requireRole(data.RoleAdmin)(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("X-Admin-Key")
+
+		if key == "" && token.FromRequest(r) != "" {
+			asUser.ServeHTTP(w, r)
+			return
+		}
+
+		if app.AdminKey == "" || subtle.ConstantTimeCompare([]byte(key), []byte(app.AdminKey)) != 1 {
+			app.errorJson(w, errors.New("admin key required"), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// adminIdentity names the admin behind a request requireAdmin let through:
+// the email of the admin user, or "admin-key" for the shared key
+func adminIdentity(r *http.Request) string {
+	if c, ok := callerFromContext(r.Context()); ok {
+		return c.Email
+	}
+	return "admin-key"
+}
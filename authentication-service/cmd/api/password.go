@@ -0,0 +1,130 @@
+package main
+
+import (
+	"authentication/data"
+	v1 "contracts/v1"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// minPasswordLength is the shortest password a reset accepts
+const minPasswordLength = 8
+
+// forgotPasswordMessage is the answer to every forgot password request, known
+// address or not, so the endpoint can not be used to find accounts
+const forgotPasswordMessage = "if the address belongs to an account, a reset link was sent to it"
+
+// ForgotPassword mails a one-time password reset token to the address of an
+// account. Tokens expire after PASSWORD_RESET_TTL and a new one voids those
+// sent before.
+func (app *Config) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var requestPayload v1.ForgotPasswordRequest
+
+	if err := app.readJson(w, r, &requestPayload); err != nil {
+		app.errorJson(w, err, http.StatusBadRequest)
+		return
+	}
+	if requestPayload.Email == "" {
+		app.errorJson(w, errors.New("missing email"), http.StatusBadRequest)
+		return
+	}
+
+	// the token is issued and mailed in the background, waiting for the
+	// database, the mail queue or the logger would tell known addresses apart
+	user, err := app.Models.User.GetByEmail(requestPayload.Email)
+	if err == nil && user.Active {
+		go app.issuePasswordReset(user)
+	}
+
+	app.writeJson(w, http.StatusAccepted, jsonReponse{
+		Error:   false,
+		Message: forgotPasswordMessage,
+	})
+}
+
+// issuePasswordReset issues a reset token for user and mails it
+func (app *Config) issuePasswordReset(user *data.User) {
+	raw, expires, err := app.Models.PasswordReset.Issue(user.ID, app.PasswordResetTTL)
+	if err != nil {
+		log.Printf("Error issuing the password reset of user %d: %v", user.ID, err)
+		return
+	}
+
+	app.sendPasswordReset(user, raw, expires)
+
+	if err := app.logUserRequest("authentication", "password reset requested", user.ID); err != nil {
+		log.Println("Error logging the password reset request:", err)
+	}
+}
+
+// ResetPassword sets a new password with a token mailed by ForgotPassword. The
+// token works once and the sessions of the user are logged out.
+func (app *Config) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var requestPayload v1.ResetPasswordRequest
+
+	if err := app.readJson(w, r, &requestPayload); err != nil {
+		app.errorJson(w, err, http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case requestPayload.Token == "":
+		app.errorJson(w, errors.New("missing token"), http.StatusBadRequest)
+		return
+	case len(requestPayload.Password) < minPasswordLength:
+		app.errorJson(w, fmt.Errorf("password must have at least %d characters", minPasswordLength), http.StatusBadRequest)
+		return
+	}
+
+	// the token is only spent with the password set, a busy hasher leaves it
+	// valid for a retry
+	userID, err := app.Models.PasswordReset.Redeem(requestPayload.Token, requestPayload.Password)
+	switch {
+	case errors.Is(err, data.ErrResetTokenInvalid):
+		app.errorJson(w, err, http.StatusBadRequest)
+		return
+	case errors.Is(err, data.ErrHasherBusy):
+		app.busyJson(w, err)
+		return
+	case err != nil:
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// whoever reads the mail of the account may log in again at once
+	if err := app.Models.AccountLock.Unlock(userID); err != nil && !errors.Is(err, data.ErrNotLocked) {
+		log.Println("Error unlocking the account after its password reset:", err)
+	}
+
+	if err := app.logUserRequest("authentication", "password reset", userID); err != nil {
+		log.Println("Error logging the password reset:", err)
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: "password reset, log in with the new password",
+	})
+}
+
+func (app *Config) sendPasswordReset(user *data.User, raw string, expires time.Time) {
+	link := raw
+	if app.PasswordResetURL != "" {
+		link = app.PasswordResetURL + "?token=" + url.QueryEscape(raw)
+	}
+
+	m, err := app.renderUserMail("password_reset", user, map[string]any{
+		"Name":      user.FirstName,
+		"Link":      link,
+		"ExpiresAt": expires.UTC().Format(time.RFC1123),
+	})
+	if err == nil {
+		err = app.Mail.Enqueue(mailTransactional, m)
+	}
+	if err != nil {
+		log.Printf("Error mailing the password reset of user %d: %v", user.ID, err)
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"authentication/data"
+	"context"
+	"contracts/token"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+)
+
+// caller is the user behind the access token of a request, with the roles and
+// permissions they hold at the time of the request. Handlers that check more
+// finely than their route use data.HasPermission on Permissions.
+type caller struct {
+	UserID      int      `json:"user_id"`
+	Email       string   `json:"email"`
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+}
+
+type callerKey struct{}
+
+// callerFromContext returns the caller requireRole let through
+func callerFromContext(ctx context.Context) (*caller, bool) {
+	c, ok := ctx.Value(callerKey{}).(*caller)
+	return c, ok
+}
+
+// requireRole only lets requests through whose bearer token belongs to a user
+// holding one of the roles; admins hold them all. Roles are read at every
+// request, so a revoked role stops working at once and not when the token
+// expires.
+func (app *Config) requireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c, err := app.authorize(r)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				app.errorJson(w, err, http.StatusUnauthorized)
+				return
+			}
+
+			if !data.HasRole(c.Roles, roles...) {
+				app.errorJson(w, fmt.Errorf("one of the roles %v is required", roles), http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), callerKey{}, c)))
+		})
+	}
+}
+
+// authorize verifies the bearer token of a request and loads the roles and
+// permissions of its user
+func (app *Config) authorize(r *http.Request) (*caller, error) {
+	raw := token.FromRequest(r)
+	if raw == "" {
+		return nil, errors.New("missing bearer token")
+	}
+
+	claims, err := app.Verifier.Verify(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return nil, token.ErrClaims
+	}
+
+	roles, err := app.Models.User.RolesOf(userID)
+	if err != nil {
+		return nil, err
+	}
+	permissions, err := app.Models.User.PermissionsOf(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &caller{UserID: userID, Email: claims.Email, Roles: roles, Permissions: permissions}, nil
+}
+
+// Me returns the caller with their roles and permissions, so a client can tell
+// what to offer
+func (app *Config) Me(w http.ResponseWriter, r *http.Request) {
+	c, _ := callerFromContext(r.Context())
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: c.Email,
+		Data:    c,
+	})
+}
+
+// ListRoles returns every role with its permissions
+func (app *Config) ListRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := app.Models.Role.All()
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: fmt.Sprintf("%d roles", len(roles)),
+		Data:    roles,
+	})
+}
+
+// GetRole returns one role
+func (app *Config) GetRole(w http.ResponseWriter, r *http.Request) {
+	role, err := app.Models.Role.Get(chi.URLParam(r, "name"))
+	if err != nil {
+		app.roleError(w, err)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: role.Name,
+		Data:    role,
+	})
+}
+
+// CreateRole adds a role
+func (app *Config) CreateRole(w http.ResponseWriter, r *http.Request) {
+	var requestPayload data.Role
+
+	if err := app.readJson(w, r, &requestPayload); err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	role, err := app.Models.Role.Insert(requestPayload)
+	if err != nil {
+		app.roleError(w, err)
+		return
+	}
+
+	app.logRoleChange(fmt.Sprintf("role %s created with permissions %v", role.Name, role.Permissions))
+
+	app.writeJson(w, http.StatusCreated, jsonReponse{
+		Error:   false,
+		Message: "role created",
+		Data:    role,
+	})
+}
+
+// UpdateRole replaces the description and permissions of a role
+func (app *Config) UpdateRole(w http.ResponseWriter, r *http.Request) {
+	var requestPayload data.Role
+
+	if err := app.readJson(w, r, &requestPayload); err != nil {
+		app.errorJson(w, err)
+		return
+	}
+	requestPayload.Name = chi.URLParam(r, "name")
+
+	role, err := app.Models.Role.Update(requestPayload)
+	if err != nil {
+		app.roleError(w, err)
+		return
+	}
+
+	app.logRoleChange(fmt.Sprintf("role %s now has permissions %v", role.Name, role.Permissions))
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: "role updated",
+		Data:    role,
+	})
+}
+
+// DeleteRole removes a role from the catalogue and from every user
+func (app *Config) DeleteRole(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	if err := app.Models.Role.Delete(name); err != nil {
+		app.roleError(w, err)
+		return
+	}
+
+	app.logRoleChange(fmt.Sprintf("role %s deleted", name))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AssignRole gives a user a standing role
+func (app *Config) AssignRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJson(w, errors.New("invalid user id"))
+		return
+	}
+	role := chi.URLParam(r, "role")
+
+	if err := app.Models.User.AssignRole(userID, role); err != nil {
+		app.roleError(w, err)
+		return
+	}
+
+	if err := app.logUserRequest("authentication", fmt.Sprintf("role %s assigned", role), userID); err != nil {
+		log.Println("Error logging the role assignment:", err)
+	}
+
+	app.userRoles(w, userID)
+}
+
+// RevokeRole takes a role from a user
+func (app *Config) RevokeRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJson(w, errors.New("invalid user id"))
+		return
+	}
+	role := chi.URLParam(r, "role")
+
+	if err := app.Models.User.RevokeRole(userID, role); err != nil {
+		app.roleError(w, err)
+		return
+	}
+
+	if err := app.logUserRequest("authentication", fmt.Sprintf("role %s revoked", role), userID); err != nil {
+		log.Println("Error logging the role revocation:", err)
+	}
+
+	app.userRoles(w, userID)
+}
+
+// GetUserRoles returns the roles a user holds now
+func (app *Config) GetUserRoles(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJson(w, errors.New("invalid user id"))
+		return
+	}
+
+	app.userRoles(w, userID)
+}
+
+func (app *Config) userRoles(w http.ResponseWriter, userID int) {
+	roles, err := app.Models.User.RolesOf(userID)
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: fmt.Sprintf("%d roles", len(roles)),
+		Data:    map[string]any{"user_id": userID, "roles": roles},
+	})
+}
+
+func (app *Config) logRoleChange(message string) {
+	if err := app.logRequest("authentication", message); err != nil {
+		log.Println("Error logging the role change:", err)
+	}
+}
+
+func (app *Config) roleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, data.ErrRoleNotFound), errors.Is(err, data.ErrUserNotFound):
+		app.errorJson(w, err, http.StatusNotFound)
+	case errors.Is(err, data.ErrRoleExists), errors.Is(err, data.ErrBuiltinRole):
+		app.errorJson(w, err, http.StatusConflict)
+	default:
+		app.errorJson(w, err)
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"authentication/data"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxMembershipBytes limits the membership feeds read for a role sync, which
+// list the whole directory
+const maxMembershipBytes = 32 << 20
+
+// scimPageSize is how many users are asked for per page of a SCIM directory
+const scimPageSize = 500
+
+// SyncRoles reconciles the standing roles mapped to directory groups, see
+// GROUP_ROLE_MAP, with the membership in the body. The body lists every member
+// of the directory, as
+//
+//	text/csv                    rows of email,group, an optional header row
+//	application/scim+json       a SCIM ListResponse of users with their groups
+//	application/json            [{"email": ..., "groups": [...]}]
+//
+// With ?dry_run=true the diff is returned without applying it.
+func (app *Config) SyncRoles(w http.ResponseWriter, r *http.Request) {
+	if len(app.GroupRoles) == 0 {
+		app.errorJson(w, errors.New("no groups are mapped to roles, set GROUP_ROLE_MAP"), http.StatusConflict)
+		return
+	}
+
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxMembershipBytes)
+	members, _, err := parseMembership(r.Header.Get("Content-Type"), r.Body)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	report, err := app.syncRoles(members, dryRun, adminIdentity(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRoleNotFound):
+			app.errorJson(w, err, http.StatusConflict)
+		case errors.Is(err, data.ErrRoleSyncGuard):
+			app.errorJson(w, err, http.StatusUnprocessableEntity)
+		default:
+			app.errorJson(w, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	message := "roles synced"
+	if dryRun {
+		message = "dry run, nothing changed"
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: message,
+		Data:    report,
+	})
+}
+
+// syncRoles applies a membership and logs every role it assigned or revoked
+// on behalf of by
+func (app *Config) syncRoles(members []data.GroupMembership, dryRun bool, by string) (*data.RoleSyncReport, error) {
+	report, err := app.Models.UserAdmin.SyncRoles(members, app.GroupRoles, app.GroupSyncMaxRevoke, dryRun)
+	if err != nil || dryRun {
+		return report, err
+	}
+
+	for _, change := range report.Assigned {
+		detail := fmt.Sprintf("role %s assigned by directory sync (%s)", change.Role, by)
+		if err := app.logUserRequest("user.role_synced", detail, change.UserID); err != nil {
+			log.Printf("Error logging the role sync of user %d: %v", change.UserID, err)
+		}
+	}
+	for _, change := range report.Revoked {
+		detail := fmt.Sprintf("role %s revoked by directory sync (%s)", change.Role, by)
+		if err := app.logUserRequest("user.role_synced", detail, change.UserID); err != nil {
+			log.Printf("Error logging the role sync of user %d: %v", change.UserID, err)
+		}
+	}
+
+	log.Printf("Role sync by %s: %d assigned, %d revoked, %d unchanged, %d unknown users",
+		by, len(report.Assigned), len(report.Revoked), report.Unchanged, len(report.UnknownUsers))
+
+	return report, nil
+}
+
+// syncRolesFromDirectory pulls the membership from GROUP_SYNC_URL every
+// interval and applies it, so directory changes reach the roles without an
+// admin posting them
+func (app *Config) syncRolesFromDirectory(interval time.Duration) {
+	client := &http.Client{Timeout: time.Minute}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		members, err := fetchMembership(client, app.GroupSyncURL, app.GroupSyncToken)
+		if err != nil {
+			log.Println("Error fetching the directory membership:", err)
+			continue
+		}
+
+		if _, err := app.syncRoles(members, false, "scheduled"); err != nil {
+			log.Println("Error syncing roles from the directory:", err)
+		}
+	}
+}
+
+// fetchMembership reads the membership at url, following the pages of a SCIM
+// directory
+func fetchMembership(client *http.Client, rawURL, bearer string) ([]data.GroupMembership, error) {
+	var members []data.GroupMembership
+
+	startIndex := 1
+	for {
+		pageURL, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		if startIndex > 1 {
+			query := pageURL.Query()
+			query.Set("startIndex", strconv.Itoa(startIndex))
+			query.Set("count", strconv.Itoa(scimPageSize))
+			pageURL.RawQuery = query.Encode()
+		}
+
+		page, total, err := fetchMembershipPage(client, pageURL.String(), bearer)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, page...)
+
+		// only SCIM directories report a total, the other feeds are one page
+		if total <= 0 || len(page) == 0 || startIndex+len(page) > total {
+			return members, nil
+		}
+		startIndex += len(page)
+	}
+}
+
+func fetchMembershipPage(client *http.Client, pageURL, bearer string) ([]data.GroupMembership, int, error) {
+	request, err := http.NewRequest("GET", pageURL, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	request.Header.Set("Accept", "application/scim+json, application/json, text/csv")
+	if bearer != "" {
+		request.Header.Set("Authorization", "Bearer "+bearer)
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("directory answered %s", response.Status)
+	}
+
+	return parseMembership(response.Header.Get("Content-Type"), io.LimitReader(response.Body, maxMembershipBytes))
+}
+
+// parseMembership reads a membership feed by its content type. total is the
+// number of users a SCIM directory holds over all pages, 0 for other feeds.
+func parseMembership(contentType string, body io.Reader) (members []data.GroupMembership, total int, err error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	switch mediaType {
+	case "text/csv":
+		members, err = parseMembershipCSV(body)
+	case "application/scim+json":
+		members, total, err = parseMembershipSCIM(body)
+	case "application/json", "":
+		members, err = parseMembershipJSON(body)
+	default:
+		err = fmt.Errorf("unsupported membership format %q", mediaType)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for i, m := range members {
+		if m.Email == "" {
+			return nil, 0, fmt.Errorf("member %d has no email", i+1)
+		}
+	}
+
+	return members, total, nil
+}
+
+// parseMembershipCSV reads rows of email,group; the groups of an email are
+// gathered over its rows
+func parseMembershipCSV(body io.Reader) ([]data.GroupMembership, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+
+	var members []data.GroupMembership
+	index := make(map[string]int)
+
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return members, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		email, group := strings.TrimSpace(record[0]), strings.TrimSpace(record[1])
+		if line == 1 && strings.EqualFold(email, "email") {
+			continue
+		}
+
+		key := strings.ToLower(email)
+		i, ok := index[key]
+		if !ok {
+			i = len(members)
+			index[key] = i
+			members = append(members, data.GroupMembership{Email: email})
+		}
+		if group != "" {
+			members[i].Groups = append(members[i].Groups, group)
+		}
+	}
+}
+
+// scimListResponse is the part of a SCIM ListResponse of users a sync reads
+type scimListResponse struct {
+	TotalResults int `json:"totalResults"`
+	Resources    []struct {
+		UserName string `json:"userName"`
+		Emails   []struct {
+			Value   string `json:"value"`
+			Primary bool   `json:"primary"`
+		} `json:"emails"`
+		Groups []struct {
+			Display string `json:"display"`
+			Value   string `json:"value"`
+		} `json:"groups"`
+	} `json:"Resources"`
+}
+
+// parseMembershipSCIM reads a page of SCIM users. The primary email is used,
+// the first one without, and the userName when a user has none; groups are
+// matched by display name, by id when they have none.
+func parseMembershipSCIM(body io.Reader) ([]data.GroupMembership, int, error) {
+	var list scimListResponse
+	if err := json.NewDecoder(body).Decode(&list); err != nil {
+		return nil, 0, decodeError(err)
+	}
+
+	members := make([]data.GroupMembership, 0, len(list.Resources))
+	for _, user := range list.Resources {
+		member := data.GroupMembership{Email: user.UserName}
+		for i, email := range user.Emails {
+			if email.Primary || i == 0 {
+				member.Email = email.Value
+			}
+		}
+		for _, group := range user.Groups {
+			name := group.Display
+			if name == "" {
+				name = group.Value
+			}
+			member.Groups = append(member.Groups, name)
+		}
+		members = append(members, member)
+	}
+
+	return members, list.TotalResults, nil
+}
+
+func parseMembershipJSON(body io.Reader) ([]data.GroupMembership, error) {
+	var members []data.GroupMembership
+
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&members); err != nil {
+		return nil, decodeError(err)
+	}
+
+	return members, nil
+}
+
+// parseGroupRoles parses GROUP_ROLE_MAP, a JSON object of the roles each
+// directory group grants
+func parseGroupRoles(s string) (map[string][]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var groupRoles map[string][]string
+	if err := json.Unmarshal([]byte(s), &groupRoles); err != nil {
+		return nil, fmt.Errorf("GROUP_ROLE_MAP: %w", err)
+	}
+
+	return groupRoles, nil
+}
@@ -1,19 +1,181 @@
 package main
 
 import (
+	"authentication/data"
+	"contracts/loglevel"
+	"contracts/negotiate"
+	"contracts/ratelimit"
+	"contracts/timeout"
+	"errors"
+	"expvar"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/cors"
 )
 
+// noTimeout is the timeout of routes that must not have one
+const noTimeout time.Duration = -1
+
+// scopes a route can require
+const (
+	scopeAdmin = "admin"
+)
+
+// route declares one endpoint with the middleware it needs. A zero rate means
+// no limit, a zero timeout the RequestTimeout of the service and noTimeout
+// none, for routes that stream.
+type route struct {
+	method  string
+	path    string
+	handler http.HandlerFunc
+	scopes  []string
+	roles   []string // the caller's user must hold one of them, see requireRole
+	rate    int      // requests per minute per client
+	timeout time.Duration
+}
+
+func (app *Config) routeTable() []route {
+	return []route{
+		{method: "GET", path: "/version", handler: app.Version},
+
+		// orchestrator probes and the preStop hook, the drain waits on purpose
+		{method: "GET", path: "/livez", handler: app.Lifecycle.Livez},
+		{method: "GET", path: "/healthz", handler: app.Lifecycle.Healthz, timeout: 5 * time.Second},
+		{method: "GET", path: "/readyz", handler: app.Lifecycle.Readyz, timeout: 5 * time.Second},
+		{method: "POST", path: "/drain", handler: app.Lifecycle.Drain, timeout: noTimeout},
+
+		{method: "GET", path: "/admin/loglevel", handler: loglevel.GetHandler, scopes: []string{scopeAdmin}},
+		{method: "PUT", path: "/admin/loglevel", handler: loglevel.SetHandler, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+
+		{method: "GET", path: "/debug/vars", handler: expvar.Handler().ServeHTTP, scopes: []string{scopeAdmin}},
+		{method: "GET", path: "/admin/metrics/active-users", handler: app.ActiveUsers, scopes: []string{scopeAdmin}, timeout: 5 * time.Second},
+
+		// password checks are slow on purpose, the limit keeps guessing slow too
+		{method: "POST", path: "/authenticate", handler: app.Authenticate, rate: 30, timeout: 15 * time.Second},
+		{method: "POST", path: "/register", handler: app.Register, rate: 10, timeout: 15 * time.Second},
+		{method: "POST", path: "/v1/token/validate", handler: app.ValidateToken, timeout: 5 * time.Second},
+		{method: "POST", path: "/refresh", handler: app.Refresh, rate: 60, timeout: 10 * time.Second},
+		{method: "POST", path: "/logout", handler: app.Logout, rate: 60, timeout: 10 * time.Second},
+		{method: "POST", path: "/password/forgot", handler: app.ForgotPassword, rate: 5, timeout: 10 * time.Second},
+		{method: "POST", path: "/password/reset", handler: app.ResetPassword, rate: 10, timeout: 15 * time.Second},
+		{method: "GET", path: "/v1/me", handler: app.Me, roles: []string{data.RoleUser}, timeout: 5 * time.Second},
+		{method: "GET", path: "/users/me/security", handler: app.SecurityCenter, roles: []string{data.RoleUser}, timeout: 10 * time.Second},
+
+		// mail templates rendered without sending, and the mails kept in dry-run mode
+		{method: "POST", path: "/mail/preview", handler: app.PreviewMail, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+		{method: "GET", path: "/admin/mail/captured", handler: app.ListCapturedMail, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+		{method: "DELETE", path: "/admin/mail/captured", handler: app.ClearCapturedMail, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+
+		// stored versions of the mail templates, rolled out to a share of the recipients
+		{method: "GET", path: "/admin/mail/templates", handler: app.ListMailTemplates, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+		{method: "GET", path: "/admin/mail/templates/{name}", handler: app.GetMailTemplate, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+		{method: "DELETE", path: "/admin/mail/templates/{name}", handler: app.DeleteMailTemplate, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+		{method: "POST", path: "/admin/mail/templates/{name}/versions", handler: app.CreateMailTemplateVersion, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+		{method: "GET", path: "/admin/mail/templates/{name}/versions/{version}", handler: app.GetMailTemplateVersion, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+		{method: "DELETE", path: "/admin/mail/templates/{name}/versions/{version}", handler: app.DeleteMailTemplateVersion, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+		{method: "PUT", path: "/admin/mail/templates/{name}/rollout", handler: app.SetMailTemplateRollout, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+		{method: "POST", path: "/admin/mail/templates/{name}/rollback", handler: app.RollbackMailTemplate, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+
+		// open pixels and wrapped links of tracked mails, and who opted out
+		{method: "GET", path: "/mail/t/{id}/o", handler: app.MailOpened, rate: 120, timeout: 5 * time.Second},
+		{method: "GET", path: "/mail/t/{id}/c/{n}", handler: app.MailClicked, rate: 120, timeout: 5 * time.Second},
+		{method: "GET", path: "/admin/mail/messages/{id}", handler: app.GetMailMessage, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+		{method: "GET", path: "/v1/me/mail-tracking", handler: app.GetMailTracking, roles: []string{data.RoleUser}, timeout: 5 * time.Second},
+		{method: "PUT", path: "/v1/me/mail-tracking", handler: app.SetMailTracking, roles: []string{data.RoleUser}, timeout: 5 * time.Second},
+
+		// replies to mails, posted by the mail provider with its own secret
+		{method: "POST", path: "/mail/inbound", handler: app.InboundMail, rate: 120, timeout: 30 * time.Second},
+
+		// user accounts, paged and searched
+		{method: "GET", path: "/admin/users", handler: app.ListUsers, scopes: []string{scopeAdmin}, timeout: 15 * time.Second},
+		{method: "GET", path: "/admin/users/{id}", handler: app.GetUser, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+		{method: "PATCH", path: "/admin/users/{id}", handler: app.UpdateUser, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+		{method: "DELETE", path: "/admin/users/{id}", handler: app.DeleteUser, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+
+		// roles and what they allow, assigned to users one by one or in bulk
+		{method: "GET", path: "/admin/roles", handler: app.ListRoles, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+		{method: "POST", path: "/admin/roles", handler: app.CreateRole, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+		{method: "GET", path: "/admin/roles/{name}", handler: app.GetRole, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+		{method: "PUT", path: "/admin/roles/{name}", handler: app.UpdateRole, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+		{method: "DELETE", path: "/admin/roles/{name}", handler: app.DeleteRole, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+		{method: "GET", path: "/admin/users/{id}/roles", handler: app.GetUserRoles, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+		{method: "PUT", path: "/admin/users/{id}/roles/{role}", handler: app.AssignRole, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+		{method: "DELETE", path: "/admin/users/{id}/roles/{role}", handler: app.RevokeRole, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+		{method: "POST", path: "/admin/roles/sync", handler: app.SyncRoles, scopes: []string{scopeAdmin}, timeout: 60 * time.Second},
+
+		// accounts locked after too many failed logins
+		{method: "GET", path: "/admin/users/{id}/lock", handler: app.GetAccountLock, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+		{method: "DELETE", path: "/admin/users/{id}/lock", handler: app.UnlockAccount, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+
+		{method: "POST", path: "/admin/users/bulk", handler: app.BulkUsers, scopes: []string{scopeAdmin}, timeout: 60 * time.Second},
+		{method: "POST", path: "/admin/users/merge", handler: app.MergeUsers, scopes: []string{scopeAdmin}, timeout: 30 * time.Second},
+		{method: "GET", path: "/admin/users/merges", handler: app.ListMerges, scopes: []string{scopeAdmin}, timeout: 15 * time.Second},
+
+		// time-boxed roles, approved by a second admin and revoked when they expire
+		{method: "POST", path: "/admin/elevations", handler: app.RequestElevation, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+		{method: "GET", path: "/admin/elevations", handler: app.ListElevations, scopes: []string{scopeAdmin}, timeout: 15 * time.Second},
+		{method: "GET", path: "/admin/elevations/{id}", handler: app.GetElevation, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+		{method: "POST", path: "/admin/elevations/{id}/approve", handler: app.ApproveElevation, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+		{method: "POST", path: "/admin/elevations/{id}/deny", handler: app.DenyElevation, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+		{method: "POST", path: "/admin/elevations/{id}/revoke", handler: app.RevokeElevation, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+
+		{method: "GET", path: "/admin/keys", handler: app.ListKeys, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+		{method: "POST", path: "/admin/keys/{id}/revoke", handler: app.RevokeKey, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+
+		{method: "GET", path: "/jobs/{id}", handler: app.GetJob, scopes: []string{scopeAdmin}, timeout: 15 * time.Second},
+	}
+}
+
+// scopeMiddleware returns the middleware that checks a scope
+func (app *Config) scopeMiddleware(scope string) func(http.Handler) http.Handler {
+	switch scope {
+	case scopeAdmin:
+		return app.requireAdmin
+	}
+	panic(fmt.Sprintf("unknown scope %q", scope))
+}
+
+// routeMiddleware builds the middleware of a route: scopes and roles first so
+// that rejected requests do not use up the rate limit, then the rate limit and
+// the timeout
+func (app *Config) routeMiddleware(rt route) []func(http.Handler) http.Handler {
+	var mws []func(http.Handler) http.Handler
+
+	for _, scope := range rt.scopes {
+		mws = append(mws, app.scopeMiddleware(scope))
+	}
+	if len(rt.roles) > 0 {
+		mws = append(mws, app.requireRole(rt.roles...))
+	}
+	if rt.rate > 0 {
+		mws = append(mws, ratelimit.New(app.Redis, rt.method+" "+rt.path, rt.rate).Middleware)
+	}
+	d := rt.timeout
+	if d == 0 {
+		d = app.RequestTimeout
+	}
+	if d > 0 {
+		mws = append(mws, timeout.Middleware(d, http.HandlerFunc(app.timedOut)))
+	}
+
+	return mws
+}
+
+// timedOut answers the requests whose handler ran out of time
+func (app *Config) timedOut(w http.ResponseWriter, r *http.Request) {
+	app.errorJson(w, errors.New("request timed out"), http.StatusGatewayTimeout)
+}
+
 func (app *Config) routes() http.Handler {
 	mux := chi.NewRouter()
 
 	mux.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"https://*", "http://*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: true,
@@ -22,9 +184,15 @@ func (app *Config) routes() http.Handler {
 
 	mux.Use(middleware.Heartbeat("/ping"))
 
-	mux.Post("/authenticate", app.Authenticate)
+	mux.Use(loglevel.DebugRequests)
+
+	mux.Use(negotiate.Middleware)
+
+	mux.Use(countRequests)
 
-	mux.Post("/register", app.Register)
+	for _, rt := range app.routeTable() {
+		mux.With(app.routeMiddleware(rt)...).Method(rt.method, rt.path, rt.handler)
+	}
 
 	return mux
 }
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"authentication/data"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// recentSignIns is how many successful logins the security page lists
+const recentSignIns = 20
+
+// securityCenter is everything the security settings page of a user shows.
+// The service has no second factor, OAuth providers or API keys, the page
+// has nothing to show for them.
+type securityCenter struct {
+	UserID       int                  `json:"user_id"`
+	Email        string               `json:"email"`
+	Sessions     []data.Session       `json:"sessions"`
+	SignIns      []data.SignIn        `json:"sign_ins"`
+	FailedLogins []data.LoginFailures `json:"failed_logins"`
+	Lock         *data.AccountLock    `json:"lock,omitempty"`
+}
+
+// SecurityCenter returns the security page of the caller in one answer: the
+// sessions that can still refresh, the recent successful and failed logins
+// and the lock of the account, if any
+func (app *Config) SecurityCenter(w http.ResponseWriter, r *http.Request) {
+	c, _ := callerFromContext(r.Context())
+
+	sessions, err := app.Models.RefreshToken.Sessions(c.UserID)
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	signIns, err := app.Models.RefreshToken.SignIns(c.UserID, recentSignIns)
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	failures, err := app.Models.AccountLock.RecentFailures(c.UserID)
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	lock, err := app.Models.AccountLock.Get(c.UserID)
+	if err != nil && !errors.Is(err, data.ErrNotLocked) {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: fmt.Sprintf("%d active sessions", len(sessions)),
+		Data: securityCenter{
+			UserID:       c.UserID,
+			Email:        c.Email,
+			Sessions:     sessions,
+			SignIns:      signIns,
+			FailedLogins: failures,
+			Lock:         lock,
+		},
+	})
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"contracts/config"
+	"contracts/failover"
+	"encoding/json"
+	"log"
+)
+
+// failoverTopic is where the failovers of the service clients are published,
+// for admins holding a stream token for it
+const failoverTopic = "failover"
+
+// newEndpoint returns the endpoint of a dependency at <KEY>_URL, fallback by
+// default, failing over to <KEY>_SECONDARY_URL when set
+func (app *Config) newEndpoint(cfg *config.Config, service, key, fallback string) *failover.Endpoint {
+	e, err := failover.New(service,
+		cfg.URL(key+"_URL", fallback, "http", "https"),
+		cfg.URL(key+"_SECONDARY_URL", "", "http", "https"),
+	)
+	if err != nil {
+		// the URLs were checked by cfg, the fallback is used for invalid ones
+		log.Panic(err)
+	}
+
+	// FAILOVER_THRESHOLD failed calls in a row over FAILOVER_SUSTAIN fail over
+	e.Threshold = cfg.Int("FAILOVER_THRESHOLD", failover.DefaultThreshold)
+	e.Sustain = cfg.Duration("FAILOVER_SUSTAIN", failover.DefaultSustain, 0)
+	e.OnFailover = app.failedOver
+
+	return e
+}
+
+// failedOver reports a move of the calls to a dependency in the log, to the
+// logger service and on the failover topic
+func (app *Config) failedOver(e failover.Event) {
+	log.Printf("Calls to %s moved from %s to %s: %s", e.Service, e.From, e.To, e.Reason)
+
+	app.publishEvent(failoverTopic, "service.failover", e)
+
+	data, _ := json.Marshal(e)
+	if err := app.logRequest("service.failover", string(data)); err != nil {
+		log.Println("Error logging failover:", err)
+	}
+}
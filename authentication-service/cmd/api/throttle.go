@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// loginDelays is how long a login waits after the given number of recent
+// failures of its account or address, the last delay repeating
+var loginDelays = []time.Duration{0, 500 * time.Millisecond, 2 * time.Second, 8 * time.Second}
+
+// loginFailureWindow is how long a failed login counts
+const loginFailureWindow = 15 * time.Minute
+
+// loginThrottle is the state of a login attempt: the Redis keys counting the
+// failures of its account and address
+type loginThrottle struct {
+	rdb     *redis.Client
+	account string
+	address string
+
+	// ip is the address of the client
+	ip string
+}
+
+func (app *Config) loginThrottle(r *http.Request, email string) *loginThrottle {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	return &loginThrottle{
+		rdb:     app.Redis,
+		account: accountKey(email),
+		address: "login:failures:ip:" + ip,
+		ip:      ip,
+	}
+}
+
+// delay is how long the attempt has to wait, for the account or the address
+// with the most failures
+func (t *loginThrottle) delay(ctx context.Context) time.Duration {
+	if t.rdb == nil {
+		return 0
+	}
+
+	counts, err := t.rdb.MGet(ctx, t.account, t.address).Result()
+	if err != nil {
+		return 0
+	}
+
+	var failures int
+	for _, c := range counts {
+		if s, ok := c.(string); ok {
+			n, _ := strconv.Atoi(s)
+			failures = max(failures, n)
+		}
+	}
+
+	return loginDelays[min(failures, len(loginDelays)-1)]
+}
+
+// wait holds the attempt for delay without outliving the request. It reports
+// false, and when the client can try again, if the delay runs past the deadline
+// of the request.
+func (t *loginThrottle) wait(ctx context.Context) (bool, time.Duration) {
+	delay := t.delay(ctx)
+	if delay <= 0 {
+		return true, 0
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		return false, delay
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true, 0
+	case <-ctx.Done():
+		return false, delay
+	}
+}
+
+// failed counts a failed attempt against the account and the address
+func (t *loginThrottle) failed(ctx context.Context) {
+	if t.rdb == nil {
+		return
+	}
+
+	t.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range []string{t.account, t.address} {
+			pipe.Incr(ctx, key)
+			pipe.Expire(ctx, key, loginFailureWindow)
+		}
+		return nil
+	})
+}
+
+// accountKey is the key counting the recent failures of an account
+func accountKey(email string) string {
+	return "login:failures:account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// succeeded forgets the failures of the account. Those of the address stay,
+// one valid account does not clear an address guessing at others.
+func (t *loginThrottle) succeeded(ctx context.Context) {
+	if t.rdb == nil {
+		return
+	}
+
+	t.rdb.Del(ctx, t.account)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"authentication/data"
+	"contracts/token"
+	v1 "contracts/v1"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// ValidateToken checks an access token, sent in the body or as a bearer token,
+// and returns its claims. Services holding the token keys check tokens on
+// their own with token.Verifier instead.
+func (app *Config) ValidateToken(w http.ResponseWriter, r *http.Request) {
+	var requestPayload v1.TokenRequest
+
+	if r.ContentLength > 0 {
+		if err := app.readJson(w, r, &requestPayload); err != nil {
+			app.errorJson(w, err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	raw := requestPayload.Token
+	if raw == "" {
+		raw = token.FromRequest(r)
+	}
+	if raw == "" {
+		app.errorJson(w, errors.New("missing token"), http.StatusBadRequest)
+		return
+	}
+
+	claims, err := app.Verifier.Verify(raw)
+	if err != nil {
+		app.errorJson(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: "valid token",
+		Data:    claims,
+	})
+}
+
+// Refresh trades a refresh token for a new access token and the refresh token
+// that replaces it. A refresh token works once; using one again revokes the
+// session it belongs to.
+func (app *Config) Refresh(w http.ResponseWriter, r *http.Request) {
+	if !app.Tokens.Enabled() {
+		app.errorJson(w, errors.New("tokens are not issued by this service"), http.StatusNotFound)
+		return
+	}
+
+	var requestPayload v1.RefreshRequest
+
+	if err := app.readJson(w, r, &requestPayload); err != nil {
+		app.errorJson(w, err, http.StatusBadRequest)
+		return
+	}
+	if requestPayload.RefreshToken == "" {
+		app.errorJson(w, errors.New("missing refresh token"), http.StatusBadRequest)
+		return
+	}
+
+	// deactivated and locked accounts can not refresh, the token is kept for
+	// when a locked account is unlocked
+	var user *data.User
+	var lock *data.AccountLock
+	refresh, issued, err := app.Models.RefreshToken.Rotate(requestPayload.RefreshToken, app.RefreshTTL, func(userID int) error {
+		var err error
+		user, err = app.Models.User.GetOne(userID)
+		if errors.Is(err, sql.ErrNoRows) || errors.Is(err, data.ErrUserNotFound) {
+			return data.ErrTokenInvalid
+		}
+		if err != nil {
+			return err
+		}
+		if !user.Active {
+			return errAccountInactive
+		}
+
+		lock, err = app.Models.AccountLock.Get(userID)
+		if err == nil {
+			return errAccountLocked
+		}
+		if errors.Is(err, data.ErrNotLocked) {
+			return nil
+		}
+		return err
+	})
+	if errors.Is(err, errAccountLocked) {
+		app.lockedJson(w, lock)
+		return
+	}
+	if err != nil {
+		if errors.Is(err, data.ErrTokenReused) {
+			log.Println("Refresh token reused, revoked its session")
+		}
+		app.refreshError(w, err)
+		return
+	}
+
+	response := v1.AuthResponse{User: newUserV1(user)}
+	if err := app.accessToken(user, &response); err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+	response.RefreshToken, response.RefreshExpiresAt = refresh, &issued.ExpiresAt
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: fmt.Sprintf("Refreshed the tokens of %s", user.Email),
+		Data:    response,
+	})
+}
+
+// Logout revokes a refresh token and the ones rotated from the same login. With
+// "all" set every session of the user ends, e.g. after a lost device.
+// Access tokens already handed out stay valid until they expire.
+func (app *Config) Logout(w http.ResponseWriter, r *http.Request) {
+	var requestPayload v1.LogoutRequest
+
+	if err := app.readJson(w, r, &requestPayload); err != nil {
+		app.errorJson(w, err, http.StatusBadRequest)
+		return
+	}
+	if requestPayload.RefreshToken == "" {
+		app.errorJson(w, errors.New("missing refresh token"), http.StatusBadRequest)
+		return
+	}
+
+	userID, err := app.Models.RefreshToken.Revoke(requestPayload.RefreshToken)
+	if err != nil {
+		app.refreshError(w, err)
+		return
+	}
+
+	message := "Logged out"
+	if requestPayload.All {
+		revoked, err := app.Models.RefreshToken.RevokeAll(userID)
+		if err != nil {
+			app.errorJson(w, err, http.StatusInternalServerError)
+			return
+		}
+		message = fmt.Sprintf("Logged out of every session, %d other tokens revoked", revoked)
+	}
+
+	if err := app.logUserRequest("authentication", message, userID); err != nil {
+		log.Println("Error logging the logout:", err)
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: message,
+	})
+}
+
+// accessToken issues an access token for user into response
+func (app *Config) accessToken(user *data.User, response *v1.AuthResponse) error {
+	raw, claims, err := app.Tokens.Issue(token.Claims{Subject: strconv.Itoa(user.ID), Email: user.Email})
+	if err != nil {
+		return err
+	}
+
+	expires := claims.Expires()
+	response.Token, response.TokenType, response.ExpiresAt = raw, "Bearer", &expires
+
+	return nil
+}
+
+// refreshError answers the errors of a refresh token with 401 and the others
+// with 500
+func (app *Config) refreshError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, data.ErrTokenInvalid), errors.Is(err, data.ErrTokenExpired), errors.Is(err, data.ErrTokenReused):
+		app.errorJson(w, err, http.StatusUnauthorized)
+	case errors.Is(err, errAccountInactive):
+		app.errorJson(w, err, http.StatusForbidden)
+	default:
+		app.errorJson(w, err, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"authentication/data"
+	"bytes"
+	v1 "contracts/v1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	netmail "net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// defaultUsersPerPage is the page size of ListUsers when per_page is not set
+const defaultUsersPerPage = 50
+
+// ListUsers returns a page of users. ?q= searches the email and name for every
+// word given, ?active= filters by status, ?sort= orders by a field with a
+// leading - for descending, ?page= and ?per_page= choose the page.
+func (app *Config) ListUsers(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	query := data.UserQuery{
+		Search:  params.Get("q"),
+		Sort:    params.Get("sort"),
+		Page:    1,
+		PerPage: defaultUsersPerPage,
+	}
+
+	if v := params.Get("active"); v != "" {
+		active, err := strconv.ParseBool(v)
+		if err != nil {
+			app.errorJson(w, errors.New("active must be true or false"))
+			return
+		}
+		query.Active = &active
+	}
+
+	for name, target := range map[string]*int{"page": &query.Page, "per_page": &query.PerPage} {
+		if v := params.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				app.errorJson(w, fmt.Errorf("%s must be a number", name))
+				return
+			}
+			*target = n
+		}
+	}
+
+	if err := query.Validate(); err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	users, total, err := app.Models.User.Search(query)
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	page := v1.UserPage{
+		Users:   make([]v1.User, 0, len(users)),
+		Page:    query.Page,
+		PerPage: query.PerPage,
+		Total:   total,
+	}
+	for _, user := range users {
+		page.Users = append(page.Users, newUserV1(user))
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: fmt.Sprintf("%d of %d users", len(page.Users), total),
+		Data:    page,
+	})
+}
+
+// GetUser returns one user with their roles
+func (app *Config) GetUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJson(w, errors.New("invalid user id"))
+		return
+	}
+
+	user, err := app.Models.User.GetOne(userID)
+	if err != nil {
+		app.userError(w, err)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: user.Email,
+		Data:    newUserV1(user),
+	})
+}
+
+// UpdateUser changes the fields of a user that are in the body and leaves the
+// others as they are. Passwords are changed with the reset flow, roles with
+// the role endpoints.
+func (app *Config) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJson(w, errors.New("invalid user id"))
+		return
+	}
+
+	var requestPayload v1.UserPatch
+
+	if err := app.readJson(w, r, &requestPayload); err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	user, err := app.Models.User.GetOne(userID)
+	if err != nil {
+		app.userError(w, err)
+		return
+	}
+
+	var changed []string
+
+	if requestPayload.Email != nil {
+		email := strings.TrimSpace(*requestPayload.Email)
+		if _, err := netmail.ParseAddress(email); err != nil || strings.ContainsAny(email, "<> ") {
+			app.errorJson(w, fmt.Errorf("invalid email %q", email))
+			return
+		}
+		user.Email = email
+		changed = append(changed, "email")
+	}
+	if requestPayload.FirstName != nil {
+		user.FirstName = *requestPayload.FirstName
+		changed = append(changed, "first_name")
+	}
+	if requestPayload.LastName != nil {
+		user.LastName = *requestPayload.LastName
+		changed = append(changed, "last_name")
+	}
+	deactivated := false
+	if requestPayload.Active != nil {
+		deactivated = user.Active && !*requestPayload.Active
+		user.Active = *requestPayload.Active
+		changed = append(changed, "active")
+	}
+
+	if len(changed) == 0 {
+		app.errorJson(w, errors.New("nothing to change, send email, first_name, last_name or active"))
+		return
+	}
+
+	if err := app.Models.User.Update(user); err != nil {
+		app.userError(w, err)
+		return
+	}
+
+	// a deactivated account must not refresh the sessions it holds
+	if deactivated {
+		if _, err := app.Models.RefreshToken.RevokeAll(userID); err != nil {
+			app.errorJson(w, fmt.Errorf("user %d deactivated, revoking their tokens: %w", userID, err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := app.logUserRequest("user.updated", fmt.Sprintf("user %d %s", userID, strings.Join(changed, ", ")), userID); err != nil {
+		log.Printf("Error emitting user.updated for user %d: %v", userID, err)
+	}
+
+	user, err = app.Models.User.GetOne(userID)
+	if err != nil {
+		app.userError(w, err)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: "user updated",
+		Data:    newUserV1(user),
+	})
+}
+
+// DeleteUser deletes a user with their roles, sessions and tokens, then asks
+// the logger service to forget their entries. The user is gone by then, so a
+// logger that did not take the request is reported for a retry instead.
+func (app *Config) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJson(w, errors.New("invalid user id"))
+		return
+	}
+
+	user, err := app.Models.User.GetOne(userID)
+	if err != nil {
+		app.userError(w, err)
+		return
+	}
+
+	if err := app.Models.User.DeleteByID(user.ID); err != nil {
+		app.userError(w, err)
+		return
+	}
+
+	// the entry is not linked to the user, it would outlive the forget
+	if err := app.logRequest("user.deleted", fmt.Sprintf("a user was deleted by %s", adminIdentity(r))); err != nil {
+		log.Printf("Error emitting user.deleted: %v", err)
+	}
+
+	if err := app.forgetUserLogs(userID, adminIdentity(r)); err != nil {
+		log.Printf("Error forgetting the logs of user %d: %v", userID, err)
+		app.writeJson(w, http.StatusOK, jsonReponse{
+			Error:   false,
+			Message: fmt.Sprintf("user %d deleted, the logger did not forget their entries", userID),
+			Data:    map[string]any{"downstream": map[string]string{"logger": err.Error()}},
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// forgetUserLogs asks the logger service to drop the link between a deleted
+// user and their entries, with the logger's admin key
+func (app *Config) forgetUserLogs(userID int, actor string) error {
+	if app.LoggerKey == "" {
+		return errors.New("LOGGER_ADMIN_KEY is not set")
+	}
+
+	jsonData, _ := json.Marshal(map[string]string{"mode": "anonymize", "actor": actor})
+
+	request, err := http.NewRequest("POST", fmt.Sprintf("/admin/users/%d/forget", userID), bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Admin-Key", app.LoggerKey)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	response, err := app.Logger.Do(client, request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("logger service answered %d", response.StatusCode)
+	}
+
+	return nil
+}
+
+func (app *Config) userError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, data.ErrUserNotFound):
+		app.errorJson(w, err, http.StatusNotFound)
+	case errors.Is(err, data.ErrEmailTaken):
+		app.errorJson(w, err, http.StatusConflict)
+	default:
+		app.errorJson(w, err, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"contracts/lifecycle"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// set at build time with
+//
+//	-ldflags "-X main.version=... -X main.commit=... -X main.buildTime=..."
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildTime = "unknown"
+)
+
+func init() {
+	// plain go builds inside the repository still know their commit
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+
+	for _, setting := range info.Settings {
+		switch {
+		case setting.Key == "vcs.revision" && commit == "unknown":
+			commit = setting.Value
+		case setting.Key == "vcs.time" && buildTime == "unknown":
+			buildTime = setting.Value
+		}
+	}
+}
+
+type buildInfo struct {
+	Service   string             `json:"service"`
+	Version   string             `json:"version"`
+	Commit    string             `json:"commit"`
+	BuildTime string             `json:"build_time"`
+	GoVersion string             `json:"go_version"`
+	Features  map[string]bool    `json:"features"`
+	Pod       *lifecycle.PodInfo `json:"pod,omitempty"`
+}
+
+// features reports which optional features this instance runs with
+func (app *Config) features() map[string]bool {
+	return map[string]bool{
+		"events": app.Redis != nil,
+	}
+}
+
+// Version reports the build and the enabled features of the service
+func (app *Config) Version(w http.ResponseWriter, r *http.Request) {
+	app.writeJson(w, http.StatusOK, buildInfo{
+		Service:   "authentication",
+		Version:   version,
+		Commit:    commit,
+		BuildTime: buildTime,
+		GoVersion: runtime.Version(),
+		Features:  app.features(),
+		Pod:       app.Lifecycle.Pod,
+	})
+}
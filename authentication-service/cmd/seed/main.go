@@ -0,0 +1,134 @@
+// Command seed loads fixture users and roles into the users database for local
+// development and demos, admin@domain holding the admin role. Running it twice
+// does not create duplicates. The log entries are seeded by the seed command
+// of logger-service, see make seed.
+package main
+
+import (
+	"authentication/data"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	_ "github.com/lib/pq"
+)
+
+var firstNames = []string{"Admin", "Anh", "Binh", "Chi", "Dung", "Giang", "Hoa", "Khanh", "Linh", "Minh", "Nam", "Phuong", "Quang", "Thao", "Tuan", "Vy"}
+
+var lastNames = []string{"User", "Nguyen", "Tran", "Le", "Pham", "Hoang", "Vu", "Dang", "Bui", "Do"}
+
+// fixtureRoles are created next to the built-in admin and user roles
+var fixtureRoles = []data.Role{
+	{Name: "support", Description: "Answers tickets, reads accounts", Permissions: []string{"users:read"}},
+	{Name: "auditor", Description: "Reviews accounts and their logs", Permissions: []string{"users:read", "logs:read"}},
+}
+
+// fixtureHolders gives roles to fixture users, by their index
+var fixtureHolders = map[int]string{
+	0: data.RoleAdmin,
+	1: "support",
+	2: "auditor",
+}
+
+func main() {
+	dsn := flag.String("dsn", os.Getenv("DSN"), "Postgres DSN")
+	count := flag.Int("users", 25, "number of fixture users")
+	password := flag.String("password", "verysecret", "password for every fixture user")
+	domain := flag.String("domain", "example.com", "email domain of the fixture users")
+	flag.Parse()
+
+	db, err := sql.Open("postgres", *dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Ping(); err != nil {
+		log.Fatal(err)
+	}
+
+	pg := data.NewPostgres(db)
+	models := data.New(pg)
+
+	if err := pg.EnsureSchema(); err != nil {
+		log.Fatal(err)
+	}
+
+	created, skipped := 0, 0
+
+	for _, role := range fixtureRoles {
+		_, err := models.Role.Insert(role)
+		if errors.Is(err, data.ErrRoleExists) {
+			skipped++
+			continue
+		}
+		if err != nil {
+			log.Fatalf("Error inserting role %s: %v", role.Name, err)
+		}
+		created++
+	}
+
+	log.Printf("Seeded roles: %d created, %d already present", created, skipped)
+
+	created, skipped = 0, 0
+	ids := make([]int, 0, *count)
+
+	for i := 0; i < *count; i++ {
+		user := fixtureUser(i, *domain)
+
+		if existing, err := models.User.GetByEmail(user.Email); err == nil {
+			ids = append(ids, existing.ID)
+			skipped++
+			continue
+		}
+
+		user.Password = *password
+
+		id, err := models.User.Insert(user)
+		if err != nil {
+			log.Fatalf("Error inserting %s: %v", user.Email, err)
+		}
+		ids = append(ids, id)
+		created++
+	}
+
+	log.Printf("Seeded users: %d created, %d already present", created, skipped)
+
+	// assigning a role that is held already only keeps it
+	for i, role := range fixtureHolders {
+		if i >= len(ids) {
+			continue
+		}
+		if err := models.User.AssignRole(ids[i], role); err != nil {
+			log.Fatalf("Error assigning %s to user %d: %v", role, ids[i], err)
+		}
+	}
+}
+
+// fixtureUser builds the i-th fixture user. The first one is always admin@domain
+// and every user gets the same email on every run, which keeps seeding idempotent.
+func fixtureUser(i int, domain string) data.User {
+	if i == 0 {
+		return data.User{
+			Email:     "admin@" + domain,
+			FirstName: "Admin",
+			LastName:  "User",
+			Active:    true,
+		}
+	}
+
+	first := firstNames[i%len(firstNames)]
+	last := lastNames[(i/len(firstNames)+i)%len(lastNames)]
+
+	return data.User{
+		Email:     fmt.Sprintf("%s.%s%d@%s", strings.ToLower(first), strings.ToLower(last), i, domain),
+		FirstName: first,
+		LastName:  last,
+		// every fifth fixture user is inactive so both states can be tried out
+		Active: i%5 != 0,
+	}
+}
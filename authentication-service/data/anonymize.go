@@ -0,0 +1,241 @@
+package data
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// anonymizeFirstNames and anonymizeLastNames are the names anonymized users
+// get, picked by a keyed hash of their email
+var (
+	anonymizeFirstNames = []string{"Alex", "Anh", "Bao", "Chi", "Dana", "Duc", "Hai", "Hana", "Khoa", "Lan", "Long", "Mai", "Ngoc", "Quynh", "Sam", "Trang", "Tung", "Yen"}
+	anonymizeLastNames  = []string{"Bui", "Cao", "Dang", "Do", "Ha", "Hoang", "Le", "Ly", "Mai", "Ngo", "Nguyen", "Pham", "Phan", "Tran", "Truong", "Vo", "Vu"}
+)
+
+// schemaPattern is what target schemas may be called, they are put in SQL as is
+var schemaPattern = regexp.MustCompile(`^[a-z_][a-z0-9_]{0,62}$`)
+
+// Anonymizer replaces the personal data of users with stand-ins derived from
+// Key, so a user gets the same stand-ins on every refresh while the originals
+// can not be recovered without Key. Every user gets Password, already hashed.
+type Anonymizer struct {
+	Key      []byte
+	Domain   string
+	Password string
+}
+
+// AnonymizeReport is the rows copied by table
+type AnonymizeReport struct {
+	Schema string         `json:"schema"`
+	Tables map[string]int `json:"tables"`
+}
+
+// NewAnonymizer returns an Anonymizer giving the users emails at domain and
+// password
+func NewAnonymizer(key, domain, password string) (*Anonymizer, error) {
+	if len(key) < 16 {
+		return nil, errors.New("the anonymization key must be at least 16 characters")
+	}
+	if domain == "" || strings.ContainsAny(domain, "@ ") {
+		return nil, fmt.Errorf("invalid email domain %q", domain)
+	}
+
+	hashed, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Anonymizer{Key: []byte(key), Domain: domain, Password: string(hashed)}, nil
+}
+
+// sum is the keyed hash of a value of a kind, kinds keep the stand-ins of
+// different columns apart
+func (a *Anonymizer) sum(kind, value string) []byte {
+	h := hmac.New(sha256.New, a.Key)
+	h.Write([]byte(kind + "\x00" + value))
+	return h.Sum(nil)
+}
+
+// Names returns the stand-in first and last name of the user with email
+func (a *Anonymizer) Names(email string) (string, string) {
+	sum := a.sum("name", strings.ToLower(email))
+	first := anonymizeFirstNames[binary.BigEndian.Uint32(sum[0:4])%uint32(len(anonymizeFirstNames))]
+	last := anonymizeLastNames[binary.BigEndian.Uint32(sum[4:8])%uint32(len(anonymizeLastNames))]
+	return first, last
+}
+
+// Email returns the stand-in email of email, it carries the stand-in names and
+// 64 bits of the keyed hash, which keeps the emails unique
+func (a *Anonymizer) Email(email string) string {
+	first, last := a.Names(email)
+	sum := a.sum("email", strings.ToLower(email))
+	return fmt.Sprintf("%s.%s.%s@%s", strings.ToLower(first), strings.ToLower(last), hex.EncodeToString(sum[:8]), a.Domain)
+}
+
+// Token returns the stand-in of a token hash or family. Stand-ins have the
+// length of sha256 hex hashes and match no token that was handed out.
+func (a *Anonymizer) Token(kind, value string) string {
+	return hex.EncodeToString(a.sum("token:"+kind, value))
+}
+
+// Copy replaces the users of schema into of target with the users of source,
+// anonymized, with their roles, refresh tokens and password reset tokens;
+// the roles are copied as they are. The tables of into are created when
+// missing and emptied otherwise, together with everything referencing users,
+// like the mails of the previous copy. source is read in one snapshot and
+// into changes in one transaction, a failed copy leaves it as it was.
+// target may be the database of source, into can not be public.
+func (a *Anonymizer) Copy(ctx context.Context, source, target *sql.DB, into string) (*AnonymizeReport, error) {
+	if !schemaPattern.MatchString(into) || into == "public" {
+		return nil, fmt.Errorf("invalid target schema %q", into)
+	}
+
+	src, err := source.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer src.Rollback()
+
+	dst, err := target.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer dst.Rollback()
+
+	// the tables of the service, in the target schema
+	if _, err := dst.ExecContext(ctx, "CREATE SCHEMA IF NOT EXISTS "+into); err != nil {
+		return nil, err
+	}
+	if _, err := dst.ExecContext(ctx, strings.ReplaceAll(schema, "public.", into+".")); err != nil {
+		return nil, fmt.Errorf("creating the tables of %s: %w", into, err)
+	}
+	if _, err := dst.ExecContext(ctx, fmt.Sprintf("TRUNCATE %[1]s.users, %[1]s.roles RESTART IDENTITY CASCADE", into)); err != nil {
+		return nil, err
+	}
+
+	report := &AnonymizeReport{Schema: into, Tables: make(map[string]int)}
+
+	for _, table := range []struct {
+		name    string
+		columns []string
+		copy    func(rows *sql.Rows) ([]any, error)
+	}{
+		{"roles", []string{"name", "description", "permissions", "created_at", "updated_at"}, func(rows *sql.Rows) ([]any, error) {
+			var name, description string
+			var permissions pq.StringArray
+			var createdAt, updatedAt time.Time
+			err := rows.Scan(&name, &description, &permissions, &createdAt, &updatedAt)
+			return []any{name, description, permissions, createdAt, updatedAt}, err
+		}},
+		{"users", []string{"id", "email", "first_name", "last_name", "password", "user_active", "created_at", "updated_at"}, func(rows *sql.Rows) ([]any, error) {
+			var id int
+			var email, firstName, lastName, password string
+			var active bool
+			var createdAt, updatedAt time.Time
+			if err := rows.Scan(&id, &email, &firstName, &lastName, &password, &active, &createdAt, &updatedAt); err != nil {
+				return nil, err
+			}
+			firstName, lastName = a.Names(email)
+			return []any{id, a.Email(email), firstName, lastName, a.Password, active, createdAt, updatedAt}, nil
+		}},
+		{"user_roles", []string{"user_id", "role", "created_at", "expires_at"}, func(rows *sql.Rows) ([]any, error) {
+			var userID int
+			var role string
+			var createdAt time.Time
+			var expiresAt sql.NullTime
+			err := rows.Scan(&userID, &role, &createdAt, &expiresAt)
+			return []any{userID, role, createdAt, expiresAt}, err
+		}},
+		{"tokens", []string{"id", "user_id", "token_hash", "family", "created_at", "expires_at", "used_at", "revoked_at"}, func(rows *sql.Rows) ([]any, error) {
+			var id, userID int
+			var tokenHash, family string
+			var createdAt, expiresAt time.Time
+			var usedAt, revokedAt sql.NullTime
+			if err := rows.Scan(&id, &userID, &tokenHash, &family, &createdAt, &expiresAt, &usedAt, &revokedAt); err != nil {
+				return nil, err
+			}
+			return []any{id, userID, a.Token("hash", tokenHash), a.Token("family", family), createdAt, expiresAt, usedAt, revokedAt}, nil
+		}},
+		{"password_resets", []string{"id", "user_id", "token_hash", "created_at", "expires_at", "used_at"}, func(rows *sql.Rows) ([]any, error) {
+			var id, userID int
+			var tokenHash string
+			var createdAt, expiresAt time.Time
+			var usedAt sql.NullTime
+			if err := rows.Scan(&id, &userID, &tokenHash, &createdAt, &expiresAt, &usedAt); err != nil {
+				return nil, err
+			}
+			return []any{id, userID, a.Token("reset", tokenHash), createdAt, expiresAt, usedAt}, nil
+		}},
+	} {
+		n, err := copyTable(ctx, src, dst, into, table.name, table.columns, table.copy)
+		if err != nil {
+			return nil, fmt.Errorf("copying %s: %w", table.name, err)
+		}
+		report.Tables[table.name] = n
+	}
+
+	// copied rows keep their ids, new rows of staging must not reuse them
+	for _, table := range []string{"users", "tokens", "password_resets"} {
+		_, err := dst.ExecContext(ctx, fmt.Sprintf(
+			"SELECT setval(pg_get_serial_sequence('%[1]s.%[2]s', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM %[1]s.%[2]s",
+			into, table))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := dst.Commit(); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// copyTable streams the rows of a public table of src into the table of the
+// same name in schema of dst, through convert
+func copyTable(ctx context.Context, src, dst *sql.Tx, schema, table string, columns []string, convert func(*sql.Rows) ([]any, error)) (int, error) {
+	rows, err := src.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM public.%s", strings.Join(columns, ", "), table))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	stmt, err := dst.PrepareContext(ctx, pq.CopyInSchema(schema, table, columns...))
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	n := 0
+	for rows.Next() {
+		values, err := convert(rows)
+		if err != nil {
+			return n, err
+		}
+		if _, err := stmt.ExecContext(ctx, values...); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+
+	// the empty exec flushes the copy
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return n, err
+	}
+
+	return n, nil
+}
@@ -0,0 +1,128 @@
+package data
+
+import (
+	"authentication/data/sqldb"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// bulk operations on users
+const (
+	BulkActivate   = "activate"
+	BulkDeactivate = "deactivate"
+	BulkDelete     = "delete"
+	BulkAssignRole = "assign_role"
+)
+
+// MaxBulkUsers is the largest number of users one bulk operation may touch
+const MaxBulkUsers = 1000
+
+// BulkResult is the outcome of a bulk operation for one user
+type BulkResult struct {
+	ID     int    `json:"id"`
+	Status string `json:"status"`
+}
+
+// bulk result statuses
+const (
+	BulkOK       = "ok"
+	BulkNotFound = "not_found"
+)
+
+// CheckBulk validates a bulk operation before it is run
+func CheckBulk(operation string, ids []int, role string) error {
+	switch operation {
+	case BulkActivate, BulkDeactivate, BulkDelete:
+	case BulkAssignRole:
+		if role == "" {
+			return errors.New("role is required to assign a role")
+		}
+	default:
+		return fmt.Errorf("unknown bulk operation %q", operation)
+	}
+
+	if len(ids) > MaxBulkUsers {
+		return fmt.Errorf("at most %d users per bulk operation", MaxBulkUsers)
+	}
+
+	return nil
+}
+
+// Bulk applies one operation to a list of users in a single transaction. Users
+// that do not exist are reported as not_found and skipped; any other error
+// rolls the whole operation back. Deactivated users lose their refresh tokens
+// in the same transaction, deleted ones lose them with the account. progress
+// may be nil.
+func (a *PostgresUserAdmin) Bulk(operation string, ids []int, role string, progress ProgressFunc) ([]BulkResult, error) {
+	if err := CheckBulk(operation, ids, role); err != nil {
+		return nil, err
+	}
+
+	var results []BulkResult
+
+	err := a.pg.runQuery("BulkUsers", []any{operation, len(ids), role}, func(ctx context.Context, q *sqldb.Queries) error {
+		tx, err := a.pg.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		qtx := q.WithTx(tx)
+		now := time.Now()
+
+		results = make([]BulkResult, 0, len(ids))
+
+		for i, id := range ids {
+			if progress != nil {
+				progress(100*i/len(ids), "")
+			}
+
+			_, err := qtx.GetUserByID(ctx, int32(id))
+			if errors.Is(err, sql.ErrNoRows) {
+				results = append(results, BulkResult{ID: id, Status: BulkNotFound})
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			switch operation {
+			case BulkActivate, BulkDeactivate:
+				err = qtx.SetUserActive(ctx, sqldb.SetUserActiveParams{
+					UserActive: operation == BulkActivate,
+					UpdatedAt:  now,
+					ID:         int32(id),
+				})
+				if err == nil && operation == BulkDeactivate {
+					_, err = qtx.RevokeUserTokens(ctx, sqldb.RevokeUserTokensParams{
+						RevokedAt: sql.NullTime{Time: now, Valid: true},
+						UserID:    int32(id),
+					})
+				}
+			case BulkDelete:
+				err = qtx.DeleteUser(ctx, int32(id))
+			case BulkAssignRole:
+				err = qtx.AssignUserRole(ctx, sqldb.AssignUserRoleParams{
+					UserID:    int32(id),
+					Role:      role,
+					CreatedAt: now,
+				})
+			}
+			if err != nil {
+				return fmt.Errorf("user %d: %w", id, err)
+			}
+
+			results = append(results, BulkResult{ID: id, Status: BulkOK})
+		}
+
+		return tx.Commit()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
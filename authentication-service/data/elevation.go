@@ -0,0 +1,318 @@
+package data
+
+import (
+	"authentication/data/sqldb"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// elevation statuses
+const (
+	ElevationPending  = "pending"
+	ElevationApproved = "approved"
+	ElevationDenied   = "denied"
+	ElevationRevoked  = "revoked"
+	ElevationExpired  = "expired"
+)
+
+// MaxElevation is the longest time an elevated role can be held
+const MaxElevation = 8 * time.Hour
+
+var (
+	// ErrElevationNotFound is returned for unknown elevation ids
+	ErrElevationNotFound = errors.New("elevation not found")
+	// ErrElevationState is returned when an elevation is not in the status
+	// the operation needs, e.g. approving one that was already denied
+	ErrElevationState = errors.New("elevation is not in a state that allows this")
+	// ErrSelfApproval is returned when the requester tries to approve their own elevation
+	ErrSelfApproval = errors.New("an elevation must be decided by someone else than its requester")
+)
+
+// Elevation is a request for a role held for a limited time. Once approved the
+// role is granted until ExpiresAt, when the revocation job takes it back.
+type Elevation struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"user_id"`
+	Role        string     `json:"role"`
+	Reason      string     `json:"reason"`
+	Duration    int        `json:"duration_seconds"`
+	Status      string     `json:"status"`
+	RequestedBy string     `json:"requested_by"`
+	DecidedBy   string     `json:"decided_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	DecidedAt   *time.Time `json:"decided_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// ExpiredRole is a time-boxed role the revocation job took back
+type ExpiredRole struct {
+	UserID int    `json:"user_id"`
+	Role   string `json:"role"`
+}
+
+// RequestElevation records a pending request for role, held for duration once approved
+func (a *PostgresUserAdmin) RequestElevation(userID int, role, reason string, duration time.Duration, requestedBy string) (*Elevation, error) {
+	switch {
+	case role == "":
+		return nil, errors.New("role is required")
+	case reason == "":
+		return nil, errors.New("a reason is required")
+	case requestedBy == "":
+		return nil, errors.New("requested_by is required")
+	case duration < time.Minute || duration > MaxElevation:
+		return nil, fmt.Errorf("duration must be between 1m and %s", MaxElevation)
+	}
+
+	var id int32
+
+	err := a.pg.runQuery("InsertRoleElevation", []any{userID, role, reason, duration, requestedBy}, func(ctx context.Context, q *sqldb.Queries) error {
+		if _, err := q.GetUserByID(ctx, int32(userID)); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("%w: %d", ErrUserNotFound, userID)
+			}
+			return err
+		}
+
+		var err error
+		id, err = q.InsertRoleElevation(ctx, sqldb.InsertRoleElevationParams{
+			UserID:          int32(userID),
+			Role:            role,
+			Reason:          reason,
+			DurationSeconds: int32(duration / time.Second),
+			Status:          ElevationPending,
+			RequestedBy:     requestedBy,
+			CreatedAt:       time.Now(),
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return a.GetElevation(int(id))
+}
+
+// GetElevation returns one elevation
+func (a *PostgresUserAdmin) GetElevation(id int) (*Elevation, error) {
+	var row sqldb.RoleElevation
+
+	err := a.pg.runQuery("GetRoleElevation", []any{id}, func(ctx context.Context, q *sqldb.Queries) error {
+		var err error
+		row, err = q.GetRoleElevation(ctx, int32(id))
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrElevationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return elevationFromRow(row), nil
+}
+
+// Elevations returns the latest elevations, of one status when status is set
+func (a *PostgresUserAdmin) Elevations(status string, limit int) ([]*Elevation, error) {
+	var rows []sqldb.RoleElevation
+
+	err := a.pg.runQuery("ListRoleElevations", []any{status, limit}, func(ctx context.Context, q *sqldb.Queries) error {
+		var err error
+		rows, err = q.ListRoleElevations(ctx, sqldb.ListRoleElevationsParams{Status: status, MaxRows: int32(limit)})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	elevations := make([]*Elevation, 0, len(rows))
+	for _, row := range rows {
+		elevations = append(elevations, elevationFromRow(row))
+	}
+
+	return elevations, nil
+}
+
+// ApproveElevation grants the role of a pending elevation until its duration
+// has passed. A standing assignment of the same role is left as it is.
+func (a *PostgresUserAdmin) ApproveElevation(id int, approver string) (*Elevation, error) {
+	return a.decideElevation(id, approver, true)
+}
+
+// DenyElevation closes a pending elevation without granting anything
+func (a *PostgresUserAdmin) DenyElevation(id int, approver string) (*Elevation, error) {
+	return a.decideElevation(id, approver, false)
+}
+
+func (a *PostgresUserAdmin) decideElevation(id int, approver string, approve bool) (*Elevation, error) {
+	if approver == "" {
+		return nil, errors.New("approver is required")
+	}
+
+	err := a.pg.runQuery("DecideRoleElevation", []any{id, approver, approve}, func(ctx context.Context, q *sqldb.Queries) error {
+		tx, err := a.pg.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		qtx := q.WithTx(tx)
+
+		row, err := qtx.GetRoleElevation(ctx, int32(id))
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrElevationNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if row.RequestedBy == approver {
+			return ErrSelfApproval
+		}
+
+		now := time.Now()
+		decision := sqldb.DecideRoleElevationParams{
+			Status:    ElevationDenied,
+			DecidedBy: approver,
+			DecidedAt: sql.NullTime{Time: now, Valid: true},
+			ID:        row.ID,
+		}
+		if approve {
+			decision.Status = ElevationApproved
+			decision.ExpiresAt = sql.NullTime{Time: now.Add(time.Duration(row.DurationSeconds) * time.Second), Valid: true}
+		}
+
+		n, err := qtx.DecideRoleElevation(ctx, decision)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrElevationState
+		}
+
+		if approve {
+			err = qtx.GrantUserRoleUntil(ctx, sqldb.GrantUserRoleUntilParams{
+				UserID:    row.UserID,
+				Role:      row.Role,
+				CreatedAt: now,
+				ExpiresAt: decision.ExpiresAt,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Commit()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return a.GetElevation(id)
+}
+
+// RevokeElevation takes an approved role back before it expires
+func (a *PostgresUserAdmin) RevokeElevation(id int) (*Elevation, error) {
+	err := a.pg.runQuery("RevokeRoleElevation", []any{id}, func(ctx context.Context, q *sqldb.Queries) error {
+		tx, err := a.pg.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		qtx := q.WithTx(tx)
+
+		row, err := qtx.GetRoleElevation(ctx, int32(id))
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrElevationNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		n, err := qtx.SetRoleElevationStatus(ctx, sqldb.SetRoleElevationStatusParams{
+			Status:     ElevationRevoked,
+			ID:         row.ID,
+			FromStatus: ElevationApproved,
+		})
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrElevationState
+		}
+
+		err = qtx.RevokeTimedUserRole(ctx, sqldb.RevokeTimedUserRoleParams{UserID: row.UserID, Role: row.Role})
+		if err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return a.GetElevation(id)
+}
+
+// RevokeExpiredRoles removes the time-boxed roles whose time is up and closes
+// their elevations
+func (a *PostgresUserAdmin) RevokeExpiredRoles() ([]ExpiredRole, error) {
+	var expired []ExpiredRole
+
+	err := a.pg.runQuery("RevokeExpiredRoles", nil, func(ctx context.Context, q *sqldb.Queries) error {
+		tx, err := a.pg.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		qtx := q.WithTx(tx)
+		now := sql.NullTime{Time: time.Now(), Valid: true}
+
+		rows, err := qtx.DeleteExpiredUserRoles(ctx, now)
+		if err != nil {
+			return err
+		}
+
+		err = qtx.ExpireRoleElevations(ctx, now)
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			expired = append(expired, ExpiredRole{UserID: int(row.UserID), Role: row.Role})
+		}
+
+		return tx.Commit()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return expired, nil
+}
+
+func elevationFromRow(row sqldb.RoleElevation) *Elevation {
+	e := &Elevation{
+		ID:          int(row.ID),
+		UserID:      int(row.UserID),
+		Role:        row.Role,
+		Reason:      row.Reason,
+		Duration:    int(row.DurationSeconds),
+		Status:      row.Status,
+		RequestedBy: row.RequestedBy,
+		DecidedBy:   row.DecidedBy,
+		CreatedAt:   row.CreatedAt,
+	}
+	if row.DecidedAt.Valid {
+		e.DecidedAt = &row.DecidedAt.Time
+	}
+	if row.ExpiresAt.Valid {
+		e.ExpiresAt = &row.ExpiresAt.Time
+	}
+
+	return e
+}
@@ -0,0 +1,110 @@
+package data
+
+import (
+	"errors"
+	"runtime"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrHasherBusy is returned when the hashing queue is full. Handlers turn it
+// into a 503 with a Retry-After header.
+var ErrHasherBusy = errors.New("password hashing is saturated, retry later")
+
+// hashQueueWait is how long a request waits for a free slot in the queue
+const hashQueueWait = 100 * time.Millisecond
+
+// hasher runs bcrypt on a bounded set of workers so bursts of registrations or
+// logins can not starve the rest of the service
+type hasher struct {
+	cost int
+	jobs chan func()
+}
+
+var passwordHasher = newHasher(runtime.NumCPU(), 64, 12)
+
+func newHasher(workers, queue, cost int) *hasher {
+	h := &hasher{
+		cost: cost,
+		jobs: make(chan func(), queue),
+	}
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range h.jobs {
+				job()
+			}
+		}()
+	}
+
+	return h
+}
+
+// ConfigureHasher replaces the password hashing pool. Zero values keep the
+// defaults of one worker per CPU, a queue of 64 and bcrypt cost 12.
+func ConfigureHasher(workers, queue, cost int) {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if queue <= 0 {
+		queue = 64
+	}
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		cost = 12
+	}
+
+	old := passwordHasher
+	passwordHasher = newHasher(workers, queue, cost)
+	close(old.jobs)
+}
+
+// submit queues fn on the pool and waits for it to finish
+func (h *hasher) submit(fn func()) error {
+	done := make(chan struct{})
+	job := func() {
+		fn()
+		close(done)
+	}
+
+	timer := time.NewTimer(hashQueueWait)
+	defer timer.Stop()
+
+	select {
+	case h.jobs <- job:
+	case <-timer.C:
+		return ErrHasherBusy
+	}
+
+	<-done
+	return nil
+}
+
+// hashPassword bcrypts a plain text password on the pool
+func hashPassword(password string) ([]byte, error) {
+	h := passwordHasher
+
+	var hashed []byte
+	var err error
+
+	if qerr := h.submit(func() {
+		hashed, err = bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	}); qerr != nil {
+		return nil, qerr
+	}
+
+	return hashed, err
+}
+
+// comparePassword checks a plain text password against a bcrypt hash on the pool
+func comparePassword(hashed, plainText string) error {
+	var err error
+
+	if qerr := passwordHasher.submit(func() {
+		err = bcrypt.CompareHashAndPassword([]byte(hashed), []byte(plainText))
+	}); qerr != nil {
+		return qerr
+	}
+
+	return err
+}
@@ -0,0 +1,80 @@
+package data
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHasherBusy(t *testing.T) {
+	h := newHasher(1, 1, bcrypt.MinCost)
+	defer close(h.jobs)
+
+	// one job keeps the worker busy, another fills the queue
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go h.submit(func() {
+		close(started)
+		<-release
+	})
+	<-started
+	h.jobs <- func() {}
+
+	err := h.submit(func() {})
+	close(release)
+
+	if !errors.Is(err, ErrHasherBusy) {
+		t.Fatalf("submit on a full queue: got %v, want ErrHasherBusy", err)
+	}
+}
+
+func TestPasswordRoundTrip(t *testing.T) {
+	ConfigureHasher(0, 0, bcrypt.MinCost)
+	defer ConfigureHasher(0, 0, 0)
+
+	hashed, err := hashPassword("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := User{Password: string(hashed)}
+
+	for password, want := range map[string]bool{
+		"correct horse battery staple": true,
+		"correct horse battery":        false,
+		"":                             false,
+	} {
+		got, err := u.PasswordMatches(password)
+		if err != nil {
+			t.Fatalf("PasswordMatches(%q): %v", password, err)
+		}
+		if got != want {
+			t.Errorf("PasswordMatches(%q) = %v, want %v", password, got, want)
+		}
+	}
+}
+
+// BenchmarkHashPassword runs at the default cost, the budget catches both a
+// slower hasher and a cost lowered by mistake
+func BenchmarkHashPassword(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		if _, err := hashPassword("correct horse battery staple"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPasswordMatches(b *testing.B) {
+	hashed, err := hashPassword("correct horse battery staple")
+	if err != nil {
+		b.Fatal(err)
+	}
+	u := User{Password: string(hashed)}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if ok, err := u.PasswordMatches("correct horse battery staple"); !ok || err != nil {
+			b.Fatalf("PasswordMatches: %v %v", ok, err)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package data
+
+import (
+	"authentication/data/sqldb"
+	"context"
+	"expvar"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// queryTimeouts overrides dbTimeOut for single queries, keyed by query name
+var queryTimeouts = map[string]time.Duration{
+	"BulkUsers":  30 * time.Second,
+	"MergeUsers": 15 * time.Second,
+}
+
+// slowQueryThreshold is the duration above which a query is logged as slow
+var slowQueryThreshold = 250 * time.Millisecond
+
+// query counters published on /debug/vars
+var (
+	queryCounts = expvar.NewMap("db_queries")
+	slowQueries = expvar.NewMap("db_slow_queries")
+	queryErrors = expvar.NewMap("db_query_errors")
+)
+
+// ConfigureQueries sets per-query timeouts and the slow query threshold. A zero
+// threshold keeps the default.
+func ConfigureQueries(timeouts map[string]time.Duration, slow time.Duration) {
+	for name, timeout := range timeouts {
+		queryTimeouts[name] = timeout
+	}
+	if slow > 0 {
+		slowQueryThreshold = slow
+	}
+}
+
+// ParseQueryTimeouts reads a list like "GetUserByEmail=1s,InsertUser=2s"
+func ParseQueryTimeouts(s string) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration)
+
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid query timeout %q", item)
+		}
+
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid query timeout %q: %w", item, err)
+		}
+
+		timeouts[name] = timeout
+	}
+
+	return timeouts, nil
+}
+
+func timeoutFor(name string) time.Duration {
+	if timeout, ok := queryTimeouts[name]; ok {
+		return timeout
+	}
+	return dbTimeOut
+}
+
+// runQuery runs one named query with its own timeout, counts it and logs it when
+// it is slow. Arguments are only used for the log line, where they are redacted.
+func (p *Postgres) runQuery(name string, args []any, fn func(ctx context.Context, q *sqldb.Queries) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeoutFor(name))
+	defer cancel()
+
+	start := time.Now()
+
+	err := p.withQueries(ctx, func(q *sqldb.Queries) error {
+		return fn(ctx, q)
+	})
+
+	elapsed := time.Since(start)
+
+	queryCounts.Add(name, 1)
+	if err != nil {
+		queryErrors.Add(name, 1)
+	}
+
+	if elapsed >= slowQueryThreshold {
+		slowQueries.Add(name, 1)
+		log.Printf("Slow query %s took %s, args: %s", name, elapsed, redactArgs(args))
+	}
+
+	return err
+}
+
+// redactArgs describes query arguments without their values
+func redactArgs(args []any) string {
+	parts := make([]string, len(args))
+
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case string:
+			parts[i] = fmt.Sprintf("$%d=string(%d)", i+1, len(v))
+		default:
+			parts[i] = fmt.Sprintf("$%d=%T", i+1, v)
+		}
+	}
+
+	return "[" + strings.Join(parts, " ") + "]"
+}
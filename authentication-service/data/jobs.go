@@ -0,0 +1,272 @@
+package data
+
+import (
+	"authentication/data/sqldb"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+)
+
+// jobPrefix starts every job id of this service, so the broker knows where to
+// look a job up
+const jobPrefix = "auth-"
+
+// job statuses
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+const (
+	// jobHeartbeat is how often a running job touches updated_at, so that the
+	// jobs of a replica that stopped can be told from those of the others
+	jobHeartbeat = 30 * time.Second
+	// jobStaleAfter is how long a job may go without an update before it is
+	// taken for interrupted
+	jobStaleAfter = 3 * jobHeartbeat
+)
+
+// ErrJobNotFound is returned for unknown job ids
+var ErrJobNotFound = errors.New("job not found")
+
+// Job is a long running operation that callers poll with GET /jobs/{id}
+type Job struct {
+	ID         string          `json:"id"`
+	Kind       string          `json:"kind"`
+	Status     string          `json:"status"`
+	Progress   int             `json:"progress"`
+	Message    string          `json:"message,omitempty"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+}
+
+// PostgresJobs is the JobRepository of the jobs table
+type PostgresJobs struct {
+	pg *Postgres
+}
+
+// jobPublisher, when set, is called with every new state of a job
+var jobPublisher func(*Job)
+
+// SetJobPublisher makes job updates visible outside of this service, e.g. on
+// the broker's event stream. It must be called before jobs are started.
+func SetJobPublisher(fn func(*Job)) {
+	jobPublisher = fn
+}
+
+// ProgressFunc reports how far a job is, in percent, with an optional message
+type ProgressFunc func(percent int, message string)
+
+// JobFunc does the work of a job and returns its result
+type JobFunc func(ctx context.Context, progress ProgressFunc) (any, error)
+
+// newJobID returns the id of a new job
+func newJobID() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return jobPrefix + hex.EncodeToString(b), nil
+}
+
+// Start stores a new job of the given kind and runs fn in the background
+func (j *PostgresJobs) Start(kind string, fn JobFunc) (*Job, error) {
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	job := &Job{
+		ID:        id,
+		Kind:      kind,
+		Status:    JobQueued,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	err = j.pg.runQuery("InsertJob", []any{job.ID, kind}, func(ctx context.Context, q *sqldb.Queries) error {
+		return q.InsertJob(ctx, sqldb.InsertJobParams{
+			ID:        job.ID,
+			Kind:      kind,
+			Status:    JobQueued,
+			CreatedAt: now,
+			UpdatedAt: now,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the runner works on its own copy, the caller may still be encoding job
+	runner := *job
+	go j.run(&runner, fn)
+
+	return job, nil
+}
+
+func (j *PostgresJobs) run(job *Job, fn JobFunc) {
+	j.progress(job, JobRunning, 0, "")
+
+	lastPercent := -1
+	progress := func(percent int, message string) {
+		// only write when the progress moved, to keep the updates down
+		if percent == lastPercent && message == "" {
+			return
+		}
+		lastPercent = percent
+		j.progress(job, JobRunning, percent, message)
+	}
+
+	stop := j.keepAlive(job)
+	result, err := fn(context.Background(), progress)
+	stop()
+
+	params := sqldb.FinishJobParams{
+		Status:    JobSucceeded,
+		Progress:  100,
+		Result:    json.RawMessage("null"),
+		UpdatedAt: time.Now(),
+		ID:        job.ID,
+	}
+
+	if err == nil {
+		params.Result, err = json.Marshal(result)
+	}
+
+	if err != nil {
+		log.Printf("Job %s (%s) failed: %v", job.ID, job.Kind, err)
+		params.Status = JobFailed
+		params.Progress = int32(max(lastPercent, 0))
+		params.Result = json.RawMessage("null")
+		params.Error = err.Error()
+	}
+
+	err = j.pg.runQuery("FinishJob", []any{job.ID}, func(ctx context.Context, q *sqldb.Queries) error {
+		return q.FinishJob(ctx, params)
+	})
+	if err != nil {
+		log.Printf("Error finishing job %s: %v", job.ID, err)
+	}
+
+	job.Status, job.Progress, job.Error = params.Status, int(params.Progress), params.Error
+	job.UpdatedAt, job.FinishedAt = params.UpdatedAt, &params.UpdatedAt
+	if string(params.Result) != "null" {
+		job.Result = params.Result
+	}
+	job.publish()
+}
+
+// keepAlive touches the job every jobHeartbeat until stop is called
+func (j *PostgresJobs) keepAlive(job *Job) (stop func()) {
+	done := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(jobHeartbeat)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				err := j.pg.runQuery("TouchJob", []any{job.ID}, func(ctx context.Context, q *sqldb.Queries) error {
+					return q.TouchJob(ctx, sqldb.TouchJobParams{UpdatedAt: now, ID: job.ID})
+				})
+				if err != nil {
+					log.Printf("Error touching job %s: %v", job.ID, err)
+				}
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+func (j *Job) publish() {
+	if jobPublisher != nil {
+		jobPublisher(j)
+	}
+}
+
+func (j *PostgresJobs) progress(job *Job, status string, percent int, message string) {
+	job.Status, job.Progress, job.Message, job.UpdatedAt = status, percent, message, time.Now()
+
+	err := j.pg.runQuery("UpdateJobProgress", []any{job.ID}, func(ctx context.Context, q *sqldb.Queries) error {
+		return q.UpdateJobProgress(ctx, sqldb.UpdateJobProgressParams{
+			Status:    job.Status,
+			Progress:  int32(job.Progress),
+			Message:   job.Message,
+			UpdatedAt: job.UpdatedAt,
+			ID:        job.ID,
+		})
+	})
+	if err != nil {
+		log.Printf("Error updating job %s: %v", job.ID, err)
+	}
+
+	job.publish()
+}
+
+// Get returns one job by id
+func (j *PostgresJobs) Get(id string) (*Job, error) {
+	var row sqldb.Job
+
+	err := j.pg.runQuery("GetJob", []any{id}, func(ctx context.Context, q *sqldb.Queries) error {
+		var err error
+		row, err = q.GetJob(ctx, id)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrJobNotFound
+		}
+		return nil, err
+	}
+
+	job := &Job{
+		ID:        row.ID,
+		Kind:      row.Kind,
+		Status:    row.Status,
+		Progress:  int(row.Progress),
+		Message:   row.Message,
+		Result:    row.Result,
+		Error:     row.Error,
+		CreatedAt: row.CreatedAt,
+		UpdatedAt: row.UpdatedAt,
+	}
+	if row.FinishedAt.Valid {
+		job.FinishedAt = &row.FinishedAt.Time
+	}
+	if string(job.Result) == "null" {
+		job.Result = nil
+	}
+
+	return job, nil
+}
+
+// FailInterrupted marks the unfinished jobs that were not updated for a while
+// as failed: the replica running them stopped. Jobs running on the other
+// replicas keep being touched and are left alone.
+func (j *PostgresJobs) FailInterrupted() error {
+	now := time.Now()
+
+	return j.pg.runQuery("FailUnfinishedJobs", nil, func(ctx context.Context, q *sqldb.Queries) error {
+		return q.FailUnfinishedJobs(ctx, sqldb.FailUnfinishedJobsParams{
+			Error:       "interrupted by a service restart",
+			UpdatedAt:   now,
+			StaleBefore: now.Add(-jobStaleAfter),
+		})
+	})
+}
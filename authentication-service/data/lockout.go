@@ -0,0 +1,248 @@
+package data
+
+import (
+	"authentication/data/sqldb"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// lockout defaults, see ConfigureLockout
+const (
+	DefaultLockoutThreshold = 10
+	DefaultLockoutWindow    = 15 * time.Minute
+	DefaultLockoutDuration  = 15 * time.Minute
+)
+
+// ErrNotLocked is returned for accounts that are not locked
+var ErrNotLocked = errors.New("account is not locked")
+
+var (
+	lockoutThreshold = DefaultLockoutThreshold
+	lockoutWindow    = DefaultLockoutWindow
+	lockoutDuration  = DefaultLockoutDuration
+)
+
+// ConfigureLockout sets how many failed logins within window lock an account,
+// and for how long. Zero values keep the defaults, a negative threshold turns
+// locking off.
+func ConfigureLockout(threshold int, window, duration time.Duration) {
+	if threshold == 0 {
+		threshold = DefaultLockoutThreshold
+	}
+	if window <= 0 {
+		window = DefaultLockoutWindow
+	}
+	if duration <= 0 {
+		duration = DefaultLockoutDuration
+	}
+
+	lockoutThreshold, lockoutWindow, lockoutDuration = threshold, window, duration
+}
+
+// AccountLock is an account locked after too many failed logins. Logins of a
+// locked account are refused before its password is checked.
+type AccountLock struct {
+	UserID      int       `json:"user_id"`
+	LockedUntil time.Time `json:"locked_until"`
+	Failures    int       `json:"failures"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// PostgresAccountLocks is the AccountLockRepository of the account_locks and
+// login_failures tables
+type PostgresAccountLocks struct {
+	pg *Postgres
+}
+
+// LoginFailures counts the recent failed logins of an account from one address
+type LoginFailures struct {
+	IP           string    `json:"ip"`
+	Failures     int       `json:"failures"`
+	LastFailedAt time.Time `json:"last_failed_at"`
+}
+
+// Get returns the lock of an account, ErrNotLocked when it has none or its
+// lock ran out
+func (l *PostgresAccountLocks) Get(userID int) (*AccountLock, error) {
+	var row sqldb.AccountLock
+
+	err := l.pg.runQuery("GetAccountLock", []any{userID}, func(ctx context.Context, q *sqldb.Queries) error {
+		var err error
+		row, err = q.GetAccountLock(ctx, int32(userID))
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotLocked
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !row.LockedUntil.After(time.Now()) {
+		return nil, ErrNotLocked
+	}
+
+	return accountLockFromRow(row), nil
+}
+
+// Failed records a failed login of an account from ip and locks the account
+// when it failed too often within the window. It returns the lock, nil when the
+// account is not locked.
+func (l *PostgresAccountLocks) Failed(userID int, ip string) (*AccountLock, error) {
+	if lockoutThreshold < 0 {
+		return nil, nil
+	}
+
+	now := time.Now()
+	var lock *sqldb.AccountLock
+
+	err := l.pg.runQuery("InsertLoginFailure", []any{userID, ip}, func(ctx context.Context, q *sqldb.Queries) error {
+		tx, err := l.pg.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		qtx := q.WithTx(tx)
+
+		err = qtx.DeleteLoginFailuresBefore(ctx, sqldb.DeleteLoginFailuresBeforeParams{
+			UserID:    int32(userID),
+			CreatedAt: now.Add(-lockoutWindow),
+		})
+		if err != nil {
+			return err
+		}
+
+		err = qtx.InsertLoginFailure(ctx, sqldb.InsertLoginFailureParams{
+			UserID:    int32(userID),
+			Ip:        ip,
+			CreatedAt: now,
+		})
+		if err != nil {
+			return err
+		}
+
+		failures, err := qtx.CountLoginFailures(ctx, sqldb.CountLoginFailuresParams{
+			UserID:    int32(userID),
+			CreatedAt: now.Add(-lockoutWindow),
+		})
+		if err != nil {
+			return err
+		}
+
+		if failures >= int64(lockoutThreshold) {
+			lock = &sqldb.AccountLock{
+				UserID:      int32(userID),
+				LockedUntil: now.Add(lockoutDuration),
+				Failures:    int32(failures),
+				CreatedAt:   now,
+			}
+			err = qtx.LockAccount(ctx, sqldb.LockAccountParams{
+				UserID:      lock.UserID,
+				LockedUntil: lock.LockedUntil,
+				Failures:    lock.Failures,
+				CreatedAt:   lock.CreatedAt,
+			})
+			if err != nil {
+				return err
+			}
+
+			// the next lock takes as many failures again
+			if err := qtx.ClearLoginFailures(ctx, int32(userID)); err != nil {
+				return err
+			}
+		}
+
+		return tx.Commit()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if lock == nil {
+		return nil, nil
+	}
+	return accountLockFromRow(*lock), nil
+}
+
+// Succeeded forgets the failed logins of an account after it logged in
+func (l *PostgresAccountLocks) Succeeded(userID int) error {
+	return l.pg.runQuery("ClearLoginFailures", []any{userID}, func(ctx context.Context, q *sqldb.Queries) error {
+		return q.ClearLoginFailures(ctx, int32(userID))
+	})
+}
+
+// Unlock removes the lock and the failed logins of an account. It returns
+// ErrNotLocked when the account had no lock.
+func (l *PostgresAccountLocks) Unlock(userID int) error {
+	var deleted int64
+
+	err := l.pg.runQuery("DeleteAccountLock", []any{userID}, func(ctx context.Context, q *sqldb.Queries) error {
+		tx, err := l.pg.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		qtx := q.WithTx(tx)
+
+		deleted, err = qtx.DeleteAccountLock(ctx, int32(userID))
+		if err != nil {
+			return err
+		}
+
+		if err := qtx.ClearLoginFailures(ctx, int32(userID)); err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	})
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrNotLocked
+	}
+
+	return nil
+}
+
+// RecentFailures returns the failed logins of an account within the window, by
+// the address they came from
+func (l *PostgresAccountLocks) RecentFailures(userID int) ([]LoginFailures, error) {
+	var rows []sqldb.ListLoginFailureAddressesRow
+
+	err := l.pg.runQuery("ListLoginFailureAddresses", []any{userID}, func(ctx context.Context, q *sqldb.Queries) error {
+		var err error
+		rows, err = q.ListLoginFailureAddresses(ctx, sqldb.ListLoginFailureAddressesParams{
+			UserID:    int32(userID),
+			CreatedAt: time.Now().Add(-lockoutWindow),
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	failures := make([]LoginFailures, 0, len(rows))
+	for _, row := range rows {
+		failures = append(failures, LoginFailures{
+			IP:           row.Ip,
+			Failures:     int(row.Failures),
+			LastFailedAt: row.LastFailedAt,
+		})
+	}
+
+	return failures, nil
+}
+
+func accountLockFromRow(row sqldb.AccountLock) *AccountLock {
+	return &AccountLock{
+		UserID:      int(row.UserID),
+		LockedUntil: row.LockedUntil,
+		Failures:    int(row.Failures),
+		CreatedAt:   row.CreatedAt,
+	}
+}
@@ -0,0 +1,252 @@
+package data
+
+import (
+	"authentication/data/sqldb"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrTemplateVersionNotFound is returned for unknown versions of a template
+	ErrTemplateVersionNotFound = errors.New("mail template version not found")
+	// ErrTemplateVersionInUse is returned when deleting a version that is sent
+	ErrTemplateVersionInUse = errors.New("mail template version is rolled out")
+)
+
+// MailTemplateVersion is one version of a mail template edited through the
+// admin API. Text defines the "subject" template like the built-in .txt files.
+type MailTemplateVersion struct {
+	Template  string    `json:"template"`
+	Version   int       `json:"version"`
+	Text      string    `json:"text"`
+	HTML      string    `json:"html,omitempty"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MailTemplateRollout says which version of a template is sent: Candidate to
+// Percent of the recipients and Stable to the others. Version 0 is the
+// built-in template, templates without a rollout only send that one.
+type MailTemplateRollout struct {
+	Template  string    `json:"template"`
+	Stable    int       `json:"stable_version"`
+	Candidate int       `json:"candidate_version,omitempty"`
+	Percent   int       `json:"percent"`
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+}
+
+// PostgresMailTemplates is the MailTemplateRepository of the
+// mail_template_versions and mail_template_rollouts tables
+type PostgresMailTemplates struct {
+	pg *Postgres
+}
+
+// CreateVersion stores a new version of a template, numbered after the last
+func (t *PostgresMailTemplates) CreateVersion(template, text, html, createdBy string) (*MailTemplateVersion, error) {
+	var row sqldb.MailTemplateVersion
+
+	err := t.pg.runQuery("InsertMailTemplateVersion", []any{template, createdBy}, func(ctx context.Context, q *sqldb.Queries) error {
+		var err error
+		row, err = q.InsertMailTemplateVersion(ctx, sqldb.InsertMailTemplateVersionParams{
+			Template:  template,
+			TextBody:  text,
+			HtmlBody:  html,
+			CreatedBy: createdBy,
+			CreatedAt: time.Now(),
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return templateVersionFromRow(row), nil
+}
+
+// Version returns one version of a template
+func (t *PostgresMailTemplates) Version(template string, version int) (*MailTemplateVersion, error) {
+	var row sqldb.MailTemplateVersion
+
+	err := t.pg.runQuery("GetMailTemplateVersion", []any{template, version}, func(ctx context.Context, q *sqldb.Queries) error {
+		var err error
+		row, err = q.GetMailTemplateVersion(ctx, sqldb.GetMailTemplateVersionParams{Template: template, Version: int32(version)})
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTemplateVersionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return templateVersionFromRow(row), nil
+}
+
+// Versions returns the versions of a template, the newest first
+func (t *PostgresMailTemplates) Versions(template string) ([]*MailTemplateVersion, error) {
+	var rows []sqldb.MailTemplateVersion
+
+	err := t.pg.runQuery("ListMailTemplateVersions", []any{template}, func(ctx context.Context, q *sqldb.Queries) error {
+		var err error
+		rows, err = q.ListMailTemplateVersions(ctx, template)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]*MailTemplateVersion, 0, len(rows))
+	for _, row := range rows {
+		versions = append(versions, templateVersionFromRow(row))
+	}
+
+	return versions, nil
+}
+
+// DeleteVersion deletes a version of a template that is not rolled out
+func (t *PostgresMailTemplates) DeleteVersion(template string, version int) error {
+	return t.pg.runQuery("DeleteMailTemplateVersion", []any{template, version}, func(ctx context.Context, q *sqldb.Queries) error {
+		tx, err := t.pg.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		qtx := q.WithTx(tx)
+
+		rollout, err := qtx.GetMailTemplateRollout(ctx, template)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if err == nil && (rollout.StableVersion.Int32 == int32(version) || rollout.CandidateVersion.Int32 == int32(version)) {
+			return ErrTemplateVersionInUse
+		}
+
+		deleted, err := qtx.DeleteMailTemplateVersion(ctx, sqldb.DeleteMailTemplateVersionParams{Template: template, Version: int32(version)})
+		if err != nil {
+			return err
+		}
+		if deleted == 0 {
+			return ErrTemplateVersionNotFound
+		}
+
+		return tx.Commit()
+	})
+}
+
+// Delete deletes every version of a template and its rollout, the built-in
+// template is sent again
+func (t *PostgresMailTemplates) Delete(template string) error {
+	return t.pg.runQuery("DeleteMailTemplateVersions", []any{template}, func(ctx context.Context, q *sqldb.Queries) error {
+		tx, err := t.pg.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		qtx := q.WithTx(tx)
+
+		if err := qtx.DeleteMailTemplateRollout(ctx, template); err != nil {
+			return err
+		}
+
+		deleted, err := qtx.DeleteMailTemplateVersions(ctx, template)
+		if err != nil {
+			return err
+		}
+		if deleted == 0 {
+			return ErrTemplateVersionNotFound
+		}
+
+		return tx.Commit()
+	})
+}
+
+// Rollout returns the rollout of a template, the built-in version when it has
+// none
+func (t *PostgresMailTemplates) Rollout(template string) (*MailTemplateRollout, error) {
+	var row sqldb.MailTemplateRollout
+
+	err := t.pg.runQuery("GetMailTemplateRollout", []any{template}, func(ctx context.Context, q *sqldb.Queries) error {
+		var err error
+		row, err = q.GetMailTemplateRollout(ctx, template)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return &MailTemplateRollout{Template: template}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return rolloutFromRow(row), nil
+}
+
+// Rollouts returns the rollouts of every template that has one
+func (t *PostgresMailTemplates) Rollouts() ([]*MailTemplateRollout, error) {
+	var rows []sqldb.MailTemplateRollout
+
+	err := t.pg.runQuery("ListMailTemplateRollouts", nil, func(ctx context.Context, q *sqldb.Queries) error {
+		var err error
+		rows, err = q.ListMailTemplateRollouts(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rollouts := make([]*MailTemplateRollout, 0, len(rows))
+	for _, row := range rows {
+		rollouts = append(rollouts, rolloutFromRow(row))
+	}
+
+	return rollouts, nil
+}
+
+// SetRollout changes which versions of a template are sent, at once on every
+// replica. The versions must exist, except version 0.
+func (t *PostgresMailTemplates) SetRollout(rollout *MailTemplateRollout) error {
+	for _, version := range []int{rollout.Stable, rollout.Candidate} {
+		if version == 0 {
+			continue
+		}
+		if _, err := t.Version(rollout.Template, version); err != nil {
+			return err
+		}
+	}
+
+	rollout.UpdatedAt = time.Now()
+
+	return t.pg.runQuery("UpsertMailTemplateRollout", []any{rollout.Template}, func(ctx context.Context, q *sqldb.Queries) error {
+		return q.UpsertMailTemplateRollout(ctx, sqldb.UpsertMailTemplateRolloutParams{
+			Template:         rollout.Template,
+			StableVersion:    sql.NullInt32{Int32: int32(rollout.Stable), Valid: rollout.Stable > 0},
+			CandidateVersion: sql.NullInt32{Int32: int32(rollout.Candidate), Valid: rollout.Candidate > 0},
+			Percent:          int32(rollout.Percent),
+			UpdatedAt:        rollout.UpdatedAt,
+		})
+	})
+}
+
+func templateVersionFromRow(row sqldb.MailTemplateVersion) *MailTemplateVersion {
+	return &MailTemplateVersion{
+		Template:  row.Template,
+		Version:   int(row.Version),
+		Text:      row.TextBody,
+		HTML:      row.HtmlBody,
+		CreatedBy: row.CreatedBy,
+		CreatedAt: row.CreatedAt,
+	}
+}
+
+func rolloutFromRow(row sqldb.MailTemplateRollout) *MailTemplateRollout {
+	return &MailTemplateRollout{
+		Template:  row.Template,
+		Stable:    int(row.StableVersion.Int32),
+		Candidate: int(row.CandidateVersion.Int32),
+		Percent:   int(row.Percent),
+		UpdatedAt: row.UpdatedAt,
+	}
+}
@@ -0,0 +1,96 @@
+package data
+
+import (
+	"authentication/data/sqldb"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrMailThreadNotFound is returned for replies to mails that were never sent
+var ErrMailThreadNotFound = errors.New("mail thread not found")
+
+// MailThread is a mail sent to a user that a reply can answer. Its id is the
+// local part of the Message-ID of the mail, replies carry it in In-Reply-To.
+type MailThread struct {
+	ID        string    `json:"id"`
+	UserID    int       `json:"user_id"`
+	Template  string    `json:"template"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PostgresMailThreads is the MailThreadRepository of the mail_threads and
+// mail_replies tables
+type PostgresMailThreads struct {
+	pg *Postgres
+}
+
+// Start stores a new thread for a mail of a user and returns its id
+func (t *PostgresMailThreads) Start(userID int, template string) (string, error) {
+	id, err := randomToken(24)
+	if err != nil {
+		return "", err
+	}
+
+	err = t.pg.runQuery("InsertMailThread", []any{id, userID, template}, func(ctx context.Context, q *sqldb.Queries) error {
+		return q.InsertMailThread(ctx, sqldb.InsertMailThreadParams{
+			ID:        id,
+			UserID:    int32(userID),
+			Template:  template,
+			CreatedAt: time.Now(),
+		})
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// Get returns one thread
+func (t *PostgresMailThreads) Get(id string) (*MailThread, error) {
+	var row sqldb.MailThread
+
+	err := t.pg.runQuery("GetMailThread", []any{id}, func(ctx context.Context, q *sqldb.Queries) error {
+		var err error
+		row, err = q.GetMailThread(ctx, id)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrMailThreadNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &MailThread{
+		ID:        row.ID,
+		UserID:    int(row.UserID),
+		Template:  row.Template,
+		CreatedAt: row.CreatedAt,
+	}, nil
+}
+
+// RecordReply stores that the reply messageID answered a thread. It returns
+// false when the reply was recorded before, mail providers deliver the same
+// reply again when they think the first delivery failed.
+func (t *PostgresMailThreads) RecordReply(messageID string, thread *MailThread) (bool, error) {
+	var inserted int64
+
+	err := t.pg.runQuery("InsertMailReply", []any{messageID, thread.ID}, func(ctx context.Context, q *sqldb.Queries) error {
+		var err error
+		inserted, err = q.InsertMailReply(ctx, sqldb.InsertMailReplyParams{
+			MessageID:  messageID,
+			ThreadID:   thread.ID,
+			UserID:     int32(thread.UserID),
+			ReceivedAt: time.Now(),
+		})
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return inserted > 0, nil
+}
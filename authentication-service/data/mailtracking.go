@@ -0,0 +1,174 @@
+package data
+
+import (
+	"authentication/data/sqldb"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrMailMessageNotFound is returned for unknown tracked mails and links
+var ErrMailMessageNotFound = errors.New("tracked mail not found")
+
+// MailMessage is a tracked mail: how often it was opened and its links
+// followed. Links holds the targets of its wrapped links, by position.
+type MailMessage struct {
+	ID             string     `json:"id"`
+	UserID         int        `json:"user_id,omitempty"`
+	Template       string     `json:"template"`
+	Links          []string   `json:"links"`
+	Opens          int        `json:"opens"`
+	Clicks         int        `json:"clicks"`
+	CreatedAt      time.Time  `json:"created_at"`
+	FirstOpenedAt  *time.Time `json:"first_opened_at,omitempty"`
+	FirstClickedAt *time.Time `json:"first_clicked_at,omitempty"`
+}
+
+// PostgresMailMessages is the MailMessageRepository of the mail_messages and
+// mail_tracking_optouts tables
+type PostgresMailMessages struct {
+	pg *Postgres
+}
+
+// Track stores a new tracked mail of a user, zero for none, and returns its id
+func (m *PostgresMailMessages) Track(userID int, template string, links []string) (string, error) {
+	id, err := randomToken(24)
+	if err != nil {
+		return "", err
+	}
+
+	err = m.pg.runQuery("InsertMailMessage", []any{id, userID, template}, func(ctx context.Context, q *sqldb.Queries) error {
+		return q.InsertMailMessage(ctx, sqldb.InsertMailMessageParams{
+			ID:        id,
+			UserID:    sql.NullInt32{Int32: int32(userID), Valid: userID > 0},
+			Template:  template,
+			Links:     nonNil(links),
+			CreatedAt: time.Now(),
+		})
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// Get returns one tracked mail
+func (m *PostgresMailMessages) Get(id string) (*MailMessage, error) {
+	var row sqldb.MailMessage
+
+	err := m.pg.runQuery("GetMailMessage", []any{id}, func(ctx context.Context, q *sqldb.Queries) error {
+		var err error
+		row, err = q.GetMailMessage(ctx, id)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrMailMessageNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &MailMessage{
+		ID:        row.ID,
+		UserID:    int(row.UserID.Int32),
+		Template:  row.Template,
+		Links:     nonNil(row.Links),
+		Opens:     int(row.Opens),
+		Clicks:    int(row.Clicks),
+		CreatedAt: row.CreatedAt,
+	}
+	if row.FirstOpenedAt.Valid {
+		msg.FirstOpenedAt = &row.FirstOpenedAt.Time
+	}
+	if row.FirstClickedAt.Valid {
+		msg.FirstClickedAt = &row.FirstClickedAt.Time
+	}
+
+	return msg, nil
+}
+
+// Link returns the target of the nth wrapped link of a mail
+func (m *PostgresMailMessages) Link(id string, n int) (string, error) {
+	msg, err := m.Get(id)
+	if err != nil {
+		return "", err
+	}
+	if n < 0 || n >= len(msg.Links) {
+		return "", ErrMailMessageNotFound
+	}
+
+	return msg.Links[n], nil
+}
+
+// Opened counts an open of a mail
+func (m *PostgresMailMessages) Opened(id string) error {
+	var updated int64
+
+	err := m.pg.runQuery("RecordMailOpen", []any{id}, func(ctx context.Context, q *sqldb.Queries) error {
+		var err error
+		updated, err = q.RecordMailOpen(ctx, sqldb.RecordMailOpenParams{OpenedAt: time.Now(), ID: id})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrMailMessageNotFound
+	}
+
+	return nil
+}
+
+// Clicked counts a followed link of a mail
+func (m *PostgresMailMessages) Clicked(id string) error {
+	var updated int64
+
+	err := m.pg.runQuery("RecordMailClick", []any{id}, func(ctx context.Context, q *sqldb.Queries) error {
+		var err error
+		updated, err = q.RecordMailClick(ctx, sqldb.RecordMailClickParams{ClickedAt: time.Now(), ID: id})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrMailMessageNotFound
+	}
+
+	return nil
+}
+
+// TrackingAllowed tells if the mails of a user may be tracked, they are unless
+// the user opted out
+func (m *PostgresMailMessages) TrackingAllowed(userID int) (bool, error) {
+	var optedOut bool
+
+	err := m.pg.runQuery("MailTrackingOptedOut", []any{userID}, func(ctx context.Context, q *sqldb.Queries) error {
+		var err error
+		optedOut, err = q.MailTrackingOptedOut(ctx, int32(userID))
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return !optedOut, nil
+}
+
+// SetTracking opts a user in or out of mail tracking
+func (m *PostgresMailMessages) SetTracking(userID int, allowed bool) error {
+	if allowed {
+		return m.pg.runQuery("DeleteMailTrackingOptOut", []any{userID}, func(ctx context.Context, q *sqldb.Queries) error {
+			return q.DeleteMailTrackingOptOut(ctx, int32(userID))
+		})
+	}
+
+	return m.pg.runQuery("InsertMailTrackingOptOut", []any{userID}, func(ctx context.Context, q *sqldb.Queries) error {
+		return q.InsertMailTrackingOptOut(ctx, sqldb.InsertMailTrackingOptOutParams{
+			UserID:    int32(userID),
+			CreatedAt: time.Now(),
+		})
+	})
+}
@@ -0,0 +1,1185 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	_ RefreshTokenRepository  = (*MemoryRefreshTokens)(nil)
+	_ AccountLockRepository   = (*MemoryAccountLocks)(nil)
+	_ PasswordResetRepository = (*MemoryPasswordResets)(nil)
+	_ RoleRepository          = (*MemoryRoles)(nil)
+	_ MailMessageRepository   = (*MemoryMailMessages)(nil)
+	_ JobRepository           = (*MemoryJobs)(nil)
+	_ MailThreadRepository    = (*MemoryMailThreads)(nil)
+	_ MailTemplateRepository  = (*MemoryMailTemplates)(nil)
+)
+
+// MemoryUsers is a UserRepository kept in memory, for tests of the handlers
+// without a database. It knows the built-in roles, more are added with
+// DefineRole. Passwords are hashed like in Postgres.
+type MemoryUsers struct {
+	mu     sync.Mutex
+	nextID int
+	users  map[int]*User
+	roles  map[int][]string
+
+	// permissions of each known role
+	permissions map[string][]string
+}
+
+// NewMemoryUsers returns an empty in-memory repository
+func NewMemoryUsers() *MemoryUsers {
+	return &MemoryUsers{
+		nextID: 1,
+		users:  make(map[int]*User),
+		roles:  make(map[int][]string),
+		permissions: map[string][]string{
+			RoleAdmin: {PermissionAll},
+			RoleUser:  {},
+		},
+	}
+}
+
+// DefineRole makes a role known to AssignRole and PermissionsOf
+func (m *MemoryUsers) DefineRole(name string, permissions ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.permissions[name] = permissions
+}
+
+// GetAll returns every user, sorted by last name
+func (m *MemoryUsers) GetAll() ([]*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	users := m.list()
+	slices.SortStableFunc(users, func(a, b *User) int {
+		return cmp.Compare(a.LastName, b.LastName)
+	})
+
+	return users, nil
+}
+
+func (m *MemoryUsers) GetByEmail(email string) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, user := range m.users {
+		if user.Email == email {
+			return m.withRoles(user), nil
+		}
+	}
+
+	return nil, errors.New("no user found with that email")
+}
+
+func (m *MemoryUsers) GetOne(id int) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: no user found with that ID", ErrUserNotFound)
+	}
+
+	return m.withRoles(user), nil
+}
+
+// Search pages through the users like the SQL of PostgresUsers.Search
+func (m *MemoryUsers) Search(query UserQuery) ([]*User, int, error) {
+	if err := query.Validate(); err != nil {
+		return nil, 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	terms := strings.Fields(strings.ToLower(query.Search))
+
+	var matches []*User
+	for _, user := range m.list() {
+		text := strings.ToLower(user.Email + " " + user.FirstName + " " + user.LastName)
+		if !containsAll(text, terms) {
+			continue
+		}
+		if query.Active != nil && user.Active != *query.Active {
+			continue
+		}
+		matches = append(matches, user)
+	}
+
+	field := strings.TrimPrefix(query.Sort, "-")
+	slices.SortStableFunc(matches, func(a, b *User) int {
+		var c int
+		switch field {
+		case "email":
+			c = cmp.Compare(a.Email, b.Email)
+		case "first_name":
+			c = cmp.Compare(a.FirstName, b.FirstName)
+		case "last_name":
+			c = cmp.Compare(a.LastName, b.LastName)
+		case "created_at":
+			c = a.CreatedAt.Compare(b.CreatedAt)
+		case "updated_at":
+			c = a.UpdatedAt.Compare(b.UpdatedAt)
+		}
+		if c == 0 {
+			c = cmp.Compare(a.ID, b.ID)
+		}
+		if strings.HasPrefix(query.Sort, "-") {
+			return -c
+		}
+		return c
+	})
+
+	offset := (query.Page - 1) * query.PerPage
+	if offset >= len(matches) {
+		return []*User{}, 0, nil
+	}
+
+	return matches[offset:min(offset+query.PerPage, len(matches))], len(matches), nil
+}
+
+func (m *MemoryUsers) Insert(user User) (int, error) {
+	hashedPassword, err := hashPassword(user.Password)
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.emailTaken(user.Email, 0) {
+		return 0, ErrEmailTaken
+	}
+
+	now := time.Now()
+
+	user.ID = m.nextID
+	user.Password = string(hashedPassword)
+	user.CreatedAt, user.UpdatedAt = now, now
+	user.Roles = nil
+
+	m.nextID++
+	m.users[user.ID] = &user
+	m.roles[user.ID] = []string{RoleUser}
+
+	return user.ID, nil
+}
+
+func (m *MemoryUsers) Update(user *User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.users[user.ID]
+	if !ok {
+		return nil
+	}
+	if m.emailTaken(user.Email, user.ID) {
+		return ErrEmailTaken
+	}
+
+	stored.Email, stored.FirstName, stored.LastName = user.Email, user.FirstName, user.LastName
+	stored.Active = user.Active
+	stored.UpdatedAt = time.Now()
+
+	return nil
+}
+
+func (m *MemoryUsers) DeleteByID(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.users, id)
+	delete(m.roles, id)
+
+	return nil
+}
+
+// ResetPassword changes the password of a user. There are no refresh tokens
+// in memory to revoke with it.
+func (m *MemoryUsers) ResetPassword(id int, password string) error {
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if user, ok := m.users[id]; ok {
+		user.Password = string(hashedPassword)
+	}
+
+	return nil
+}
+
+func (m *MemoryUsers) RolesOf(userID int) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return slices.Clone(m.roles[userID]), nil
+}
+
+func (m *MemoryUsers) PermissionsOf(userID int) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var permissions []string
+	for _, role := range m.roles[userID] {
+		for _, p := range m.permissions[role] {
+			if !slices.Contains(permissions, p) {
+				permissions = append(permissions, p)
+			}
+		}
+	}
+	slices.Sort(permissions)
+
+	return permissions, nil
+}
+
+func (m *MemoryUsers) AssignRole(userID int, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.permissions[role]; !ok {
+		return fmt.Errorf("%w: %s", ErrRoleNotFound, role)
+	}
+	if _, ok := m.users[userID]; !ok {
+		return fmt.Errorf("%w: %d", ErrUserNotFound, userID)
+	}
+
+	if !slices.Contains(m.roles[userID], role) {
+		m.roles[userID] = append(m.roles[userID], role)
+		slices.Sort(m.roles[userID])
+	}
+
+	return nil
+}
+
+func (m *MemoryUsers) RevokeRole(userID int, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := slices.Index(m.roles[userID], role)
+	if i < 0 {
+		return fmt.Errorf("%w: user %d does not hold %s", ErrRoleNotFound, userID, role)
+	}
+	m.roles[userID] = slices.Delete(m.roles[userID], i, i+1)
+
+	return nil
+}
+
+// list returns copies of the users by id, callers can not change the stored
+// ones. It expects m.mu to be held.
+func (m *MemoryUsers) list() []*User {
+	users := make([]*User, 0, len(m.users))
+	for _, user := range m.users {
+		u := *user
+		users = append(users, &u)
+	}
+	slices.SortFunc(users, func(a, b *User) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return users
+}
+
+// withRoles returns a copy of user with its roles, like GetOne of Postgres
+func (m *MemoryUsers) withRoles(user *User) *User {
+	u := *user
+	u.Roles = slices.Clone(m.roles[user.ID])
+	return &u
+}
+
+// emailTaken tells if another user than id has email
+func (m *MemoryUsers) emailTaken(email string, id int) bool {
+	for _, user := range m.users {
+		if user.Email == email && user.ID != id {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAll(text string, terms []string) bool {
+	for _, term := range terms {
+		if !strings.Contains(text, term) {
+			return false
+		}
+	}
+	return true
+}
+
+// MemoryRefreshTokens is a RefreshTokenRepository kept in memory, for tests of
+// the handlers without a database
+type MemoryRefreshTokens struct {
+	mu     sync.Mutex
+	tokens map[string]*memoryToken
+}
+
+type memoryToken struct {
+	RefreshToken
+	used, revoked bool
+}
+
+// NewMemoryRefreshTokens returns an empty in-memory token store
+func NewMemoryRefreshTokens() *MemoryRefreshTokens {
+	return &MemoryRefreshTokens{tokens: make(map[string]*memoryToken)}
+}
+
+func (m *MemoryRefreshTokens) Issue(userID int, ttl time.Duration) (string, *RefreshToken, error) {
+	family, err := randomToken(16)
+	if err != nil {
+		return "", nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.insert(userID, family, ttl)
+}
+
+// Rotate uses up raw like PostgresRefreshTokens.Rotate, revoking its family
+// when it was used before
+func (m *MemoryRefreshTokens) Rotate(raw string, ttl time.Duration, allow func(userID int) error) (string, *RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, ok := m.tokens[hashToken(raw)]
+	switch {
+	case !ok || token.revoked:
+		return "", nil, ErrTokenInvalid
+	case !token.ExpiresAt.After(time.Now()):
+		return "", nil, ErrTokenExpired
+	}
+
+	if err := allow(token.UserID); err != nil {
+		return "", nil, err
+	}
+
+	if token.used {
+		m.revoke(func(t *memoryToken) bool { return t.Family == token.Family })
+		return "", nil, ErrTokenReused
+	}
+	token.used = true
+
+	return m.insert(token.UserID, token.Family, ttl)
+}
+
+func (m *MemoryRefreshTokens) Revoke(raw string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, ok := m.tokens[hashToken(raw)]
+	if !ok {
+		return 0, ErrTokenInvalid
+	}
+	m.revoke(func(t *memoryToken) bool { return t.Family == token.Family })
+
+	return token.UserID, nil
+}
+
+func (m *MemoryRefreshTokens) RevokeAll(userID int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.revoke(func(t *memoryToken) bool { return t.UserID == userID }), nil
+}
+
+func (m *MemoryRefreshTokens) Sessions(userID int) ([]Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	byFamily := make(map[string]*Session)
+	active := make(map[string]bool)
+	for _, t := range m.tokens {
+		if t.UserID != userID {
+			continue
+		}
+
+		s, ok := byFamily[t.Family]
+		if !ok {
+			s = &Session{Family: t.Family, SignedInAt: t.CreatedAt, RefreshedAt: t.CreatedAt, ExpiresAt: t.ExpiresAt}
+			byFamily[t.Family] = s
+		}
+		if t.CreatedAt.Before(s.SignedInAt) {
+			s.SignedInAt = t.CreatedAt
+		}
+		if t.CreatedAt.After(s.RefreshedAt) {
+			s.RefreshedAt = t.CreatedAt
+		}
+		if t.ExpiresAt.After(s.ExpiresAt) {
+			s.ExpiresAt = t.ExpiresAt
+		}
+		if !t.used && !t.revoked && t.ExpiresAt.After(now) {
+			active[t.Family] = true
+		}
+	}
+
+	sessions := make([]Session, 0, len(active))
+	for family := range active {
+		sessions = append(sessions, *byFamily[family])
+	}
+	slices.SortFunc(sessions, func(a, b Session) int { return b.RefreshedAt.Compare(a.RefreshedAt) })
+
+	return sessions, nil
+}
+
+func (m *MemoryRefreshTokens) SignIns(userID, limit int) ([]SignIn, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	byFamily := make(map[string]*SignIn)
+	for _, t := range m.tokens {
+		if t.UserID != userID {
+			continue
+		}
+
+		s, ok := byFamily[t.Family]
+		if !ok {
+			s = &SignIn{Family: t.Family, SignedInAt: t.CreatedAt}
+			byFamily[t.Family] = s
+		}
+		if t.CreatedAt.Before(s.SignedInAt) {
+			s.SignedInAt = t.CreatedAt
+		}
+		if !t.used && !t.revoked && t.ExpiresAt.After(now) {
+			s.Active = true
+		}
+	}
+
+	signIns := make([]SignIn, 0, len(byFamily))
+	for _, s := range byFamily {
+		signIns = append(signIns, *s)
+	}
+	slices.SortFunc(signIns, func(a, b SignIn) int {
+		return cmp.Or(b.SignedInAt.Compare(a.SignedInAt), cmp.Compare(a.Family, b.Family))
+	})
+	if len(signIns) > limit {
+		signIns = signIns[:limit]
+	}
+
+	return signIns, nil
+}
+
+// insert stores a new token of family, it expects m.mu to be held
+func (m *MemoryRefreshTokens) insert(userID int, family string, ttl time.Duration) (string, *RefreshToken, error) {
+	raw, err := randomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if ttl <= 0 {
+		ttl = DefaultRefreshTTL
+	}
+
+	now := time.Now()
+	token := &memoryToken{RefreshToken: RefreshToken{UserID: userID, Family: family, CreatedAt: now, ExpiresAt: now.Add(ttl)}}
+	m.tokens[hashToken(raw)] = token
+
+	issued := token.RefreshToken
+	return raw, &issued, nil
+}
+
+// revoke revokes the tokens matching that were not revoked yet and returns
+// how many there were, it expects m.mu to be held
+func (m *MemoryRefreshTokens) revoke(match func(*memoryToken) bool) int {
+	revoked := 0
+	for _, t := range m.tokens {
+		if match(t) && !t.revoked {
+			t.revoked = true
+			revoked++
+		}
+	}
+	return revoked
+}
+
+// MemoryAccountLocks is an AccountLockRepository kept in memory, locking after
+// the failures set by ConfigureLockout like Postgres
+type MemoryAccountLocks struct {
+	mu       sync.Mutex
+	locks    map[int]*AccountLock
+	failures map[int][]loginFailure
+}
+
+type loginFailure struct {
+	ip string
+	at time.Time
+}
+
+// NewMemoryAccountLocks returns an in-memory store without locks
+func NewMemoryAccountLocks() *MemoryAccountLocks {
+	return &MemoryAccountLocks{
+		locks:    make(map[int]*AccountLock),
+		failures: make(map[int][]loginFailure),
+	}
+}
+
+func (m *MemoryAccountLocks) Get(userID int) (*AccountLock, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lock, ok := m.locks[userID]
+	if !ok || !lock.LockedUntil.After(time.Now()) {
+		return nil, ErrNotLocked
+	}
+
+	l := *lock
+	return &l, nil
+}
+
+func (m *MemoryAccountLocks) Failed(userID int, ip string) (*AccountLock, error) {
+	if lockoutThreshold < 0 {
+		return nil, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	failures := append(m.recent(userID, now), loginFailure{ip: ip, at: now})
+	m.failures[userID] = failures
+
+	if len(failures) < lockoutThreshold {
+		return nil, nil
+	}
+
+	lock := &AccountLock{UserID: userID, LockedUntil: now.Add(lockoutDuration), Failures: len(failures), CreatedAt: now}
+	m.locks[userID] = lock
+	delete(m.failures, userID)
+
+	l := *lock
+	return &l, nil
+}
+
+func (m *MemoryAccountLocks) Succeeded(userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.failures, userID)
+	return nil
+}
+
+func (m *MemoryAccountLocks) Unlock(userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.locks[userID]
+	delete(m.locks, userID)
+	delete(m.failures, userID)
+	if !ok {
+		return ErrNotLocked
+	}
+
+	return nil
+}
+
+func (m *MemoryAccountLocks) RecentFailures(userID int) ([]LoginFailures, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	byIP := make(map[string]int)
+	failures := []LoginFailures{}
+	for _, f := range m.recent(userID, time.Now()) {
+		i, ok := byIP[f.ip]
+		if !ok {
+			i = len(failures)
+			byIP[f.ip] = i
+			failures = append(failures, LoginFailures{IP: f.ip})
+		}
+		failures[i].Failures++
+		failures[i].LastFailedAt = f.at
+	}
+	slices.SortFunc(failures, func(a, b LoginFailures) int {
+		return cmp.Or(cmp.Compare(b.Failures, a.Failures), cmp.Compare(a.IP, b.IP))
+	})
+
+	return failures, nil
+}
+
+// recent returns the failures of a user within the window, it expects m.mu to
+// be held
+func (m *MemoryAccountLocks) recent(userID int, now time.Time) []loginFailure {
+	var recent []loginFailure
+	for _, f := range m.failures[userID] {
+		if f.at.After(now.Add(-lockoutWindow)) {
+			recent = append(recent, f)
+		}
+	}
+	return recent
+}
+
+// MemoryPasswordResets is a PasswordResetRepository kept in memory. Redeem
+// sets the password on users and revokes the sessions in tokens, like the
+// transaction of Postgres.
+type MemoryPasswordResets struct {
+	users  *MemoryUsers
+	tokens *MemoryRefreshTokens
+
+	mu     sync.Mutex
+	resets map[string]*memoryReset
+}
+
+type memoryReset struct {
+	userID  int
+	expires time.Time
+	used    bool
+}
+
+// NewMemoryPasswordResets returns an empty in-memory reset store for users
+// and their refresh tokens
+func NewMemoryPasswordResets(users *MemoryUsers, tokens *MemoryRefreshTokens) *MemoryPasswordResets {
+	return &MemoryPasswordResets{users: users, tokens: tokens, resets: make(map[string]*memoryReset)}
+}
+
+func (m *MemoryPasswordResets) Issue(userID int, ttl time.Duration) (string, time.Time, error) {
+	raw, err := randomToken(32)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	if ttl <= 0 {
+		ttl = DefaultPasswordResetTTL
+	}
+	expires := time.Now().Add(ttl)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, reset := range m.resets {
+		if reset.userID == userID {
+			reset.used = true
+		}
+	}
+	m.resets[hashToken(raw)] = &memoryReset{userID: userID, expires: expires}
+
+	return raw, expires, nil
+}
+
+// Redeem uses up raw like PostgresPasswordResets.Redeem, a token stays valid
+// when the password could not be set
+func (m *MemoryPasswordResets) Redeem(raw, password string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	reset, ok := m.resets[hashToken(raw)]
+	if !ok || reset.used || !reset.expires.After(time.Now()) {
+		return 0, ErrResetTokenInvalid
+	}
+
+	if err := m.users.ResetPassword(reset.userID, password); err != nil {
+		return 0, err
+	}
+	reset.used = true
+
+	if m.tokens != nil {
+		m.tokens.RevokeAll(reset.userID)
+	}
+
+	return reset.userID, nil
+}
+
+// MemoryRoles is a RoleRepository kept in memory. The roles it stores are
+// defined on users, so that they can be assigned there.
+type MemoryRoles struct {
+	users *MemoryUsers
+
+	mu    sync.Mutex
+	roles map[string]*Role
+}
+
+// NewMemoryRoles returns an in-memory role store holding the built-in roles
+func NewMemoryRoles(users *MemoryUsers) *MemoryRoles {
+	now := time.Now()
+	return &MemoryRoles{
+		users: users,
+		roles: map[string]*Role{
+			RoleAdmin: {Name: RoleAdmin, Description: "Manages users and roles, passes every role check", Permissions: []string{PermissionAll}, CreatedAt: now, UpdatedAt: now},
+			RoleUser:  {Name: RoleUser, Description: "Given to every registered account", Permissions: []string{}, CreatedAt: now, UpdatedAt: now},
+		},
+	}
+}
+
+func (m *MemoryRoles) All() ([]*Role, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	roles := make([]*Role, 0, len(m.roles))
+	for _, role := range m.roles {
+		r := *role
+		roles = append(roles, &r)
+	}
+	slices.SortFunc(roles, func(a, b *Role) int { return cmp.Compare(a.Name, b.Name) })
+
+	return roles, nil
+}
+
+func (m *MemoryRoles) Get(name string) (*Role, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	role, ok := m.roles[name]
+	if !ok {
+		return nil, ErrRoleNotFound
+	}
+
+	r := *role
+	return &r, nil
+}
+
+func (m *MemoryRoles) Insert(role Role) (*Role, error) {
+	if err := role.Validate(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.roles[role.Name]; ok {
+		return nil, ErrRoleExists
+	}
+
+	now := time.Now()
+	role.Permissions = nonNil(role.Permissions)
+	role.CreatedAt, role.UpdatedAt = now, now
+	m.roles[role.Name] = &role
+	m.users.DefineRole(role.Name, role.Permissions...)
+
+	r := role
+	return &r, nil
+}
+
+func (m *MemoryRoles) Update(role Role) (*Role, error) {
+	if err := role.Validate(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.roles[role.Name]
+	if !ok {
+		return nil, ErrRoleNotFound
+	}
+
+	stored.Description, stored.Permissions = role.Description, nonNil(role.Permissions)
+	stored.UpdatedAt = time.Now()
+	m.users.DefineRole(stored.Name, stored.Permissions...)
+
+	r := *stored
+	return &r, nil
+}
+
+func (m *MemoryRoles) Delete(name string) error {
+	if name == RoleAdmin || name == RoleUser {
+		return ErrBuiltinRole
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.roles[name]; !ok {
+		return ErrRoleNotFound
+	}
+	delete(m.roles, name)
+	m.users.forgetRole(name)
+
+	return nil
+}
+
+// forgetRole removes a role and takes it from the users holding it
+func (m *MemoryUsers) forgetRole(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.permissions, name)
+	for id, roles := range m.roles {
+		m.roles[id] = slices.DeleteFunc(roles, func(r string) bool { return r == name })
+	}
+}
+
+// MemoryMailMessages is a MailMessageRepository kept in memory
+type MemoryMailMessages struct {
+	mu       sync.Mutex
+	messages map[string]*MailMessage
+	optedOut map[int]bool
+}
+
+// NewMemoryMailMessages returns an empty in-memory mail tracking store
+func NewMemoryMailMessages() *MemoryMailMessages {
+	return &MemoryMailMessages{messages: make(map[string]*MailMessage), optedOut: make(map[int]bool)}
+}
+
+func (m *MemoryMailMessages) Track(userID int, template string, links []string) (string, error) {
+	id, err := randomToken(24)
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages[id] = &MailMessage{
+		ID:        id,
+		UserID:    userID,
+		Template:  template,
+		Links:     slices.Clone(nonNil(links)),
+		CreatedAt: time.Now(),
+	}
+
+	return id, nil
+}
+
+func (m *MemoryMailMessages) Get(id string) (*MailMessage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	msg, ok := m.messages[id]
+	if !ok {
+		return nil, ErrMailMessageNotFound
+	}
+
+	c := *msg
+	return &c, nil
+}
+
+func (m *MemoryMailMessages) Link(id string, n int) (string, error) {
+	msg, err := m.Get(id)
+	if err != nil {
+		return "", err
+	}
+	if n < 0 || n >= len(msg.Links) {
+		return "", ErrMailMessageNotFound
+	}
+
+	return msg.Links[n], nil
+}
+
+func (m *MemoryMailMessages) Opened(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	msg, ok := m.messages[id]
+	if !ok {
+		return ErrMailMessageNotFound
+	}
+
+	msg.Opens++
+	if msg.FirstOpenedAt == nil {
+		now := time.Now()
+		msg.FirstOpenedAt = &now
+	}
+
+	return nil
+}
+
+func (m *MemoryMailMessages) Clicked(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	msg, ok := m.messages[id]
+	if !ok {
+		return ErrMailMessageNotFound
+	}
+
+	msg.Clicks++
+	if msg.FirstClickedAt == nil {
+		now := time.Now()
+		msg.FirstClickedAt = &now
+	}
+
+	return nil
+}
+
+func (m *MemoryMailMessages) TrackingAllowed(userID int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return !m.optedOut[userID], nil
+}
+
+func (m *MemoryMailMessages) SetTracking(userID int, allowed bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if allowed {
+		delete(m.optedOut, userID)
+	} else {
+		m.optedOut[userID] = true
+	}
+
+	return nil
+}
+
+// MemoryJobs is a JobRepository kept in memory. Start runs the job before it
+// returns, so that callers see it finished.
+type MemoryJobs struct {
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+// NewMemoryJobs returns an empty in-memory job store
+func NewMemoryJobs() *MemoryJobs {
+	return &MemoryJobs{jobs: make(map[string]*Job)}
+}
+
+func (m *MemoryJobs) Start(kind string, fn JobFunc) (*Job, error) {
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	job := &Job{ID: id, Kind: kind, Status: JobRunning, CreatedAt: now, UpdatedAt: now}
+
+	result, err := fn(context.Background(), func(percent int, message string) {
+		job.Progress, job.Message = percent, message
+	})
+
+	finished := time.Now()
+	job.UpdatedAt, job.FinishedAt = finished, &finished
+	if err != nil {
+		job.Status, job.Error = JobFailed, err.Error()
+	} else if job.Result, err = json.Marshal(result); err != nil {
+		return nil, err
+	} else {
+		job.Status, job.Progress = JobSucceeded, 100
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.jobs[id] = job
+
+	c := *job
+	return &c, nil
+}
+
+func (m *MemoryJobs) Get(id string) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+
+	c := *job
+	return &c, nil
+}
+
+// FailInterrupted has nothing to do, jobs in memory finish in Start
+func (m *MemoryJobs) FailInterrupted() error {
+	return nil
+}
+
+// MemoryMailThreads is a MailThreadRepository kept in memory
+type MemoryMailThreads struct {
+	mu      sync.Mutex
+	threads map[string]*MailThread
+	replies map[string]bool
+}
+
+// NewMemoryMailThreads returns an empty in-memory thread store
+func NewMemoryMailThreads() *MemoryMailThreads {
+	return &MemoryMailThreads{threads: make(map[string]*MailThread), replies: make(map[string]bool)}
+}
+
+func (m *MemoryMailThreads) Start(userID int, template string) (string, error) {
+	id, err := randomToken(24)
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.threads[id] = &MailThread{ID: id, UserID: userID, Template: template, CreatedAt: time.Now()}
+
+	return id, nil
+}
+
+func (m *MemoryMailThreads) Get(id string) (*MailThread, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	thread, ok := m.threads[id]
+	if !ok {
+		return nil, ErrMailThreadNotFound
+	}
+
+	c := *thread
+	return &c, nil
+}
+
+func (m *MemoryMailThreads) RecordReply(messageID string, thread *MailThread) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.replies[messageID] {
+		return false, nil
+	}
+	m.replies[messageID] = true
+
+	return true, nil
+}
+
+// MemoryMailTemplates is a MailTemplateRepository kept in memory
+type MemoryMailTemplates struct {
+	mu       sync.Mutex
+	versions map[string][]*MailTemplateVersion
+	rollouts map[string]*MailTemplateRollout
+}
+
+// NewMemoryMailTemplates returns an empty in-memory template store
+func NewMemoryMailTemplates() *MemoryMailTemplates {
+	return &MemoryMailTemplates{
+		versions: make(map[string][]*MailTemplateVersion),
+		rollouts: make(map[string]*MailTemplateRollout),
+	}
+}
+
+func (m *MemoryMailTemplates) CreateVersion(template, text, html, createdBy string) (*MailTemplateVersion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	last := 0
+	for _, v := range m.versions[template] {
+		last = max(last, v.Version)
+	}
+
+	v := &MailTemplateVersion{
+		Template:  template,
+		Version:   last + 1,
+		Text:      text,
+		HTML:      html,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now(),
+	}
+	m.versions[template] = append(m.versions[template], v)
+
+	c := *v
+	return &c, nil
+}
+
+func (m *MemoryMailTemplates) Version(template string, version int) (*MailTemplateVersion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.version(template, version)
+}
+
+// version returns a copy of a version, it expects m.mu to be held
+func (m *MemoryMailTemplates) version(template string, version int) (*MailTemplateVersion, error) {
+	for _, v := range m.versions[template] {
+		if v.Version == version {
+			c := *v
+			return &c, nil
+		}
+	}
+	return nil, ErrTemplateVersionNotFound
+}
+
+// Versions returns the versions of a template, the newest first
+func (m *MemoryMailTemplates) Versions(template string) ([]*MailTemplateVersion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	versions := make([]*MailTemplateVersion, 0, len(m.versions[template]))
+	for _, v := range m.versions[template] {
+		c := *v
+		versions = append(versions, &c)
+	}
+	slices.SortFunc(versions, func(a, b *MailTemplateVersion) int { return cmp.Compare(b.Version, a.Version) })
+
+	return versions, nil
+}
+
+func (m *MemoryMailTemplates) DeleteVersion(template string, version int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if r, ok := m.rollouts[template]; ok && (r.Stable == version || r.Candidate == version) {
+		return ErrTemplateVersionInUse
+	}
+
+	i := slices.IndexFunc(m.versions[template], func(v *MailTemplateVersion) bool { return v.Version == version })
+	if i < 0 {
+		return ErrTemplateVersionNotFound
+	}
+	m.versions[template] = slices.Delete(m.versions[template], i, i+1)
+
+	return nil
+}
+
+func (m *MemoryMailTemplates) Delete(template string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.rollouts, template)
+	if len(m.versions[template]) == 0 {
+		return ErrTemplateVersionNotFound
+	}
+	delete(m.versions, template)
+
+	return nil
+}
+
+func (m *MemoryMailTemplates) Rollout(template string) (*MailTemplateRollout, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, ok := m.rollouts[template]
+	if !ok {
+		return &MailTemplateRollout{Template: template}, nil
+	}
+
+	c := *r
+	return &c, nil
+}
+
+func (m *MemoryMailTemplates) Rollouts() ([]*MailTemplateRollout, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rollouts := make([]*MailTemplateRollout, 0, len(m.rollouts))
+	for _, r := range m.rollouts {
+		c := *r
+		rollouts = append(rollouts, &c)
+	}
+	slices.SortFunc(rollouts, func(a, b *MailTemplateRollout) int { return cmp.Compare(a.Template, b.Template) })
+
+	return rollouts, nil
+}
+
+func (m *MemoryMailTemplates) SetRollout(rollout *MailTemplateRollout) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, version := range []int{rollout.Stable, rollout.Candidate} {
+		if version == 0 {
+			continue
+		}
+		if _, err := m.version(rollout.Template, version); err != nil {
+			return err
+		}
+	}
+
+	rollout.UpdatedAt = time.Now()
+	c := *rollout
+	m.rollouts[rollout.Template] = &c
+
+	return nil
+}
@@ -0,0 +1,218 @@
+package data
+
+import (
+	"authentication/data/sqldb"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrUserNotFound is returned when a user of a merge does not exist
+var ErrUserNotFound = errors.New("user not found")
+
+// MergeResult describes what a merge changed, or would change in a dry run
+type MergeResult struct {
+	MergeID      int      `json:"merge_id,omitempty"`
+	SourceID     int      `json:"source_id"`
+	TargetID     int      `json:"target_id"`
+	SourceEmail  string   `json:"source_email"`
+	TargetEmail  string   `json:"target_email"`
+	RolesMoved   []string `json:"roles_moved"`
+	FieldsFilled []string `json:"fields_filled"`
+	Activated    bool     `json:"activated"`
+	DryRun       bool     `json:"dry_run"`
+}
+
+// UserMerge is one entry of the merge audit trail
+type UserMerge struct {
+	ID          int             `json:"id"`
+	SourceID    int             `json:"source_id"`
+	TargetID    int             `json:"target_id"`
+	SourceEmail string          `json:"source_email"`
+	TargetEmail string          `json:"target_email"`
+	Actor       string          `json:"actor"`
+	Details     json.RawMessage `json:"details"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// Merge folds the account sourceID into targetID: the roles of the source move
+// to the target, profile fields the target lacks are copied over, the target is
+// activated when either account was, and the source is deleted. Everything
+// happens in one transaction that also writes the audit record. With dryRun
+// nothing is written and the result tells what would have been done.
+func (a *PostgresUserAdmin) Merge(sourceID, targetID int, actor string, dryRun bool) (*MergeResult, error) {
+	if sourceID == targetID {
+		return nil, errors.New("a user cannot be merged into itself")
+	}
+
+	var result *MergeResult
+
+	err := a.pg.runQuery("MergeUsers", []any{sourceID, targetID, dryRun}, func(ctx context.Context, q *sqldb.Queries) error {
+		tx, err := a.pg.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		qtx := q.WithTx(tx)
+
+		source, err := getMergedUser(ctx, qtx, sourceID)
+		if err != nil {
+			return err
+		}
+		target, err := getMergedUser(ctx, qtx, targetID)
+		if err != nil {
+			return err
+		}
+
+		sourceRoles, err := qtx.GetUserRoles(ctx, source.ID)
+		if err != nil {
+			return err
+		}
+		targetRoles, err := qtx.GetUserRoles(ctx, target.ID)
+		if err != nil {
+			return err
+		}
+
+		result = planMerge(source, target, sourceRoles, targetRoles)
+		result.DryRun = dryRun
+
+		if dryRun {
+			return nil
+		}
+
+		now := time.Now()
+
+		err = qtx.MoveUserRoles(ctx, sqldb.MoveUserRolesParams{ToID: target.ID, FromID: source.ID})
+		if err != nil {
+			return err
+		}
+
+		err = qtx.DeleteUser(ctx, source.ID)
+		if err != nil {
+			return err
+		}
+
+		if len(result.FieldsFilled) > 0 || result.Activated {
+			err = qtx.UpdateUser(ctx, sqldb.UpdateUserParams{
+				Email:      target.Email,
+				FirstName:  target.FirstName,
+				LastName:   target.LastName,
+				UserActive: target.UserActive,
+				UpdatedAt:  now,
+				ID:         target.ID,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		details, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+
+		id, err := qtx.InsertUserMerge(ctx, sqldb.InsertUserMergeParams{
+			SourceID:    source.ID,
+			TargetID:    target.ID,
+			SourceEmail: source.Email,
+			TargetEmail: target.Email,
+			Actor:       actor,
+			Details:     details,
+			CreatedAt:   now,
+		})
+		if err != nil {
+			return err
+		}
+		result.MergeID = int(id)
+
+		return tx.Commit()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// planMerge works out the changes of a merge and applies the profile ones to target
+func planMerge(source, target *sqldb.User, sourceRoles, targetRoles []string) *MergeResult {
+	result := &MergeResult{
+		SourceID:     int(source.ID),
+		TargetID:     int(target.ID),
+		SourceEmail:  source.Email,
+		TargetEmail:  target.Email,
+		RolesMoved:   []string{},
+		FieldsFilled: []string{},
+	}
+
+	held := make(map[string]bool, len(targetRoles))
+	for _, role := range targetRoles {
+		held[role] = true
+	}
+	for _, role := range sourceRoles {
+		if !held[role] {
+			result.RolesMoved = append(result.RolesMoved, role)
+		}
+	}
+
+	if target.FirstName == "" && source.FirstName != "" {
+		target.FirstName = source.FirstName
+		result.FieldsFilled = append(result.FieldsFilled, "first_name")
+	}
+	if target.LastName == "" && source.LastName != "" {
+		target.LastName = source.LastName
+		result.FieldsFilled = append(result.FieldsFilled, "last_name")
+	}
+	if !target.UserActive && source.UserActive {
+		target.UserActive = true
+		result.Activated = true
+	}
+
+	return result
+}
+
+func getMergedUser(ctx context.Context, q *sqldb.Queries, id int) (*sqldb.User, error) {
+	row, err := q.GetUserByID(ctx, int32(id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %d", ErrUserNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &row, nil
+}
+
+// Merges returns the latest entries of the merge audit trail
+func (a *PostgresUserAdmin) Merges(limit int) ([]UserMerge, error) {
+	var rows []sqldb.UserMerge
+
+	err := a.pg.runQuery("ListUserMerges", []any{limit}, func(ctx context.Context, q *sqldb.Queries) error {
+		var err error
+		rows, err = q.ListUserMerges(ctx, int32(limit))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	merges := make([]UserMerge, 0, len(rows))
+	for _, row := range rows {
+		merges = append(merges, UserMerge{
+			ID:          int(row.ID),
+			SourceID:    int(row.SourceID),
+			TargetID:    int(row.TargetID),
+			SourceEmail: row.SourceEmail,
+			TargetEmail: row.TargetEmail,
+			Actor:       row.Actor,
+			Details:     row.Details,
+			CreatedAt:   row.CreatedAt,
+		})
+	}
+
+	return merges, nil
+}
@@ -1,26 +1,35 @@
 package data
 
 import (
+	"authentication/data/sqldb"
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"log"
 	"time"
 
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 )
 
 const dbTimeOut = time.Second * 3
 
-var db *sql.DB
-
 // New is the function used to create an instance of data package. It return the type
-// Model, which embeds all the types we want to be available to our application
-func New(dbPool *sql.DB) Models {
-	db = dbPool
-
+// Model, which embeds all the types we want to be available to our application,
+// all stored in pg
+func New(pg *Postgres) Models {
 	return Models{
-		User: User{},
+		User:          &PostgresUsers{pg: pg},
+		UserAdmin:     &PostgresUserAdmin{pg: pg},
+		Job:           &PostgresJobs{pg: pg},
+		RefreshToken:  &PostgresRefreshTokens{pg: pg},
+		PasswordReset: &PostgresPasswordResets{pg: pg},
+		AccountLock:   &PostgresAccountLocks{pg: pg},
+		Role:          &PostgresRoles{pg: pg},
+		MailMessage:   &PostgresMailMessages{pg: pg},
+		MailThread:    &PostgresMailThreads{pg: pg},
+		MailTemplate:  &PostgresMailTemplates{pg: pg},
 	}
 }
 
@@ -29,7 +38,143 @@ func New(dbPool *sql.DB) Models {
 // app variable is used, provided that the model is also added in the New function
 
 type Models struct {
-	User User
+	User          UserRepository
+	UserAdmin     UserAdminRepository
+	Job           JobRepository
+	RefreshToken  RefreshTokenRepository
+	PasswordReset PasswordResetRepository
+	AccountLock   AccountLockRepository
+	Role          RoleRepository
+	MailMessage   MailMessageRepository
+	MailThread    MailThreadRepository
+	MailTemplate  MailTemplateRepository
+}
+
+// UserRepository stores the user accounts and the roles they hold. PostgresUsers
+// is the one the service runs on, MemoryUsers stands in for it in tests.
+type UserRepository interface {
+	GetAll() ([]*User, error)
+	GetByEmail(email string) (*User, error)
+	GetOne(id int) (*User, error)
+	Search(query UserQuery) ([]*User, int, error)
+	Insert(user User) (int, error)
+	Update(user *User) error
+	DeleteByID(id int) error
+	ResetPassword(id int, password string) error
+
+	RolesOf(userID int) ([]string, error)
+	PermissionsOf(userID int) ([]string, error)
+	AssignRole(userID int, role string) error
+	RevokeRole(userID int, role string) error
+}
+
+// PostgresUsers is the UserRepository of the users table
+type PostgresUsers struct {
+	pg *Postgres
+}
+
+var (
+	_ UserRepository = (*PostgresUsers)(nil)
+	_ UserRepository = (*MemoryUsers)(nil)
+)
+
+// UserAdminRepository runs the admin operations that change several accounts
+// in one transaction: bulk changes, merges, group syncs and time-boxed roles.
+type UserAdminRepository interface {
+	Bulk(operation string, ids []int, role string, progress ProgressFunc) ([]BulkResult, error)
+	Merge(sourceID, targetID int, actor string, dryRun bool) (*MergeResult, error)
+	Merges(limit int) ([]UserMerge, error)
+	SyncRoles(members []GroupMembership, groupRoles map[string][]string, maxRevoke int, dryRun bool) (*RoleSyncReport, error)
+
+	RequestElevation(userID int, role, reason string, duration time.Duration, requestedBy string) (*Elevation, error)
+	GetElevation(id int) (*Elevation, error)
+	Elevations(status string, limit int) ([]*Elevation, error)
+	ApproveElevation(id int, approver string) (*Elevation, error)
+	DenyElevation(id int, approver string) (*Elevation, error)
+	RevokeElevation(id int) (*Elevation, error)
+	RevokeExpiredRoles() ([]ExpiredRole, error)
+}
+
+// PostgresUserAdmin is the UserAdminRepository of the users tables
+type PostgresUserAdmin struct {
+	pg *Postgres
+}
+
+// RefreshTokenRepository stores the refresh tokens of the sessions, see
+// RefreshToken
+type RefreshTokenRepository interface {
+	Issue(userID int, ttl time.Duration) (string, *RefreshToken, error)
+	Rotate(raw string, ttl time.Duration, allow func(userID int) error) (string, *RefreshToken, error)
+	Revoke(raw string) (int, error)
+	RevokeAll(userID int) (int, error)
+	Sessions(userID int) ([]Session, error)
+	SignIns(userID, limit int) ([]SignIn, error)
+}
+
+// PasswordResetRepository hands out and redeems the one-time tokens of the
+// forgot password flow. Only the sha256 of a token is stored.
+type PasswordResetRepository interface {
+	Issue(userID int, ttl time.Duration) (string, time.Time, error)
+	Redeem(raw, password string) (int, error)
+}
+
+// AccountLockRepository counts failed logins and locks the accounts that
+// fail too often, see ConfigureLockout
+type AccountLockRepository interface {
+	Get(userID int) (*AccountLock, error)
+	Failed(userID int, ip string) (*AccountLock, error)
+	Succeeded(userID int) error
+	Unlock(userID int) error
+	RecentFailures(userID int) ([]LoginFailures, error)
+}
+
+// RoleRepository stores the roles and their permissions
+type RoleRepository interface {
+	All() ([]*Role, error)
+	Get(name string) (*Role, error)
+	Insert(role Role) (*Role, error)
+	Update(role Role) (*Role, error)
+	Delete(name string) error
+}
+
+// MailMessageRepository stores the tracked mails and the users who opted out
+// of tracking
+type MailMessageRepository interface {
+	Track(userID int, template string, links []string) (string, error)
+	Get(id string) (*MailMessage, error)
+	Link(id string, n int) (string, error)
+	Opened(id string) error
+	Clicked(id string) error
+	TrackingAllowed(userID int) (bool, error)
+	SetTracking(userID int, allowed bool) error
+}
+
+// JobRepository stores the long running jobs callers poll, see Job
+type JobRepository interface {
+	Start(kind string, fn JobFunc) (*Job, error)
+	Get(id string) (*Job, error)
+	FailInterrupted() error
+}
+
+// MailThreadRepository stores the mails a reply can answer and the replies
+// they got
+type MailThreadRepository interface {
+	Start(userID int, template string) (string, error)
+	Get(id string) (*MailThread, error)
+	RecordReply(messageID string, thread *MailThread) (bool, error)
+}
+
+// MailTemplateRepository stores the versions of the mail templates edited
+// through the admin API and their rollouts
+type MailTemplateRepository interface {
+	CreateVersion(template, text, html, createdBy string) (*MailTemplateVersion, error)
+	Version(template string, version int) (*MailTemplateVersion, error)
+	Versions(template string) ([]*MailTemplateVersion, error)
+	DeleteVersion(template string, version int) error
+	Delete(template string) error
+	Rollout(template string) (*MailTemplateRollout, error)
+	Rollouts() ([]*MailTemplateRollout, error)
+	SetRollout(rollout *MailTemplateRollout) error
 }
 
 // User is the structure with holds one user from the database
@@ -40,81 +185,53 @@ type User struct {
 	LastName  string    `json:"last_name,omitempty"`
 	Password  string    `json:"-"`
 	Active    bool      `json:"active"`
-	CreatedAt time.Time `json:created_at`
-	UpdatedAt time.Time `json:updated_at`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Roles are the roles the user holds, loaded by GetByEmail and GetOne
+	Roles []string `json:"roles,omitempty"`
 }
 
 // get all returns a slice of all user, sorted by last name
-func (u *User) GetAll() ([]*User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeOut)
-	defer cancel()
-
-	query := `select id, email, first_name, last_name, password, user_active, created_at, updated_at
-	from users order by last_name`
+func (u *PostgresUsers) GetAll() ([]*User, error) {
+	var rows []sqldb.User
 
-	rows, err := db.QueryContext(ctx, query)
+	err := u.pg.runQuery("GetAllUsers", nil, func(ctx context.Context, q *sqldb.Queries) error {
+		var err error
+		rows, err = q.GetAllUsers(ctx)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	defer rows.Close()
-
 	var users []*User
 
-	for rows.Next() {
-		var user User
-		err := rows.Scan(
-			&user.ID,
-			&user.Email,
-			&user.FirstName,
-			&user.LastName,
-			&user.Password,
-			&user.Active,
-			&user.CreatedAt,
-			&user.UpdatedAt,
-		)
-
-		if err != nil {
-			return nil, err
-		}
-
-		users = append(users, &user)
+	for _, row := range rows {
+		users = append(users, userFromRow(row))
 	}
 	return users, nil
 }
 
 // getByEmail returns one user by email
 
-func (u *User) GetByEmail(email string) (*User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeOut)
-	defer cancel()
-
+func (u *PostgresUsers) GetByEmail(email string) (*User, error) {
 	// In ra giá trị email được truyền vào để kiểm tra
 	log.Printf("Executing GetByEmail with email: %s", email)
 
-	// Câu lệnh SQL với điều kiện lọc email
-	query := `SELECT id, email, first_name, last_name, password, user_active, created_at, updated_at 
-	          FROM users
-	          WHERE email = $1`
+	var row sqldb.User
+	var roles []string
 
-	var user User
-
-	// Thực hiện truy vấn với giá trị email
-	row := db.QueryRowContext(ctx, query, email)
-
-	// Quét dữ liệu từ kết quả trả về và ghi log trước khi quét
-	log.Printf("Query executed, scanning result for email: %s", email)
-
-	err := row.Scan(
-		&user.ID,
-		&user.Email,
-		&user.FirstName,
-		&user.LastName,
-		&user.Password,
-		&user.Active,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+	// Thực hiện truy vấn với câu lệnh đã được prepare sẵn
+	err := u.pg.runQuery("GetUserByEmail", []any{email}, func(ctx context.Context, q *sqldb.Queries) error {
+		var err error
+		row, err = q.GetUserByEmail(ctx, email)
+		if err != nil {
+			return err
+		}
+		roles, err = q.GetUserRoles(ctx, row.ID)
+		return err
+	})
 
 	// Xử lý lỗi nếu có
 	if err != nil {
@@ -128,94 +245,69 @@ func (u *User) GetByEmail(email string) (*User, error) {
 		return nil, err
 	}
 
+	user := userFromRow(row)
+	user.Roles = roles
+
 	// Ghi log nếu tìm thấy người dùng
 	log.Printf("User found with email: %s, ID: %d", user.Email, user.ID)
 
 	// Trả về người dùng nếu tìm thấy
-	return &user, nil
+	return user, nil
 }
 
 // get one user by user by id
 
-func (u *User) GetOne(id int) (*User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeOut)
-	defer cancel()
-
-	// Câu lệnh SQL có điều kiện lọc theo id
-	query := `SELECT id, email, first_name, last_name, password, user_active, created_at, updated_at 
-	          FROM users 
-	          WHERE id = $1`
-
-	var user User
+func (u *PostgresUsers) GetOne(id int) (*User, error) {
+	var row sqldb.User
+	var roles []string
 
 	// Thực hiện truy vấn với tham số id
-	row := db.QueryRowContext(ctx, query, id)
-
-	// Quét dữ liệu từ kết quả truy vấn
-	err := row.Scan(
-		&user.ID,
-		&user.Email,
-		&user.FirstName,
-		&user.LastName,
-		&user.Password,
-		&user.Active,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+	err := u.pg.runQuery("GetUserByID", []any{id}, func(ctx context.Context, q *sqldb.Queries) error {
+		var err error
+		row, err = q.GetUserByID(ctx, int32(id))
+		if err != nil {
+			return err
+		}
+		roles, err = q.GetUserRoles(ctx, row.ID)
+		return err
+	})
 
 	// Xử lý lỗi nếu có
 	if err != nil {
 		if err == sql.ErrNoRows {
 			// Trả về nil và lỗi nếu không tìm thấy người dùng
-			return nil, errors.New("no user found with that ID")
+			return nil, fmt.Errorf("%w: no user found with that ID", ErrUserNotFound)
 		}
 		return nil, err
 	}
 
 	// Trả về người dùng nếu tìm thấy
-	return &user, nil
+	user := userFromRow(row)
+	user.Roles = roles
+
+	return user, nil
 }
 
 // update updates one user in the database, using the interformation
-// stored in the receiver u
-func (u *User) Update() error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeOut)
-	defer cancel()
-
-	stmt := `update users set
-	email = $1,
-	first_name = $2,
-	last_name = $3,
-	user_active = $4,
-	updated_at = $5,
-	where id = $6
-	`
-
-	_, err := db.ExecContext(ctx, stmt,
-		u.Email,
-		u.FirstName,
-		u.LastName,
-		u.Active,
-		time.Now(),
-		u.ID,
-	)
+// stored in user
+func (u *PostgresUsers) Update(user *User) error {
+	now := time.Now()
 
-	if err != nil {
-		return err
+	err := u.pg.runQuery("UpdateUser", []any{user.Email, user.FirstName, user.LastName, user.Active, now, user.ID}, func(ctx context.Context, q *sqldb.Queries) error {
+		return q.UpdateUser(ctx, sqldb.UpdateUserParams{
+			Email:      user.Email,
+			FirstName:  user.FirstName,
+			LastName:   user.LastName,
+			UserActive: user.Active,
+			UpdatedAt:  now,
+			ID:         int32(user.ID),
+		})
+	})
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" { // unique_violation
+		return ErrEmailTaken
 	}
-
-	return nil
-}
-
-// Delete deletes one user from the database, by user.ID
-
-func (u *User) Delete() error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeOut)
-	defer cancel()
-
-	stmt := `delete from users where id = $1`
-
-	_, err := db.ExecContext(ctx, stmt, u.ID)
 	if err != nil {
 		return err
 	}
@@ -224,13 +316,10 @@ func (u *User) Delete() error {
 }
 
 // DeleteByID deletes one user from the database, by ID
-func (u *User) DeleteByID(id int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeOut)
-	defer cancel()
-
-	stmt := `delete from users where id = $1`
-
-	_, err := db.ExecContext(ctx, stmt, id)
+func (u *PostgresUsers) DeleteByID(id int) error {
+	err := u.pg.runQuery("DeleteUser", []any{id}, func(ctx context.Context, q *sqldb.Queries) error {
+		return q.DeleteUser(ctx, int32(id))
+	})
 	if err != nil {
 		return err
 	}
@@ -238,13 +327,9 @@ func (u *User) DeleteByID(id int) error {
 	return nil
 }
 
-func (u *User) Insert(user User) (int, error) {
-	// Tạo một context với timeout
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeOut)
-	defer cancel()
-
+func (u *PostgresUsers) Insert(user User) (int, error) {
 	// Hash mật khẩu người dùng với bcrypt và log lỗi nếu có
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), 12)
+	hashedPassword, err := hashPassword(user.Password)
 	if err != nil {
 		return 0, err
 	}
@@ -254,44 +339,93 @@ func (u *User) Insert(user User) (int, error) {
 
 	log.Printf("Inserting user: %s, %s, %s", user.Email, user.FirstName, user.LastName)
 
-	// Câu lệnh SQL chèn người dùng mới vào cơ sở dữ liệu
-	stmt := `insert into public.users (email, first_name, last_name, password, user_active, created_at, updated_at)
-			 values ($1, $2, $3, $4, $5, $6, $7) returning id`
-
-	var newId int
+	var newId int32
 
 	// Thực hiện câu lệnh chèn với các tham số và lấy id mới
-	err = db.QueryRowContext(ctx, stmt,
-		user.Email,
-		user.FirstName,
-		user.LastName,
-		hashedPassword,
-		user.Active,
-		now,
-		now,
-	).Scan(&newId)
+	// the user and their role are stored together, or not at all
+	err = u.pg.runQuery("InsertUser", []any{user.Email, user.FirstName, user.LastName, string(hashedPassword), user.Active, now, now}, func(ctx context.Context, q *sqldb.Queries) error {
+		tx, err := u.pg.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		qtx := q.WithTx(tx)
+
+		newId, err = qtx.InsertUser(ctx, sqldb.InsertUserParams{
+			Email:      user.Email,
+			FirstName:  user.FirstName,
+			LastName:   user.LastName,
+			Password:   string(hashedPassword),
+			UserActive: user.Active,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		})
+		if err != nil {
+			return err
+		}
 
+		// every account starts out as a plain user
+		err = qtx.AssignUserRole(ctx, sqldb.AssignUserRoleParams{
+			UserID:    newId,
+			Role:      RoleUser,
+			CreatedAt: now,
+		})
+		if err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	})
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" { // unique_violation
+		return 0, ErrEmailTaken
+	}
 	if err != nil {
 		return 0, err
 	}
 
-	return newId, nil
+	return int(newId), nil
 }
 
-// Reset password is the method we will use to change a user's password
+// Reset password is the method we will use to change a user's password.
+// The refresh tokens of the user are revoked with it, so every session has to
+// log in again with the new password.
 
-func (u *User) ResetPassword(password string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeOut)
-	defer cancel()
-
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+func (u *PostgresUsers) ResetPassword(id int, password string) error {
+	hashedPassword, err := hashPassword(password)
 	if err != nil {
 		return err
 	}
 
-	stmt := `update users set password = $1 where id = $2`
+	err = u.pg.runQuery("UpdatePassword", []any{string(hashedPassword), id}, func(ctx context.Context, q *sqldb.Queries) error {
+		tx, err := u.pg.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		qtx := q.WithTx(tx)
+
+		err = qtx.UpdatePassword(ctx, sqldb.UpdatePasswordParams{
+			Password: string(hashedPassword),
+			ID:       int32(id),
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = qtx.RevokeUserTokens(ctx, sqldb.RevokeUserTokensParams{
+			RevokedAt: sql.NullTime{Time: time.Now(), Valid: true},
+			UserID:    int32(id),
+		})
+		if err != nil {
+			return err
+		}
 
-	_, err = db.ExecContext(ctx, stmt, hashedPassword, u.ID)
+		return tx.Commit()
+	})
 	if err != nil {
 		return err
 	}
@@ -300,7 +434,7 @@ func (u *User) ResetPassword(password string) error {
 }
 
 func (u *User) PasswordMatches(plainText string) (bool, error) {
-	err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(plainText))
+	err := comparePassword(u.Password, plainText)
 	if err != nil {
 		switch {
 		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
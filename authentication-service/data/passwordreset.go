@@ -0,0 +1,133 @@
+package data
+
+import (
+	"authentication/data/sqldb"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// DefaultPasswordResetTTL is how long a mailed reset token can be used
+const DefaultPasswordResetTTL = 30 * time.Minute
+
+// ErrResetTokenInvalid is returned for reset tokens that are unknown, used or
+// expired. Callers are not told which, so tokens can not be probed.
+var ErrResetTokenInvalid = errors.New("invalid or expired password reset token")
+
+// PostgresPasswordResets is the PasswordResetRepository of the
+// password_resets table
+type PostgresPasswordResets struct {
+	pg *Postgres
+}
+
+// Issue returns a new reset token for userID, valid for ttl, and voids the
+// tokens issued to the user before
+func (p *PostgresPasswordResets) Issue(userID int, ttl time.Duration) (string, time.Time, error) {
+	raw, err := randomToken(32)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	if ttl <= 0 {
+		ttl = DefaultPasswordResetTTL
+	}
+
+	now := time.Now()
+	expires := now.Add(ttl)
+
+	err = p.pg.runQuery("InsertPasswordReset", []any{userID}, func(ctx context.Context, q *sqldb.Queries) error {
+		tx, err := p.pg.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		qtx := q.WithTx(tx)
+
+		err = qtx.VoidPasswordResets(ctx, sqldb.VoidPasswordResetsParams{
+			UsedAt: sql.NullTime{Time: now, Valid: true},
+			UserID: int32(userID),
+		})
+		if err != nil {
+			return err
+		}
+
+		err = qtx.InsertPasswordReset(ctx, sqldb.InsertPasswordResetParams{
+			UserID:    int32(userID),
+			TokenHash: hashToken(raw),
+			CreatedAt: now,
+			ExpiresAt: expires,
+		})
+		if err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return raw, expires, nil
+}
+
+// Redeem uses up a reset token to set the password of its user and returns
+// the user's id. The refresh tokens of the user are revoked with it, so every
+// session has to log in again with the new password. The password is hashed
+// first and the token is only used up with the password set: a token fails
+// with ErrHasherBusy or a database error stays valid. A token is redeemed
+// once, even when two requests race with it.
+func (p *PostgresPasswordResets) Redeem(raw, password string) (int, error) {
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		return 0, err
+	}
+
+	var userID int32
+
+	err = p.pg.runQuery("UsePasswordReset", nil, func(ctx context.Context, q *sqldb.Queries) error {
+		tx, err := p.pg.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		qtx := q.WithTx(tx)
+		now := time.Now()
+
+		userID, err = qtx.UsePasswordReset(ctx, sqldb.UsePasswordResetParams{
+			UsedAt:    sql.NullTime{Time: now, Valid: true},
+			TokenHash: hashToken(raw),
+		})
+		if err != nil {
+			return err
+		}
+
+		err = qtx.UpdatePassword(ctx, sqldb.UpdatePasswordParams{
+			Password: string(hashedPassword),
+			ID:       userID,
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = qtx.RevokeUserTokens(ctx, sqldb.RevokeUserTokensParams{
+			RevokedAt: sql.NullTime{Time: now, Valid: true},
+			UserID:    userID,
+		})
+		if err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrResetTokenInvalid
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return int(userID), nil
+}
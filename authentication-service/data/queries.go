@@ -0,0 +1,177 @@
+package data
+
+import (
+	"authentication/data/sqldb"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"log"
+	"sync"
+
+	"github.com/lib/pq"
+)
+
+// Postgres is the connection pool the models run on, with the sqlc generated
+// queries prepared against it. Regenerate them with `sqlc generate` after
+// changing data/sql.
+type Postgres struct {
+	db *sql.DB
+
+	mu    sync.RWMutex
+	stmts *statements
+
+	// preparing serializes the re-prepares, so that the callers that hit
+	// the same invalidated set prepare a new one once
+	preparing sync.Mutex
+}
+
+// statements is one prepared set of the queries. Its users are counted, a
+// set that was replaced is closed once the last of them is done with it.
+type statements struct {
+	q    *sqldb.Queries
+	refs sync.WaitGroup
+}
+
+// NewPostgres returns the store of a pool, the queries are prepared on first
+// use or by PrepareStatements
+func NewPostgres(db *sql.DB) *Postgres {
+	return &Postgres{db: db}
+}
+
+// PrepareStatements prepares every generated query against the pool
+func (p *Postgres) PrepareStatements() error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeOut)
+	defer cancel()
+
+	s, err := p.reprepare(ctx, nil)
+	if err != nil {
+		return err
+	}
+	s.refs.Done()
+
+	return nil
+}
+
+// acquire returns the prepared queries for one use, preparing them on first
+// use. The caller calls refs.Done when it is done with them.
+func (p *Postgres) acquire(ctx context.Context) (*statements, error) {
+	p.mu.RLock()
+	s := p.stmts
+	if s != nil {
+		s.refs.Add(1)
+	}
+	p.mu.RUnlock()
+
+	if s != nil {
+		return s, nil
+	}
+
+	return p.reprepare(ctx, nil)
+}
+
+// reprepare replaces the set stale with newly prepared queries and returns
+// them acquired. When stale was replaced already its replacement is returned.
+// The replaced set is closed in the background once its users are done.
+func (p *Postgres) reprepare(ctx context.Context, stale *statements) (*statements, error) {
+	p.preparing.Lock()
+	defer p.preparing.Unlock()
+
+	p.mu.Lock()
+	if s := p.stmts; s != nil && s != stale {
+		s.refs.Add(1)
+		p.mu.Unlock()
+		return s, nil
+	}
+	p.mu.Unlock()
+
+	q, err := sqldb.Prepare(ctx, p.db)
+	if err != nil {
+		return nil, err
+	}
+	next := &statements{q: q}
+	next.refs.Add(1)
+
+	p.mu.Lock()
+	old := p.stmts
+	p.stmts = next
+	p.mu.Unlock()
+
+	if old != nil {
+		go func() {
+			old.refs.Wait()
+			old.q.Close()
+		}()
+	}
+
+	return next, nil
+}
+
+// withQueries runs fn with the prepared queries. When a statement was
+// invalidated by a connection reset or a server side change the queries are
+// prepared again and fn is retried once. The errors that cause a retry are
+// raised before the failing statement ran, so fn must run its writes in a
+// single statement or in a transaction: a failed fn then wrote nothing and
+// may run again.
+func (p *Postgres) withQueries(ctx context.Context, fn func(*sqldb.Queries) error) error {
+	s, err := p.acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = fn(s.q)
+	s.refs.Done()
+
+	if !needsReprepare(err) {
+		return err
+	}
+
+	log.Println("Re-preparing statements after error:", err)
+
+	s, err = p.reprepare(ctx, s)
+	if err != nil {
+		return err
+	}
+	defer s.refs.Done()
+
+	return fn(s.q)
+}
+
+// needsReprepare reports whether an error means the prepared statement is no
+// longer usable on the server. These are all raised before the statement ran:
+// database/sql only returns driver.ErrBadConn for requests that were not sent,
+// and the server checks the statement before executing it.
+func needsReprepare(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case "26000", // invalid_sql_statement_name
+			"0A000": // feature_not_supported, e.g. cached plan must not change result type
+			return true
+		}
+	}
+
+	return false
+}
+
+// userFromRow converts a generated row into the User model
+func userFromRow(row sqldb.User) *User {
+	return &User{
+		ID:        int(row.ID),
+		Email:     row.Email,
+		FirstName: row.FirstName,
+		LastName:  row.LastName,
+		Password:  row.Password,
+		Active:    row.UserActive,
+		CreatedAt: row.CreatedAt,
+		UpdatedAt: row.UpdatedAt,
+	}
+}
@@ -0,0 +1,404 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// The properties below hold for every UserRepository. They run on MemoryUsers
+// and, when TEST_DSN points at a scratch database, on PostgresUsers:
+//
+//	TEST_DSN="host=localhost port=5432 user=postgres password=password dbname=users_test sslmode=disable" go test ./data
+
+// repositories returns the repositories to check, by name
+func repositories(t *testing.T) map[string]UserRepository {
+	repos := map[string]UserRepository{"memory": NewMemoryUsers()}
+
+	dsn := os.Getenv("TEST_DSN")
+	if dsn == "" {
+		return repos
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	pg := NewPostgres(db)
+	if err := pg.EnsureSchema(); err != nil {
+		t.Fatal(err)
+	}
+	repos["postgres"] = New(pg).User
+
+	return repos
+}
+
+// fastHashing lowers the bcrypt cost for the test, the properties hash
+// hundreds of passwords
+func fastHashing(t *testing.T) {
+	ConfigureHasher(0, 0, bcrypt.MinCost)
+	t.Cleanup(func() { ConfigureHasher(0, 0, 0) })
+}
+
+// userInput is a generated account. Emails are unique per run, so the
+// properties do not trip over each other or over rows already in Postgres.
+type userInput struct {
+	Email, FirstName, LastName, Password string
+	Active                               bool
+}
+
+var run = rand.Int63()
+
+func (userInput) Generate(r *rand.Rand, size int) reflect.Value {
+	return reflect.ValueOf(userInput{
+		Email:     fmt.Sprintf("%s.%d.%d@example.com", text(r, size), run, r.Int63()),
+		FirstName: text(r, size),
+		LastName:  text(r, size),
+		Password:  text(r, size) + "!",
+		Active:    r.Intn(2) == 0,
+	})
+}
+
+// text returns up to size printable characters, a few of them outside ASCII
+func text(r *rand.Rand, size int) string {
+	const alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789 '-éøß漢"
+
+	letters := []rune(alphabet)
+	var b strings.Builder
+	for i := r.Intn(size + 1); i > 0; i-- {
+		b.WriteRune(letters[r.Intn(len(letters))])
+	}
+	return b.String()
+}
+
+func (in userInput) user() User {
+	return User{Email: in.Email, FirstName: in.FirstName, LastName: in.LastName, Password: in.Password, Active: in.Active}
+}
+
+var quickConfig = &quick.Config{MaxCount: 50}
+
+func TestRepositoryInsertGet(t *testing.T) {
+	fastHashing(t)
+
+	for name, repo := range repositories(t) {
+		t.Run(name, func(t *testing.T) {
+			property := func(in userInput) bool {
+				id, err := repo.Insert(in.user())
+				if err != nil {
+					t.Logf("Insert: %v", err)
+					return false
+				}
+				defer repo.DeleteByID(id)
+
+				got, err := repo.GetOne(id)
+				if err != nil {
+					t.Logf("GetOne: %v", err)
+					return false
+				}
+				byEmail, err := repo.GetByEmail(in.Email)
+				if err != nil || byEmail.ID != id {
+					t.Logf("GetByEmail: %v", err)
+					return false
+				}
+
+				matches, err := got.PasswordMatches(in.Password)
+
+				return got.ID == id &&
+					got.Email == in.Email && got.FirstName == in.FirstName && got.LastName == in.LastName &&
+					got.Active == in.Active &&
+					got.Password != in.Password && matches && err == nil &&
+					reflect.DeepEqual(got.Roles, []string{RoleUser}) &&
+					!got.CreatedAt.IsZero() && got.UpdatedAt.Equal(got.CreatedAt)
+			}
+
+			if err := quick.Check(property, quickConfig); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestRepositoryUpdate(t *testing.T) {
+	fastHashing(t)
+
+	for name, repo := range repositories(t) {
+		t.Run(name, func(t *testing.T) {
+			property := func(in, change userInput) bool {
+				id, err := repo.Insert(in.user())
+				if err != nil {
+					t.Logf("Insert: %v", err)
+					return false
+				}
+				defer repo.DeleteByID(id)
+
+				before, _ := repo.GetOne(id)
+
+				updated := change.user()
+				updated.ID = id
+				if err := repo.Update(&updated); err != nil {
+					t.Logf("Update: %v", err)
+					return false
+				}
+
+				got, err := repo.GetOne(id)
+				if err != nil {
+					t.Logf("GetOne: %v", err)
+					return false
+				}
+
+				// the password is only changed by ResetPassword
+				matches, _ := got.PasswordMatches(in.Password)
+
+				return got.Email == change.Email && got.FirstName == change.FirstName && got.LastName == change.LastName &&
+					got.Active == change.Active && matches &&
+					got.CreatedAt.Equal(before.CreatedAt) && !got.UpdatedAt.Before(before.UpdatedAt)
+			}
+
+			if err := quick.Check(property, quickConfig); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestRepositoryDelete(t *testing.T) {
+	fastHashing(t)
+
+	for name, repo := range repositories(t) {
+		t.Run(name, func(t *testing.T) {
+			property := func(in userInput) bool {
+				id, err := repo.Insert(in.user())
+				if err != nil {
+					t.Logf("Insert: %v", err)
+					return false
+				}
+				if err := repo.DeleteByID(id); err != nil {
+					t.Logf("DeleteByID: %v", err)
+					return false
+				}
+
+				_, err = repo.GetOne(id)
+				_, emailErr := repo.GetByEmail(in.Email)
+				roles, _ := repo.RolesOf(id)
+
+				// the email is free again
+				again, insertErr := repo.Insert(in.user())
+				if insertErr == nil {
+					repo.DeleteByID(again)
+				}
+
+				return errors.Is(err, ErrUserNotFound) && emailErr != nil && len(roles) == 0 && insertErr == nil
+			}
+
+			if err := quick.Check(property, quickConfig); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestRepositoryUniqueEmail(t *testing.T) {
+	fastHashing(t)
+
+	for name, repo := range repositories(t) {
+		t.Run(name, func(t *testing.T) {
+			property := func(first, second userInput) bool {
+				id, err := repo.Insert(first.user())
+				if err != nil {
+					t.Logf("Insert: %v", err)
+					return false
+				}
+				defer repo.DeleteByID(id)
+
+				twin := second.user()
+				twin.Email = first.Email
+				if twinID, err := repo.Insert(twin); !errors.Is(err, ErrEmailTaken) {
+					repo.DeleteByID(twinID)
+					t.Logf("second Insert of %s: %v", first.Email, err)
+					return false
+				}
+
+				otherID, err := repo.Insert(second.user())
+				if err != nil {
+					t.Logf("Insert: %v", err)
+					return false
+				}
+				defer repo.DeleteByID(otherID)
+
+				other, _ := repo.GetOne(otherID)
+				other.Email = first.Email
+
+				return errors.Is(repo.Update(other), ErrEmailTaken)
+			}
+
+			if err := quick.Check(property, quickConfig); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestRepositoryResetPassword(t *testing.T) {
+	fastHashing(t)
+
+	for name, repo := range repositories(t) {
+		t.Run(name, func(t *testing.T) {
+			property := func(in userInput, password string) bool {
+				password += "?" // never the old one, which ends in !
+
+				id, err := repo.Insert(in.user())
+				if err != nil {
+					t.Logf("Insert: %v", err)
+					return false
+				}
+				defer repo.DeleteByID(id)
+
+				if err := repo.ResetPassword(id, password); err != nil {
+					t.Logf("ResetPassword: %v", err)
+					return false
+				}
+
+				got, err := repo.GetOne(id)
+				if err != nil {
+					return false
+				}
+
+				matchesNew, err := got.PasswordMatches(password)
+				matchesOld, _ := got.PasswordMatches(in.Password)
+
+				return matchesNew && err == nil && !matchesOld
+			}
+
+			if err := quick.Check(property, &quick.Config{MaxCount: 20, Values: func(v []reflect.Value, r *rand.Rand) {
+				v[0] = userInput{}.Generate(r, 20)
+				v[1] = reflect.ValueOf(text(r, 60))
+			}}); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// TestRepositoryOperations runs random sequences of inserts, updates and
+// deletes and checks the repository against a map of what it should hold
+func TestRepositoryOperations(t *testing.T) {
+	fastHashing(t)
+
+	for name, repo := range repositories(t) {
+		t.Run(name, func(t *testing.T) {
+			property := func(seed int64) bool {
+				r := rand.New(rand.NewSource(seed))
+				model := make(map[int]userInput)
+				defer func() {
+					for id := range model {
+						repo.DeleteByID(id)
+					}
+				}()
+
+				for step := 0; step < 30; step++ {
+					ids := make([]int, 0, len(model))
+					for id := range model {
+						ids = append(ids, id)
+					}
+
+					switch op := r.Intn(3); {
+					case op == 0 || len(ids) == 0:
+						in := userInput{}.Generate(r, 10).Interface().(userInput)
+						id, err := repo.Insert(in.user())
+						if err != nil {
+							t.Logf("step %d Insert: %v", step, err)
+							return false
+						}
+						if _, ok := model[id]; ok {
+							t.Logf("step %d: id %d handed out twice", step, id)
+							return false
+						}
+						model[id] = in
+					case op == 1:
+						id := ids[r.Intn(len(ids))]
+						in := userInput{}.Generate(r, 10).Interface().(userInput)
+						in.Password = model[id].Password
+						u := in.user()
+						u.ID = id
+						if err := repo.Update(&u); err != nil {
+							t.Logf("step %d Update: %v", step, err)
+							return false
+						}
+						model[id] = in
+					default:
+						id := ids[r.Intn(len(ids))]
+						if err := repo.DeleteByID(id); err != nil {
+							t.Logf("step %d DeleteByID: %v", step, err)
+							return false
+						}
+						delete(model, id)
+					}
+				}
+
+				all, err := repo.GetAll()
+				if err != nil {
+					t.Logf("GetAll: %v", err)
+					return false
+				}
+
+				seen := 0
+				for _, u := range all {
+					in, ok := model[u.ID]
+					if !ok {
+						continue
+					}
+					seen++
+					if u.Email != in.Email || u.FirstName != in.FirstName || u.LastName != in.LastName || u.Active != in.Active {
+						t.Logf("user %d is %+v, want %+v", u.ID, u, in)
+						return false
+					}
+				}
+				if seen != len(model) {
+					t.Logf("GetAll returned %d of the %d users", seen, len(model))
+					return false
+				}
+
+				return true
+			}
+
+			if err := quick.Check(property, &quick.Config{MaxCount: 10}); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// TestMemoryRecentFailuresOrder checks that MemoryAccountLocks orders like
+// ListLoginFailureAddresses: most failures first, then by the bytes of the
+// address, 10.0.0.2 before 100.0.0.1
+func TestMemoryRecentFailuresOrder(t *testing.T) {
+	locks := NewMemoryAccountLocks()
+	for _, ip := range []string{"100.0.0.1", "10.0.0.2", "9.0.0.1", "9.0.0.1"} {
+		if _, err := locks.Failed(1, ip); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	failures, err := locks.RecentFailures(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, f := range failures {
+		got = append(got, fmt.Sprintf("%s:%d", f.IP, f.Failures))
+	}
+	if want := []string{"9.0.0.1:2", "10.0.0.2:1", "100.0.0.1:1"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
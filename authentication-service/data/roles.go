@@ -0,0 +1,304 @@
+package data
+
+import (
+	"authentication/data/sqldb"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// built-in roles, created with the schema
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+// PermissionAll is the permission that stands for every permission
+const PermissionAll = "*"
+
+var (
+	// ErrRoleNotFound is returned for unknown role names
+	ErrRoleNotFound = errors.New("role not found")
+	// ErrRoleExists is returned when creating a role that is already there
+	ErrRoleExists = errors.New("role already exists")
+	// ErrBuiltinRole is returned when deleting admin or user
+	ErrBuiltinRole = errors.New("built-in roles can not be deleted")
+)
+
+var roleName = regexp.MustCompile(`^[a-z][a-z0-9_.:-]{0,63}$`)
+
+// Role is a named set of permissions users are given through user_roles
+type Role struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// PostgresRoles is the RoleRepository of the roles table
+type PostgresRoles struct {
+	pg *Postgres
+}
+
+// Validate checks a role before it is stored
+func (r *Role) Validate() error {
+	if !roleName.MatchString(r.Name) {
+		return fmt.Errorf("invalid role name %q, use lower case letters, digits and _.:-", r.Name)
+	}
+	for _, p := range r.Permissions {
+		if p == "" {
+			return errors.New("permissions can not be empty")
+		}
+	}
+	return nil
+}
+
+// All returns every role by name
+func (r *PostgresRoles) All() ([]*Role, error) {
+	var rows []sqldb.Role
+
+	err := r.pg.runQuery("ListRoles", nil, func(ctx context.Context, q *sqldb.Queries) error {
+		var err error
+		rows, err = q.ListRoles(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make([]*Role, 0, len(rows))
+	for _, row := range rows {
+		roles = append(roles, roleFromRow(row))
+	}
+
+	return roles, nil
+}
+
+// Get returns one role
+func (r *PostgresRoles) Get(name string) (*Role, error) {
+	var row sqldb.Role
+
+	err := r.pg.runQuery("GetRole", []any{name}, func(ctx context.Context, q *sqldb.Queries) error {
+		var err error
+		row, err = q.GetRole(ctx, name)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRoleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return roleFromRow(row), nil
+}
+
+// Insert creates a role
+func (r *PostgresRoles) Insert(role Role) (*Role, error) {
+	if err := role.Validate(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	err := r.pg.runQuery("InsertRole", []any{role.Name}, func(ctx context.Context, q *sqldb.Queries) error {
+		return q.InsertRole(ctx, sqldb.InsertRoleParams{
+			Name:        role.Name,
+			Description: role.Description,
+			Permissions: nonNil(role.Permissions),
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		})
+	})
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" { // unique_violation
+		return nil, ErrRoleExists
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Get(role.Name)
+}
+
+// Update replaces the description and permissions of a role
+func (r *PostgresRoles) Update(role Role) (*Role, error) {
+	if err := role.Validate(); err != nil {
+		return nil, err
+	}
+
+	var updated int64
+
+	err := r.pg.runQuery("UpdateRole", []any{role.Name}, func(ctx context.Context, q *sqldb.Queries) error {
+		var err error
+		updated, err = q.UpdateRole(ctx, sqldb.UpdateRoleParams{
+			Description: role.Description,
+			Permissions: nonNil(role.Permissions),
+			UpdatedAt:   time.Now(),
+			Name:        role.Name,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if updated == 0 {
+		return nil, ErrRoleNotFound
+	}
+
+	return r.Get(role.Name)
+}
+
+// Delete removes a role and takes it from the users holding it
+func (r *PostgresRoles) Delete(name string) error {
+	if name == RoleAdmin || name == RoleUser {
+		return ErrBuiltinRole
+	}
+
+	return r.pg.runQuery("DeleteRole", []any{name}, func(ctx context.Context, q *sqldb.Queries) error {
+		tx, err := r.pg.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		qtx := q.WithTx(tx)
+
+		deleted, err := qtx.DeleteRole(ctx, name)
+		if err != nil {
+			return err
+		}
+		if deleted == 0 {
+			return ErrRoleNotFound
+		}
+
+		if err := qtx.DeleteRoleAssignments(ctx, name); err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	})
+}
+
+// RolesOf returns the roles a user holds now, standing and time-boxed ones
+func (u *PostgresUsers) RolesOf(userID int) ([]string, error) {
+	var roles []string
+
+	err := u.pg.runQuery("GetUserRoles", []any{userID}, func(ctx context.Context, q *sqldb.Queries) error {
+		var err error
+		roles, err = q.GetUserRoles(ctx, int32(userID))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// PermissionsOf returns the permissions the roles of a user give
+func (u *PostgresUsers) PermissionsOf(userID int) ([]string, error) {
+	var permissions []string
+
+	err := u.pg.runQuery("GetUserPermissions", []any{userID}, func(ctx context.Context, q *sqldb.Queries) error {
+		var err error
+		permissions, err = q.GetUserPermissions(ctx, int32(userID))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// AssignRole gives a user a standing role, which must exist
+func (u *PostgresUsers) AssignRole(userID int, role string) error {
+	return u.pg.runQuery("AssignUserRole", []any{userID, role}, func(ctx context.Context, q *sqldb.Queries) error {
+		if _, err := q.GetRole(ctx, role); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("%w: %s", ErrRoleNotFound, role)
+			}
+			return err
+		}
+
+		if _, err := q.GetUserByID(ctx, int32(userID)); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("%w: %d", ErrUserNotFound, userID)
+			}
+			return err
+		}
+
+		return q.AssignUserRole(ctx, sqldb.AssignUserRoleParams{
+			UserID:    int32(userID),
+			Role:      role,
+			CreatedAt: time.Now(),
+		})
+	})
+}
+
+// RevokeRole takes a role from a user, standing or time-boxed
+func (u *PostgresUsers) RevokeRole(userID int, role string) error {
+	var revoked int64
+
+	err := u.pg.runQuery("RevokeUserRole", []any{userID, role}, func(ctx context.Context, q *sqldb.Queries) error {
+		var err error
+		revoked, err = q.RevokeUserRole(ctx, sqldb.RevokeUserRoleParams{
+			UserID: int32(userID),
+			Role:   role,
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if revoked == 0 {
+		return fmt.Errorf("%w: user %d does not hold %s", ErrRoleNotFound, userID, role)
+	}
+
+	return nil
+}
+
+// HasRole tells if roles holds one of want. Admins pass every role check.
+func HasRole(roles []string, want ...string) bool {
+	if slices.Contains(roles, RoleAdmin) {
+		return true
+	}
+	for _, role := range want {
+		if slices.Contains(roles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermission tells if permissions include want, directly or through "*"
+func HasPermission(permissions []string, want string) bool {
+	return slices.Contains(permissions, PermissionAll) || slices.Contains(permissions, want)
+}
+
+func roleFromRow(row sqldb.Role) *Role {
+	return &Role{
+		Name:        row.Name,
+		Description: row.Description,
+		Permissions: nonNil(row.Permissions),
+		CreatedAt:   row.CreatedAt,
+		UpdatedAt:   row.UpdatedAt,
+	}
+}
+
+// nonNil returns an empty list for nil, text[] columns are NOT NULL
+func nonNil(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
@@ -0,0 +1,206 @@
+package data
+
+import (
+	"authentication/data/sqldb"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrRoleSyncGuard is returned when a sync would revoke more roles than
+// allowed, which usually means the membership it was given is incomplete
+var ErrRoleSyncGuard = errors.New("role sync would revoke too many roles")
+
+// GroupMembership is the groups of one account in an external directory
+type GroupMembership struct {
+	Email  string   `json:"email"`
+	Groups []string `json:"groups"`
+}
+
+// RoleSyncChange is a role a sync assigned or revoked
+type RoleSyncChange struct {
+	UserID int    `json:"user_id"`
+	Email  string `json:"email"`
+	Role   string `json:"role"`
+}
+
+// RoleSyncReport is the diff a sync applied, or would apply in a dry run.
+// UnknownUsers are members without an account here, UnmappedGroups the
+// groups of members no role is mapped to; neither is an error.
+type RoleSyncReport struct {
+	DryRun         bool             `json:"dry_run"`
+	Assigned       []RoleSyncChange `json:"assigned"`
+	Revoked        []RoleSyncChange `json:"revoked"`
+	Unchanged      int              `json:"unchanged"`
+	UnknownUsers   []string         `json:"unknown_users"`
+	UnmappedGroups []string         `json:"unmapped_groups"`
+}
+
+// SyncRoles reconciles the standing roles groupRoles maps groups to with the
+// members of those groups. Only mapped roles are managed: members of a mapped
+// group get its roles and accounts holding a managed role outside of every
+// group mapped to it lose it. Time-boxed roles and roles no group maps to are
+// left alone, so are accounts the directory does not know, which keep nothing
+// managed. members must list the whole directory; with maxRevoke above zero a
+// sync revoking more roles fails with ErrRoleSyncGuard instead of applying.
+// Syncs run one at a time.
+func (a *PostgresUserAdmin) SyncRoles(members []GroupMembership, groupRoles map[string][]string, maxRevoke int, dryRun bool) (*RoleSyncReport, error) {
+	managed := managedRoles(groupRoles)
+	report := &RoleSyncReport{DryRun: dryRun}
+
+	err := a.pg.runQuery("SyncRoles", []any{len(members), len(managed), dryRun}, func(ctx context.Context, q *sqldb.Queries) error {
+		tx, err := a.pg.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		qtx := q.WithTx(tx)
+
+		if err := qtx.LockRoleSync(ctx); err != nil {
+			return err
+		}
+
+		for _, role := range managed {
+			if _, err := qtx.GetRole(ctx, role); err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					return fmt.Errorf("%w: %s", ErrRoleNotFound, role)
+				}
+				return err
+			}
+		}
+
+		emails := make([]string, 0, len(members))
+		for _, m := range members {
+			emails = append(emails, strings.ToLower(m.Email))
+		}
+
+		accounts, err := qtx.GetUserIDsByEmails(ctx, emails)
+		if err != nil {
+			return err
+		}
+		ids := make(map[string]RoleSyncChange, len(accounts))
+		for _, account := range accounts {
+			ids[strings.ToLower(account.Email)] = RoleSyncChange{UserID: int(account.ID), Email: account.Email}
+		}
+
+		// the roles every account should hold, keyed by user and role
+		want := make(map[[2]any]RoleSyncChange)
+		unmapped := make(map[string]bool)
+
+		for _, m := range members {
+			account, ok := ids[strings.ToLower(m.Email)]
+			if !ok {
+				report.UnknownUsers = append(report.UnknownUsers, m.Email)
+				continue
+			}
+
+			for _, group := range m.Groups {
+				roles, ok := groupRoles[group]
+				if !ok {
+					unmapped[group] = true
+					continue
+				}
+				for _, role := range roles {
+					change := account
+					change.Role = role
+					want[[2]any{change.UserID, role}] = change
+				}
+			}
+		}
+
+		held, err := qtx.ListStandingRoleHolders(ctx, managed)
+		if err != nil {
+			return err
+		}
+
+		for _, row := range held {
+			key := [2]any{int(row.UserID), row.Role}
+			if _, ok := want[key]; ok {
+				delete(want, key)
+				report.Unchanged++
+				continue
+			}
+			report.Revoked = append(report.Revoked, RoleSyncChange{UserID: int(row.UserID), Email: row.Email, Role: row.Role})
+		}
+
+		for _, change := range want {
+			report.Assigned = append(report.Assigned, change)
+		}
+		sortRoleSyncChanges(report.Assigned)
+
+		for group := range unmapped {
+			report.UnmappedGroups = append(report.UnmappedGroups, group)
+		}
+		sort.Strings(report.UnmappedGroups)
+
+		if dryRun {
+			return nil
+		}
+
+		if maxRevoke > 0 && len(report.Revoked) > maxRevoke {
+			return fmt.Errorf("%w: %d revocations, at most %d are allowed", ErrRoleSyncGuard, len(report.Revoked), maxRevoke)
+		}
+
+		now := time.Now()
+
+		for _, change := range report.Assigned {
+			err := qtx.AssignUserRole(ctx, sqldb.AssignUserRoleParams{
+				UserID:    int32(change.UserID),
+				Role:      change.Role,
+				CreatedAt: now,
+			})
+			if err != nil {
+				return fmt.Errorf("assigning %s to user %d: %w", change.Role, change.UserID, err)
+			}
+		}
+
+		for _, change := range report.Revoked {
+			err := qtx.RevokeStandingUserRole(ctx, sqldb.RevokeStandingUserRoleParams{
+				UserID: int32(change.UserID),
+				Role:   change.Role,
+			})
+			if err != nil {
+				return fmt.Errorf("revoking %s from user %d: %w", change.Role, change.UserID, err)
+			}
+		}
+
+		return tx.Commit()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// managedRoles returns the roles groupRoles maps to, sorted
+func managedRoles(groupRoles map[string][]string) []string {
+	seen := make(map[string]bool)
+	for _, roles := range groupRoles {
+		for _, role := range roles {
+			seen[role] = true
+		}
+	}
+
+	managed := make([]string, 0, len(seen))
+	for role := range seen {
+		managed = append(managed, role)
+	}
+	sort.Strings(managed)
+
+	return managed
+}
+
+func sortRoleSyncChanges(changes []RoleSyncChange) {
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].UserID != changes[j].UserID {
+			return changes[i].UserID < changes[j].UserID
+		}
+		return changes[i].Role < changes[j].Role
+	})
+}
@@ -0,0 +1,21 @@
+package data
+
+import (
+	"context"
+	_ "embed"
+)
+
+// schema creates the tables that do not exist yet, it is safe to run on every start
+//
+//go:embed sql/schema.sql
+var schema string
+
+// EnsureSchema creates missing tables. It has to run before PrepareStatements,
+// which fails for queries on tables that do not exist.
+func (p *Postgres) EnsureSchema() error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeOut)
+	defer cancel()
+
+	_, err := p.db.ExecContext(ctx, schema)
+	return err
+}
@@ -0,0 +1,375 @@
+-- name: GetAllUsers :many
+SELECT id, email, first_name, last_name, password, user_active, created_at, updated_at
+FROM users
+ORDER BY last_name;
+
+-- name: GetUserByEmail :one
+SELECT id, email, first_name, last_name, password, user_active, created_at, updated_at
+FROM users
+WHERE email = $1;
+
+-- name: GetUserByID :one
+SELECT id, email, first_name, last_name, password, user_active, created_at, updated_at
+FROM users
+WHERE id = $1;
+
+-- name: InsertUser :one
+INSERT INTO public.users (email, first_name, last_name, password, user_active, created_at, updated_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id;
+
+-- name: UpdateUser :exec
+UPDATE users SET
+    email = $1,
+    first_name = $2,
+    last_name = $3,
+    user_active = $4,
+    updated_at = $5
+WHERE id = $6;
+
+-- name: DeleteUser :exec
+DELETE FROM users WHERE id = $1;
+
+-- name: UpdatePassword :exec
+UPDATE users SET password = $1 WHERE id = $2;
+
+-- name: SetUserActive :exec
+UPDATE users SET user_active = $1, updated_at = $2 WHERE id = $3;
+
+-- name: AssignUserRole :exec
+INSERT INTO user_roles (user_id, role, created_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, role) DO UPDATE SET expires_at = NULL;
+
+-- name: GetUserRoles :many
+SELECT role FROM user_roles
+WHERE user_id = $1 AND (expires_at IS NULL OR expires_at > now())
+ORDER BY role;
+
+-- name: GrantUserRoleUntil :exec
+INSERT INTO user_roles (user_id, role, created_at, expires_at)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (user_id, role) DO UPDATE SET expires_at = EXCLUDED.expires_at
+WHERE user_roles.expires_at IS NOT NULL AND user_roles.expires_at < EXCLUDED.expires_at;
+
+-- name: RevokeTimedUserRole :exec
+DELETE FROM user_roles WHERE user_id = $1 AND role = $2 AND expires_at IS NOT NULL;
+
+-- name: RevokeStandingUserRole :exec
+DELETE FROM user_roles WHERE user_id = $1 AND role = $2 AND expires_at IS NULL;
+
+-- name: ListStandingRoleHolders :many
+SELECT user_roles.user_id, users.email, user_roles.role
+FROM user_roles
+JOIN users ON users.id = user_roles.user_id
+WHERE user_roles.role = ANY(sqlc.arg(roles)::text[]) AND user_roles.expires_at IS NULL
+ORDER BY user_roles.user_id, user_roles.role;
+
+-- name: GetUserIDsByEmails :many
+SELECT id, email FROM users WHERE lower(email) = ANY(sqlc.arg(emails)::text[]);
+
+-- name: LockRoleSync :exec
+SELECT pg_advisory_xact_lock(7261);
+
+-- name: DeleteExpiredUserRoles :many
+DELETE FROM user_roles WHERE expires_at <= $1
+RETURNING user_id, role;
+
+-- name: MoveUserRoles :exec
+UPDATE user_roles SET user_id = sqlc.arg(to_id)
+WHERE user_id = sqlc.arg(from_id)
+  AND role NOT IN (SELECT target.role FROM user_roles AS target WHERE target.user_id = sqlc.arg(to_id));
+
+-- name: InsertUserMerge :one
+INSERT INTO user_merges (source_id, target_id, source_email, target_email, actor, details, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id;
+
+-- name: ListUserMerges :many
+SELECT id, source_id, target_id, source_email, target_email, actor, details, created_at
+FROM user_merges
+ORDER BY id DESC
+LIMIT $1;
+
+-- name: InsertJob :exec
+INSERT INTO jobs (id, kind, status, created_at, updated_at)
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: UpdateJobProgress :exec
+UPDATE jobs SET status = $1, progress = $2, message = $3, updated_at = $4 WHERE id = $5;
+
+-- name: FinishJob :exec
+UPDATE jobs SET status = $1, progress = $2, result = $3, error = $4, updated_at = $5, finished_at = $5 WHERE id = $6;
+
+-- name: GetJob :one
+SELECT id, kind, status, progress, message, result, error, created_at, updated_at, finished_at
+FROM jobs
+WHERE id = $1;
+
+-- name: TouchJob :exec
+UPDATE jobs SET updated_at = $1 WHERE id = $2 AND status = 'running';
+
+-- name: FailUnfinishedJobs :exec
+UPDATE jobs SET status = 'failed', error = sqlc.arg(error), updated_at = sqlc.arg(updated_at), finished_at = sqlc.arg(updated_at)
+WHERE status IN ('queued', 'running') AND updated_at < sqlc.arg(stale_before);
+
+-- name: InsertRoleElevation :one
+INSERT INTO role_elevations (user_id, role, reason, duration_seconds, status, requested_by, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id;
+
+-- name: GetRoleElevation :one
+SELECT id, user_id, role, reason, duration_seconds, status, requested_by, decided_by, created_at, decided_at, expires_at
+FROM role_elevations
+WHERE id = $1;
+
+-- name: ListRoleElevations :many
+SELECT id, user_id, role, reason, duration_seconds, status, requested_by, decided_by, created_at, decided_at, expires_at
+FROM role_elevations
+WHERE sqlc.arg(status)::text = '' OR status = sqlc.arg(status)
+ORDER BY id DESC
+LIMIT sqlc.arg(max_rows);
+
+-- name: DecideRoleElevation :execrows
+UPDATE role_elevations SET status = $1, decided_by = $2, decided_at = $3, expires_at = $4
+WHERE id = $5 AND status = 'pending';
+
+-- name: SetRoleElevationStatus :execrows
+UPDATE role_elevations SET status = sqlc.arg(status)
+WHERE id = sqlc.arg(id) AND status = sqlc.arg(from_status);
+
+-- name: ExpireRoleElevations :exec
+UPDATE role_elevations SET status = 'expired'
+WHERE status = 'approved' AND expires_at <= $1;
+
+-- name: InsertToken :exec
+INSERT INTO tokens (user_id, token_hash, family, created_at, expires_at)
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: GetTokenByHash :one
+SELECT id, user_id, token_hash, family, created_at, expires_at, used_at, revoked_at
+FROM tokens
+WHERE token_hash = $1;
+
+-- name: UseToken :execrows
+UPDATE tokens SET used_at = $1
+WHERE id = $2 AND used_at IS NULL AND revoked_at IS NULL;
+
+-- name: RevokeTokenFamily :exec
+UPDATE tokens SET revoked_at = $1
+WHERE family = $2 AND revoked_at IS NULL;
+
+-- name: RevokeUserTokens :execrows
+UPDATE tokens SET revoked_at = $1
+WHERE user_id = $2 AND revoked_at IS NULL;
+
+-- name: ListUserSessions :many
+SELECT family, min(created_at)::timestamp AS signed_in_at, max(created_at)::timestamp AS refreshed_at, max(expires_at)::timestamp AS expires_at
+FROM tokens
+WHERE user_id = $1
+GROUP BY family
+HAVING bool_or(used_at IS NULL AND revoked_at IS NULL AND expires_at > $2)
+ORDER BY refreshed_at DESC;
+
+-- name: ListUserSignIns :many
+SELECT family, min(created_at)::timestamp AS signed_in_at,
+    bool_or(used_at IS NULL AND revoked_at IS NULL AND expires_at > $2)::boolean AS active
+FROM tokens
+WHERE user_id = $1
+GROUP BY family
+ORDER BY signed_in_at DESC
+LIMIT $3;
+
+-- name: ListRoles :many
+SELECT name, description, permissions, created_at, updated_at
+FROM roles
+ORDER BY name;
+
+-- name: GetRole :one
+SELECT name, description, permissions, created_at, updated_at
+FROM roles
+WHERE name = $1;
+
+-- name: InsertRole :exec
+INSERT INTO roles (name, description, permissions, created_at, updated_at)
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: UpdateRole :execrows
+UPDATE roles SET description = $1, permissions = $2, updated_at = $3
+WHERE name = $4;
+
+-- name: DeleteRole :execrows
+DELETE FROM roles WHERE name = $1;
+
+-- name: DeleteRoleAssignments :exec
+DELETE FROM user_roles WHERE role = $1;
+
+-- name: RevokeUserRole :execrows
+DELETE FROM user_roles WHERE user_id = $1 AND role = $2;
+
+-- name: GetUserPermissions :many
+SELECT DISTINCT unnest(roles.permissions)::text AS permission
+FROM user_roles
+JOIN roles ON roles.name = user_roles.role
+WHERE user_roles.user_id = $1 AND (user_roles.expires_at IS NULL OR user_roles.expires_at > now())
+ORDER BY permission;
+
+-- name: InsertPasswordReset :exec
+INSERT INTO password_resets (user_id, token_hash, created_at, expires_at)
+VALUES ($1, $2, $3, $4);
+
+-- name: VoidPasswordResets :exec
+UPDATE password_resets SET used_at = $1
+WHERE user_id = $2 AND used_at IS NULL;
+
+-- name: UsePasswordReset :one
+UPDATE password_resets SET used_at = sqlc.arg(used_at)
+WHERE token_hash = sqlc.arg(token_hash) AND used_at IS NULL AND expires_at > sqlc.arg(used_at)
+RETURNING user_id;
+
+-- name: InsertLoginFailure :exec
+INSERT INTO login_failures (user_id, ip, created_at)
+VALUES ($1, $2, $3);
+
+-- name: DeleteLoginFailuresBefore :exec
+DELETE FROM login_failures WHERE user_id = $1 AND created_at < $2;
+
+-- name: CountLoginFailures :one
+SELECT count(*) FROM login_failures
+WHERE user_id = $1 AND created_at >= $2;
+
+-- name: ListLoginFailureAddresses :many
+SELECT ip, count(*) AS failures, max(created_at)::timestamp AS last_failed_at
+FROM login_failures
+WHERE user_id = $1 AND created_at >= $2
+GROUP BY ip
+ORDER BY failures DESC, ip COLLATE "C";
+
+-- name: ClearLoginFailures :exec
+DELETE FROM login_failures WHERE user_id = $1;
+
+-- name: LockAccount :exec
+INSERT INTO account_locks (user_id, locked_until, failures, created_at)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (user_id) DO UPDATE
+SET locked_until = EXCLUDED.locked_until, failures = EXCLUDED.failures, created_at = EXCLUDED.created_at;
+
+-- name: GetAccountLock :one
+SELECT user_id, locked_until, failures, created_at
+FROM account_locks
+WHERE user_id = $1;
+
+-- name: DeleteAccountLock :execrows
+DELETE FROM account_locks WHERE user_id = $1;
+
+-- name: SearchUsers :many
+SELECT id, email, first_name, last_name, password, user_active, created_at, updated_at,
+    count(*) OVER () AS total
+FROM users
+WHERE NOT EXISTS (
+        SELECT 1 FROM unnest(sqlc.arg(terms)::text[]) AS term
+        WHERE (email || ' ' || first_name || ' ' || last_name) NOT ILIKE '%' || term || '%'
+    )
+    AND (sqlc.narg(active)::boolean IS NULL OR user_active = sqlc.narg(active))
+ORDER BY
+    CASE WHEN NOT sqlc.arg(descending)::boolean THEN
+        CASE sqlc.arg(sort)::text WHEN 'email' THEN email WHEN 'first_name' THEN first_name WHEN 'last_name' THEN last_name END
+    END ASC,
+    CASE WHEN sqlc.arg(descending) THEN
+        CASE sqlc.arg(sort) WHEN 'email' THEN email WHEN 'first_name' THEN first_name WHEN 'last_name' THEN last_name END
+    END DESC,
+    CASE WHEN NOT sqlc.arg(descending) THEN
+        CASE sqlc.arg(sort) WHEN 'created_at' THEN created_at WHEN 'updated_at' THEN updated_at END
+    END ASC,
+    CASE WHEN sqlc.arg(descending) THEN
+        CASE sqlc.arg(sort) WHEN 'created_at' THEN created_at WHEN 'updated_at' THEN updated_at END
+    END DESC,
+    CASE WHEN sqlc.arg(descending) AND sqlc.arg(sort) = 'id' THEN id END DESC,
+    id ASC
+LIMIT sqlc.arg(row_limit) OFFSET sqlc.arg(row_offset);
+
+-- name: InsertMailMessage :exec
+INSERT INTO mail_messages (id, user_id, template, links, created_at)
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: GetMailMessage :one
+SELECT id, user_id, template, links, opens, clicks, created_at, first_opened_at, first_clicked_at
+FROM mail_messages
+WHERE id = $1;
+
+-- name: RecordMailOpen :execrows
+UPDATE mail_messages SET opens = opens + 1, first_opened_at = COALESCE(first_opened_at, sqlc.arg(opened_at)::timestamp)
+WHERE id = sqlc.arg(id);
+
+-- name: RecordMailClick :execrows
+UPDATE mail_messages SET clicks = clicks + 1, first_clicked_at = COALESCE(first_clicked_at, sqlc.arg(clicked_at)::timestamp)
+WHERE id = sqlc.arg(id);
+
+-- name: MailTrackingOptedOut :one
+SELECT EXISTS (SELECT 1 FROM mail_tracking_optouts WHERE user_id = $1) AS opted_out;
+
+-- name: InsertMailTrackingOptOut :exec
+INSERT INTO mail_tracking_optouts (user_id, created_at)
+VALUES ($1, $2)
+ON CONFLICT (user_id) DO NOTHING;
+
+-- name: DeleteMailTrackingOptOut :exec
+DELETE FROM mail_tracking_optouts WHERE user_id = $1;
+
+-- name: InsertMailThread :exec
+INSERT INTO mail_threads (id, user_id, template, created_at)
+VALUES ($1, $2, $3, $4);
+
+-- name: GetMailThread :one
+SELECT id, user_id, template, created_at
+FROM mail_threads
+WHERE id = $1;
+
+-- name: InsertMailReply :execrows
+INSERT INTO mail_replies (message_id, thread_id, user_id, received_at)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (message_id) DO NOTHING;
+
+-- name: InsertMailTemplateVersion :one
+INSERT INTO mail_template_versions (template, version, text_body, html_body, created_by, created_at)
+SELECT sqlc.arg(template), COALESCE(MAX(version), 0) + 1, sqlc.arg(text_body), sqlc.arg(html_body), sqlc.arg(created_by), sqlc.arg(created_at)
+FROM mail_template_versions
+WHERE template = sqlc.arg(template)
+RETURNING template, version, text_body, html_body, created_by, created_at;
+
+-- name: GetMailTemplateVersion :one
+SELECT template, version, text_body, html_body, created_by, created_at
+FROM mail_template_versions
+WHERE template = $1 AND version = $2;
+
+-- name: ListMailTemplateVersions :many
+SELECT template, version, text_body, html_body, created_by, created_at
+FROM mail_template_versions
+WHERE template = $1
+ORDER BY version DESC;
+
+-- name: DeleteMailTemplateVersion :execrows
+DELETE FROM mail_template_versions WHERE template = $1 AND version = $2;
+
+-- name: DeleteMailTemplateVersions :execrows
+DELETE FROM mail_template_versions WHERE template = $1;
+
+-- name: GetMailTemplateRollout :one
+SELECT template, stable_version, candidate_version, percent, updated_at
+FROM mail_template_rollouts
+WHERE template = $1;
+
+-- name: ListMailTemplateRollouts :many
+SELECT template, stable_version, candidate_version, percent, updated_at
+FROM mail_template_rollouts
+ORDER BY template;
+
+-- name: UpsertMailTemplateRollout :exec
+INSERT INTO mail_template_rollouts (template, stable_version, candidate_version, percent, updated_at)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (template) DO UPDATE
+SET stable_version = EXCLUDED.stable_version, candidate_version = EXCLUDED.candidate_version,
+    percent = EXCLUDED.percent, updated_at = EXCLUDED.updated_at;
+
+-- name: DeleteMailTemplateRollout :exec
+DELETE FROM mail_template_rollouts WHERE template = $1;
@@ -0,0 +1,199 @@
+-- users holds one row per registered account
+CREATE TABLE IF NOT EXISTS public.users (
+    id          serial PRIMARY KEY,
+    email       character varying(255) NOT NULL UNIQUE,
+    first_name  character varying(255) NOT NULL DEFAULT '',
+    last_name   character varying(255) NOT NULL DEFAULT '',
+    password    character varying(60) NOT NULL,
+    user_active boolean NOT NULL DEFAULT false,
+    created_at  timestamp without time zone NOT NULL DEFAULT now(),
+    updated_at  timestamp without time zone NOT NULL DEFAULT now()
+);
+
+-- user_roles assigns roles to accounts, a user can hold several
+CREATE TABLE IF NOT EXISTS public.user_roles (
+    user_id    integer NOT NULL REFERENCES public.users (id) ON DELETE CASCADE,
+    role       character varying(64) NOT NULL,
+    created_at timestamp without time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, role)
+);
+
+-- roles granted for a limited time expire at expires_at, standing ones never
+ALTER TABLE public.user_roles ADD COLUMN IF NOT EXISTS expires_at timestamp without time zone;
+
+-- role_elevations are requests for a time-boxed role, which another admin
+-- approves or denies. Approved ones grant the role until expires_at.
+CREATE TABLE IF NOT EXISTS public.role_elevations (
+    id               serial PRIMARY KEY,
+    user_id          integer NOT NULL REFERENCES public.users (id) ON DELETE CASCADE,
+    role             character varying(64) NOT NULL,
+    reason           text NOT NULL,
+    duration_seconds integer NOT NULL,
+    status           character varying(16) NOT NULL,
+    requested_by     character varying(255) NOT NULL,
+    decided_by       character varying(255) NOT NULL DEFAULT '',
+    created_at       timestamp without time zone NOT NULL DEFAULT now(),
+    decided_at       timestamp without time zone,
+    expires_at       timestamp without time zone
+);
+
+-- jobs tracks long running operations that callers poll with GET /jobs/{id}
+CREATE TABLE IF NOT EXISTS public.jobs (
+    id          character varying(64) PRIMARY KEY,
+    kind        character varying(64) NOT NULL,
+    status      character varying(16) NOT NULL,
+    progress    integer NOT NULL DEFAULT 0,
+    message     text NOT NULL DEFAULT '',
+    result      jsonb NOT NULL DEFAULT 'null',
+    error       text NOT NULL DEFAULT '',
+    created_at  timestamp without time zone NOT NULL DEFAULT now(),
+    updated_at  timestamp without time zone NOT NULL DEFAULT now(),
+    finished_at timestamp without time zone
+);
+
+-- user_merges is the audit trail of accounts merged into another one. The
+-- source account is gone after a merge, so neither id is a foreign key.
+CREATE TABLE IF NOT EXISTS public.user_merges (
+    id           serial PRIMARY KEY,
+    source_id    integer NOT NULL,
+    target_id    integer NOT NULL,
+    source_email character varying(255) NOT NULL,
+    target_email character varying(255) NOT NULL,
+    actor        character varying(255) NOT NULL,
+    details      jsonb NOT NULL DEFAULT '{}',
+    created_at   timestamp without time zone NOT NULL DEFAULT now()
+);
+
+-- tokens holds the refresh tokens handed out at login, by the sha256 of the
+-- token so that a leaked table can not be replayed. Each use rotates the token
+-- into a new one of the same family; a rotated token used again revokes the
+-- family, as one of its holders must have stolen it.
+CREATE TABLE IF NOT EXISTS public.tokens (
+    id          serial PRIMARY KEY,
+    user_id     integer NOT NULL REFERENCES public.users (id) ON DELETE CASCADE,
+    token_hash  character(64) NOT NULL UNIQUE,
+    family      character varying(64) NOT NULL,
+    created_at  timestamp without time zone NOT NULL DEFAULT now(),
+    expires_at  timestamp without time zone NOT NULL,
+    used_at     timestamp without time zone,
+    revoked_at  timestamp without time zone
+);
+
+CREATE INDEX IF NOT EXISTS tokens_user_id_idx ON public.tokens (user_id);
+CREATE INDEX IF NOT EXISTS tokens_family_idx ON public.tokens (family);
+
+-- roles lists the roles accounts can hold and what they allow. user_roles does
+-- not reference it, so elevations of ad hoc roles keep working; such roles
+-- simply grant no permission.
+CREATE TABLE IF NOT EXISTS public.roles (
+    name        character varying(64) PRIMARY KEY,
+    description text NOT NULL DEFAULT '',
+    permissions text[] NOT NULL DEFAULT '{}',
+    created_at  timestamp without time zone NOT NULL DEFAULT now(),
+    updated_at  timestamp without time zone NOT NULL DEFAULT now()
+);
+
+INSERT INTO public.roles (name, description, permissions) VALUES
+    ('admin', 'Manages users and roles, passes every role check', '{*}'),
+    ('user', 'Given to every registered account', '{}')
+ON CONFLICT (name) DO NOTHING;
+
+-- password_resets holds the one-time tokens mailed by POST /password/forgot,
+-- by their sha256. A token is used once; asking for a new one voids the
+-- tokens handed out before.
+CREATE TABLE IF NOT EXISTS public.password_resets (
+    id          serial PRIMARY KEY,
+    user_id     integer NOT NULL REFERENCES public.users (id) ON DELETE CASCADE,
+    token_hash  character(64) NOT NULL UNIQUE,
+    created_at  timestamp without time zone NOT NULL DEFAULT now(),
+    expires_at  timestamp without time zone NOT NULL,
+    used_at     timestamp without time zone
+);
+
+CREATE INDEX IF NOT EXISTS password_resets_user_id_idx ON public.password_resets (user_id);
+
+-- login_failures holds the failed logins of existing accounts and the address
+-- they came from. Failures older than the lockout window are deleted as new
+-- ones come in.
+CREATE TABLE IF NOT EXISTS public.login_failures (
+    id          serial PRIMARY KEY,
+    user_id     integer NOT NULL REFERENCES public.users (id) ON DELETE CASCADE,
+    ip          text NOT NULL,
+    created_at  timestamp without time zone NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS login_failures_user_id_idx ON public.login_failures (user_id, created_at);
+
+-- account_locks holds the accounts locked after too many failed logins. A lock
+-- ends at locked_until or when an admin deletes it.
+CREATE TABLE IF NOT EXISTS public.account_locks (
+    user_id      integer PRIMARY KEY REFERENCES public.users (id) ON DELETE CASCADE,
+    locked_until timestamp without time zone NOT NULL,
+    failures     integer NOT NULL,
+    created_at   timestamp without time zone NOT NULL DEFAULT now()
+);
+
+-- mail_messages holds the tracked mails: how often they were opened and their
+-- links followed. links are the targets of the wrapped links, by position, so
+-- the redirect endpoint only sends clients to addresses the service mailed.
+CREATE TABLE IF NOT EXISTS public.mail_messages (
+    id               character(32) PRIMARY KEY,
+    user_id          integer REFERENCES public.users (id) ON DELETE CASCADE,
+    template         text NOT NULL,
+    links            text[] NOT NULL DEFAULT '{}',
+    opens            integer NOT NULL DEFAULT 0,
+    clicks           integer NOT NULL DEFAULT 0,
+    created_at       timestamp without time zone NOT NULL DEFAULT now(),
+    first_opened_at  timestamp without time zone,
+    first_clicked_at timestamp without time zone
+);
+
+CREATE INDEX IF NOT EXISTS mail_messages_user_id_idx ON public.mail_messages (user_id);
+
+-- mail_tracking_optouts holds the users whose mails are never tracked
+CREATE TABLE IF NOT EXISTS public.mail_tracking_optouts (
+    user_id    integer PRIMARY KEY REFERENCES public.users (id) ON DELETE CASCADE,
+    created_at timestamp without time zone NOT NULL DEFAULT now()
+);
+
+-- mail_threads holds the mails sent to users that replies can answer, by the
+-- id in their Message-ID header
+CREATE TABLE IF NOT EXISTS public.mail_threads (
+    id         character(32) PRIMARY KEY,
+    user_id    integer NOT NULL REFERENCES public.users (id) ON DELETE CASCADE,
+    template   text NOT NULL,
+    created_at timestamp without time zone NOT NULL DEFAULT now()
+);
+
+-- mail_replies holds the replies received, by their Message-ID, so a reply
+-- delivered twice is only handled once
+CREATE TABLE IF NOT EXISTS public.mail_replies (
+    message_id  text PRIMARY KEY,
+    thread_id   character(32) NOT NULL REFERENCES public.mail_threads (id) ON DELETE CASCADE,
+    user_id     integer NOT NULL REFERENCES public.users (id) ON DELETE CASCADE,
+    received_at timestamp without time zone NOT NULL DEFAULT now()
+);
+
+-- mail_template_versions holds the versions of the mail templates edited
+-- through the admin API. text_body defines the "subject" template like the
+-- built-in .txt files; versions are never changed, a change is a new version.
+CREATE TABLE IF NOT EXISTS public.mail_template_versions (
+    template   text NOT NULL,
+    version    integer NOT NULL,
+    text_body  text NOT NULL,
+    html_body  text NOT NULL DEFAULT '',
+    created_by text NOT NULL,
+    created_at timestamp without time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (template, version)
+);
+
+-- mail_template_rollouts says which version of a template is sent: the
+-- candidate to percent of the recipients, the stable version to the others.
+-- A NULL stable_version is the built-in template.
+CREATE TABLE IF NOT EXISTS public.mail_template_rollouts (
+    template          text PRIMARY KEY,
+    stable_version    integer,
+    candidate_version integer,
+    percent           integer NOT NULL DEFAULT 0,
+    updated_at        timestamp without time zone NOT NULL DEFAULT now()
+);
@@ -0,0 +1,315 @@
+package data
+
+import (
+	"authentication/data/sqldb"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// DefaultRefreshTTL is how long a refresh token is valid when the caller does not say
+const DefaultRefreshTTL = 30 * 24 * time.Hour
+
+var (
+	// ErrTokenInvalid is returned for refresh tokens that are unknown or revoked
+	ErrTokenInvalid = errors.New("invalid refresh token")
+	// ErrTokenExpired is returned for refresh tokens past their expiry
+	ErrTokenExpired = errors.New("refresh token expired")
+	// ErrTokenReused is returned when a refresh token that was already rotated
+	// is used again. Every token of its family is revoked then.
+	ErrTokenReused = errors.New("refresh token was already used, the session is revoked")
+)
+
+// RefreshToken is a stored refresh token. The token itself is only known to
+// its holder, the table keeps its sha256.
+type RefreshToken struct {
+	UserID    int       `json:"user_id"`
+	Family    string    `json:"family"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Session is a login that can still refresh: the family of refresh tokens
+// rotated from it, of which one is neither used nor revoked
+type Session struct {
+	Family      string    `json:"id"`
+	SignedInAt  time.Time `json:"signed_in_at"`
+	RefreshedAt time.Time `json:"refreshed_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// SignIn is a successful login, the first refresh token of a family. Active
+// sign-ins are the sessions that can still refresh.
+type SignIn struct {
+	Family     string    `json:"id"`
+	SignedInAt time.Time `json:"signed_in_at"`
+	Active     bool      `json:"active"`
+}
+
+// PostgresRefreshTokens is the RefreshTokenRepository of the tokens table
+type PostgresRefreshTokens struct {
+	pg *Postgres
+}
+
+// Issue stores a new refresh token for userID, the first of a new family, and
+// returns it with its row
+func (t *PostgresRefreshTokens) Issue(userID int, ttl time.Duration) (string, *RefreshToken, error) {
+	family, err := randomToken(16)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var raw string
+	var issued *RefreshToken
+
+	err = t.pg.runQuery("InsertToken", []any{userID}, func(ctx context.Context, q *sqldb.Queries) error {
+		var err error
+		raw, issued, err = insertToken(ctx, q, userID, family, ttl)
+		return err
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	return raw, issued, nil
+}
+
+// Rotate uses up raw and returns the token that replaces it, for the same user
+// and family. A token used twice means it leaked: the whole family is revoked
+// and ErrTokenReused returned. allow is asked whether the user of raw may
+// still refresh before raw is used up; its error is returned and raw is left
+// as it was.
+func (t *PostgresRefreshTokens) Rotate(raw string, ttl time.Duration, allow func(userID int) error) (string, *RefreshToken, error) {
+	var next string
+	var issued *RefreshToken
+	var reused bool
+
+	err := t.pg.runQuery("RotateToken", nil, func(ctx context.Context, q *sqldb.Queries) error {
+		tx, err := t.pg.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		qtx := q.WithTx(tx)
+
+		row, err := qtx.GetTokenByHash(ctx, hashToken(raw))
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrTokenInvalid
+		}
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+
+		switch {
+		case row.RevokedAt.Valid:
+			return ErrTokenInvalid
+		case !row.ExpiresAt.After(now):
+			return ErrTokenExpired
+		}
+
+		if err := allow(int(row.UserID)); err != nil {
+			return err
+		}
+
+		used, err := qtx.UseToken(ctx, sqldb.UseTokenParams{
+			UsedAt: sql.NullTime{Time: now, Valid: true},
+			ID:     row.ID,
+		})
+		if err != nil {
+			return err
+		}
+
+		if used == 0 {
+			// rotated before, by this holder or by a thief
+			err = qtx.RevokeTokenFamily(ctx, sqldb.RevokeTokenFamilyParams{
+				RevokedAt: sql.NullTime{Time: now, Valid: true},
+				Family:    row.Family,
+			})
+			if err != nil {
+				return err
+			}
+			reused = true
+			return tx.Commit()
+		}
+
+		next, issued, err = insertToken(ctx, qtx, int(row.UserID), row.Family, ttl)
+		if err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	if reused {
+		return "", nil, ErrTokenReused
+	}
+
+	return next, issued, nil
+}
+
+// Revoke revokes raw and the tokens rotated from the same login, and returns
+// the id of their user
+func (t *PostgresRefreshTokens) Revoke(raw string) (int, error) {
+	var userID int
+
+	err := t.pg.runQuery("RevokeTokenFamily", nil, func(ctx context.Context, q *sqldb.Queries) error {
+		row, err := q.GetTokenByHash(ctx, hashToken(raw))
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrTokenInvalid
+		}
+		if err != nil {
+			return err
+		}
+
+		userID = int(row.UserID)
+
+		return q.RevokeTokenFamily(ctx, sqldb.RevokeTokenFamilyParams{
+			RevokedAt: sql.NullTime{Time: time.Now(), Valid: true},
+			Family:    row.Family,
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// RevokeAll revokes every refresh token of a user, e.g. after a password
+// reset, and returns how many were still valid
+func (t *PostgresRefreshTokens) RevokeAll(userID int) (int, error) {
+	var revoked int64
+
+	err := t.pg.runQuery("RevokeUserTokens", []any{userID}, func(ctx context.Context, q *sqldb.Queries) error {
+		var err error
+		revoked, err = q.RevokeUserTokens(ctx, sqldb.RevokeUserTokensParams{
+			RevokedAt: sql.NullTime{Time: time.Now(), Valid: true},
+			UserID:    int32(userID),
+		})
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(revoked), nil
+}
+
+// Sessions returns the sessions of a user that can still refresh, the last
+// refreshed first
+func (t *PostgresRefreshTokens) Sessions(userID int) ([]Session, error) {
+	var rows []sqldb.ListUserSessionsRow
+
+	err := t.pg.runQuery("ListUserSessions", []any{userID}, func(ctx context.Context, q *sqldb.Queries) error {
+		var err error
+		rows, err = q.ListUserSessions(ctx, sqldb.ListUserSessionsParams{
+			UserID:    int32(userID),
+			ExpiresAt: time.Now(),
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]Session, 0, len(rows))
+	for _, row := range rows {
+		sessions = append(sessions, Session{
+			Family:      row.Family,
+			SignedInAt:  row.SignedInAt,
+			RefreshedAt: row.RefreshedAt,
+			ExpiresAt:   row.ExpiresAt,
+		})
+	}
+
+	return sessions, nil
+}
+
+// SignIns returns the last limit successful logins of a user, newest first,
+// including those whose session ended
+func (t *PostgresRefreshTokens) SignIns(userID, limit int) ([]SignIn, error) {
+	var rows []sqldb.ListUserSignInsRow
+
+	err := t.pg.runQuery("ListUserSignIns", []any{userID, limit}, func(ctx context.Context, q *sqldb.Queries) error {
+		var err error
+		rows, err = q.ListUserSignIns(ctx, sqldb.ListUserSignInsParams{
+			UserID:    int32(userID),
+			ExpiresAt: time.Now(),
+			Limit:     int32(limit),
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	signIns := make([]SignIn, 0, len(rows))
+	for _, row := range rows {
+		signIns = append(signIns, SignIn{
+			Family:     row.Family,
+			SignedInAt: row.SignedInAt,
+			Active:     row.Active,
+		})
+	}
+
+	return signIns, nil
+}
+
+// insertToken stores a new random token of family and returns it
+func insertToken(ctx context.Context, q *sqldb.Queries, userID int, family string, ttl time.Duration) (string, *RefreshToken, error) {
+	raw, err := randomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if ttl <= 0 {
+		ttl = DefaultRefreshTTL
+	}
+
+	now := time.Now()
+	issued := &RefreshToken{
+		UserID:    userID,
+		Family:    family,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+
+	err = q.InsertToken(ctx, sqldb.InsertTokenParams{
+		UserID:    int32(userID),
+		TokenHash: hashToken(raw),
+		Family:    family,
+		CreatedAt: issued.CreatedAt,
+		ExpiresAt: issued.ExpiresAt,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	return raw, issued, nil
+}
+
+// randomToken returns n random bytes, URL safe
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the stored form of a token. Tokens are random, a plain
+// sha256 is enough; bcrypt would only slow down every refresh.
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,114 @@
+package data
+
+import (
+	"authentication/data/sqldb"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ErrEmailTaken is returned when a user is given the email of another
+var ErrEmailTaken = errors.New("email already belongs to another user")
+
+// UserSortFields are the fields users can be sorted by
+var UserSortFields = []string{"id", "email", "first_name", "last_name", "created_at", "updated_at"}
+
+// MaxUsersPerPage caps the page size of Search
+const MaxUsersPerPage = 200
+
+// UserQuery selects a page of users
+type UserQuery struct {
+	// Search holds words that must each appear in the email or the name of a
+	// user, in any case, e.g. "ann smi" finds Anna Smith
+	Search string
+
+	// Active only returns active or inactive users when set
+	Active *bool
+
+	// Sort is one of UserSortFields, with a leading "-" for descending order.
+	// Users are sorted by id when it is empty.
+	Sort string
+
+	// Page counts from 1, PerPage is at most MaxUsersPerPage
+	Page    int
+	PerPage int
+}
+
+// Validate checks the sort field and the page of a query
+func (q UserQuery) Validate() error {
+	if q.Sort != "" && !slices.Contains(UserSortFields, strings.TrimPrefix(q.Sort, "-")) {
+		return fmt.Errorf("invalid sort %q, use one of %s with an optional leading -", q.Sort, strings.Join(UserSortFields, ", "))
+	}
+	if q.Page < 1 {
+		return errors.New("page must be at least 1")
+	}
+	if q.PerPage < 1 || q.PerPage > MaxUsersPerPage {
+		return fmt.Errorf("per_page must be between 1 and %d", MaxUsersPerPage)
+	}
+	return nil
+}
+
+// Search returns a page of the users matching a query, and how many match in
+// all. The total is zero for pages past the last one.
+func (u *PostgresUsers) Search(query UserQuery) ([]*User, int, error) {
+	if err := query.Validate(); err != nil {
+		return nil, 0, err
+	}
+
+	params := sqldb.SearchUsersParams{
+		Terms:      searchTerms(query.Search),
+		Descending: strings.HasPrefix(query.Sort, "-"),
+		Sort:       strings.TrimPrefix(query.Sort, "-"),
+		RowLimit:   int32(query.PerPage),
+		RowOffset:  int32((query.Page - 1) * query.PerPage),
+	}
+	if params.Sort == "" {
+		params.Sort = "id"
+	}
+	if query.Active != nil {
+		params.Active = sql.NullBool{Bool: *query.Active, Valid: true}
+	}
+
+	var rows []sqldb.SearchUsersRow
+
+	err := u.pg.runQuery("SearchUsers", []any{query.Search, query.Sort, query.Page}, func(ctx context.Context, q *sqldb.Queries) error {
+		var err error
+		rows, err = q.SearchUsers(ctx, params)
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	users := make([]*User, 0, len(rows))
+	var total int
+	for _, row := range rows {
+		users = append(users, userFromRow(sqldb.User{
+			ID:         row.ID,
+			Email:      row.Email,
+			FirstName:  row.FirstName,
+			LastName:   row.LastName,
+			Password:   row.Password,
+			UserActive: row.UserActive,
+			CreatedAt:  row.CreatedAt,
+			UpdatedAt:  row.UpdatedAt,
+		}))
+		total = int(row.Total)
+	}
+
+	return users, total, nil
+}
+
+// searchTerms splits a search into words, escaping the wildcards of ILIKE
+func searchTerms(search string) []string {
+	escape := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+	terms := []string{}
+	for _, word := range strings.Fields(search) {
+		terms = append(terms, escape.Replace(word))
+	}
+	return terms
+}
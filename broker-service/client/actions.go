@@ -0,0 +1,59 @@
+package client
+
+import (
+	"context"
+	v1 "contracts/v1"
+	"encoding/json"
+)
+
+// User is the account returned by a successful authentication
+type User = v1.User
+
+// Authenticate checks an email and password through the broker. A wrong
+// password comes back as an *Error, see IsUnauthorized.
+func (c *Client) Authenticate(ctx context.Context, email, password string) (*User, error) {
+	resp, err := c.submit(ctx, v1.BrokerRequest{
+		Action: "auth",
+		Auth:   v1.AuthRequest{Email: email, Password: password},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var user User
+	if err := json.Unmarshal(resp.Data, &user); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// Log writes one entry to the logger service through the broker
+func (c *Client) Log(ctx context.Context, name, data string) error {
+	_, err := c.submit(ctx, v1.BrokerRequest{
+		Action: "log",
+		Log:    v1.LogEntry{Name: name, Data: data},
+	})
+	return err
+}
+
+// Register creates an account through the broker. Invalid fields come back as
+// an *Error with status 422.
+func (c *Client) Register(ctx context.Context, req v1.RegisterRequest) (*User, error) {
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.submit(ctx, v1.BrokerRequest{Action: "register", Payload: payload})
+	if err != nil {
+		return nil, err
+	}
+
+	var user User
+	if err := json.Unmarshal(resp.Data, &user); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
@@ -0,0 +1,235 @@
+// Package client is a typed Go client for the broker's public API. Services that
+// talk to the broker should use it instead of building requests by hand.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Client calls the broker. The zero value is not usable, create one with New.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	token      string
+	maxRetries int
+	backoff    time.Duration
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient replaces the default http.Client, which has a 10 second timeout
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithToken sends token as a Bearer token on every request
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithRetries sets how often a failed request is retried and the base delay
+// between attempts. The delay doubles on every attempt.
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = retries
+		c.backoff = backoff
+	}
+}
+
+// New returns a client for the broker at baseURL, e.g. http://localhost:8080
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    baseURL,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		maxRetries: 3,
+		backoff:    200 * time.Millisecond,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Response is the envelope every broker endpoint answers with
+type Response struct {
+	Error   bool            `json:"error"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// Error is returned when the broker answers with an error payload or an
+// unexpected status code
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("broker: %d %s", e.StatusCode, e.Message)
+}
+
+// IsUnauthorized reports whether err is a 401 from the broker
+func IsUnauthorized(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnauthorized
+}
+
+// Ping checks that the broker is up
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.do(ctx, http.MethodGet, "/ping", nil)
+	return err
+}
+
+// submit posts one action to /handle
+func (c *Client) submit(ctx context.Context, payload any) (*Response, error) {
+	return c.do(ctx, http.MethodPost, "/handle", payload)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, payload any) (*Response, error) {
+	var body []byte
+
+	if payload != nil {
+		var err error
+		body, err = json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var lastErr error
+
+	for attempt := 0; attempt <= c.maxRetries; attempt++ {
+		if attempt > 0 {
+			if err := c.wait(ctx, attempt, lastErr); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, retry, err := c.send(ctx, method, path, body)
+		if err == nil {
+			return resp, nil
+		}
+
+		if !retry {
+			return nil, err
+		}
+
+		lastErr = err
+	}
+
+	return nil, lastErr
+}
+
+// send makes one attempt and reports whether a failure is worth retrying
+func (c *Client) send(ctx context.Context, method, path string, body []byte) (*Response, bool, error) {
+	request, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, false, err
+	}
+
+	request.Header.Set("Accept", "application/json")
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		request.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		// the context is done, retrying will not help
+		if ctx.Err() != nil {
+			return nil, false, ctx.Err()
+		}
+		return nil, true, err
+	}
+	defer response.Body.Close()
+
+	raw, err := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return nil, true, err
+	}
+
+	var resp Response
+	if len(raw) > 0 && response.Header.Get("Content-Type") == "application/json" {
+		if err := json.Unmarshal(raw, &resp); err != nil {
+			return nil, false, err
+		}
+	}
+
+	if response.StatusCode >= 400 || resp.Error {
+		apiErr := &Error{StatusCode: response.StatusCode, Message: resp.Message}
+		if apiErr.Message == "" {
+			apiErr.Message = http.StatusText(response.StatusCode)
+		}
+
+		retry := response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500
+		if retry {
+			return nil, true, &retryAfterError{err: apiErr, after: retryAfter(response)}
+		}
+
+		return nil, false, apiErr
+	}
+
+	return &resp, false, nil
+}
+
+// retryAfterError carries the broker's Retry-After hint to the next attempt
+type retryAfterError struct {
+	err   *Error
+	after time.Duration
+}
+
+func (e *retryAfterError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryAfterError) Unwrap() error {
+	return e.err
+}
+
+func retryAfter(response *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(response.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// wait sleeps before the next attempt, using exponential backoff with jitter or
+// the server's Retry-After when it is longer
+func (c *Client) wait(ctx context.Context, attempt int, lastErr error) error {
+	delay := c.backoff << (attempt - 1)
+	delay += time.Duration(rand.Int63n(int64(delay)/2 + 1))
+
+	var hinted *retryAfterError
+	if errors.As(lastErr, &hinted) && hinted.after > delay {
+		delay = hinted.after
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"contracts/keystore"
+	"contracts/signing"
+	v1 "contracts/v1"
+	"io"
+	"net/http"
+	"time"
+)
+
+// maxWebhookBody is the largest webhook body VerifyWebhook reads
+const maxWebhookBody = 1 << 20
+
+// VerifyWebhook reads the body of a webhook delivered by the services and
+// checks its signature against secrets, listed newest first. It returns the
+// body so the caller can decode it once the delivery is known to be genuine.
+// Callers should also drop deliveries whose Webhook-Id they have already seen.
+func VerifyWebhook(r *http.Request, secrets []string, tolerance time.Duration) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Header.Get(signing.IDHeader) == "" {
+		return nil, signing.ErrMissingID
+	}
+
+	err = signing.Verify(r.Header.Get(signing.SignatureHeader), body, secrets, time.Now(), tolerance)
+	if err != nil {
+		return nil, err
+	}
+
+	return body, nil
+}
+
+// VerifyEvent checks the signature of an event received from the event stream.
+// The secrets are tried in order whatever key id the event names.
+func VerifyEvent(e v1.Event, secrets []string, tolerance time.Duration) error {
+	keys := make([]keystore.Key, len(secrets))
+	for i, secret := range secrets {
+		keys[i] = keystore.Key{Secret: []byte(secret)}
+	}
+	return signing.VerifyEvent(e, keys, time.Now(), tolerance)
+}
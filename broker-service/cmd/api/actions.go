@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"contracts/failover"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// actionError is one problem with a request to /handle: a field of the
+// payload that is not valid, or the answer of a service the action called
+type actionError struct {
+	Field   string `json:"field,omitempty"`
+	Service string `json:"service,omitempty"`
+	Status  int    `json:"status,omitempty"`
+	Message string `json:"message"`
+}
+
+// brokerAction is one action of /handle
+type brokerAction struct {
+	// legacy returns the payload of requests that put it in the field named
+	// after the action, nil for actions that came after payload
+	legacy func(RequestPayload) any
+
+	// run decodes, validates and handles the payload
+	run func(w http.ResponseWriter, r *http.Request, raw json.RawMessage)
+}
+
+// actions are what clients can ask of the broker. Each one decodes its
+// payload into the body of the service it calls and checks it first, so
+// invalid requests never reach the services.
+func (app *Config) actions() map[string]brokerAction {
+	return map[string]brokerAction{
+		"auth": {
+			legacy: func(p RequestPayload) any { return p.Auth },
+			run:    newAction(app, validateAuth, app.authenticate),
+		},
+		"log": {
+			legacy: func(p RequestPayload) any { return p.Log },
+			run:    newAction(app, validateLog, app.logItem),
+		},
+		"register": {
+			run: newAction(app, validateRegister, app.register),
+		},
+		"refresh": {
+			run: newAction(app, validateRefresh, app.refresh),
+		},
+		"logout": {
+			run: newAction(app, validateLogout, app.logout),
+		},
+	}
+}
+
+// newAction returns the run of an action with a payload of type T
+func newAction[T any](app *Config, validate func(T) []actionError, handle func(http.ResponseWriter, *http.Request, T)) func(http.ResponseWriter, *http.Request, json.RawMessage) {
+	return func(w http.ResponseWriter, r *http.Request, raw json.RawMessage) {
+		var payload T
+
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&payload); err != nil {
+			app.errorJson(w, decodeError(err))
+			return
+		}
+
+		if errs := validate(payload); len(errs) > 0 {
+			app.writeJson(w, http.StatusUnprocessableEntity, jsonReponse{
+				Error:   true,
+				Message: fmt.Sprintf("invalid payload: %s", errs[0].describe()),
+				Data:    errs,
+			})
+			return
+		}
+
+		handle(w, r, payload)
+	}
+}
+
+func (e actionError) describe() string {
+	if e.Field != "" {
+		return e.Field + " " + e.Message
+	}
+	return e.Message
+}
+
+func validateAuth(a AuthPayload) []actionError {
+	var errs []actionError
+	errs = require(errs, "email", a.Email)
+	errs = require(errs, "password", a.Password)
+	return errs
+}
+
+func validateLog(entry LogPayload) []actionError {
+	var errs []actionError
+	errs = require(errs, "name", entry.Name)
+	errs = require(errs, "data", entry.Data)
+	return errs
+}
+
+func validateRegister(p RegisterPayload) []actionError {
+	var errs []actionError
+	errs = require(errs, "email", p.Email)
+	if p.Email != "" && !strings.Contains(p.Email, "@") {
+		errs = append(errs, actionError{Field: "email", Message: "is not an email address"})
+	}
+	errs = require(errs, "password", p.Password)
+	errs = require(errs, "first_name", p.FirstName)
+	errs = require(errs, "last_name", p.LastName)
+	return errs
+}
+
+func validateRefresh(p RefreshPayload) []actionError {
+	return require(nil, "refresh_token", p.RefreshToken)
+}
+
+func validateLogout(p LogoutPayload) []actionError {
+	return require(nil, "refresh_token", p.RefreshToken)
+}
+
+// require adds an error for a field left empty
+func require(errs []actionError, field, value string) []actionError {
+	if strings.TrimSpace(value) == "" {
+		errs = append(errs, actionError{Field: field, Message: "is required"})
+	}
+	return errs
+}
+
+// callService posts a JSON body to path of a service and returns its answer.
+// The bearer token of the caller goes along, see exchangeTokens.
+func callService(ctx context.Context, service *failover.Endpoint, path string, body []byte) (int, []byte, error) {
+	request, err := http.NewRequestWithContext(ctx, "POST", path, bytes.NewBuffer(body))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	if bearer := forwardedBearer(ctx); bearer != "" {
+		request.Header.Set("Authorization", "Bearer "+bearer)
+	}
+
+	client := &http.Client{}
+
+	response, err := service.Do(client, request)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer response.Body.Close()
+
+	answer, err := io.ReadAll(response.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return response.StatusCode, answer, nil
+}
+
+// serviceErrorJson answers a failed call to a service in the response shape
+// of the broker, with the message of the service when it sent one. Requests
+// the service refused keep its status, a service that failed or could not be
+// reached is a 502.
+func (app *Config) serviceErrorJson(w http.ResponseWriter, service string, status int, body []byte, err error) {
+	e := actionError{Service: service, Status: status}
+
+	var answer jsonReponse
+	switch {
+	case err != nil:
+		e.Message = err.Error()
+	case json.Unmarshal(body, &answer) == nil && answer.Message != "":
+		e.Message = answer.Message
+	default:
+		e.Message = http.StatusText(status)
+	}
+
+	code := http.StatusBadGateway
+	if status >= 400 && status < 500 {
+		code = status
+	}
+
+	app.writeJson(w, code, jsonReponse{
+		Error:   true,
+		Message: fmt.Sprintf("%s: %s", service, e.Message),
+		Data:    []actionError{e},
+	})
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	v1 "contracts/v1"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// maxCapturedBody is how much of each body a capture keeps
+	maxCapturedBody = 64 << 10
+
+	redacted = "[REDACTED]"
+)
+
+// sensitiveHeaders are dropped from captures
+var sensitiveHeaders = map[string]bool{
+	"Authorization":  true,
+	"Cookie":         true,
+	"Set-Cookie":     true,
+	"X-Admin-Key":    true,
+	"X-Stream-Token": true,
+}
+
+// sensitiveField reports whether a JSON field is masked in captures
+func sensitiveField(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range []string{"password", "token", "secret", "authorization", "api_key", "apikey"} {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// capture is a request and its response, sent to the logger service
+type capture = v1.Capture
+
+// capturer records the requests of the routes listed in CAPTURE_ROUTES, e.g.
+// "POST /handle,POST /", and ships them to the logger in the background
+type capturer struct {
+	app    *Config
+	routes map[string]bool
+	queue  chan capture
+}
+
+func newCapturer(app *Config, routes string) *capturer {
+	c := &capturer{
+		app:    app,
+		routes: make(map[string]bool),
+		queue:  make(chan capture, 256),
+	}
+
+	for _, route := range strings.Split(routes, ",") {
+		method, path, ok := strings.Cut(strings.TrimSpace(route), " ")
+		if ok {
+			c.routes[strings.ToUpper(method)+" "+strings.TrimSpace(path)] = true
+		}
+	}
+
+	if len(c.routes) == 0 {
+		return nil
+	}
+
+	go c.ship()
+
+	return c
+}
+
+// middleware captures the requests of the configured routes
+func (c *capturer) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c == nil || !c.routes[r.Method+" "+r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// the handler still gets the whole body, only the copy is cut short
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxCapturedBody))
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+
+		rec := &captureRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+
+		next.ServeHTTP(rec, r)
+
+		entry := capture{
+			Method:          r.Method,
+			Path:            r.URL.Path,
+			Query:           r.URL.RawQuery,
+			RequestHeaders:  sanitizeHeaders(r.Header),
+			RequestBody:     sanitizeBody(body),
+			Status:          rec.status,
+			ResponseHeaders: sanitizeHeaders(w.Header()),
+			ResponseBody:    sanitizeBody(rec.body.Bytes()),
+			DurationMs:      time.Since(start).Milliseconds(),
+		}
+
+		select {
+		case c.queue <- entry:
+		default:
+			log.Println("Capture queue full, dropping capture of", entry.Path)
+		}
+	})
+}
+
+func (c *capturer) ship() {
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	for entry := range c.queue {
+		if err := c.send(client, entry); err != nil {
+			log.Println("Error sending capture:", err)
+		}
+	}
+}
+
+func (c *capturer) send(client *http.Client, entry capture) error {
+	jsonData, _ := json.Marshal(entry)
+
+	request, err := http.NewRequest("POST", "/captures", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "Bearer "+c.app.LogToken)
+
+	response, err := c.app.Logger.Do(client, request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("logger service answered %d", response.StatusCode)
+	}
+
+	return nil
+}
+
+// readCloser reads the captured start of a body and then the rest of it
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// captureRecorder keeps the status and the start of the body of a response
+type captureRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *captureRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *captureRecorder) Write(b []byte) (int, error) {
+	if room := maxCapturedBody - r.body.Len(); room > 0 {
+		r.body.Write(b[:min(len(b), room)])
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *captureRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func sanitizeHeaders(h http.Header) map[string]string {
+	out := make(map[string]string, len(h))
+	for name, values := range h {
+		if sensitiveHeaders[http.CanonicalHeaderKey(name)] {
+			continue
+		}
+		out[name] = strings.Join(values, ", ")
+	}
+	return out
+}
+
+// sanitizeBody masks the sensitive fields of JSON bodies. Other bodies are
+// kept as they are.
+func sanitizeBody(body []byte) string {
+	if len(body) > maxCapturedBody {
+		body = body[:maxCapturedBody]
+	}
+
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return string(body)
+	}
+
+	out, err := json.Marshal(maskFields(v))
+	if err != nil {
+		return string(body)
+	}
+	return string(out)
+}
+
+func maskFields(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, value := range v {
+			if sensitiveField(k) {
+				v[k] = redacted
+				continue
+			}
+			v[k] = maskFields(value)
+		}
+	case []any:
+		for i := range v {
+			v[i] = maskFields(v[i])
+		}
+	}
+	return v
+}
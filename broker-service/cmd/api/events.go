@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// streamTokenTTL is how long a stream token can be used to open a stream
+const streamTokenTTL = 12 * time.Hour
+
+type StreamTokenPayload struct {
+	Topics []string `json:"topics"`
+}
+
+type NotificationPayload struct {
+	UserID  int    `json:"user_id"`
+	Title   string `json:"title"`
+	Message string `json:"message"`
+}
+
+// Events streams the events of the topics granted by ?token= as server-sent
+// events until the client goes away
+func (app *Config) Events(w http.ResponseWriter, r *http.Request) {
+	topics, err := app.StreamTokens.Topics(r.URL.Query().Get("token"))
+	if err != nil {
+		app.errorJson(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+
+	// streams stay open far longer than the server's write timeout
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	events, unsubscribe := app.Hub.Subscribe(topics)
+	defer unsubscribe()
+
+	// the stream ends at shutdown, the client reconnects to another replica
+	ctx, cancel := app.Lifecycle.StreamContext(r.Context())
+	defer cancel()
+
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+
+	fmt.Fprintf(w, "retry: 3000\n: subscribed to %s\n\n", strings.Join(topics, ","))
+	rc.Flush()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case e := <-events:
+			data, _ := json.Marshal(e)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// IssueStreamToken gives admins a stream token for any topics, e.g. job:<id>
+func (app *Config) IssueStreamToken(w http.ResponseWriter, r *http.Request) {
+	var requestPayload StreamTokenPayload
+
+	err := app.readJson(w, r, &requestPayload)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	if len(requestPayload.Topics) == 0 {
+		app.errorJson(w, errors.New("topics are required"))
+		return
+	}
+
+	app.writeJson(w, http.StatusCreated, jsonReponse{
+		Error:   false,
+		Message: "stream token issued",
+		Data: map[string]string{
+			"token": app.StreamTokens.Issue(requestPayload.Topics, streamTokenTTL),
+		},
+	})
+}
+
+// Notify sends a notification to the streams of one user
+func (app *Config) Notify(w http.ResponseWriter, r *http.Request) {
+	var requestPayload NotificationPayload
+
+	err := app.readJson(w, r, &requestPayload)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	if requestPayload.UserID <= 0 || requestPayload.Message == "" {
+		app.errorJson(w, errors.New("user_id and message are required"))
+		return
+	}
+
+	topic := fmt.Sprintf("user:%d", requestPayload.UserID)
+
+	err = app.Hub.Publish(r.Context(), topic, "notification", requestPayload)
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJson(w, http.StatusAccepted, jsonReponse{
+		Error:   false,
+		Message: "notification sent",
+	})
+}
+
+// userStreamToken returns a stream token for the notifications of the user in
+// an auth response, or "" when the response has no user id
+func (app *Config) userStreamToken(user any) string {
+	raw, err := json.Marshal(user)
+	if err != nil {
+		return ""
+	}
+
+	var u struct {
+		ID int `json:"id"`
+	}
+	if json.Unmarshal(raw, &u) != nil || u.ID == 0 {
+		return ""
+	}
+
+	return app.StreamTokens.Issue([]string{fmt.Sprintf("user:%d", u.ID)}, streamTokenTTL)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// responseMapper reshapes the data of one action's response before it is sent,
+// configured through RESPONSE_MAPPERS, e.g.
+//
+//	{"auth": {"drop": ["created_at"], "rename": {"first_name": "firstName"}}}
+type responseMapper struct {
+	Drop   []string          `json:"drop"`
+	Rename map[string]string `json:"rename"`
+}
+
+func parseResponseMappers(s string) (map[string]responseMapper, error) {
+	mappers := make(map[string]responseMapper)
+	if s == "" {
+		return mappers, nil
+	}
+
+	if err := json.Unmarshal([]byte(s), &mappers); err != nil {
+		return nil, fmt.Errorf("invalid RESPONSE_MAPPERS: %w", err)
+	}
+
+	return mappers, nil
+}
+
+func (m responseMapper) apply(obj map[string]any) {
+	for _, field := range m.Drop {
+		delete(obj, field)
+	}
+
+	for from, to := range m.Rename {
+		if value, ok := obj[from]; ok {
+			delete(obj, from)
+			obj[to] = value
+		}
+	}
+}
+
+// shape runs the action's mapper over data and then keeps only the fields the
+// client asked for with ?fields=id,email. Fields are matched after renaming.
+func (app *Config) shape(r *http.Request, action string, data any) (any, error) {
+	mapper, hasMapper := app.ResponseMappers[action]
+	fields := parseFields(r.URL.Query().Get("fields"))
+
+	if data == nil || (!hasMapper && fields == nil) {
+		return data, nil
+	}
+
+	// work on a generic copy so any payload type can be reshaped
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var generic any
+	if err := json.Unmarshal(raw, &generic); err != nil {
+		return nil, err
+	}
+
+	each(generic, func(obj map[string]any) {
+		if hasMapper {
+			mapper.apply(obj)
+		}
+		if fields != nil {
+			for key := range obj {
+				if !fields[key] {
+					delete(obj, key)
+				}
+			}
+		}
+	})
+
+	return generic, nil
+}
+
+// each calls fn for an object, or for every object of a list
+func each(v any, fn func(map[string]any)) {
+	switch v := v.(type) {
+	case map[string]any:
+		fn(v)
+	case []any:
+		for _, item := range v {
+			if obj, ok := item.(map[string]any); ok {
+				fn(obj)
+			}
+		}
+	}
+}
+
+func parseFields(s string) map[string]bool {
+	if s == "" {
+		return nil
+	}
+
+	fields := make(map[string]bool)
+	for _, field := range strings.Split(s, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields[field] = true
+		}
+	}
+
+	return fields
+}
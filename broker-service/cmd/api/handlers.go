@@ -2,27 +2,25 @@ package main
 
 import (
 	"bytes"
+	"context"
+	v1 "contracts/v1"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 )
 
-type RequestPayload struct {
-	Action string      `json:"action"`
-	Auth   AuthPayload `json:"auth,omitempty"`
-	Log    LogPayload  `json:"log,omitempty"`
-}
-
-type AuthPayload struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
-}
-
-type LogPayload struct {
-	Name string `json:"name"`
-	Data string `json:"data"`
-}
+// The bodies exchanged with the other services are defined in the contracts
+// module, these names are kept for the handlers of the broker
+type (
+	RequestPayload  = v1.BrokerRequest
+	AuthPayload     = v1.AuthRequest
+	LogPayload      = v1.LogEntry
+	RegisterPayload = v1.RegisterRequest
+	RefreshPayload  = v1.RefreshRequest
+	LogoutPayload   = v1.LogoutRequest
+)
 
 func (app *Config) Broker(w http.ResponseWriter, r *http.Request) {
 	payload := jsonReponse{
@@ -33,6 +31,8 @@ func (app *Config) Broker(w http.ResponseWriter, r *http.Request) {
 	_ = app.writeJson(w, http.StatusOK, payload)
 }
 
+// HandleSubmission is the single entry point of the front end: it runs the
+// action of the request on its payload, see actions
 func (app *Config) HandleSubmission(w http.ResponseWriter, r *http.Request) {
 	var requestPayload RequestPayload
 
@@ -42,48 +42,43 @@ func (app *Config) HandleSubmission(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	switch requestPayload.Action {
-	case "auth":
-		app.authenticate(w, requestPayload.Auth)
-	case "log":
-		app.logItem(w, requestPayload.Log)
-	default:
-		app.errorJson(w, errors.New("unknown action"))
+	action, ok := app.actions()[requestPayload.Action]
+	if !ok {
+		app.errorJson(w, fmt.Errorf("unknown action %q", requestPayload.Action))
+		return
 	}
+
+	raw := requestPayload.Payload
+	if len(raw) == 0 && action.legacy != nil {
+		raw, _ = json.Marshal(action.legacy(requestPayload))
+	}
+	if len(raw) == 0 {
+		app.errorJson(w, errors.New("missing payload"))
+		return
+	}
+
+	action.run(w, r, raw)
 }
 
-func (app *Config) authenticate(w http.ResponseWriter, a AuthPayload) {
+func (app *Config) authenticate(w http.ResponseWriter, r *http.Request, a AuthPayload) {
 	// create some json we'll send to the auth microservices
 	jsonData, _ := json.MarshalIndent(a, "", "\t")
 
 	// call the service
-	request, err := http.NewRequest("POST", "http://authentication-service/authenticate", bytes.NewBuffer(jsonData))
-
+	status, body, err := callService(r.Context(), app.Auth, "/authenticate", jsonData)
 	if err != nil {
-		app.errorJson(w, err)
+		app.serviceErrorJson(w, "authentication-service", 0, nil, err)
 		return
 	}
 
-	request.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
+	log.Printf("Response received from auth service, Status Code: %d", status)
 
-	response, err := client.Do(request)
+	// mirror a share of the logins to the shadow auth service, if any
+	app.AuthShadow.mirror("/authenticate", jsonData, status, body)
 
-	if err != nil {
-		app.errorJson(w, err)
-		return
-	}
-
-	defer response.Body.Close()
-	log.Printf("Response received from auth service, Status Code: %d", response.StatusCode)
 	// make sure we get back the correct status code
-
-	if response.StatusCode == http.StatusUnauthorized {
-		app.errorJson(w, errors.New("invalid credentials"))
-		return
-	} else if response.StatusCode != http.StatusAccepted {
-		app.errorJson(w, errors.New("error to calling auth service"))
+	if status != http.StatusAccepted {
+		app.serviceErrorJson(w, "authentication-service", status, body, nil)
 		return
 	}
 
@@ -91,7 +86,7 @@ func (app *Config) authenticate(w http.ResponseWriter, a AuthPayload) {
 	var jsonFromService jsonReponse
 
 	// decode the json from auth service
-	err = json.NewDecoder(response.Body).Decode(&jsonFromService)
+	err = json.Unmarshal(body, &jsonFromService)
 
 	if err != nil {
 		app.errorJson(w, err)
@@ -99,51 +94,179 @@ func (app *Config) authenticate(w http.ResponseWriter, a AuthPayload) {
 	}
 
 	if jsonFromService.Error {
-		app.errorJson(w, err, http.StatusUnauthorized)
+		app.serviceErrorJson(w, "authentication-service", http.StatusUnauthorized, body, nil)
+		return
+	}
+
+	// in opaque mode the browser only gets a reference to its access token
+	if err := app.wrapAccessToken(r.Context(), jsonFromService.Data); err != nil {
+		app.errorJson(w, err, http.StatusServiceUnavailable)
+		return
+	}
+
+	data, err := app.shape(r, "auth", jsonFromService.Data)
+	if err != nil {
+		app.errorJson(w, err)
 		return
 	}
 
 	var payload jsonReponse
 	payload.Error = false
 	payload.Message = "Authenticated"
-	payload.Data = jsonFromService.Data
+	payload.Data = data
+
+	// lets the front end open /events for the user's notifications
+	if token := app.userStreamToken(jsonFromService.Data); token != "" {
+		w.Header().Set("X-Stream-Token", token)
+	}
 
 	app.writeJson(w, http.StatusAccepted, payload)
 }
 
-func (app *Config) logItem(w http.ResponseWriter, entry LogPayload) {
-	jsonData, _ := json.MarshalIndent(entry, "", "\t")
+func (app *Config) register(w http.ResponseWriter, r *http.Request, p RegisterPayload) {
+	jsonData, _ := json.Marshal(p)
 
-	logServiceURL := "http://logger-service/log"
+	status, body, err := callService(r.Context(), app.Auth, "/register", jsonData)
+	if err != nil {
+		app.serviceErrorJson(w, "authentication-service", 0, nil, err)
+		return
+	}
+	if status != http.StatusAccepted {
+		app.serviceErrorJson(w, "authentication-service", status, body, nil)
+		return
+	}
 
-	request, err := http.NewRequest("POST", logServiceURL, bytes.NewBuffer(jsonData))
+	var jsonFromService jsonReponse
+	if err := json.Unmarshal(body, &jsonFromService); err != nil {
+		app.errorJson(w, err)
+		return
+	}
 
+	data, err := app.shape(r, "register", jsonFromService.Data)
 	if err != nil {
 		app.errorJson(w, err)
 		return
 	}
 
-	request.Header.Set("Content-Type", "application/json")
+	app.writeJson(w, http.StatusAccepted, jsonReponse{
+		Error:   false,
+		Message: jsonFromService.Message,
+		Data:    data,
+	})
+}
 
-	client := &http.Client{}
+// refresh trades a refresh token for new tokens. In opaque mode the new
+// access token is handed out as a reference too and the reference the caller
+// used, if any, is forgotten.
+func (app *Config) refresh(w http.ResponseWriter, r *http.Request, p RefreshPayload) {
+	jsonData, _ := json.Marshal(p)
+
+	status, body, err := callService(r.Context(), app.Auth, "/refresh", jsonData)
+	if err != nil {
+		app.serviceErrorJson(w, "authentication-service", 0, nil, err)
+		return
+	}
+	if status != http.StatusOK {
+		app.serviceErrorJson(w, "authentication-service", status, body, nil)
+		return
+	}
 
-	response, err := client.Do(request)
+	var jsonFromService jsonReponse
+	if err := json.Unmarshal(body, &jsonFromService); err != nil {
+		app.errorJson(w, err)
+		return
+	}
 
+	if err := app.wrapAccessToken(r.Context(), jsonFromService.Data); err != nil {
+		app.errorJson(w, err, http.StatusServiceUnavailable)
+		return
+	}
+	app.revokeCallerReference(r.Context())
+
+	data, err := app.shape(r, "refresh", jsonFromService.Data)
 	if err != nil {
 		app.errorJson(w, err)
 		return
 	}
 
-	defer response.Body.Close()
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: jsonFromService.Message,
+		Data:    data,
+	})
+}
 
-	if response.StatusCode != http.StatusAccepted {
+// logout ends the session of a refresh token, and the reference the caller
+// used in opaque mode
+func (app *Config) logout(w http.ResponseWriter, r *http.Request, p LogoutPayload) {
+	jsonData, _ := json.Marshal(p)
+
+	status, body, err := callService(r.Context(), app.Auth, "/logout", jsonData)
+	if err != nil {
+		app.serviceErrorJson(w, "authentication-service", 0, nil, err)
+		return
+	}
+	if status != http.StatusOK {
+		app.serviceErrorJson(w, "authentication-service", status, body, nil)
+		return
+	}
+
+	var jsonFromService jsonReponse
+	if err := json.Unmarshal(body, &jsonFromService); err != nil {
 		app.errorJson(w, err)
 		return
 	}
 
+	app.revokeCallerReference(r.Context())
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: jsonFromService.Message,
+	})
+}
+
+func (app *Config) logItem(w http.ResponseWriter, r *http.Request, entry LogPayload) {
+	err := app.sendLog(r.Context(), entry)
+	if err != nil {
+		app.serviceErrorJson(w, "logger-service", 0, nil, err)
+		return
+	}
+
 	var payload jsonReponse
 	payload.Error = false
 	payload.Message = "logged"
 
 	app.writeJson(w, http.StatusAccepted, payload)
 }
+
+// sendLog writes one entry to the logger service
+func (app *Config) sendLog(ctx context.Context, entry LogPayload) error {
+	entry.Version = version
+
+	jsonData, _ := json.MarshalIndent(entry, "", "\t")
+
+	request, err := http.NewRequestWithContext(ctx, "POST", "/log", bytes.NewBuffer(jsonData))
+
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "Bearer "+app.LogToken)
+
+	client := &http.Client{}
+
+	response, err := app.Logger.Do(client, request)
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("logger service answered %d", response.StatusCode)
+	}
+
+	return nil
+}
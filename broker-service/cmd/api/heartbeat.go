@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+type heartbeatPayload struct {
+	IntervalSeconds int64        `json:"interval_seconds"`
+	Requests        RequestStats `json:"requests"`
+}
+
+// sendHeartbeats tells the logger service every interval that this service is
+// alive, so it can alert when the heartbeats stop. Each heartbeat carries the
+// request counts since the previous one for the SLO reports.
+func (app *Config) sendHeartbeats(interval time.Duration) {
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for ; ; <-ticker.C {
+		payload := heartbeatPayload{
+			IntervalSeconds: int64(interval / time.Second),
+			Requests:        requests.take(),
+		}
+
+		jsonData, _ := json.Marshal(payload)
+
+		err := app.heartbeat(client, jsonData)
+		if err != nil {
+			log.Println("Error sending heartbeat:", err)
+			requests.restore(payload.Requests)
+		}
+	}
+}
+
+func (app *Config) heartbeat(client *http.Client, jsonData []byte) error {
+	request, err := http.NewRequest("POST", "/heartbeat", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "Bearer "+app.LogToken)
+
+	response, err := app.Logger.Do(client, request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("logger service answered %d", response.StatusCode)
+	}
+
+	return nil
+}
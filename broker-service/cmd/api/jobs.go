@@ -0,0 +1,57 @@
+package main
+
+import (
+	"contracts/failover"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// jobService returns the service that runs a job, by the prefix of its id
+func (app *Config) jobService(id string) *failover.Endpoint {
+	switch {
+	case strings.HasPrefix(id, "auth-"):
+		return app.Auth
+	case strings.HasPrefix(id, "logger-"):
+		return app.Logger
+	}
+	return nil
+}
+
+// GetJob looks a job up on the service that owns it. The admin key of the
+// caller is passed on, the services decide who may see their jobs.
+func (app *Config) GetJob(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	service := app.jobService(id)
+	if service == nil {
+		app.errorJson(w, errors.New("job not found"), http.StatusNotFound)
+		return
+	}
+
+	request, err := http.NewRequestWithContext(r.Context(), "GET", "/jobs/"+url.PathEscape(id), nil)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	request.Header.Set("Accept", "application/json")
+	request.Header.Set("X-Admin-Key", r.Header.Get("X-Admin-Key"))
+
+	client := &http.Client{}
+
+	response, err := service.Do(client, request)
+	if err != nil {
+		app.errorJson(w, err, http.StatusBadGateway)
+		return
+	}
+	defer response.Body.Close()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(response.StatusCode)
+	io.Copy(w, response.Body)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"contracts/configlint"
+	"contracts/keystore"
+	"os"
+)
+
+// lintConfig looks for insecure settings of the broker, see configlint
+func lintConfig(app *Config) *configlint.Lint {
+	var lint configlint.Lint
+
+	lint.Secret("ADMIN_API_KEY", app.AdminKey)
+	lint.Secret("LOG_INGEST_TOKEN", app.LogToken)
+	lint.LogLevel("LOG_LEVEL", os.Getenv("LOG_LEVEL"))
+
+	if v := os.Getenv("EVENT_SIGNING_KEYS"); v != "" {
+		lint.Secret("EVENT_SIGNING_KEYS", v)
+	} else if !app.Keys.Has(keystore.PurposeEvents) {
+		lint.Add("EVENT_SIGNING_KEYS", "no event keys, events from Redis are not verified")
+	}
+	if v := os.Getenv("STREAM_TOKEN_SECRET"); v != "" {
+		lint.Secret("STREAM_TOKEN_SECRET", v)
+	}
+
+	for service, tokens := range app.ServiceTokens {
+		for _, token := range tokens {
+			lint.Secret("SERVICE_TOKENS "+service, token)
+		}
+	}
+
+	for source, secrets := range app.WebhookSecrets {
+		for _, secret := range secrets {
+			lint.Secret("WEBHOOK_SECRETS "+source, secret)
+		}
+	}
+
+	return &lint
+}
@@ -1,19 +1,180 @@
 package main
 
 import (
+	"broker/events"
+	"context"
+	"contracts/config"
+	"contracts/eventschema"
+	"contracts/failover"
+	"contracts/keystore"
+	"contracts/lifecycle"
+	"contracts/loglevel"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
 )
 
-const webPort = "81"
+type Config struct {
+	LogToken       string
+	WebhookSecrets map[string][]string
+	AuthShadow     *shadow
+
+	ResponseMappers map[string]responseMapper
+
+	// UploadTargets are the services multipart uploads are streamed to
+	UploadTargets map[string]uploadTarget
+
+	AdminKey string
+
+	// ServiceTokens are the bearer tokens of the services allowed on the
+	// internal routes, by service, e.g. the token exchange
+	ServiceTokens map[string][]string
+
+	Hub          *events.Hub
+	StreamTokens events.Tokens
+	Redis        *redis.Client
+
+	// Opaque hands out token references in place of access tokens, nil
+	// unless TOKEN_MODE is opaque
+	Opaque *opaqueTokens
 
-type Config struct{}
+	// Keys holds the event and stream token keys
+	Keys *keystore.Store
+
+	Capture *capturer
+
+	// Auth and Logger are the services the broker calls, see newEndpoint
+	Auth   *failover.Endpoint
+	Logger *failover.Endpoint
+
+	Lifecycle *lifecycle.Lifecycle
+
+	// MaxBodyBytes limits the JSON request bodies read by readJson
+	MaxBodyBytes int64
+
+	// RequestTimeout bounds the routes that set no timeout of their own
+	RequestTimeout time.Duration
+}
 
 func main() {
-	app := Config{}
+	// every setting is an environment variable or a flag named after it,
+	// -redis-addr for REDIS_ADDR
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Panic(err)
+	}
+
+	loglevel.Setup(cfg.String("LOG_LEVEL", ""))
+
+	// PORT is where the API listens, 81 by default
+	webPort := cfg.Port("PORT", "81")
+
+	app := Config{
+		LogToken:       cfg.String("LOG_INGEST_TOKEN", ""),
+		WebhookSecrets: parseWebhookSecrets(cfg.String("WEBHOOK_SECRETS", "")),
+		AdminKey:       cfg.String("ADMIN_API_KEY", ""),
+		// SERVICE_TOKENS, e.g. "auth:s3cret,logger:new|old", like WEBHOOK_SECRETS
+		ServiceTokens: parseWebhookSecrets(cfg.String("SERVICE_TOKENS", "")),
+	}
+
+	keys, err := openKeystore()
+	if err != nil {
+		log.Panic(err)
+	}
+	app.Keys = keys
+	app.StreamTokens = events.Tokens{Keys: keys}
+
+	// insecure settings stop the service in production
+	lintConfig(&app).Enforce("broker")
+
+	// MAX_BODY_BYTES overrides the one mega byte limit of JSON request bodies
+	app.MaxBodyBytes = cfg.Int64("MAX_BODY_BYTES", 0)
+
+	// REQUEST_TIMEOUT overrides the ten seconds routes get unless they set
+	// a timeout of their own
+	app.RequestTimeout = cfg.Duration("REQUEST_TIMEOUT", 10*time.Second, time.Millisecond)
 
-	log.Println("Starting broker service on port %s", webPort)
+	// events reach the clients of every replica through Redis pub/sub
+	var rdb *redis.Client
+	if addr := cfg.Addr("REDIS_ADDR", ""); addr != "" {
+		rdb = redis.NewClient(&redis.Options{Addr: addr})
+	}
+	app.Redis = rdb
+
+	// TOKEN_MODE=opaque keeps access tokens from browsers, they get a
+	// reference the broker resolves on the way to the services
+	if cfg.OneOf("TOKEN_MODE", tokenModeJWT, tokenModeJWT, tokenModeOpaque) == tokenModeOpaque {
+		if rdb == nil {
+			log.Println("TOKEN_MODE is opaque without REDIS_ADDR, token references are only known to the replica that handed them out")
+		}
+		app.Opaque = newOpaqueTokens(rdb)
+	}
+
+	// events of older schemas must still upcast to what clients are sent
+	if err := eventschema.Events.Check(); err != nil {
+		log.Panic(err)
+	}
+	app.Hub = events.NewHub(rdb, keys)
+
+	// probes, the preStop drain and the shutdown, see lifecycle
+	app.Lifecycle = lifecycle.New()
+	app.Lifecycle.AdminKey = app.AdminKey
+	if rdb != nil {
+		app.Lifecycle.AddCheck("redis", func(ctx context.Context) error {
+			return rdb.Ping(ctx).Err()
+		})
+		app.Lifecycle.OnShutdown("redis", func(context.Context) error {
+			return rdb.Close()
+		})
+	}
+
+	// key revocations made on any service
+	go watchRevocations(rdb, keys)
+	app.Hub.Version = version
+
+	mappers, err := parseResponseMappers(cfg.String("RESPONSE_MAPPERS", ""))
+	if err != nil {
+		log.Panic(err)
+	}
+	app.ResponseMappers = mappers
+
+	// UPLOAD_TARGETS lists the services that take uploads through /uploads
+	app.UploadTargets, err = parseUploadTargets(cfg.String("UPLOAD_TARGETS", ""))
+	if err != nil {
+		log.Panic(err)
+	}
+
+	// mirror SHADOW_AUTH_PERCENT percent of the logins to SHADOW_AUTH_URL
+	shadowPercent := cfg.Float("SHADOW_AUTH_PERCENT", 0)
+	shadowURL := cfg.URL("SHADOW_AUTH_URL", "", "http", "https")
+	app.AuthShadow = newShadow(&app, "authentication", shadowURL, shadowPercent, cfg.String("SHADOW_IGNORE_FIELDS", ""))
+
+	// opt-in capture of the requests of some routes for replays
+	app.Capture = newCapturer(&app, cfg.String("CAPTURE_ROUTES", ""))
+
+	// the services the broker calls, each may have a secondary deployment it
+	// fails over to, e.g. AUTH_SECONDARY_URL=https://auth.dr.example.com
+	app.Auth = app.newEndpoint(cfg, "authentication-service", "AUTH", "http://authentication-service")
+	app.Logger = app.newEndpoint(cfg, "logger-service", "LOGGER", "http://logger-service")
+
+	// dead man's switch, the logger alerts when the heartbeats stop
+	heartbeatInterval := cfg.Duration("HEARTBEAT_INTERVAL", 30*time.Second, time.Second)
+
+	// settings that are set but invalid stop the service before it serves
+	if err := cfg.Err(); err != nil {
+		log.Panicf("Invalid configuration:\n%v", err)
+	}
+
+	go app.sendHeartbeats(heartbeatInterval)
+
+	log.Printf("Starting broker service on port %s", webPort)
+	if pod := app.Lifecycle.Pod; pod != nil {
+		log.Printf("Running as pod %s/%s on node %s", pod.Namespace, pod.Name, pod.Node)
+	}
 
 	// define http server
 	srv := &http.Server{
@@ -21,9 +182,8 @@ func main() {
 		Handler: app.routes(),
 	}
 
-	// start the server
-	err := srv.ListenAndServe()
-	if err != nil {
+	// start the server, until SIGTERM
+	if err := app.Lifecycle.Serve(srv); err != nil {
 		log.Panic(err)
 	}
 }
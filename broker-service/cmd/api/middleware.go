@@ -0,0 +1,50 @@
+package main
+
+import (
+	"contracts/token"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+)
+
+// requireAdmin only lets requests through that carry the admin key in the
+// X-Admin-Key header. When no admin key is configured every request is refused.
+func (app *Config) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("X-Admin-Key")
+
+		if app.AdminKey == "" || subtle.ConstantTimeCompare([]byte(key), []byte(app.AdminKey)) != 1 {
+			app.errorJson(w, errors.New("admin key required"), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireService only lets requests through whose bearer token is one of
+// SERVICE_TOKENS, the credentials of the services behind the broker. When no
+// service token is configured every request is refused.
+func (app *Config) requireService(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if serviceOf(app.ServiceTokens, token.FromRequest(r)) == "" {
+			app.errorJson(w, errors.New("service token required"), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// serviceOf returns the service a token belongs to, "" for none
+func serviceOf(tokens map[string][]string, raw string) string {
+	found := ""
+	for service, list := range tokens {
+		for _, t := range list {
+			if raw != "" && subtle.ConstantTimeCompare([]byte(raw), []byte(t)) == 1 {
+				found = service
+			}
+		}
+	}
+	return found
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"contracts/token"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// token modes of TOKEN_MODE
+const (
+	tokenModeJWT    = "jwt"
+	tokenModeOpaque = "opaque"
+)
+
+// opaquePrefix starts the references handed out in place of access tokens
+const opaquePrefix = "opq_"
+
+// errOpaqueUnknown is returned for references that are unknown or expired
+var errOpaqueUnknown = errors.New("unknown or expired token reference")
+
+// context keys of exchangeTokens
+type (
+	bearerKey    struct{}
+	referenceKey struct{}
+)
+
+// opaqueTokens keeps the access tokens of the authentication service away
+// from browsers under TOKEN_MODE=opaque. The broker hands out a random
+// reference instead of the token and keeps the token under the sha256 of the
+// reference until it expires; the claims never leave the backend. Requests
+// the broker passes on to a service have their reference exchanged for the
+// token on the way, see exchangeTokens; services handed a reference otherwise
+// exchange it on /tokens/exchange with their service token.
+//
+// The references are shared by the replicas through Redis; without Redis
+// each replica only knows the references it handed out.
+type opaqueTokens struct {
+	rdb *redis.Client
+
+	mu    sync.Mutex
+	local map[string]opaqueEntry
+}
+
+type opaqueEntry struct {
+	token   string
+	expires time.Time
+}
+
+func newOpaqueTokens(rdb *redis.Client) *opaqueTokens {
+	return &opaqueTokens{rdb: rdb, local: make(map[string]opaqueEntry)}
+}
+
+// wrap stores access until expires and returns the reference to it
+func (o *opaqueTokens) wrap(ctx context.Context, access string, expires time.Time) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	ref := opaquePrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	ttl := time.Until(expires)
+	if ttl <= 0 {
+		return "", errors.New("token already expired")
+	}
+
+	if o.rdb != nil {
+		if err := o.rdb.Set(ctx, opaqueKey(ref), access, ttl).Err(); err != nil {
+			return "", err
+		}
+		return ref, nil
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := time.Now()
+	for key, e := range o.local {
+		if !e.expires.After(now) {
+			delete(o.local, key)
+		}
+	}
+	o.local[opaqueKey(ref)] = opaqueEntry{token: access, expires: expires}
+
+	return ref, nil
+}
+
+// resolve returns the token behind a reference
+func (o *opaqueTokens) resolve(ctx context.Context, ref string) (string, error) {
+	if !strings.HasPrefix(ref, opaquePrefix) {
+		return "", errOpaqueUnknown
+	}
+
+	if o.rdb != nil {
+		access, err := o.rdb.Get(ctx, opaqueKey(ref)).Result()
+		if errors.Is(err, redis.Nil) {
+			return "", errOpaqueUnknown
+		}
+		return access, err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	e, ok := o.local[opaqueKey(ref)]
+	if !ok || !e.expires.After(time.Now()) {
+		return "", errOpaqueUnknown
+	}
+	return e.token, nil
+}
+
+// revoke forgets a reference before its token expires
+func (o *opaqueTokens) revoke(ctx context.Context, ref string) error {
+	if o.rdb != nil {
+		return o.rdb.Del(ctx, opaqueKey(ref)).Err()
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	delete(o.local, opaqueKey(ref))
+	return nil
+}
+
+// opaqueKey is where the token of ref is kept, by hash so that a dump of
+// Redis does not hand out usable references
+func opaqueKey(ref string) string {
+	sum := sha256.Sum256([]byte(ref))
+	return "opaque:" + hex.EncodeToString(sum[:])
+}
+
+// wrapAccessToken replaces the access token in the data of an auth answer by
+// a reference when the broker runs in opaque mode
+func (app *Config) wrapAccessToken(ctx context.Context, data any) error {
+	if app.Opaque == nil {
+		return nil
+	}
+
+	fields, ok := data.(map[string]any)
+	if !ok {
+		return nil
+	}
+	access, _ := fields["token"].(string)
+	if access == "" {
+		return nil
+	}
+
+	expiresAt, _ := fields["expires_at"].(string)
+	expires, err := time.Parse(time.RFC3339, expiresAt)
+	if err != nil {
+		return errors.New("authentication-service answered a token without expiry")
+	}
+
+	ref, err := app.Opaque.wrap(ctx, access, expires)
+	if err != nil {
+		return err
+	}
+	fields["token"] = ref
+
+	return nil
+}
+
+// exchangeTokens swaps a token reference in the Authorization header for the
+// access token it stands for, so the services behind the broker get the
+// claims. Requests with an unknown reference are refused; bearer tokens that
+// are not references pass as they are. The bearer token is kept in the
+// context for callService, the reference for the handlers that end it.
+func (app *Config) exchangeTokens(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw := token.FromRequest(r)
+		if raw == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		if app.Opaque != nil && strings.HasPrefix(raw, opaquePrefix) {
+			access, err := app.Opaque.resolve(ctx, raw)
+			if errors.Is(err, errOpaqueUnknown) {
+				app.errorJson(w, err, http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				app.errorJson(w, err, http.StatusServiceUnavailable)
+				return
+			}
+
+			ctx = context.WithValue(ctx, referenceKey{}, raw)
+			raw = access
+			r.Header.Set("Authorization", "Bearer "+access)
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, bearerKey{}, raw)))
+	})
+}
+
+// forwardedBearer returns the bearer token of the request behind ctx, the
+// access token when the request carried a reference
+func forwardedBearer(ctx context.Context) string {
+	raw, _ := ctx.Value(bearerKey{}).(string)
+	return raw
+}
+
+// tokenReference returns the token reference the request behind ctx carried,
+// "" when it had none
+func tokenReference(ctx context.Context) string {
+	ref, _ := ctx.Value(referenceKey{}).(string)
+	return ref
+}
+
+// revokeCallerReference forgets the reference the caller used, after its
+// session ended or its token was replaced
+func (app *Config) revokeCallerReference(ctx context.Context) {
+	ref := tokenReference(ctx)
+	if app.Opaque == nil || ref == "" {
+		return
+	}
+	if err := app.Opaque.revoke(ctx, ref); err != nil {
+		log.Println("Error revoking a token reference:", err)
+	}
+}
+
+// ExchangeToken answers the access token behind a reference, for the services
+// that were handed a reference instead of a token. They call it with their
+// service token, see requireService.
+func (app *Config) ExchangeToken(w http.ResponseWriter, r *http.Request) {
+	var requestPayload struct {
+		Token string `json:"token"`
+	}
+
+	if err := app.readJson(w, r, &requestPayload); err != nil {
+		app.errorJson(w, err)
+		return
+	}
+	if app.Opaque == nil {
+		app.errorJson(w, errors.New("the broker does not hand out token references, TOKEN_MODE is jwt"), http.StatusNotFound)
+		return
+	}
+
+	access, err := app.Opaque.resolve(r.Context(), requestPayload.Token)
+	if errors.Is(err, errOpaqueUnknown) {
+		app.errorJson(w, err, http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		app.errorJson(w, err, http.StatusServiceUnavailable)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: "token exchanged",
+		Data:    map[string]string{"token": access, "token_type": "Bearer"},
+	})
+}
+
+// RevokeTokenReference forgets the reference of the caller, its access token
+// stays valid for the services until it expires
+func (app *Config) RevokeTokenReference(w http.ResponseWriter, r *http.Request) {
+	ref := tokenReference(r.Context())
+	if app.Opaque == nil || ref == "" {
+		app.errorJson(w, errors.New("missing token reference"))
+		return
+	}
+
+	if err := app.Opaque.revoke(r.Context(), ref); err != nil {
+		app.errorJson(w, err, http.StatusServiceUnavailable)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: "token reference revoked",
+	})
+}
@@ -1,13 +1,137 @@
 package main
 
 import (
+	"contracts/loglevel"
+	"contracts/negotiate"
+	"contracts/ratelimit"
+	"contracts/timeout"
+	"errors"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 )
 
+// noTimeout is the timeout of routes that must not have one
+const noTimeout time.Duration = -1
+
+// scopes a route can require
+const (
+	scopeAdmin   = "admin"
+	scopeService = "service"
+)
+
+// route declares one endpoint with the middleware it needs. A zero rate means
+// no limit, a zero timeout the RequestTimeout of the service and noTimeout
+// none, for routes that stream.
+type route struct {
+	method  string
+	path    string
+	handler http.HandlerFunc
+	scopes  []string
+	rate    int // requests per minute per client
+	timeout time.Duration
+}
+
+func (app *Config) routeTable() []route {
+	routes := []route{
+		{method: "GET", path: "/version", handler: app.Version},
+
+		// orchestrator probes and the preStop hook, the drain waits on purpose
+		{method: "GET", path: "/livez", handler: app.Lifecycle.Livez},
+		{method: "GET", path: "/healthz", handler: app.Lifecycle.Healthz, timeout: 5 * time.Second},
+		{method: "GET", path: "/readyz", handler: app.Lifecycle.Readyz, timeout: 5 * time.Second},
+		{method: "POST", path: "/drain", handler: app.Lifecycle.Drain, timeout: noTimeout},
+
+		{method: "GET", path: "/admin/loglevel", handler: loglevel.GetHandler, scopes: []string{scopeAdmin}},
+		{method: "PUT", path: "/admin/loglevel", handler: loglevel.SetHandler, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+
+		{method: "POST", path: "/", handler: app.Broker, timeout: 30 * time.Second},
+		{method: "POST", path: "/handle", handler: app.HandleSubmission, rate: 300, timeout: 30 * time.Second},
+
+		{method: "GET", path: "/jobs/{id}", handler: app.GetJob, timeout: 15 * time.Second},
+
+		// streams stay open, they have no timeout
+		{method: "GET", path: "/events", handler: app.Events, rate: 60, timeout: noTimeout},
+		{method: "GET", path: "/ws", handler: app.WebSocket, rate: 60, timeout: noTimeout},
+		{method: "POST", path: "/events/token", handler: app.IssueStreamToken, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+		{method: "POST", path: "/admin/notifications", handler: app.Notify, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+
+		// token references of TOKEN_MODE=opaque, the exchange is for the
+		// services that were handed a reference
+		{method: "POST", path: "/tokens/exchange", handler: app.ExchangeToken, scopes: []string{scopeService}, timeout: 10 * time.Second},
+		{method: "POST", path: "/tokens/revoke", handler: app.RevokeTokenReference, rate: 60, timeout: 10 * time.Second},
+
+		{method: "GET", path: "/admin/keys", handler: app.ListKeys, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+		{method: "POST", path: "/admin/keys/{id}/revoke", handler: app.RevokeKey, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+	}
+
+	for source, receiver := range app.webhookReceivers() {
+		routes = append(routes, route{
+			method:  "POST",
+			path:    "/webhooks/" + source,
+			handler: receiver.ServeHTTP,
+			rate:    600,
+			timeout: 30 * time.Second,
+		})
+	}
+
+	// uploads stream for as long as the client sends
+	for name, target := range app.UploadTargets {
+		routes = append(routes, route{
+			method:  "POST",
+			path:    "/uploads/" + name,
+			handler: app.uploadHandler(target),
+			rate:    30,
+			timeout: noTimeout,
+		})
+	}
+
+	return routes
+}
+
+// scopeMiddleware returns the middleware that checks a scope
+func (app *Config) scopeMiddleware(scope string) func(http.Handler) http.Handler {
+	switch scope {
+	case scopeAdmin:
+		return app.requireAdmin
+	case scopeService:
+		return app.requireService
+	}
+	panic(fmt.Sprintf("unknown scope %q", scope))
+}
+
+// routeMiddleware builds the middleware of a route: scopes first so that
+// rejected requests do not use up the rate limit, then the rate limit and the
+// timeout
+func (app *Config) routeMiddleware(rt route) []func(http.Handler) http.Handler {
+	var mws []func(http.Handler) http.Handler
+
+	for _, scope := range rt.scopes {
+		mws = append(mws, app.scopeMiddleware(scope))
+	}
+	if rt.rate > 0 {
+		mws = append(mws, ratelimit.New(app.Redis, rt.method+" "+rt.path, rt.rate).Middleware)
+	}
+	d := rt.timeout
+	if d == 0 {
+		d = app.RequestTimeout
+	}
+	if d > 0 {
+		mws = append(mws, timeout.Middleware(d, http.HandlerFunc(app.timedOut)))
+	}
+
+	return mws
+}
+
+// timedOut answers the requests whose handler ran out of time
+func (app *Config) timedOut(w http.ResponseWriter, r *http.Request) {
+	app.errorJson(w, errors.New("request timed out"), http.StatusGatewayTimeout)
+}
+
 func (app *Config) routes() http.Handler {
 	mux := chi.NewRouter()
 
@@ -15,16 +139,27 @@ func (app *Config) routes() http.Handler {
 		AllowedOrigins:   []string{"https://*", "http://*"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		ExposedHeaders:   []string{"Link", "X-Stream-Token"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
 
 	mux.Use(middleware.Heartbeat("/ping"))
 
-	mux.Post("/", app.Broker)
+	mux.Use(loglevel.DebugRequests)
+
+	mux.Use(negotiate.Middleware)
+
+	mux.Use(countRequests)
+
+	mux.Use(app.Capture.middleware)
+
+	// token references are swapped for access tokens before any handler
+	mux.Use(app.exchangeTokens)
 
-	mux.Post("/handle", app.HandleSubmission)
+	for _, rt := range app.routeTable() {
+		mux.With(app.routeMiddleware(rt)...).Method(rt.method, rt.path, rt.handler)
+	}
 
 	return mux
 }
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// shadow mirrors a share of the requests sent to a downstream service to a
+// second deployment of it, e.g. a new auth version, and records where the two
+// answer differently. Callers only ever get the primary's answer.
+type shadow struct {
+	app     *Config
+	name    string
+	baseURL string
+	percent float64
+	ignore  map[string]bool
+	client  *http.Client
+	slots   chan struct{}
+}
+
+// newShadow returns nil, which mirrors nothing, when baseURL is empty
+func newShadow(app *Config, name, baseURL string, percent float64, ignore string) *shadow {
+	if baseURL == "" || percent <= 0 {
+		return nil
+	}
+
+	s := &shadow{
+		app:     app,
+		name:    name,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		percent: percent,
+		ignore:  make(map[string]bool),
+		client:  &http.Client{Timeout: 5 * time.Second},
+		// at most this many mirrored requests in flight, the rest are skipped
+		slots: make(chan struct{}, 50),
+	}
+
+	for _, field := range strings.Split(ignore, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			s.ignore[field] = true
+		}
+	}
+
+	return s
+}
+
+type shadowDiff struct {
+	Target        string          `json:"target"`
+	Path          string          `json:"path"`
+	PrimaryStatus int             `json:"primary_status"`
+	ShadowStatus  int             `json:"shadow_status,omitempty"`
+	PrimaryBody   json.RawMessage `json:"primary_body,omitempty"`
+	ShadowBody    json.RawMessage `json:"shadow_body,omitempty"`
+	Error         string          `json:"error,omitempty"`
+}
+
+// mirror sends the request to the shadow in the background when it is sampled
+func (s *shadow) mirror(path string, body []byte, primaryStatus int, primaryBody []byte) {
+	if s == nil || rand.Float64()*100 >= s.percent {
+		return
+	}
+
+	select {
+	case s.slots <- struct{}{}:
+	default:
+		return
+	}
+
+	go func() {
+		defer func() { <-s.slots }()
+
+		diff := s.compare(path, body, primaryStatus, primaryBody)
+		if diff == nil {
+			return
+		}
+
+		jsonData, _ := json.Marshal(diff)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		err := s.app.sendLog(ctx, LogPayload{Name: "shadow_diff", Data: string(jsonData)})
+		if err != nil {
+			log.Println("Error recording shadow diff:", err)
+		}
+	}()
+}
+
+// compare calls the shadow and returns nil when it answered like the primary
+func (s *shadow) compare(path string, body []byte, primaryStatus int, primaryBody []byte) *shadowDiff {
+	diff := &shadowDiff{
+		Target:        s.name,
+		Path:          path,
+		PrimaryStatus: primaryStatus,
+		PrimaryBody:   asJSON(primaryBody),
+	}
+
+	request, err := http.NewRequest("POST", s.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		diff.Error = err.Error()
+		return diff
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		diff.Error = err.Error()
+		return diff
+	}
+	defer response.Body.Close()
+
+	shadowBody, err := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		diff.Error = err.Error()
+		return diff
+	}
+
+	diff.ShadowStatus = response.StatusCode
+	diff.ShadowBody = asJSON(shadowBody)
+
+	if response.StatusCode == primaryStatus && s.sameBody(primaryBody, shadowBody) {
+		return nil
+	}
+
+	return diff
+}
+
+// sameBody compares two JSON bodies, leaving out the ignored fields at any depth
+func (s *shadow) sameBody(a, b []byte) bool {
+	var va, vb any
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return bytes.Equal(a, b)
+	}
+
+	return reflect.DeepEqual(s.strip(va), s.strip(vb))
+}
+
+func (s *shadow) strip(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if s.ignore[key] {
+				delete(v, key)
+				continue
+			}
+			v[key] = s.strip(value)
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = s.strip(value)
+		}
+	}
+	return v
+}
+
+// asJSON keeps a body as raw JSON in the diff, or quotes it when it is not JSON
+func asJSON(body []byte) json.RawMessage {
+	if len(body) == 0 {
+		return nil
+	}
+	if json.Valid(body) {
+		return body
+	}
+	quoted, _ := json.Marshal(string(body))
+	return quoted
+}
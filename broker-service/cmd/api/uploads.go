@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// defaultUploadMaxBytes bounds the uploads of targets that set no limit
+const defaultUploadMaxBytes = 10 << 20
+
+var (
+	// errUnsupportedFileType is returned for files of a type the target refuses
+	errUnsupportedFileType = errors.New("unsupported file type")
+	// errUploadAnswered stops the copy of an upload the service answered
+	errUploadAnswered = errors.New("upload answered")
+)
+
+// uploadTarget is a service multipart uploads are streamed to, configured
+// through UPLOAD_TARGETS, e.g.
+//
+//	{"avatar": {"url": "http://authentication-service/v1/me/avatar",
+//	            "max_bytes": 5242880, "content_types": ["image/png", "image/jpeg"]},
+//	 "users-import": {"url": "http://authentication-service/admin/users/import",
+//	                  "content_types": ["text/csv"]}}
+//
+// and served on POST /uploads/<name>. MaxBytes bounds the whole body, files
+// of other content types than ContentTypes are refused.
+type uploadTarget struct {
+	URL          string   `json:"url"`
+	MaxBytes     int64    `json:"max_bytes"`
+	ContentTypes []string `json:"content_types"`
+}
+
+func parseUploadTargets(s string) (map[string]uploadTarget, error) {
+	targets := make(map[string]uploadTarget)
+	if s == "" {
+		return targets, nil
+	}
+
+	if err := json.Unmarshal([]byte(s), &targets); err != nil {
+		return nil, fmt.Errorf("invalid UPLOAD_TARGETS: %w", err)
+	}
+
+	for name, target := range targets {
+		if target.URL == "" {
+			return nil, fmt.Errorf("invalid UPLOAD_TARGETS: %s has no url", name)
+		}
+		if target.MaxBytes <= 0 {
+			target.MaxBytes = defaultUploadMaxBytes
+		}
+		targets[name] = target
+	}
+
+	return targets, nil
+}
+
+// uploadHandler streams multipart uploads to a target part by part, so files
+// are never held in memory. Each file part is checked against the content
+// types of the target, by the type the client declared and, for images, by
+// its first bytes; the caller's Authorization header goes along.
+func (app *Config) uploadHandler(target uploadTarget) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || mediaType != "multipart/form-data" || params["boundary"] == "" {
+			app.errorJson(w, errors.New("Body must be multipart/form-data"), http.StatusUnsupportedMediaType)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, target.MaxBytes)
+		in := multipart.NewReader(r.Body, params["boundary"])
+
+		body, pw := io.Pipe()
+		out := multipart.NewWriter(pw)
+
+		// the body is written while the service reads it, the error of the
+		// copy tells why the request failed
+		copied := make(chan error, 1)
+		go func() {
+			err := copyParts(out, in, target.ContentTypes)
+			if err == nil {
+				err = out.Close()
+			}
+			pw.CloseWithError(err)
+			copied <- err
+		}()
+
+		request, err := http.NewRequestWithContext(r.Context(), "POST", target.URL, body)
+		if err != nil {
+			body.CloseWithError(err)
+			<-copied
+			app.errorJson(w, err, http.StatusInternalServerError)
+			return
+		}
+		request.Header.Set("Content-Type", out.FormDataContentType())
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			request.Header.Set("Authorization", auth)
+		}
+
+		// a service may answer before it read the whole body, the rest of
+		// the upload is dropped then
+		response, err := http.DefaultClient.Do(request)
+		body.CloseWithError(errUploadAnswered)
+		if copyErr := <-copied; copyErr != nil && !errors.Is(copyErr, errUploadAnswered) {
+			if response != nil {
+				response.Body.Close()
+			}
+			app.uploadError(w, copyErr)
+			return
+		}
+		if err != nil {
+			app.errorJson(w, err, http.StatusBadGateway)
+			return
+		}
+		defer response.Body.Close()
+
+		for _, header := range []string{"Content-Type", "Location"} {
+			if value := response.Header.Get(header); value != "" {
+				w.Header().Set(header, value)
+			}
+		}
+		w.WriteHeader(response.StatusCode)
+		io.Copy(w, response.Body)
+	}
+}
+
+// copyParts writes the parts of in to out as they arrive
+func copyParts(out *multipart.Writer, in *multipart.Reader, contentTypes []string) error {
+	for {
+		part, err := in.NextRawPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		src := bufio.NewReaderSize(part, 512)
+		if part.FileName() != "" {
+			if err := checkFileType(part.Header.Get("Content-Type"), src, contentTypes); err != nil {
+				return err
+			}
+		}
+
+		dst, err := out.CreatePart(part.Header)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(dst, src); err != nil {
+			return err
+		}
+	}
+}
+
+// checkFileType refuses files whose declared type is not allowed, and images
+// whose first bytes are of another type than the declared one
+func checkFileType(declared string, src *bufio.Reader, allowed []string) error {
+	mediaType, _, err := mime.ParseMediaType(declared)
+	if err != nil || !slices.Contains(allowed, mediaType) {
+		return fmt.Errorf("%w %q, expected one of %s", errUnsupportedFileType, declared, strings.Join(allowed, ", "))
+	}
+
+	if strings.HasPrefix(mediaType, "image/") {
+		head, err := src.Peek(512)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if sniffed := http.DetectContentType(head); sniffed != mediaType {
+			return fmt.Errorf("%w: file declared as %s is %s", errUnsupportedFileType, mediaType, sniffed)
+		}
+	}
+
+	return nil
+}
+
+func (app *Config) uploadError(w http.ResponseWriter, err error) {
+	var maxErr *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &maxErr):
+		app.errorJson(w, fmt.Errorf("Body must not be larger than %d bytes", maxErr.Limit), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, errUnsupportedFileType):
+		app.errorJson(w, err, http.StatusUnsupportedMediaType)
+	default:
+		app.errorJson(w, err)
+	}
+}
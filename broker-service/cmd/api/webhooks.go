@@ -0,0 +1,72 @@
+package main
+
+import (
+	"broker/webhook"
+	"context"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// parseWebhookSecrets reads WEBHOOK_SECRETS, e.g. "mail:s3cret,billing:new|old".
+// A source may list several secrets separated by | while one is being rotated.
+func parseWebhookSecrets(s string) map[string][]string {
+	secrets := make(map[string][]string)
+
+	for _, item := range strings.Split(s, ",") {
+		source, list, ok := strings.Cut(strings.TrimSpace(item), ":")
+		if !ok || source == "" {
+			continue
+		}
+
+		for _, secret := range strings.Split(list, "|") {
+			if secret = strings.TrimSpace(secret); secret != "" {
+				secrets[source] = append(secrets[source], secret)
+			}
+		}
+	}
+
+	return secrets
+}
+
+// webhookReceivers builds one receiver per configured source. Until a source has
+// its own handler, verified events are recorded in the logger service.
+func (app *Config) webhookReceivers() map[string]*webhook.Receiver {
+	receivers := make(map[string]*webhook.Receiver)
+
+	for source, secrets := range app.WebhookSecrets {
+		receiver := webhook.NewReceiver(source, secrets, app.logWebhook)
+		if app.Redis != nil {
+			receiver.Deliveries = redisDeliveries{rdb: app.Redis, source: source}
+		}
+		receivers[source] = receiver
+	}
+
+	return receivers
+}
+
+func (app *Config) logWebhook(ctx context.Context, e webhook.Event) error {
+	return app.sendLog(ctx, LogPayload{
+		Name: "webhook." + e.Source,
+		Data: string(e.Body),
+	})
+}
+
+// redisDeliveries deduplicates the deliveries of a source across the replicas
+type redisDeliveries struct {
+	rdb    *redis.Client
+	source string
+}
+
+func (d redisDeliveries) key(id string) string {
+	return "webhook:" + d.source + ":" + id
+}
+
+func (d redisDeliveries) Claim(ctx context.Context, id string, ttl time.Duration) (bool, error) {
+	return d.rdb.SetNX(ctx, d.key(id), 1, ttl).Result()
+}
+
+func (d redisDeliveries) Release(ctx context.Context, id string) error {
+	return d.rdb.Del(ctx, d.key(id)).Err()
+}
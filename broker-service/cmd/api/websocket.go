@@ -0,0 +1,260 @@
+package main
+
+import (
+	"broker/events"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsWriteWait  = 10 * time.Second
+	wsPongWait   = 60 * time.Second
+	wsPingPeriod = wsPongWait * 9 / 10
+	wsMaxMessage = 4096
+
+	// clients may send wsRateBurst messages at once and wsRatePerSecond after that
+	wsRatePerSecond = 5
+	wsRateBurst     = 20
+
+	// connections that keep sending over the limit are closed
+	wsMaxViolations = 10
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// browsers connect from the front end's origin, access is granted by the token
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// wsMessage is sent by clients to change their subscriptions
+type wsMessage struct {
+	Action string   `json:"action"`
+	Topics []string `json:"topics,omitempty"`
+}
+
+// wsReply answers a client message
+type wsReply struct {
+	Type    string   `json:"type"`
+	Topics  []string `json:"topics,omitempty"`
+	Message string   `json:"message,omitempty"`
+}
+
+// rateLimiter is a token bucket for the messages of one connection
+type rateLimiter struct {
+	tokens float64
+	last   time.Time
+}
+
+func (l *rateLimiter) allow(now time.Time) bool {
+	l.tokens += now.Sub(l.last).Seconds() * wsRatePerSecond
+	if l.tokens > wsRateBurst {
+		l.tokens = wsRateBurst
+	}
+	l.last = now
+
+	if l.tokens < 1 {
+		return false
+	}
+
+	l.tokens--
+	return true
+}
+
+// WebSocket upgrades the connection and relays the events of the topics the
+// client subscribes to. The token, from ?token= or a Bearer header, says which
+// topics the client may subscribe to; they are all subscribed on connect.
+func (app *Config) WebSocket(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		token = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+
+	granted, err := app.StreamTokens.Topics(token)
+	if err != nil {
+		app.errorJson(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println("Error upgrading websocket:", err)
+		return
+	}
+
+	c := &wsClient{
+		app:        app,
+		conn:       conn,
+		granted:    make(map[string]bool),
+		subscribed: make(map[string]bool),
+		events:     make(chan events.Event, 64),
+		replies:    make(chan wsReply, 8),
+		done:       make(chan struct{}),
+	}
+
+	for _, topic := range granted {
+		c.granted[topic] = true
+	}
+
+	c.subscribe(granted)
+	defer c.close()
+
+	// hijacked connections are not closed by the shutdown, the client is
+	// told to reconnect to another replica
+	go func() {
+		select {
+		case <-app.Lifecycle.Stopping():
+			c.reply(wsReply{Type: "closing", Message: "server shutting down, reconnect"})
+			time.AfterFunc(wsWriteWait, func() { c.conn.Close() })
+		case <-c.done:
+		}
+	}()
+
+	go c.writePump()
+	c.readPump()
+}
+
+type wsClient struct {
+	app  *Config
+	conn *websocket.Conn
+
+	granted    map[string]bool
+	subscribed map[string]bool
+
+	events  chan events.Event
+	replies chan wsReply
+	done    chan struct{}
+}
+
+func (c *wsClient) subscribe(topics []string) []string {
+	var added []string
+
+	for _, topic := range topics {
+		if c.granted[topic] && !c.subscribed[topic] {
+			c.subscribed[topic] = true
+			added = append(added, topic)
+		}
+	}
+
+	c.app.Hub.Add(c.events, added...)
+	return added
+}
+
+func (c *wsClient) unsubscribe(topics []string) {
+	var removed []string
+
+	for _, topic := range topics {
+		if c.subscribed[topic] {
+			delete(c.subscribed, topic)
+			removed = append(removed, topic)
+		}
+	}
+
+	c.app.Hub.Remove(c.events, removed...)
+}
+
+func (c *wsClient) close() {
+	var topics []string
+	for topic := range c.subscribed {
+		topics = append(topics, topic)
+	}
+	c.app.Hub.Remove(c.events, topics...)
+
+	close(c.done)
+	c.conn.Close()
+}
+
+// readPump handles client messages until the connection breaks
+func (c *wsClient) readPump() {
+	c.conn.SetReadLimit(wsMaxMessage)
+	c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	limiter := &rateLimiter{tokens: wsRateBurst, last: time.Now()}
+	violations := 0
+
+	for {
+		_, raw, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		if !limiter.allow(time.Now()) {
+			violations++
+			if violations >= wsMaxViolations {
+				c.reply(wsReply{Type: "error", Message: "rate limit exceeded, closing"})
+				return
+			}
+			c.reply(wsReply{Type: "error", Message: "rate limit exceeded"})
+			continue
+		}
+
+		var msg wsMessage
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			c.reply(wsReply{Type: "error", Message: "invalid message"})
+			continue
+		}
+
+		switch msg.Action {
+		case "subscribe":
+			c.reply(wsReply{Type: "subscribed", Topics: c.subscribe(msg.Topics)})
+		case "unsubscribe":
+			c.unsubscribe(msg.Topics)
+			c.reply(wsReply{Type: "unsubscribed", Topics: msg.Topics})
+		case "ping":
+			c.reply(wsReply{Type: "pong"})
+		default:
+			c.reply(wsReply{Type: "error", Message: "unknown action"})
+		}
+	}
+}
+
+func (c *wsClient) reply(r wsReply) {
+	select {
+	case c.replies <- r:
+	default:
+	}
+}
+
+// writePump is the only writer of the connection
+func (c *wsClient) writePump() {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+
+	for {
+		var msg any
+		ping := false
+
+		select {
+		case <-c.done:
+			return
+		case e := <-c.events:
+			msg = e
+		case r := <-c.replies:
+			msg = r
+		case <-ticker.C:
+			ping = true
+		}
+
+		c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+
+		var err error
+		if ping {
+			err = c.conn.WriteMessage(websocket.PingMessage, nil)
+		} else {
+			err = c.conn.WriteJSON(msg)
+		}
+
+		if err != nil {
+			c.conn.Close()
+			return
+		}
+	}
+}
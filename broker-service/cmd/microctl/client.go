@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+type response struct {
+	Error   bool            `json:"error"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// adminClient calls the admin APIs with the X-Admin-Key header
+type adminClient struct {
+	key string
+}
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+func (c *adminClient) do(method, url string, body any, out any) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	request, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("X-Admin-Key", c.key)
+	request.Header.Set("Accept", "application/json")
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	var payload response
+	if err := json.NewDecoder(res.Body).Decode(&payload); err != nil {
+		return fmt.Errorf("%s %s: %s", method, url, res.Status)
+	}
+
+	if payload.Error || res.StatusCode >= 400 {
+		return errors.New(payload.Message)
+	}
+
+	if out != nil && len(payload.Data) > 0 {
+		return json.Unmarshal(payload.Data, out)
+	}
+	return nil
+}
+
+// ping reports how long GET /ping takes, or the error
+func ping(url string) (time.Duration, error) {
+	start := time.Now()
+
+	res, err := httpClient.Get(url + "/ping")
+	if err != nil {
+		return 0, err
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("status %s", res.Status)
+	}
+
+	return time.Since(start), nil
+}
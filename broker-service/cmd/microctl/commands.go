@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+func health(c *adminClient, svc services) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(w, "SERVICE\tURL\tSTATUS\tLATENCY")
+	for _, s := range []struct{ name, url string }{
+		{"broker", svc.broker},
+		{"authentication", svc.auth},
+		{"logger", svc.logger},
+	} {
+		latency, err := ping(s.url)
+		if err != nil {
+			fmt.Fprintf(w, "%s\t%s\tdown: %v\t-\n", s.name, s.url, err)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\tup\t%s\n", s.name, s.url, latency.Round(time.Millisecond))
+	}
+	w.Flush()
+
+	var beats []struct {
+		Service  string    `json:"service"`
+		LastSeen time.Time `json:"last_seen"`
+		Interval int64     `json:"interval_seconds"`
+	}
+	if err := c.do("GET", svc.logger+"/admin/heartbeats", nil, &beats); err != nil {
+		return fmt.Errorf("heartbeats: %w", err)
+	}
+
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "HEARTBEAT\tLAST SEEN\tINTERVAL\tMISSED")
+	for _, b := range beats {
+		missed := 0
+		if b.Interval > 0 {
+			missed = int(time.Since(b.LastSeen) / (time.Duration(b.Interval) * time.Second))
+		}
+		fmt.Fprintf(w, "%s\t%s ago\t%ds\t%d\n", b.Service, time.Since(b.LastSeen).Round(time.Second), b.Interval, missed)
+	}
+	w.Flush()
+
+	var slos []struct {
+		Service                string  `json:"service"`
+		Availability           float64 `json:"availability"`
+		AvailabilityTarget     float64 `json:"availability_target"`
+		AvailabilityBudgetLeft float64 `json:"availability_budget_left"`
+		Latency                float64 `json:"latency"`
+		LatencyTarget          float64 `json:"latency_target"`
+		LatencyThreshold       string  `json:"latency_threshold"`
+	}
+	if err := c.do("GET", svc.logger+"/slo", nil, &slos); err != nil {
+		return fmt.Errorf("slo: %w", err)
+	}
+
+	if len(slos) > 0 {
+		fmt.Println()
+		w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "SLO	AVAILABILITY	BUDGET LEFT	LATENCY")
+		for _, s := range slos {
+			fmt.Fprintf(w, "%s	%.3f%% (target %.3f%%)	%.1f%%	%.2f%% under %s (target %.2f%%)\n",
+				s.Service, s.Availability, s.AvailabilityTarget, s.AvailabilityBudgetLeft,
+				s.Latency, s.LatencyThreshold, s.LatencyTarget)
+		}
+		w.Flush()
+	}
+
+	return nil
+}
+
+func tokens(c *adminClient, svc services, args []string, grace time.Duration) error {
+	if len(args) == 0 {
+		var list []map[string]any
+		if err := c.do("GET", svc.logger+"/admin/tokens", nil, &list); err != nil {
+			return err
+		}
+		return printJSON(list)
+	}
+
+	if len(args) < 2 {
+		return fmt.Errorf("usage: microctl tokens [issue <producer>|rotate <id>|revoke <id>]")
+	}
+
+	var out any
+
+	switch args[0] {
+	case "issue":
+		if err := c.do("POST", svc.logger+"/admin/tokens", map[string]string{"producer": args[1]}, &out); err != nil {
+			return err
+		}
+	case "rotate":
+		body := map[string]int{"grace_seconds": int(grace / time.Second)}
+		if err := c.do("POST", svc.logger+"/admin/tokens/"+args[1]+"/rotate", body, &out); err != nil {
+			return err
+		}
+	case "revoke":
+		if err := c.do("DELETE", svc.logger+"/admin/tokens/"+args[1], nil, nil); err != nil {
+			return err
+		}
+		fmt.Println("revoked", args[1])
+		return nil
+	default:
+		return fmt.Errorf("unknown tokens command %q", args[0])
+	}
+
+	return printJSON(out)
+}
+
+// jobState is the part of a job microctl shows
+type jobState struct {
+	ID       string          `json:"id"`
+	Kind     string          `json:"kind"`
+	Status   string          `json:"status"`
+	Progress int             `json:"progress"`
+	Message  string          `json:"message"`
+	Result   json.RawMessage `json:"result,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+func (j jobState) done() bool {
+	return j.Status == "succeeded" || j.Status == "failed"
+}
+
+func backup(c *adminClient, svc services, wait bool) error {
+	var j jobState
+	if err := c.do("POST", svc.logger+"/admin/backups", nil, &j); err != nil {
+		return err
+	}
+
+	fmt.Println("backup started, job", j.ID)
+
+	if !wait {
+		return nil
+	}
+	return job(c, svc, j.ID, true)
+}
+
+// job shows a job through the broker, which routes it to the service that owns it
+func job(c *adminClient, svc services, id string, wait bool) error {
+	for {
+		var j jobState
+		if err := c.do("GET", svc.broker+"/jobs/"+id, nil, &j); err != nil {
+			return err
+		}
+
+		if !wait || j.done() {
+			return printJSON(j)
+		}
+
+		fmt.Printf("%s %3d%% %s\n", j.Status, j.Progress, j.Message)
+		time.Sleep(2 * time.Second)
+	}
+}
+
+func alertTest(c *adminClient, svc services) error {
+	var results any
+	if err := c.do("POST", svc.logger+"/admin/alerts/test", nil, &results); err != nil {
+		return err
+	}
+	return printJSON(results)
+}
+
+func printJSON(v any) error {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
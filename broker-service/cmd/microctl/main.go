@@ -0,0 +1,96 @@
+// Command microctl runs common operations across the platform through the
+// admin APIs of the services.
+//
+//	microctl health                     ping every service and show heartbeats and SLOs
+//	microctl tokens                     list the logger's ingest tokens
+//	microctl tokens issue <producer>    issue an ingest token
+//	microctl tokens rotate <id>         rotate an ingest token, -grace keeps the old one valid
+//	microctl tokens revoke <id>         revoke an ingest token
+//	microctl backup                     start a log backup, -wait follows the job
+//	microctl job <id>                   show a job, -wait follows it until it ends
+//	microctl alert-test                 send a test alert to every notifier
+//
+// The admin API key comes from -key or ADMIN_API_KEY, service URLs from flags
+// or BROKER_URL, AUTH_URL and LOGGER_URL.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+type services struct {
+	broker string
+	auth   string
+	logger string
+}
+
+func main() {
+	log.SetFlags(0)
+
+	var svc services
+
+	key := flag.String("key", os.Getenv("ADMIN_API_KEY"), "admin API key")
+	flag.StringVar(&svc.broker, "broker", envOr("BROKER_URL", "http://localhost:8081"), "broker-service URL")
+	flag.StringVar(&svc.auth, "auth", envOr("AUTH_URL", "http://localhost:8082"), "authentication-service URL")
+	flag.StringVar(&svc.logger, "logger", envOr("LOGGER_URL", "http://localhost:8083"), "logger-service URL")
+	wait := flag.Bool("wait", false, "follow the started job until it ends")
+	grace := flag.Duration("grace", time.Hour, "how long a rotated token keeps working")
+	flag.Usage = usage
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		usage()
+	}
+
+	if *key == "" {
+		log.Fatal("an admin API key is required, use -key or ADMIN_API_KEY")
+	}
+
+	c := &adminClient{key: *key}
+	svc.broker = strings.TrimRight(svc.broker, "/")
+	svc.auth = strings.TrimRight(svc.auth, "/")
+	svc.logger = strings.TrimRight(svc.logger, "/")
+
+	var err error
+
+	switch args[0] {
+	case "health":
+		err = health(c, svc)
+	case "tokens":
+		err = tokens(c, svc, args[1:], *grace)
+	case "backup":
+		err = backup(c, svc, *wait)
+	case "job":
+		if len(args) < 2 {
+			usage()
+		}
+		err = job(c, svc, args[1], *wait)
+	case "alert-test":
+		err = alertTest(c, svc)
+	default:
+		usage()
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: microctl [flags] health|tokens|backup|job <id>|alert-test")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,213 @@
+// Command replay re-sends requests captured by a service in capture mode (see
+// CAPTURE_ROUTES) against a target environment and reports the responses that
+// differ from the captured ones.
+//
+//	replay -target http://staging-broker -path /handle -since 2h
+//
+// Captured secrets are masked, so requests that need them can be given fresh
+// ones with -header, e.g. -header "X-Admin-Key: ...".
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type capture struct {
+	ID             string            `json:"id"`
+	Service        string            `json:"service"`
+	Method         string            `json:"method"`
+	Path           string            `json:"path"`
+	Query          string            `json:"query"`
+	RequestHeaders map[string]string `json:"request_headers"`
+	RequestBody    string            `json:"request_body"`
+	Status         int               `json:"status"`
+	ResponseBody   string            `json:"response_body"`
+}
+
+type headers []string
+
+func (h *headers) String() string     { return strings.Join(*h, ", ") }
+func (h *headers) Set(v string) error { *h = append(*h, v); return nil }
+
+// hop-by-hop and computed headers are not replayed
+var skippedHeaders = map[string]bool{
+	"Content-Length":    true,
+	"Connection":        true,
+	"Transfer-Encoding": true,
+	"Accept-Encoding":   true,
+}
+
+func main() {
+	log.SetFlags(0)
+
+	loggerURL := flag.String("logger", envOr("LOGGER_URL", "http://localhost:8083"), "logger-service URL holding the captures")
+	key := flag.String("key", os.Getenv("ADMIN_API_KEY"), "admin API key of the logger")
+	target := flag.String("target", "", "base URL the requests are replayed against")
+	service := flag.String("service", "broker", "service whose captures are replayed")
+	method := flag.String("method", "", "only captures of this method")
+	path := flag.String("path", "", "only captures of this path")
+	since := flag.Duration("since", 24*time.Hour, "only captures this recent")
+	limit := flag.Int("limit", 100, "maximum number of captures (1-1000)")
+	delay := flag.Duration("delay", 0, "pause between two requests")
+	dryRun := flag.Bool("dry-run", false, "list the captures without sending them")
+	var extra headers
+	flag.Var(&extra, "header", `header added to every request, "Name: value", repeatable`)
+	flag.Parse()
+
+	if *key == "" {
+		log.Fatal("an admin API key is required, use -key or ADMIN_API_KEY")
+	}
+	if *target == "" && !*dryRun {
+		log.Fatal("-target is required")
+	}
+
+	captures, err := fetchCaptures(strings.TrimRight(*loggerURL, "/"), *key, url.Values{
+		"service": {*service},
+		"method":  {strings.ToUpper(*method)},
+		"path":    {*path},
+		"since":   {since.String()},
+		"limit":   {strconv.Itoa(*limit)},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("%d captures", len(captures))
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	same, different, failed := 0, 0, 0
+
+	for i, c := range captures {
+		if *dryRun {
+			fmt.Printf("%s %s %s -> %d\n", c.ID, c.Method, c.Path, c.Status)
+			continue
+		}
+
+		if i > 0 && *delay > 0 {
+			time.Sleep(*delay)
+		}
+
+		status, body, err := replay(client, strings.TrimRight(*target, "/"), c, extra)
+		switch {
+		case err != nil:
+			failed++
+			fmt.Printf("FAIL %s %s %s: %v\n", c.ID, c.Method, c.Path, err)
+		case status != c.Status || !sameJSON(body, c.ResponseBody):
+			different++
+			fmt.Printf("DIFF %s %s %s: status %d, captured %d\n", c.ID, c.Method, c.Path, status, c.Status)
+		default:
+			same++
+		}
+	}
+
+	if !*dryRun {
+		log.Printf("%d same, %d different, %d failed", same, different, failed)
+	}
+	if different > 0 || failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func fetchCaptures(loggerURL, key string, params url.Values) ([]capture, error) {
+	for k, v := range params {
+		if v[0] == "" {
+			params.Del(k)
+		}
+	}
+
+	request, err := http.NewRequest("GET", loggerURL+"/admin/captures?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("X-Admin-Key", key)
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	var payload struct {
+		Error   bool      `json:"error"`
+		Message string    `json:"message"`
+		Data    []capture `json:"data"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&payload); err != nil {
+		return nil, fmt.Errorf("logger answered %s", response.Status)
+	}
+	if payload.Error {
+		return nil, errors.New(payload.Message)
+	}
+
+	return payload.Data, nil
+}
+
+func replay(client *http.Client, target string, c capture, extra headers) (int, string, error) {
+	u := target + c.Path
+	if c.Query != "" {
+		u += "?" + c.Query
+	}
+
+	request, err := http.NewRequest(c.Method, u, strings.NewReader(c.RequestBody))
+	if err != nil {
+		return 0, "", err
+	}
+
+	for name, value := range c.RequestHeaders {
+		if !skippedHeaders[http.CanonicalHeaderKey(name)] {
+			request.Header.Set(name, value)
+		}
+	}
+	for _, h := range extra {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok {
+			return 0, "", fmt.Errorf("invalid header %q", h)
+		}
+		request.Header.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, "", err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, 64<<10))
+	if err != nil {
+		return 0, "", err
+	}
+
+	return response.StatusCode, string(body), nil
+}
+
+// sameJSON compares two bodies as JSON when both are, byte for byte otherwise
+func sameJSON(a, b string) bool {
+	var va, vb any
+	if json.Unmarshal([]byte(a), &va) != nil || json.Unmarshal([]byte(b), &vb) != nil {
+		return a == b
+	}
+
+	ja, _ := json.Marshal(va)
+	jb, _ := json.Marshal(vb)
+
+	return bytes.Equal(ja, jb)
+}
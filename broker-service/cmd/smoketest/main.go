@@ -0,0 +1,272 @@
+// Command smoketest runs a scripted flow against a deployed environment and
+// exits non-zero when a step fails, for post-deploy verification:
+//
+//	ping       the broker answers /ping
+//	register   a throwaway user is registered on the authentication service
+//	login      the user authenticates through the broker
+//	log        an entry is written through the broker
+//	query      the entry can be found on the logger service
+//	mail       skipped, there is no mail service yet
+//	cleanup    the throwaway user is deleted
+//
+// The admin API key comes from -key or ADMIN_API_KEY, service URLs from flags
+// or BROKER_URL, AUTH_URL and LOGGER_URL. With -json the report is printed as
+// JSON instead of a table.
+package main
+
+import (
+	"broker/client"
+	"bytes"
+	"context"
+	v1 "contracts/v1"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// step results
+const (
+	statusPass = "pass"
+	statusFail = "fail"
+	statusSkip = "skip"
+)
+
+// result is the outcome of one step of the flow
+type result struct {
+	Step     string `json:"step"`
+	Status   string `json:"status"`
+	Duration string `json:"duration"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+type smoke struct {
+	broker  *client.Client
+	auth    string
+	logger  string
+	key     string
+	timeout time.Duration
+
+	runID    string
+	email    string
+	password string
+	userID   int
+
+	results []result
+}
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+func main() {
+	log.SetFlags(0)
+
+	brokerURL := flag.String("broker", envOr("BROKER_URL", "http://localhost:8081"), "broker-service URL")
+	authURL := flag.String("auth", envOr("AUTH_URL", "http://localhost:8082"), "authentication-service URL")
+	loggerURL := flag.String("logger", envOr("LOGGER_URL", "http://localhost:8083"), "logger-service URL")
+	key := flag.String("key", os.Getenv("ADMIN_API_KEY"), "admin API key")
+	timeout := flag.Duration("timeout", 30*time.Second, "how long to wait for the log entry to show up")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	flag.Parse()
+
+	if *key == "" {
+		log.Fatal("an admin API key is required, use -key or ADMIN_API_KEY")
+	}
+
+	runID := fmt.Sprintf("smoke-%d", time.Now().UnixNano())
+
+	s := &smoke{
+		broker:   client.New(strings.TrimRight(*brokerURL, "/"), client.WithRetries(2, 500*time.Millisecond)),
+		auth:     strings.TrimRight(*authURL, "/"),
+		logger:   strings.TrimRight(*loggerURL, "/"),
+		key:      *key,
+		timeout:  *timeout,
+		runID:    runID,
+		email:    runID + "@smoketest.invalid",
+		password: runID + "-Pw!",
+	}
+
+	s.run()
+
+	if *asJSON {
+		out, _ := json.MarshalIndent(s.results, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		for _, r := range s.results {
+			fmt.Printf("%-4s  %-9s %8s  %s\n", strings.ToUpper(r.Status), r.Step, r.Duration, r.Detail)
+		}
+	}
+
+	for _, r := range s.results {
+		if r.Status == statusFail {
+			os.Exit(1)
+		}
+	}
+}
+
+// run goes through the steps; a failed step skips the ones that need it
+func (s *smoke) run() {
+	ctx := context.Background()
+
+	up := s.step("ping", true, func() (string, error) {
+		return "", s.broker.Ping(ctx)
+	})
+
+	registered := s.step("register", up, s.register)
+
+	s.step("login", registered, func() (string, error) {
+		user, err := s.broker.Authenticate(ctx, s.email, s.password)
+		if err != nil {
+			return "", err
+		}
+		if user.ID != s.userID {
+			return "", fmt.Errorf("logged in as user %d, registered %d", user.ID, s.userID)
+		}
+		return fmt.Sprintf("user %d", user.ID), nil
+	})
+
+	logged := s.step("log", up, func() (string, error) {
+		return s.runID, s.broker.Log(ctx, "smoketest", s.runID)
+	})
+
+	s.step("query", logged, s.query)
+
+	s.results = append(s.results, result{Step: "mail", Status: statusSkip, Duration: "0s", Detail: "no mail service in this deployment"})
+
+	s.step("cleanup", registered, s.cleanup)
+}
+
+// step runs fn when ok and records its result. It returns whether the step passed.
+func (s *smoke) step(name string, ok bool, fn func() (string, error)) bool {
+	if !ok {
+		s.results = append(s.results, result{Step: name, Status: statusSkip, Duration: "0s", Detail: "an earlier step failed"})
+		return false
+	}
+
+	start := time.Now()
+	detail, err := fn()
+
+	r := result{Step: name, Status: statusPass, Duration: time.Since(start).Round(time.Millisecond).String(), Detail: detail}
+	if err != nil {
+		r.Status = statusFail
+		r.Detail = err.Error()
+	}
+	s.results = append(s.results, r)
+
+	return err == nil
+}
+
+// register creates an active throwaway user on the authentication service
+func (s *smoke) register() (string, error) {
+	var user v1.User
+
+	err := s.call(http.MethodPost, s.auth+"/register", "", v1.RegisterRequest{
+		Email:     s.email,
+		Password:  s.password,
+		FirstName: "Smoke",
+		LastName:  "Test",
+		Active:    true,
+	}, &user)
+	if err != nil {
+		return "", err
+	}
+
+	s.userID = user.ID
+
+	return fmt.Sprintf("user %d %s", user.ID, s.email), nil
+}
+
+// query waits for the entry written by the log step to be searchable. Entries
+// go through the logger's batching writer, so it can take a moment.
+func (s *smoke) query() (string, error) {
+	q := url.Values{"q": {fmt.Sprintf("name:smoketest AND data:%q", s.runID)}, "limit": {"1"}}
+	deadline := time.Now().Add(s.timeout)
+
+	for {
+		var entries []json.RawMessage
+
+		err := s.call(http.MethodGet, s.logger+"/logs?"+q.Encode(), s.key, nil, &entries)
+		if err != nil {
+			return "", err
+		}
+		if len(entries) > 0 {
+			return "entry found", nil
+		}
+
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("entry %s not found after %s", s.runID, s.timeout)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// cleanup deletes the throwaway user
+func (s *smoke) cleanup() (string, error) {
+	payload := map[string]any{"operation": "delete", "ids": []int{s.userID}}
+
+	if err := s.call(http.MethodPost, s.auth+"/admin/users/bulk", s.key, payload, nil); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("user %d deleted", s.userID), nil
+}
+
+// call sends a JSON request, with the admin key when key is set, and decodes
+// the data of the answer into out
+func (s *smoke) call(method, target, key string, body, out any) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	request, err := http.NewRequest(method, target, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if key != "" {
+		request.Header.Set("X-Admin-Key", key)
+	}
+
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	var answer struct {
+		Error   bool            `json:"error"`
+		Message string          `json:"message"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&answer); err != nil {
+		return fmt.Errorf("%s %s: %s", method, target, response.Status)
+	}
+
+	if answer.Error || response.StatusCode >= 400 {
+		return errors.New(answer.Message)
+	}
+
+	if out != nil && len(answer.Data) > 0 {
+		return json.Unmarshal(answer.Data, out)
+	}
+	return nil
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,216 @@
+// Package events fans events out to the clients connected to this broker. With
+// Redis configured every replica subscribes to the same channels, so an event
+// published anywhere reaches clients on every replica.
+package events
+
+import (
+	"context"
+	"contracts/eventschema"
+	"contracts/keystore"
+	"contracts/signing"
+	v1 "contracts/v1"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// channelPrefix is put in front of the topic to get the Redis channel. Other
+// services publish to the same channels.
+const channelPrefix = "events:"
+
+// Consumer is the name the logger replays lost events to the hubs under, on
+// the channels of v1.ReplayChannel
+const Consumer = "broker"
+
+// Event is one message on a topic, e.g. topic "job:auth-1f2e" with type "job"
+type Event = v1.Event
+
+// Hub delivers published events to the local subscribers of their topic
+type Hub struct {
+	// Version is stamped on the events published by this hub
+	Version string
+
+	redis *redis.Client
+
+	// keys sign the events published by this hub and verify those read from
+	// Redis, with the keys of the events purpose
+	keys *keystore.Store
+	seen map[string]time.Time
+
+	mu   sync.RWMutex
+	subs map[string]map[chan Event]struct{}
+}
+
+// NewHub returns a hub. When rdb is nil events only reach clients of this
+// replica. When keys holds event keys, events from Redis that are unsigned,
+// wrongly signed, signed with a revoked key, too old or already seen are dropped.
+func NewHub(rdb *redis.Client, keys *keystore.Store) *Hub {
+	h := &Hub{
+		redis: rdb,
+		keys:  keys,
+		seen:  make(map[string]time.Time),
+		subs:  make(map[string]map[chan Event]struct{}),
+	}
+
+	if rdb != nil {
+		go h.listen()
+	}
+
+	return h
+}
+
+// Publish sends an event to every subscriber of topic
+func (h *Hub) Publish(ctx context.Context, topic, eventType string, data any) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	// the id is set even without a signing key, the logger stores events by it
+	e := Event{ID: signing.NewID(), Topic: topic, Type: eventType, Data: raw, Schema: eventschema.Events.Current(eventType), Version: h.Version}
+	if key, err := h.keys.Signing(keystore.PurposeEvents); err == nil {
+		signing.SignEvent(&e, key)
+	}
+
+	if h.redis == nil {
+		h.deliver(e)
+		return nil
+	}
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	return h.redis.Publish(ctx, channelPrefix+topic, payload).Err()
+}
+
+// Subscribe returns a channel with the events of the topics. Call the returned
+// function to unsubscribe. Slow subscribers miss events rather than block others.
+func (h *Hub) Subscribe(topics []string) (<-chan Event, func()) {
+	ch := make(chan Event, 32)
+
+	h.Add(ch, topics...)
+
+	return ch, func() {
+		h.Remove(ch, topics...)
+	}
+}
+
+// Add subscribes an existing channel to more topics
+func (h *Hub) Add(ch chan Event, topics ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, topic := range topics {
+		if h.subs[topic] == nil {
+			h.subs[topic] = make(map[chan Event]struct{})
+		}
+		h.subs[topic][ch] = struct{}{}
+	}
+}
+
+// Remove unsubscribes a channel from the topics
+func (h *Hub) Remove(ch chan Event, topics ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, topic := range topics {
+		delete(h.subs[topic], ch)
+		if len(h.subs[topic]) == 0 {
+			delete(h.subs, topic)
+		}
+	}
+}
+
+func (h *Hub) deliver(e Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for ch := range h.subs[e.Topic] {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// listen relays the events of every replica and service from Redis, and the
+// events replayed to the hubs, and subscribes again when the connection is lost
+func (h *Hub) listen() {
+	replayPrefix := v1.ReplayChannel(Consumer, "")
+
+	for {
+		pubsub := h.redis.PSubscribe(context.Background(), channelPrefix+"*", replayPrefix+"*")
+
+		for msg := range pubsub.Channel() {
+			var e Event
+			if err := json.Unmarshal([]byte(msg.Payload), &e); err != nil {
+				log.Println("Dropping malformed event:", err)
+				continue
+			}
+
+			e.Replayed = strings.HasPrefix(msg.Channel, replayPrefix)
+
+			if e.Topic == "" {
+				e.Topic = strings.TrimPrefix(strings.TrimPrefix(msg.Channel, replayPrefix), channelPrefix)
+			}
+
+			if err := h.verify(e, time.Now()); err != nil {
+				log.Printf("Dropping event %s on %s: %v", e.ID, e.Topic, err)
+				continue
+			}
+
+			// clients get the data of every event in its current shape
+			if err := eventschema.Events.Upcast(&e); err != nil {
+				log.Printf("Dropping event %s on %s: %v", e.ID, e.Topic, err)
+				continue
+			}
+
+			h.deliver(e)
+		}
+
+		pubsub.Close()
+		log.Println("Event subscription closed, subscribing again")
+		time.Sleep(time.Second)
+	}
+}
+
+// verify checks the signature of an event read from Redis and that it was
+// not delivered before. Only listen calls it, so seen needs no lock.
+func (h *Hub) verify(e Event, now time.Time) error {
+	if !h.keys.Has(keystore.PurposeEvents) {
+		return nil
+	}
+
+	keys := h.keys.Verifying(keystore.PurposeEvents)
+	if err := signing.VerifyEvent(e, keys, now, signing.DefaultTolerance); err != nil {
+		return err
+	}
+
+	for id, expires := range h.seen {
+		if now.After(expires) {
+			delete(h.seen, id)
+		}
+	}
+
+	// an event the logger replays was seen before, once on the bus
+	id := e.ID
+	if e.Replayed {
+		id = "replay:" + id
+	}
+
+	if _, ok := h.seen[id]; ok {
+		return errors.New("replayed event")
+	}
+
+	// ids are kept a little longer than a replayed signature stays valid
+	h.seen[id] = now.Add(2 * signing.DefaultTolerance)
+
+	return nil
+}
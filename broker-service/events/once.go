@@ -0,0 +1,207 @@
+package events
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// DefaultProcessedTTL is how long the id of a processed event is kept. The
+	// bus redelivers within seconds, a replay from the logger within its
+	// retention; a replay older than this runs the handler again.
+	DefaultProcessedTTL = 24 * time.Hour
+
+	// DefaultProcessingTimeout is how long a handler may run before another
+	// delivery of the event is let through, e.g. after the consumer crashed
+	DefaultProcessingTimeout = 5 * time.Minute
+)
+
+// Processed records the ids of the events a consumer handled
+type Processed interface {
+	// Claim marks id as in progress for ttl and reports false when it is in
+	// progress or was processed already
+	Claim(ctx context.Context, id string, ttl time.Duration) (bool, error)
+	// Complete keeps id as processed for ttl
+	Complete(ctx context.Context, id string, ttl time.Duration) error
+	// Release forgets id so a failed event can be handled again
+	Release(ctx context.Context, id string) error
+}
+
+// HandlerFunc handles one event. Returning an error lets the next delivery of
+// the event run the handler again.
+type HandlerFunc func(ctx context.Context, e Event) error
+
+// Once runs the handlers of a consumer once per event id, for handlers with
+// side effects such as sending the welcome mail. Handlers that fail are run
+// again on the next delivery; handlers that were interrupted are run again
+// after ProcessingTimeout.
+type Once struct {
+	// Consumer names the consumer, two consumers handle the same event
+	// independently
+	Consumer string
+
+	// Processed is shared by the replicas of the consumer, in the memory of
+	// this process when nil
+	Processed Processed
+
+	// TTL is how long processed ids are kept, DefaultProcessedTTL when zero
+	TTL time.Duration
+
+	// ProcessingTimeout is how long a handler may run, DefaultProcessingTimeout
+	// when zero
+	ProcessingTimeout time.Duration
+
+	memoryOnce sync.Once
+	memory     *memoryProcessed
+}
+
+// NewOnce returns the deduplication of a consumer, shared through Redis when
+// rdb is set
+func NewOnce(consumer string, rdb *redis.Client) *Once {
+	o := &Once{Consumer: consumer}
+	if rdb != nil {
+		o.Processed = RedisProcessed(rdb)
+	}
+	return o
+}
+
+// Handle runs fn for e unless it was processed already, and reports if fn ran.
+// Events without an id can not be told apart and always run fn.
+func (o *Once) Handle(ctx context.Context, e Event, fn HandlerFunc) (bool, error) {
+	if e.ID == "" {
+		return true, fn(ctx, e)
+	}
+
+	processed := o.processed()
+	id := o.Consumer + ":" + e.ID
+
+	first, err := processed.Claim(ctx, id, o.processingTimeout())
+	if err != nil {
+		// running it anyway could run it twice, the caller retries
+		return false, err
+	}
+	if !first {
+		return false, nil
+	}
+
+	if err := fn(ctx, e); err != nil {
+		if err := processed.Release(context.WithoutCancel(ctx), id); err != nil {
+			log.Printf("Releasing event %s of %s failed, it is retried after %s: %v", e.ID, o.Consumer, o.processingTimeout(), err)
+		}
+		return true, err
+	}
+
+	if err := processed.Complete(context.WithoutCancel(ctx), id, o.ttl()); err != nil {
+		log.Printf("Marking event %s of %s processed failed, a redelivery after %s runs it again: %v", e.ID, o.Consumer, o.processingTimeout(), err)
+	}
+
+	return true, nil
+}
+
+// Wrap returns fn running once per event id. Duplicates are dropped silently.
+func (o *Once) Wrap(fn HandlerFunc) HandlerFunc {
+	return func(ctx context.Context, e Event) error {
+		_, err := o.Handle(ctx, e, fn)
+		return err
+	}
+}
+
+func (o *Once) processed() Processed {
+	if o.Processed != nil {
+		return o.Processed
+	}
+
+	o.memoryOnce.Do(func() {
+		o.memory = newMemoryProcessed()
+	})
+	return o.memory
+}
+
+func (o *Once) ttl() time.Duration {
+	if o.TTL > 0 {
+		return o.TTL
+	}
+	return DefaultProcessedTTL
+}
+
+func (o *Once) processingTimeout() time.Duration {
+	if o.ProcessingTimeout > 0 {
+		return o.ProcessingTimeout
+	}
+	return DefaultProcessingTimeout
+}
+
+// RedisProcessed returns a Processed shared by every replica using rdb
+func RedisProcessed(rdb *redis.Client) Processed {
+	return redisProcessed{rdb: rdb}
+}
+
+type redisProcessed struct {
+	rdb *redis.Client
+}
+
+func (p redisProcessed) key(id string) string {
+	return "processed:" + id
+}
+
+func (p redisProcessed) Claim(ctx context.Context, id string, ttl time.Duration) (bool, error) {
+	return p.rdb.SetNX(ctx, p.key(id), "processing", ttl).Result()
+}
+
+func (p redisProcessed) Complete(ctx context.Context, id string, ttl time.Duration) error {
+	return p.rdb.Set(ctx, p.key(id), "done", ttl).Err()
+}
+
+func (p redisProcessed) Release(ctx context.Context, id string) error {
+	return p.rdb.Del(ctx, p.key(id)).Err()
+}
+
+// memoryProcessed keeps the ids of one process until they expire
+type memoryProcessed struct {
+	mu  sync.Mutex
+	ids map[string]time.Time
+}
+
+func newMemoryProcessed() *memoryProcessed {
+	return &memoryProcessed{ids: make(map[string]time.Time)}
+}
+
+func (p *memoryProcessed) Claim(_ context.Context, id string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key, expires := range p.ids {
+		if now.After(expires) {
+			delete(p.ids, key)
+		}
+	}
+
+	if _, ok := p.ids[id]; ok {
+		return false, nil
+	}
+
+	p.ids[id] = now.Add(ttl)
+	return true, nil
+}
+
+func (p *memoryProcessed) Complete(_ context.Context, id string, ttl time.Duration) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.ids[id] = time.Now().Add(ttl)
+	return nil
+}
+
+func (p *memoryProcessed) Release(_ context.Context, id string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.ids, id)
+	return nil
+}
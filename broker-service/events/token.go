@@ -0,0 +1,89 @@
+package events
+
+import (
+	"contracts/keystore"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken is returned for stream tokens that are forged, malformed or expired
+var ErrInvalidToken = errors.New("invalid stream token")
+
+// Tokens signs and checks stream tokens. A token names the topics its holder may
+// subscribe to, so it can be passed as a query parameter by EventSource, which
+// can not send headers. Tokens are signed with the stream keys of the keystore
+// and name the key that signed them:
+//
+//	<base64 claims>.<key id>.<base64 hmac-sha256 of the claims>
+type Tokens struct {
+	Keys *keystore.Store
+}
+
+// Issue returns a token for the topics that is valid for ttl, or "" when there
+// is no stream key to sign it
+func (t Tokens) Issue(topics []string, ttl time.Duration) string {
+	if t.Keys == nil {
+		return ""
+	}
+
+	key, err := t.Keys.Signing(keystore.PurposeStream)
+	if err != nil {
+		return ""
+	}
+
+	claims := strings.Join(topics, ",") + "|" + strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	payload := base64.RawURLEncoding.EncodeToString([]byte(claims))
+
+	return payload + "." + key.ID + "." + sign(key.Secret, payload)
+}
+
+// Enabled tells if there is a stream key to issue tokens with
+func (t Tokens) Enabled() bool {
+	if t.Keys == nil {
+		return false
+	}
+	_, err := t.Keys.Signing(keystore.PurposeStream)
+	return err == nil
+}
+
+// Topics checks a token and returns the topics it grants
+func (t Tokens) Topics(token string) ([]string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || t.Keys == nil {
+		return nil, ErrInvalidToken
+	}
+	payload, id, signature := parts[0], parts[1], parts[2]
+
+	key, err := t.Keys.Lookup(keystore.PurposeStream, id)
+	if err != nil || !hmac.Equal([]byte(signature), []byte(sign(key.Secret, payload))) {
+		return nil, ErrInvalidToken
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	list, expires, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return nil, ErrInvalidToken
+	}
+
+	return strings.Split(list, ","), nil
+}
+
+func sign(secret []byte, payload string) string {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
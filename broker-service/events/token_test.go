@@ -0,0 +1,69 @@
+package events
+
+import (
+	"contracts/keystore"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testTokens() Tokens {
+	keys := keystore.New()
+	keys.AddSecrets(keystore.PurposeStream, []string{"test-stream-secret"})
+	return Tokens{Keys: keys}
+}
+
+func TestTopics(t *testing.T) {
+	tokens := testTokens()
+
+	raw := tokens.Issue([]string{"logs", "user:42"}, time.Minute)
+	topics, err := tokens.Topics(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"logs", "user:42"}; !reflect.DeepEqual(topics, want) {
+		t.Fatalf("got %v, want %v", topics, want)
+	}
+
+	for name, bad := range map[string]string{
+		"expired":   tokens.Issue([]string{"logs"}, -time.Minute),
+		"forged":    raw[:len(raw)-2] + "AA",
+		"other key": testTokensWith("other-secret").Issue([]string{"logs"}, time.Minute),
+		"malformed": strings.ReplaceAll(raw, ".", ""),
+	} {
+		if _, err := tokens.Topics(bad); err != ErrInvalidToken {
+			t.Errorf("%s: got %v, want ErrInvalidToken", name, err)
+		}
+	}
+}
+
+func testTokensWith(secret string) Tokens {
+	keys := keystore.New()
+	keys.AddSecrets(keystore.PurposeStream, []string{secret})
+	return Tokens{Keys: keys}
+}
+
+// FuzzTopics feeds Topics arbitrary strings, which it must refuse without a
+// panic unless they carry the signature of the stream key
+func FuzzTopics(f *testing.F) {
+	tokens := testTokens()
+
+	f.Add(tokens.Issue([]string{"logs", "user:42"}, time.Hour))
+	f.Add(tokens.Issue(nil, time.Hour))
+	f.Add("")
+	f.Add("..")
+	f.Add("bG9nc3w5OTk5OTk5OTk5.x.y")
+
+	f.Fuzz(func(t *testing.T, raw string) {
+		topics, err := tokens.Topics(raw)
+		if err != nil {
+			return
+		}
+
+		parts := strings.Split(raw, ".")
+		if sign([]byte("test-stream-secret"), parts[0]) != parts[2] {
+			t.Fatalf("accepted %q without its signature, topics %v", raw, topics)
+		}
+	})
+}
@@ -5,4 +5,16 @@ go 1.23
 require (
 	github.com/go-chi/chi/v5 v5.1.0
 	github.com/go-chi/cors v1.2.1
+	github.com/gorilla/websocket v1.5.3
+	github.com/redis/go-redis/v9 v9.7.3
+	github.com/vmihailenco/msgpack/v5 v5.4.1
 )
+
+require (
+	contracts v0.0.0
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+)
+
+replace contracts => ../contracts
@@ -0,0 +1,205 @@
+// Package webhook receives signed webhooks from outside services. It checks the
+// HMAC signature, rejects replays and drops deliveries it has already processed,
+// so handlers only ever see each verified event once.
+//
+// Senders sign the raw body as described in contracts/signing and give every
+// delivery a unique Webhook-Id. Processed ids are kept in memory unless the
+// receiver is given shared Deliveries, which replicas behind a load balancer
+// need to drop the redeliveries that reach another replica.
+package webhook
+
+import (
+	"context"
+	"contracts/signing"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	SignatureHeader = signing.SignatureHeader
+	IDHeader        = signing.IDHeader
+)
+
+var (
+	ErrMissingSignature = signing.ErrMissingSignature
+	ErrInvalidSignature = signing.ErrInvalidSignature
+	ErrStaleTimestamp   = signing.ErrStaleTimestamp
+	ErrMissingID        = signing.ErrMissingID
+)
+
+// Event is one verified delivery
+type Event struct {
+	ID         string
+	Source     string
+	ReceivedAt time.Time
+	Body       []byte
+	Header     http.Header
+}
+
+// Deliveries records the delivery ids that were processed
+type Deliveries interface {
+	// Claim marks id as processed for ttl and reports false when it already was
+	Claim(ctx context.Context, id string, ttl time.Duration) (bool, error)
+	// Release forgets id so a failed delivery can be retried
+	Release(ctx context.Context, id string) error
+}
+
+// HandlerFunc processes a verified event. Returning an error answers 500 and
+// lets the sender retry, the delivery is then processed again.
+type HandlerFunc func(ctx context.Context, e Event) error
+
+// Receiver verifies and dispatches webhooks from one source
+type Receiver struct {
+	Source string
+
+	// Secrets are tried in order, so a secret can be rotated by listing the new
+	// one first and removing the old one once the sender has switched
+	Secrets []string
+
+	// Tolerance is the allowed clock skew of the signed timestamp, 5 minutes by default
+	Tolerance time.Duration
+
+	// MaxBody limits the body size, 1 MB by default
+	MaxBody int64
+
+	Handler HandlerFunc
+
+	// Deliveries deduplicates deliveries, in the memory of this process when nil
+	Deliveries Deliveries
+
+	seen *seenStore
+}
+
+// NewReceiver returns a receiver for source with the default tolerance and body limit
+func NewReceiver(source string, secrets []string, handler HandlerFunc) *Receiver {
+	return &Receiver{
+		Source:  source,
+		Secrets: secrets,
+		Handler: handler,
+		seen:    newSeenStore(),
+	}
+}
+
+// Sign returns the signature header value for body, used by senders and tooling
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	return signing.Sign(secret, timestamp, body)
+}
+
+// Verify checks the signature header against body at time now
+func (rc *Receiver) Verify(header string, body []byte, now time.Time) error {
+	return signing.Verify(header, body, rc.Secrets, now, rc.tolerance())
+}
+
+func (rc *Receiver) tolerance() time.Duration {
+	if rc.Tolerance > 0 {
+		return rc.Tolerance
+	}
+	return signing.DefaultTolerance
+}
+
+// ServeHTTP verifies the delivery and runs the handler once per delivery id
+func (rc *Receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	maxBody := rc.MaxBody
+	if maxBody <= 0 {
+		maxBody = 1 << 20
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBody))
+	if err != nil {
+		http.Error(w, "body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	now := time.Now()
+
+	if err := rc.Verify(r.Header.Get(SignatureHeader), body, now); err != nil {
+		log.Printf("Rejected %s webhook: %v", rc.Source, err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	id := r.Header.Get(IDHeader)
+	if id == "" {
+		http.Error(w, ErrMissingID.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var seen Deliveries = rc.seen
+	if rc.Deliveries != nil {
+		seen = rc.Deliveries
+	}
+
+	// ids are kept a little longer than a replayed signature stays valid
+	first, err := seen.Claim(r.Context(), id, 2*rc.tolerance())
+	if err != nil {
+		// processing it anyway could run the handler twice, the sender retries
+		log.Printf("Deduplicating %s webhook %s failed: %v", rc.Source, id, err)
+		http.Error(w, "try again later", http.StatusServiceUnavailable)
+		return
+	}
+	if !first {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	err = rc.Handler(r.Context(), Event{
+		ID:         id,
+		Source:     rc.Source,
+		ReceivedAt: now,
+		Body:       body,
+		Header:     r.Header,
+	})
+	if err != nil {
+		if err := seen.Release(context.WithoutCancel(r.Context()), id); err != nil {
+			log.Printf("Releasing %s webhook %s failed, its retries are dropped until it expires: %v", rc.Source, id, err)
+		}
+		log.Printf("Processing %s webhook %s failed: %v", rc.Source, id, err)
+		http.Error(w, "processing failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// seenStore remembers processed delivery ids until they expire
+type seenStore struct {
+	mu  sync.Mutex
+	ids map[string]time.Time
+}
+
+func newSeenStore() *seenStore {
+	return &seenStore{ids: make(map[string]time.Time)}
+}
+
+// Claim marks id as processed and reports false when it already was
+func (s *seenStore) Claim(_ context.Context, id string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, expires := range s.ids {
+		if now.After(expires) {
+			delete(s.ids, key)
+		}
+	}
+
+	if _, ok := s.ids[id]; ok {
+		return false, nil
+	}
+
+	s.ids[id] = now.Add(ttl)
+	return true, nil
+}
+
+// Release forgets id so a failed delivery can be retried
+func (s *seenStore) Release(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.ids, id)
+	return nil
+}
@@ -0,0 +1,303 @@
+// Package config reads the settings of a service. Every setting is an
+// environment variable; a command line flag named after it, in lower case with
+// dashes, overrides it, e.g. -mongo-url for MONGO_URL. Load puts the flags in
+// the environment, so the code reading settings directly, like configlint,
+// sees them too.
+//
+// The getters return the fallback for settings that are not set. Settings that
+// are set but invalid are collected instead of being silently replaced by the
+// fallback, Err reports them all at once before the service starts.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config reads settings and collects the invalid ones
+type Config struct {
+	errs []error
+}
+
+// Load applies the flags in args, usually os.Args[1:], to the environment.
+// Flags are -name=value or -name value, with one or two dashes; a flag without
+// a value is true.
+func Load(args []string) (*Config, error) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") || arg == "-" || arg == "--" {
+			return nil, fmt.Errorf("config: unexpected argument %q, settings are given as -name=value", arg)
+		}
+
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !hasValue {
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				i++
+				value = args[i]
+			} else {
+				value = "true"
+			}
+		}
+
+		if err := os.Setenv(Key(name), value); err != nil {
+			return nil, fmt.Errorf("config: flag -%s: %w", name, err)
+		}
+	}
+
+	return &Config{}, nil
+}
+
+// Key returns the environment variable of a flag name, MONGO_URL for mongo-url
+func Key(flag string) string {
+	return strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+// Flag returns the flag name of an environment variable, mongo-url for MONGO_URL
+func Flag(key string) string {
+	return strings.ToLower(strings.ReplaceAll(key, "_", "-"))
+}
+
+// invalid records a problem with a setting, once for settings read twice
+func (c *Config) invalid(key, format string, args ...any) {
+	err := fmt.Errorf("%s (-%s): %s", key, Flag(key), fmt.Sprintf(format, args...))
+	for _, e := range c.errs {
+		if e.Error() == err.Error() {
+			return
+		}
+	}
+	c.errs = append(c.errs, err)
+}
+
+// Err returns the invalid settings read so far, nil when there were none
+func (c *Config) Err() error {
+	return errors.Join(c.errs...)
+}
+
+// String returns a setting, fallback when it is not set
+func (c *Config) String(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// Required returns a setting that has no fallback
+func (c *Config) Required(key string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		c.invalid(key, "required")
+	}
+	return value
+}
+
+// OneOf returns a setting that takes one of values
+func (c *Config) OneOf(key, fallback string, values ...string) string {
+	value := c.String(key, fallback)
+	if !contains(values, value) {
+		c.invalid(key, "%q is not one of %s", value, strings.Join(values, ", "))
+		return fallback
+	}
+	return value
+}
+
+// Int returns a whole number setting
+func (c *Config) Int(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		c.invalid(key, "%q is not a whole number", value)
+		return fallback
+	}
+	return n
+}
+
+// Int64 returns a whole number setting that may not fit an int
+func (c *Config) Int64(key string, fallback int64) int64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		c.invalid(key, "%q is not a whole number", value)
+		return fallback
+	}
+	return n
+}
+
+// Float returns a decimal setting
+func (c *Config) Float(key string, fallback float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		c.invalid(key, "%q is not a number", value)
+		return fallback
+	}
+	return f
+}
+
+// Bool returns a true or false setting, see strconv.ParseBool
+func (c *Config) Bool(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		c.invalid(key, "%q is not true or false", value)
+		return fallback
+	}
+	return b
+}
+
+// Duration returns a duration setting of at least min, e.g. 30s or 24h
+func (c *Config) Duration(key string, fallback, min time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		c.invalid(key, "%q is not a duration like 30s or 5m", value)
+		return fallback
+	}
+	if d < min {
+		c.invalid(key, "%s is shorter than %s", d, min)
+		return fallback
+	}
+	return d
+}
+
+// Port returns a TCP port setting
+func (c *Config) Port(key, fallback string) string {
+	value := c.String(key, fallback)
+	if value == "" {
+		return ""
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > 65535 {
+		c.invalid(key, "%q is not a port", value)
+		return fallback
+	}
+	return value
+}
+
+// Addr returns a host:port setting, the host may be empty
+func (c *Config) Addr(key, fallback string) string {
+	value := c.String(key, fallback)
+	if value == "" {
+		return ""
+	}
+
+	_, port, err := net.SplitHostPort(value)
+	if err != nil {
+		c.invalid(key, "%q is not host:port", value)
+		return fallback
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		c.invalid(key, "%q has no valid port", value)
+		return fallback
+	}
+	return value
+}
+
+// URL returns an absolute URL setting with one of schemes, any scheme when
+// none are given
+func (c *Config) URL(key, fallback string, schemes ...string) string {
+	value := c.String(key, fallback)
+	if value == "" {
+		return ""
+	}
+
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		c.invalid(key, "%q is not an absolute URL", redact(value))
+		return fallback
+	}
+	if len(schemes) > 0 && !contains(schemes, u.Scheme) {
+		c.invalid(key, "scheme %s is not one of %s", u.Scheme, strings.Join(schemes, ", "))
+		return fallback
+	}
+	return value
+}
+
+// DSN returns a Postgres DSN setting, a postgres:// URL or key=value pairs.
+// Without a fallback it is required.
+func (c *Config) DSN(key, fallback string) string {
+	value := c.String(key, fallback)
+	if value == "" {
+		c.invalid(key, "required")
+		return ""
+	}
+
+	if err := checkDSN(value); err != nil {
+		c.invalid(key, "%v", err)
+		return fallback
+	}
+	return value
+}
+
+// checkDSN checks the form of a DSN without connecting
+func checkDSN(dsn string) error {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil || u.Host == "" {
+			return errors.New("not a valid postgres URL")
+		}
+		return nil
+	}
+
+	hasHost := false
+	for _, pair := range strings.Fields(dsn) {
+		name, _, ok := strings.Cut(pair, "=")
+		if !ok || name == "" {
+			return fmt.Errorf("%q is not key=value", redact(pair))
+		}
+		hasHost = hasHost || name == "host"
+	}
+	if !hasHost {
+		return errors.New("no host")
+	}
+	return nil
+}
+
+// redact hides the password of URLs and key=value settings in errors
+func redact(value string) string {
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "xxxxx")
+			return u.String()
+		}
+	}
+	if name, _, ok := strings.Cut(value, "="); ok && name == "password" {
+		return "password=xxxxx"
+	}
+	return value
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+// Package configlint checks the configuration of a service for settings that
+// are fine on a laptop and dangerous anywhere else: the passwords and secrets
+// of docker-compose, databases reached without TLS, debug logging. Outside
+// production the findings are logged; with APP_ENV=production the service
+// refuses to start unless ALLOW_INSECURE_CONFIG=true.
+package configlint
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// minSecretLength is the shortest secret accepted in production
+const minSecretLength = 16
+
+// defaultSecrets are the values shipped in docker-compose and the sources
+var defaultSecrets = []string{"password", "secret", "verysecret", "admin", "changeme"}
+
+// Finding is one insecure setting
+type Finding struct {
+	Setting string
+	Problem string
+}
+
+func (f Finding) String() string {
+	return f.Setting + ": " + f.Problem
+}
+
+// Lint collects the findings of a service
+type Lint struct {
+	Findings []Finding
+}
+
+// Add records a finding
+func (l *Lint) Add(setting, problem string, args ...any) {
+	l.Findings = append(l.Findings, Finding{Setting: setting, Problem: fmt.Sprintf(problem, args...)})
+}
+
+// Production tells if the service runs with APP_ENV=production
+func Production() bool {
+	return strings.EqualFold(os.Getenv("APP_ENV"), "production")
+}
+
+// Secret checks a secret: set, not a known default and long enough. Several
+// secrets separated by | are checked one by one.
+func (l *Lint) Secret(setting, value string) {
+	if value == "" {
+		l.Add(setting, "is not set")
+		return
+	}
+
+	for _, secret := range strings.Split(value, "|") {
+		secret = strings.TrimSpace(secret)
+		switch {
+		case isDefault(secret):
+			l.Add(setting, "holds a default value")
+		case len(secret) < minSecretLength:
+			l.Add(setting, "is shorter than %d characters", minSecretLength)
+		}
+	}
+}
+
+// Password checks a database password
+func (l *Lint) Password(setting, value string) {
+	if value == "" || isDefault(value) {
+		l.Add(setting, "holds an empty or default password")
+	}
+}
+
+// PostgresDSN checks a key=value or URL Postgres DSN for a default password
+// and a disabled TLS mode
+func (l *Lint) PostgresDSN(setting, dsn string) {
+	if dsn == "" {
+		return
+	}
+
+	params := make(map[string]string)
+	if u, err := url.Parse(dsn); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+		if password, ok := u.User.Password(); ok {
+			params["password"] = password
+		}
+		params["sslmode"] = u.Query().Get("sslmode")
+	} else {
+		for _, field := range strings.Fields(dsn) {
+			if key, value, ok := strings.Cut(field, "="); ok {
+				params[key] = value
+			}
+		}
+	}
+
+	l.Password(setting+" password", params["password"])
+
+	switch params["sslmode"] {
+	case "", "disable", "allow", "prefer":
+		l.Add(setting, "does not require TLS, set sslmode=require or stricter")
+	}
+}
+
+// MongoURL checks that a Mongo URL asks for TLS
+func (l *Lint) MongoURL(setting, uri string) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		l.Add(setting, "is not a valid URL")
+		return
+	}
+
+	q := u.Query()
+	if u.Scheme != "mongodb+srv" && q.Get("tls") != "true" && q.Get("ssl") != "true" {
+		l.Add(setting, "does not use TLS, add tls=true")
+	}
+}
+
+// HTTPS checks that an outbound URL uses TLS
+func (l *Lint) HTTPS(setting, raw string) {
+	if raw == "" {
+		return
+	}
+	if u, err := url.Parse(raw); err != nil || u.Scheme != "https" {
+		l.Add(setting, "is not an https URL")
+	}
+}
+
+// LogLevel flags debug logging, which writes request details to the logs
+func (l *Lint) LogLevel(setting, level string) {
+	if strings.EqualFold(level, "debug") {
+		l.Add(setting, "is debug")
+	}
+}
+
+// Enforce logs the findings. In production it stops the service when there are
+// any, unless ALLOW_INSECURE_CONFIG=true.
+func (l *Lint) Enforce(service string) {
+	if len(l.Findings) == 0 {
+		return
+	}
+
+	for _, f := range l.Findings {
+		log.Printf("Insecure configuration of %s: %s", service, f)
+	}
+
+	if !Production() {
+		return
+	}
+
+	if os.Getenv("ALLOW_INSECURE_CONFIG") == "true" {
+		log.Printf("Starting %s in production with %d insecure settings because ALLOW_INSECURE_CONFIG=true", service, len(l.Findings))
+		return
+	}
+
+	log.Fatalf("Refusing to start %s in production with %d insecure settings, fix them or set ALLOW_INSECURE_CONFIG=true", service, len(l.Findings))
+}
+
+func isDefault(secret string) bool {
+	s := strings.ToLower(secret)
+	if strings.HasPrefix(s, "change-me") || strings.Contains(s, "_dev_") {
+		return true
+	}
+	for _, d := range defaultSecrets {
+		if s == d {
+			return true
+		}
+	}
+	return false
+}
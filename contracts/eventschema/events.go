@@ -0,0 +1,24 @@
+package eventschema
+
+import (
+	"contracts/failover"
+	v1 "contracts/v1"
+)
+
+// Events holds the event types published on the bus. Publishers stamp
+// Events.Current on their events and consumers upcast with Events.Upcast.
+var Events = NewRegistry()
+
+func init() {
+	Events.Define("notification", 1, v1.Notification{})
+	Events.Define("mail.replied", 1, v1.MailReply{})
+	Events.Define("service.failover", 1, failover.Event{})
+
+	// data owned by one service, consumers only pass it on
+	Events.Define("job", 1, nil)
+	Events.Define("log", 1, nil)
+	Events.Define("crash.reported", 1, nil)
+	for _, status := range []string{"created", "regressed", "open", "resolved"} {
+		Events.Define("issue."+status, 1, nil)
+	}
+}
@@ -0,0 +1,218 @@
+// Package eventschema keeps old events readable after the shape of their data
+// changed. Every event type has a current schema version, stamped on the
+// events published with it; consumers upcast the data of older events one
+// version at a time, with the upcasters registered for the type, before they
+// use it.
+//
+// Changing the data of an event type is:
+//
+//	eventschema.Events.Define("notification", 2, v1.Notification{})
+//	eventschema.Events.Upcaster("notification", 1, func(data json.RawMessage) (json.RawMessage, error) {
+//		// rename "message" to "body"
+//	}, json.RawMessage(`{"user_id":1,"title":"t","message":"m"}`))
+//
+// The sample is data of the old version; Check upcasts every sample and
+// decodes it into the current type, so a missing or broken upcaster is found
+// when a service starts and not when an old event is replayed.
+package eventschema
+
+import (
+	"bytes"
+	v1 "contracts/v1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+var (
+	// ErrNewerSchema is returned for events of a schema the consumer does not
+	// know yet, published by a newer build
+	ErrNewerSchema = errors.New("eventschema: event is newer than its consumer")
+	// ErrNoUpcaster is returned when a version of a type can not be upcast
+	ErrNoUpcaster = errors.New("eventschema: no upcaster")
+)
+
+// Upcaster turns the data of one version of an event type into the next
+type Upcaster func(data json.RawMessage) (json.RawMessage, error)
+
+// Registry holds the current version and the upcasters of event types
+type Registry struct {
+	mu    sync.RWMutex
+	types map[string]*typeSchema
+}
+
+type typeSchema struct {
+	current   int
+	target    reflect.Type
+	upcasters map[int]Upcaster
+	samples   map[int]json.RawMessage
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{types: make(map[string]*typeSchema)}
+}
+
+// Define sets the current version of an event type and the Go type its data
+// decodes into. A nil target only requires the data to be JSON.
+func (r *Registry) Define(eventType string, current int, target any) {
+	if current < 1 {
+		panic(fmt.Sprintf("eventschema: version of %s must be at least 1", eventType))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t := r.typeOf(eventType)
+	t.current = current
+	t.target = nil
+	if target != nil {
+		t.target = reflect.TypeOf(target)
+	}
+}
+
+// Upcaster registers fn to turn version from of an event type into from+1.
+// Sample is data of version from, checked by Check.
+func (r *Registry) Upcaster(eventType string, from int, fn Upcaster, sample json.RawMessage) {
+	if from < 1 {
+		panic(fmt.Sprintf("eventschema: upcaster of %s must start at version 1 or later", eventType))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t := r.typeOf(eventType)
+	t.upcasters[from] = fn
+	t.samples[from] = sample
+}
+
+// typeOf returns the entry of an event type, creating it. The caller holds mu.
+func (r *Registry) typeOf(eventType string) *typeSchema {
+	t, ok := r.types[eventType]
+	if !ok {
+		t = &typeSchema{
+			current:   1,
+			upcasters: make(map[int]Upcaster),
+			samples:   make(map[int]json.RawMessage),
+		}
+		r.types[eventType] = t
+	}
+	return t
+}
+
+// Current is the version events of a type are published with, 1 for types
+// that were never defined
+func (r *Registry) Current(eventType string) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if t, ok := r.types[eventType]; ok {
+		return t.current
+	}
+	return 1
+}
+
+// Upcast brings the data of e to the current version of its type. Events
+// published before versioning count as version 1. The signature of e covers
+// the data it was published with, so events are verified before they are
+// upcast.
+func (r *Registry) Upcast(e *v1.Event) error {
+	version := max(e.Schema, 1)
+
+	r.mu.RLock()
+	t, ok := r.types[e.Type]
+	r.mu.RUnlock()
+
+	if !ok {
+		if version > 1 {
+			return fmt.Errorf("%w: %s version %d", ErrNewerSchema, e.Type, version)
+		}
+		return nil
+	}
+
+	data, err := t.upcast(e.Type, version, e.Data)
+	if err != nil {
+		return err
+	}
+
+	e.Data, e.Schema = data, t.current
+	return nil
+}
+
+func (t *typeSchema) upcast(name string, version int, data json.RawMessage) (json.RawMessage, error) {
+	if version > t.current {
+		return nil, fmt.Errorf("%w: %s version %d, current is %d", ErrNewerSchema, name, version, t.current)
+	}
+
+	for ; version < t.current; version++ {
+		fn, ok := t.upcasters[version]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s version %d", ErrNoUpcaster, name, version)
+		}
+
+		var err error
+		data, err = fn(data)
+		if err != nil {
+			return nil, fmt.Errorf("eventschema: upcasting %s version %d: %w", name, version, err)
+		}
+	}
+
+	return data, nil
+}
+
+// Check makes sure every older version of every type can be upcast, and that
+// the upcast samples decode into the type of the current version without
+// unknown fields. Services call it when they start.
+func (r *Registry) Check() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.types))
+	for name := range r.types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+
+	for _, name := range names {
+		t := r.types[name]
+
+		for version := 1; version < t.current; version++ {
+			data, err := t.upcast(name, version, t.samples[version])
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if err := t.decode(data); err != nil {
+				errs = append(errs, fmt.Errorf("eventschema: %s version %d does not decode after upcasting: %w", name, version, err))
+			}
+		}
+
+		for version := range t.upcasters {
+			if version >= t.current {
+				errs = append(errs, fmt.Errorf("eventschema: %s has an upcaster from version %d, current is %d", name, version, t.current))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// decode checks data against the current version of the type
+func (t *typeSchema) decode(data json.RawMessage) error {
+	if t.target == nil {
+		if !json.Valid(data) {
+			return errors.New("invalid JSON")
+		}
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	return dec.Decode(reflect.New(t.target).Interface())
+}
@@ -0,0 +1,120 @@
+package eventschema
+
+import (
+	"bytes"
+	v1 "contracts/v1"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestEventsCheck(t *testing.T) {
+	if err := Events.Check(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// renamed is version 2 of a notification, "message" became "body"
+type renamed struct {
+	UserID int    `json:"user_id"`
+	Title  string `json:"title"`
+	Body   string `json:"body"`
+}
+
+func renameMessage(data json.RawMessage) (json.RawMessage, error) {
+	var old map[string]any
+	if err := json.Unmarshal(data, &old); err != nil {
+		return nil, err
+	}
+	old["body"] = old["message"]
+	delete(old, "message")
+	return json.Marshal(old)
+}
+
+const sample = `{"user_id":1,"title":"t","message":"m"}`
+
+func TestUpcast(t *testing.T) {
+	r := NewRegistry()
+	r.Define("notification", 2, renamed{})
+	r.Upcaster("notification", 1, renameMessage, json.RawMessage(sample))
+
+	if err := r.Check(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, schema := range []int{0, 1} {
+		e := &v1.Event{Type: "notification", Data: json.RawMessage(sample), Schema: schema}
+		if err := r.Upcast(e); err != nil {
+			t.Fatalf("schema %d: %v", schema, err)
+		}
+		if e.Schema != 2 || !bytes.Contains(e.Data, []byte(`"body":"m"`)) {
+			t.Errorf("schema %d: got version %d %s", schema, e.Schema, e.Data)
+		}
+	}
+
+	// current events are left alone
+	e := &v1.Event{Type: "notification", Data: json.RawMessage(`{"body":"b"}`), Schema: 2}
+	if err := r.Upcast(e); err != nil || string(e.Data) != `{"body":"b"}` {
+		t.Errorf("current event: %v %s", err, e.Data)
+	}
+}
+
+func TestUpcastNewerSchema(t *testing.T) {
+	r := NewRegistry()
+	r.Define("notification", 1, v1.Notification{})
+
+	for _, e := range []*v1.Event{
+		{Type: "notification", Data: json.RawMessage(`{}`), Schema: 2},
+		{Type: "unknown", Data: json.RawMessage(`{}`), Schema: 2},
+	} {
+		if err := r.Upcast(e); !errors.Is(err, ErrNewerSchema) {
+			t.Errorf("%s version %d: got %v, want ErrNewerSchema", e.Type, e.Schema, err)
+		}
+	}
+
+	// types never defined are at version 1
+	if err := r.Upcast(&v1.Event{Type: "unknown", Data: json.RawMessage(`{}`)}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUpcastNoUpcaster(t *testing.T) {
+	r := NewRegistry()
+	r.Define("notification", 3, renamed{})
+	r.Upcaster("notification", 1, renameMessage, json.RawMessage(sample))
+
+	e := &v1.Event{Type: "notification", Data: json.RawMessage(sample), Schema: 1}
+	if err := r.Upcast(e); !errors.Is(err, ErrNoUpcaster) {
+		t.Errorf("got %v, want ErrNoUpcaster", err)
+	}
+	if err := r.Check(); !errors.Is(err, ErrNoUpcaster) {
+		t.Errorf("Check: got %v, want ErrNoUpcaster", err)
+	}
+}
+
+func TestCheckFindsBrokenUpcasters(t *testing.T) {
+	tests := map[string]func(r *Registry){
+		"sample does not decode": func(r *Registry) {
+			r.Upcaster("notification", 1, func(data json.RawMessage) (json.RawMessage, error) { return data, nil }, json.RawMessage(sample))
+		},
+		"upcaster fails": func(r *Registry) {
+			r.Upcaster("notification", 1, func(json.RawMessage) (json.RawMessage, error) { return nil, errors.New("boom") }, json.RawMessage(sample))
+		},
+		"upcaster past current": func(r *Registry) {
+			r.Upcaster("notification", 1, renameMessage, json.RawMessage(sample))
+			r.Upcaster("notification", 2, renameMessage, json.RawMessage(sample))
+		},
+	}
+
+	for name, register := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := NewRegistry()
+			r.Define("notification", 2, renamed{})
+			register(r)
+
+			if err := r.Check(); err == nil {
+				t.Error("Check passed")
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+// Package failover sends the calls to a dependency to its primary deployment
+// and, for disaster recovery, to a passive secondary one once the primary has
+// failed for a while. While the secondary serves, the primary is probed and
+// the calls go back to it as soon as it is healthy again.
+//
+// Requests are built with a path only and sent with Do, which sends them to
+// the deployment in use:
+//
+//	request, err := http.NewRequestWithContext(ctx, "POST", "/authenticate", body)
+//	response, err := auth.Do(client, request)
+//
+// A failed call is not repeated on the other deployment, the caller decides
+// whether it can be.
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of the endpoints made by New
+const (
+	DefaultThreshold  = 5
+	DefaultSustain    = 10 * time.Second
+	DefaultProbeEvery = 10 * time.Second
+	DefaultHealthPath = "/healthz"
+)
+
+// Event tells that the calls to Service moved from one deployment to another
+type Event struct {
+	Service string    `json:"service"`
+	From    string    `json:"from"`
+	To      string    `json:"to"`
+	Reason  string    `json:"reason"`
+	At      time.Time `json:"at"`
+}
+
+// Endpoint is a dependency with a primary and an optional secondary
+// deployment. The settings must not change once it is in use.
+type Endpoint struct {
+	Service string
+
+	// Threshold failures in a row, over at least Sustain, fail over. Calls
+	// fail when they get no answer or a 5xx one.
+	Threshold int
+	Sustain   time.Duration
+
+	// the primary is probed at HealthPath every ProbeEvery while the
+	// secondary serves, with Probe
+	ProbeEvery time.Duration
+	HealthPath string
+	Probe      *http.Client
+
+	// OnFailover is called with every move, from its own goroutine
+	OnFailover func(Event)
+
+	bases []*url.URL
+
+	mu        sync.Mutex
+	active    int
+	failures  int
+	failingAt time.Time
+	probing   bool
+}
+
+// New returns the endpoint of service, secondary may be empty
+func New(service, primary, secondary string) (*Endpoint, error) {
+	if primary == "" {
+		return nil, fmt.Errorf("failover: %s has no primary URL", service)
+	}
+
+	e := &Endpoint{
+		Service:    service,
+		Threshold:  DefaultThreshold,
+		Sustain:    DefaultSustain,
+		ProbeEvery: DefaultProbeEvery,
+		HealthPath: DefaultHealthPath,
+		Probe:      &http.Client{Timeout: 2 * time.Second},
+	}
+
+	for _, base := range []string{primary, secondary} {
+		if base == "" {
+			continue
+		}
+		u, err := url.Parse(base)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("failover: %s: %q is not an absolute URL", service, base)
+		}
+		e.bases = append(e.bases, u)
+	}
+
+	return e, nil
+}
+
+// MustNew is New for endpoints whose URLs are constants
+func MustNew(service, primary, secondary string) *Endpoint {
+	e, err := New(service, primary, secondary)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// Active returns the base URL of the deployment in use
+func (e *Endpoint) Active() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.bases[e.active].String()
+}
+
+// URL returns the URL of path on the deployment in use, for the callers that
+// hand the URL on, like redirects
+func (e *Endpoint) URL(path string) string {
+	e.mu.Lock()
+	base := e.bases[e.active]
+	e.mu.Unlock()
+
+	return join(base, &url.URL{Path: path}).String()
+}
+
+// Do sends req, whose URL is a path and query, to the deployment in use and
+// counts the outcome towards a failover
+func (e *Endpoint) Do(client *http.Client, req *http.Request) (*http.Response, error) {
+	e.mu.Lock()
+	idx := e.active
+	e.mu.Unlock()
+
+	req.URL = join(e.bases[idx], req.URL)
+	req.Host = ""
+
+	response, err := client.Do(req)
+
+	switch {
+	case err != nil && req.Context().Err() != nil:
+		// the caller gave up, that says nothing about the deployment
+	case err != nil:
+		e.failed(idx, err.Error())
+	case response.StatusCode >= 500:
+		e.failed(idx, fmt.Sprintf("answered %d", response.StatusCode))
+	default:
+		e.succeeded(idx)
+	}
+
+	return response, err
+}
+
+func join(base, ref *url.URL) *url.URL {
+	u := *base
+	u.Path = strings.TrimRight(base.Path, "/") + ref.Path
+	u.RawPath = ""
+	u.RawQuery = ref.RawQuery
+	return &u
+}
+
+func (e *Endpoint) succeeded(idx int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if idx == e.active {
+		e.failures = 0
+	}
+}
+
+// failed counts a failure of the deployment idx, the primary fails over once
+// it failed Threshold times in a row for Sustain
+func (e *Endpoint) failed(idx int, reason string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if idx != e.active {
+		return
+	}
+
+	if e.failures == 0 {
+		e.failingAt = time.Now()
+	}
+	e.failures++
+
+	if idx != 0 || len(e.bases) < 2 {
+		return
+	}
+	if e.failures < e.Threshold || time.Since(e.failingAt) < e.Sustain {
+		return
+	}
+
+	e.moveTo(1, fmt.Sprintf("%d failures in a row over %s, last: %s",
+		e.failures, time.Since(e.failingAt).Round(time.Second), reason))
+
+	if !e.probing {
+		e.probing = true
+		go e.probePrimary()
+	}
+}
+
+// moveTo switches to the deployment idx, e.mu is held
+func (e *Endpoint) moveTo(idx int, reason string) {
+	event := Event{
+		Service: e.Service,
+		From:    e.bases[e.active].String(),
+		To:      e.bases[idx].String(),
+		Reason:  reason,
+		At:      time.Now(),
+	}
+
+	e.active = idx
+	e.failures = 0
+
+	if e.OnFailover != nil {
+		go e.OnFailover(event)
+	}
+}
+
+// probePrimary checks the health of the primary until it answers, then moves
+// the calls back to it
+func (e *Endpoint) probePrimary() {
+	ticker := time.NewTicker(e.ProbeEvery)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		err := e.check(e.bases[0])
+		if err != nil {
+			continue
+		}
+
+		e.mu.Lock()
+		if e.active != 0 {
+			e.moveTo(0, "primary is healthy again")
+		}
+		e.probing = false
+		e.mu.Unlock()
+		return
+	}
+}
+
+// check asks the deployment at base for its health
+func (e *Endpoint) check(base *url.URL) error {
+	ctx, cancel := context.WithTimeout(context.Background(), e.Probe.Timeout+time.Second)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, "GET", join(base, &url.URL{Path: e.HealthPath}).String(), nil)
+	if err != nil {
+		return err
+	}
+
+	response, err := e.Probe.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return errors.New(response.Status)
+	}
+	return nil
+}
@@ -0,0 +1,358 @@
+// Package keystore holds the secrets the services sign and verify with. Every
+// key has an id that is written into what it signs, a purpose, and a schedule:
+// it signs from ActiveFrom until a newer key of its purpose becomes active, and
+// verifies until ExpiresAt. Rotating a key is staging its successor with a
+// later ActiveFrom; revoking one stops it from signing and verifying at once.
+//
+// Keys come from a JSON file, reloaded while the service runs:
+//
+//	{
+//	  "keys": [
+//	    {"id": "events-2026-10", "purpose": "events", "secret": "<base64>",
+//	     "active_from": "2026-10-01T00:00:00Z", "expires_at": "2026-12-01T00:00:00Z"}
+//	  ],
+//	  "revoked": ["events-2026-08"]
+//	}
+//
+// Secrets still configured through the environment are added with AddSecrets
+// and get an id derived from their fingerprint, so every service holding the
+// same secret names it the same way.
+package keystore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// key purposes
+const (
+	PurposeEvents   = "events"
+	PurposeWebhooks = "webhooks"
+	PurposeStream   = "stream"
+	PurposeAudit    = "audit"
+	PurposeTokens   = "tokens"
+	PurposeShares   = "shares"
+)
+
+var (
+	// ErrNoKey is returned when a purpose has no key that may sign right now
+	ErrNoKey = errors.New("keystore: no active key")
+	// ErrUnknownKey is returned for key ids that are unknown, expired or revoked
+	ErrUnknownKey = errors.New("keystore: unknown or revoked key")
+)
+
+// Key is one versioned secret
+type Key struct {
+	ID         string    `json:"id"`
+	Purpose    string    `json:"purpose"`
+	Secret     []byte    `json:"secret,omitempty"`
+	ActiveFrom time.Time `json:"active_from,omitempty"`
+	ExpiresAt  time.Time `json:"expires_at,omitempty"`
+}
+
+// KeyInfo describes a key without its secret
+type KeyInfo struct {
+	ID         string     `json:"id"`
+	Purpose    string     `json:"purpose"`
+	ActiveFrom *time.Time `json:"active_from,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	Signing    bool       `json:"signing"`
+	Revoked    bool       `json:"revoked"`
+	Source     string     `json:"source"`
+}
+
+type file struct {
+	Keys    []Key    `json:"keys"`
+	Revoked []string `json:"revoked"`
+}
+
+// Store holds the keys of a service. It is safe for concurrent use.
+type Store struct {
+	path string
+
+	mu      sync.RWMutex
+	loaded  []Key // from the file
+	static  []Key // from the environment
+	revoked map[string]bool
+	signing map[string]string // purpose to the id that signed last, to log changeovers
+}
+
+// New returns an empty store
+func New() *Store {
+	return &Store{
+		revoked: make(map[string]bool),
+		signing: make(map[string]string),
+	}
+}
+
+// Open returns a store with the keys of the file at path. An empty path gives
+// an empty store, for services that only use AddSecrets.
+func Open(path string) (*Store, error) {
+	s := New()
+	s.path = path
+
+	if path == "" {
+		return s, nil
+	}
+
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Reload reads the keystore file again. Revocations made with Revoke are kept.
+func (s *Store) Reload() error {
+	if s.path == "" {
+		return nil
+	}
+
+	raw, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	var f file
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return fmt.Errorf("invalid keystore %s: %w", s.path, err)
+	}
+
+	seen := make(map[string]bool, len(f.Keys))
+	for _, k := range f.Keys {
+		switch {
+		case k.ID == "" || k.Purpose == "":
+			return fmt.Errorf("invalid keystore %s: keys need an id and a purpose", s.path)
+		case len(k.Secret) < 16:
+			return fmt.Errorf("invalid keystore %s: key %s is shorter than 16 bytes", s.path, k.ID)
+		case seen[k.ID]:
+			return fmt.Errorf("invalid keystore %s: key id %s is used twice", s.path, k.ID)
+		}
+		seen[k.ID] = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.loaded = f.Keys
+	for _, id := range f.Revoked {
+		s.revoked[id] = true
+	}
+
+	return nil
+}
+
+// Watch reloads the keystore file at every interval and logs when the signing
+// key of a purpose changes. It never returns.
+func (s *Store) Watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := s.Reload(); err != nil {
+			log.Println("Error reloading keystore:", err)
+		}
+
+		for _, purpose := range s.purposes() {
+			if _, err := s.Signing(purpose); err != nil {
+				log.Printf("Keystore has no active %s key", purpose)
+			}
+		}
+	}
+}
+
+// AddSecrets adds keys for plain secrets, the first one signing. Their ids are
+// "<purpose>-<first 8 hex of the sha256 of the secret>".
+func (s *Store) AddSecrets(purpose string, secrets []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// listed first means newest, so it must win the ActiveFrom comparison
+	active := time.Unix(0, 0).Add(time.Duration(len(secrets)) * time.Second)
+
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+
+		s.static = append(s.static, Key{
+			ID:         Fingerprint(purpose, []byte(secret)),
+			Purpose:    purpose,
+			Secret:     []byte(secret),
+			ActiveFrom: active,
+		})
+		active = active.Add(-time.Second)
+	}
+}
+
+// Fingerprint returns the id of a key configured as a plain secret
+func Fingerprint(purpose string, secret []byte) string {
+	sum := sha256.Sum256(secret)
+	return purpose + "-" + hex.EncodeToString(sum[:4])
+}
+
+// Signing returns the key that signs for purpose now: the one with the latest
+// ActiveFrom that has passed, among the keys that are neither expired nor revoked
+func (s *Store) Signing(purpose string) (Key, error) {
+	now := time.Now()
+
+	s.mu.RLock()
+	var current *Key
+	for _, k := range s.all() {
+		if k.Purpose != purpose || !s.usable(k, now) || k.ActiveFrom.After(now) {
+			continue
+		}
+		if current == nil || k.ActiveFrom.After(current.ActiveFrom) {
+			current = &k
+		}
+	}
+	s.mu.RUnlock()
+
+	if current == nil {
+		return Key{}, ErrNoKey
+	}
+
+	s.mu.Lock()
+	if last := s.signing[purpose]; last != current.ID {
+		if last != "" {
+			log.Printf("Keystore: %s key %s replaces %s for signing", purpose, current.ID, last)
+		}
+		s.signing[purpose] = current.ID
+	}
+	s.mu.Unlock()
+
+	return *current, nil
+}
+
+// Verifying returns the keys that verify for purpose now, staged ones included
+// so that a replica whose clock runs ahead does not get rejected
+func (s *Store) Verifying(purpose string) []Key {
+	now := time.Now()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var keys []Key
+	for _, k := range s.all() {
+		if k.Purpose == purpose && s.usable(k, now) {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.SliceStable(keys, func(i, j int) bool {
+		return keys[i].ActiveFrom.After(keys[j].ActiveFrom)
+	})
+
+	return keys
+}
+
+// Lookup returns the key of purpose with the given id if it may still verify
+func (s *Store) Lookup(purpose, id string) (Key, error) {
+	for _, k := range s.Verifying(purpose) {
+		if k.ID == id {
+			return k, nil
+		}
+	}
+	return Key{}, ErrUnknownKey
+}
+
+// Revoke stops a key from signing and verifying. It is meant for keys that
+// leaked and only affects this store: the services share revocations through
+// Redis, and the id belongs in the "revoked" list of the file for good.
+func (s *Store) Revoke(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revoked[id] = true
+}
+
+// Has tells if the store holds keys for purpose, revoked or expired ones
+// included. Receivers use it to decide whether signatures are required, so
+// revoking every key of a purpose rejects everything instead of nothing.
+func (s *Store) Has(purpose string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, k := range s.all() {
+		if k.Purpose == purpose {
+			return true
+		}
+	}
+	return false
+}
+
+// Keys describes every key of the store, without the secrets
+func (s *Store) Keys() []KeyInfo {
+	current := make(map[string]string)
+	for _, purpose := range s.purposes() {
+		if k, err := s.Signing(purpose); err == nil {
+			current[purpose] = k.ID
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var infos []KeyInfo
+	add := func(keys []Key, source string) {
+		for _, k := range keys {
+			info := KeyInfo{
+				ID:      k.ID,
+				Purpose: k.Purpose,
+				Signing: current[k.Purpose] == k.ID,
+				Revoked: s.revoked[k.ID],
+				Source:  source,
+			}
+			if source == "file" && !k.ActiveFrom.IsZero() {
+				info.ActiveFrom = &k.ActiveFrom
+			}
+			if !k.ExpiresAt.IsZero() {
+				info.ExpiresAt = &k.ExpiresAt
+			}
+			infos = append(infos, info)
+		}
+	}
+	add(s.loaded, "file")
+	add(s.static, "env")
+
+	return infos
+}
+
+func (s *Store) purposes() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var purposes []string
+	for _, k := range s.all() {
+		if !seen[k.Purpose] {
+			seen[k.Purpose] = true
+			purposes = append(purposes, k.Purpose)
+		}
+	}
+	return purposes
+}
+
+// all returns the file keys followed by the environment ones. The caller must
+// hold s.mu.
+func (s *Store) all() []Key {
+	keys := make([]Key, 0, len(s.loaded)+len(s.static))
+	keys = append(keys, s.loaded...)
+	return append(keys, s.static...)
+}
+
+// usable tells if a key is neither revoked nor expired. The caller must hold s.mu.
+func (s *Store) usable(k Key, now time.Time) bool {
+	if s.revoked[k.ID] {
+		return false
+	}
+	return k.ExpiresAt.IsZero() || now.Before(k.ExpiresAt)
+}
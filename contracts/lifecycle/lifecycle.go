@@ -0,0 +1,337 @@
+// Package lifecycle runs the HTTP server of a service from its probes to its
+// shutdown: /livez, /healthz and /readyz answer the orchestrator with the
+// state of the dependencies registered with AddCheck, /drain takes the replica
+// out of rotation before it is stopped, and Serve stops the server on SIGTERM
+// and releases the resources registered with OnShutdown.
+package lifecycle
+
+import (
+	"context"
+	"contracts/negotiate"
+	v1 "contracts/v1"
+	"crypto/subtle"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// PodInfo is the pod metadata Kubernetes hands to the container through the
+// downward API, e.g.
+//
+//	env:
+//	  - name: POD_NAME
+//	    valueFrom: {fieldRef: {fieldPath: metadata.name}}
+type PodInfo struct {
+	Name      string `json:"name,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Node      string `json:"node,omitempty"`
+	IP        string `json:"ip,omitempty"`
+}
+
+func readPodInfo() *PodInfo {
+	pod := &PodInfo{
+		Name:      os.Getenv("POD_NAME"),
+		Namespace: os.Getenv("POD_NAMESPACE"),
+		Node:      os.Getenv("NODE_NAME"),
+		IP:        os.Getenv("POD_IP"),
+	}
+	if *pod == (PodInfo{}) {
+		return nil
+	}
+	return pod
+}
+
+// readinessCheck is one dependency the replica needs to serve traffic
+type readinessCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// Lifecycle answers the probes of the orchestrator and drains the replica
+// before it is stopped. The preStop hook posts to /drain from inside the pod,
+// on the port of the service:
+//
+//	lifecycle:
+//	  preStop:
+//	    exec: {command: ["wget", "-qO-", "--post-data=", "http://127.0.0.1:80/drain"]}
+//
+// From then on /readyz fails so the replica is taken out of the endpoints,
+// and /drain returns after DRAIN_DELAY, when the SIGTERM follows. On SIGTERM
+// or SIGINT Serve stops the server, see Serve.
+type Lifecycle struct {
+	Pod *PodInfo
+
+	// AdminKey lets /drain be called from outside the pod with X-Admin-Key
+	AdminKey string
+
+	draining atomic.Bool
+	delay    time.Duration
+	checks   []readinessCheck
+	server   *http.Server
+
+	// checkTimeout bounds each dependency check of /healthz and /readyz
+	checkTimeout time.Duration
+
+	// timeout bounds the requests still running at shutdown
+	timeout time.Duration
+	// closers release the resources of the replica once the server stopped
+	closers []shutdownCloser
+	// stopping is closed when the shutdown starts
+	stopping chan struct{}
+}
+
+// shutdownCloser releases one resource at shutdown
+type shutdownCloser struct {
+	name  string
+	close func(ctx context.Context) error
+}
+
+// closeTimeout bounds each closer run at shutdown
+const closeTimeout = 5 * time.Second
+
+// New returns the lifecycle of the replica, set by DRAIN_DELAY,
+// SHUTDOWN_TIMEOUT and HEALTH_CHECK_TIMEOUT
+func New() *Lifecycle {
+	delay, err := time.ParseDuration(os.Getenv("DRAIN_DELAY"))
+	if err != nil || delay < 0 {
+		delay = 10 * time.Second
+	}
+
+	// SHUTDOWN_TIMEOUT is how long requests may finish after SIGTERM
+	timeout, err := time.ParseDuration(os.Getenv("SHUTDOWN_TIMEOUT"))
+	if err != nil || timeout <= 0 {
+		timeout = 15 * time.Second
+	}
+
+	// HEALTH_CHECK_TIMEOUT is how long a dependency may take to answer
+	checkTimeout, err := time.ParseDuration(os.Getenv("HEALTH_CHECK_TIMEOUT"))
+	if err != nil || checkTimeout <= 0 {
+		checkTimeout = 2 * time.Second
+	}
+
+	return &Lifecycle{
+		Pod:          readPodInfo(),
+		delay:        delay,
+		timeout:      timeout,
+		checkTimeout: checkTimeout,
+		stopping:     make(chan struct{}),
+	}
+}
+
+// OnShutdown registers a resource to release once the server stopped.
+// Resources are released in the reverse order they were registered, so the
+// ones registered first, like the databases, are still there for the others.
+func (l *Lifecycle) OnShutdown(name string, close func(ctx context.Context) error) {
+	l.closers = append(l.closers, shutdownCloser{name: name, close: close})
+}
+
+// StreamContext is ctx, done as well when the shutdown starts. Streams, which
+// would hold the shutdown until its deadline, run under it; their clients
+// reconnect to another replica.
+func (l *Lifecycle) StreamContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-l.stopping:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// Stopping is closed when the shutdown starts, for the connections the
+// server does not close itself, like hijacked ones
+func (l *Lifecycle) Stopping() <-chan struct{} {
+	return l.stopping
+}
+
+// Serve runs srv until SIGTERM or SIGINT, then shuts down: the server stops
+// accepting connections and waits up to SHUTDOWN_TIMEOUT for the requests in
+// flight, streams are ended, and the resources registered with OnShutdown are
+// released. A second signal ends the process at once.
+func (l *Lifecycle) Serve(srv *http.Server) error {
+	l.server = srv
+	srv.RegisterOnShutdown(func() { close(l.stopping) })
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	stop()
+
+	log.Printf("Shutting down, waiting up to %s for requests in flight", l.timeout)
+	l.draining.Store(true)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), l.timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Println("Requests still running at the shutdown deadline, closing them:", err)
+		srv.Close()
+	} else {
+		log.Println("Server stopped, all requests finished")
+	}
+
+	for i := len(l.closers) - 1; i >= 0; i-- {
+		c := l.closers[i]
+
+		ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+		err := c.close(ctx)
+		cancel()
+
+		if err != nil {
+			log.Printf("Error closing %s: %v", c.name, err)
+			continue
+		}
+		log.Printf("Closed %s", c.name)
+	}
+
+	log.Println("Shutdown complete")
+	return nil
+}
+
+// AddCheck registers a dependency that /healthz and /readyz check
+func (l *Lifecycle) AddCheck(name string, check func(ctx context.Context) error) {
+	l.checks = append(l.checks, readinessCheck{name: name, check: check})
+}
+
+// DependencyStatus is the state of one dependency, or of the draining gate
+type DependencyStatus struct {
+	Status  string  `json:"status"`
+	Latency float64 `json:"latency_ms"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// CheckDependencies pings every dependency at once, each for at most
+// HEALTH_CHECK_TIMEOUT, and tells if they all answered
+func (l *Lifecycle) CheckDependencies(ctx context.Context) (map[string]DependencyStatus, bool) {
+	statuses := make(map[string]DependencyStatus, len(l.checks)+1)
+	healthy := true
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range l.checks {
+		wg.Add(1)
+		go func(c readinessCheck) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, l.checkTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := c.check(ctx)
+			status := DependencyStatus{Status: "ok", Latency: float64(time.Since(start).Microseconds()) / 1000}
+			if err != nil {
+				status.Status, status.Error = "down", err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			statuses[c.name] = status
+			healthy = healthy && err == nil
+		}(c)
+	}
+	wg.Wait()
+
+	return statuses, healthy
+}
+
+// Livez answers the liveness probe: the process serves requests
+func (l *Lifecycle) Livez(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+// Healthz answers the health checks of docker compose and of monitors with
+// the state of every dependency. Unlike /readyz it keeps answering while the
+// replica drains, a draining replica is not unhealthy.
+func (l *Lifecycle) Healthz(w http.ResponseWriter, r *http.Request) {
+	statuses, healthy := l.CheckDependencies(r.Context())
+	writeStatus(w, statuses, healthy, "healthy", "unhealthy")
+}
+
+// Readyz answers the readiness probe with the state of every gate. It fails
+// while the replica drains or when a dependency is down.
+func (l *Lifecycle) Readyz(w http.ResponseWriter, r *http.Request) {
+	statuses, ready := l.CheckDependencies(r.Context())
+
+	statuses["draining"] = DependencyStatus{Status: "ok"}
+	if l.draining.Load() {
+		statuses["draining"] = DependencyStatus{Status: "draining"}
+		ready = false
+	}
+
+	writeStatus(w, statuses, ready, "ready", "not ready")
+}
+
+func writeStatus(w http.ResponseWriter, statuses map[string]DependencyStatus, ok bool, up, down string) {
+	if !ok {
+		negotiate.Write(w, http.StatusServiceUnavailable, v1.Response[map[string]DependencyStatus]{
+			Error:   true,
+			Message: down,
+			Data:    statuses,
+		})
+		return
+	}
+
+	negotiate.Write(w, http.StatusOK, v1.Response[map[string]DependencyStatus]{
+		Error:   false,
+		Message: up,
+		Data:    statuses,
+	})
+}
+
+// Drain takes the replica out of rotation ahead of a shutdown. It only
+// answers requests from inside the pod or with the admin key.
+func (l *Lifecycle) Drain(w http.ResponseWriter, r *http.Request) {
+	if !loopback(r) && (l.AdminKey == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Admin-Key")), []byte(l.AdminKey)) != 1) {
+		negotiate.Write(w, http.StatusForbidden, v1.Response[any]{
+			Error:   true,
+			Message: "drain is only allowed from inside the pod",
+		})
+		return
+	}
+
+	if !l.draining.Swap(true) {
+		log.Printf("Draining, stopping in %s", l.delay)
+
+		// clients holding a connection open get moved to other replicas
+		if l.server != nil {
+			l.server.SetKeepAlivesEnabled(false)
+		}
+	}
+
+	select {
+	case <-time.After(l.delay):
+	case <-r.Context().Done():
+	}
+
+	negotiate.Write(w, http.StatusOK, v1.Response[any]{
+		Error:   false,
+		Message: "drained",
+	})
+}
+
+func loopback(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
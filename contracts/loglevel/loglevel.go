@@ -0,0 +1,188 @@
+// Package loglevel sets the level of the slog logger of a service and lets
+// admins change it at runtime, for a while or for good, through GET and PUT
+// /admin/loglevel.
+package loglevel
+
+import (
+	"contracts/negotiate"
+	v1 "contracts/v1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxTTL bounds how long a temporary log level stays in place
+const MaxTTL = 24 * time.Hour
+
+// logLevel is the level of the default logger, it can be changed at runtime
+// through PUT /admin/loglevel
+var logLevel = new(slog.LevelVar)
+
+// levels holds the configured level and the pending revert of a temporary one
+var levels struct {
+	mu       sync.Mutex
+	base     slog.Level
+	revert   *time.Timer
+	revertAt time.Time
+}
+
+// Setup makes slog, and the log package through it, write JSON records at
+// level, LOG_LEVEL of the service (info by default)
+func Setup(level string) {
+	if level != "" {
+		if err := logLevel.UnmarshalText([]byte(level)); err != nil {
+			log.Printf("Invalid LOG_LEVEL %q, using info", level)
+		}
+	}
+	levels.base = logLevel.Level()
+
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel})))
+}
+
+// Set changes the level. With a ttl the level goes back to the configured one
+// when it expires, otherwise it becomes the configured level. It returns when
+// the level reverts, zero without a ttl.
+func Set(level slog.Level, ttl time.Duration) time.Time {
+	levels.mu.Lock()
+	defer levels.mu.Unlock()
+
+	if levels.revert != nil {
+		levels.revert.Stop()
+		levels.revert = nil
+		levels.revertAt = time.Time{}
+	}
+
+	logLevel.Set(level)
+
+	if ttl <= 0 {
+		levels.base = level
+		return time.Time{}
+	}
+
+	base := levels.base
+	levels.revertAt = time.Now().Add(ttl)
+	levels.revert = time.AfterFunc(ttl, func() {
+		levels.mu.Lock()
+		defer levels.mu.Unlock()
+
+		logLevel.Set(base)
+		levels.revert = nil
+		levels.revertAt = time.Time{}
+		slog.Info("log level reverted", "level", base.String())
+	})
+
+	return levels.revertAt
+}
+
+// Payload is the body of PUT /admin/loglevel
+type Payload struct {
+	Level      string `json:"level"`
+	TTLSeconds int    `json:"ttl_seconds,omitempty"`
+}
+
+// State is the current level, the configured one and when the current one
+// reverts to it
+type State struct {
+	Level    string     `json:"level"`
+	Base     string     `json:"base"`
+	RevertAt *time.Time `json:"revert_at,omitempty"`
+}
+
+// Current returns the state of the level
+func Current() State {
+	levels.mu.Lock()
+	defer levels.mu.Unlock()
+
+	state := State{
+		Level: strings.ToLower(logLevel.Level().String()),
+		Base:  strings.ToLower(levels.base.String()),
+	}
+	if !levels.revertAt.IsZero() {
+		revertAt := levels.revertAt
+		state.RevertAt = &revertAt
+	}
+
+	return state
+}
+
+// GetHandler reports the current log level and when it reverts, for GET
+// /admin/loglevel
+func GetHandler(w http.ResponseWriter, r *http.Request) {
+	negotiate.Write(w, http.StatusOK, v1.Response[State]{
+		Error:   false,
+		Message: "log level",
+		Data:    Current(),
+	})
+}
+
+// SetHandler changes the log level, for ttl_seconds when given, for PUT
+// /admin/loglevel
+func SetHandler(w http.ResponseWriter, r *http.Request) {
+	var requestPayload Payload
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&requestPayload); err != nil {
+		writeError(w, fmt.Errorf("Body must be a log level payload: %w", err))
+		return
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(requestPayload.Level)); err != nil {
+		writeError(w, errors.New("level must be debug, info, warn or error"))
+		return
+	}
+
+	ttl := time.Duration(requestPayload.TTLSeconds) * time.Second
+	if ttl < 0 || ttl > MaxTTL {
+		writeError(w, errors.New("ttl_seconds must be between 0 and 86400"))
+		return
+	}
+
+	Set(level, ttl)
+	slog.Info("log level changed", "level", level.String(), "ttl", ttl.String())
+
+	negotiate.Write(w, http.StatusOK, v1.Response[State]{
+		Error:   false,
+		Message: "log level changed",
+		Data:    Current(),
+	})
+}
+
+// maxBodyBytes bounds the body of SetHandler
+const maxBodyBytes = 1 << 10
+
+func writeError(w http.ResponseWriter, err error) {
+	negotiate.Write(w, http.StatusBadRequest, v1.Response[any]{
+		Error:   true,
+		Message: err.Error(),
+	})
+}
+
+// DebugRequests logs every request at debug level, it costs nothing while the
+// level is above debug
+func DebugRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if logLevel.Level() > slog.LevelDebug {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		next.ServeHTTP(w, r)
+
+		slog.Debug("request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"remote", r.RemoteAddr,
+			"duration", time.Since(start).String(),
+		)
+	})
+}
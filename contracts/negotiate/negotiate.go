@@ -0,0 +1,241 @@
+// Package negotiate answers in the format the client prefers: JSON, XML or
+// MessagePack. Middleware picks it from the Accept header and Write encodes
+// the response in it:
+//
+//	mux.Use(negotiate.Middleware)
+//	negotiate.Write(w, http.StatusOK, response)
+package negotiate
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Formats a client can ask for in its Accept header
+const (
+	JSON    = "application/json"
+	XML     = "application/xml"
+	Msgpack = "application/msgpack"
+)
+
+var mediaFormats = map[string]string{
+	"application/json":        JSON,
+	"application/xml":         XML,
+	"text/xml":                XML,
+	"application/msgpack":     Msgpack,
+	"application/x-msgpack":   Msgpack,
+	"application/vnd.msgpack": Msgpack,
+}
+
+// negotiatedWriter carries the format chosen for the response to Write
+type negotiatedWriter struct {
+	http.ResponseWriter
+	format string
+}
+
+func (w *negotiatedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Middleware picks the response format from the Accept header. Only requests
+// that prefer XML or MessagePack get a wrapped writer, the others, streams
+// included, are left alone.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if format := Accepted(r.Header.Get("Accept")); format != JSON {
+			w = &negotiatedWriter{ResponseWriter: w, format: format}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Format finds the format chosen by Middleware, looking through the writers
+// wrapped around it by other middleware
+func Format(w http.ResponseWriter) string {
+	for {
+		switch rw := w.(type) {
+		case *negotiatedWriter:
+			return rw.format
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			return JSON
+		}
+	}
+}
+
+// Accepted returns the format with the highest quality in an Accept header,
+// JSON when nothing else is preferred
+func Accepted(accept string) string {
+	best, bestQ := JSON, 0.0
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+
+		format, ok := mediaFormats[mediaType]
+		if !ok || q <= 0 {
+			continue
+		}
+
+		// on equal quality JSON wins
+		if q > bestQ || (q == bestQ && format == JSON) {
+			best, bestQ = format, q
+		}
+	}
+
+	return best
+}
+
+// Write writes data in the format chosen by Middleware, JSON by default, with
+// the headers in headers, if any
+func Write(w http.ResponseWriter, status int, data any, headers ...http.Header) error {
+	format := Format(w)
+
+	out, err := Encode(format, data)
+	if err != nil {
+		return err
+	}
+
+	if len(headers) > 0 {
+		for key, value := range headers[0] {
+			w.Header()[key] = value
+		}
+	}
+
+	w.Header().Set("Content-Type", format)
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(status)
+	_, err = w.Write(out)
+	return err
+}
+
+// Encode encodes data in a format. The value goes through JSON first so the
+// three formats have the same shape and field names.
+func Encode(format string, data any) ([]byte, error) {
+	out, err := json.Marshal(data)
+	if err != nil || format == JSON {
+		return out, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(out))
+	dec.UseNumber()
+
+	var generic any
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+	generic = plainNumbers(generic)
+
+	var buf bytes.Buffer
+
+	if format == Msgpack {
+		enc := msgpack.NewEncoder(&buf)
+		enc.UseCompactInts(true)
+		if err := enc.Encode(generic); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	buf.WriteString(xml.Header)
+	writeXML(&buf, "response", generic)
+
+	return buf.Bytes(), nil
+}
+
+// plainNumbers replaces json.Number by int64 or float64
+func plainNumbers(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case []any:
+		for i := range v {
+			v[i] = plainNumbers(v[i])
+		}
+	case map[string]any:
+		for k := range v {
+			v[k] = plainNumbers(v[k])
+		}
+	}
+	return v
+}
+
+var xmlName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// writeXML writes v as an element: objects become child elements sorted by key,
+// arrays repeated item elements. Keys that are not valid element names are
+// written as entry elements with a key attribute.
+func writeXML(buf *bytes.Buffer, name string, v any) {
+	open, end := "<"+name, "</"+name+">"
+	if !xmlName.MatchString(name) || strings.HasPrefix(strings.ToLower(name), "xml") {
+		var key bytes.Buffer
+		_ = xml.EscapeText(&key, []byte(name))
+		open, end = `<entry key="`+key.String()+`"`, "</entry>"
+	}
+
+	switch v := v.(type) {
+	case nil:
+		buf.WriteString(open + "/>")
+	case map[string]any:
+		buf.WriteString(open + ">")
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			writeXML(buf, k, v[k])
+		}
+		buf.WriteString(end)
+	case []any:
+		buf.WriteString(open + ">")
+		for _, item := range v {
+			writeXML(buf, "item", item)
+		}
+		buf.WriteString(end)
+	case string:
+		buf.WriteString(open + ">")
+		_ = xml.EscapeText(buf, []byte(v))
+		buf.WriteString(end)
+	default:
+		buf.WriteString(open + ">")
+		buf.WriteString(formatScalar(v))
+		buf.WriteString(end)
+	}
+}
+
+func formatScalar(v any) string {
+	switch v := v.(type) {
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return ""
+}
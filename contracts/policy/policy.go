@@ -0,0 +1,177 @@
+// Package policy says how a service treats the failures of the services it
+// depends on. A required dependency fails the request that needed it. A
+// best-effort one does not: what could not be delivered is kept in a local
+// queue and delivered once the dependency answers again.
+package policy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Mode is how failures of a dependency are treated
+type Mode int
+
+const (
+	// Required dependencies fail their callers
+	Required Mode = iota
+	// BestEffort dependencies never do, their work is queued instead
+	BestEffort
+)
+
+func (m Mode) String() string {
+	if m == BestEffort {
+		return "best-effort"
+	}
+	return "required"
+}
+
+// ParseMode parses "required" and "best-effort", empty is fallback
+func ParseMode(s string, fallback Mode) (Mode, error) {
+	switch s {
+	case "":
+		return fallback, nil
+	case "required":
+		return Required, nil
+	case "best-effort":
+		return BestEffort, nil
+	}
+	return fallback, fmt.Errorf("invalid policy %q, expected required or best-effort", s)
+}
+
+// Dependency calls one dependency under its mode. Items of a best-effort
+// dependency that failed are queued, up to the size of the queue, the oldest
+// are dropped beyond it. While items wait, new ones are queued behind them
+// without a call, so callers do not wait on a dependency known to be down.
+type Dependency[T any] struct {
+	Name string
+	Mode Mode
+
+	call func(ctx context.Context, item T) error
+	size int
+
+	mu    sync.Mutex
+	queue []T
+	// removed counts the items taken off the front of the queue, delivered
+	// or dropped, dropped those dropped since the queue was last empty
+	removed uint64
+	dropped int
+	wake    chan struct{}
+}
+
+// New returns a dependency delivering items with call, keeping at most size
+// items while it is down, 1000 when size is not positive
+func New[T any](name string, mode Mode, size int, call func(ctx context.Context, item T) error) *Dependency[T] {
+	if size <= 0 {
+		size = 1000
+	}
+
+	return &Dependency[T]{
+		Name: name,
+		Mode: mode,
+		call: call,
+		size: size,
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// Do delivers item. The error of a required dependency is returned, a
+// best-effort dependency queues the item and returns nil.
+func (d *Dependency[T]) Do(ctx context.Context, item T) error {
+	if d.Mode == BestEffort && d.Pending() > 0 {
+		d.enqueue(item)
+		return nil
+	}
+
+	err := d.call(ctx, item)
+	if err == nil || d.Mode == Required {
+		return err
+	}
+
+	log.Printf("%s is unavailable, queueing for later delivery: %v", d.Name, err)
+	d.enqueue(item)
+
+	return nil
+}
+
+// Pending returns how many items wait for delivery
+func (d *Dependency[T]) Pending() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return len(d.queue)
+}
+
+func (d *Dependency[T]) enqueue(item T) {
+	d.mu.Lock()
+	if len(d.queue) >= d.size {
+		d.queue = d.queue[1:]
+		d.removed++
+		d.dropped++
+	}
+	d.queue = append(d.queue, item)
+	d.mu.Unlock()
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run delivers the queued items in order until ctx is done. A failed
+// delivery is tried again after a pause that doubles up to a minute.
+func (d *Dependency[T]) Run(ctx context.Context) {
+	backoff := time.Second
+
+	for {
+		d.mu.Lock()
+		if len(d.queue) == 0 {
+			d.mu.Unlock()
+			select {
+			case <-d.wake:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		item, position := d.queue[0], d.removed
+		d.mu.Unlock()
+
+		callCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		err := d.call(callCtx, item)
+		cancel()
+
+		if err != nil {
+			select {
+			case <-time.After(backoff):
+				backoff = min(2*backoff, time.Minute)
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+		backoff = time.Second
+
+		d.mu.Lock()
+		// the item may have been dropped to make room meanwhile
+		if d.removed == position {
+			d.queue = d.queue[1:]
+			d.removed++
+		}
+		remaining, dropped := len(d.queue), d.dropped
+		if remaining == 0 {
+			d.dropped = 0
+		}
+		d.mu.Unlock()
+
+		if remaining == 0 {
+			log.Printf("%s is back, delivered the queued items", d.Name)
+			if dropped > 0 {
+				log.Printf("%s: %d items were dropped while it was down", d.Name, dropped)
+			}
+		}
+	}
+}
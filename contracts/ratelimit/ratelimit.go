@@ -0,0 +1,168 @@
+// Package ratelimit limits the requests of each client to a route with token
+// buckets, kept in Redis so that the replicas of a service share them:
+//
+//	mux.With(ratelimit.New(rdb, "POST /authenticate", 30).Middleware)
+package ratelimit
+
+import (
+	"context"
+	"contracts/negotiate"
+	v1 "contracts/v1"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// maxLimitedClients bounds the buckets kept by one limiter, full buckets are
+// dropped first when it is reached
+const maxLimitedClients = 10000
+
+// bucket is the token bucket of one client
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter allows perMinute requests of one route per client address, with
+// bursts of up to perMinute requests, counted across the replicas in Redis
+// when there is one
+type Limiter struct {
+	rdb   *redis.Client
+	route string
+
+	mu        sync.Mutex
+	perMinute float64
+	clients   map[string]*bucket
+
+	// shared is false while Redis is unreachable and every replica limits
+	// on its own
+	shared atomic.Bool
+}
+
+// New returns the limiter of route, rdb may be nil to count on this replica
+// only
+func New(rdb *redis.Client, route string, perMinute int) *Limiter {
+	l := &Limiter{rdb: rdb, route: route, perMinute: float64(perMinute), clients: make(map[string]*bucket)}
+	l.shared.Store(true)
+	return l
+}
+
+// allow takes a token from the bucket of client and otherwise says how long
+// to wait for the next one
+func (l *Limiter) allow(client string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.clients[client]
+	if !ok {
+		if len(l.clients) >= maxLimitedClients {
+			l.prune(now)
+		}
+		b = &bucket{tokens: l.perMinute, last: now}
+		l.clients[client] = b
+	}
+
+	b.tokens += now.Sub(b.last).Minutes() * l.perMinute
+	if b.tokens > l.perMinute {
+		b.tokens = l.perMinute
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.perMinute * float64(time.Minute))
+	}
+
+	b.tokens--
+	return true, 0
+}
+
+// prune drops the buckets that are full again. The caller must hold l.mu.
+func (l *Limiter) prune(now time.Time) {
+	for client, b := range l.clients {
+		if b.tokens+now.Sub(b.last).Minutes()*l.perMinute >= l.perMinute {
+			delete(l.clients, client)
+		}
+	}
+}
+
+// takeToken is the token bucket of Limiter run in Redis, so that every replica
+// takes from the same bucket. It uses the clock of Redis, the clocks of the
+// replicas may differ, and answers whether the request is allowed and how many
+// milliseconds to wait otherwise. A bucket left alone for a minute is full
+// again and expires.
+var takeToken = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) + tonumber(t[2]) / 1000000
+
+local b = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens = tonumber(b[1]) or rate
+local last = tonumber(b[2]) or now
+
+tokens = math.min(rate, tokens + (now - last) / 60 * rate)
+
+local allowed, wait = 0, 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) / rate * 60000)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'last', tostring(now))
+redis.call('PEXPIRE', KEYS[1], 60000)
+
+return {allowed, wait}
+`)
+
+// Allow takes a token from the bucket of client and otherwise says how long to
+// wait for the next one. With Redis the replicas share the bucket; when Redis
+// cannot be reached it falls back to the bucket of this replica, which lets a
+// client through as many times as there are replicas.
+func (l *Limiter) Allow(ctx context.Context, client string) (bool, time.Duration) {
+	if l.rdb == nil {
+		return l.allow(client, time.Now())
+	}
+
+	res, err := takeToken.Run(ctx, l.rdb, []string{"ratelimit:" + l.route + ":" + client}, l.perMinute).Int64Slice()
+	if err != nil || len(res) != 2 {
+		if l.shared.Swap(false) {
+			log.Printf("Rate limiting %s on this replica only: %v", l.route, err)
+		}
+		return l.allow(client, time.Now())
+	}
+
+	if !l.shared.Swap(true) {
+		log.Printf("Rate limiting %s through Redis", l.route)
+	}
+
+	return res[0] == 1, time.Duration(res[1]) * time.Millisecond
+}
+
+// Middleware answers 429 to the clients that used up their bucket
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			client = r.RemoteAddr
+		}
+
+		ok, wait := l.Allow(r.Context(), client)
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait/time.Second)+1))
+			negotiate.Write(w, http.StatusTooManyRequests, v1.Response[any]{
+				Error:   true,
+				Message: "too many requests",
+			})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,125 @@
+// Package timeout bounds how long the handlers of a service run. A handler
+// that is not done in time is answered for with the timeout response of the
+// service, whatever it writes afterwards is dropped.
+package timeout
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Middleware runs the handler with a deadline of d in its context. Its
+// response is held back until it returns, so that expired can answer instead
+// once d passed; routes that stream or hijack the connection must not use it.
+// Requests the client gave up on are not answered at all.
+func Middleware(d time.Duration, expired http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			tw := &writer{w: w, header: make(http.Header)}
+			done := make(chan struct{})
+			panicked := make(chan any, 1)
+
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicked <- fmt.Sprintf("%v\n\n%s", p, debug.Stack())
+					}
+				}()
+				next.ServeHTTP(tw, r)
+				close(done)
+			}()
+
+			select {
+			case p := <-panicked:
+				panic(p)
+			case <-done:
+				tw.flush()
+			case <-ctx.Done():
+				tw.expire()
+				if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					expired.ServeHTTP(w, r)
+				}
+			}
+		})
+	}
+}
+
+// writer buffers the response of a handler
+type writer struct {
+	w http.ResponseWriter
+
+	mu      sync.Mutex
+	header  http.Header
+	status  int
+	body    bytes.Buffer
+	expired bool
+}
+
+func (tw *writer) Header() http.Header {
+	return tw.header
+}
+
+func (tw *writer) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.expired || tw.status != 0 {
+		return
+	}
+	tw.status = status
+}
+
+func (tw *writer) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.expired {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+
+	return tw.body.Write(b)
+}
+
+// Unwrap lets middleware inside find the writers wrapped around this one
+func (tw *writer) Unwrap() http.ResponseWriter {
+	return tw.w
+}
+
+// flush sends the buffered response
+func (tw *writer) flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	dst := tw.w.Header()
+	for key, value := range tw.header {
+		dst[key] = value
+	}
+
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	tw.w.WriteHeader(tw.status)
+	tw.w.Write(tw.body.Bytes())
+}
+
+// expire drops the response, the handler is still running but its writes
+// fail from now on
+func (tw *writer) expire() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	tw.expired = true
+}
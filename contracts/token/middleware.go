@@ -0,0 +1,59 @@
+package token
+
+import (
+	"context"
+	v1 "contracts/v1"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+type contextKey struct{}
+
+// NewContext returns ctx carrying the claims of the caller
+func NewContext(ctx context.Context, c Claims) context.Context {
+	return context.WithValue(ctx, contextKey{}, c)
+}
+
+// FromContext returns the claims the middleware verified
+func FromContext(ctx context.Context) (Claims, bool) {
+	c, ok := ctx.Value(contextKey{}).(Claims)
+	return c, ok
+}
+
+// FromRequest returns the bearer token of the Authorization header
+func FromRequest(r *http.Request) string {
+	scheme, raw, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(raw)
+}
+
+// Middleware answers 401 to requests without a valid bearer token and gives
+// the next handler the claims, see FromContext
+func (v Verifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw := FromRequest(r)
+		if raw == "" {
+			unauthorized(w, "missing bearer token")
+			return
+		}
+
+		c, err := v.Verify(raw)
+		if err != nil {
+			unauthorized(w, err.Error())
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), c)))
+	})
+}
+
+func unauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	w.WriteHeader(http.StatusUnauthorized)
+
+	json.NewEncoder(w).Encode(v1.Response[any]{Error: true, Message: message})
+}
@@ -0,0 +1,194 @@
+// Package token issues and verifies the access tokens users authenticate with.
+// Tokens are HS256 JSON web tokens signed with the "tokens" keys of the
+// keystore, the signing key named in the kid header:
+//
+//	<base64 header>.<base64 claims>.<base64 hmac-sha256 of the first two parts>
+//
+// Any service holding the token keys verifies them on its own, without a call
+// to the authentication service.
+package token
+
+import (
+	"contracts/keystore"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// DefaultTTL is how long a token is valid when the issuer does not say
+const DefaultTTL = 15 * time.Minute
+
+var (
+	// ErrMalformed is returned for strings that are not an HS256 token
+	ErrMalformed = errors.New("token: malformed")
+	// ErrSignature is returned for tokens whose signature does not match
+	ErrSignature = errors.New("token: invalid signature")
+	// ErrExpired is returned for tokens past their expiry
+	ErrExpired = errors.New("token: expired")
+	// ErrClaims is returned for tokens issued in the future or by someone else
+	ErrClaims = errors.New("token: invalid claims")
+)
+
+// Claims are the claims of a token. Subject is the id of the user.
+type Claims struct {
+	Issuer    string `json:"iss,omitempty"`
+	Subject   string `json:"sub"`
+	Email     string `json:"email,omitempty"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+	ID        string `json:"jti"`
+}
+
+// Expires returns the expiry as a time
+func (c Claims) Expires() time.Time {
+	return time.Unix(c.ExpiresAt, 0)
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid"`
+}
+
+// Issuer signs tokens
+type Issuer struct {
+	Keys *keystore.Store
+
+	// Name goes into the iss claim
+	Name string
+
+	// TTL is how long tokens are valid, DefaultTTL when zero
+	TTL time.Duration
+}
+
+// Enabled tells if there is a key to sign tokens with
+func (i Issuer) Enabled() bool {
+	if i.Keys == nil {
+		return false
+	}
+	_, err := i.Keys.Signing(keystore.PurposeTokens)
+	return err == nil
+}
+
+// Issue signs a token for the subject and email of c. The other claims are
+// set by the issuer and returned with the token.
+func (i Issuer) Issue(c Claims) (string, Claims, error) {
+	if i.Keys == nil {
+		return "", Claims{}, keystore.ErrNoKey
+	}
+
+	key, err := i.Keys.Signing(keystore.PurposeTokens)
+	if err != nil {
+		return "", Claims{}, err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", Claims{}, err
+	}
+
+	ttl := i.TTL
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+
+	now := time.Now()
+	c.Issuer = i.Name
+	c.IssuedAt = now.Unix()
+	c.ExpiresAt = now.Add(ttl).Unix()
+	c.ID = hex.EncodeToString(id)
+
+	h, err := json.Marshal(header{Alg: "HS256", Typ: "JWT", Kid: key.ID})
+	if err != nil {
+		return "", Claims{}, err
+	}
+	p, err := json.Marshal(c)
+	if err != nil {
+		return "", Claims{}, err
+	}
+
+	signed := encode(h) + "." + encode(p)
+
+	return signed + "." + sign(key.Secret, signed), c, nil
+}
+
+// Verifier checks tokens
+type Verifier struct {
+	Keys *keystore.Store
+
+	// Issuer, when set, must match the iss claim
+	Issuer string
+
+	// Leeway is the allowed clock skew on the expiry and issue time
+	Leeway time.Duration
+}
+
+// Verify checks the signature and claims of a token and returns the claims
+func (v Verifier) Verify(raw string) (Claims, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 || v.Keys == nil {
+		return Claims{}, ErrMalformed
+	}
+
+	var h header
+	if err := decode(parts[0], &h); err != nil {
+		return Claims{}, ErrMalformed
+	}
+
+	// the algorithm is fixed, never taken from the token
+	if h.Alg != "HS256" {
+		return Claims{}, ErrMalformed
+	}
+
+	key, err := v.Keys.Lookup(keystore.PurposeTokens, h.Kid)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	if !hmac.Equal([]byte(parts[2]), []byte(sign(key.Secret, parts[0]+"."+parts[1]))) {
+		return Claims{}, ErrSignature
+	}
+
+	var c Claims
+	if err := decode(parts[1], &c); err != nil {
+		return Claims{}, ErrMalformed
+	}
+
+	now := time.Now()
+	switch {
+	case now.After(c.Expires().Add(v.Leeway)):
+		return Claims{}, ErrExpired
+	case time.Unix(c.IssuedAt, 0).After(now.Add(v.Leeway)):
+		return Claims{}, ErrClaims
+	case v.Issuer != "" && c.Issuer != v.Issuer:
+		return Claims{}, ErrClaims
+	case c.Subject == "":
+		return Claims{}, ErrClaims
+	}
+
+	return c, nil
+}
+
+func sign(secret []byte, signed string) string {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(signed))
+	return encode(h.Sum(nil))
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decode(s string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,97 @@
+package token
+
+import (
+	"contracts/keystore"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testKeys() *keystore.Store {
+	keys := keystore.New()
+	keys.AddSecrets(keystore.PurposeTokens, []string{"test-token-secret"})
+	return keys
+}
+
+func TestIssueVerify(t *testing.T) {
+	keys := testKeys()
+	issuer := Issuer{Keys: keys, Name: "auth", TTL: time.Minute}
+	verifier := Verifier{Keys: keys, Issuer: "auth"}
+
+	raw, issued, err := issuer.Issue(Claims{Subject: "42", Email: "ada@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := verifier.Verify(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != issued {
+		t.Fatalf("verified %+v, issued %+v", c, issued)
+	}
+
+	for name, tt := range map[string]struct {
+		raw string
+		v   Verifier
+		err error
+	}{
+		"other issuer":   {raw, Verifier{Keys: keys, Issuer: "broker"}, ErrClaims},
+		"unknown key":    {raw, Verifier{Keys: keystore.New()}, keystore.ErrUnknownKey},
+		"two parts":      {raw[:strings.LastIndex(raw, ".")], verifier, ErrMalformed},
+		"bad signature":  {raw[:len(raw)-2] + "AA", verifier, ErrSignature},
+		"not base64":     {"!." + raw[strings.Index(raw, ".")+1:], verifier, ErrMalformed},
+		"empty":          {"", verifier, ErrMalformed},
+		"no keys at all": {raw, Verifier{}, ErrMalformed},
+	} {
+		if _, err := tt.v.Verify(tt.raw); !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %v, want %v", name, err, tt.err)
+		}
+	}
+}
+
+func TestVerifyExpired(t *testing.T) {
+	keys := testKeys()
+
+	raw, _, err := Issuer{Keys: keys, TTL: time.Nanosecond}.Issue(Claims{Subject: "42"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	if _, err := (Verifier{Keys: keys}).Verify(raw); !errors.Is(err, ErrExpired) {
+		t.Fatalf("got %v, want ErrExpired", err)
+	}
+}
+
+// FuzzVerify feeds Verify arbitrary strings: it must not panic, and whatever
+// it accepts must carry a subject and verify again to the same claims
+func FuzzVerify(f *testing.F) {
+	keys := testKeys()
+	verifier := Verifier{Keys: keys, Leeway: time.Hour}
+
+	raw, _, err := Issuer{Keys: keys, Name: "auth"}.Issue(Claims{Subject: "42"})
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	f.Add(raw)
+	f.Add("")
+	f.Add("..")
+	f.Add("eyJhbGciOiJub25lIn0.eyJzdWIiOiI0MiJ9.")
+	f.Add(strings.Replace(raw, ".", "..", 1))
+
+	f.Fuzz(func(t *testing.T, raw string) {
+		c, err := verifier.Verify(raw)
+		if err != nil {
+			return
+		}
+		if c.Subject == "" {
+			t.Fatalf("accepted %q without a subject", raw)
+		}
+		if again, err := verifier.Verify(raw); err != nil || again != c {
+			t.Fatalf("verify of %q is not stable: %+v %v", raw, again, err)
+		}
+	})
+}
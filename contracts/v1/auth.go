@@ -0,0 +1,164 @@
+package v1
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// AuthRequest is the body of POST /authenticate
+type AuthRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// User is a user account as returned by the auth service
+type User struct {
+	ID        int       `json:"id"`
+	Email     string    `json:"email"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Roles     []string  `json:"roles,omitempty"`
+}
+
+// UserPatch is the body of PATCH /admin/users/{id}. Only the fields that are
+// present are changed.
+type UserPatch struct {
+	Email     *string `json:"email,omitempty"`
+	FirstName *string `json:"first_name,omitempty"`
+	LastName  *string `json:"last_name,omitempty"`
+	Active    *bool   `json:"active,omitempty"`
+}
+
+// UserPage is the data of GET /admin/users, one page of the matching users
+type UserPage struct {
+	Users   []User `json:"users"`
+	Page    int    `json:"page"`
+	PerPage int    `json:"per_page"`
+	Total   int    `json:"total"`
+}
+
+// AuthResponse is the data of a successful POST /authenticate or /refresh: the
+// user, and the access and refresh tokens when the auth service issues tokens
+type AuthResponse struct {
+	User
+	Token     string     `json:"token,omitempty"`
+	TokenType string     `json:"token_type,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// RefreshToken is traded for the next access token on POST /refresh, once
+	RefreshToken     string     `json:"refresh_token,omitempty"`
+	RefreshExpiresAt *time.Time `json:"refresh_expires_at,omitempty"`
+}
+
+// RefreshRequest is the body of POST /refresh
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// LogoutRequest is the body of POST /logout. All revokes the tokens of every
+// session of the user, not only those of this one.
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+	All          bool   `json:"all"`
+}
+
+// LockedResponse is the data of the 423 answer to a login of an account locked
+// after too many failed logins
+type LockedResponse struct {
+	LockedUntil time.Time `json:"locked_until"`
+	// RetryAfter is the seconds until the lock ends
+	RetryAfter int `json:"retry_after"`
+}
+
+// ForgotPasswordRequest is the body of POST /password/forgot
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// ResetPasswordRequest is the body of POST /password/reset. Token is the one
+// mailed by POST /password/forgot.
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// TokenRequest is the body of POST /v1/token/validate
+type TokenRequest struct {
+	Token string `json:"token"`
+}
+
+// RegisterRequest is the body of POST /register
+type RegisterRequest struct {
+	Email     string `json:"email"`
+	Password  string `json:"password"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Active    bool   `json:"active"`
+
+	// Legacy is set when the body used the old field names
+	Legacy bool `json:"-"`
+}
+
+// UnmarshalJSON accepts the legacy firstname and lastname fields next to the
+// canonical ones. Unknown fields are still rejected.
+func (p *RegisterRequest) UnmarshalJSON(b []byte) error {
+	var in struct {
+		Email     string  `json:"email"`
+		Password  string  `json:"password"`
+		FirstName *string `json:"first_name"`
+		LastName  *string `json:"last_name"`
+		Active    bool    `json:"active"`
+
+		LegacyFirstName *string `json:"firstname"`
+		LegacyLastName  *string `json:"lastname"`
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&in); err != nil {
+		return err
+	}
+
+	firstName, legacyFirst, err := pickField("first_name", in.FirstName, in.LegacyFirstName)
+	if err != nil {
+		return err
+	}
+	lastName, legacyLast, err := pickField("last_name", in.LastName, in.LegacyLastName)
+	if err != nil {
+		return err
+	}
+
+	*p = RegisterRequest{
+		Email:     in.Email,
+		Password:  in.Password,
+		FirstName: firstName,
+		LastName:  lastName,
+		Active:    in.Active,
+		Legacy:    legacyFirst || legacyLast,
+	}
+
+	return nil
+}
+
+// pickField returns the canonical value of a field, or its legacy value when
+// only that one was sent, and whether the legacy one was used
+func pickField(name string, canonical, legacy *string) (string, bool, error) {
+	switch {
+	case legacy == nil:
+		if canonical == nil {
+			return "", false, nil
+		}
+		return *canonical, false, nil
+	case canonical == nil:
+		return *legacy, true, nil
+	case *canonical != *legacy:
+		return "", false, errors.New("Body contains both " + name + " and its legacy name with different values")
+	}
+
+	return *canonical, true, nil
+}
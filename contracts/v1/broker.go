@@ -0,0 +1,61 @@
+package v1
+
+import "encoding/json"
+
+// BrokerRequest is the body of POST /handle on the broker. Payload is the body
+// of the action, e.g. an AuthRequest for "auth"; requests from before payload
+// put it in the field named after the action instead.
+type BrokerRequest struct {
+	Action  string          `json:"action"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	Auth    AuthRequest     `json:"auth,omitempty"`
+	Log     LogEntry        `json:"log,omitempty"`
+}
+
+// Event is one message on the event bus, published by any service to the
+// Redis channel "events:<topic>" and streamed by the broker to its clients.
+// When the services share an event signing key, Signature covers the id,
+// topic, type and data, see signing.EventBody.
+type Event struct {
+	ID        string          `json:"id,omitempty"`
+	Topic     string          `json:"topic"`
+	Type      string          `json:"type"`
+	Data      json.RawMessage `json:"data"`
+	Signature string          `json:"signature,omitempty"`
+
+	// Schema is the version of the shape of Data for Type, 1 when zero. Events
+	// of older schemas are upcast by the consumer, see eventschema.
+	Schema int `json:"schema,omitempty"`
+
+	// Version is the build of the service that published the event
+	Version string `json:"version,omitempty"`
+
+	// Replayed is set on events the logger sends again from its event store,
+	// see ReplayChannel
+	Replayed bool `json:"replayed,omitempty"`
+}
+
+// ReplayChannel is the Redis channel of the events replayed to one consumer,
+// e.g. "replay:broker:job:auth-1f2e". Consumers subscribe to
+// ReplayChannel(name, "*") next to "events:*".
+func ReplayChannel(consumer, topic string) string {
+	return "replay:" + consumer + ":" + topic
+}
+
+// Notification is the data of "notification" events, shown to one user
+type Notification struct {
+	UserID  int    `json:"user_id"`
+	Title   string `json:"title"`
+	Message string `json:"message"`
+}
+
+// MailReply is the data of "mail.replied" events, a reply of a user to a mail
+// of the authentication service. Text is the reply without the quoted mail.
+type MailReply struct {
+	ThreadID string `json:"thread_id"`
+	UserID   int    `json:"user_id"`
+	Template string `json:"template"`
+	From     string `json:"from"`
+	Subject  string `json:"subject"`
+	Text     string `json:"text"`
+}
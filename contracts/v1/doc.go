@@ -0,0 +1,7 @@
+// Package v1 holds the version 1 request and response bodies exchanged by the
+// services. Producers and consumers both use these types, so a field renamed on
+// one side is a compile error on the other instead of a silently dropped value.
+//
+// Field names are snake_case. Fields may be added to a version, but never
+// renamed or removed; that needs a v2 package.
+package v1
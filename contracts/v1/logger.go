@@ -0,0 +1,55 @@
+package v1
+
+// LogEntry is the body of POST /log on the logger service. Only name and data
+// are required. Level is debug, info (the default), warn or error; Service
+// names the component of the producer that logged the entry and Fields holds
+// its structured context.
+type LogEntry struct {
+	Name    string            `json:"name"`
+	Data    string            `json:"data"`
+	TraceID string            `json:"trace_id,omitempty"`
+	SpanID  string            `json:"span_id,omitempty"`
+	Level   string            `json:"level,omitempty"`
+	Stack   string            `json:"stack,omitempty"`
+	UserID  string            `json:"user_id,omitempty"`
+	Version string            `json:"version,omitempty"`
+	Service string            `json:"service,omitempty"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// LogExchange is the durable RabbitMQ topic exchange log entries are published
+// to as JSON LogEntry messages, with LogRoutingKey. listener-service drains it
+// into the logger.
+const LogExchange = "logs"
+
+// LogRoutingKey is the routing key of an entry on LogExchange, e.g.
+// "log.user.deleted"
+func LogRoutingKey(name string) string {
+	return "log." + name
+}
+
+// LogBatch is the body of POST /log/batch on the logger service
+type LogBatch struct {
+	Entries []LogEntry `json:"entries"`
+}
+
+// Capture is the body of POST /captures on the logger service, a sanitized
+// request and its response recorded by a service in capture mode
+type Capture struct {
+	Method          string            `json:"method"`
+	Path            string            `json:"path"`
+	Query           string            `json:"query,omitempty"`
+	RequestHeaders  map[string]string `json:"request_headers,omitempty"`
+	RequestBody     string            `json:"request_body,omitempty"`
+	Status          int               `json:"status"`
+	ResponseHeaders map[string]string `json:"response_headers,omitempty"`
+	ResponseBody    string            `json:"response_body,omitempty"`
+	DurationMs      int64             `json:"duration_ms"`
+}
+
+// UserMerge is the body of POST /users/merge on the logger service, sent when
+// the account From was merged into the account To
+type UserMerge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
@@ -0,0 +1,9 @@
+package v1
+
+// Response is the envelope every service answers with. Data is the type of
+// the payload of the endpoint, use json.RawMessage to decode it later.
+type Response[T any] struct {
+	Error   bool   `json:"error"`
+	Message string `json:"message"`
+	Data    T      `json:"data,omitempty"`
+}
@@ -0,0 +1,146 @@
+// Package event drains the log entries the services publish to RabbitMQ.
+package event
+
+import (
+	"context"
+	v1 "contracts/v1"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Consumer reads the entries of the logs exchange from a durable queue and
+// hands them to Write. Entries are acknowledged once written, so those of a
+// listener that stops are delivered again; entries Write failed on are put
+// back on the queue, unless Permanent says the error will not go away.
+type Consumer struct {
+	URL   string
+	Queue string
+
+	Write     func(ctx context.Context, entry v1.LogEntry) error
+	Permanent func(err error) bool
+
+	// Prefetch is how many entries are delivered before they are
+	// acknowledged, 32 when zero
+	Prefetch int
+}
+
+// Run consumes until ctx is done, connecting again whenever the connection
+// drops and waiting longer after each failed attempt up to half a minute
+func (c *Consumer) Run(ctx context.Context) error {
+	backoff := time.Second
+
+	for {
+		err := c.consume(ctx, func() { backoff = time.Second })
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		log.Printf("Log queue consumer stopped, reconnecting in %s: %v", backoff, err)
+
+		select {
+		case <-time.After(backoff):
+			backoff = min(2*backoff, 30*time.Second)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// consume runs one connection, connected is called once it delivers
+func (c *Consumer) consume(ctx context.Context, connected func()) error {
+	conn, err := amqp.Dial(c.URL)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	if err := declare(ch, c.Queue); err != nil {
+		return err
+	}
+
+	prefetch := c.Prefetch
+	if prefetch <= 0 {
+		prefetch = 32
+	}
+	if err := ch.Qos(prefetch, 0, false); err != nil {
+		return err
+	}
+
+	deliveries, err := ch.Consume(c.Queue, "", false, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Consuming log entries from %s", c.Queue)
+	connected()
+
+	for {
+		select {
+		case d, ok := <-deliveries:
+			if !ok {
+				return errors.New("delivery channel closed")
+			}
+			c.handle(ctx, d)
+		case <-ctx.Done():
+			// the entries prefetched but not acknowledged go back to the
+			// queue when the channel closes
+			log.Printf("Stopped consuming from %s", c.Queue)
+			return ctx.Err()
+		}
+	}
+}
+
+// handle writes one entry. The write is not cut short when ctx is done, so
+// the entry in flight at shutdown is written and acknowledged.
+func (c *Consumer) handle(ctx context.Context, d amqp.Delivery) {
+	var entry v1.LogEntry
+	if err := json.Unmarshal(d.Body, &entry); err != nil || entry.Name == "" {
+		log.Printf("Dropping malformed log entry from %s: %v", d.AppId, err)
+		d.Reject(false)
+		return
+	}
+
+	writeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	err := c.Write(writeCtx, entry)
+	cancel()
+
+	switch {
+	case err == nil:
+		d.Ack(false)
+	case c.Permanent != nil && c.Permanent(err):
+		log.Printf("Dropping log entry %s from %s: %v", entry.Name, d.AppId, err)
+		d.Reject(false)
+	default:
+		log.Printf("Error writing log entry %s, requeueing it: %v", entry.Name, err)
+		// the logger is struggling, give it a moment before the next entry
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+		}
+		d.Nack(false, true)
+	}
+}
+
+// declare makes the logs exchange and a durable queue bound to every entry on
+// it, both survive a restart of RabbitMQ
+func declare(ch *amqp.Channel, queue string) error {
+	if err := ch.ExchangeDeclare(v1.LogExchange, "topic", true, false, false, false, nil); err != nil {
+		return err
+	}
+
+	if _, err := ch.QueueDeclare(queue, true, false, false, false, nil); err != nil {
+		return err
+	}
+
+	return ch.QueueBind(queue, v1.LogRoutingKey("#"), v1.LogExchange, false, nil)
+}
@@ -0,0 +1,150 @@
+// Package alert sends alerts raised by the logger to chat channels. Every alert
+// goes through a Dispatcher, which fans it out to the notifiers and keeps alert
+// storms from flooding the channels.
+package alert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Severity of an alert
+const (
+	Info     = "info"
+	Warning  = "warning"
+	Critical = "critical"
+)
+
+// Alert is one notification
+type Alert struct {
+	Name     string            `json:"name"`
+	Severity string            `json:"severity"`
+	Summary  string            `json:"summary"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	FiredAt  time.Time         `json:"fired_at"`
+
+	// Suppressed is the number of alerts with the same name that were held
+	// back by the rate limit since this name was last sent
+	Suppressed int `json:"suppressed,omitempty"`
+}
+
+// Notifier delivers alerts to one channel
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, a Alert) error
+}
+
+// Result is the outcome of sending an alert to one notifier
+type Result struct {
+	Notifier string `json:"notifier"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Dispatcher fans alerts out to the notifiers. The same alert name is sent at
+// most once per Window, and no more than Burst alerts in total per Window;
+// held back alerts are counted and reported with the next one that goes out.
+type Dispatcher struct {
+	Notifiers []Notifier
+	Window    time.Duration
+	Burst     int
+
+	mu          sync.Mutex
+	lastSent    map[string]time.Time
+	suppressed  map[string]int
+	windowStart time.Time
+	sentInWin   int
+}
+
+// NewDispatcher returns a dispatcher with a 5 minute window and a burst of 20
+// when window or burst are zero
+func NewDispatcher(notifiers []Notifier, window time.Duration, burst int) *Dispatcher {
+	if window <= 0 {
+		window = 5 * time.Minute
+	}
+	if burst <= 0 {
+		burst = 20
+	}
+
+	return &Dispatcher{
+		Notifiers:  notifiers,
+		Window:     window,
+		Burst:      burst,
+		lastSent:   make(map[string]time.Time),
+		suppressed: make(map[string]int),
+	}
+}
+
+// Fire sends a to every notifier unless the rate limit holds it back. It reports
+// whether the alert was sent.
+func (d *Dispatcher) Fire(ctx context.Context, a Alert) (bool, error) {
+	if a.FiredAt.IsZero() {
+		a.FiredAt = time.Now().UTC()
+	}
+
+	if !d.allow(&a) {
+		return false, nil
+	}
+
+	_, err := d.send(ctx, a)
+	return true, err
+}
+
+// Test sends a to every notifier, bypassing the rate limit, and reports the
+// result of each notifier
+func (d *Dispatcher) Test(ctx context.Context, a Alert) []Result {
+	if a.FiredAt.IsZero() {
+		a.FiredAt = time.Now().UTC()
+	}
+
+	results, _ := d.send(ctx, a)
+	return results
+}
+
+func (d *Dispatcher) allow(a *Alert) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := a.FiredAt
+
+	if now.Sub(d.windowStart) >= d.Window {
+		d.windowStart = now
+		d.sentInWin = 0
+	}
+
+	last, seen := d.lastSent[a.Name]
+	if (seen && now.Sub(last) < d.Window) || d.sentInWin >= d.Burst {
+		d.suppressed[a.Name]++
+		return false
+	}
+
+	a.Suppressed = d.suppressed[a.Name]
+	delete(d.suppressed, a.Name)
+
+	d.lastSent[a.Name] = now
+	d.sentInWin++
+
+	return true
+}
+
+func (d *Dispatcher) send(ctx context.Context, a Alert) ([]Result, error) {
+	var results []Result
+	var errs []error
+
+	for _, n := range d.Notifiers {
+		result := Result{Notifier: n.Name()}
+
+		if err := n.Notify(ctx, a); err != nil {
+			log.Printf("Sending alert %s to %s failed: %v", a.Name, n.Name(), err)
+			result.Error = err.Error()
+			errs = append(errs, fmt.Errorf("%s: %w", n.Name(), err))
+		}
+
+		results = append(results, result)
+	}
+
+	return results, errors.Join(errs...)
+}
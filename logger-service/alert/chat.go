@@ -0,0 +1,133 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultTemplate renders the message text of an alert
+const DefaultTemplate = `[{{ upper .Severity }}] {{ .Name }}: {{ .Summary }}
+{{- range $key, $value := .Labels }}
+{{ $key }}: {{ $value }}
+{{- end }}
+{{- if .Suppressed }}
+(+{{ .Suppressed }} similar alerts suppressed)
+{{- end }}`
+
+// ParseTemplate parses a message template, an empty text gives DefaultTemplate
+func ParseTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		text = DefaultTemplate
+	}
+
+	return template.New("alert").Funcs(template.FuncMap{"upper": strings.ToUpper}).Parse(text)
+}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// SlackNotifier posts alerts to a Slack incoming webhook
+type SlackNotifier struct {
+	URL      string
+	Template *template.Template
+}
+
+func (s *SlackNotifier) Name() string {
+	return "slack"
+}
+
+func (s *SlackNotifier) Notify(ctx context.Context, a Alert) error {
+	text, err := render(s.Template, a)
+	if err != nil {
+		return err
+	}
+
+	return postJSON(ctx, s.URL, map[string]string{"text": text})
+}
+
+// TeamsNotifier posts alerts to a Microsoft Teams incoming webhook
+type TeamsNotifier struct {
+	URL      string
+	Template *template.Template
+}
+
+func (t *TeamsNotifier) Name() string {
+	return "teams"
+}
+
+func (t *TeamsNotifier) Notify(ctx context.Context, a Alert) error {
+	text, err := render(t.Template, a)
+	if err != nil {
+		return err
+	}
+
+	return postJSON(ctx, t.URL, map[string]any{
+		"@type":      "MessageCard",
+		"@context":   "https://schema.org/extensions",
+		"summary":    a.Name,
+		"themeColor": themeColor(a.Severity),
+		"title":      a.Name,
+		// Teams renders markdown, so keep the line breaks
+		"text": strings.ReplaceAll(text, "\n", "  \n"),
+	})
+}
+
+func themeColor(severity string) string {
+	switch severity {
+	case Critical:
+		return "D32F2F"
+	case Warning:
+		return "F9A825"
+	default:
+		return "1976D2"
+	}
+}
+
+func render(tmpl *template.Template, a Alert) (string, error) {
+	if tmpl == nil {
+		var err error
+		tmpl, err = ParseTemplate("")
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, a); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+func postJSON(ctx context.Context, url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return fmt.Errorf("webhook answered %d: %s", response.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	return nil
+}
@@ -0,0 +1,151 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"contracts/keystore"
+	"contracts/signing"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"text/template"
+)
+
+// WebhookConfig describes an outbound webhook, e.g. a PagerDuty or Opsgenie
+// events endpoint, with the body rendered from a template
+type WebhookConfig struct {
+	Name     string            `json:"name"`
+	URL      string            `json:"url"`
+	Template string            `json:"template"`
+	Secret   string            `json:"secret,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+}
+
+// WebhookNotifier posts alerts to a webhook. When a secret is set the body is
+// signed with the signing package, the same way the broker checks inbound
+// webhooks.
+type WebhookNotifier struct {
+	name    string
+	url     string
+	secret  string
+	keys    *keystore.Store
+	headers map[string]string
+	body    *template.Template
+}
+
+// ParseWebhooks reads ALERT_WEBHOOKS, a JSON list of WebhookConfig. Webhooks
+// without a secret of their own are signed with the current webhooks key of keys.
+func ParseWebhooks(s string, keys *keystore.Store) ([]*WebhookNotifier, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var configs []WebhookConfig
+	if err := json.Unmarshal([]byte(s), &configs); err != nil {
+		return nil, fmt.Errorf("invalid alert webhooks: %w", err)
+	}
+
+	var notifiers []*WebhookNotifier
+
+	for _, c := range configs {
+		if c.Secret == "" && !keys.Has(keystore.PurposeWebhooks) {
+			log.Printf("alert webhook %s has no secret, its deliveries are not signed", c.Name)
+		}
+
+		n, err := NewWebhookNotifier(c)
+		if err != nil {
+			return nil, err
+		}
+		n.keys = keys
+		notifiers = append(notifiers, n)
+	}
+
+	return notifiers, nil
+}
+
+// NewWebhookNotifier parses the body template of a webhook. Inside the template
+// the alert is the dot and {{ json .Summary }} writes a value as JSON.
+func NewWebhookNotifier(c WebhookConfig) (*WebhookNotifier, error) {
+	if c.Name == "" || c.URL == "" {
+		return nil, fmt.Errorf("alert webhook needs a name and a url")
+	}
+
+	text := c.Template
+	if text == "" {
+		text = `{{ json . }}`
+	}
+
+	body, err := template.New(c.Name).Funcs(template.FuncMap{
+		"json":  toJSON,
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+	}).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("alert webhook %s: %w", c.Name, err)
+	}
+
+	return &WebhookNotifier{
+		name:    c.Name,
+		url:     c.URL,
+		secret:  c.Secret,
+		headers: c.Headers,
+		body:    body,
+	}, nil
+}
+
+func toJSON(v any) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+func (n *WebhookNotifier) Name() string {
+	return "webhook:" + n.name
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, a Alert) error {
+	var buf bytes.Buffer
+	if err := n.body.Execute(&buf, a); err != nil {
+		return err
+	}
+
+	body := buf.Bytes()
+	if !json.Valid(body) {
+		return fmt.Errorf("template did not render valid JSON")
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range n.headers {
+		request.Header.Set(key, value)
+	}
+
+	switch {
+	case n.secret != "":
+		signing.SignRequest(request, keystore.Key{Secret: []byte(n.secret)}, body)
+	case n.keys != nil:
+		key, err := n.keys.Signing(keystore.PurposeWebhooks)
+		if err == nil {
+			signing.SignRequest(request, key, body)
+		}
+	}
+
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return fmt.Errorf("webhook answered %d: %s", response.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"contracts/keystore"
+	"logger/alert"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+type TestAlertPayload struct {
+	Severity string `json:"severity"`
+	Summary  string `json:"summary"`
+}
+
+// newDispatcher builds the alert dispatcher from ALERT_SLACK_WEBHOOK,
+// ALERT_TEAMS_WEBHOOK, ALERT_WEBHOOKS, ALERT_TEMPLATE, ALERT_RATE_WINDOW and ALERT_BURST
+func newDispatcher(keys *keystore.Store) (*alert.Dispatcher, error) {
+	tmpl, err := alert.ParseTemplate(os.Getenv("ALERT_TEMPLATE"))
+	if err != nil {
+		return nil, err
+	}
+
+	var notifiers []alert.Notifier
+
+	if url := os.Getenv("ALERT_SLACK_WEBHOOK"); url != "" {
+		notifiers = append(notifiers, &alert.SlackNotifier{URL: url, Template: tmpl})
+	}
+	if url := os.Getenv("ALERT_TEAMS_WEBHOOK"); url != "" {
+		notifiers = append(notifiers, &alert.TeamsNotifier{URL: url, Template: tmpl})
+	}
+
+	webhooks, err := alert.ParseWebhooks(os.Getenv("ALERT_WEBHOOKS"), keys)
+	if err != nil {
+		return nil, err
+	}
+	for _, webhook := range webhooks {
+		notifiers = append(notifiers, webhook)
+	}
+
+	window, _ := time.ParseDuration(os.Getenv("ALERT_RATE_WINDOW"))
+	burst, _ := strconv.Atoi(os.Getenv("ALERT_BURST"))
+
+	return alert.NewDispatcher(notifiers, window, burst), nil
+}
+
+// TestAlert fires a test alert to every configured channel, ignoring the rate limit
+func (app *Config) TestAlert(w http.ResponseWriter, r *http.Request) {
+	var requestPayload TestAlertPayload
+
+	if r.ContentLength > 0 {
+		err := app.readJson(w, r, &requestPayload)
+		if err != nil {
+			app.errorJson(w, err)
+			return
+		}
+	}
+
+	if requestPayload.Severity == "" {
+		requestPayload.Severity = alert.Info
+	}
+	if requestPayload.Summary == "" {
+		requestPayload.Summary = "Test alert from the logger service"
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	results := app.Alerts.Test(ctx, alert.Alert{
+		Name:     "test",
+		Severity: requestPayload.Severity,
+		Summary:  requestPayload.Summary,
+	})
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: "test alert sent",
+		Data:    results,
+	})
+}
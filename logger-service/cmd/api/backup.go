@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"contracts/config"
+	"errors"
+	"fmt"
+	"log"
+	"logger/alert"
+	"logger/data"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// backupStore keeps the archives in the bucket BACKUP_S3_BUCKET when it is
+// set, in the directory BACKUP_DIR, /backups by default, otherwise.
+// BACKUP_S3_ENDPOINT is any store speaking the S3 API, e.g.
+// https://storage.googleapis.com with BACKUP_S3_REGION auto and the HMAC keys
+// of a service account for GCS.
+func backupStore(cfg *config.Config) data.BackupStore {
+	bucket := cfg.String("BACKUP_S3_BUCKET", "")
+	if bucket == "" {
+		return data.LocalBackups{Dir: cfg.String("BACKUP_DIR", "/backups")}
+	}
+
+	return &data.S3Backups{
+		Endpoint:  cfg.URL("BACKUP_S3_ENDPOINT", "https://s3.amazonaws.com", "http", "https"),
+		Region:    cfg.String("BACKUP_S3_REGION", "us-east-1"),
+		Bucket:    bucket,
+		Prefix:    cfg.String("BACKUP_S3_PREFIX", ""),
+		AccessKey: cfg.Required("BACKUP_S3_ACCESS_KEY"),
+		SecretKey: cfg.Required("BACKUP_S3_SECRET_KEY"),
+		Client:    &http.Client{Timeout: 30 * time.Minute},
+	}
+}
+
+type BackupPayload struct {
+	Collections []string `json:"collections"`
+}
+
+// ListBackups returns the archives in the backup store
+func (app *Config) ListBackups(w http.ResponseWriter, r *http.Request) {
+	backups, err := app.Backups.List(r.Context())
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: "backups",
+		Data:    backups,
+	})
+}
+
+// DownloadBackup serves a stored archive. Range requests let clients resume a
+// broken download, with If-Range and the ETag of the archive they check that
+// the archive is the one they started on.
+func (app *Config) DownloadBackup(w http.ResponseWriter, r *http.Request) {
+	f, info, err := app.Backups.Open(r.Context(), chi.URLParam(r, "name"))
+	if errors.Is(err, data.ErrBackupNotFound) {
+		app.errorJson(w, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("ETag", info.ETag)
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", info.Name))
+
+	http.ServeContent(w, r, info.Name, info.CreatedAt, f)
+}
+
+// CreateBackup starts a job that dumps the requested collections, or all log
+// collections, and answers with the job to poll
+func (app *Config) CreateBackup(w http.ResponseWriter, r *http.Request) {
+	var requestPayload BackupPayload
+
+	if r.ContentLength > 0 {
+		err := app.readJson(w, r, &requestPayload)
+		if err != nil {
+			app.errorJson(w, err)
+			return
+		}
+	}
+
+	job, err := app.Models.Job.Start("backup", func(ctx context.Context, progress data.ProgressFunc) (any, error) {
+		ctx, cancel := context.WithTimeout(ctx, 30*time.Minute)
+		defer cancel()
+
+		name, err := data.Backup(ctx, app.Backups, requestPayload.Collections, progress)
+		if err != nil {
+			return nil, err
+		}
+
+		return map[string]string{"name": name}, nil
+	})
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJson(w, http.StatusAccepted, jsonReponse{
+		Error:   false,
+		Message: "backup started",
+		Data:    job,
+	})
+}
+
+// scheduleBackups writes a backup of all log collections at every interval,
+// on one replica at a time
+func (app *Config) scheduleBackups(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lease := app.newLease("backups", interval+30*time.Second)
+
+	for range ticker.C {
+		if !lease.hold() {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+		name, err := data.Backup(ctx, app.Backups, nil, nil)
+		cancel()
+
+		if err != nil {
+			log.Println("Scheduled backup failed:", err)
+			app.Alerts.Fire(context.Background(), alert.Alert{
+				Name:     "backup_failed",
+				Severity: alert.Critical,
+				Summary:  err.Error(),
+			})
+			continue
+		}
+
+		log.Println("Scheduled backup written:", name)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	v1 "contracts/v1"
+	"errors"
+	"logger/data"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// StoreCapture stores a request and response captured by the producer
+func (app *Config) StoreCapture(w http.ResponseWriter, r *http.Request) {
+	var requestPayload v1.Capture
+
+	err := app.readJson(w, r, &requestPayload)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	if requestPayload.Method == "" || requestPayload.Path == "" {
+		app.errorJson(w, errors.New("method and path are required"))
+		return
+	}
+
+	err = app.Models.Capture.Insert(data.Capture{
+		Service:         producerFromContext(r.Context()),
+		Method:          requestPayload.Method,
+		Path:            requestPayload.Path,
+		Query:           requestPayload.Query,
+		RequestHeaders:  requestPayload.RequestHeaders,
+		RequestBody:     requestPayload.RequestBody,
+		Status:          requestPayload.Status,
+		ResponseHeaders: requestPayload.ResponseHeaders,
+		ResponseBody:    requestPayload.ResponseBody,
+		DurationMs:      requestPayload.DurationMs,
+	})
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListCaptures returns captures oldest first, filtered by ?service=, ?method=,
+// ?path= and ?since= (a duration, 24h by default)
+func (app *Config) ListCaptures(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	since := 24 * time.Hour
+	if v := query.Get("since"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			app.errorJson(w, errors.New("invalid since"))
+			return
+		}
+		since = d
+	}
+
+	limit := int64(100)
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 || n > 1000 {
+			app.errorJson(w, errors.New("limit must be between 1 and 1000"))
+			return
+		}
+		limit = n
+	}
+
+	captures, err := app.Models.Capture.List(query.Get("service"), query.Get("method"), query.Get("path"), time.Now().Add(-since), limit)
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: "captures",
+		Data:    captures,
+	})
+}
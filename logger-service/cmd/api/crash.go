@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"logger/alert"
+	"logger/data"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxStackSize bounds the stack trace of one crash report
+const maxStackSize = 64 << 10
+
+type CrashPayload struct {
+	Message string            `json:"message"`
+	Stack   string            `json:"stack"`
+	Runtime map[string]string `json:"runtime,omitempty"`
+	TraceID string            `json:"trace_id,omitempty"`
+}
+
+// ReportCrash stores a panic recovered by the producer. The first report of a
+// stack fires an alert, the next ones are only counted.
+func (app *Config) ReportCrash(w http.ResponseWriter, r *http.Request) {
+	var requestPayload CrashPayload
+
+	err := app.readJson(w, r, &requestPayload)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	if requestPayload.Stack == "" {
+		app.errorJson(w, errors.New("stack is required"))
+		return
+	}
+	if len(requestPayload.Stack) > maxStackSize {
+		requestPayload.Stack = requestPayload.Stack[:maxStackSize]
+	}
+
+	if !data.ValidTraceID(requestPayload.TraceID) {
+		requestPayload.TraceID = ""
+		if traceID, _, ok := data.ParseTraceparent(r.Header.Get("traceparent")); ok {
+			requestPayload.TraceID = traceID
+		}
+	}
+
+	crash, err := app.Models.Crash.Record(data.Crash{
+		Service: producerFromContext(r.Context()),
+		Message: requestPayload.Message,
+		Stack:   requestPayload.Stack,
+		Runtime: requestPayload.Runtime,
+		TraceID: requestPayload.TraceID,
+	})
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.publishEvent("crashes", "crash.reported", crash)
+
+	if crash.Count == 1 {
+		app.Alerts.Fire(context.Background(), alert.Alert{
+			Name:     "new_crash",
+			Severity: alert.Critical,
+			Summary:  crash.Service + ": " + crash.Message,
+			Labels: map[string]string{
+				"service":     crash.Service,
+				"fingerprint": crash.Fingerprint,
+			},
+		})
+	}
+
+	app.writeJson(w, http.StatusAccepted, jsonReponse{
+		Error:   false,
+		Message: "crash recorded",
+		Data:    crash,
+	})
+}
+
+// TopCrashes lists the most frequent crashes, optionally of one service and
+// over a window such as ?since=24h
+func (app *Config) TopCrashes(w http.ResponseWriter, r *http.Request) {
+	since := 7 * 24 * time.Hour
+	if v := r.URL.Query().Get("since"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			app.errorJson(w, errors.New("invalid since"))
+			return
+		}
+		since = d
+	}
+
+	limit := int64(20)
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 || n > 100 {
+			app.errorJson(w, errors.New("limit must be between 1 and 100"))
+			return
+		}
+		limit = n
+	}
+
+	crashes, err := app.Models.Crash.Top(r.URL.Query().Get("service"), time.Now().Add(-since), limit)
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: "crashes",
+		Data:    crashes,
+	})
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"logger/data"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// declaredConfig is the admin configuration of the logger as a document, e.g.
+//
+//	producers:
+//	  broker:
+//	    allow_cidrs: [10.0.0.0/8]
+//	  authentication:
+//	    allow_cidrs: [10.0.0.0/8]
+//	    deny_cidrs: [10.0.9.0/24]
+//
+// The document is the whole truth: producers left out lose their rules.
+type declaredConfig struct {
+	Producers map[string]declaredProducer `yaml:"producers"`
+}
+
+// declaredProducer is the address rules every token of a producer is held to
+type declaredProducer struct {
+	AllowCIDRs []string `yaml:"allow_cidrs" json:"allow_cidrs,omitempty"`
+	DenyCIDRs  []string `yaml:"deny_cidrs" json:"deny_cidrs,omitempty"`
+}
+
+// change actions
+const (
+	changeCreate = "create"
+	changeUpdate = "update"
+	changeDelete = "delete"
+)
+
+// configChange is one difference between the document and the stored state
+type configChange struct {
+	Action string `json:"action"`
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Before any    `json:"before,omitempty"`
+	After  any    `json:"after,omitempty"`
+}
+
+// configPlan is the answer of ApplyConfig
+type configPlan struct {
+	Mode    string         `json:"mode"`
+	Changes []configChange `json:"changes"`
+	Applied int            `json:"applied"`
+}
+
+// ApplyConfig compares a YAML document of the admin configuration with the
+// stored state. With ?mode=plan, the default, it returns the changes; with
+// ?mode=apply it makes them too. Applying the same document twice changes
+// nothing the second time.
+func (app *Config) ApplyConfig(w http.ResponseWriter, r *http.Request) {
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = "plan"
+	}
+	if mode != "plan" && mode != "apply" {
+		app.errorJson(w, fmt.Errorf("unknown mode %q, use plan or apply", mode))
+		return
+	}
+
+	declared, err := app.readConfig(w, r)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	current, err := app.Models.IPRules.All()
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	plan := configPlan{Mode: mode, Changes: diffProducers(declared.Producers, current)}
+
+	if mode == "apply" {
+		for _, c := range plan.Changes {
+			if err := app.applyChange(c); err != nil {
+				app.errorJson(w, fmt.Errorf("%d of %d changes applied, %s %s failed: %w", plan.Applied, len(plan.Changes), c.Action, c.Name, err), http.StatusInternalServerError)
+				return
+			}
+			plan.Applied++
+		}
+
+		if plan.Applied > 0 {
+			err := app.Models.LogEntry.Insert(data.LogEntry{
+				Name:     "config.applied",
+				Data:     fmt.Sprintf("%d changes", plan.Applied),
+				Producer: "logger",
+			})
+			if err != nil {
+				log.Println("Error logging the applied configuration:", err)
+			}
+		}
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: fmt.Sprintf("%d changes", len(plan.Changes)),
+		Data:    plan,
+	})
+}
+
+// readConfig decodes and checks the document. Unknown keys are rejected so a
+// typo does not silently drop a setting.
+func (app *Config) readConfig(w http.ResponseWriter, r *http.Request) (*declaredConfig, error) {
+	maxBytes := app.MaxBodyBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxBodyBytes
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBytes))
+	if err != nil {
+		return nil, decodeError(err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(body))
+	dec.KnownFields(true)
+
+	var declared declaredConfig
+	err = dec.Decode(&declared)
+	switch {
+	case errors.Is(err, io.EOF):
+		// an empty body would remove everything, that has to be asked for
+		return nil, errors.New("empty configuration, send \"producers: {}\" to remove every rule")
+	case err != nil:
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	for producer, rules := range declared.Producers {
+		if strings.TrimSpace(producer) == "" {
+			return nil, errors.New("invalid configuration: producers need a name")
+		}
+		if err := validIPRules(IPRulesPayload{Allow: rules.AllowCIDRs, Deny: rules.DenyCIDRs}); err != nil {
+			return nil, fmt.Errorf("invalid configuration of producer %s: %w", producer, err)
+		}
+	}
+
+	return &declared, nil
+}
+
+// diffProducers lists the changes that turn the stored producer rules into the
+// declared ones, in name order
+func diffProducers(declared map[string]declaredProducer, current []*data.ProducerIPRules) []configChange {
+	stored := make(map[string]*data.ProducerIPRules, len(current))
+	for _, rules := range current {
+		stored[rules.Producer] = rules
+	}
+
+	changes := []configChange{}
+
+	for producer, want := range declared {
+		have, ok := stored[producer]
+		switch {
+		case !ok:
+			changes = append(changes, configChange{Action: changeCreate, Kind: "producer", Name: producer, After: want})
+		case !slices.Equal(have.AllowCIDRs, want.AllowCIDRs) || !slices.Equal(have.DenyCIDRs, want.DenyCIDRs):
+			changes = append(changes, configChange{
+				Action: changeUpdate,
+				Kind:   "producer",
+				Name:   producer,
+				Before: declaredProducer{AllowCIDRs: have.AllowCIDRs, DenyCIDRs: have.DenyCIDRs},
+				After:  want,
+			})
+		}
+	}
+
+	for producer, have := range stored {
+		if _, ok := declared[producer]; !ok {
+			changes = append(changes, configChange{
+				Action: changeDelete,
+				Kind:   "producer",
+				Name:   producer,
+				Before: declaredProducer{AllowCIDRs: have.AllowCIDRs, DenyCIDRs: have.DenyCIDRs},
+			})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+
+	return changes
+}
+
+func (app *Config) applyChange(c configChange) error {
+	if c.Action == changeDelete {
+		return app.Models.IPRules.Delete(c.Name)
+	}
+
+	want := c.After.(declaredProducer)
+	_, err := app.Models.IPRules.Set(c.Name, want.AllowCIDRs, want.DenyCIDRs)
+	return err
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"contracts/keystore"
+	"contracts/signing"
+	v1 "contracts/v1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"logger/data"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// defaultReplayRate is how many events a replay sends per second when the
+// request does not say. The broker drops events its clients do not read fast
+// enough, so a replay is paced.
+const defaultReplayRate = 50
+
+// consumerName is what a replay can be sent to, see v1.ReplayChannel
+var consumerName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+type ReplayPayload struct {
+	// Consumer receives the events on its replay channel, e.g. "broker"
+	Consumer string `json:"consumer"`
+
+	// Topic is the aggregate to replay, e.g. "job:auth-1f2e", all when empty
+	Topic string `json:"topic"`
+
+	// From and To bound the time the events were published, To is now when zero
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+
+	// Rate is the events sent per second
+	Rate int `json:"rate"`
+}
+
+// storeEvents keeps every event published on the bus, so a consumer that lost
+// some can be sent them again. Events with an invalid signature are not kept.
+func (app *Config) storeEvents() {
+	if app.Redis == nil {
+		return
+	}
+
+	for {
+		pubsub := app.Redis.PSubscribe(context.Background(), "events:*")
+
+		for msg := range pubsub.Channel() {
+			var e v1.Event
+			if err := json.Unmarshal([]byte(msg.Payload), &e); err != nil {
+				log.Println("Not storing malformed event:", err)
+				continue
+			}
+
+			if app.Keys.Has(keystore.PurposeEvents) {
+				keys := app.Keys.Verifying(keystore.PurposeEvents)
+				if err := signing.VerifyEvent(e, keys, time.Now(), signing.DefaultTolerance); err != nil {
+					log.Printf("Not storing event %s on %s: %v", e.ID, e.Topic, err)
+					continue
+				}
+			}
+
+			if _, err := app.Models.Event.Insert(e); err != nil {
+				log.Printf("Error storing event %s on %s: %v", e.ID, e.Topic, err)
+			}
+		}
+
+		pubsub.Close()
+		log.Println("Event subscription closed, subscribing again")
+		time.Sleep(time.Second)
+	}
+}
+
+// ReplayEvents starts a job that sends the stored events of a topic or time
+// range again, to one consumer, in the order they were published. Replayed
+// events keep their id and are signed again with the current key.
+func (app *Config) ReplayEvents(w http.ResponseWriter, r *http.Request) {
+	var requestPayload ReplayPayload
+
+	err := app.readJson(w, r, &requestPayload)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	if app.Redis == nil {
+		app.errorJson(w, errors.New("no event bus is configured"), http.StatusServiceUnavailable)
+		return
+	}
+
+	if requestPayload.To.IsZero() {
+		requestPayload.To = time.Now()
+	}
+	if requestPayload.Rate <= 0 {
+		requestPayload.Rate = defaultReplayRate
+	}
+
+	switch {
+	case !consumerName.MatchString(requestPayload.Consumer):
+		app.errorJson(w, errors.New("consumer must be a lower case name, e.g. broker"))
+		return
+	case requestPayload.Topic == "" && requestPayload.From.IsZero():
+		app.errorJson(w, errors.New("a topic or a from time is required"))
+		return
+	case !requestPayload.From.Before(requestPayload.To):
+		app.errorJson(w, errors.New("from must be before to"))
+		return
+	case requestPayload.Rate > 1000:
+		app.errorJson(w, errors.New("rate can be at most 1000 events per second"))
+		return
+	}
+
+	filter := data.EventFilter{
+		Topic: requestPayload.Topic,
+		From:  requestPayload.From,
+		To:    requestPayload.To,
+	}
+
+	job, err := app.Models.Job.Start("replay_events", func(ctx context.Context, progress data.ProgressFunc) (any, error) {
+		ctx, cancel := context.WithTimeout(ctx, 2*time.Hour)
+		defer cancel()
+
+		return app.replayEvents(ctx, requestPayload.Consumer, filter, requestPayload.Rate, progress)
+	})
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	err = app.Models.LogEntry.Insert(data.LogEntry{
+		Name:     "events.replay",
+		Data:     fmt.Sprintf("replaying %q from %s to %s to %s", filter.Topic, filter.From.Format(time.RFC3339), filter.To.Format(time.RFC3339), requestPayload.Consumer),
+		Producer: "logger",
+	})
+	if err != nil {
+		log.Println("Error logging the event replay:", err)
+	}
+
+	app.writeJson(w, http.StatusAccepted, jsonReponse{
+		Error:   false,
+		Message: "replay started",
+		Data:    job,
+	})
+}
+
+func (app *Config) replayEvents(ctx context.Context, consumer string, filter data.EventFilter, rate int, progress data.ProgressFunc) (any, error) {
+	total, err := app.Models.Event.Count(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	tick := time.NewTicker(time.Second / time.Duration(rate))
+	defer tick.Stop()
+
+	var sent int64
+
+	err = app.Models.Event.Each(ctx, filter, func(stored *data.StoredEvent) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick.C:
+		}
+
+		e := v1.Event{
+			ID:       stored.ID,
+			Topic:    stored.Topic,
+			Type:     stored.Type,
+			Data:     stored.Data,
+			Schema:   stored.Schema,
+			Version:  stored.Version,
+			Replayed: true,
+		}
+		if key, err := app.Keys.Signing(keystore.PurposeEvents); err == nil {
+			signing.SignEvent(&e, key)
+		}
+
+		payload, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+
+		if err := app.Redis.Publish(ctx, v1.ReplayChannel(consumer, e.Topic), payload).Err(); err != nil {
+			return err
+		}
+
+		sent++
+		if sent%100 == 0 && total > 0 {
+			progress(int(sent*100/total), fmt.Sprintf("%d of %d events", sent, total))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%d of %d events replayed: %w", sent, total, err)
+	}
+
+	return map[string]any{"consumer": consumer, "replayed": sent}, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"contracts/logpb"
+	"errors"
+	"fmt"
+	"log"
+	"logger/data"
+	"net"
+	"net/netip"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// LogServer is the gRPC LogService. Producers authenticate like on /log, with
+// their ingest token as "authorization: Bearer <token>" metadata, and the
+// address lists of the token apply too.
+type LogServer struct {
+	logpb.UnimplementedLogServiceServer
+
+	app *Config
+}
+
+// WriteLog stores one entry
+func (s *LogServer) WriteLog(ctx context.Context, entry *logpb.LogEntry) (*logpb.WriteLogResponse, error) {
+	ctx, err := s.app.authenticateProducer(ctx, bearerFromMetadata(ctx), peerAddr(ctx))
+	switch {
+	case errors.Is(err, data.ErrInvalidToken):
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, errAddressNotAllowed):
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	var traceparent string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("traceparent"); len(values) > 0 {
+			traceparent = values[0]
+		}
+	}
+
+	err = s.app.ingest(ctx, traceparent, JSONPayload{
+		Name:    entry.GetName(),
+		Data:    entry.GetData(),
+		TraceID: entry.GetTraceId(),
+		SpanID:  entry.GetSpanId(),
+		Level:   entry.GetLevel(),
+		Stack:   entry.GetStack(),
+		UserID:  entry.GetUserId(),
+		Version: entry.GetVersion(),
+		Service: entry.GetService(),
+		Fields:  entry.GetFields(),
+	})
+	switch {
+	case errors.Is(err, data.ErrInvalidEntry):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, data.ErrBackpressure):
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, data.ErrWriterStopped):
+		return nil, status.Error(codes.Unavailable, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &logpb.WriteLogResponse{}, nil
+}
+
+// authenticateProducer checks the ingest token of a gRPC or RPC call from addr
+// and returns ctx with the producer on it. Errors are data.ErrInvalidToken,
+// errAddressNotAllowed or those of the lookups.
+func (app *Config) authenticateProducer(ctx context.Context, plain string, addr netip.Addr) (context.Context, error) {
+	token, err := app.Models.IngestToken.Authenticate(plain)
+	if err != nil {
+		if !errors.Is(err, data.ErrInvalidToken) {
+			log.Println("Error checking ingest token", err)
+		}
+		return nil, data.ErrInvalidToken
+	}
+
+	if err := app.checkAddr(addr, token); err != nil {
+		if !errors.Is(err, errAddressNotAllowed) {
+			log.Println("Error checking client address", err)
+			return nil, err
+		}
+		log.Printf("Refused ingest token %s of %s from %s", token.Prefix, token.Producer, addr)
+		return nil, err
+	}
+
+	return context.WithValue(ctx, producerKey, token.Producer), nil
+}
+
+func bearerFromMetadata(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return ""
+	}
+
+	return strings.TrimPrefix(values[0], "Bearer ")
+}
+
+func peerAddr(ctx context.Context) netip.Addr {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return netip.Addr{}
+	}
+	return parseRemoteAddr(p.Addr.String())
+}
+
+// gRPCListen serves LogService on GRPCPort until the server is stopped
+func (app *Config) gRPCListen(srv *grpc.Server) error {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", app.GRPCPort))
+	if err != nil {
+		return err
+	}
+
+	logpb.RegisterLogServiceServer(srv, &LogServer{app: app})
+
+	log.Printf("gRPC server started on port %s", app.GRPCPort)
+
+	return srv.Serve(lis)
+}
@@ -1,39 +1,247 @@
 package main
 
 import (
+	"context"
+	v1 "contracts/v1"
+	"errors"
+	"fmt"
 	"logger/data"
 	"net/http"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
-type JSONPayload struct {
-	Name string `json:"name"`
-	Data string `json:"data"`
-}
+// JSONPayload is one entry as sent by the producers, see the contracts module
+type JSONPayload = v1.LogEntry
 
-func (app *Config) WriterLog(w http.ResponseWriter, r *http.Request) {
-	// read json into var
+// maxBatchEntries bounds the entries of one /log/batch request
+const maxBatchEntries = 1000
 
+type BatchPayload = v1.LogBatch
+
+// WriterLog stores one entry, sent as JSON or as a protobuf LogEntry
+func (app *Config) WriterLog(w http.ResponseWriter, r *http.Request) {
 	var requestPayload JSONPayload
 
-	_ = app.readJson(w, r, &requestPayload)
+	if isProtobuf(r) {
+		body, err := app.readBody(w, r)
+		if err == nil {
+			requestPayload, err = decodeLogEntry(body.Bytes())
+			releaseBody(body)
+		}
+		if err != nil {
+			app.errorJson(w, err)
+			return
+		}
+	} else {
+		err := app.readLogPayload(w, r, &requestPayload)
+		if err != nil {
+			app.errorJson(w, err)
+			return
+		}
+	}
+
+	err := app.ingest(r.Context(), r.Header.Get("traceparent"), requestPayload)
+	if err != nil {
+		app.ingestError(w, err)
+		return
+	}
+
+	resp := jsonReponse{
+		Error:   false,
+		Message: "logged",
+	}
+
+	app.writeJson(w, http.StatusAccepted, resp)
+
+}
+
+// WriterLogBatch stores several entries, sent as JSON or as a protobuf
+// LogBatch. Entries are written in order and the first failure stops the batch;
+// the response says how many were stored.
+func (app *Config) WriterLogBatch(w http.ResponseWriter, r *http.Request) {
+	var requestPayload BatchPayload
+
+	if isProtobuf(r) {
+		body, err := app.readBody(w, r)
+		if err == nil {
+			requestPayload.Entries, err = decodeLogBatch(body.Bytes())
+			releaseBody(body)
+		}
+		if err != nil {
+			app.errorJson(w, err)
+			return
+		}
+	} else {
+		err := app.readLogBatch(w, r, &requestPayload)
+		if err != nil {
+			app.errorJson(w, err)
+			return
+		}
+	}
+
+	if len(requestPayload.Entries) == 0 {
+		app.errorJson(w, errors.New("entries are required"))
+		return
+	}
+	if len(requestPayload.Entries) > maxBatchEntries {
+		app.errorJson(w, fmt.Errorf("a batch holds at most %d entries", maxBatchEntries))
+		return
+	}
+
+	for i, entry := range requestPayload.Entries {
+		err := app.ingest(r.Context(), r.Header.Get("traceparent"), entry)
+		if err != nil {
+			if i > 0 {
+				w.Header().Set("X-Logged-Entries", strconv.Itoa(i))
+			}
+			app.ingestError(w, fmt.Errorf("entries[%d]: %w", i, err))
+			return
+		}
+	}
+
+	app.writeJson(w, http.StatusAccepted, jsonReponse{
+		Error:   false,
+		Message: "logged",
+		Data:    map[string]int{"logged": len(requestPayload.Entries)},
+	})
+}
+
+// ingest is the single path every entry takes, whatever its encoding and
+// transport. The producer comes from ctx, traceparent is the W3C header of the
+// request if any.
+func (app *Config) ingest(ctx context.Context, traceparent string, requestPayload JSONPayload) error {
+	level, err := data.NormalizeLevel(requestPayload.Level)
+	if err != nil {
+		return err
+	}
+	if err := data.ValidateFields(requestPayload.Fields); err != nil {
+		return err
+	}
 
-	// insert data
 	event := data.LogEntry{
-		Name: requestPayload.Name,
-		Data: requestPayload.Data,
+		Name:     requestPayload.Name,
+		Data:     requestPayload.Data,
+		Producer: producerFromContext(ctx),
+		Level:    level,
+		Service:  requestPayload.Service,
+		Fields:   requestPayload.Fields,
+		UserID:   requestPayload.UserID,
+
+		ProducerVersion: requestPayload.Version,
+	}
+
+	if data.IsErrorLevel(event.Level) {
+		if len(requestPayload.Stack) > maxStackSize {
+			requestPayload.Stack = requestPayload.Stack[:maxStackSize]
+		}
+		event.IssueID = data.IssueID(event.Producer, event.Data, requestPayload.Stack)
+	}
+
+	// the trace comes from the payload or else from the traceparent header
+	if data.ValidTraceID(requestPayload.TraceID) {
+		event.TraceID = requestPayload.TraceID
+		if data.ValidSpanID(requestPayload.SpanID) {
+			event.SpanID = requestPayload.SpanID
+		}
+	} else if traceID, spanID, ok := data.ParseTraceparent(traceparent); ok {
+		event.TraceID, event.SpanID = traceID, spanID
 	}
 
-	err := app.Models.LogEntry.Insert(event)
+	err = app.Models.LogEntry.Insert(event)
 	if err != nil {
+		return err
+	}
+
+	// admins can tail new entries on the broker's "logs" topic
+	app.publishEvent("logs", "log", event)
+
+	if event.IssueID != "" {
+		app.recordIssue(event, requestPayload.Stack)
+	}
+
+	return nil
+}
+
+func (app *Config) ingestError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, data.ErrBackpressure):
+		w.Header().Set("Retry-After", "1")
+		app.errorJson(w, err, http.StatusServiceUnavailable)
+	case errors.Is(err, data.ErrWriterStopped):
+		// this replica is shutting down, another one takes the retry
+		app.errorJson(w, err, http.StatusServiceUnavailable)
+	default:
 		app.errorJson(w, err)
+	}
+}
+
+// VerifyLog walks the hash chain and reports whether any entry was edited or removed
+func (app *Config) VerifyLog(w http.ResponseWriter, r *http.Request) {
+	report, err := app.Models.LogEntry.Verify()
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	resp := jsonReponse{
+		Error:   !report.Valid,
+		Message: "log chain verified",
+		Data:    report,
+	}
+
+	if !report.Valid {
+		resp.Message = "log chain verification failed"
+	}
+
+	app.writeJson(w, http.StatusOK, resp)
+}
+
+type RedactPayload struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+	// Actor names who asks for the redaction, the tombstone records it next
+	// to the admin key the request was made with
+	Actor string `json:"actor"`
+}
+
+// RedactLog blanks the data of a single entry and records a tombstone for it.
+// This is the only way to change an entry when write-once mode is enabled.
+func (app *Config) RedactLog(w http.ResponseWriter, r *http.Request) {
+	var requestPayload RedactPayload
+
+	err := app.readJson(w, r, &requestPayload)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	if requestPayload.ID == "" || requestPayload.Reason == "" || requestPayload.Actor == "" {
+		app.errorJson(w, errors.New("id, reason and actor are required"))
+		return
+	}
+
+	actor := data.Actor{Credential: adminKeyCredential, Name: requestPayload.Actor}
+
+	tombstone, err := app.Models.LogEntry.Redact(requestPayload.ID, requestPayload.Reason, actor)
+	if err != nil {
+		switch {
+		case errors.Is(err, mongo.ErrNoDocuments):
+			app.errorJson(w, errors.New("log entry not found"), http.StatusNotFound)
+		case errors.Is(err, data.ErrAlreadyRedacted):
+			app.errorJson(w, err, http.StatusConflict)
+		default:
+			app.errorJson(w, err, http.StatusInternalServerError)
+		}
 		return
 	}
 
 	resp := jsonReponse{
 		Error:   false,
-		Message: "logged",
+		Message: "redacted",
+		Data:    tombstone,
 	}
 
 	app.writeJson(w, http.StatusAccepted, resp)
-
 }
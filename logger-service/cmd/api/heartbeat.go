@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"logger/alert"
+	"logger/data"
+	"net/http"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// defaultHeartbeatInterval is assumed when a service does not say how often it beats
+const defaultHeartbeatInterval = 30 * time.Second
+
+type HeartbeatPayload struct {
+	IntervalSeconds int64              `json:"interval_seconds"`
+	Requests        *data.RequestStats `json:"requests,omitempty"`
+}
+
+// Heartbeat records a sign of life of the producer that sent it
+func (app *Config) Heartbeat(w http.ResponseWriter, r *http.Request) {
+	var requestPayload HeartbeatPayload
+
+	if r.ContentLength > 0 {
+		err := app.readJson(w, r, &requestPayload)
+		if err != nil {
+			app.errorJson(w, err)
+			return
+		}
+	}
+
+	interval := time.Duration(requestPayload.IntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = defaultHeartbeatInterval
+	}
+
+	service := producerFromContext(r.Context())
+
+	err := app.Models.Heartbeat.Beat(service, interval)
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if requestPayload.Requests != nil {
+		err = app.Models.SLOSample.Record(service, *requestPayload.Requests)
+		if err != nil {
+			app.errorJson(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListHeartbeats shows the last heartbeat of every service
+func (app *Config) ListHeartbeats(w http.ResponseWriter, r *http.Request) {
+	beats, err := app.Models.Heartbeat.All()
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: "heartbeats",
+		Data:    beats,
+	})
+}
+
+// monitorHeartbeats alerts once when a service misses the configured number of
+// heartbeats in a row, and again when it comes back. One replica at a time
+// monitors, see lease.
+func (app *Config) monitorHeartbeats() {
+	const interval = 10 * time.Second
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lease := app.newLease("heartbeats", interval+30*time.Second)
+	down := &downServices{rdb: app.Redis, local: make(map[string]bool)}
+
+	for range ticker.C {
+		if !lease.hold() {
+			continue
+		}
+
+		beats, err := app.Models.Heartbeat.All()
+		if err != nil {
+			log.Println("Error reading heartbeats:", err)
+			continue
+		}
+
+		now := time.Now()
+		misses := app.Alerting.get().HeartbeatMisses
+
+		for _, beat := range beats {
+			missed := beat.Missed(now)
+
+			switch {
+			case missed >= misses && !down.is(beat.Service):
+				down.set(beat.Service, true)
+				app.Alerts.Fire(context.Background(), alert.Alert{
+					Name:     "heartbeat_missed." + beat.Service,
+					Severity: alert.Critical,
+					Summary:  fmt.Sprintf("%s missed %d heartbeats, last seen %s", beat.Service, missed, beat.LastSeen.Format(time.RFC3339)),
+					Labels:   map[string]string{"service": beat.Service},
+				})
+			case missed < misses && down.is(beat.Service):
+				down.set(beat.Service, false)
+				app.Alerts.Fire(context.Background(), alert.Alert{
+					Name:     "heartbeat_recovered." + beat.Service,
+					Severity: alert.Info,
+					Summary:  fmt.Sprintf("%s is sending heartbeats again", beat.Service),
+					Labels:   map[string]string{"service": beat.Service},
+				})
+			}
+		}
+	}
+}
+
+// downServices remembers the services alerted as down. With Redis the replica
+// taking the monitor over neither alerts again nor misses a recovery.
+type downServices struct {
+	rdb   *redis.Client
+	local map[string]bool
+}
+
+const downKey = "heartbeat:down"
+
+func (d *downServices) is(service string) bool {
+	if d.rdb != nil {
+		down, err := d.rdb.SIsMember(context.Background(), downKey, service).Result()
+		if err == nil {
+			return down
+		}
+		log.Println("Error reading down services:", err)
+	}
+	return d.local[service]
+}
+
+func (d *downServices) set(service string, down bool) {
+	var err error
+
+	if down {
+		d.local[service] = true
+		if d.rdb != nil {
+			err = d.rdb.SAdd(context.Background(), downKey, service).Err()
+		}
+	} else {
+		delete(d.local, service)
+		if d.rdb != nil {
+			err = d.rdb.SRem(context.Background(), downKey, service).Err()
+		}
+	}
+
+	if err != nil {
+		log.Println("Error storing down services:", err)
+	}
+}
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// The ingest endpoints decode their payloads with the scanner below instead of
+// encoding/json: no reflection, the body is read into a pooled buffer and the
+// only allocations left are the strings kept in the entry.
+
+// maxPooledBuffer keeps unusually large bodies from staying in the pool
+const maxPooledBuffer = 64 << 10
+
+var bodyPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// readBody reads the request body into a pooled buffer within the body limit.
+// The buffer goes back to the pool with releaseBody.
+func (app *Config) readBody(w http.ResponseWriter, r *http.Request) (*bytes.Buffer, error) {
+	maxBytes := app.MaxBodyBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxBodyBytes
+	}
+
+	buf := bodyPool.Get().(*bytes.Buffer)
+	buf.Reset()
+
+	_, err := buf.ReadFrom(http.MaxBytesReader(w, r.Body, maxBytes))
+	if err != nil {
+		releaseBody(buf)
+
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return nil, fmt.Errorf("Body must not be larger than %d bytes", maxErr.Limit)
+		}
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+func releaseBody(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBuffer {
+		bodyPool.Put(buf)
+	}
+}
+
+// readLogPayload decodes a JSON log entry like readJson would
+func (app *Config) readLogPayload(w http.ResponseWriter, r *http.Request, p *JSONPayload) error {
+	buf, err := app.readBody(w, r)
+	if err != nil {
+		return err
+	}
+	defer releaseBody(buf)
+
+	s := scanner{b: buf.Bytes()}
+
+	if err := s.logPayload(p); err != nil {
+		return err
+	}
+	return s.end()
+}
+
+// readLogBatch decodes a JSON batch {"entries": [...]}
+func (app *Config) readLogBatch(w http.ResponseWriter, r *http.Request, batch *BatchPayload) error {
+	buf, err := app.readBody(w, r)
+	if err != nil {
+		return err
+	}
+	defer releaseBody(buf)
+
+	s := scanner{b: buf.Bytes()}
+
+	err = s.object(func(key []byte) error {
+		if string(key) != "entries" {
+			return fmt.Errorf("Body contains unknown field %q", key)
+		}
+
+		if s.null() {
+			return nil
+		}
+		if err := s.expect('['); err != nil {
+			return err
+		}
+		if s.skipSpace(); s.peek() == ']' {
+			s.i++
+			return nil
+		}
+
+		for {
+			var p JSONPayload
+			if err := s.logPayload(&p); err != nil {
+				return err
+			}
+			batch.Entries = append(batch.Entries, p)
+
+			if len(batch.Entries) > maxBatchEntries {
+				return fmt.Errorf("a batch holds at most %d entries", maxBatchEntries)
+			}
+
+			s.skipSpace()
+			switch s.peek() {
+			case ',':
+				s.i++
+			case ']':
+				s.i++
+				return nil
+			default:
+				return s.syntaxError()
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.end()
+}
+
+// scanner is a minimal JSON reader for the objects of string fields sent to
+// the ingest endpoints
+type scanner struct {
+	b   []byte
+	i   int
+	tmp []byte
+}
+
+func (s *scanner) logPayload(p *JSONPayload) error {
+	return s.object(func(key []byte) error {
+		var field *string
+
+		switch string(key) {
+		case "name":
+			field = &p.Name
+		case "data":
+			field = &p.Data
+		case "trace_id":
+			field = &p.TraceID
+		case "span_id":
+			field = &p.SpanID
+		case "level":
+			field = &p.Level
+		case "stack":
+			field = &p.Stack
+		case "user_id":
+			field = &p.UserID
+		case "version":
+			field = &p.Version
+		case "service":
+			field = &p.Service
+		case "fields":
+			return s.stringMap(&p.Fields)
+		default:
+			return fmt.Errorf("Body contains unknown field %q", key)
+		}
+
+		return s.stringField(key, field)
+	})
+}
+
+// stringField reads the string or null value of the field key into field
+func (s *scanner) stringField(key []byte, field *string) error {
+	if s.null() {
+		return nil
+	}
+
+	if s.skipSpace(); s.peek() != '"' {
+		return fmt.Errorf("Body contains a non-string value for field %q, expected string", key)
+	}
+
+	raw, err := s.str()
+	if err != nil {
+		return err
+	}
+	*field = string(raw)
+
+	return nil
+}
+
+// stringMap reads an object of strings, or null, into m
+func (s *scanner) stringMap(m *map[string]string) error {
+	if s.null() {
+		return nil
+	}
+
+	*m = make(map[string]string)
+
+	return s.object(func(key []byte) error {
+		var value string
+		if err := s.stringField(key, &value); err != nil {
+			return err
+		}
+		(*m)[string(key)] = value
+		return nil
+	})
+}
+
+// object reads {"key": value, ...} and calls field for each key, positioned
+// at its value
+func (s *scanner) object(field func(key []byte) error) error {
+	if err := s.expect('{'); err != nil {
+		return err
+	}
+	if s.skipSpace(); s.peek() == '}' {
+		s.i++
+		return nil
+	}
+
+	for {
+		if s.skipSpace(); s.peek() != '"' {
+			return s.syntaxError()
+		}
+
+		key, err := s.str()
+		if err != nil {
+			return err
+		}
+		// the key may live in s.tmp, which the value can overwrite
+		key = append([]byte(nil), key...)
+
+		if err := s.expect(':'); err != nil {
+			return err
+		}
+
+		if err := field(key); err != nil {
+			return err
+		}
+
+		s.skipSpace()
+		switch s.peek() {
+		case ',':
+			s.i++
+		case '}':
+			s.i++
+			return nil
+		default:
+			return s.syntaxError()
+		}
+	}
+}
+
+// str reads a string at s.i. The result is a view of the body when there is
+// nothing to unescape and of s.tmp otherwise, copy it to keep it.
+func (s *scanner) str() ([]byte, error) {
+	s.i++ // opening quote
+	start := s.i
+
+	for s.i < len(s.b) {
+		c := s.b[s.i]
+		switch {
+		case c == '"':
+			s.i++
+			return s.b[start : s.i-1], nil
+		case c == '\\':
+			return s.escapedStr(start)
+		case c < 0x20:
+			return nil, s.syntaxError()
+		case c >= utf8.RuneSelf:
+			// invalid UTF-8 is replaced like encoding/json does
+			r, size := utf8.DecodeRune(s.b[s.i:])
+			if r == utf8.RuneError && size == 1 {
+				return s.escapedStr(start)
+			}
+			s.i += size
+			continue
+		}
+		s.i++
+	}
+
+	return nil, errors.New("Body contains badly-formed JSON")
+}
+
+func (s *scanner) escapedStr(start int) ([]byte, error) {
+	out := append(s.tmp[:0], s.b[start:s.i]...)
+
+	for s.i < len(s.b) {
+		c := s.b[s.i]
+
+		switch {
+		case c == '"':
+			s.i++
+			s.tmp = out
+			return out, nil
+		case c < 0x20:
+			return nil, s.syntaxError()
+		case c >= utf8.RuneSelf:
+			r, size := utf8.DecodeRune(s.b[s.i:])
+			if r == utf8.RuneError && size == 1 {
+				out = utf8.AppendRune(out, utf8.RuneError)
+			} else {
+				out = append(out, s.b[s.i:s.i+size]...)
+			}
+			s.i += size
+			continue
+		case c != '\\':
+			out = append(out, c)
+			s.i++
+			continue
+		}
+
+		if s.i+1 >= len(s.b) {
+			return nil, errors.New("Body contains badly-formed JSON")
+		}
+		s.i += 2
+
+		switch s.b[s.i-1] {
+		case '"', '\\', '/':
+			out = append(out, s.b[s.i-1])
+		case 'b':
+			out = append(out, '\b')
+		case 'f':
+			out = append(out, '\f')
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case 'u':
+			r, ok := s.hex4()
+			if !ok {
+				return nil, s.syntaxError()
+			}
+			if utf16.IsSurrogate(r) {
+				// the next escape is only taken when it completes the pair,
+				// a lone half is replaced like encoding/json does
+				r = s.lowSurrogate(r)
+			}
+			out = utf8.AppendRune(out, r)
+		default:
+			return nil, s.syntaxError()
+		}
+	}
+
+	return nil, errors.New("Body contains badly-formed JSON")
+}
+
+// lowSurrogate decodes the pair of the high surrogate r with the \u escape at
+// s.i, or returns utf8.RuneError and leaves the escape when there is no pair
+func (s *scanner) lowSurrogate(r rune) rune {
+	if s.i+1 >= len(s.b) || s.b[s.i] != '\\' || s.b[s.i+1] != 'u' {
+		return utf8.RuneError
+	}
+
+	i := s.i
+	s.i += 2
+	low, ok := s.hex4()
+	if ok {
+		if pair := utf16.DecodeRune(r, low); pair != utf8.RuneError {
+			return pair
+		}
+	}
+
+	s.i = i
+	return utf8.RuneError
+}
+
+func (s *scanner) hex4() (rune, bool) {
+	if s.i+4 > len(s.b) {
+		return 0, false
+	}
+
+	var r rune
+	for _, c := range s.b[s.i : s.i+4] {
+		r <<= 4
+		switch {
+		case c >= '0' && c <= '9':
+			r |= rune(c - '0')
+		case c >= 'a' && c <= 'f':
+			r |= rune(c - 'a' + 10)
+		case c >= 'A' && c <= 'F':
+			r |= rune(c - 'A' + 10)
+		default:
+			return 0, false
+		}
+	}
+	s.i += 4
+
+	return r, true
+}
+
+// null consumes a null value
+func (s *scanner) null() bool {
+	s.skipSpace()
+	if bytes.HasPrefix(s.b[s.i:], []byte("null")) {
+		s.i += 4
+		return true
+	}
+	return false
+}
+
+func (s *scanner) skipSpace() {
+	for s.i < len(s.b) {
+		switch s.b[s.i] {
+		case ' ', '\t', '\n', '\r':
+			s.i++
+		default:
+			return
+		}
+	}
+}
+
+func (s *scanner) peek() byte {
+	if s.i < len(s.b) {
+		return s.b[s.i]
+	}
+	return 0
+}
+
+func (s *scanner) expect(c byte) error {
+	s.skipSpace()
+	if s.i == len(s.b) {
+		if s.i == 0 {
+			return errors.New("Body must not be empty")
+		}
+		return errors.New("Body contains badly-formed JSON")
+	}
+	if s.b[s.i] != c {
+		return s.syntaxError()
+	}
+	s.i++
+	return nil
+}
+
+// end checks that nothing but white space follows the value
+func (s *scanner) end() error {
+	s.skipSpace()
+	if s.i != len(s.b) {
+		return errors.New("Body must have only a single JSON value")
+	}
+	return nil
+}
+
+func (s *scanner) syntaxError() error {
+	return fmt.Errorf("Body contains badly-formed JSON at character %d", s.i+1)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const sampleEntry = `{"name":"authentication","data":"Logged in user ada@example.com","level":"info","service":"api","version":"1.4.2",` +
+	`"user_id":"42","trace_id":"4bf92f3577b34da6a3ce929d0e0e4736","fields":{"method":"POST","path":"/authenticate","status":"202"}}`
+
+// TestReadLogPayloadMatchesJSON checks the scanner decodes like encoding/json
+func TestReadLogPayloadMatchesJSON(t *testing.T) {
+	app := Config{}
+
+	for _, body := range []string{
+		sampleEntry,
+		`{"name":"x","data":"quote \" backslash \\ tab \t unicode é 😀"}`,
+		`{"name":"x","data":"","fields":null,"stack":null}`,
+		` { "name" : "spaced" , "data" : "y" } `,
+	} {
+		var want JSONPayload
+		if err := json.Unmarshal([]byte(body), &want); err != nil {
+			t.Fatalf("encoding/json on %s: %v", body, err)
+		}
+
+		var got JSONPayload
+		r := httptest.NewRequest("POST", "/log", strings.NewReader(body))
+		if err := app.readLogPayload(httptest.NewRecorder(), r, &got); err != nil {
+			t.Fatalf("readLogPayload(%s): %v", body, err)
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("readLogPayload(%s)\n got %+v\nwant %+v", body, got, want)
+		}
+	}
+}
+
+func TestReadLogPayloadErrors(t *testing.T) {
+	app := Config{MaxBodyBytes: 128}
+
+	for _, body := range []string{
+		``,
+		`{"name":"x"`,
+		`{"name":1}`,
+		`{"name":"x","unknown":"y"}`,
+		`{"name":"x"}{}`,
+		`{"name":"` + strings.Repeat("a", 128) + `"}`,
+	} {
+		var p JSONPayload
+		r := httptest.NewRequest("POST", "/log", strings.NewReader(body))
+		if err := app.readLogPayload(httptest.NewRecorder(), r, &p); err == nil {
+			t.Errorf("readLogPayload(%q) accepted it", body)
+		}
+	}
+}
+
+func BenchmarkReadLogPayload(b *testing.B) {
+	app := Config{}
+	body := []byte(sampleEntry)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var p JSONPayload
+		r := httptest.NewRequest("POST", "/log", bytes.NewReader(body))
+		if err := app.readLogPayload(httptest.NewRecorder(), r, &p); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadLogBatch(b *testing.B) {
+	app := Config{}
+	body := []byte(`{"entries":[` + strings.TrimSuffix(strings.Repeat(sampleEntry+",", 100), ",") + `]}`)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var batch BatchPayload
+		r := httptest.NewRequest("POST", "/log/batch", bytes.NewReader(body))
+		if err := app.readLogBatch(httptest.NewRecorder(), r, &batch); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// FuzzReadLogPayload checks the scanner against encoding/json on arbitrary
+// bodies: it must not panic, and what it accepts encoding/json must decode to
+// the same entry
+func FuzzReadLogPayload(f *testing.F) {
+	app := Config{}
+
+	f.Add(sampleEntry)
+	f.Add(`{"name":"x","data":"é😀 \n"}`)
+	f.Add(`{"name":"x","data":"\ud800"}`)
+	f.Add(`{"name":"x","data":"\ud800\u0041"}`)
+	f.Add(`{"fields":{"a":"b","c":null}}`)
+	f.Add(`{"name":null}`)
+	f.Add(`{"name":"x",}`)
+	f.Add(`{}`)
+
+	f.Fuzz(func(t *testing.T, body string) {
+		var got JSONPayload
+		r := httptest.NewRequest("POST", "/log", strings.NewReader(body))
+		if err := app.readLogPayload(httptest.NewRecorder(), r, &got); err != nil {
+			return
+		}
+
+		var want JSONPayload
+		dec := json.NewDecoder(strings.NewReader(body))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&want); err != nil {
+			t.Fatalf("scanner accepted %q, encoding/json did not: %v", body, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%q\nscanner       %+v\nencoding/json %+v", body, got, want)
+		}
+	})
+}
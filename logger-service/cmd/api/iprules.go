@@ -0,0 +1,198 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"logger/data"
+	"logger/ipfilter"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// errAddressNotAllowed is returned to producers calling from outside the
+// ranges of their token or of the producer
+var errAddressNotAllowed = errors.New("client address not allowed for this token")
+
+type IPRulesPayload struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+// maxCachedFilters bounds the compiled filters kept, the cache starts over
+// when it is reached
+const maxCachedFilters = 1000
+
+// compiled filters keyed by their lists, which change rarely
+var filterCache = struct {
+	sync.Mutex
+	items map[string]*ipfilter.Filter
+}{items: make(map[string]*ipfilter.Filter)}
+
+// compileFilter returns the filter of two lists, nil when both are empty.
+// The lists were validated when they were stored.
+func compileFilter(allow, deny []string) *ipfilter.Filter {
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil
+	}
+
+	key := strings.Join(allow, ",") + "|" + strings.Join(deny, ",")
+
+	filterCache.Lock()
+	defer filterCache.Unlock()
+
+	if f, ok := filterCache.items[key]; ok {
+		return f
+	}
+
+	f, err := ipfilter.New(allow, deny)
+	if err != nil {
+		log.Println("Error compiling stored address rules:", err)
+		// rules that cannot be read must not open the door
+		f, _ = ipfilter.New(nil, []string{"0.0.0.0/0", "::/0"})
+	}
+
+	if len(filterCache.items) >= maxCachedFilters {
+		filterCache.items = make(map[string]*ipfilter.Filter)
+	}
+	filterCache.items[key] = f
+
+	return f
+}
+
+// clientAddr is the address the request came from
+func clientAddr(r *http.Request) netip.Addr {
+	return parseRemoteAddr(r.RemoteAddr)
+}
+
+// parseRemoteAddr returns the address of a host:port, as in RemoteAddr
+func parseRemoteAddr(remote string) netip.Addr {
+	host, _, err := net.SplitHostPort(remote)
+	if err != nil {
+		host = remote
+	}
+
+	addr, _ := netip.ParseAddr(host)
+	return addr
+}
+
+// checkClientAddr applies the address lists of the token, then those of its producer
+func (app *Config) checkClientAddr(r *http.Request, token *data.IngestToken) error {
+	return app.checkAddr(clientAddr(r), token)
+}
+
+// checkAddr applies the address lists of the token and its producer to addr
+func (app *Config) checkAddr(addr netip.Addr, token *data.IngestToken) error {
+	if !compileFilter(token.AllowCIDRs, token.DenyCIDRs).Allowed(addr) {
+		return errAddressNotAllowed
+	}
+
+	rules, err := app.Models.IPRules.ForProducer(token.Producer)
+	if err != nil {
+		return err
+	}
+	if rules != nil && !compileFilter(rules.AllowCIDRs, rules.DenyCIDRs).Allowed(addr) {
+		return errAddressNotAllowed
+	}
+
+	return nil
+}
+
+// validIPRules checks the lists of an admin request before they are stored
+func validIPRules(payload IPRulesPayload) error {
+	_, err := ipfilter.New(payload.Allow, payload.Deny)
+	return err
+}
+
+// SetTokenIPRules replaces the address lists of an ingest token
+func (app *Config) SetTokenIPRules(w http.ResponseWriter, r *http.Request) {
+	var requestPayload IPRulesPayload
+
+	err := app.readJson(w, r, &requestPayload)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	if err := validIPRules(requestPayload); err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	token, err := app.Models.IngestToken.SetIPRules(chi.URLParam(r, "id"), requestPayload.Allow, requestPayload.Deny)
+	if errors.Is(err, data.ErrInvalidToken) {
+		app.errorJson(w, errors.New("token not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: "token address rules updated",
+		Data:    token,
+	})
+}
+
+// ListProducerIPRules returns the address lists of every producer that has some
+func (app *Config) ListProducerIPRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := app.Models.IPRules.All()
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: "producer address rules",
+		Data:    rules,
+	})
+}
+
+// SetProducerIPRules replaces the address lists of a producer
+func (app *Config) SetProducerIPRules(w http.ResponseWriter, r *http.Request) {
+	var requestPayload IPRulesPayload
+
+	err := app.readJson(w, r, &requestPayload)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	if err := validIPRules(requestPayload); err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	rules, err := app.Models.IPRules.Set(chi.URLParam(r, "producer"), requestPayload.Allow, requestPayload.Deny)
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: "producer address rules updated",
+		Data:    rules,
+	})
+}
+
+// DeleteProducerIPRules lifts the address restriction of a producer
+func (app *Config) DeleteProducerIPRules(w http.ResponseWriter, r *http.Request) {
+	err := app.Models.IPRules.Delete(chi.URLParam(r, "producer"))
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJson(w, http.StatusAccepted, jsonReponse{
+		Error:   false,
+		Message: "producer address rules removed",
+	})
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"logger/data"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// recordIssue counts an error entry on its issue. The entry is already stored,
+// so a failure here is only logged.
+func (app *Config) recordIssue(entry data.LogEntry, stack string) {
+	issue, err := app.Models.Issue.Record(entry, stack)
+	if err != nil {
+		log.Println("Error recording issue:", err)
+		return
+	}
+
+	switch {
+	case issue.Count == 1:
+		app.publishEvent("issues", "issue.created", issue)
+	case issue.Regressed:
+		app.publishEvent("issues", "issue.regressed", issue)
+	}
+}
+
+func issueLimit(r *http.Request, fallback int64) (int64, error) {
+	v := r.URL.Query().Get("limit")
+	if v == "" {
+		return fallback, nil
+	}
+
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n <= 0 || n > 100 {
+		return 0, errors.New("limit must be between 1 and 100")
+	}
+
+	return n, nil
+}
+
+// ListIssues lists issues by last occurrence, ?status=open|resolved and
+// ?service= narrow the list
+func (app *Config) ListIssues(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status != "" && status != data.IssueOpen && status != data.IssueResolved {
+		app.errorJson(w, errors.New("status must be open or resolved"))
+		return
+	}
+
+	limit, err := issueLimit(r, 50)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	issues, err := app.Models.Issue.List(status, r.URL.Query().Get("service"), limit)
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: "issues",
+		Data:    issues,
+	})
+}
+
+// GetIssue returns an issue with its latest entries
+func (app *Config) GetIssue(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	issue, err := app.Models.Issue.Get(id)
+	if errors.Is(err, data.ErrIssueNotFound) {
+		app.errorJson(w, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	limit, err := issueLimit(r, 20)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	events, err := app.Models.Issue.Events(id, limit)
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: "issue",
+		Data: map[string]any{
+			"issue":   issue,
+			"entries": events,
+		},
+	})
+}
+
+type IssueStatusPayload struct {
+	Status string `json:"status"`
+}
+
+// UpdateIssue resolves or reopens an issue
+func (app *Config) UpdateIssue(w http.ResponseWriter, r *http.Request) {
+	var requestPayload IssueStatusPayload
+
+	err := app.readJson(w, r, &requestPayload)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	if requestPayload.Status != data.IssueOpen && requestPayload.Status != data.IssueResolved {
+		app.errorJson(w, errors.New("status must be open or resolved"))
+		return
+	}
+
+	issue, err := app.Models.Issue.SetStatus(chi.URLParam(r, "id"), requestPayload.Status)
+	if errors.Is(err, data.ErrIssueNotFound) {
+		app.errorJson(w, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.publishEvent("issues", "issue."+issue.Status, issue)
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: "issue " + issue.Status,
+		Data:    issue,
+	})
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"logger/data"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// GetJob returns the status and progress of a job
+func (app *Config) GetJob(w http.ResponseWriter, r *http.Request) {
+	job, err := app.Models.Job.Get(chi.URLParam(r, "id"))
+	if err != nil {
+		if errors.Is(err, data.ErrJobNotFound) {
+			app.errorJson(w, err, http.StatusNotFound)
+			return
+		}
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: job.Status,
+		Data:    job,
+	})
+}
+
+// failInterruptedJobs fails the jobs of replicas that stopped, at start and
+// then at every interval. Every replica runs it, a job only fails once.
+func (app *Config) failInterruptedJobs(interval time.Duration) {
+	for {
+		if err := app.Models.Job.FailInterrupted(); err != nil {
+			log.Println("Error failing interrupted jobs:", err)
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"contracts/keystore"
+	"contracts/signing"
+	"fmt"
+	"log"
+	"logger/data"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+// revokedKeys is the Redis set, and channel, every service reads emergency
+// key revocations from
+const revokedKeys = "keystore:revoked"
+
+// openKeystore reads KEYSTORE_FILE and adds the secrets still configured
+// through the environment. The file is reloaded every KEYSTORE_RELOAD.
+func openKeystore() (*keystore.Store, error) {
+	keys, err := keystore.Open(os.Getenv("KEYSTORE_FILE"))
+	if err != nil {
+		return nil, err
+	}
+
+	// EVENT_SIGNING_KEYS is shared by every service publishing events, e.g. "new|old"
+	keys.AddSecrets(keystore.PurposeEvents, signing.ParseSecrets(os.Getenv("EVENT_SIGNING_KEYS")))
+	keys.AddSecrets(keystore.PurposeWebhooks, signing.ParseSecrets(os.Getenv("WEBHOOK_SIGNING_SECRET")))
+	keys.AddSecrets(keystore.PurposeAudit, signing.ParseSecrets(os.Getenv("AUDIT_SIGNING_KEY")))
+	keys.AddSecrets(keystore.PurposeShares, signing.ParseSecrets(os.Getenv("SHARE_LINK_SECRET")))
+
+	if os.Getenv("KEYSTORE_FILE") != "" {
+		interval, err := time.ParseDuration(os.Getenv("KEYSTORE_RELOAD"))
+		if err != nil || interval < time.Second {
+			interval = time.Minute
+		}
+		go keys.Watch(interval)
+	}
+
+	return keys, nil
+}
+
+// watchRevocations applies the revocations made on any service to keys
+func watchRevocations(rdb *redis.Client, keys *keystore.Store) {
+	if rdb == nil {
+		return
+	}
+
+	for {
+		ctx := context.Background()
+
+		// subscribe before reading the set so no revocation falls in between
+		sub := rdb.Subscribe(ctx, revokedKeys)
+
+		ids, err := rdb.SMembers(ctx, revokedKeys).Result()
+		if err != nil {
+			log.Println("Error reading revoked keys:", err)
+		}
+		for _, id := range ids {
+			keys.Revoke(id)
+		}
+
+		for msg := range sub.Channel() {
+			log.Printf("Key %s revoked", msg.Payload)
+			keys.Revoke(msg.Payload)
+		}
+
+		sub.Close()
+		time.Sleep(time.Second)
+	}
+}
+
+// ListKeys describes the keys of the keystore, without their secrets
+func (app *Config) ListKeys(w http.ResponseWriter, r *http.Request) {
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: "keys",
+		Data:    app.Keys.Keys(),
+	})
+}
+
+// RevokeKey stops a key from signing and verifying on every service at once,
+// for keys that leaked. List the id under "revoked" in the keystore file too,
+// so the revocation outlives Redis.
+func (app *Config) RevokeKey(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	app.Keys.Revoke(id)
+
+	if app.Redis != nil {
+		err := app.Redis.SAdd(r.Context(), revokedKeys, id).Err()
+		if err == nil {
+			err = app.Redis.Publish(r.Context(), revokedKeys, id).Err()
+		}
+		if err != nil {
+			app.errorJson(w, fmt.Errorf("key revoked on this replica only: %w", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	err := app.Models.LogEntry.Insert(data.LogEntry{Name: "key.revoked", Data: id, Producer: "logger"})
+	if err != nil {
+		log.Printf("Error logging the revocation of key %s: %v", id, err)
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: fmt.Sprintf("key %s revoked", id),
+	})
+}
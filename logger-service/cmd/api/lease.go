@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// replicaID names this process in the leases and locks it holds
+var replicaID = newReplicaID()
+
+func newReplicaID() string {
+	name := os.Getenv("POD_NAME")
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+
+	b := make([]byte, 4)
+	rand.Read(b)
+
+	return name + "-" + hex.EncodeToString(b)
+}
+
+// renewLease extends the lease when this replica holds it and takes it when
+// nobody does. It answers 1 when the replica holds the lease.
+var renewLease = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return 1
+end
+return 0
+`)
+
+// releaseLock deletes a lock only if this replica still holds it
+var releaseLock = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// lease lets one replica at a time run a background loop, like the scheduled
+// backups or the heartbeat monitor. The holder renews it at every round; when
+// it stops, another replica takes over once ttl has passed.
+type lease struct {
+	rdb  *redis.Client
+	name string
+	ttl  time.Duration
+	held bool
+}
+
+func (app *Config) newLease(name string, ttl time.Duration) *lease {
+	return &lease{rdb: app.Redis, name: name, ttl: ttl}
+}
+
+// hold tells if this replica runs the loop this round. Without Redis every
+// replica does; while Redis can not be reached the last holder carries on.
+func (l *lease) hold() bool {
+	if l.rdb == nil {
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	held, err := renewLease.Run(ctx, l.rdb, []string{"lease:logger:" + l.name}, replicaID, l.ttl.Milliseconds()).Bool()
+	if err != nil {
+		log.Printf("Error renewing the %s lease: %v", l.name, err)
+		return l.held
+	}
+
+	if held != l.held {
+		if held {
+			log.Printf("Running %s on this replica", l.name)
+		} else {
+			log.Printf("Leaving %s to another replica", l.name)
+		}
+		l.held = held
+	}
+
+	return held
+}
+
+// chainLockTTL bounds how long a replica that died holds the chain
+const chainLockTTL = 30 * time.Second
+
+// lockChain takes the Redis lock of the log chain, waiting for the replica
+// that holds it until ctx is done. When Redis can not be reached the entries
+// are written without the lock, the unique sequence index of the chain turns
+// away the replica that loses a race.
+func (app *Config) lockChain(ctx context.Context) (func(), error) {
+	key := "lock:logger:chain"
+
+	for {
+		ok, err := app.Redis.SetNX(ctx, key, replicaID, chainLockTTL).Result()
+		if err != nil && ctx.Err() == nil {
+			log.Println("Error locking the log chain, writing without the lock:", err)
+			return func() {}, nil
+		}
+		if ok {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, errors.New("the log chain is held by another replica")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		if err := releaseLock.Run(ctx, app.Redis, []string{key}, replicaID).Err(); err != nil {
+			log.Println("Error releasing the log chain lock:", err)
+		}
+	}, nil
+}
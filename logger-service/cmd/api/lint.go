@@ -0,0 +1,64 @@
+package main
+
+import (
+	"contracts/configlint"
+	"contracts/keystore"
+	"encoding/json"
+	"logger/alert"
+	"os"
+	"strings"
+)
+
+// lintConfig looks for insecure settings of the logger service, see configlint
+func lintConfig(keys *keystore.Store) *configlint.Lint {
+	var lint configlint.Lint
+
+	lint.MongoURL("MONGO_URL", mongoURL())
+	lint.Password("MONGO_PASSWORD", mongoCredential().Password)
+
+	lint.Secret("ADMIN_API_KEY", os.Getenv("ADMIN_API_KEY"))
+	lint.LogLevel("LOG_LEVEL", os.Getenv("LOG_LEVEL"))
+
+	for _, item := range strings.Split(os.Getenv("INGEST_TOKENS"), ",") {
+		if producer, token, ok := strings.Cut(strings.TrimSpace(item), ":"); ok {
+			lint.Secret("INGEST_TOKENS "+producer, token)
+		}
+	}
+
+	if v := os.Getenv("EVENT_SIGNING_KEYS"); v != "" {
+		lint.Secret("EVENT_SIGNING_KEYS", v)
+	} else if !keys.Has(keystore.PurposeEvents) {
+		lint.Add("EVENT_SIGNING_KEYS", "no event keys, published events are not signed")
+	}
+	if v := os.Getenv("AUDIT_SIGNING_KEY"); v != "" {
+		lint.Secret("AUDIT_SIGNING_KEY", v)
+	} else if !keys.Has(keystore.PurposeAudit) {
+		lint.Add("AUDIT_SIGNING_KEY", "no audit keys, log checkpoints are not signed")
+	}
+	if v := os.Getenv("SHARE_LINK_SECRET"); v != "" {
+		lint.Secret("SHARE_LINK_SECRET", v)
+	}
+	if v := os.Getenv("WEBHOOK_SIGNING_SECRET"); v != "" {
+		lint.Secret("WEBHOOK_SIGNING_SECRET", v)
+	}
+
+	if os.Getenv("BACKUP_S3_BUCKET") != "" {
+		lint.HTTPS("BACKUP_S3_ENDPOINT", os.Getenv("BACKUP_S3_ENDPOINT"))
+		lint.Secret("BACKUP_S3_SECRET_KEY", os.Getenv("BACKUP_S3_SECRET_KEY"))
+	}
+
+	lint.HTTPS("ALERT_SLACK_WEBHOOK", os.Getenv("ALERT_SLACK_WEBHOOK"))
+	lint.HTTPS("ALERT_TEAMS_WEBHOOK", os.Getenv("ALERT_TEAMS_WEBHOOK"))
+
+	var webhooks []alert.WebhookConfig
+	if json.Unmarshal([]byte(os.Getenv("ALERT_WEBHOOKS")), &webhooks) == nil {
+		for _, c := range webhooks {
+			lint.HTTPS("ALERT_WEBHOOKS "+c.Name, c.URL)
+			if c.Secret != "" {
+				lint.Secret("ALERT_WEBHOOKS "+c.Name+" secret", c.Secret)
+			}
+		}
+	}
+
+	return &lint
+}
@@ -2,32 +2,101 @@ package main
 
 import (
 	"context"
+	"contracts/config"
+	"contracts/keystore"
+	"contracts/lifecycle"
+	"contracts/loglevel"
+	"errors"
 	"fmt"
 	"log"
+	"logger/alert"
 	"logger/data"
+	"net"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 
+	"github.com/redis/go-redis/v9"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/grpc"
 )
 
-const (
-	webPort  = "83"
-	rpcPort  = "5001"
-	mongoURL = "mongodb://mongo:27017"
-	gRpcPort = "50001"
-)
+// defaultMongoURL is the mongo container of docker-compose
+const defaultMongoURL = "mongodb://mongo:27017"
 
 var client *mongo.Client
 
 type Config struct {
-	Models data.Models
+	Models   data.Models
+	AdminKey string
+	Backups  data.BackupStore
+	Alerts   *alert.Dispatcher
+
+	// Alerting holds the SLOs and heartbeat thresholds, see settings
+	Alerting *alertSettings
+
+	Redis *redis.Client
+
+	// Keys holds the event, alert webhook and audit checkpoint keys
+	Keys *keystore.Store
+
+	Traces TraceLinks
+
+	Lifecycle *lifecycle.Lifecycle
+
+	// MaxBodyBytes limits the JSON request bodies read by readJson
+	MaxBodyBytes int64
+
+	// RequestTimeout bounds the routes that set no timeout of their own
+	RequestTimeout time.Duration
+
+	// ShareBaseURL is where the holders of share links reach the service
+	ShareBaseURL string
+
+	// RPCPort and GRPCPort are where producers that skip HTTP send entries
+	RPCPort  string
+	GRPCPort string
+
+	// Queries bounds the searches of share link holders, see guardQuery
+	Queries *queryGuard
 }
 
 func main() {
+	// every setting is an environment variable or a flag named after it,
+	// -mongo-url for MONGO_URL
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Panic(err)
+	}
+
+	loglevel.Setup(cfg.String("LOG_LEVEL", ""))
+
+	// PORT is where the API listens, 83 by default, RPC_PORT and GRPC_PORT
+	// the net/rpc and gRPC servers, 5001 and 50001
+	webPort := cfg.Port("PORT", "83")
+	rpcPort := cfg.Port("RPC_PORT", "5001")
+	gRpcPort := cfg.Port("GRPC_PORT", "50001")
+
+	// MONGO_URL is the store of the entries, MONGO_USERNAME and
+	// MONGO_PASSWORD its credentials, without them the store is used without
+	// authentication
+	mongoURI := cfg.URL("MONGO_URL", defaultMongoURL, "mongodb", "mongodb+srv")
+	if err := cfg.Err(); err != nil {
+		log.Panicf("Invalid configuration:\n%v", err)
+	}
+
+	keys, err := openKeystore()
+	if err != nil {
+		log.Panic(err)
+	}
+
+	// insecure settings stop the service in production
+	lintConfig(keys).Enforce("logger")
+
 	//connect to mongo db
-	mongoClient, err := connectToMongo()
+	mongoClient, err := connectToMongo(mongoURI, mongoCredential())
 
 	if err != nil {
 		log.Panic(err)
@@ -35,21 +104,228 @@ func main() {
 
 	client = mongoClient
 
-	// create a context in order to disconnect
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
+	app := Config{
+		Models:   data.New(client),
+		AdminKey: cfg.String("ADMIN_API_KEY", ""),
+		Backups:  backupStore(cfg),
+		Traces: TraceLinks{
+			QueryURL: cfg.URL("TRACE_QUERY_URL", "", "http", "https"),
+			UIURL:    cfg.URL("TRACE_UI_URL", "", "http", "https"),
+			LogsURL:  cfg.URL("TRACE_LOGS_URL", "", "http", "https"),
+		},
+		RPCPort:  rpcPort,
+		GRPCPort: gRpcPort,
+	}
+
+	// share links are signed with SHARE_LINK_SECRET and handed out under
+	// SHARE_BASE_URL, e.g. https://logs.example.com
+	app.ShareBaseURL = strings.TrimRight(cfg.URL("SHARE_BASE_URL", "", "http", "https"), "/")
+
+	// MAX_BODY_BYTES overrides the one mega byte limit of JSON request bodies
+	app.MaxBodyBytes = cfg.Int64("MAX_BODY_BYTES", 0)
+
+	// REQUEST_TIMEOUT overrides the ten seconds routes get unless they set
+	// a timeout of their own
+	app.RequestTimeout = cfg.Duration("REQUEST_TIMEOUT", 10*time.Second, time.Millisecond)
+
+	if err := data.EnsureIndexes(); err != nil {
+		log.Println("Error creating indexes:", err)
+	}
+
+	app.Keys = keys
+
+	// job progress and new entries are streamed to clients by the broker through
+	// Redis, which also shares the state of the replicas
+	if addr := cfg.Addr("REDIS_ADDR", ""); addr != "" {
+		app.Redis = redis.NewClient(&redis.Options{Addr: addr})
+	}
+
+	app.Alerts, err = newDispatcher(app.Keys)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	// dead man's switch, alert after HEARTBEAT_MISSES missed heartbeats
+	misses := cfg.Int("HEARTBEAT_MISSES", 3)
+	if misses <= 0 {
+		misses = 3
+	}
+
+	// SLOs are computed from the request counts sent with the heartbeats
+	objectives, err := data.ParseObjectives(cfg.String("SLO_OBJECTIVES", ""))
+	if err != nil {
+		log.Panic(err)
+	}
+	window := cfg.Duration("SLO_WINDOW", 30*24*time.Hour, time.Hour)
+
+	// scheduled backups, e.g. BACKUP_INTERVAL=24h
+	backupInterval := cfg.Duration("BACKUP_INTERVAL", 0, time.Minute)
+
+	// LOG_RETENTION keeps the entries of each level for a time, e.g.
+	// debug=7d,info=30d,warn=90d; levels left out are kept for good. A TTL
+	// index removes expired entries unless LOG_RETENTION_TTL=false, for stores
+	// without TTL support, where the purge every LOG_PURGE_INTERVAL, an hour
+	// by default, does it alone
+	logRetention, err := data.ParseRetention(cfg.String("LOG_RETENTION", ""))
+	if err != nil {
+		log.Panic(err)
+	}
+	retentionTTL := cfg.Bool("LOG_RETENTION_TTL", true)
+	purgeInterval := cfg.Duration("LOG_PURGE_INTERVAL", time.Hour, time.Minute)
+
+	// the entries are counted by minute and hour every LOG_ROLLUP_INTERVAL, a
+	// minute by default; the minute counts are kept for LOG_ROLLUP_RETENTION,
+	// a week by default, the hour counts for good
+	rollupInterval := cfg.Duration("LOG_ROLLUP_INTERVAL", time.Minute, 10*time.Second)
+	rollupRetention := cfg.Duration("LOG_ROLLUP_RETENTION", 7*24*time.Hour, 24*time.Hour)
 
-	//close connection
-	defer func() {
-		if err = client.Disconnect(ctx); err != nil {
-			panic(err)
+	// compliance deployments keep entries write-once, only redaction is allowed
+	writeOnce := cfg.Bool("LOG_WRITE_ONCE", false)
+
+	// checkpoint signatures for the tamper-evident log chain
+	signEvery := cfg.Int64("AUDIT_SIGN_EVERY", 0)
+
+	// all inserts go through the batching writer
+	writer := data.WriterConfig{
+		FlushInterval: time.Duration(cfg.Int("LOG_FLUSH_INTERVAL_MS", 0)) * time.Millisecond,
+		MaxBatch:      cfg.Int("LOG_BATCH_SIZE", 0),
+		QueueSize:     cfg.Int("LOG_QUEUE_SIZE", 0),
+	}
+
+	// searches of share link holders may cost LOG_QUERY_MAX_COST each, 720 by
+	// default or a month of unfiltered entries, and LOG_QUERY_BUDGET an hour;
+	// costlier searches are rejected, or narrowed to their newest entries with
+	// LOG_QUERY_OVERSIZE=sample. 0 lifts a limit
+	app.Queries = newQueryGuard(
+		cfg.Float("LOG_QUERY_MAX_COST", 720),
+		cfg.Float("LOG_QUERY_BUDGET", 7200),
+		cfg.OneOf("LOG_QUERY_OVERSIZE", "reject", "reject", "sample") == "sample",
+	)
+
+	// settings that are set but invalid stop the service before it serves
+	if err := cfg.Err(); err != nil {
+		log.Panicf("Invalid configuration:\n%v", err)
+	}
+
+	// imported settings take precedence over the environment
+	app.Alerting = &alertSettings{current: data.AlertingSettings{
+		Objectives:      objectives,
+		SLOWindow:       window,
+		HeartbeatMisses: misses,
+	}}
+	go app.reloadAlerting(time.Minute)
+
+	go app.monitorHeartbeats()
+	go app.evaluateSLOs(5 * time.Minute)
+
+	if backupInterval > 0 {
+		go app.scheduleBackups(backupInterval)
+	}
+
+	// key revocations made on any service
+	go watchRevocations(app.Redis, app.Keys)
+
+	// events of every service, kept to be replayed to consumers that lost some
+	go app.storeEvents()
+
+	data.SetJobPublisher(func(job *data.Job) {
+		app.publishEvent("job:"+job.ID, "job", job)
+	})
+
+	// jobs of replicas that stopped while running them can not finish anymore
+	go app.failInterruptedJobs(time.Minute)
+
+	// replicas take turns extending the tamper-evident log chain
+	if app.Redis != nil {
+		data.SetChainLock(app.lockChain)
+	}
+
+	// expired entries are removed under LOG_RETENTION
+	data.ConfigureRetention(logRetention)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+		if err := data.EnsureRetention(ctx, retentionTTL); err != nil {
+			log.Println("Error applying the log retention:", err)
 		}
 	}()
+	if len(logRetention) > 0 {
+		go app.purgeExpired(purgeInterval)
+	}
 
-	app := Config{
-		Models: data.New(client),
+	data.ConfigureRollups(rollupRetention)
+	go app.rollupLogs(rollupInterval)
+
+	data.SetWriteOnce(writeOnce)
+	data.ConfigureAudit(app.Keys, signEvery)
+	data.StartWriter(writer)
+
+	// tokens for producers configured through the environment
+	if tokens := cfg.String("INGEST_TOKENS", ""); tokens != "" {
+		if err := app.Models.IngestToken.Bootstrap(tokens); err != nil {
+			log.Panic(err)
+		}
+	}
+
+	// probes, the preStop drain and the shutdown, see lifecycle
+	app.Lifecycle = lifecycle.New()
+	app.Lifecycle.AdminKey = app.AdminKey
+	app.Lifecycle.AddCheck("mongo", func(ctx context.Context) error {
+		return client.Ping(ctx, nil)
+	})
+	app.Lifecycle.OnShutdown("mongo", client.Disconnect)
+	if app.Redis != nil {
+		app.Lifecycle.AddCheck("redis", func(ctx context.Context) error {
+			return app.Redis.Ping(ctx).Err()
+		})
+		app.Lifecycle.OnShutdown("redis", func(context.Context) error {
+			return app.Redis.Close()
+		})
+	}
+	// the entries queued in the writer are written before mongo is closed
+	app.Lifecycle.OnShutdown("log writer", func(context.Context) error {
+		data.StopWriter()
+		return nil
+	})
+	if pod := app.Lifecycle.Pod; pod != nil {
+		log.Printf("Running as pod %s/%s on node %s", pod.Namespace, pod.Name, pod.Node)
 	}
 
+	// producers that skip HTTP log over gRPC, or Go's net/rpc; both stop
+	// taking entries before the writer is stopped
+	grpcServer := grpc.NewServer()
+	go func() {
+		if err := app.gRPCListen(grpcServer); err != nil {
+			log.Println("gRPC server stopped:", err)
+		}
+	}()
+	app.Lifecycle.OnShutdown("gRPC server", func(ctx context.Context) error {
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			grpcServer.Stop()
+		}
+		return nil
+	})
+
+	rpcListener, err := net.Listen("tcp", fmt.Sprintf(":%s", app.RPCPort))
+	if err != nil {
+		log.Panic(err)
+	}
+	go func() {
+		if err := app.rpcListen(rpcListener); err != nil && !errors.Is(err, net.ErrClosed) {
+			log.Println("RPC server stopped:", err)
+		}
+	}()
+	app.Lifecycle.OnShutdown("RPC server", func(context.Context) error {
+		return rpcListener.Close()
+	})
+
 	log.Println("starting server ...")
 
 	srv := &http.Server{
@@ -57,9 +333,8 @@ func main() {
 		Handler: app.routes(),
 	}
 
-	err = srv.ListenAndServe()
-	if err != nil {
-		log.Panic()
+	if err := app.Lifecycle.Serve(srv); err != nil {
+		log.Panic(err)
 	}
 }
 
@@ -76,22 +351,39 @@ func main() {
 // 	}
 // }
 
-func connectToMongo() (*mongo.Client, error) {
+func connectToMongo(uri string, credential options.Credential) (*mongo.Client, error) {
 	// create connection to mongo
-	clientOption := options.Client().ApplyURI(mongoURL)
-	clientOption.SetAuth(options.Credential{
-		Username: "admin",
-		Password: "password",
-	})
+	clientOption := options.Client().ApplyURI(uri)
+	if credential.Username != "" {
+		clientOption.SetAuth(credential)
+	}
 
 	// connect
 	c, err := mongo.Connect(context.TODO(), clientOption)
 
 	if err != nil {
 		log.Print("Error connecting: ", err)
+		return nil, err
 	}
 
 	log.Println("Connected to mongo!")
 
 	return c, nil
 }
+
+// mongoURL is MONGO_URL, or the mongo container of docker-compose
+func mongoURL() string {
+	if url := os.Getenv("MONGO_URL"); url != "" {
+		return url
+	}
+	return defaultMongoURL
+}
+
+// mongoCredential is MONGO_USERNAME and MONGO_PASSWORD, there is no default
+// user, without MONGO_USERNAME the store is used without authentication
+func mongoCredential() options.Credential {
+	return options.Credential{
+		Username: os.Getenv("MONGO_USERNAME"),
+		Password: os.Getenv("MONGO_PASSWORD"),
+	}
+}
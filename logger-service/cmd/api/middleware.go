@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"logger/data"
+	"net/http"
+	"strings"
+)
+
+type contextKey string
+
+const producerKey contextKey = "producer"
+
+// adminKeyCredential is the credential recorded for the changes made with the
+// admin key. The key is shared, who used it is only known from what they say.
+const adminKeyCredential = "admin-key"
+
+// requireAdmin only lets requests through that carry the admin key in the
+// X-Admin-Key header. When no admin key is configured every request is refused.
+func (app *Config) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("X-Admin-Key")
+
+		if app.AdminKey == "" || subtle.ConstantTimeCompare([]byte(key), []byte(app.AdminKey)) != 1 {
+			app.errorJson(w, errors.New("admin key required"), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireIngestToken authenticates log producers with their ingest token, sent
+// as a bearer token, and puts the producer name on the request context
+func (app *Config) requireIngestToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		plain := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+		token, err := app.Models.IngestToken.Authenticate(plain)
+		if err != nil {
+			if !errors.Is(err, data.ErrInvalidToken) {
+				log.Println("Error checking ingest token", err)
+			}
+			app.errorJson(w, data.ErrInvalidToken, http.StatusUnauthorized)
+			return
+		}
+
+		if err := app.checkClientAddr(r, token); err != nil {
+			if !errors.Is(err, errAddressNotAllowed) {
+				log.Println("Error checking client address", err)
+				app.errorJson(w, err, http.StatusInternalServerError)
+				return
+			}
+			log.Printf("Refused ingest token %s of %s from %s", token.Prefix, token.Producer, r.RemoteAddr)
+			app.errorJson(w, err, http.StatusForbidden)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), producerKey, token.Producer)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func producerFromContext(ctx context.Context) string {
+	producer, _ := ctx.Value(producerKey).(string)
+	return producer
+}
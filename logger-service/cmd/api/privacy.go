@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	v1 "contracts/v1"
+	"errors"
+	"logger/data"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// UserLogs returns the latest entries linked to a user account
+func (app *Config) UserLogs(w http.ResponseWriter, r *http.Request) {
+	limit := int64(100)
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 || n > 1000 {
+			app.errorJson(w, errors.New("limit must be between 1 and 1000"))
+			return
+		}
+		limit = n
+	}
+
+	entries, err := app.Models.LogEntry.ByUser(chi.URLParam(r, "id"), limit)
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: "user logs",
+		Data:    entries,
+	})
+}
+
+type ForgetPayload struct {
+	// Mode is anonymize (drop the user id) or purge (also redact the data)
+	Mode  string `json:"mode"`
+	Actor string `json:"actor"`
+}
+
+// ForgetUser starts the job that anonymizes or purges the entries of a user,
+// used by the account deletion flow
+func (app *Config) ForgetUser(w http.ResponseWriter, r *http.Request) {
+	var requestPayload ForgetPayload
+
+	if r.ContentLength > 0 {
+		err := app.readJson(w, r, &requestPayload)
+		if err != nil {
+			app.errorJson(w, err)
+			return
+		}
+	}
+
+	if requestPayload.Mode == "" {
+		requestPayload.Mode = "anonymize"
+	}
+	if requestPayload.Mode != "anonymize" && requestPayload.Mode != "purge" {
+		app.errorJson(w, errors.New("mode must be anonymize or purge"))
+		return
+	}
+	if requestPayload.Actor == "" {
+		requestPayload.Actor = "admin"
+	}
+
+	userID := chi.URLParam(r, "id")
+	purge := requestPayload.Mode == "purge"
+
+	job, err := app.Models.Job.Start("forget_user", func(ctx context.Context, progress data.ProgressFunc) (any, error) {
+		ctx, cancel := context.WithTimeout(ctx, 30*time.Minute)
+		defer cancel()
+
+		actor := data.Actor{Credential: adminKeyCredential, Name: requestPayload.Actor}
+		return app.Models.LogEntry.ForgetUser(ctx, userID, purge, actor, progress)
+	})
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJson(w, http.StatusAccepted, jsonReponse{
+		Error:   false,
+		Message: "forget started",
+		Data:    job,
+	})
+}
+
+// MergeUser links the entries of a merged account to the account it was
+// merged into, used by the account merge flow of the auth service
+func (app *Config) MergeUser(w http.ResponseWriter, r *http.Request) {
+	var requestPayload v1.UserMerge
+
+	err := app.readJson(w, r, &requestPayload)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	err = app.Models.UserAlias.Link(requestPayload.From, requestPayload.To, producerFromContext(r.Context()))
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// contentProtobuf is the content type of protobuf ingest bodies, see contracts/logpb/log.proto
+const contentProtobuf = "application/x-protobuf"
+
+func isProtobuf(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == contentProtobuf || mediaType == "application/protobuf"
+}
+
+// decodeLogEntry decodes a logger.v1.LogEntry message. Unknown fields are
+// skipped as protobuf requires.
+func decodeLogEntry(b []byte) (JSONPayload, error) {
+	var p JSONPayload
+
+	fields := map[protowire.Number]*string{
+		1: &p.Name,
+		2: &p.Data,
+		3: &p.TraceID,
+		4: &p.SpanID,
+		5: &p.Level,
+		6: &p.Stack,
+		7: &p.UserID,
+		8: &p.Version,
+		9: &p.Service,
+	}
+
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return p, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if field, ok := fields[num]; ok && typ == protowire.BytesType {
+			v, n := protowire.ConsumeString(b)
+			if n < 0 {
+				return p, fmt.Errorf("field %d: %w", num, protowire.ParseError(n))
+			}
+			*field = v
+			b = b[n:]
+			continue
+		}
+
+		if num == 10 && typ == protowire.BytesType {
+			msg, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return p, fmt.Errorf("field %d: %w", num, protowire.ParseError(n))
+			}
+			key, value, err := decodeMapEntry(msg)
+			if err != nil {
+				return p, fmt.Errorf("field %d: %w", num, err)
+			}
+			if p.Fields == nil {
+				p.Fields = make(map[string]string)
+			}
+			p.Fields[key] = value
+			b = b[n:]
+			continue
+		}
+
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return p, fmt.Errorf("field %d: %w", num, protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+
+	return p, nil
+}
+
+// decodeMapEntry decodes an entry of a map<string, string>, a message with
+// the key as field 1 and the value as field 2
+func decodeMapEntry(b []byte) (key, value string, err error) {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return "", "", protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if (num == 1 || num == 2) && typ == protowire.BytesType {
+			v, n := protowire.ConsumeString(b)
+			if n < 0 {
+				return "", "", protowire.ParseError(n)
+			}
+			if num == 1 {
+				key = v
+			} else {
+				value = v
+			}
+			b = b[n:]
+			continue
+		}
+
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return "", "", protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+
+	return key, value, nil
+}
+
+// decodeLogBatch decodes a logger.v1.LogBatch message
+func decodeLogBatch(b []byte) ([]JSONPayload, error) {
+	var entries []JSONPayload
+
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if num == 1 && typ == protowire.BytesType {
+			msg, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return nil, fmt.Errorf("entries[%d]: %w", len(entries), protowire.ParseError(n))
+			}
+
+			entry, err := decodeLogEntry(msg)
+			if err != nil {
+				return nil, fmt.Errorf("entries[%d]: %w", len(entries), err)
+			}
+			entries = append(entries, entry)
+
+			b = b[n:]
+			continue
+		}
+
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return nil, fmt.Errorf("field %d: %w", num, protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// callerKey holds the caller of a search on the request context
+	callerKey contextKey = "caller"
+	// adminCaller is the caller of requests made with the admin key
+	adminCaller = "admin"
+
+	// budgetWindow is how long the budget of a caller lasts
+	budgetWindow = time.Hour
+)
+
+// queryGuard guards the store against broad searches of callers other than
+// the admin, like dashboards built on share links. Searches costing more than
+// MaxCost, see data.EstimateCost, are rejected or, when Sample is set, cut
+// down to the newest entries that fit. Each caller may spend Budget an hour;
+// the budgets are shared by the replicas through Redis when there is one.
+type queryGuard struct {
+	MaxCost float64
+	Budget  float64
+	Sample  bool
+
+	mu     sync.Mutex
+	window int64
+	used   map[string]float64
+
+	// shared is false while Redis is unreachable and every replica counts
+	// on its own
+	shared atomic.Bool
+}
+
+// budgetUse is what a caller spent of its budget in the current window
+type budgetUse struct {
+	Caller    string    `json:"caller"`
+	Used      float64   `json:"used"`
+	Budget    float64   `json:"budget"`
+	Remaining float64   `json:"remaining"`
+	ResetsAt  time.Time `json:"resets_at"`
+}
+
+func newQueryGuard(maxCost, budget float64, sample bool) *queryGuard {
+	g := &queryGuard{MaxCost: maxCost, Budget: budget, Sample: sample, used: make(map[string]float64)}
+	g.shared.Store(true)
+	return g
+}
+
+// windowOf returns the budget window of t and when it ends
+func windowOf(t time.Time) (int64, time.Time) {
+	w := t.Unix() / int64(budgetWindow/time.Second)
+	return w, time.Unix((w+1)*int64(budgetWindow/time.Second), 0)
+}
+
+// charge spends cost of the budget of caller and returns what it used with
+// it. A charge the budget can not cover is not spent.
+func (g *queryGuard) charge(ctx context.Context, rdb *redis.Client, caller string, cost float64) (budgetUse, bool) {
+	window, resets := windowOf(time.Now())
+	use := budgetUse{Caller: caller, Budget: g.Budget, ResetsAt: resets}
+
+	used, ok, err := g.chargeShared(ctx, rdb, window, caller, cost)
+	if err != nil {
+		if g.shared.Swap(false) {
+			log.Println("Counting query budgets on this replica only:", err)
+		}
+		used, ok = g.chargeLocal(window, caller, cost)
+	} else if rdb != nil && !g.shared.Swap(true) {
+		log.Println("Counting query budgets through Redis")
+	}
+
+	use.Used = used
+	use.Remaining = max(g.Budget-used, 0)
+	return use, ok
+}
+
+// chargeBudget adds the cost to the budget in Redis unless it would exceed
+// it, and returns what was used
+var chargeBudget = redis.NewScript(`
+local used = tonumber(redis.call('GET', KEYS[1]) or '0')
+local cost, budget = tonumber(ARGV[1]), tonumber(ARGV[2])
+if used + cost > budget then
+	return {0, tostring(used)}
+end
+used = tonumber(redis.call('INCRBYFLOAT', KEYS[1], ARGV[1]))
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return {1, tostring(used)}
+`)
+
+func (g *queryGuard) chargeShared(ctx context.Context, rdb *redis.Client, window int64, caller string, cost float64) (float64, bool, error) {
+	if rdb == nil {
+		used, ok := g.chargeLocal(window, caller, cost)
+		return used, ok, nil
+	}
+
+	res, err := chargeBudget.Run(ctx, rdb, []string{budgetKey(window, caller)},
+		cost, g.Budget, (2 * budgetWindow).Milliseconds()).Slice()
+	if err != nil || len(res) != 2 {
+		return 0, false, fmt.Errorf("charging query budget: %v", err)
+	}
+
+	allowed, _ := res[0].(int64)
+	used, _ := strconv.ParseFloat(fmt.Sprint(res[1]), 64)
+	return used, allowed == 1, nil
+}
+
+func (g *queryGuard) chargeLocal(window int64, caller string, cost float64) (float64, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if window != g.window {
+		g.window = window
+		g.used = make(map[string]float64)
+	}
+
+	used := g.used[caller]
+	if used+cost > g.Budget {
+		return used, false
+	}
+	g.used[caller] = used + cost
+	return used + cost, true
+}
+
+// usage returns what the callers spent in the current window, the biggest
+// spenders first
+func (g *queryGuard) usage(ctx context.Context, rdb *redis.Client) ([]budgetUse, error) {
+	window, resets := windowOf(time.Now())
+	used := make(map[string]float64)
+
+	if rdb != nil && g.shared.Load() {
+		prefix := budgetKey(window, "")
+		iter := rdb.Scan(ctx, 0, prefix+"*", 100).Iterator()
+		for iter.Next(ctx) {
+			v, err := rdb.Get(ctx, iter.Val()).Float64()
+			if err != nil && err != redis.Nil {
+				return nil, err
+			}
+			used[strings.TrimPrefix(iter.Val(), prefix)] = v
+		}
+		if err := iter.Err(); err != nil {
+			return nil, err
+		}
+	} else {
+		g.mu.Lock()
+		if g.window == window {
+			for caller, v := range g.used {
+				used[caller] = v
+			}
+		}
+		g.mu.Unlock()
+	}
+
+	uses := make([]budgetUse, 0, len(used))
+	for caller, v := range used {
+		uses = append(uses, budgetUse{Caller: caller, Used: v, Budget: g.Budget, Remaining: max(g.Budget-v, 0), ResetsAt: resets})
+	}
+	sort.Slice(uses, func(i, j int) bool { return uses[i].Used > uses[j].Used })
+
+	return uses, nil
+}
+
+func budgetKey(window int64, caller string) string {
+	return fmt.Sprintf("querybudget:%d:%s", window, caller)
+}
+
+// callerOf returns the caller of a request, see requireAdminOrShare
+func callerOf(r *http.Request) string {
+	if caller, ok := r.Context().Value(callerKey).(string); ok {
+		return caller
+	}
+	return adminCaller
+}
+
+// setBudgetHeaders tells the caller what its search cost and what is left
+func setBudgetHeaders(h http.Header, cost float64, use budgetUse) {
+	h.Set("X-Query-Cost", strconv.FormatFloat(math.Ceil(cost), 'f', 0, 64))
+	h.Set("X-Query-Budget", strconv.FormatFloat(use.Budget, 'f', 0, 64))
+	h.Set("X-Query-Budget-Remaining", strconv.FormatFloat(math.Floor(use.Remaining), 'f', 0, 64))
+	h.Set("X-Query-Budget-Reset", strconv.FormatInt(use.ResetsAt.Unix(), 10))
+}
+
+// ListQueryBudgets returns what the callers spent of their query budgets in
+// the current hour
+func (app *Config) ListQueryBudgets(w http.ResponseWriter, r *http.Request) {
+	uses, err := app.Queries.usage(r.Context(), app.Redis)
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: fmt.Sprintf("max cost %.0f, budget %.0f an hour", app.Queries.MaxCost, app.Queries.Budget),
+		Data:    uses,
+	})
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"logger/data"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// PurgeLogs removes the entries created before ?before=, RFC 3339 or
+// YYYY-MM-DD, of one ?level= when given. With ?dry_run=true it only counts
+// them. ?actor= names who purged, it is recorded with the purge.
+func (app *Config) PurgeLogs(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	if params.Get("before") == "" {
+		app.errorJson(w, errors.New("before is required"))
+		return
+	}
+	before, err := data.ParseQueryTime(params.Get("before"))
+	if err != nil {
+		app.errorJson(w, fmt.Errorf("before: %w", err))
+		return
+	}
+	if before.After(time.Now()) {
+		app.errorJson(w, errors.New("before must be in the past"))
+		return
+	}
+
+	purge := data.Purge{Before: before, Actor: params.Get("actor")}
+	if purge.Actor == "" {
+		purge.Actor = "admin"
+	}
+	if v := params.Get("level"); v != "" {
+		if purge.Level, err = data.NormalizeLevel(v); err != nil {
+			app.errorJson(w, err)
+			return
+		}
+	}
+	purge.DryRun, _ = strconv.ParseBool(params.Get("dry_run"))
+
+	result, err := app.Models.LogEntry.Purge(r.Context(), purge)
+	if errors.Is(err, data.ErrWriteOnce) {
+		app.errorJson(w, err, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	message := fmt.Sprintf("%d entries purged", result.Entries)
+	if result.DryRun {
+		message = fmt.Sprintf("%d entries would be purged", result.Entries)
+	} else {
+		log.Printf("%s purged %d entries created before %s", result.Actor, result.Entries, before.Format(time.RFC3339))
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: message,
+		Data:    result,
+	})
+}
+
+// purgeExpired removes the expired entries every interval, on one replica at
+// a time
+func (app *Config) purgeExpired(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lease := app.newLease("retention", interval+30*time.Second)
+
+	for range ticker.C {
+		if !lease.hold() {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		removed, err := data.PurgeExpired(ctx)
+		cancel()
+
+		if err != nil {
+			log.Println("Error purging expired entries:", err)
+			continue
+		}
+		if removed > 0 {
+			log.Printf("Purged %d expired entries", removed)
+		}
+	}
+}
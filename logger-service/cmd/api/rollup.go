@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"logger/data"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// rollupSpans are the default and the longest spans of a rollup query by
+// resolution
+var rollupSpans = map[string]struct{ fallback, max time.Duration }{
+	data.RollupMinute: {time.Hour, 48 * time.Hour},
+	data.RollupHour:   {24 * time.Hour, 366 * 24 * time.Hour},
+}
+
+// LogRollups returns the entry counts of the rollups, for dashboards that
+// would otherwise count the entries themselves
+//
+//	resolution=minute|hour            minute by default
+//	from=<time>, to=<time>            the last hour of minutes or day of hours by default
+//	service=, level=, name=           counts of these entries only
+//	group_by=service,level,name       counts by these fields, totals by default
+//
+// Counts of the current minute are not there yet, the current hour is counted
+// so far.
+func (app *Config) LogRollups(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	q := data.RollupQuery{
+		Resolution: params.Get("resolution"),
+		Service:    params.Get("service"),
+		Name:       params.Get("name"),
+	}
+	if q.Resolution == "" {
+		q.Resolution = data.RollupMinute
+	}
+	span, ok := rollupSpans[q.Resolution]
+	if !ok {
+		app.errorJson(w, errors.New("resolution must be minute or hour"))
+		return
+	}
+
+	if v := params.Get("level"); v != "" {
+		level, err := data.NormalizeLevel(v)
+		if err != nil {
+			app.errorJson(w, err)
+			return
+		}
+		q.Level = level
+	}
+
+	if v := params.Get("group_by"); v != "" {
+		for _, field := range strings.Split(v, ",") {
+			switch field {
+			case "service", "level", "name":
+				q.GroupBy = append(q.GroupBy, field)
+			default:
+				app.errorJson(w, fmt.Errorf("cannot group by %q, only by service, level and name", field))
+				return
+			}
+		}
+	}
+
+	q.To = time.Now()
+	for _, bound := range []struct {
+		param string
+		t     *time.Time
+	}{{"from", &q.From}, {"to", &q.To}} {
+		v := params.Get(bound.param)
+		if v == "" {
+			continue
+		}
+		t, err := data.ParseQueryTime(v)
+		if err != nil {
+			app.errorJson(w, fmt.Errorf("%s: %w", bound.param, err))
+			return
+		}
+		*bound.t = t
+	}
+	if q.From.IsZero() {
+		q.From = q.To.Add(-span.fallback)
+	}
+	if !q.From.Before(q.To) {
+		app.errorJson(w, errors.New("from must be before to"))
+		return
+	}
+	if q.To.Sub(q.From) > span.max {
+		app.errorJson(w, fmt.Errorf("%s rollups span at most %s", q.Resolution, span.max))
+		return
+	}
+
+	points, err := data.Rollups(r.Context(), q)
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: fmt.Sprintf("%d %s rollups", len(points), q.Resolution),
+		Data:    points,
+	})
+}
+
+// rollupLogs counts the new entries into rollups every interval, on one
+// replica at a time
+func (app *Config) rollupLogs(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lease := app.newLease("rollups", interval+30*time.Second)
+
+	for range ticker.C {
+		if !lease.hold() {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), interval+time.Minute)
+		run, err := data.RollupLogs(ctx, time.Now())
+		cancel()
+
+		if err != nil {
+			log.Println("Error rolling up entries:", err)
+			continue
+		}
+		slog.Debug("rolled up entries", "from", run.From, "until", run.Until, "minutes", run.Minutes, "hours", run.Hours)
+	}
+}
@@ -1,28 +1,192 @@
 package main
 
 import (
+	"contracts/loglevel"
+	"contracts/negotiate"
+	"contracts/ratelimit"
+	"contracts/timeout"
+	"errors"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 )
 
+// noTimeout is the timeout of routes that must not have one
+const noTimeout time.Duration = -1
+
+// scopes a route can require
+const (
+	scopeAdmin  = "admin"
+	scopeIngest = "ingest"
+)
+
+// route declares one endpoint with the middleware it needs. A zero rate means
+// no limit, a zero timeout the RequestTimeout of the service and noTimeout
+// none, for routes that stream.
+type route struct {
+	method  string
+	path    string
+	handler http.HandlerFunc
+	scopes  []string
+	rate    int // requests per minute per client
+	timeout time.Duration
+	share   bool // admin routes that also take share links, see CreateShareLink
+}
+
+func (app *Config) routeTable() []route {
+	return []route{
+		{method: "GET", path: "/version", handler: app.Version},
+
+		// orchestrator probes and the preStop hook, the drain waits on purpose
+		{method: "GET", path: "/livez", handler: app.Lifecycle.Livez},
+		{method: "GET", path: "/healthz", handler: app.Lifecycle.Healthz, timeout: 5 * time.Second},
+		{method: "GET", path: "/readyz", handler: app.Lifecycle.Readyz, timeout: 5 * time.Second},
+		{method: "POST", path: "/drain", handler: app.Lifecycle.Drain, timeout: noTimeout},
+
+		{method: "GET", path: "/admin/loglevel", handler: loglevel.GetHandler, scopes: []string{scopeAdmin}},
+		{method: "PUT", path: "/admin/loglevel", handler: loglevel.SetHandler, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+
+		{method: "POST", path: "/log", handler: app.WriterLog, scopes: []string{scopeIngest}, timeout: 15 * time.Second},
+		{method: "POST", path: "/log/batch", handler: app.WriterLogBatch, scopes: []string{scopeIngest}, timeout: 60 * time.Second},
+		{method: "POST", path: "/log/crash", handler: app.ReportCrash, scopes: []string{scopeIngest}, timeout: 10 * time.Second},
+		{method: "POST", path: "/heartbeat", handler: app.Heartbeat, scopes: []string{scopeIngest}, timeout: 10 * time.Second},
+		{method: "POST", path: "/captures", handler: app.StoreCapture, scopes: []string{scopeIngest}, timeout: 10 * time.Second},
+
+		{method: "GET", path: "/log/verify", handler: app.VerifyLog, rate: 6, timeout: 90 * time.Second},
+
+		{method: "GET", path: "/logs", handler: app.SearchLogs, scopes: []string{scopeAdmin}, timeout: 30 * time.Second, share: true},
+		// streams stay open as long as the client watches
+		{method: "GET", path: "/logs/stream", handler: app.StreamLogs, scopes: []string{scopeAdmin}, timeout: noTimeout},
+		{method: "DELETE", path: "/logs", handler: app.PurgeLogs, scopes: []string{scopeAdmin}, timeout: 5 * time.Minute},
+		{method: "GET", path: "/logs/trace/{id}", handler: app.TraceLogs, scopes: []string{scopeAdmin}, timeout: 30 * time.Second, share: true},
+		{method: "GET", path: "/logs/user/{id}", handler: app.UserLogs, scopes: []string{scopeAdmin}, timeout: 30 * time.Second},
+		// counts for dashboards, cheaper than searching the entries
+		{method: "GET", path: "/logs/rollups", handler: app.LogRollups, scopes: []string{scopeAdmin}, timeout: 30 * time.Second, share: true},
+
+		{method: "GET", path: "/slo", handler: app.ListSLOs, rate: 120, timeout: 15 * time.Second},
+		{method: "GET", path: "/slo/{service}", handler: app.GetSLO, rate: 120, timeout: 15 * time.Second},
+
+		{method: "POST", path: "/log/redact", handler: app.RedactLog, scopes: []string{scopeAdmin}, timeout: 30 * time.Second},
+
+		{method: "GET", path: "/admin/backups", handler: app.ListBackups, scopes: []string{scopeAdmin}, timeout: 15 * time.Second},
+		{method: "POST", path: "/admin/backups", handler: app.CreateBackup, scopes: []string{scopeAdmin}, timeout: 15 * time.Second},
+		// archives run to gigabytes, downloads have no timeout
+		{method: "GET", path: "/admin/backups/{name}", handler: app.DownloadBackup, scopes: []string{scopeAdmin}, timeout: noTimeout, share: true},
+
+		{method: "GET", path: "/jobs/{id}", handler: app.GetJob, scopes: []string{scopeAdmin}, timeout: 15 * time.Second},
+
+		{method: "POST", path: "/admin/users/{id}/forget", handler: app.ForgetUser, scopes: []string{scopeAdmin}, timeout: 15 * time.Second},
+		{method: "POST", path: "/users/merge", handler: app.MergeUser, scopes: []string{scopeIngest}, timeout: 10 * time.Second},
+
+		{method: "POST", path: "/admin/alerts/test", handler: app.TestAlert, scopes: []string{scopeAdmin}, rate: 10, timeout: 45 * time.Second},
+		{method: "GET", path: "/admin/heartbeats", handler: app.ListHeartbeats, scopes: []string{scopeAdmin}, timeout: 15 * time.Second},
+		{method: "GET", path: "/admin/captures", handler: app.ListCaptures, scopes: []string{scopeAdmin}, timeout: 15 * time.Second},
+		{method: "GET", path: "/admin/crashes", handler: app.TopCrashes, scopes: []string{scopeAdmin}, timeout: 15 * time.Second},
+
+		{method: "GET", path: "/admin/issues", handler: app.ListIssues, scopes: []string{scopeAdmin}, timeout: 15 * time.Second},
+		{method: "GET", path: "/admin/issues/{id}", handler: app.GetIssue, scopes: []string{scopeAdmin}, timeout: 15 * time.Second},
+		{method: "PUT", path: "/admin/issues/{id}", handler: app.UpdateIssue, scopes: []string{scopeAdmin}, timeout: 15 * time.Second},
+
+		{method: "GET", path: "/admin/tokens", handler: app.ListTokens, scopes: []string{scopeAdmin}, timeout: 15 * time.Second},
+		{method: "POST", path: "/admin/tokens", handler: app.IssueToken, scopes: []string{scopeAdmin}, timeout: 15 * time.Second},
+		{method: "POST", path: "/admin/tokens/{id}/rotate", handler: app.RotateToken, scopes: []string{scopeAdmin}, timeout: 15 * time.Second},
+		{method: "DELETE", path: "/admin/tokens/{id}", handler: app.RevokeToken, scopes: []string{scopeAdmin}, timeout: 15 * time.Second},
+		{method: "PUT", path: "/admin/tokens/{id}/ips", handler: app.SetTokenIPRules, scopes: []string{scopeAdmin}, timeout: 15 * time.Second},
+		{method: "GET", path: "/admin/producers/ips", handler: app.ListProducerIPRules, scopes: []string{scopeAdmin}, timeout: 15 * time.Second},
+		{method: "PUT", path: "/admin/producers/{producer}/ips", handler: app.SetProducerIPRules, scopes: []string{scopeAdmin}, timeout: 15 * time.Second},
+		{method: "DELETE", path: "/admin/producers/{producer}/ips", handler: app.DeleteProducerIPRules, scopes: []string{scopeAdmin}, timeout: 15 * time.Second},
+
+		// the admin configuration as a YAML document, planned then applied
+		{method: "POST", path: "/admin/config", handler: app.ApplyConfig, scopes: []string{scopeAdmin}, timeout: 60 * time.Second},
+
+		// alerting settings promoted from one environment to the next
+		{method: "GET", path: "/admin/config/export", handler: app.ExportConfig, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+		{method: "POST", path: "/admin/config/import", handler: app.ImportConfig, scopes: []string{scopeAdmin}, timeout: 15 * time.Second},
+
+		// stored events sent again to a consumer that lost them
+		{method: "POST", path: "/admin/events/replay", handler: app.ReplayEvents, scopes: []string{scopeAdmin}, timeout: 15 * time.Second},
+
+		// signed links to admin resources for people without the admin key
+		{method: "GET", path: "/admin/shares", handler: app.ListShareLinks, scopes: []string{scopeAdmin}, timeout: 15 * time.Second},
+		{method: "POST", path: "/admin/shares", handler: app.CreateShareLink, scopes: []string{scopeAdmin}, timeout: 15 * time.Second},
+		{method: "DELETE", path: "/admin/shares/{id}", handler: app.RevokeShareLink, scopes: []string{scopeAdmin}, timeout: 15 * time.Second},
+
+		// what the share link holders spent of their query budgets this hour
+		{method: "GET", path: "/admin/query-budgets", handler: app.ListQueryBudgets, scopes: []string{scopeAdmin}, timeout: 15 * time.Second},
+
+		{method: "GET", path: "/admin/keys", handler: app.ListKeys, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+		{method: "POST", path: "/admin/keys/{id}/revoke", handler: app.RevokeKey, scopes: []string{scopeAdmin}, timeout: 10 * time.Second},
+	}
+}
+
+// scopeMiddleware returns the middleware that checks a scope
+func (app *Config) scopeMiddleware(scope string) func(http.Handler) http.Handler {
+	switch scope {
+	case scopeAdmin:
+		return app.requireAdmin
+	case scopeIngest:
+		return app.requireIngestToken
+	}
+	panic(fmt.Sprintf("unknown scope %q", scope))
+}
+
+// routeMiddleware builds the middleware of a route: scopes first so that
+// rejected requests do not use up the rate limit, then the rate limit and the
+// timeout
+func (app *Config) routeMiddleware(rt route) []func(http.Handler) http.Handler {
+	var mws []func(http.Handler) http.Handler
+
+	for _, scope := range rt.scopes {
+		if scope == scopeAdmin && rt.share {
+			mws = append(mws, app.requireAdminOrShare)
+			continue
+		}
+		mws = append(mws, app.scopeMiddleware(scope))
+	}
+	if rt.rate > 0 {
+		mws = append(mws, ratelimit.New(app.Redis, rt.method+" "+rt.path, rt.rate).Middleware)
+	}
+	d := rt.timeout
+	if d == 0 {
+		d = app.RequestTimeout
+	}
+	if d > 0 {
+		mws = append(mws, timeout.Middleware(d, http.HandlerFunc(app.timedOut)))
+	}
+
+	return mws
+}
+
+// timedOut answers the requests whose handler ran out of time
+func (app *Config) timedOut(w http.ResponseWriter, r *http.Request) {
+	app.errorJson(w, errors.New("request timed out"), http.StatusGatewayTimeout)
+}
+
 func (app *Config) routes() http.Handler {
 	mux := chi.NewRouter()
 
 	mux.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"https://*", "http://*"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Range", "If-Range", "If-None-Match", "Last-Event-ID"},
+		ExposedHeaders:   []string{"Link", "ETag", "Accept-Ranges", "Content-Range", "Content-Disposition"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
 
 	mux.Use(middleware.Heartbeat("/ping"))
 
-	mux.Post("/log", app.WriterLog)
+	mux.Use(loglevel.DebugRequests)
+
+	mux.Use(negotiate.Middleware)
+
+	for _, rt := range app.routeTable() {
+		mux.With(app.routeMiddleware(rt)...).Method(rt.method, rt.path, rt.handler)
+	}
 
 	return mux
 }
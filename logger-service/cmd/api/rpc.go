@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/netip"
+	"net/rpc"
+)
+
+// RPCServer takes log entries over Go's net/rpc on RPCPort, for Go producers
+// that want neither HTTP nor gRPC. The ingest token travels in the payload.
+// Every connection gets its own RPCServer, so the address lists of the ingest
+// tokens can be applied.
+type RPCServer struct {
+	app  *Config
+	addr netip.Addr
+}
+
+// RPCPayload is one entry sent to RPCServer.LogInfo
+type RPCPayload struct {
+	Token string
+	JSONPayload
+}
+
+// LogInfo stores one entry
+func (r *RPCServer) LogInfo(payload RPCPayload, resp *string) error {
+	ctx, err := r.app.authenticateProducer(context.Background(), payload.Token, r.addr)
+	if err != nil {
+		return err
+	}
+
+	if err := r.app.ingest(ctx, "", payload.JSONPayload); err != nil {
+		return err
+	}
+
+	*resp = "logged " + payload.Name
+	return nil
+}
+
+// rpcListen serves RPCServer on lis, listening on RPCPort, until the listener
+// fails or is closed
+func (app *Config) rpcListen(lis net.Listener) error {
+	defer lis.Close()
+
+	log.Printf("RPC server started on port %s", app.RPCPort)
+
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			return err
+		}
+
+		srv := rpc.NewServer()
+		if err := srv.Register(&RPCServer{app: app, addr: parseRemoteAddr(conn.RemoteAddr().String())}); err != nil {
+			conn.Close()
+			return err
+		}
+
+		go srv.ServeConn(conn)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"logger/data"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// SearchLogs returns a page of the entries matching the query language in
+// ?q=, see data.ParseQuery, and the filters
+//
+//	name=<name>             entries with this name
+//	from=<time>, to=<time>  entries created in [from, to), RFC 3339 or YYYY-MM-DD
+//	search=<text>           entries whose name or data hold the words
+//	sort=created_at         oldest first, -created_at (the default) newest first
+//	limit=<n>               entries per page, 100 by default and at most 1000
+//
+// The URL of the next page is in the Link header, with rel="next"; the last
+// page has none. The estimated cost of the search is in X-Query-Cost. Callers
+// other than the admin, see callerOf, spend it from their query budget and
+// can not run searches costing more than the maximum, see queryGuard.
+func (app *Config) SearchLogs(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	filter, err := data.ParseQuery(params.Get("q"))
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	query := data.LogQuery{
+		Search: params.Get("search"),
+		Cursor: params.Get("cursor"),
+		Limit:  100,
+	}
+
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 || n > 1000 {
+			app.errorJson(w, errors.New("limit must be between 1 and 1000"))
+			return
+		}
+		query.Limit = n
+	}
+
+	switch params.Get("sort") {
+	case "", "-created_at":
+	case "created_at":
+		query.Ascending = true
+	default:
+		app.errorJson(w, errors.New("sort must be created_at or -created_at"))
+		return
+	}
+
+	filters := bson.A{}
+	if len(filter) > 0 {
+		filters = append(filters, filter)
+	}
+	if name := params.Get("name"); name != "" {
+		filters = append(filters, bson.M{"name": name})
+	}
+	for _, bound := range []struct{ param, op string }{{"from", "$gte"}, {"to", "$lt"}} {
+		v := params.Get(bound.param)
+		if v == "" {
+			continue
+		}
+		t, err := data.ParseQueryTime(v)
+		if err != nil {
+			app.errorJson(w, fmt.Errorf("%s: %w", bound.param, err))
+			return
+		}
+		filters = append(filters, bson.M{"created_at": bson.M{bound.op: t}})
+	}
+	if len(filters) > 0 {
+		query.Filter = bson.M{"$and": filters}
+	}
+
+	headers := http.Header{}
+	if !app.guardQuery(w, r, &query, headers) {
+		return
+	}
+
+	entries, next, err := app.Models.LogEntry.Search(query)
+	if errors.Is(err, data.ErrInvalidCursor) {
+		app.errorJson(w, err)
+		return
+	}
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if next != "" {
+		params.Set("cursor", next)
+		link := url.URL{Path: r.URL.Path, RawQuery: params.Encode()}
+		headers.Set("Link", fmt.Sprintf(`<%s>; rel="next"`, link.String()))
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: "logs",
+		Data:    entries,
+	}, headers)
+}
+
+// guardQuery estimates the cost of query and, for callers other than the
+// admin, rejects it or samples it when it costs more than the maximum, then
+// charges it to the budget of the caller. It reports whether the search may
+// run; when it may not, the response was written.
+func (app *Config) guardQuery(w http.ResponseWriter, r *http.Request, query *data.LogQuery, headers http.Header) bool {
+	now := time.Now()
+	cost := data.EstimateCost(*query, time.Time{}, time.Time{}, now)
+
+	caller := callerOf(r)
+	if caller == adminCaller {
+		headers.Set("X-Query-Cost", strconv.FormatFloat(math.Ceil(cost.Units), 'f', 0, 64))
+		return true
+	}
+
+	guard := app.Queries
+	if guard.MaxCost > 0 && cost.Units > guard.MaxCost {
+		if !guard.Sample {
+			app.errorJson(w, fmt.Errorf("query cost %.0f exceeds the maximum of %.0f, narrow it down with from, to or exact filters", cost.Units, guard.MaxCost), http.StatusUnprocessableEntity)
+			return false
+		}
+
+		// only the newest entries that fit are searched
+		from := cost.Narrowed(guard.MaxCost)
+		bound := bson.M{"created_at": bson.M{"$gte": from}}
+		if len(query.Filter) > 0 {
+			bound = bson.M{"$and": bson.A{query.Filter, bound}}
+		}
+		query.Filter = bound
+		headers.Set("X-Query-Sampled", from.UTC().Format(time.RFC3339))
+		cost = data.EstimateCost(*query, time.Time{}, time.Time{}, now)
+	}
+
+	if guard.Budget <= 0 {
+		headers.Set("X-Query-Cost", strconv.FormatFloat(math.Ceil(cost.Units), 'f', 0, 64))
+		return true
+	}
+
+	use, ok := guard.charge(r.Context(), app.Redis, caller, cost.Units)
+	setBudgetHeaders(headers, cost.Units, use)
+	if !ok {
+		for key, values := range headers {
+			w.Header()[key] = values
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(use.ResetsAt)/time.Second)+1))
+		app.errorJson(w, fmt.Errorf("query budget of %s exhausted, %.0f of %.0f used this hour", caller, use.Used, use.Budget), http.StatusTooManyRequests)
+		return false
+	}
+
+	return true
+}
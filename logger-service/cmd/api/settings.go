@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"logger/data"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// configVersion is the version of the exported configuration document. Import
+// refuses documents of another version.
+const configVersion = 1
+
+// alertSettings are the alerting settings in use, read by the loops and the
+// handlers while an import may replace them
+type alertSettings struct {
+	mu      sync.RWMutex
+	current data.AlertingSettings
+}
+
+func (a *alertSettings) get() data.AlertingSettings {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.current
+}
+
+func (a *alertSettings) set(settings data.AlertingSettings) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.current = settings
+}
+
+// reloadAlerting picks up the imported settings at start and then every
+// interval, so an import made on one replica reaches the others
+func (app *Config) reloadAlerting(interval time.Duration) {
+	for {
+		stored, err := app.Models.Alerting.Get()
+		switch {
+		case err != nil:
+			log.Println("Error reading alerting settings:", err)
+		case stored != nil && !stored.UpdatedAt.Equal(app.Alerting.get().UpdatedAt):
+			log.Printf("Using the alerting settings imported at %s", stored.UpdatedAt.Format(time.RFC3339))
+			app.Alerting.set(*stored)
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+// configDocument is the configuration of the logger that moves between
+// environments. Durations are in nanoseconds, like in the SLO reports.
+type configDocument struct {
+	Version    int                    `json:"version"`
+	Service    string                 `json:"service"`
+	ExportedAt time.Time              `json:"exported_at"`
+	Alerting   *data.AlertingSettings `json:"alerting"`
+}
+
+// ExportConfig returns the alerting settings in use as a versioned document,
+// to be imported into another environment
+func (app *Config) ExportConfig(w http.ResponseWriter, r *http.Request) {
+	settings := app.Alerting.get()
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: "configuration",
+		Data: configDocument{
+			Version:    configVersion,
+			Service:    "logger",
+			ExportedAt: time.Now().UTC(),
+			Alerting:   &settings,
+		},
+	})
+}
+
+// ImportConfig stores the settings of an exported document and uses them at
+// once; the other replicas follow within a minute
+func (app *Config) ImportConfig(w http.ResponseWriter, r *http.Request) {
+	var requestPayload configDocument
+
+	err := app.readJson(w, r, &requestPayload)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	switch {
+	case requestPayload.Version != configVersion:
+		app.errorJson(w, fmt.Errorf("unsupported configuration version %d, expected %d", requestPayload.Version, configVersion))
+		return
+	case requestPayload.Service != "logger":
+		app.errorJson(w, fmt.Errorf("configuration of %q can not be imported into the logger", requestPayload.Service))
+		return
+	case requestPayload.Alerting == nil:
+		app.errorJson(w, errors.New("configuration has no alerting settings"))
+		return
+	}
+
+	if err := requestPayload.Alerting.Validate(); err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	stored, err := app.Models.Alerting.Save(*requestPayload.Alerting)
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.Alerting.set(*stored)
+
+	err = app.Models.LogEntry.Insert(data.LogEntry{
+		Name:     "config.imported",
+		Data:     fmt.Sprintf("alerting settings exported at %s", requestPayload.ExportedAt.Format(time.RFC3339)),
+		Producer: "logger",
+	})
+	if err != nil {
+		log.Println("Error logging the imported configuration:", err)
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: "configuration imported",
+		Data:    stored,
+	})
+}
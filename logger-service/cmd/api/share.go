@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"contracts/keystore"
+	"contracts/signing"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"logger/data"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultShareTTL = 24 * time.Hour
+	maxShareTTL     = 7 * 24 * time.Hour
+)
+
+// errInvalidShare is returned for share links that are forged, malformed,
+// expired or revoked, without telling which
+var errInvalidShare = errors.New("invalid or expired share link")
+
+// SharePayload asks for a link to Target, a path of a shareable route with
+// its query, e.g. /logs?q=level:error
+type SharePayload struct {
+	Target     string `json:"target"`
+	TTLSeconds int    `json:"ttl_seconds,omitempty"`
+	Note       string `json:"note,omitempty"`
+	CreatedBy  string `json:"created_by,omitempty"`
+}
+
+// CreateShareLink signs a link that lets whoever holds it read the target
+// without the admin key, for ttl_seconds, a day by default and a week at most.
+// The link is the target with a share parameter; the recipient can page
+// through its results but not change its query.
+func (app *Config) CreateShareLink(w http.ResponseWriter, r *http.Request) {
+	var requestPayload SharePayload
+
+	if err := app.readJson(w, r, &requestPayload); err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	target, err := url.Parse(requestPayload.Target)
+	if err != nil || target.IsAbs() || !strings.HasPrefix(target.Path, "/") {
+		app.errorJson(w, errors.New("target must be a path, e.g. /logs?q=level:error"))
+		return
+	}
+	if !app.shareable(target.Path) {
+		app.errorJson(w, fmt.Errorf("%s can not be shared", target.Path))
+		return
+	}
+
+	ttl := time.Duration(requestPayload.TTLSeconds) * time.Second
+	if ttl == 0 {
+		ttl = defaultShareTTL
+	}
+	if ttl < 0 || ttl > maxShareTTL {
+		app.errorJson(w, fmt.Errorf("ttl_seconds must be between 1 and %d", int(maxShareTTL/time.Second)))
+		return
+	}
+
+	key, err := app.Keys.Signing(keystore.PurposeShares)
+	if err != nil {
+		app.errorJson(w, errors.New("no share link key, set SHARE_LINK_SECRET"), http.StatusConflict)
+		return
+	}
+
+	now := time.Now()
+	link := data.ShareLink{
+		ID:        signing.NewID(),
+		Target:    shareTarget(target),
+		Note:      requestPayload.Note,
+		CreatedBy: requestPayload.CreatedBy,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl).Truncate(time.Second),
+	}
+	if link.CreatedBy == "" {
+		link.CreatedBy = "admin"
+	}
+
+	if err := app.Models.Share.Insert(link); err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("%s shared %s until %s as link %s", link.CreatedBy, link.Target, link.ExpiresAt.Format(time.RFC3339), link.ID)
+
+	app.writeJson(w, http.StatusCreated, jsonReponse{
+		Error:   false,
+		Message: "share link created",
+		Data: map[string]any{
+			"link": link,
+			"url":  app.ShareBaseURL + shareURL(link, key),
+		},
+	})
+}
+
+// ListShareLinks returns the links that have not expired, revoked ones included
+func (app *Config) ListShareLinks(w http.ResponseWriter, r *http.Request) {
+	links, err := app.Models.Share.All()
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: fmt.Sprintf("%d share links", len(links)),
+		Data:    links,
+	})
+}
+
+// RevokeShareLink stops a link from working at once
+func (app *Config) RevokeShareLink(w http.ResponseWriter, r *http.Request) {
+	link, err := app.Models.Share.Revoke(chi.URLParam(r, "id"))
+	if errors.Is(err, data.ErrShareNotFound) {
+		app.errorJson(w, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Share link %s of %s revoked", link.ID, link.Target)
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: "share link revoked",
+		Data:    link,
+	})
+}
+
+// requireAdminOrShare lets through the requests requireAdmin does and those
+// carrying a share link for their path and query in ?share=. The link is the
+// caller of the request, see callerOf.
+func (app *Config) requireAdminOrShare(next http.Handler) http.Handler {
+	admin := app.requireAdmin(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("share")
+		if token == "" {
+			admin.ServeHTTP(w, r)
+			return
+		}
+
+		if err := app.checkShareLink(r, token); err != nil {
+			if !errors.Is(err, errInvalidShare) {
+				log.Println("Error checking share link:", err)
+				app.errorJson(w, err, http.StatusInternalServerError)
+				return
+			}
+			app.errorJson(w, err, http.StatusForbidden)
+			return
+		}
+
+		id, _, _ := strings.Cut(token, ".")
+		ctx := context.WithValue(r.Context(), callerKey, "share:"+id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// checkShareLink verifies the signature and expiry of a share token against
+// the request, then that the link was not revoked
+func (app *Config) checkShareLink(r *http.Request, token string) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 4 {
+		return errInvalidShare
+	}
+	id, expires, keyID, signature := parts[0], parts[1], parts[2], parts[3]
+
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return errInvalidShare
+	}
+
+	key, err := app.Keys.Lookup(keystore.PurposeShares, keyID)
+	if err != nil {
+		return errInvalidShare
+	}
+
+	target := shareTarget(r.URL)
+	if !hmac.Equal([]byte(signature), []byte(signShare(key.Secret, id, expires, target))) {
+		return errInvalidShare
+	}
+
+	link, err := app.Models.Share.Use(r.Context(), id)
+	if errors.Is(err, data.ErrShareNotFound) {
+		return errInvalidShare
+	}
+	if err != nil {
+		return err
+	}
+	if link.Target != target {
+		return errInvalidShare
+	}
+
+	return nil
+}
+
+// shareURL returns the target of a link with its signed token
+//
+//	?share=<id>.<expiry>.<key id>.<base64 hmac-sha256 of id, expiry and target>
+func shareURL(link data.ShareLink, key keystore.Key) string {
+	expires := strconv.FormatInt(link.ExpiresAt.Unix(), 10)
+	token := strings.Join([]string{link.ID, expires, key.ID, signShare(key.Secret, link.ID, expires, link.Target)}, ".")
+
+	separator := "?"
+	if strings.Contains(link.Target, "?") {
+		separator = "&"
+	}
+	return link.Target + separator + url.Values{"share": {token}}.Encode()
+}
+
+func signShare(secret []byte, id, expires, target string) string {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(id + "|" + expires + "|" + target))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// shareTarget is the path and query a link is signed for. The share token is
+// left out, and so is the cursor, so the recipient can follow the pages.
+func shareTarget(u *url.URL) string {
+	query := u.Query()
+	query.Del("share")
+	query.Del("cursor")
+
+	if len(query) == 0 {
+		return u.Path
+	}
+	return u.Path + "?" + query.Encode()
+}
+
+// shareable tells if path is the path of a GET route that may be shared
+func (app *Config) shareable(path string) bool {
+	mux := chi.NewRouter()
+	for _, rt := range app.routeTable() {
+		if rt.share && rt.method == "GET" {
+			mux.Method(rt.method, rt.path, rt.handler)
+		}
+	}
+
+	return mux.Match(chi.NewRouteContext(), "GET", path)
+}
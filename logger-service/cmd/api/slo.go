@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"logger/alert"
+	"logger/data"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// burnAlerts are the multiwindow burn-rate rules: an alert fires when both the
+// long and the short window burn faster than the rate
+var burnAlerts = []struct {
+	long, short time.Duration
+	rate        float64
+	severity    string
+}{
+	{time.Hour, 5 * time.Minute, 14.4, alert.Critical},
+	{6 * time.Hour, 30 * time.Minute, 6, alert.Warning},
+}
+
+func (app *Config) objective(service string) (data.Objective, bool) {
+	for _, o := range app.Alerting.get().Objectives {
+		if o.Service == service {
+			return o, true
+		}
+	}
+	return data.Objective{}, false
+}
+
+func (app *Config) sloReport(o data.Objective) (data.SLOReport, error) {
+	window := app.Alerting.get().SLOWindow
+
+	stats, err := app.Models.SLOSample.Sum(o.Service, time.Now().Add(-window))
+	if err != nil {
+		return data.SLOReport{}, err
+	}
+
+	return o.Report(stats, window), nil
+}
+
+// ListSLOs reports every objective over the SLO window
+func (app *Config) ListSLOs(w http.ResponseWriter, r *http.Request) {
+	var reports []data.SLOReport
+
+	for _, o := range app.Alerting.get().Objectives {
+		report, err := app.sloReport(o)
+		if err != nil {
+			app.errorJson(w, err, http.StatusInternalServerError)
+			return
+		}
+		reports = append(reports, report)
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: "slo",
+		Data:    reports,
+	})
+}
+
+// GetSLO reports one service, with the stored error budgets of the last
+// ?history= period (24h by default)
+func (app *Config) GetSLO(w http.ResponseWriter, r *http.Request) {
+	o, ok := app.objective(chi.URLParam(r, "service"))
+	if !ok {
+		app.errorJson(w, errors.New("no SLO for that service"), http.StatusNotFound)
+		return
+	}
+
+	history := 24 * time.Hour
+	if v := r.URL.Query().Get("history"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			app.errorJson(w, err)
+			return
+		}
+		history = d
+	}
+
+	report, err := app.sloReport(o)
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	budgets, err := app.Models.SLOReport.BudgetHistory(o.Service, time.Now().Add(-history))
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: "slo",
+		Data: map[string]any{
+			"current": report,
+			"history": budgets,
+		},
+	})
+}
+
+// evaluateSLOs stores the error budgets and checks the burn rates every
+// interval, on one replica at a time
+func (app *Config) evaluateSLOs(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lease := app.newLease("slos", interval+30*time.Second)
+
+	for range ticker.C {
+		if !lease.hold() {
+			continue
+		}
+
+		for _, o := range app.Alerting.get().Objectives {
+			report, err := app.sloReport(o)
+			if err != nil {
+				log.Printf("Error computing SLO of %s: %v", o.Service, err)
+				continue
+			}
+
+			if err := report.StoreBudget(); err != nil {
+				log.Printf("Error storing error budget of %s: %v", o.Service, err)
+			}
+
+			app.checkBurnRates(o)
+		}
+	}
+}
+
+func (app *Config) checkBurnRates(o data.Objective) {
+	now := time.Now()
+
+	for _, rule := range burnAlerts {
+		long, err := app.Models.SLOSample.Sum(o.Service, now.Add(-rule.long))
+		if err != nil {
+			log.Printf("Error reading SLO samples of %s: %v", o.Service, err)
+			return
+		}
+
+		short, err := app.Models.SLOSample.Sum(o.Service, now.Add(-rule.short))
+		if err != nil {
+			log.Printf("Error reading SLO samples of %s: %v", o.Service, err)
+			return
+		}
+
+		longAvail, longLatency := o.BurnRates(long)
+		shortAvail, shortLatency := o.BurnRates(short)
+
+		if longAvail > rule.rate && shortAvail > rule.rate {
+			app.fireBurnAlert(o, "availability", rule.severity, longAvail, rule.long)
+		}
+		if longLatency > rule.rate && shortLatency > rule.rate {
+			app.fireBurnAlert(o, "latency", rule.severity, longLatency, rule.long)
+		}
+	}
+}
+
+func (app *Config) fireBurnAlert(o data.Objective, kind, severity string, rate float64, window time.Duration) {
+	app.Alerts.Fire(context.Background(), alert.Alert{
+		Name:     fmt.Sprintf("slo_burn.%s.%s.%s", o.Service, kind, severity),
+		Severity: severity,
+		Summary:  fmt.Sprintf("%s is burning its %s error budget %.1fx too fast over the last %s", o.Service, kind, rate, window),
+		Labels: map[string]string{
+			"service": o.Service,
+			"slo":     kind,
+		},
+	})
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"logger/data"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	streamKeepAlive = 15 * time.Second
+	streamWriteWait = 10 * time.Second
+)
+
+var streamUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+	// access is granted by the admin key, not the origin
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// streamMessage is a message of the WebSocket stream
+type streamMessage struct {
+	Type  string         `json:"type"`
+	ID    string         `json:"id,omitempty"`
+	Entry *data.LogEntry `json:"entry,omitempty"`
+	Error string         `json:"error,omitempty"`
+}
+
+// StreamLogs tails the new entries, as server-sent events or, when the client
+// asks to upgrade, over a WebSocket. The filters
+//
+//	level=<level>,...       entries of these levels
+//	service=<service>,...   entries of these services
+//
+// narrow the stream. Every entry carries its id; a client that reconnects
+// with it, in Last-Event-ID or ?after=, gets the entries it missed first.
+func (app *Config) StreamLogs(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	var filter data.StreamFilter
+	for _, v := range splitList(params.Get("level")) {
+		level, err := data.NormalizeLevel(v)
+		if err != nil {
+			app.errorJson(w, err)
+			return
+		}
+		filter.Levels = append(filter.Levels, level)
+	}
+	filter.Services = splitList(params.Get("service"))
+
+	after := r.Header.Get("Last-Event-ID")
+	if after == "" {
+		after = params.Get("after")
+	}
+
+	// the stream ends at shutdown, the client reconnects to another replica
+	ctx, cancel := app.Lifecycle.StreamContext(r.Context())
+	defer cancel()
+
+	stream, err := app.Models.LogEntry.Stream(ctx, filter, after)
+	if errors.Is(err, data.ErrInvalidCursor) {
+		app.errorJson(w, errors.New("invalid entry id to resume after"))
+		return
+	}
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if websocket.IsWebSocketUpgrade(r) {
+		app.streamWebSocket(ctx, w, r, stream)
+		return
+	}
+	app.streamEvents(ctx, w, stream)
+}
+
+// streamEvents sends the stream as server-sent events
+func (app *Config) streamEvents(ctx context.Context, w http.ResponseWriter, stream *data.LogStream) {
+	rc := http.NewResponseController(w)
+
+	// streams stay open far longer than the server's write timeout
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprint(w, "retry: 3000\n: streaming logs\n\n")
+	if err := rc.Flush(); err != nil {
+		stream.Close(context.Background())
+		return
+	}
+
+	entries, errs := nextEntries(ctx, stream)
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-errs:
+			log.Println("Error streaming logs:", err)
+			fmt.Fprintf(w, "event: error\ndata: %q\n\n", err.Error())
+			rc.Flush()
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case entry := <-entries:
+			raw, _ := json.Marshal(entry)
+			fmt.Fprintf(w, "id: %s\nevent: log\ndata: %s\n\n", entry.ID, raw)
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// streamWebSocket sends the stream as JSON messages over a WebSocket. Clients
+// send nothing; reading only tells when they close.
+func (app *Config) streamWebSocket(ctx context.Context, w http.ResponseWriter, r *http.Request, stream *data.LogStream) {
+	conn, err := streamUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		stream.Close(context.Background())
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	conn.SetReadLimit(512)
+	conn.SetReadDeadline(time.Now().Add(2 * streamKeepAlive))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * streamKeepAlive))
+	})
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	entries, errs := nextEntries(ctx, stream)
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+
+		var err error
+		select {
+		case <-ctx.Done():
+			// the client left, or the server shuts down and it reconnects
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""))
+			return
+		case streamErr := <-errs:
+			log.Println("Error streaming logs:", streamErr)
+			conn.WriteJSON(streamMessage{Type: "error", Error: streamErr.Error()})
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseInternalServerErr, ""))
+			return
+		case <-keepAlive.C:
+			err = conn.WriteMessage(websocket.PingMessage, nil)
+		case entry := <-entries:
+			err = conn.WriteJSON(streamMessage{Type: "log", ID: entry.ID, Entry: entry})
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// nextEntries reads the stream until ctx is done or it fails, then closes it
+func nextEntries(ctx context.Context, stream *data.LogStream) (<-chan *data.LogEntry, <-chan error) {
+	entries := make(chan *data.LogEntry)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer stream.Close(context.Background())
+
+		for {
+			entry, err := stream.Next(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					errs <- err
+				}
+				return
+			}
+
+			select {
+			case entries <- entry:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return entries, errs
+}
+
+// splitList splits a comma separated parameter, dropping empty items
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
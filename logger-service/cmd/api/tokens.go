@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// defaultRotationGrace is how long the old token keeps working after a rotation
+const defaultRotationGrace = time.Hour
+
+type IssueTokenPayload struct {
+	Producer string `json:"producer"`
+}
+
+type RotateTokenPayload struct {
+	GraceSeconds int `json:"grace_seconds"`
+}
+
+type issuedToken struct {
+	Token any    `json:"token"`
+	Value string `json:"value"`
+}
+
+// ListTokens returns all ingest tokens without their values
+func (app *Config) ListTokens(w http.ResponseWriter, r *http.Request) {
+	tokens, err := app.Models.IngestToken.AllTokens()
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: "ingest tokens",
+		Data:    tokens,
+	})
+}
+
+// IssueToken creates a token for a producer. The value is only returned here.
+func (app *Config) IssueToken(w http.ResponseWriter, r *http.Request) {
+	var requestPayload IssueTokenPayload
+
+	err := app.readJson(w, r, &requestPayload)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	if requestPayload.Producer == "" {
+		app.errorJson(w, errors.New("producer is required"))
+		return
+	}
+
+	token, plain, err := app.Models.IngestToken.Issue(requestPayload.Producer)
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJson(w, http.StatusCreated, jsonReponse{
+		Error:   false,
+		Message: "token issued",
+		Data:    issuedToken{Token: token, Value: plain},
+	})
+}
+
+// RotateToken issues a replacement token and keeps the old one valid for a grace period
+func (app *Config) RotateToken(w http.ResponseWriter, r *http.Request) {
+	var requestPayload RotateTokenPayload
+
+	if r.ContentLength > 0 {
+		err := app.readJson(w, r, &requestPayload)
+		if err != nil {
+			app.errorJson(w, err)
+			return
+		}
+	}
+
+	grace := defaultRotationGrace
+	if requestPayload.GraceSeconds > 0 {
+		grace = time.Duration(requestPayload.GraceSeconds) * time.Second
+	}
+
+	token, plain, err := app.Models.IngestToken.Rotate(chi.URLParam(r, "id"), grace)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	app.writeJson(w, http.StatusCreated, jsonReponse{
+		Error:   false,
+		Message: "token rotated",
+		Data:    issuedToken{Token: token, Value: plain},
+	})
+}
+
+// RevokeToken disables a token immediately
+func (app *Config) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	err := app.Models.IngestToken.Revoke(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	app.writeJson(w, http.StatusAccepted, jsonReponse{
+		Error:   false,
+		Message: "token revoked",
+	})
+}
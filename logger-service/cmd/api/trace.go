@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"logger/data"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// TraceLinks holds the URLs between logs and the tracing backend. The
+// templates replace {trace_id}.
+type TraceLinks struct {
+	// QueryURL returns the spans of a trace as JSON, e.g. the Jaeger or Tempo
+	// API at http://jaeger:16686/api/traces/{trace_id}
+	QueryURL string
+
+	// UIURL opens a trace in the tracing UI
+	UIURL string
+
+	// LogsURL is where the tracing UI links back to the entries of a trace
+	LogsURL string
+}
+
+func (t TraceLinks) expand(tmpl, traceID string) string {
+	if tmpl == "" {
+		return ""
+	}
+	return strings.ReplaceAll(tmpl, "{trace_id}", url.PathEscape(traceID))
+}
+
+// TraceLogs returns the entries of one trace, with the span tree from the
+// tracing backend when one is configured
+func (app *Config) TraceLogs(w http.ResponseWriter, r *http.Request) {
+	traceID := strings.ToLower(chi.URLParam(r, "id"))
+	if !data.ValidTraceID(traceID) {
+		app.errorJson(w, errors.New("invalid trace id"))
+		return
+	}
+
+	entries, err := app.Models.LogEntry.ByTrace(traceID)
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	result := map[string]any{
+		"trace_id": traceID,
+		"entries":  entries,
+	}
+
+	if link := app.Traces.expand(app.Traces.UIURL, traceID); link != "" {
+		result["trace_url"] = link
+	}
+	if link := app.Traces.expand(app.Traces.LogsURL, traceID); link != "" {
+		result["logs_url"] = link
+	}
+
+	if app.Traces.QueryURL != "" {
+		spans, err := app.fetchTrace(r.Context(), traceID)
+		if err != nil {
+			// the logs are still useful without the spans
+			log.Printf("Error fetching trace %s: %v", traceID, err)
+			result["spans_error"] = err.Error()
+		} else {
+			result["spans"] = spans
+		}
+	}
+
+	app.writeJson(w, http.StatusOK, jsonReponse{
+		Error:   false,
+		Message: "trace",
+		Data:    result,
+	})
+}
+
+func (app *Config) fetchTrace(ctx context.Context, traceID string) (json.RawMessage, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, "GET", app.Traces.expand(app.Traces.QueryURL, traceID), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "application/json")
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tracing backend answered %d", response.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, 8<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	if !json.Valid(body) {
+		return nil, errors.New("tracing backend did not answer JSON")
+	}
+
+	return body, nil
+}
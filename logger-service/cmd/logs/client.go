@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// entry is a log entry as returned by logger-service
+type entry struct {
+	ID        string    `json:"id"`
+	Seq       int64     `json:"seq,omitempty"`
+	Name      string    `json:"name"`
+	Data      string    `json:"data"`
+	Producer  string    `json:"producer,omitempty"`
+	Service   string    `json:"service,omitempty"`
+	Level     string    `json:"level,omitempty"`
+	TraceID   string    `json:"trace_id,omitempty"`
+	UserID    string    `json:"user_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+type response struct {
+	Error   bool            `json:"error"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+type client struct {
+	loggerURL string
+	key       string
+}
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// downloadClient has no timeout, archives take as long as they take
+var downloadClient = &http.Client{}
+
+func (c *client) do(method, url string, body any, out any) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	request, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("X-Admin-Key", c.key)
+	request.Header.Set("Accept", "application/json")
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	var payload response
+	if err := json.NewDecoder(res.Body).Decode(&payload); err != nil {
+		return fmt.Errorf("%s %s: %s", method, url, res.Status)
+	}
+
+	if payload.Error || res.StatusCode >= 400 {
+		return errors.New(payload.Message)
+	}
+
+	if out != nil {
+		return json.Unmarshal(payload.Data, out)
+	}
+	return nil
+}
+
+// search returns the entries matching a query, newest first
+func (c *client) search(query string, limit int) ([]entry, error) {
+	params := url.Values{}
+	params.Set("q", query)
+	params.Set("limit", strconv.Itoa(limit))
+
+	var entries []entry
+	err := c.do("GET", c.loggerURL+"/logs?"+params.Encode(), nil, &entries)
+
+	return entries, err
+}
+
+// download fetches a backup archive to path. The bytes are written to
+// path+".part" with the ETag of the archive next to them, so a download that
+// broke off continues where it stopped as long as the archive is the same;
+// an archive that changed is fetched again from the start.
+func (c *client) download(name, path string) error {
+	part := path + ".part"
+
+	f, err := os.OpenFile(part, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest("GET", c.loggerURL+"/admin/backups/"+url.PathEscape(name), nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("X-Admin-Key", c.key)
+
+	etag, _ := os.ReadFile(part + ".etag")
+	if offset > 0 && len(etag) > 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		request.Header.Set("If-Range", string(etag))
+	}
+
+	res, err := downloadClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		if err := f.Truncate(0); err != nil {
+			return err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if err := os.WriteFile(part+".etag", []byte(res.Header.Get("ETag")), 0o644); err != nil {
+			return err
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// the part already holds the whole archive
+	default:
+		var payload response
+		if json.NewDecoder(res.Body).Decode(&payload) == nil && payload.Message != "" {
+			return errors.New(payload.Message)
+		}
+		return fmt.Errorf("GET %s: %s", request.URL, res.Status)
+	}
+
+	if res.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		if _, err := io.Copy(f, res.Body); err != nil {
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	os.Remove(part + ".etag")
+	return os.Rename(part, path)
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	colorReset  = "\033[0m"
+	colorRed    = "\033[31m"
+	colorYellow = "\033[33m"
+	colorBlue   = "\033[34m"
+	colorGray   = "\033[90m"
+)
+
+// printer writes entries one per line, colored by level on a terminal
+type printer struct {
+	color bool
+}
+
+func newPrinter(opts options) printer {
+	info, err := os.Stdout.Stat()
+	terminal := err == nil && info.Mode()&os.ModeCharDevice != 0
+
+	return printer{color: terminal && !opts.noColor}
+}
+
+func (p printer) paint(color, s string) string {
+	if !p.color {
+		return s
+	}
+	return color + s + colorReset
+}
+
+func (p printer) print(e entry) {
+	level := e.Level
+	if level == "" {
+		level = "-"
+	}
+
+	switch level {
+	case "error", "fatal", "panic", "critical":
+		level = p.paint(colorRed, level)
+	case "warn", "warning":
+		level = p.paint(colorYellow, level)
+	case "debug":
+		level = p.paint(colorGray, level)
+	default:
+		level = p.paint(colorBlue, level)
+	}
+
+	service := e.Service
+	if service == "" {
+		service = e.Producer
+	}
+
+	fmt.Printf("%s %-8s %s %s %s%s\n",
+		p.paint(colorGray, e.CreatedAt.Local().Format("2006-01-02 15:04:05")),
+		level,
+		p.paint(colorGray, service),
+		e.Name,
+		e.Data,
+		p.paint(colorGray, formatFields(e.Fields)),
+	)
+}
+
+// formatFields writes fields as " key=value ...", sorted by key
+func formatFields(fields map[string]string) string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&b, " %s=%s", key, strconv.Quote(fields[key]))
+	}
+
+	return b.String()
+}
+
+func runQuery(c *client, opts options) error {
+	entries, err := c.search(searchQuery(opts), opts.limit)
+	if err != nil {
+		return err
+	}
+
+	p := newPrinter(opts)
+
+	// the newest entry is printed last, like tail
+	for i := len(entries) - 1; i >= 0; i-- {
+		p.print(entries[i])
+	}
+
+	return nil
+}
+
+func runExport(c *client, opts options) error {
+	entries, err := c.search(searchQuery(opts), opts.limit)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if opts.output != "" {
+		f, err := os.Create(opts.output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	switch opts.format {
+	case "jsonl":
+		enc := json.NewEncoder(w)
+		for _, e := range entries {
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+		}
+	case "csv":
+		cw := csv.NewWriter(w)
+		_ = cw.Write([]string{"id", "seq", "created_at", "producer", "service", "level", "name", "data", "trace_id", "user_id"})
+		for _, e := range entries {
+			_ = cw.Write([]string{
+				e.ID,
+				strconv.FormatInt(e.Seq, 10),
+				e.CreatedAt.UTC().Format(time.RFC3339Nano),
+				e.Producer,
+				e.Service,
+				e.Level,
+				e.Name,
+				e.Data,
+				e.TraceID,
+				e.UserID,
+			})
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown format %q", opts.format)
+	}
+
+	if opts.output != "" {
+		log.Printf("Exported %d entries to %s", len(entries), opts.output)
+	}
+
+	return nil
+}
+
+// runBackup downloads the archive named by the first argument, trying again
+// from where it stopped when the connection drops
+func runBackup(c *client, opts options) error {
+	if len(opts.args) != 1 {
+		return errors.New("usage: logs backup [flags] <name>")
+	}
+	name := opts.args[0]
+
+	output := opts.output
+	if output == "" {
+		output = name
+	}
+
+	var err error
+	for attempt := 1; attempt <= 5; attempt++ {
+		if err = c.download(name, output); err == nil {
+			log.Printf("Downloaded %s to %s", name, output)
+			return nil
+		}
+
+		log.Printf("Download of %s stopped, resuming: %v", name, err)
+		time.Sleep(time.Duration(attempt) * 2 * time.Second)
+	}
+
+	return err
+}
+
+// streamMessage is a message of the WebSocket of /logs/stream
+type streamMessage struct {
+	Type  string `json:"type"`
+	ID    string `json:"id"`
+	Entry entry  `json:"entry"`
+	Error string `json:"error"`
+}
+
+// runTail follows the stream of the logger and reconnects when the connection
+// drops, resuming after the last entry printed. Level and service are filtered
+// by the logger, the other filters here.
+func runTail(c *client, opts options) error {
+	var grep *regexp.Regexp
+	if opts.grep != "" {
+		var err error
+		if grep, err = regexp.Compile(opts.grep); err != nil {
+			return err
+		}
+	}
+
+	match := func(e entry) bool {
+		return (opts.name == "" || e.Name == opts.name) &&
+			(grep == nil || grep.MatchString(e.Data))
+	}
+
+	params := url.Values{}
+	if opts.level != "" {
+		params.Set("level", opts.level)
+	}
+	if opts.service != "" {
+		params.Set("service", opts.service)
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+
+	p := newPrinter(opts)
+
+	var last string
+	for {
+		err := tailOnce(c, p, params, match, &last, interrupt)
+		if err == nil {
+			return nil
+		}
+
+		log.Println("Connection lost, reconnecting:", err)
+
+		select {
+		case <-interrupt:
+			return nil
+		case <-time.After(3 * time.Second):
+		}
+	}
+}
+
+func tailOnce(c *client, p printer, params url.Values, match func(entry) bool, last *string, interrupt chan os.Signal) error {
+	u, err := url.Parse(c.loggerURL + "/logs/stream")
+	if err != nil {
+		return err
+	}
+	u.Scheme = strings.Replace(u.Scheme, "http", "ws", 1)
+
+	query := url.Values{}
+	for key, values := range params {
+		query[key] = values
+	}
+	if *last != "" {
+		query.Set("after", *last)
+	}
+	u.RawQuery = query.Encode()
+
+	conn, _, err := websocket.DefaultDialer.Dial(u.String(), http.Header{"X-Admin-Key": {c.key}})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	errs := make(chan error, 1)
+
+	go func() {
+		for {
+			var message streamMessage
+			if err := conn.ReadJSON(&message); err != nil {
+				errs <- err
+				return
+			}
+
+			if message.Type == "error" {
+				log.Println("Logger:", message.Error)
+				continue
+			}
+
+			*last = message.ID
+			if match(message.Entry) {
+				p.print(message.Entry)
+			}
+		}
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-interrupt:
+		_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		return nil
+	}
+}
@@ -0,0 +1,128 @@
+// Command logs queries, tails and exports entries of logger-service.
+//
+//	logs query  [flags]   print the latest matching entries
+//	logs tail   [flags]   follow new entries as the logger stores them
+//	logs export [flags]   write matching entries as JSON lines or CSV
+//	logs backup [flags] <name>
+//	                      download a backup archive, resuming broken downloads
+//
+// Every command authenticates with the admin API key from -key or ADMIN_API_KEY.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+type options struct {
+	loggerURL string
+	key       string
+
+	query   string
+	level   string
+	service string
+	name    string
+	grep    string
+	limit   int
+
+	format  string
+	output  string
+	noColor bool
+
+	// args are the arguments after the flags
+	args []string
+}
+
+func main() {
+	log.SetFlags(0)
+
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	command := os.Args[1]
+
+	var opts options
+
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	fs.StringVar(&opts.loggerURL, "logger", envOr("LOGGER_URL", "http://localhost:8083"), "logger-service URL")
+	fs.StringVar(&opts.key, "key", os.Getenv("ADMIN_API_KEY"), "admin API key")
+	fs.StringVar(&opts.query, "q", "", `query, e.g. level:error AND data:~"timeout" (not used by tail)`)
+	fs.StringVar(&opts.level, "level", "", "only entries of this level")
+	fs.StringVar(&opts.service, "service", "", "only entries of this service")
+	fs.StringVar(&opts.name, "name", "", "only entries with this name")
+	fs.StringVar(&opts.grep, "grep", "", "only entries whose data matches this regular expression")
+	fs.IntVar(&opts.limit, "limit", 100, "maximum number of entries (1-1000)")
+	fs.StringVar(&opts.format, "format", "jsonl", "export format, jsonl or csv")
+	fs.StringVar(&opts.output, "o", "", "export file, stdout when empty; for backup the archive file, its name when empty")
+	fs.BoolVar(&opts.noColor, "no-color", os.Getenv("NO_COLOR") != "", "disable colors")
+	_ = fs.Parse(os.Args[2:])
+	opts.args = fs.Args()
+
+	if opts.key == "" {
+		log.Fatal("an admin API key is required, use -key or ADMIN_API_KEY")
+	}
+
+	c := &client{loggerURL: strings.TrimRight(opts.loggerURL, "/"), key: opts.key}
+
+	var err error
+
+	switch command {
+	case "query":
+		err = runQuery(c, opts)
+	case "tail":
+		err = runTail(c, opts)
+	case "export":
+		err = runExport(c, opts)
+	case "backup":
+		err = runBackup(c, opts)
+	default:
+		usage()
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: logs query|tail|export|backup [flags]")
+	os.Exit(2)
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// searchQuery combines -q with the filter flags in the logger's query language
+func searchQuery(opts options) string {
+	var terms []string
+
+	if opts.query != "" {
+		terms = append(terms, "("+opts.query+")")
+	}
+	if opts.level != "" {
+		terms = append(terms, "level:"+quote(opts.level))
+	}
+	if opts.service != "" {
+		terms = append(terms, "service:"+quote(opts.service))
+	}
+	if opts.name != "" {
+		terms = append(terms, "name:"+quote(opts.name))
+	}
+	if opts.grep != "" {
+		terms = append(terms, "data:~"+quote(opts.grep))
+	}
+
+	return strings.Join(terms, " AND ")
+}
+
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
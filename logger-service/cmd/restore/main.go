@@ -0,0 +1,73 @@
+// Command restore validates a log backup archive and replays it into Mongo.
+// Use -dry-run to only validate the archive, and -write-once against a store
+// in write-once mode: entries already in it are then skipped, not replaced.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"logger/data"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func main() {
+	file := flag.String("file", "", "path of the .jsonl.gz archive to restore")
+	mongoURL := flag.String("mongo", "mongodb://localhost:27017", "Mongo URL")
+	username := flag.String("username", "admin", "Mongo user")
+	password := flag.String("password", "password", "Mongo password")
+	dryRun := flag.Bool("dry-run", false, "validate the archive without writing")
+	writeOnce := flag.Bool("write-once", os.Getenv("LOG_WRITE_ONCE") == "true", "only insert, skip documents that are already stored")
+	flag.Parse()
+
+	if *file == "" {
+		log.Fatal("-file is required")
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Hour)
+	defer cancel()
+
+	clientOption := options.Client().ApplyURI(*mongoURL)
+	clientOption.SetAuth(options.Credential{
+		Username: *username,
+		Password: *password,
+	})
+
+	client, err := mongo.Connect(ctx, clientOption)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Disconnect(context.Background())
+
+	data.New(client)
+	data.SetWriteOnce(*writeOnce)
+
+	report, err := data.RestoreArchive(ctx, f, *dryRun)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for name, count := range report.Documents {
+		log.Printf("%s: %d documents", name, count)
+	}
+	for name, count := range report.Skipped {
+		log.Printf("%s: %d documents already stored, skipped", name, count)
+	}
+
+	if *dryRun {
+		log.Println("Archive is valid, nothing was written")
+		return
+	}
+
+	log.Println("Restore complete")
+}
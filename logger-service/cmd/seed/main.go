@@ -0,0 +1,82 @@
+// Command seed loads fixture log entries into Mongo for local development and
+// demos. Seeded entries carry the producer "seed"; running it again only tops
+// them up to the requested number.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"logger/data"
+	"math/rand"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const seedProducer = "seed"
+
+var fixtures = []struct {
+	name string
+	data string
+}{
+	{"authentication", "user%d@example.com logged in"},
+	{"authentication", "failed login for user%d@example.com"},
+	{"broker", "handled auth action in %dms"},
+	{"broker", "handled log action in %dms"},
+	{"event", "user %d registered"},
+	{"mail", "welcome mail queued for user %d"},
+}
+
+func main() {
+	mongoURL := flag.String("mongo", "mongodb://localhost:27017", "Mongo URL")
+	username := flag.String("username", "admin", "Mongo user")
+	password := flag.String("password", "password", "Mongo password")
+	count := flag.Int64("entries", 500, "number of fixture log entries")
+	flag.Parse()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	clientOption := options.Client().ApplyURI(*mongoURL)
+	clientOption.SetAuth(options.Credential{
+		Username: *username,
+		Password: *password,
+	})
+
+	client, err := mongo.Connect(ctx, clientOption)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Disconnect(context.Background())
+
+	existing, err := client.Database("logs").Collection("logs").CountDocuments(ctx, bson.M{"producer": seedProducer})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	models := data.New(client)
+
+	for i := existing; i < *count; i++ {
+		fixture := fixtures[i%int64(len(fixtures))]
+
+		err := models.LogEntry.Insert(data.LogEntry{
+			Name:     fixture.name,
+			Data:     fmt.Sprintf(fixture.data, rand.Intn(100)),
+			Producer: seedProducer,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	created := *count - existing
+	if created < 0 {
+		created = 0
+	}
+
+	log.Printf("Seeded log entries: %d created, %d already present", created, existing)
+}
@@ -0,0 +1,76 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxLinkedUsers bounds how many merged accounts one user can stand for
+const maxLinkedUsers = 100
+
+// UserAlias records that a user account was merged into another one. Entries
+// keep the user id they were written with, since it is part of their hash, and
+// lookups by user follow the aliases instead.
+type UserAlias struct {
+	From      string    `bson:"_id" json:"from"`
+	To        string    `bson:"to" json:"to"`
+	Producer  string    `bson:"producer" json:"producer"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
+
+// Link makes the entries of user from show up as entries of user to
+func (a *UserAlias) Link(from, to, producer string) error {
+	if from == "" || to == "" {
+		return errors.New("both users are required")
+	}
+	if from == to {
+		return errors.New("a user cannot be merged into itself")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database("logs").Collection("user_aliases")
+
+	_, err := collection.UpdateByID(ctx, from,
+		bson.M{"$set": bson.M{"to": to, "producer": producer, "created_at": time.Now().UTC()}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// linkedUserIDs returns the user and every account merged into it, directly
+// or through other merges
+func linkedUserIDs(ctx context.Context, userID string) ([]string, error) {
+	collection := client.Database("logs").Collection("user_aliases")
+
+	ids := []string{userID}
+	seen := map[string]bool{userID: true}
+
+	for frontier := []string{userID}; len(frontier) > 0 && len(ids) < maxLinkedUsers; {
+		cursor, err := collection.Find(ctx, bson.M{"to": bson.M{"$in": frontier}})
+		if err != nil {
+			return nil, err
+		}
+
+		var aliases []UserAlias
+		if err := cursor.All(ctx, &aliases); err != nil {
+			return nil, err
+		}
+
+		frontier = frontier[:0]
+		for _, alias := range aliases {
+			if !seen[alias.From] {
+				seen[alias.From] = true
+				ids = append(ids, alias.From)
+				frontier = append(frontier, alias.From)
+			}
+		}
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,230 @@
+package data
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// archiveVersion is written in the header of every archive
+const archiveVersion = 1
+
+// BackupCollections are the collections dumped when no list is given
+var BackupCollections = []string{"logs", "log_signatures", "ingest_tokens", "crashes", "issues"}
+
+// archiveHeader is the first line of an archive
+type archiveHeader struct {
+	Version     int       `json:"version"`
+	CreatedAt   time.Time `json:"created_at"`
+	Collections []string  `json:"collections"`
+}
+
+// archiveLine holds one document in canonical extended JSON, so types like
+// ObjectID and dates survive the round trip
+type archiveLine struct {
+	Collection string          `json:"c"`
+	Document   json.RawMessage `json:"d"`
+}
+
+// BackupInfo describes a stored archive. Archives never change once written,
+// their ETag lets a download be resumed with If-Range.
+type BackupInfo struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+	ETag      string    `json:"etag"`
+}
+
+// RestoreReport counts what a restore did, or would do in a dry run. In
+// write-once mode documents already in the store are left alone and counted
+// in Skipped.
+type RestoreReport struct {
+	DryRun    bool             `json:"dry_run"`
+	Documents map[string]int64 `json:"documents"`
+	Skipped   map[string]int64 `json:"skipped,omitempty"`
+}
+
+// Backup dumps the collections into a new archive in the store and returns its
+// name. progress, if not nil, is told about every collection that is started.
+func Backup(ctx context.Context, store BackupStore, collections []string, progress ProgressFunc) (string, error) {
+	if len(collections) == 0 {
+		collections = BackupCollections
+	}
+
+	name := fmt.Sprintf("logs-%s.jsonl.gz", time.Now().UTC().Format("20060102T150405Z"))
+
+	w, err := store.Create(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	defer w.Close()
+
+	if err := WriteArchive(ctx, w, collections, progress); err != nil {
+		return "", err
+	}
+
+	return name, w.Commit()
+}
+
+// WriteArchive writes a gzip compressed archive of the collections to w
+func WriteArchive(ctx context.Context, w io.Writer, collections []string, progress ProgressFunc) error {
+	gz := gzip.NewWriter(w)
+	enc := json.NewEncoder(gz)
+
+	err := enc.Encode(archiveHeader{
+		Version:     archiveVersion,
+		CreatedAt:   time.Now().UTC(),
+		Collections: collections,
+	})
+	if err != nil {
+		return err
+	}
+
+	for i, name := range collections {
+		if progress != nil {
+			progress(100*i/len(collections), "dumping "+name)
+		}
+
+		if err := dumpCollection(ctx, enc, name); err != nil {
+			return fmt.Errorf("dumping %s: %w", name, err)
+		}
+	}
+
+	return gz.Close()
+}
+
+func dumpCollection(ctx context.Context, enc *json.Encoder, name string) error {
+	collection := client.Database("logs").Collection(name)
+
+	cursor, err := collection.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		doc, err := bson.MarshalExtJSON(cursor.Current, true, false)
+		if err != nil {
+			return err
+		}
+
+		if err := enc.Encode(archiveLine{Collection: name, Document: doc}); err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
+
+// RestoreArchive validates an archive and replays its documents. Documents are
+// upserted by _id, so restoring the same archive twice is harmless. In
+// write-once mode nothing is replaced, documents are only inserted and those
+// whose _id is already taken are skipped. With dryRun the archive is only
+// validated and counted.
+func RestoreArchive(ctx context.Context, r io.Reader, dryRun bool) (*RestoreReport, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	if !scanner.Scan() {
+		return nil, errors.New("archive is empty")
+	}
+
+	var header archiveHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return nil, fmt.Errorf("invalid archive header: %w", err)
+	}
+
+	if header.Version != archiveVersion {
+		return nil, fmt.Errorf("unsupported archive version %d", header.Version)
+	}
+
+	allowed := make(map[string]bool)
+	for _, name := range header.Collections {
+		allowed[name] = true
+	}
+
+	report := &RestoreReport{DryRun: dryRun, Documents: make(map[string]int64)}
+	if writeOnce {
+		report.Skipped = make(map[string]int64)
+	}
+	lineNo := 1
+
+	for scanner.Scan() {
+		lineNo++
+
+		var line archiveLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return report, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+
+		if !allowed[line.Collection] {
+			return report, fmt.Errorf("line %d: collection %q is not listed in the header", lineNo, line.Collection)
+		}
+
+		var doc bson.D
+		if err := bson.UnmarshalExtJSON(line.Document, true, &doc); err != nil {
+			return report, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+
+		var id any
+		for _, field := range doc {
+			if field.Key == "_id" {
+				id = field.Value
+			}
+		}
+
+		if id == nil {
+			return report, fmt.Errorf("line %d: document has no _id", lineNo)
+		}
+
+		if !dryRun {
+			collection := client.Database("logs").Collection(line.Collection)
+
+			if writeOnce {
+				_, err := collection.InsertOne(ctx, doc)
+				if mongo.IsDuplicateKeyError(err) {
+					report.Skipped[line.Collection]++
+					continue
+				}
+				if err != nil {
+					return report, fmt.Errorf("line %d: %w", lineNo, err)
+				}
+			} else {
+				_, err := collection.ReplaceOne(ctx, bson.M{"_id": id}, doc, options.Replace().SetUpsert(true))
+				if err != nil {
+					return report, fmt.Errorf("line %d: %w", lineNo, err)
+				}
+			}
+		}
+
+		report.Documents[line.Collection]++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return report, err
+	}
+
+	if !dryRun && report.Documents["logs"] > 0 {
+		// the restored entries may have moved the head of the hash chain
+		chain.mu.Lock()
+		chain.loaded = false
+		chain.mu.Unlock()
+	}
+
+	return report, nil
+}
@@ -0,0 +1,170 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// BackupStore keeps the archives written by Backup. LocalBackups keeps them in
+// a directory, S3Backups in a bucket of S3 or of a store speaking its API.
+type BackupStore interface {
+	// Create starts a new archive, it is listed once committed
+	Create(ctx context.Context, name string) (BackupWriter, error)
+
+	// Open opens a committed archive for reading
+	Open(ctx context.Context, name string) (io.ReadSeekCloser, BackupInfo, error)
+
+	// List returns the committed archives, newest first
+	List(ctx context.Context) ([]BackupInfo, error)
+}
+
+// BackupWriter receives a new archive. Commit publishes it under its name,
+// Close without Commit throws it away, so a listed archive is always complete
+// and never changes under a download.
+type BackupWriter interface {
+	io.Writer
+	Commit() error
+	Close() error
+}
+
+// ErrBackupNotFound is returned for archives that are not in the store
+var ErrBackupNotFound = errors.New("backup not found")
+
+// validBackupName reports whether name can be an archive of a store, plain
+// names only so a name never reaches outside the store
+func validBackupName(name string) bool {
+	return name == filepath.Base(name) && strings.HasSuffix(name, ".jsonl.gz")
+}
+
+// LocalBackups keeps archives as files in a directory
+type LocalBackups struct {
+	Dir string
+}
+
+var _ BackupStore = LocalBackups{}
+
+func localBackupInfo(info fs.FileInfo) BackupInfo {
+	return BackupInfo{
+		Name:      info.Name(),
+		Size:      info.Size(),
+		CreatedAt: info.ModTime(),
+		ETag:      fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()),
+	}
+}
+
+// localWriter writes an archive under another name and renames it on commit
+type localWriter struct {
+	f         *os.File
+	part      string
+	name      string
+	committed bool
+}
+
+func (w *localWriter) Write(p []byte) (int, error) {
+	return w.f.Write(p)
+}
+
+func (w *localWriter) Commit() error {
+	if err := w.f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(w.part, w.name); err != nil {
+		return err
+	}
+	w.committed = true
+	return nil
+}
+
+func (w *localWriter) Close() error {
+	if w.committed {
+		return nil
+	}
+	w.f.Close()
+	return os.Remove(w.part)
+}
+
+// Create opens a new archive for writing
+func (s LocalBackups) Create(_ context.Context, name string) (BackupWriter, error) {
+	if !validBackupName(name) {
+		return nil, fmt.Errorf("invalid backup name %q", name)
+	}
+	if err := os.MkdirAll(s.Dir, 0o750); err != nil {
+		return nil, err
+	}
+
+	name = filepath.Join(s.Dir, name)
+
+	f, err := os.Create(name + ".part")
+	if err != nil {
+		return nil, err
+	}
+
+	return &localWriter{f: f, part: name + ".part", name: name}, nil
+}
+
+// Open opens a stored archive for reading, archives still being written are
+// not found
+func (s LocalBackups) Open(_ context.Context, name string) (io.ReadSeekCloser, BackupInfo, error) {
+	if !validBackupName(name) {
+		return nil, BackupInfo{}, ErrBackupNotFound
+	}
+
+	f, err := os.Open(filepath.Join(s.Dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, BackupInfo{}, ErrBackupNotFound
+	}
+	if err != nil {
+		return nil, BackupInfo{}, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, BackupInfo{}, err
+	}
+
+	return f, localBackupInfo(info), nil
+}
+
+// List returns the stored archives, newest first
+func (s LocalBackups) List(_ context.Context) ([]BackupInfo, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var backups []BackupInfo
+
+	for _, entry := range entries {
+		if entry.IsDir() || !validBackupName(entry.Name()) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		backups = append(backups, localBackupInfo(info))
+	}
+
+	sortBackups(backups)
+
+	return backups, nil
+}
+
+func sortBackups(backups []BackupInfo) {
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
+}
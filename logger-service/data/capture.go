@@ -0,0 +1,96 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// captureRetention is how long captured requests are kept
+const captureRetention = 7 * 24 * time.Hour
+
+// Capture is a sanitized request and response recorded by a service in
+// capture mode, to be replayed against another environment
+type Capture struct {
+	ID              string            `bson:"_id,omitempty" json:"id,omitempty"`
+	Service         string            `bson:"service" json:"service"`
+	Method          string            `bson:"method" json:"method"`
+	Path            string            `bson:"path" json:"path"`
+	Query           string            `bson:"query,omitempty" json:"query,omitempty"`
+	RequestHeaders  map[string]string `bson:"request_headers,omitempty" json:"request_headers,omitempty"`
+	RequestBody     string            `bson:"request_body,omitempty" json:"request_body,omitempty"`
+	Status          int               `bson:"status" json:"status"`
+	ResponseHeaders map[string]string `bson:"response_headers,omitempty" json:"response_headers,omitempty"`
+	ResponseBody    string            `bson:"response_body,omitempty" json:"response_body,omitempty"`
+	DurationMs      int64             `bson:"duration_ms" json:"duration_ms"`
+	CreatedAt       time.Time         `bson:"created_at" json:"created_at"`
+}
+
+// Insert stores a capture of the service
+func (c *Capture) Insert(capture Capture) error {
+	collection := client.Database("logs").Collection("captures")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	capture.ID = ""
+	capture.CreatedAt = time.Now().UTC()
+
+	_, err := collection.InsertOne(ctx, capture)
+	return err
+}
+
+// List returns the oldest captures first, so a replay keeps the original
+// order. Empty filters match everything.
+func (c *Capture) List(service, method, path string, since time.Time, limit int64) ([]*Capture, error) {
+	collection := client.Database("logs").Collection("captures")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	filter := bson.M{"created_at": bson.M{"$gte": since}}
+	if service != "" {
+		filter["service"] = service
+	}
+	if method != "" {
+		filter["method"] = method
+	}
+	if path != "" {
+		filter["path"] = path
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}).SetLimit(limit)
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var captures []*Capture
+	if err := cursor.All(ctx, &captures); err != nil {
+		return nil, err
+	}
+
+	return captures, nil
+}
+
+// ensureCaptureIndexes expires captures after captureRetention
+func ensureCaptureIndexes(ctx context.Context) error {
+	collection := client.Database("logs").Collection("captures")
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "created_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(captureRetention / time.Second)),
+		},
+		{
+			Keys: bson.D{{Key: "service", Value: 1}, {Key: "path", Value: 1}, {Key: "created_at", Value: 1}},
+		},
+	})
+
+	return err
+}
@@ -0,0 +1,503 @@
+package data
+
+import (
+	"context"
+	"contracts/keystore"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// chainState holds the tail of the hash chain. Every insert goes through it so that
+// entries get a contiguous sequence number and a link to the previous record.
+// Replicas writing to the same collection take turns through SetChainLock.
+type chainState struct {
+	mu       sync.Mutex
+	loaded   bool
+	lastSeq  int64
+	lastHash string
+}
+
+var chain chainState
+
+// chainLock, when set, is held around every append so that one replica at a
+// time extends the chain
+var chainLock func(ctx context.Context) (unlock func(), err error)
+
+// SetChainLock makes every append take lock first and read the head the other
+// replicas left. Without it the service must run as a single replica. It must
+// be called before entries are written.
+func SetChainLock(lock func(ctx context.Context) (unlock func(), err error)) {
+	chainLock = lock
+}
+
+// auditKeys and signEvery control the periodic checkpoint signatures written to
+// the log_signatures collection
+var (
+	auditKeys       = keystore.New()
+	signEvery int64 = 100
+)
+
+// Checkpoint is a signed record of the chain head at a given sequence number.
+// KeyID names the audit key that signed it; checkpoints written before keys
+// had ids have none.
+type Checkpoint struct {
+	ID        string    `bson:"_id,omitempty" json:"id,omitempty"`
+	Seq       int64     `bson:"seq" json:"seq"`
+	Hash      string    `bson:"hash" json:"hash"`
+	Signature string    `bson:"signature" json:"signature"`
+	KeyID     string    `bson:"key_id,omitempty" json:"key_id,omitempty"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
+
+// ChainProblem describes one inconsistency found while verifying the chain
+type ChainProblem struct {
+	Seq    int64  `json:"seq"`
+	ID     string `json:"id,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// ChainReport is the result of walking the whole chain. Pruned counts the
+// entries missing from it that retention or a purge removed.
+type ChainReport struct {
+	Valid       bool           `json:"valid"`
+	Entries     int64          `json:"entries"`
+	Pruned      int64          `json:"pruned,omitempty"`
+	Checkpoints int64          `json:"checkpoints"`
+	HeadSeq     int64          `json:"head_seq"`
+	HeadHash    string         `json:"head_hash"`
+	Problems    []ChainProblem `json:"problems,omitempty"`
+}
+
+// ConfigureAudit sets the keystore whose audit keys sign checkpoints and how
+// many entries are written between two checkpoints. Without audit keys there
+// are no checkpoint signatures, the hash chain itself is always maintained.
+// Checkpoints signed with a key that was revoked no longer verify, so audit
+// keys should be given no expiry.
+func ConfigureAudit(keys *keystore.Store, every int64) {
+	auditKeys = keys
+	if every > 0 {
+		signEvery = every
+	}
+}
+
+// digest returns the hex sha256 of a string
+func digest(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// dataDigest is the digest of the entry data that takes part in the chain hash.
+// Redacted entries no longer hold their data, so the digest recorded at
+// redaction time is used instead.
+func dataDigest(e LogEntry) string {
+	if e.Redacted {
+		return e.DataHash
+	}
+	return digest(e.Data)
+}
+
+// hashEntry computes the chain hash of an entry. The timestamp is formatted in
+// UTC with millisecond precision because that is what Mongo stores.
+func hashEntry(e LogEntry) string {
+	payload := struct {
+		Seq        int64             `json:"seq"`
+		PrevHash   string            `json:"prev_hash"`
+		Name       string            `json:"name"`
+		Data       string            `json:"data"`
+		Producer   string            `json:"producer,omitempty"`
+		Version    string            `json:"producer_version,omitempty"`
+		RedactedID string            `json:"redacted_id,omitempty"`
+		Level      string            `json:"level,omitempty"`
+		IssueID    string            `json:"issue_id,omitempty"`
+		Service    string            `json:"service,omitempty"`
+		Fields     map[string]string `json:"fields,omitempty"`
+		User       string            `json:"user,omitempty"`
+		TraceID    string            `json:"trace_id,omitempty"`
+		SpanID     string            `json:"span_id,omitempty"`
+		CreatedAt  string            `json:"created_at"`
+	}{
+		Seq:        e.Seq,
+		PrevHash:   e.PrevHash,
+		Name:       e.Name,
+		Data:       dataDigest(e),
+		Producer:   e.Producer,
+		Version:    e.ProducerVersion,
+		RedactedID: e.RedactedID,
+		Level:      e.Level,
+		IssueID:    e.IssueID,
+		Service:    e.Service,
+		Fields:     e.Fields,
+		User:       e.UserHash,
+		TraceID:    e.TraceID,
+		SpanID:     e.SpanID,
+		CreatedAt:  e.CreatedAt.UTC().Format("2006-01-02T15:04:05.000Z07:00"),
+	}
+
+	out, _ := json.Marshal(payload)
+	sum := sha256.Sum256(out)
+
+	return hex.EncodeToString(sum[:])
+}
+
+func sign(key keystore.Key, hash string) string {
+	mac := hmac.New(sha256.New, key.Secret)
+	mac.Write([]byte(hash))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyCheckpoint checks the signature of a checkpoint with the key it names,
+// or with any audit key for checkpoints without a key id
+func verifyCheckpoint(cp Checkpoint) string {
+	if cp.KeyID != "" {
+		key, err := auditKeys.Lookup(keystore.PurposeAudit, cp.KeyID)
+		if err != nil {
+			return fmt.Sprintf("checkpoint is signed with key %s, which is unknown or revoked", cp.KeyID)
+		}
+		if !hmac.Equal([]byte(sign(key, cp.Hash)), []byte(cp.Signature)) {
+			return "checkpoint signature is invalid"
+		}
+		return ""
+	}
+
+	for _, key := range auditKeys.Verifying(keystore.PurposeAudit) {
+		if hmac.Equal([]byte(sign(key, cp.Hash)), []byte(cp.Signature)) {
+			return ""
+		}
+	}
+	return "checkpoint signature is invalid"
+}
+
+// loadHead reads the last chained entry so a restarted service continues the chain
+func (c *chainState) loadHead(ctx context.Context) error {
+	if c.loaded {
+		return nil
+	}
+
+	collection := client.Database("logs").Collection("logs")
+
+	opts := options.FindOne().SetSort(bson.D{{Key: "seq", Value: -1}})
+
+	var last LogEntry
+	err := collection.FindOne(ctx, bson.M{"seq": bson.M{"$gt": 0}}, opts).Decode(&last)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return err
+	}
+
+	c.lastSeq = last.Seq
+	c.lastHash = last.Hash
+
+	// the last entry may have expired or been purged, its link is kept
+	var head chainHead
+	err = chainCollection().FindOne(ctx, bson.M{"_id": chainHeadID}).Decode(&head)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return err
+	}
+	if head.Seq > c.lastSeq {
+		c.lastSeq = head.Seq
+		c.lastHash = head.Hash
+	}
+
+	c.loaded = true
+
+	return nil
+}
+
+// append links a single entry to the chain head and stores it
+func (c *chainState) append(ctx context.Context, e *LogEntry) error {
+	_, err := c.appendMany(ctx, []*LogEntry{e})
+	return err
+}
+
+// appendMany links the entries to the chain head in order, stores them with one
+// ordered InsertMany and writes checkpoints for every signed sequence number the
+// batch crossed. It returns how many entries were stored; the chain head only
+// moves past those.
+func (c *chainState) appendMany(ctx context.Context, entries []*LogEntry) (int, error) {
+	collection := client.Database("logs").Collection("logs")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if chainLock != nil {
+		unlock, err := chainLock(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("locking the log chain: %w", err)
+		}
+		defer unlock()
+
+		// another replica may have moved the head since
+		c.loaded = false
+	}
+
+	if err := c.loadHead(ctx); err != nil {
+		return 0, err
+	}
+
+	seq, hash := c.lastSeq, c.lastHash
+
+	docs := make([]any, len(entries))
+	for i, e := range entries {
+		e.ExpiresAt = retention.expiresAt(e.Level, e.CreatedAt)
+		c.link(e)
+		docs[i] = e
+	}
+
+	res, err := collection.InsertMany(ctx, docs, options.InsertMany().SetOrdered(true))
+	inserted := insertedCount(res, err, len(entries))
+
+	// move the head back to the last entry that was actually stored so the next
+	// write does not leave a gap
+	c.lastSeq, c.lastHash = seq, hash
+	if inserted > 0 {
+		c.lastSeq = entries[inserted-1].Seq
+		c.lastHash = entries[inserted-1].Hash
+	}
+
+	// the sequence number is taken, a replica wrote without the lock
+	if mongo.IsDuplicateKeyError(err) {
+		c.loaded = false
+	}
+
+	if res != nil {
+		for i, id := range res.InsertedIDs {
+			if oid, ok := id.(primitive.ObjectID); ok && i < len(entries) {
+				entries[i].ID = oid.Hex()
+			}
+		}
+	}
+
+	for _, e := range entries[:inserted] {
+		c.checkpoint(ctx, e)
+	}
+
+	if inserted > 0 && len(retention) > 0 {
+		if err := saveChainHead(ctx, c.lastSeq, c.lastHash); err != nil {
+			log.Println("Error saving the log chain head", err)
+		}
+	}
+
+	return inserted, err
+}
+
+// chainHeadID is the id of the head of the chain in the log_chain collection
+const chainHeadID = "head"
+
+// chainHead is the link of the last entry of the chain, kept apart from the
+// entries while retention may remove the last of them
+type chainHead struct {
+	Seq  int64  `bson:"seq"`
+	Hash string `bson:"hash"`
+}
+
+func chainCollection() *mongo.Collection {
+	return client.Database("logs").Collection("log_chain")
+}
+
+// saveChainHead records the head of the chain, unless a replica recorded a
+// later one
+func saveChainHead(ctx context.Context, seq int64, hash string) error {
+	_, err := chainCollection().UpdateOne(ctx,
+		bson.M{"_id": chainHeadID, "seq": bson.M{"$lt": seq}},
+		bson.M{"$set": bson.M{"seq": seq, "hash": hash}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	return err
+}
+
+// link assigns the next sequence number, previous hash and hash to the entry.
+// The caller must hold c.mu.
+func (c *chainState) link(e *LogEntry) {
+	e.Seq = c.lastSeq + 1
+	e.PrevHash = c.lastHash
+	e.Hash = hashEntry(*e)
+
+	c.lastSeq = e.Seq
+	c.lastHash = e.Hash
+}
+
+// checkpoint writes a signed checkpoint when the entry sits on a multiple of signEvery
+func (c *chainState) checkpoint(ctx context.Context, e *LogEntry) {
+	if e.Seq%signEvery != 0 {
+		return
+	}
+
+	key, err := auditKeys.Signing(keystore.PurposeAudit)
+	if err != nil {
+		return
+	}
+
+	collection := client.Database("logs").Collection("log_signatures")
+
+	_, err = collection.InsertOne(ctx, Checkpoint{
+		Seq:       e.Seq,
+		Hash:      e.Hash,
+		Signature: sign(key, e.Hash),
+		KeyID:     key.ID,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		log.Println("Error writing log checkpoint", err)
+	}
+}
+
+// Verify walks the chain in sequence order and reports gaps, broken links, edited
+// entries and checkpoints whose signature or hash no longer matches.
+func (l *LogEntry) Verify() (*ChainReport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	collection := client.Database("logs").Collection("logs")
+
+	opts := options.Find().SetSort(bson.D{{Key: "seq", Value: 1}})
+
+	cursor, err := collection.Find(ctx, bson.M{"seq": bson.M{"$gt": 0}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	// entries created before the floor may have expired or been purged
+	floor, err := retentionFloor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ChainReport{}
+	hashes := make(map[int64]string)
+
+	var prevSeq int64
+	var prevHash string
+	var prevCreated time.Time
+
+	for cursor.Next(ctx) {
+		var entry LogEntry
+		if err := cursor.Decode(&entry); err != nil {
+			return nil, err
+		}
+
+		report.Entries++
+
+		// the missing entries were created after the entry before them
+		pruned := false
+		if entry.Seq != prevSeq+1 {
+			if prevCreated.Before(floor) {
+				pruned = true
+				report.Pruned += entry.Seq - prevSeq - 1
+			} else {
+				report.Problems = append(report.Problems, ChainProblem{
+					Seq:    entry.Seq,
+					ID:     entry.ID,
+					Reason: fmt.Sprintf("gap: expected seq %d", prevSeq+1),
+				})
+			}
+		}
+
+		if entry.PrevHash != prevHash && !pruned {
+			report.Problems = append(report.Problems, ChainProblem{
+				Seq:    entry.Seq,
+				ID:     entry.ID,
+				Reason: "previous hash does not match the preceding entry",
+			})
+		}
+
+		if hashEntry(entry) != entry.Hash {
+			report.Problems = append(report.Problems, ChainProblem{
+				Seq:    entry.Seq,
+				ID:     entry.ID,
+				Reason: "entry content does not match its hash",
+			})
+		}
+
+		if entry.UserID != "" && userHash(entry.UserNonce, entry.UserID) != entry.UserHash {
+			report.Problems = append(report.Problems, ChainProblem{
+				Seq:    entry.Seq,
+				ID:     entry.ID,
+				Reason: "user id does not match its hash",
+			})
+		}
+
+		hashes[entry.Seq] = entry.Hash
+		prevSeq = entry.Seq
+		prevHash = entry.Hash
+		prevCreated = entry.CreatedAt
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	report.HeadSeq = prevSeq
+	report.HeadHash = prevHash
+
+	if err := verifyCheckpoints(ctx, hashes, floor, report); err != nil {
+		return nil, err
+	}
+
+	report.Valid = len(report.Problems) == 0
+
+	return report, nil
+}
+
+func verifyCheckpoints(ctx context.Context, hashes map[int64]string, floor time.Time, report *ChainReport) error {
+	collection := client.Database("logs").Collection("log_signatures")
+
+	opts := options.Find().SetSort(bson.D{{Key: "seq", Value: 1}})
+
+	cursor, err := collection.Find(ctx, bson.D{}, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var cp Checkpoint
+		if err := cursor.Decode(&cp); err != nil {
+			return err
+		}
+
+		report.Checkpoints++
+
+		if auditKeys.Has(keystore.PurposeAudit) {
+			if reason := verifyCheckpoint(cp); reason != "" {
+				report.Problems = append(report.Problems, ChainProblem{
+					Seq:    cp.Seq,
+					Reason: reason,
+				})
+			}
+		}
+
+		hash, ok := hashes[cp.Seq]
+		switch {
+		case !ok && cp.CreatedAt.Before(floor):
+			// the entry expired or was purged
+		case !ok:
+			report.Problems = append(report.Problems, ChainProblem{
+				Seq:    cp.Seq,
+				Reason: "checkpointed entry is missing",
+			})
+		case hash != cp.Hash:
+			report.Problems = append(report.Problems, ChainProblem{
+				Seq:    cp.Seq,
+				Reason: "entry hash differs from signed checkpoint",
+			})
+		}
+	}
+
+	return cursor.Err()
+}
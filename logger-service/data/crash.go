@@ -0,0 +1,142 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Crash is a panic reported by the recovery middleware of a service. Reports
+// with the same stack are counted on one document.
+type Crash struct {
+	Fingerprint string            `bson:"_id" json:"fingerprint"`
+	Service     string            `bson:"service" json:"service"`
+	Message     string            `bson:"message" json:"message"`
+	Stack       string            `bson:"stack" json:"stack"`
+	Runtime     map[string]string `bson:"runtime,omitempty" json:"runtime,omitempty"`
+	TraceID     string            `bson:"trace_id,omitempty" json:"trace_id,omitempty"`
+	Count       int64             `bson:"count" json:"count"`
+	FirstSeen   time.Time         `bson:"first_seen" json:"first_seen"`
+	LastSeen    time.Time         `bson:"last_seen" json:"last_seen"`
+}
+
+var (
+	// goroutine ids, argument values and pc offsets change between two runs of
+	// the same panic, they are left out of the fingerprint
+	goroutineHeader = regexp.MustCompile(`^goroutine \d+ \[[^\]]*\]:$`)
+	frameArgs       = regexp.MustCompile(`\(.*\)$`)
+	pcOffset        = regexp.MustCompile(` \+0x[0-9a-f]+$`)
+)
+
+// StackFingerprint identifies a stack trace of service regardless of
+// goroutine ids, argument values and offsets
+func StackFingerprint(service, stack string) string {
+	return fingerprint(service, normalizeStack(stack))
+}
+
+// normalizeStack drops what varies between two runs of the same stack
+func normalizeStack(stack string) string {
+	var lines []string
+
+	for _, line := range strings.Split(stack, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || goroutineHeader.MatchString(line) {
+			continue
+		}
+
+		line = pcOffset.ReplaceAllString(line, "")
+		line = frameArgs.ReplaceAllString(line, "()")
+
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func fingerprint(parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+// Record stores a crash, or counts it on the crash with the same stack
+func (c *Crash) Record(crash Crash) (*Crash, error) {
+	collection := client.Database("logs").Collection("crashes")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now().UTC()
+	fingerprint := StackFingerprint(crash.Service, crash.Stack)
+
+	set := bson.M{
+		"message":   crash.Message,
+		"runtime":   crash.Runtime,
+		"last_seen": now,
+	}
+	if crash.TraceID != "" {
+		set["trace_id"] = crash.TraceID
+	}
+
+	var saved Crash
+
+	err := collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": fingerprint},
+		bson.M{
+			"$set": set,
+			"$inc": bson.M{"count": 1},
+			"$setOnInsert": bson.M{
+				"service":    crash.Service,
+				"stack":      crash.Stack,
+				"first_seen": now,
+			},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&saved)
+	if err != nil {
+		return nil, err
+	}
+
+	return &saved, nil
+}
+
+// Top returns the most frequent crashes seen since the given time, of one
+// service or of all when service is empty
+func (c *Crash) Top(service string, since time.Time, limit int64) ([]*Crash, error) {
+	collection := client.Database("logs").Collection("crashes")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"last_seen": bson.M{"$gte": since}}
+	if service != "" {
+		filter["service"] = service
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "count", Value: -1}, {Key: "last_seen", Value: -1}}).
+		SetLimit(limit)
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var crashes []*Crash
+	if err := cursor.All(ctx, &crashes); err != nil {
+		return nil, err
+	}
+
+	return crashes, nil
+}
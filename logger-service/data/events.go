@@ -0,0 +1,136 @@
+package data
+
+import (
+	"context"
+	v1 "contracts/v1"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// eventRetention is how long published events can be replayed
+const eventRetention = 30 * 24 * time.Hour
+
+// StoredEvent is an event seen on the event bus, kept so that it can be
+// replayed to a consumer that lost it. Signatures are not kept, replayed
+// events are signed again. Data keeps the schema it was published with, the
+// consumer upcasts it.
+type StoredEvent struct {
+	ID         string          `bson:"_id" json:"id"`
+	Topic      string          `bson:"topic" json:"topic"`
+	Type       string          `bson:"type" json:"type"`
+	Data       json.RawMessage `bson:"data" json:"data"`
+	Schema     int             `bson:"schema,omitempty" json:"schema,omitempty"`
+	Version    string          `bson:"version,omitempty" json:"version,omitempty"`
+	ReceivedAt time.Time       `bson:"received_at" json:"received_at"`
+}
+
+// EventFilter selects stored events. Topic is the aggregate the events are
+// about, e.g. "job:auth-1f2e"; the empty topic matches every topic.
+type EventFilter struct {
+	Topic string
+	From  time.Time
+	To    time.Time
+}
+
+func (f EventFilter) query() bson.M {
+	filter := bson.M{}
+	if f.Topic != "" {
+		filter["topic"] = f.Topic
+	}
+
+	received := bson.M{}
+	if !f.From.IsZero() {
+		received["$gte"] = f.From
+	}
+	if !f.To.IsZero() {
+		received["$lt"] = f.To
+	}
+	if len(received) > 0 {
+		filter["received_at"] = received
+	}
+
+	return filter
+}
+
+func eventsCollection() *mongo.Collection {
+	return client.Database("logs").Collection("events")
+}
+
+// Insert stores an event. Every replica reads the bus, the first one to store
+// an event wins and the others are told it was stored already.
+func (s *StoredEvent) Insert(e v1.Event) (bool, error) {
+	if e.ID == "" {
+		return false, errors.New("events need an id to be stored")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := eventsCollection().InsertOne(ctx, StoredEvent{
+		ID:         e.ID,
+		Topic:      e.Topic,
+		Type:       e.Type,
+		Data:       e.Data,
+		Schema:     e.Schema,
+		Version:    e.Version,
+		ReceivedAt: time.Now().UTC(),
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Each calls fn with the events of the filter, oldest first, and stops at the
+// first error
+func (s *StoredEvent) Each(ctx context.Context, f EventFilter, fn func(*StoredEvent) error) error {
+	opts := options.Find().SetSort(bson.D{{Key: "received_at", Value: 1}, {Key: "_id", Value: 1}})
+
+	cursor, err := eventsCollection().Find(ctx, f.query(), opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var e StoredEvent
+		if err := cursor.Decode(&e); err != nil {
+			return err
+		}
+		if err := fn(&e); err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
+
+// Count returns how many events match the filter
+func (s *StoredEvent) Count(ctx context.Context, f EventFilter) (int64, error) {
+	return eventsCollection().CountDocuments(ctx, f.query())
+}
+
+// ensureEventIndexes expires events after eventRetention and looks them up by
+// topic and time
+func ensureEventIndexes(ctx context.Context) error {
+	_, err := eventsCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "received_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(eventRetention / time.Second)),
+		},
+		{
+			Keys: bson.D{{Key: "topic", Value: 1}, {Key: "received_at", Value: 1}},
+		},
+	})
+
+	return err
+}
@@ -0,0 +1,67 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Heartbeat is the last sign of life of a service. Services post one every
+// Interval, the monitor alerts when several in a row are missing.
+type Heartbeat struct {
+	Service  string    `bson:"_id" json:"service"`
+	LastSeen time.Time `bson:"last_seen" json:"last_seen"`
+	Interval int64     `bson:"interval_seconds" json:"interval_seconds"`
+}
+
+// Beat records a heartbeat of service, which promises the next one within interval
+func (h *Heartbeat) Beat(service string, interval time.Duration) error {
+	collection := client.Database("logs").Collection("heartbeats")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := collection.UpdateOne(ctx,
+		bson.M{"_id": service},
+		bson.M{"$set": bson.M{
+			"last_seen":        time.Now().UTC(),
+			"interval_seconds": int64(interval / time.Second),
+		}},
+		options.Update().SetUpsert(true),
+	)
+
+	return err
+}
+
+// All returns the last heartbeat of every service that ever sent one
+func (h *Heartbeat) All() ([]*Heartbeat, error) {
+	collection := client.Database("logs").Collection("heartbeats")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := collection.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var beats []*Heartbeat
+	if err := cursor.All(ctx, &beats); err != nil {
+		return nil, err
+	}
+
+	return beats, nil
+}
+
+// Missed returns how many heartbeats are overdue at now
+func (h *Heartbeat) Missed(now time.Time) int {
+	interval := time.Duration(h.Interval) * time.Second
+	if interval <= 0 {
+		return 0
+	}
+
+	return int(now.Sub(h.LastSeen) / interval)
+}
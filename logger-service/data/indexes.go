@@ -0,0 +1,81 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EnsureIndexes creates the secondary indexes of the logs collection used to
+// look entries up by trace, issue and user, to page through them by time,
+// name, level and service and to search their text, the unique index of the chain sequence and
+// the indexes of the captures, stored events, share links and rollups
+func EnsureIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	collection := client.Database("logs").Collection("logs")
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "trace_id", Value: 1}, {Key: "seq", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+		{
+			Keys:    bson.D{{Key: "issue_id", Value: 1}, {Key: "seq", Value: -1}},
+			Options: options.Index().SetSparse(true),
+		},
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "seq", Value: -1}},
+			Options: options.Index().SetSparse(true),
+		},
+		// pages of Search, in either direction
+		{
+			Keys: bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "name", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}},
+		},
+		// entries of a level by service, e.g. the errors of one service
+		{
+			Keys: bson.D{{Key: "level", Value: 1}, {Key: "service", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+		// free text of Search, a collection has at most one text index
+		{
+			Keys:    bson.D{{Key: "name", Value: "text"}, {Key: "data", Value: "text"}},
+			Options: options.Index().SetName("logs_text").SetWeights(bson.D{{Key: "name", Value: 2}, {Key: "data", Value: 1}}),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// two replicas extending the chain from the same head can not both store
+	// their entry, see SetChainLock
+	_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "seq", Value: 1}},
+		Options: options.Index().SetUnique(true).
+			SetPartialFilterExpression(bson.M{"seq": bson.M{"$gt": 0}}),
+	})
+	if err != nil {
+		return fmt.Errorf("unique chain sequence, the chain may have forked: %w", err)
+	}
+
+	if err := ensureCaptureIndexes(ctx); err != nil {
+		return err
+	}
+
+	if err := ensureShareIndexes(ctx); err != nil {
+		return err
+	}
+
+	if err := ensureRollupIndexes(ctx); err != nil {
+		return err
+	}
+
+	return ensureEventIndexes(ctx)
+}
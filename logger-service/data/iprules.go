@@ -0,0 +1,130 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ProducerIPRules restricts the client addresses every token of a producer
+// may be used from, on top of the lists of each token
+type ProducerIPRules struct {
+	Producer   string    `bson:"_id" json:"producer"`
+	AllowCIDRs []string  `bson:"allow_cidrs,omitempty" json:"allow_cidrs,omitempty"`
+	DenyCIDRs  []string  `bson:"deny_cidrs,omitempty" json:"deny_cidrs,omitempty"`
+	UpdatedAt  time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+type cachedIPRules struct {
+	rules     *ProducerIPRules
+	fetchedAt time.Time
+}
+
+// producer rules are read on every ingest request, so they are cached like tokens
+var ipRulesCache = struct {
+	sync.Mutex
+	items map[string]cachedIPRules
+}{items: make(map[string]cachedIPRules)}
+
+// ForProducer returns the rules of a producer, nil when it has none
+func (p *ProducerIPRules) ForProducer(producer string) (*ProducerIPRules, error) {
+	now := time.Now()
+
+	ipRulesCache.Lock()
+	cached, ok := ipRulesCache.items[producer]
+	ipRulesCache.Unlock()
+
+	if ok && now.Sub(cached.fetchedAt) < tokenCacheTTL {
+		return cached.rules, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database("logs").Collection("ip_rules")
+
+	var rules *ProducerIPRules
+	err := collection.FindOne(ctx, bson.M{"_id": producer}).Decode(&rules)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+
+	ipRulesCache.Lock()
+	ipRulesCache.items[producer] = cachedIPRules{rules: rules, fetchedAt: now}
+	ipRulesCache.Unlock()
+
+	return rules, nil
+}
+
+// All returns the rules of every producer that has some
+func (p *ProducerIPRules) All() ([]*ProducerIPRules, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	collection := client.Database("logs").Collection("ip_rules")
+
+	cursor, err := collection.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var rules []*ProducerIPRules
+	if err := cursor.All(ctx, &rules); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// Set replaces the rules of a producer
+func (p *ProducerIPRules) Set(producer string, allow, deny []string) (*ProducerIPRules, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	collection := client.Database("logs").Collection("ip_rules")
+
+	rules := &ProducerIPRules{
+		Producer:   producer,
+		AllowCIDRs: allow,
+		DenyCIDRs:  deny,
+		UpdatedAt:  time.Now().UTC(),
+	}
+
+	_, err := collection.ReplaceOne(ctx, bson.M{"_id": producer}, rules, options.Replace().SetUpsert(true))
+	if err != nil {
+		return nil, err
+	}
+
+	forgetIPRules(producer)
+
+	return rules, nil
+}
+
+// Delete removes the rules of a producer
+func (p *ProducerIPRules) Delete(producer string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	collection := client.Database("logs").Collection("ip_rules")
+
+	_, err := collection.DeleteOne(ctx, bson.M{"_id": producer})
+	if err != nil {
+		return err
+	}
+
+	forgetIPRules(producer)
+
+	return nil
+}
+
+func forgetIPRules(producer string) {
+	ipRulesCache.Lock()
+	delete(ipRulesCache.items, producer)
+	ipRulesCache.Unlock()
+}
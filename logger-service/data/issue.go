@@ -0,0 +1,236 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	IssueOpen     = "open"
+	IssueResolved = "resolved"
+)
+
+// ErrIssueNotFound is returned for an unknown issue id
+var ErrIssueNotFound = errors.New("issue not found")
+
+// Issue groups the error entries of a producer that share a message template
+// and a stack
+type Issue struct {
+	ID         string     `bson:"_id" json:"id"`
+	Producer   string     `bson:"producer" json:"producer"`
+	Template   string     `bson:"template" json:"template"`
+	Message    string     `bson:"message" json:"message"`
+	Stack      string     `bson:"stack,omitempty" json:"stack,omitempty"`
+	Count      int64      `bson:"count" json:"count"`
+	Status     string     `bson:"status" json:"status"`
+	FirstSeen  time.Time  `bson:"first_seen" json:"first_seen"`
+	LastSeen   time.Time  `bson:"last_seen" json:"last_seen"`
+	ResolvedAt *time.Time `bson:"resolved_at,omitempty" json:"resolved_at,omitempty"`
+
+	// Regressed is set when an occurrence reopened a resolved issue
+	Regressed bool `bson:"-" json:"regressed,omitempty"`
+}
+
+// IsErrorLevel reports whether entries of the level are grouped into issues
+func IsErrorLevel(level string) bool {
+	switch strings.ToLower(level) {
+	case "error", "fatal", "panic", "critical":
+		return true
+	}
+	return false
+}
+
+// variable parts of a message, replaced so that messages differing only in ids
+// or values share a template
+var templateParts = []struct {
+	pattern     *regexp.Regexp
+	placeholder string
+}{
+	{regexp.MustCompile(`"[^"]*"|'[^']*'`), "<str>"},
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`), "<uuid>"},
+	{regexp.MustCompile(`(?i)\b0x[0-9a-f]+\b|\b[0-9a-f]{24,}\b`), "<hex>"},
+	{regexp.MustCompile(`\b[\w.+-]+@[\w-]+\.[\w.-]+\b`), "<email>"},
+	{regexp.MustCompile(`\b\d+(\.\d+)*\b`), "<num>"},
+}
+
+// MessageTemplate replaces the variable parts of a message by placeholders
+func MessageTemplate(message string) string {
+	for _, part := range templateParts {
+		message = part.pattern.ReplaceAllString(message, part.placeholder)
+	}
+	return message
+}
+
+// IssueID returns the id of the issue an error of producer belongs to
+func IssueID(producer, message, stack string) string {
+	return fingerprint(producer, MessageTemplate(message), normalizeStack(stack))
+}
+
+// Record counts one occurrence on the issue of the entry, creating it or
+// reopening it when it was resolved
+func (i *Issue) Record(entry LogEntry, stack string) (*Issue, error) {
+	collection := client.Database("logs").Collection("issues")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now().UTC()
+
+	var before Issue
+
+	err := collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": entry.IssueID},
+		bson.M{
+			"$set": bson.M{
+				"message":   entry.Data,
+				"status":    IssueOpen,
+				"last_seen": now,
+			},
+			"$unset": bson.M{"resolved_at": ""},
+			"$inc":   bson.M{"count": 1},
+			"$setOnInsert": bson.M{
+				"producer":   entry.Producer,
+				"template":   MessageTemplate(entry.Data),
+				"stack":      stack,
+				"first_seen": now,
+			},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before),
+	).Decode(&before)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return &Issue{
+			ID:        entry.IssueID,
+			Producer:  entry.Producer,
+			Template:  MessageTemplate(entry.Data),
+			Message:   entry.Data,
+			Stack:     stack,
+			Count:     1,
+			Status:    IssueOpen,
+			FirstSeen: now,
+			LastSeen:  now,
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	issue := before
+	issue.Regressed = before.Status == IssueResolved
+	issue.Message = entry.Data
+	issue.Status = IssueOpen
+	issue.ResolvedAt = nil
+	issue.LastSeen = now
+	issue.Count++
+
+	return &issue, nil
+}
+
+// List returns issues by most recent occurrence, filtered by status and
+// producer when they are not empty
+func (i *Issue) List(status, producer string, limit int64) ([]*Issue, error) {
+	collection := client.Database("logs").Collection("issues")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if status != "" {
+		filter["status"] = status
+	}
+	if producer != "" {
+		filter["producer"] = producer
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "last_seen", Value: -1}}).SetLimit(limit)
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var issues []*Issue
+	if err := cursor.All(ctx, &issues); err != nil {
+		return nil, err
+	}
+
+	return issues, nil
+}
+
+// Get returns one issue
+func (i *Issue) Get(id string) (*Issue, error) {
+	collection := client.Database("logs").Collection("issues")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var issue Issue
+
+	err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&issue)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrIssueNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &issue, nil
+}
+
+// SetStatus resolves or reopens an issue
+func (i *Issue) SetStatus(id, status string) (*Issue, error) {
+	collection := client.Database("logs").Collection("issues")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"status": status}, "$unset": bson.M{"resolved_at": ""}}
+	if status == IssueResolved {
+		update = bson.M{"$set": bson.M{"status": status, "resolved_at": time.Now().UTC()}}
+	}
+
+	var issue Issue
+
+	err := collection.FindOneAndUpdate(ctx, bson.M{"_id": id}, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&issue)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrIssueNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &issue, nil
+}
+
+// Events returns the latest entries of an issue
+func (i *Issue) Events(id string, limit int64) ([]*LogEntry, error) {
+	collection := client.Database("logs").Collection("logs")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "seq", Value: -1}}).SetLimit(limit)
+
+	cursor, err := collection.Find(ctx, bson.M{"issue_id": id}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var logs []*LogEntry
+	if err := cursor.All(ctx, &logs); err != nil {
+		return nil, err
+	}
+
+	return logs, nil
+}
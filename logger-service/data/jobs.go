@@ -0,0 +1,229 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// jobPrefix starts every job id of this service, so the broker knows where to
+// look a job up
+const jobPrefix = "logger-"
+
+// job statuses
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+const (
+	// jobHeartbeat is how often a running job touches updated_at, so that the
+	// jobs of a replica that stopped can be told from those of the others
+	jobHeartbeat = 30 * time.Second
+	// jobStaleAfter is how long a job may go without an update before it is
+	// taken for interrupted
+	jobStaleAfter = 3 * jobHeartbeat
+)
+
+// ErrJobNotFound is returned for unknown job ids
+var ErrJobNotFound = errors.New("job not found")
+
+// Job is a long running operation that callers poll with GET /jobs/{id}
+type Job struct {
+	ID         string     `bson:"_id" json:"id"`
+	Kind       string     `bson:"kind" json:"kind"`
+	Status     string     `bson:"status" json:"status"`
+	Progress   int        `bson:"progress" json:"progress"`
+	Message    string     `bson:"message,omitempty" json:"message,omitempty"`
+	Result     any        `bson:"result,omitempty" json:"result,omitempty"`
+	Error      string     `bson:"error,omitempty" json:"error,omitempty"`
+	CreatedAt  time.Time  `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time  `bson:"updated_at" json:"updated_at"`
+	FinishedAt *time.Time `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+}
+
+// ProgressFunc reports how far a job is, in percent, with an optional message
+type ProgressFunc func(percent int, message string)
+
+// JobFunc does the work of a job and returns its result
+type JobFunc func(ctx context.Context, progress ProgressFunc) (any, error)
+
+// jobPublisher, when set, is called with every new state of a job
+var jobPublisher func(*Job)
+
+// SetJobPublisher makes job updates visible outside of this service, e.g. on
+// the broker's event stream. It must be called before jobs are started.
+func SetJobPublisher(fn func(*Job)) {
+	jobPublisher = fn
+}
+
+func jobsCollection() *mongo.Collection {
+	return client.Database("logs").Collection("jobs")
+}
+
+// Start stores a new job of the given kind and runs fn in the background
+func (j *Job) Start(kind string, fn JobFunc) (*Job, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+
+	job := &Job{
+		ID:        jobPrefix + hex.EncodeToString(b),
+		Kind:      kind,
+		Status:    JobQueued,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := jobsCollection().InsertOne(ctx, job); err != nil {
+		return nil, err
+	}
+
+	// the runner works on its own copy, the caller may still be encoding job
+	runner := *job
+	go runner.run(fn)
+
+	return job, nil
+}
+
+func (j *Job) run(fn JobFunc) {
+	j.Status = JobRunning
+	j.update(bson.M{"status": JobRunning})
+
+	lastPercent := -1
+	progress := func(percent int, message string) {
+		// only write when the progress moved, to keep Mongo writes down
+		if percent == lastPercent && message == "" {
+			return
+		}
+		lastPercent = percent
+		j.Progress, j.Message = percent, message
+		j.update(bson.M{"progress": percent, "message": message})
+	}
+
+	stop := j.keepAlive()
+	result, err := fn(context.Background(), progress)
+	stop()
+
+	finished := time.Now().UTC()
+	j.FinishedAt = &finished
+	set := bson.M{"finished_at": finished}
+
+	if err != nil {
+		log.Printf("Job %s (%s) failed: %v", j.ID, j.Kind, err)
+		j.Status, j.Error = JobFailed, err.Error()
+		set["status"] = JobFailed
+		set["error"] = err.Error()
+	} else {
+		j.Status, j.Progress, j.Result = JobSucceeded, 100, result
+		set["status"] = JobSucceeded
+		set["progress"] = 100
+		set["result"] = result
+	}
+
+	j.update(set)
+}
+
+// keepAlive touches the job every jobHeartbeat until stop is called
+func (j *Job) keepAlive() (stop func()) {
+	done := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(jobHeartbeat)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				_, err := jobsCollection().UpdateOne(ctx,
+					bson.M{"_id": j.ID, "status": JobRunning},
+					bson.M{"$set": bson.M{"updated_at": now.UTC()}},
+				)
+				cancel()
+				if err != nil {
+					log.Printf("Error touching job %s: %v", j.ID, err)
+				}
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// update stores the changed fields and publishes the new state of the job
+func (j *Job) update(set bson.M) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	j.UpdatedAt = time.Now().UTC()
+	set["updated_at"] = j.UpdatedAt
+
+	_, err := jobsCollection().UpdateOne(ctx, bson.M{"_id": j.ID}, bson.M{"$set": set})
+	if err != nil {
+		log.Printf("Error updating job %s: %v", j.ID, err)
+	}
+
+	if jobPublisher != nil {
+		jobPublisher(j)
+	}
+}
+
+// Get returns one job by id
+func (j *Job) Get(id string) (*Job, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var job Job
+
+	err := jobsCollection().FindOne(ctx, bson.M{"_id": id}).Decode(&job)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrJobNotFound
+		}
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// FailInterrupted marks the unfinished jobs that were not updated for a while
+// as failed: the replica running them stopped. Jobs running on the other
+// replicas keep being touched and are left alone.
+func (j *Job) FailInterrupted() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now().UTC()
+
+	_, err := jobsCollection().UpdateMany(ctx,
+		bson.M{
+			"status":     bson.M{"$in": bson.A{JobQueued, JobRunning}},
+			"updated_at": bson.M{"$lt": now.Add(-jobStaleAfter)},
+		},
+		bson.M{"$set": bson.M{
+			"status":      JobFailed,
+			"error":       "interrupted by a service restart",
+			"updated_at":  now,
+			"finished_at": now,
+		}},
+	)
+
+	return err
+}
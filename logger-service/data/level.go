@@ -0,0 +1,69 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ErrInvalidEntry is wrapped by the errors of entries the logger refuses
+var ErrInvalidEntry = errors.New("invalid log entry")
+
+// Levels are the levels stored entries have, from the least severe
+var Levels = []string{"debug", "info", "warn", "error"}
+
+// levelAliases are the levels of common logging libraries stored as one of
+// Levels
+var levelAliases = map[string]string{
+	"":         "info",
+	"trace":    "debug",
+	"warning":  "warn",
+	"fatal":    "error",
+	"panic":    "error",
+	"critical": "error",
+}
+
+// NormalizeLevel returns the stored level of level, entries without one are
+// info
+func NormalizeLevel(level string) (string, error) {
+	level = strings.ToLower(strings.TrimSpace(level))
+
+	if alias, ok := levelAliases[level]; ok {
+		return alias, nil
+	}
+	for _, l := range Levels {
+		if level == l {
+			return level, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: level %q is not one of %s", ErrInvalidEntry, level, strings.Join(Levels, ", "))
+}
+
+// limits of the fields of an entry
+const (
+	maxFields          = 32
+	maxFieldValueBytes = 1024
+)
+
+// fieldKey is what field keys look like, they are queried as fields.<key>
+var fieldKey = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// ValidateFields checks the number, keys and sizes of the fields of an entry
+func ValidateFields(fields map[string]string) error {
+	if len(fields) > maxFields {
+		return fmt.Errorf("%w: more than %d fields", ErrInvalidEntry, maxFields)
+	}
+
+	for key, value := range fields {
+		if !fieldKey.MatchString(key) {
+			return fmt.Errorf("%w: field key %q must be 1 to 64 letters, digits, _ or -", ErrInvalidEntry, key)
+		}
+		if len(value) > maxFieldValueBytes {
+			return fmt.Errorf("%w: field %s is longer than %d bytes", ErrInvalidEntry, key, maxFieldValueBytes)
+		}
+	}
+
+	return nil
+}
@@ -17,33 +17,130 @@ func New(mongo *mongo.Client) Models {
 	client = mongo
 
 	return Models{
-		LogEntry: LogEntry{},
+		LogEntry:    LogEntry{},
+		IngestToken: IngestToken{},
+		Heartbeat:   Heartbeat{},
+		SLOSample:   SLOSample{},
+		SLOReport:   SLOReport{},
+		Job:         Job{},
+		Crash:       Crash{},
+		Issue:       Issue{},
+		Capture:     Capture{},
+		UserAlias:   UserAlias{},
+		IPRules:     ProducerIPRules{},
+		Alerting:    AlertingSettings{},
+		Event:       StoredEvent{},
+		Share:       ShareLink{},
 	}
 }
 
 type Models struct {
-	LogEntry LogEntry
+	LogEntry    LogEntry
+	IngestToken IngestToken
+	Heartbeat   Heartbeat
+	SLOSample   SLOSample
+	SLOReport   SLOReport
+	Job         Job
+	Crash       Crash
+	Issue       Issue
+	Capture     Capture
+	UserAlias   UserAlias
+	IPRules     ProducerIPRules
+	Alerting    AlertingSettings
+	Event       StoredEvent
+	Share       ShareLink
 }
 
 type LogEntry struct {
 	ID        string    `bson:"_id,omitempty" json:"id,omitempty"`
 	Name      string    `bson:"name" json:"name"`
 	Data      string    `bson:"data" json:"data"`
+	Producer  string    `bson:"producer,omitempty" json:"producer,omitempty"`
 	CreatedAt time.Time `bson:"created_at" json:"created_at"`
 	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+	Seq       int64     `bson:"seq,omitempty" json:"seq,omitempty"`
+	PrevHash  string    `bson:"prev_hash,omitempty" json:"prev_hash,omitempty"`
+	Hash      string    `bson:"hash,omitempty" json:"hash,omitempty"`
+
+	// Level is the severity given by the producer, one of Levels; error
+	// entries are grouped into issues by IssueID
+	Level   string `bson:"level,omitempty" json:"level,omitempty"`
+	IssueID string `bson:"issue_id,omitempty" json:"issue_id,omitempty"`
+
+	// Service is the component of the producer that logged the entry, Fields
+	// its structured context
+	Service string            `bson:"service,omitempty" json:"service,omitempty"`
+	Fields  map[string]string `bson:"fields,omitempty" json:"fields,omitempty"`
+
+	// UserID links the entry to a user account. UserHash commits to it in the
+	// chain hash, so the id and its nonce can be dropped by ForgetUser without
+	// breaking the chain.
+	UserID    string `bson:"user_id,omitempty" json:"user_id,omitempty"`
+	UserNonce string `bson:"user_nonce,omitempty" json:"-"`
+	UserHash  string `bson:"user_hash,omitempty" json:"user_hash,omitempty"`
+
+	// ProducerVersion is the build of the producer that sent the entry
+	ProducerVersion string `bson:"producer_version,omitempty" json:"producer_version,omitempty"`
+
+	// W3C trace context of the request that produced the entry
+	TraceID string `bson:"trace_id,omitempty" json:"trace_id,omitempty"`
+	SpanID  string `bson:"span_id,omitempty" json:"span_id,omitempty"`
+
+	// redaction metadata, see Redact
+	Redacted   bool       `bson:"redacted,omitempty" json:"redacted,omitempty"`
+	RedactedAt *time.Time `bson:"redacted_at,omitempty" json:"redacted_at,omitempty"`
+	DataHash   string     `bson:"data_hash,omitempty" json:"data_hash,omitempty"`
+	RedactedID string     `bson:"redacted_id,omitempty" json:"redacted_id,omitempty"`
+
+	// ExpiresAt is when the entry is removed under the retention of its
+	// level, see EnsureRetention
+	ExpiresAt *time.Time `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
 }
 
+// Insert appends an entry to the hash chain and stores it. When the bulk writer
+// is running the entry is written together with other pending entries; once
+// it stopped the entry is refused with ErrWriterStopped.
 func (l *LogEntry) Insert(entry LogEntry) error {
-	collection := client.Database("logs").Collection("logs")
+	now := time.Now().UTC().Truncate(time.Millisecond)
 
-	_, err := collection.InsertOne(context.TODO(), LogEntry{
+	record := LogEntry{
 		Name:      entry.Name,
 		Data:      entry.Data,
-		CreatedAt: entry.CreatedAt,
-		UpdatedAt: entry.UpdatedAt,
-	})
+		Producer:  entry.Producer,
+		Level:     entry.Level,
+		IssueID:   entry.IssueID,
+		Service:   entry.Service,
+		Fields:    entry.Fields,
+		TraceID:   entry.TraceID,
+		SpanID:    entry.SpanID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
 
-	if err != nil {
+	record.ProducerVersion = entry.ProducerVersion
+
+	// entries the logger writes itself are info entries of the producer
+	if record.Level == "" {
+		record.Level = "info"
+	}
+	if record.Service == "" {
+		record.Service = record.Producer
+	}
+
+	if entry.UserID != "" {
+		record.UserID = entry.UserID
+		record.UserNonce = newUserNonce()
+		record.UserHash = userHash(record.UserNonce, record.UserID)
+	}
+
+	if b := writer.Load(); b != nil {
+		return b.enqueue(&record)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	if err := chain.append(ctx, &record); err != nil {
 		log.Println("Error inserting into logs", err)
 		return err
 	}
@@ -58,7 +155,7 @@ func (l *LogEntry) All() ([]*LogEntry, error) {
 	collection := client.Database("logs").Collection("logs")
 
 	opts := options.Find()
-	opts.SetSort(bson.D{{"created_at", -1}})
+	opts.SetSort(bson.D{{Key: "created_at", Value: -1}})
 
 	cursor, err := collection.Find(context.TODO(), bson.D{}, opts)
 	if err != nil {
@@ -106,6 +203,10 @@ func (l *LogEntry) GetOne(id string) (*LogEntry, error) {
 }
 
 func (l *LogEntry) DropCollection() error {
+	if writeOnce {
+		return ErrWriteOnce
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 
@@ -118,6 +219,9 @@ func (l *LogEntry) DropCollection() error {
 }
 
 func (l *LogEntry) Update() (*mongo.UpdateResult, error) {
+	if writeOnce {
+		return nil, ErrWriteOnce
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 
@@ -135,10 +239,10 @@ func (l *LogEntry) Update() (*mongo.UpdateResult, error) {
 		ctx,
 		bson.M{"_id": docID},
 		bson.D{
-			{"$set", bson.D{
-				{"name", l.Name},
-				{"data", l.Data},
-				{"updated_at", time.Now()},
+			{Key: "$set", Value: bson.D{
+				{Key: "name", Value: l.Name},
+				{Key: "data", Value: l.Data},
+				{Key: "updated_at", Value: time.Now()},
 			}},
 		},
 	)
@@ -0,0 +1,132 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// newUserNonce returns the random nonce that keeps the user hash of an entry
+// from being reversed by trying every user id
+func newUserNonce() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func userHash(nonce, userID string) string {
+	return digest(nonce + ":" + userID)
+}
+
+// ForgetResult counts what ForgetUser changed
+type ForgetResult struct {
+	UserID     string `json:"user_id"`
+	Anonymized int64  `json:"anonymized"`
+	Purged     int64  `json:"purged"`
+}
+
+// ByUser returns the latest entries linked to a user, including those of the
+// accounts merged into it
+func (l *LogEntry) ByUser(userID string, limit int64) ([]*LogEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	userIDs, err := linkedUserIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	collection := client.Database("logs").Collection("logs")
+
+	opts := options.Find().SetSort(bson.D{{Key: "seq", Value: -1}}).SetLimit(limit)
+
+	cursor, err := collection.Find(ctx, bson.M{"user_id": bson.M{"$in": userIDs}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var logs []*LogEntry
+	if err := cursor.All(ctx, &logs); err != nil {
+		return nil, err
+	}
+
+	return logs, nil
+}
+
+// ForgetUser removes the link between a user and their entries. Each entry
+// keeps only the user hash, which cannot be traced back once the nonce is gone.
+// With purge the data of those entries is redacted first, leaving tombstones
+// in the chain like any other redaction. The accounts merged into the user are
+// forgotten with it.
+func (l *LogEntry) ForgetUser(ctx context.Context, userID string, purge bool, actor Actor, progress ProgressFunc) (*ForgetResult, error) {
+	userIDs, err := linkedUserIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	linked := bson.M{"$in": userIDs}
+
+	collection := client.Database("logs").Collection("logs")
+
+	result := &ForgetResult{UserID: userID}
+
+	if purge {
+		cursor, err := collection.Find(ctx,
+			bson.M{"user_id": linked, "redacted": bson.M{"$ne": true}},
+			options.Find().SetProjection(bson.M{"_id": 1}),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		var ids []struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cursor.All(ctx, &ids); err != nil {
+			return nil, err
+		}
+
+		for i, doc := range ids {
+			if progress != nil && i%100 == 0 {
+				progress(90*i/len(ids), "redacting entries")
+			}
+
+			_, err := l.Redact(doc.ID.Hex(), "user data erasure", actor)
+			if errors.Is(err, ErrAlreadyRedacted) {
+				continue
+			}
+			if err != nil {
+				return result, err
+			}
+			result.Purged++
+		}
+	}
+
+	if progress != nil {
+		progress(90, "anonymizing entries")
+	}
+
+	res, err := collection.UpdateMany(ctx,
+		bson.M{"user_id": linked},
+		bson.M{"$unset": bson.M{"user_id": "", "user_nonce": ""}},
+	)
+	if err != nil {
+		return result, err
+	}
+	result.Anonymized = res.ModifiedCount
+
+	_, err = client.Database("logs").Collection("user_aliases").DeleteMany(ctx,
+		bson.M{"$or": bson.A{bson.M{"_id": linked}, bson.M{"to": linked}}},
+	)
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
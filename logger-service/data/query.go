@@ -0,0 +1,431 @@
+package data
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MaxQueryLength bounds the query strings accepted by ParseQuery
+const MaxQueryLength = 1000
+
+// queryFields maps the field names of the query language to entry fields
+var queryFields = map[string]string{
+	"name":     "name",
+	"data":     "data",
+	"level":    "level",
+	"service":  "service",
+	"producer": "producer",
+	"trace":    "trace_id",
+	"span":     "span_id",
+	"user":     "user_id",
+	"issue":    "issue_id",
+	"seq":      "seq",
+	"created":  "created_at",
+}
+
+// ParseQuery turns a query such as
+//
+//	level:error AND (service:auth OR service:broker) AND NOT data:~"timeout"
+//
+// into a Mongo filter on the logs collection. Terms are field:value for an
+// exact match, field:~value for a case-insensitive regular expression and
+// field:>value, field:>=value, field:<value, field:<=value for seq and created
+// (RFC 3339 time or YYYY-MM-DD). fields.<key> matches the fields of entries.
+// Terms next to each other are ANDed, AND binds tighter than OR, values with
+// spaces are quoted.
+func ParseQuery(query string) (bson.M, error) {
+	if len(query) > MaxQueryLength {
+		return nil, fmt.Errorf("query is longer than %d characters", MaxQueryLength)
+	}
+
+	tokens, err := lexQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tokens) == 0 {
+		return bson.M{}, nil
+	}
+
+	p := &queryParser{tokens: tokens}
+
+	filter, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+
+	return filter, nil
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenString
+	tokenLParen
+	tokenRParen
+)
+
+type queryToken struct {
+	kind tokenKind
+	text string
+}
+
+func lexQuery(query string) ([]queryToken, error) {
+	var tokens []queryToken
+
+	runes := []rune(query)
+
+	for i := 0; i < len(runes); {
+		c := runes[i]
+
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, queryToken{tokenLParen, "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, queryToken{tokenRParen, ")"})
+			i++
+		case c == '"':
+			var b strings.Builder
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				b.WriteRune(runes[i])
+			}
+			if i == len(runes) {
+				return nil, errors.New("unterminated string")
+			}
+			i++
+			tokens = append(tokens, queryToken{tokenString, b.String()})
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '(' && runes[i] != ')' && runes[i] != '"' {
+				i++
+			}
+			tokens = append(tokens, queryToken{tokenWord, string(runes[start:i])})
+		}
+	}
+
+	return tokens, nil
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peekKeyword(keyword string) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokenWord && p.tokens[p.pos].text == keyword
+}
+
+func (p *queryParser) or() (bson.M, error) {
+	first, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+
+	clauses := []bson.M{first}
+	for p.peekKeyword("OR") {
+		p.pos++
+		next, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, next)
+	}
+
+	if len(clauses) == 1 {
+		return first, nil
+	}
+	return bson.M{"$or": clauses}, nil
+}
+
+func (p *queryParser) and() (bson.M, error) {
+	first, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+
+	clauses := []bson.M{first}
+	for p.pos < len(p.tokens) && !p.peekKeyword("OR") && p.tokens[p.pos].kind != tokenRParen {
+		if p.peekKeyword("AND") {
+			p.pos++
+		}
+		next, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, next)
+	}
+
+	if len(clauses) == 1 {
+		return first, nil
+	}
+	return bson.M{"$and": clauses}, nil
+}
+
+func (p *queryParser) unary() (bson.M, error) {
+	if p.pos == len(p.tokens) {
+		return nil, errors.New("unexpected end of query")
+	}
+
+	if p.peekKeyword("NOT") {
+		p.pos++
+		inner, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return bson.M{"$nor": []bson.M{inner}}, nil
+	}
+
+	token := p.tokens[p.pos]
+
+	switch token.kind {
+	case tokenLParen:
+		p.pos++
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.pos == len(p.tokens) || p.tokens[p.pos].kind != tokenRParen {
+			return nil, errors.New("missing )")
+		}
+		p.pos++
+		return inner, nil
+	case tokenWord:
+		p.pos++
+		return p.term(token.text)
+	}
+
+	return nil, fmt.Errorf("unexpected %q", token.text)
+}
+
+// term parses field:value, where the value may be the quoted string following
+// the word
+func (p *queryParser) term(word string) (bson.M, error) {
+	name, rest, ok := strings.Cut(word, ":")
+	if !ok {
+		return nil, fmt.Errorf("expected field:value, got %q", word)
+	}
+
+	field, ok := queryFields[strings.ToLower(name)]
+	if key, isField := strings.CutPrefix(name, "fields."); isField && fieldKey.MatchString(key) {
+		field, ok = name, true
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q", name)
+	}
+
+	op := ""
+	for _, candidate := range []string{">=", "<=", ">", "<", "~"} {
+		if strings.HasPrefix(rest, candidate) {
+			op, rest = candidate, rest[len(candidate):]
+			break
+		}
+	}
+
+	value := rest
+	if value == "" && p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokenString {
+		value = p.tokens[p.pos].text
+		p.pos++
+	}
+	if value == "" {
+		return nil, fmt.Errorf("missing value for %s", name)
+	}
+
+	switch op {
+	case "~":
+		if _, err := regexp.Compile(value); err != nil {
+			return nil, fmt.Errorf("invalid pattern for %s: %w", name, err)
+		}
+		return bson.M{field: primitive.Regex{Pattern: value, Options: "i"}}, nil
+	case "":
+		typed, err := queryValue(field, value)
+		if err != nil {
+			return nil, err
+		}
+		return bson.M{field: typed}, nil
+	}
+
+	if field != "seq" && field != "created_at" {
+		return nil, fmt.Errorf("%s does not support %s", name, op)
+	}
+
+	typed, err := queryValue(field, value)
+	if err != nil {
+		return nil, err
+	}
+
+	operators := map[string]string{">": "$gt", ">=": "$gte", "<": "$lt", "<=": "$lte"}
+
+	return bson.M{field: bson.M{operators[op]: typed}}, nil
+}
+
+func queryValue(field, value string) (any, error) {
+	switch field {
+	case "seq":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid seq %q", value)
+		}
+		return n, nil
+	case "created_at":
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return t.UTC(), nil
+		}
+		t, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time %q", value)
+		}
+		return t, nil
+	case "level":
+		return strings.ToLower(value), nil
+	}
+
+	return value, nil
+}
+
+// ParseQueryTime parses the times of the query language, an RFC 3339 time or
+// a YYYY-MM-DD date
+func ParseQueryTime(value string) (time.Time, error) {
+	t, err := queryValue("created_at", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.(time.Time), nil
+}
+
+// ErrInvalidCursor is returned for cursors Search did not hand out
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// LogQuery selects a page of entries for Search
+type LogQuery struct {
+	// Filter is built by ParseQuery, nil for all entries
+	Filter bson.M
+	// Search is free text matched against the name and data of entries
+	// with the text index of the collection
+	Search string
+	// Ascending sorts the oldest entry first, the newest is first otherwise
+	Ascending bool
+	// Cursor is the Next of the page before, empty for the first page
+	Cursor string
+	Limit  int64
+}
+
+// logCursor is the position after the last entry of a page. Entries are
+// sorted by created_at and then _id, so entries of the same instant are
+// neither skipped nor repeated between pages.
+type logCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        string    `json:"id"`
+}
+
+// Search returns a page of the entries matching a query and the cursor of the
+// next page, empty on the last one
+func (l *LogEntry) Search(q LogQuery) ([]*LogEntry, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	collection := client.Database("logs").Collection("logs")
+
+	filters := bson.A{}
+	if len(q.Filter) > 0 {
+		filters = append(filters, q.Filter)
+	}
+	if q.Search != "" {
+		filters = append(filters, bson.M{"$text": bson.M{"$search": q.Search}})
+	}
+
+	order, next := -1, "$lt"
+	if q.Ascending {
+		order, next = 1, "$gt"
+	}
+
+	if q.Cursor != "" {
+		after, err := decodeLogCursor(q.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		filters = append(filters, bson.M{"$or": bson.A{
+			bson.M{"created_at": bson.M{next: after.CreatedAt}},
+			bson.M{"created_at": after.CreatedAt, "_id": bson.M{next: entryID(after.ID)}},
+		}})
+	}
+
+	filter := bson.M{}
+	if len(filters) > 0 {
+		filter = bson.M{"$and": filters}
+	}
+
+	// one entry more than the page tells whether there is a next page
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: order}, {Key: "_id", Value: order}}).
+		SetLimit(q.Limit + 1).
+		SetMaxTime(10 * time.Second)
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	defer cursor.Close(ctx)
+
+	var logs []*LogEntry
+	if err := cursor.All(ctx, &logs); err != nil {
+		return nil, "", err
+	}
+
+	if int64(len(logs)) <= q.Limit {
+		return logs, "", nil
+	}
+
+	logs = logs[:q.Limit]
+	last := logs[len(logs)-1]
+
+	return logs, encodeLogCursor(logCursor{CreatedAt: last.CreatedAt, ID: last.ID}), nil
+}
+
+func encodeLogCursor(c logCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeLogCursor(s string) (logCursor, error) {
+	var c logCursor
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(b, &c) != nil || c.ID == "" {
+		return c, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+// entryID returns the _id of an entry as stored, entries written by the
+// service have ObjectIDs and restored or imported ones may have strings
+func entryID(id string) any {
+	if oid, err := primitive.ObjectIDFromHex(id); err == nil {
+		return oid
+	}
+	return id
+}
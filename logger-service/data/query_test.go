@@ -0,0 +1,80 @@
+package data
+
+import (
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseQuery(t *testing.T) {
+	for _, tt := range []struct {
+		query, want string
+	}{
+		{``, `{}`},
+		{`level:error`, `{"level":"error"}`},
+		{`level:error service:auth`, `{"$and":[{"level":"error"},{"service":"auth"}]}`},
+		{`name:a OR name:b`, `{"$or":[{"name":"a"},{"name":"b"}]}`},
+		{`data:"two words"`, `{"data":"two words"}`},
+		{`seq:>=10`, `{"seq":{"$gte":10}}`},
+	} {
+		filter, err := ParseQuery(tt.query)
+		if err != nil {
+			t.Errorf("ParseQuery(%q): %v", tt.query, err)
+			continue
+		}
+
+		got, err := bson.MarshalExtJSON(filter, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("ParseQuery(%q) = %s, want %s", tt.query, got, tt.want)
+		}
+	}
+
+	for _, query := range []string{
+		`(level:error`,
+		`level:error)`,
+		`data:"open`,
+		`nofield:x`,
+		`seq:>ten`,
+		`AND`,
+		strings.Repeat("a", MaxQueryLength+1),
+	} {
+		if _, err := ParseQuery(query); err == nil {
+			t.Errorf("ParseQuery(%q) accepted it", query)
+		}
+	}
+}
+
+// FuzzParseQuery feeds the query language arbitrary strings: the parser must
+// not panic, and every filter it returns must be one Mongo can be sent
+func FuzzParseQuery(f *testing.F) {
+	for _, seed := range []string{
+		`level:error AND (service:auth OR service:broker) AND NOT data:~"timeout"`,
+		`created:>=2024-01-01 created:<"2024-02-01T00:00:00Z"`,
+		`fields.method:POST seq:>10`,
+		`data:"quote \" inside"`,
+		`((((name:x))))`,
+		`NOT NOT NOT level:warn`,
+		`data:~"(unclosed"`,
+		`user:`,
+		``,
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, query string) {
+		filter, err := ParseQuery(query)
+		if err != nil {
+			return
+		}
+		if len(query) > MaxQueryLength {
+			t.Fatalf("accepted a query of %d characters", len(query))
+		}
+		if _, err := bson.Marshal(filter); err != nil {
+			t.Fatalf("ParseQuery(%q) returned a filter bson can not encode: %v", query, err)
+		}
+	})
+}
@@ -0,0 +1,192 @@
+package data
+
+import (
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// queryHorizon is how far back a search without a lower time bound is taken
+// to reach when no retention bounds the entries
+const queryHorizon = 90 * 24 * time.Hour
+
+// costFactors weigh the hours of a search by how well an exact match on a
+// field narrows it down, through the indexes of the logs collection
+var costFactors = map[string]float64{
+	"trace_id": 0.01,
+	"span_id":  0.01,
+	"user_id":  0.01,
+	"issue_id": 0.01,
+	"seq":      0.01,
+	"name":     0.1,
+	"level":    0.3,
+	"service":  0.3,
+}
+
+const (
+	// regexCost weighs each regular expression, which matches entry by entry
+	regexCost = 3
+	// textCost weighs a free text search, which goes through the text index
+	textCost = 0.5
+)
+
+// QueryCost estimates the work of a search before it runs, in entry-hours:
+// the hours of entries it spans, weighted by how much its filters narrow them
+// down and by the size of the page asked for. An unfiltered search of a day
+// of entries costs 24.
+type QueryCost struct {
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	Hours  float64   `json:"hours"`
+	Factor float64   `json:"factor"`
+	Units  float64   `json:"units"`
+}
+
+// EstimateCost estimates the cost of q over [from, to); zero times are open
+// bounds. Bounds on created in the query narrow the span when every entry
+// has to meet them.
+func EstimateCost(q LogQuery, from, to, now time.Time) QueryCost {
+	factor := 1.0
+	if q.Search != "" {
+		factor *= textCost
+	}
+
+	for _, term := range conjuncts(q.Filter) {
+		for field, value := range term {
+			if field == "created_at" {
+				from, to = narrowSpan(value, from, to)
+				continue
+			}
+			if f, ok := costFactors[field]; ok && isExact(value) {
+				factor *= f
+			}
+		}
+	}
+	factor *= math.Pow(regexCost, float64(countRegexes(q.Filter)))
+
+	if to.IsZero() || to.After(now) {
+		to = now
+	}
+	if from.IsZero() {
+		from = now.Add(-horizon())
+	}
+
+	hours := max(to.Sub(from).Hours(), 1.0/60)
+	pages := max(float64(q.Limit)/100, 1)
+
+	return QueryCost{From: from, To: to, Hours: hours, Factor: factor, Units: hours * factor * pages}
+}
+
+// Narrowed returns the latest lower bound that brings the cost within units,
+// the span is narrowed to the newest entries
+func (c QueryCost) Narrowed(units float64) time.Time {
+	if c.Units <= units {
+		return c.From
+	}
+	hours := c.Hours * units / c.Units
+	return c.To.Add(-time.Duration(hours * float64(time.Hour)))
+}
+
+// horizon is how old the oldest entry can be
+func horizon() time.Duration {
+	if longest := ConfiguredRetention().longest(); longest > 0 {
+		return longest
+	}
+	return queryHorizon
+}
+
+// conjuncts returns the terms every matching entry meets, those ANDed at the
+// top of filter
+func conjuncts(filter bson.M) []bson.M {
+	if len(filter) == 0 {
+		return nil
+	}
+
+	and, ok := filter["$and"]
+	if !ok || len(filter) > 1 {
+		return []bson.M{filter}
+	}
+
+	var terms []bson.M
+	switch clauses := and.(type) {
+	case []bson.M:
+		for _, c := range clauses {
+			terms = append(terms, conjuncts(c)...)
+		}
+	case bson.A:
+		for _, c := range clauses {
+			if m, ok := c.(bson.M); ok {
+				terms = append(terms, conjuncts(m)...)
+			}
+		}
+	}
+	return terms
+}
+
+// narrowSpan applies the bounds of a created_at condition to [from, to)
+func narrowSpan(value any, from, to time.Time) (time.Time, time.Time) {
+	ops, ok := value.(bson.M)
+	if !ok {
+		// an exact instant
+		if t, ok := value.(time.Time); ok {
+			return t, t.Add(time.Second)
+		}
+		return from, to
+	}
+
+	for op, v := range ops {
+		t, ok := v.(time.Time)
+		if !ok {
+			continue
+		}
+		switch op {
+		case "$gt", "$gte":
+			if t.After(from) {
+				from = t
+			}
+		case "$lt", "$lte":
+			if to.IsZero() || t.Before(to) {
+				to = t
+			}
+		}
+	}
+	return from, to
+}
+
+// isExact tells values matched for equality from patterns and ranges
+func isExact(value any) bool {
+	switch value.(type) {
+	case bson.M, primitive.Regex:
+		return false
+	}
+	return true
+}
+
+// countRegexes counts the regular expressions anywhere in filter
+func countRegexes(value any) int {
+	switch v := value.(type) {
+	case primitive.Regex:
+		return 1
+	case bson.M:
+		n := 0
+		for _, inner := range v {
+			n += countRegexes(inner)
+		}
+		return n
+	case []bson.M:
+		n := 0
+		for _, inner := range v {
+			n += countRegexes(inner)
+		}
+		return n
+	case bson.A:
+		n := 0
+		for _, inner := range v {
+			n += countRegexes(inner)
+		}
+		return n
+	}
+	return 0
+}
@@ -0,0 +1,116 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// redactedData replaces the data of a redacted entry
+const redactedData = "[REDACTED]"
+
+// ErrWriteOnce is returned by operations that modify or remove entries while
+// the service runs in write-once mode
+var ErrWriteOnce = errors.New("log entries are write-once, use the redaction API")
+
+// ErrAlreadyRedacted is returned when redacting an entry twice
+var ErrAlreadyRedacted = errors.New("log entry is already redacted")
+
+var writeOnce bool
+
+// SetWriteOnce turns write-once mode on or off. In write-once mode Update and
+// DropCollection are refused, restores only insert and the only way to change
+// an entry is Redact.
+func SetWriteOnce(enabled bool) {
+	writeOnce = enabled
+}
+
+// WriteOnce reports whether write-once mode is enabled
+func WriteOnce() bool {
+	return writeOnce
+}
+
+// Actor is who redacts: the credential the request was authenticated with and
+// the name the caller gave, which a shared credential can not vouch for
+type Actor struct {
+	Credential string
+	Name       string
+}
+
+// Tombstone is the payload stored in the data field of the entry that records a redaction
+type Tombstone struct {
+	RedactedID  string `json:"redacted_id"`
+	RedactedSeq int64  `json:"redacted_seq"`
+	Reason      string `json:"reason"`
+	Actor       string `json:"actor"`
+	Credential  string `json:"credential,omitempty"`
+}
+
+// Redact blanks the data of one entry and appends a tombstone entry to the chain
+// recording who redacted what and why. The digest of the original data is kept
+// so that the chain still verifies after the redaction.
+func (l *LogEntry) Redact(id, reason string, actor Actor) (*LogEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	collection := client.Database("logs").Collection("logs")
+
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry LogEntry
+	err = collection.FindOne(ctx, bson.M{"_id": docID}).Decode(&entry)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.Redacted {
+		return nil, ErrAlreadyRedacted
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	_, err = collection.UpdateOne(
+		ctx,
+		bson.M{"_id": docID, "redacted": bson.M{"$ne": true}},
+		bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "data", Value: redactedData},
+				{Key: "data_hash", Value: digest(entry.Data)},
+				{Key: "redacted", Value: true},
+				{Key: "redacted_at", Value: now},
+			}},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, _ := json.Marshal(Tombstone{
+		RedactedID:  id,
+		RedactedSeq: entry.Seq,
+		Reason:      reason,
+		Actor:       actor.Name,
+		Credential:  actor.Credential,
+	})
+
+	tombstone := LogEntry{
+		Name:       "tombstone",
+		Data:       string(payload),
+		RedactedID: id,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	if err := chain.append(ctx, &tombstone); err != nil {
+		return nil, err
+	}
+
+	return &tombstone, nil
+}
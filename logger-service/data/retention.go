@@ -0,0 +1,389 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// retentionID is the id of the retention last applied to the stored entries
+// in the settings collection
+const retentionID = "retention"
+
+// purgeBatch is how many entries a purge deletes at once, so that it does not
+// hold up the writers
+const purgeBatch = 1000
+
+// Retention is how long entries are kept, by level. Entries of levels without
+// one are kept for good.
+type Retention map[string]time.Duration
+
+// ParseRetention parses LOG_RETENTION, e.g. debug=7d,info=30d,warn=90d. Days
+// are written with d, anything else as a Go duration; level aliases are
+// accepted.
+func ParseRetention(s string) (Retention, error) {
+	r := Retention{}
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("retention %q: expected level=duration", part)
+		}
+
+		level, err := NormalizeLevel(name)
+		if err != nil || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("retention %q: unknown level %q", part, name)
+		}
+
+		d, err := parseRetentionDuration(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("retention %q: %w", part, err)
+		}
+		r[level] = d
+	}
+
+	return r, nil
+}
+
+func parseRetentionDuration(s string) (time.Duration, error) {
+	var d time.Duration
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid days %q", s)
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if d, err = time.ParseDuration(s); err != nil {
+			return 0, err
+		}
+	}
+
+	if d < time.Hour {
+		return 0, fmt.Errorf("%s is shorter than an hour", s)
+	}
+	return d, nil
+}
+
+// String returns the retention in the form ParseRetention reads
+func (r Retention) String() string {
+	parts := make([]string, 0, len(r))
+	for _, level := range Levels {
+		if d, ok := r[level]; ok {
+			parts = append(parts, fmt.Sprintf("%s=%s", level, d))
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// shortest returns the shortest retention, 0 when entries are kept for good
+func (r Retention) shortest() time.Duration {
+	var shortest time.Duration
+	for _, d := range r {
+		if shortest == 0 || d < shortest {
+			shortest = d
+		}
+	}
+	return shortest
+}
+
+// longest returns the longest retention when every level has one, 0 when the
+// entries of some level are kept for good
+func (r Retention) longest() time.Duration {
+	var longest time.Duration
+	for _, level := range Levels {
+		d, ok := r[level]
+		if !ok {
+			return 0
+		}
+		longest = max(longest, d)
+	}
+	return longest
+}
+
+// retention is the retention entries are stored with, see ConfigureRetention
+var retention Retention
+
+// ConfigureRetention sets the retention of the entries written from now on.
+// It must be called before entries are written; EnsureRetention applies it to
+// the stored entries.
+func ConfigureRetention(r Retention) {
+	retention = r
+}
+
+// expiresAt returns when an entry of level created at created expires, nil
+// when it is kept for good. Entries without a level, like tombstones, are info
+// entries.
+func (r Retention) expiresAt(level string, created time.Time) *time.Time {
+	level, err := NormalizeLevel(level)
+	if err != nil {
+		return nil
+	}
+
+	d, ok := r[level]
+	if !ok {
+		return nil
+	}
+
+	t := created.Add(d)
+	return &t
+}
+
+// levelFilter matches the stored entries of level, entries without a level
+// are info entries
+func levelFilter(level string) bson.M {
+	if level == "info" {
+		return bson.M{"level": bson.M{"$in": bson.A{"info", "", nil}}}
+	}
+	return bson.M{"level": level}
+}
+
+// EnsureRetention makes the stored entries expire under the configured
+// retention. With ttl a TTL index on expires_at has Mongo remove them; without
+// it, for stores that do not support TTL indexes, only PurgeExpired does. The
+// expiry of stored entries is recomputed for the levels whose retention
+// changed since it was last applied. expires_at is not part of the chain hash,
+// setting it is allowed in write-once mode.
+func EnsureRetention(ctx context.Context, ttl bool) error {
+	collection := client.Database("logs").Collection("logs")
+
+	if ttl && len(retention) > 0 {
+		_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetName("logs_ttl").SetExpireAfterSeconds(0),
+		})
+		if err != nil {
+			return fmt.Errorf("TTL index: %w", err)
+		}
+	} else {
+		_, err := collection.Indexes().DropOne(ctx, "logs_ttl")
+		var cmdErr mongo.CommandError
+		if err != nil && !(errors.As(err, &cmdErr) && cmdErr.Name == "IndexNotFound") {
+			return err
+		}
+	}
+
+	var applied struct {
+		Levels map[string]int64 `bson:"levels"`
+	}
+	err := settingsCollection().FindOne(ctx, bson.M{"_id": retentionID}).Decode(&applied)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return err
+	}
+
+	levels := make(map[string]int64, len(retention))
+	for _, level := range Levels {
+		d := retention[level]
+		levels[level] = int64(d / time.Millisecond)
+		if applied.Levels[level] == levels[level] {
+			continue
+		}
+
+		var update any = bson.M{"$unset": bson.M{"expires_at": ""}}
+		if d > 0 {
+			update = bson.A{bson.M{"$set": bson.M{
+				"expires_at": bson.M{"$add": bson.A{"$created_at", levels[level]}},
+			}}}
+		}
+
+		res, err := collection.UpdateMany(ctx, levelFilter(level), update)
+		if err != nil {
+			return fmt.Errorf("applying the retention of %s entries: %w", level, err)
+		}
+		log.Printf("Retention of %s entries is now %s, %d entries updated", level, retentionLabel(d), res.ModifiedCount)
+	}
+
+	_, err = settingsCollection().UpdateOne(ctx,
+		bson.M{"_id": retentionID},
+		bson.M{"$set": bson.M{"levels": levels, "updated_at": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+func retentionLabel(d time.Duration) string {
+	if d == 0 {
+		return "unlimited"
+	}
+	return d.String()
+}
+
+// PurgeExpired removes the entries past their expiry, in batches, and the
+// checkpoints older than the longest retention. It does the work of the TTL
+// index on stores without one and catches up on the TTL monitor, which runs
+// once a minute, otherwise. It returns how many entries it removed.
+func PurgeExpired(ctx context.Context) (int64, error) {
+	if len(retention) == 0 {
+		return 0, nil
+	}
+
+	removed, err := deleteInBatches(ctx, bson.M{"expires_at": bson.M{"$lt": time.Now()}})
+	if err != nil {
+		return removed, err
+	}
+
+	// the checkpoints of expired entries can no longer be checked
+	if longest := retention.longest(); longest > 0 {
+		_, err = client.Database("logs").Collection("log_signatures").DeleteMany(ctx,
+			bson.M{"created_at": bson.M{"$lt": time.Now().Add(-longest)}},
+		)
+	}
+
+	return removed, err
+}
+
+// deleteInBatches deletes the entries matching filter purgeBatch at a time
+func deleteInBatches(ctx context.Context, filter bson.M) (int64, error) {
+	collection := client.Database("logs").Collection("logs")
+
+	var removed int64
+	for {
+		cursor, err := collection.Find(ctx, filter,
+			options.Find().SetProjection(bson.M{"_id": 1}).SetLimit(purgeBatch),
+		)
+		if err != nil {
+			return removed, err
+		}
+
+		var docs []struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cursor.All(ctx, &docs); err != nil {
+			return removed, err
+		}
+		if len(docs) == 0 {
+			return removed, nil
+		}
+
+		ids := make(bson.A, len(docs))
+		for i, doc := range docs {
+			ids[i] = doc.ID
+		}
+
+		res, err := collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+		if err != nil {
+			return removed, err
+		}
+		removed += res.DeletedCount
+
+		if len(docs) < purgeBatch {
+			return removed, nil
+		}
+	}
+}
+
+// Purge is a manual removal of the entries created before Before, of one
+// level when Level is set
+type Purge struct {
+	Before  time.Time `bson:"before" json:"before"`
+	Level   string    `bson:"level,omitempty" json:"level,omitempty"`
+	DryRun  bool      `bson:"-" json:"dry_run"`
+	Entries int64     `bson:"entries" json:"entries"`
+	Actor   string    `bson:"actor" json:"actor"`
+	At      time.Time `bson:"at" json:"at"`
+}
+
+// Purge removes the entries created before p.Before, or only counts them with
+// p.DryRun. Purges are recorded so that Verify can tell the gaps they leave in
+// the chain. Write-once mode allows none.
+func (l *LogEntry) Purge(ctx context.Context, p Purge) (*Purge, error) {
+	if writeOnce && !p.DryRun {
+		return nil, ErrWriteOnce
+	}
+
+	filter := bson.M{"created_at": bson.M{"$lt": p.Before}}
+	if p.Level != "" {
+		for key, value := range levelFilter(p.Level) {
+			filter[key] = value
+		}
+	}
+
+	p.At = time.Now()
+
+	if p.DryRun {
+		n, err := client.Database("logs").Collection("logs").CountDocuments(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		p.Entries = n
+		return &p, nil
+	}
+
+	// the purge may remove the last entry, the next one links to it still
+	var last LogEntry
+	err := client.Database("logs").Collection("logs").FindOne(ctx,
+		bson.M{"seq": bson.M{"$gt": 0}},
+		options.FindOne().SetSort(bson.D{{Key: "seq", Value: -1}}),
+	).Decode(&last)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+	if last.Seq > 0 {
+		if err := saveChainHead(ctx, last.Seq, last.Hash); err != nil {
+			return nil, err
+		}
+	}
+
+	// recorded first, a purge that fails halfway leaves gaps too
+	res, err := purgesCollection().InsertOne(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	p.Entries, err = deleteInBatches(ctx, filter)
+	if _, updateErr := purgesCollection().UpdateByID(ctx, res.InsertedID, bson.M{"$set": bson.M{"entries": p.Entries}}); updateErr != nil {
+		log.Println("Error recording the purged entries:", updateErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+func purgesCollection() *mongo.Collection {
+	return client.Database("logs").Collection("log_purges")
+}
+
+// retentionFloor returns the time before which entries may be missing from
+// the chain: the latest manual purge or the shortest retention, zero when no
+// entry may be
+func retentionFloor(ctx context.Context) (time.Time, error) {
+	var floor time.Time
+	if shortest := retention.shortest(); shortest > 0 {
+		floor = time.Now().Add(-shortest)
+	}
+
+	var last Purge
+	err := purgesCollection().FindOne(ctx, bson.M{},
+		options.FindOne().SetSort(bson.D{{Key: "before", Value: -1}}),
+	).Decode(&last)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return floor, err
+	}
+	if last.Before.After(floor) {
+		floor = last.Before
+	}
+
+	return floor, nil
+}
+
+// ConfiguredRetention returns the retention entries are stored with
+func ConfiguredRetention() Retention {
+	return retention
+}
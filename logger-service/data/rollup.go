@@ -0,0 +1,321 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Resolutions of the rollups
+const (
+	RollupMinute = "minute"
+	RollupHour   = "hour"
+)
+
+const (
+	// rollupsID is the id of the progress of the rollups in the settings
+	// collection
+	rollupsID = "rollups"
+
+	// rollupLateness is how long after their minute entries may still be
+	// stored, through the batching writer and redelivered events. The minutes
+	// in it are counted again at every round.
+	rollupLateness = 5 * time.Minute
+
+	// rollupBackfill is how far back the first round counts
+	rollupBackfill = 24 * time.Hour
+
+	// rollupChunk bounds the entries one round counts, so that catching up
+	// after a pause does not scan them all at once
+	rollupChunk = 6 * time.Hour
+
+	rollupBatch = 1000
+)
+
+// rollupRetention is how long the minute rollups are kept, the hour rollups
+// are kept for good
+var rollupRetention = 7 * 24 * time.Hour
+
+// Rollup counts the entries of one name, level and service created in one
+// minute or hour. Rollups outlive the entries they count: the retention and
+// purges of entries do not change them.
+type Rollup struct {
+	Resolution string     `bson:"resolution" json:"resolution"`
+	Start      time.Time  `bson:"start" json:"start"`
+	Service    string     `bson:"service" json:"service"`
+	Level      string     `bson:"level" json:"level"`
+	Name       string     `bson:"name" json:"name"`
+	Count      int64      `bson:"count" json:"count"`
+	ExpiresAt  *time.Time `bson:"expires_at,omitempty" json:"-"`
+}
+
+// RollupRun is what one round of RollupLogs counted
+type RollupRun struct {
+	From    time.Time `json:"from"`
+	Until   time.Time `json:"until"`
+	Minutes int       `json:"minutes"`
+	Hours   int       `json:"hours"`
+}
+
+// RollupQuery selects rollups of one resolution created in [From, To) and sums
+// them by start and the fields in GroupBy, service, level and name
+type RollupQuery struct {
+	Resolution string
+	From, To   time.Time
+	Service    string
+	Level      string
+	Name       string
+	GroupBy    []string
+}
+
+// RollupPoint is the count of entries starting at Start, of the service,
+// level and name when the query grouped by them
+type RollupPoint struct {
+	Start   time.Time `bson:"start" json:"start"`
+	Service string    `bson:"service,omitempty" json:"service,omitempty"`
+	Level   string    `bson:"level,omitempty" json:"level,omitempty"`
+	Name    string    `bson:"name,omitempty" json:"name,omitempty"`
+	Count   int64     `bson:"count" json:"count"`
+}
+
+func rollupsCollection() *mongo.Collection {
+	return client.Database("logs").Collection("rollups")
+}
+
+// ConfigureRollups sets how long the minute rollups are kept, those already
+// stored keep their expiry
+func ConfigureRollups(minutes time.Duration) {
+	rollupRetention = minutes
+}
+
+// ensureRollupIndexes keeps one rollup per resolution, start, service, level
+// and name, and removes the minute rollups once they expire
+func ensureRollupIndexes(ctx context.Context) error {
+	_, err := rollupsCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "resolution", Value: 1}, {Key: "start", Value: 1},
+				{Key: "service", Value: 1}, {Key: "level", Value: 1}, {Key: "name", Value: 1},
+			},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetName("rollups_ttl").SetExpireAfterSeconds(0),
+		},
+	})
+	return err
+}
+
+// RollupLogs counts the entries created since the last round into minute
+// rollups, up to the start of the minute of now, and sums those into hour
+// rollups; the hour of now is counted so far. Counting a span again replaces
+// its rollups, so a round may repeat one that failed.
+func RollupLogs(ctx context.Context, now time.Time) (*RollupRun, error) {
+	var progress struct {
+		Until time.Time `bson:"until"`
+	}
+	err := settingsCollection().FindOne(ctx, bson.M{"_id": rollupsID}).Decode(&progress)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+
+	run := &RollupRun{Until: now.UTC().Truncate(time.Minute)}
+	run.From = run.Until.Add(-rollupBackfill)
+	if !progress.Until.IsZero() {
+		run.From = progress.Until.UTC().Add(-rollupLateness)
+	}
+	if run.Until.Sub(run.From) > rollupChunk {
+		run.Until = run.From.Add(rollupChunk)
+	}
+
+	run.Minutes, err = rollupMinutes(ctx, run.From, run.Until)
+	if err != nil {
+		return nil, fmt.Errorf("minute rollups: %w", err)
+	}
+
+	// the hours are summed from the minute rollups of their start on
+	run.Hours, err = rollupHours(ctx, run.From.Truncate(time.Hour), run.Until)
+	if err != nil {
+		return nil, fmt.Errorf("hour rollups: %w", err)
+	}
+
+	_, err = settingsCollection().UpdateOne(ctx,
+		bson.M{"_id": rollupsID},
+		bson.M{"$set": bson.M{"until": run.Until, "updated_at": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return run, nil
+}
+
+// rollupMinutes counts the entries created in [from, until) by minute
+func rollupMinutes(ctx context.Context, from, until time.Time) (int, error) {
+	cursor, err := client.Database("logs").Collection("logs").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"created_at": bson.M{"$gte": from, "$lt": until}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{
+				"start":   truncateDate("$created_at", time.Minute),
+				"service": bson.M{"$ifNull": bson.A{"$service", ""}},
+				"level":   rollupLevel,
+				"name":    "$name",
+			},
+			"count": bson.M{"$sum": 1},
+		}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return storeRollups(ctx, cursor, RollupMinute)
+}
+
+// rollupHours sums the minute rollups of [from, until) by hour
+func rollupHours(ctx context.Context, from, until time.Time) (int, error) {
+	cursor, err := rollupsCollection().Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"resolution": RollupMinute,
+			"start":      bson.M{"$gte": from, "$lt": until},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{
+				"start":   truncateDate("$start", time.Hour),
+				"service": "$service",
+				"level":   "$level",
+				"name":    "$name",
+			},
+			"count": bson.M{"$sum": "$count"},
+		}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return storeRollups(ctx, cursor, RollupHour)
+}
+
+// rollupLevel is the aggregation expression of the level of an entry, those
+// without one are info entries, see levelFilter
+var rollupLevel = bson.M{"$cond": bson.A{
+	bson.M{"$in": bson.A{bson.M{"$ifNull": bson.A{"$level", ""}}, bson.A{"", "info"}}},
+	"info",
+	"$level",
+}}
+
+// truncateDate is the aggregation expression of the date of field truncated
+// to a multiple of d, $dateTrunc needs Mongo 5
+func truncateDate(field string, d time.Duration) bson.M {
+	return bson.M{"$subtract": bson.A{
+		field,
+		bson.M{"$mod": bson.A{bson.M{"$toLong": field}, d.Milliseconds()}},
+	}}
+}
+
+// storeRollups upserts the counts grouped by an aggregation, rollupBatch at a
+// time, and returns how many there were
+func storeRollups(ctx context.Context, cursor *mongo.Cursor, resolution string) (int, error) {
+	defer cursor.Close(ctx)
+
+	stored := 0
+	models := make([]mongo.WriteModel, 0, rollupBatch)
+
+	flush := func() error {
+		if len(models) == 0 {
+			return nil
+		}
+		_, err := rollupsCollection().BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+		stored += len(models)
+		models = models[:0]
+		return err
+	}
+
+	for cursor.Next(ctx) {
+		var group struct {
+			Key struct {
+				Start   time.Time `bson:"start"`
+				Service string    `bson:"service"`
+				Level   string    `bson:"level"`
+				Name    string    `bson:"name"`
+			} `bson:"_id"`
+			Count int64 `bson:"count"`
+		}
+		if err := cursor.Decode(&group); err != nil {
+			return stored, err
+		}
+
+		set := bson.M{"count": group.Count}
+		if resolution == RollupMinute {
+			set["expires_at"] = group.Key.Start.Add(rollupRetention)
+		}
+
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{
+				"resolution": resolution,
+				"start":      group.Key.Start,
+				"service":    group.Key.Service,
+				"level":      group.Key.Level,
+				"name":       group.Key.Name,
+			}).
+			SetUpdate(bson.M{"$set": set}).
+			SetUpsert(true))
+
+		if len(models) == rollupBatch {
+			if err := flush(); err != nil {
+				return stored, err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return stored, err
+	}
+
+	return stored, flush()
+}
+
+// Rollups returns the counts of the rollups matching q by start, oldest first
+func Rollups(ctx context.Context, q RollupQuery) ([]RollupPoint, error) {
+	match := bson.M{
+		"resolution": q.Resolution,
+		"start":      bson.M{"$gte": q.From, "$lt": q.To},
+	}
+	if q.Service != "" {
+		match["service"] = q.Service
+	}
+	if q.Level != "" {
+		match["level"] = q.Level
+	}
+	if q.Name != "" {
+		match["name"] = q.Name
+	}
+
+	key := bson.M{"start": "$start"}
+	for _, field := range q.GroupBy {
+		key[field] = "$" + field
+	}
+
+	cursor, err := rollupsCollection().Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{"_id": key, "count": bson.M{"$sum": "$count"}}}},
+		{{Key: "$replaceRoot", Value: bson.M{"newRoot": bson.M{"$mergeObjects": bson.A{"$_id", bson.M{"count": "$count"}}}}}},
+		{{Key: "$sort", Value: bson.D{
+			{Key: "start", Value: 1}, {Key: "service", Value: 1}, {Key: "level", Value: 1}, {Key: "name", Value: 1},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	points := []RollupPoint{}
+	if err := cursor.All(ctx, &points); err != nil {
+		return nil, err
+	}
+	return points, nil
+}
@@ -0,0 +1,408 @@
+package data
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// emptySHA256 is the payload hash of requests without a body
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3Backups keeps archives as objects in a bucket of S3 or of a store that
+// speaks its API with HMAC keys, GCS at https://storage.googleapis.com with
+// region auto or MinIO. Objects are addressed path style, endpoint/bucket/key,
+// and requests are signed with AWS signature version 4.
+type S3Backups struct {
+	// Endpoint is the base URL of the store, e.g. https://s3.eu-central-1.amazonaws.com
+	Endpoint string
+	Region   string
+	Bucket   string
+
+	// Prefix is put before the names of the archives, e.g. logger/
+	Prefix string
+
+	AccessKey string
+	SecretKey string
+
+	// Client sends the requests, http.DefaultClient when nil
+	Client *http.Client
+}
+
+var _ BackupStore = (*S3Backups)(nil)
+
+// s3Error is the body of a failed request
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// listBucketResult is the answer of ListObjectsV2
+type listBucketResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		LastModified time.Time `xml:"LastModified"`
+		ETag         string    `xml:"ETag"`
+		Size         int64     `xml:"Size"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// s3Request is one request to the bucket, key is empty for the bucket itself
+type s3Request struct {
+	method      string
+	key         string
+	query       url.Values
+	header      http.Header
+	body        io.Reader
+	size        int64
+	payloadHash string
+}
+
+// do signs and sends a request, answers outside 2xx are returned as errors
+// with the status and code of the store
+func (s *S3Backups) do(ctx context.Context, r s3Request) (*http.Response, error) {
+	u := strings.TrimRight(s.Endpoint, "/") + "/" + s3Escape(s.Bucket, false)
+	if r.key != "" {
+		u += "/" + s3Escape(r.key, true)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, r.method, u, r.body)
+	if err != nil {
+		return nil, err
+	}
+	req.URL.RawQuery = s3Query(r.query)
+	for name, values := range r.header {
+		req.Header[name] = values
+	}
+	if r.body != nil {
+		req.ContentLength = r.size
+	}
+
+	payloadHash := r.payloadHash
+	if payloadHash == "" {
+		payloadHash = emptySHA256
+	}
+	signV4(req, payloadHash, s.Region, s.AccessKey, s.SecretKey, time.Now())
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+
+		var body s3Error
+		xml.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&body)
+
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, ErrBackupNotFound
+		}
+		return nil, fmt.Errorf("%s %s: %s %s %s", r.method, req.URL.Path, resp.Status, body.Code, body.Message)
+	}
+
+	return resp, nil
+}
+
+// s3Writer spools an archive to a temporary file and uploads it on commit,
+// a single PUT makes the object appear complete or not at all
+type s3Writer struct {
+	ctx   context.Context
+	store *S3Backups
+	key   string
+	f     *os.File
+	hash  hash.Hash
+	size  int64
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) {
+	n, err := w.f.Write(p)
+	w.hash.Write(p[:n])
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *s3Writer) Commit() error {
+	if _, err := w.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	resp, err := w.store.do(w.ctx, s3Request{
+		method:      http.MethodPut,
+		key:         w.key,
+		header:      http.Header{"Content-Type": {"application/gzip"}},
+		body:        w.f,
+		size:        w.size,
+		payloadHash: hex.EncodeToString(w.hash.Sum(nil)),
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+func (w *s3Writer) Close() error {
+	w.f.Close()
+	return os.Remove(w.f.Name())
+}
+
+// Create starts a new archive, it is uploaded on commit
+func (s *S3Backups) Create(ctx context.Context, name string) (BackupWriter, error) {
+	if !validBackupName(name) {
+		return nil, fmt.Errorf("invalid backup name %q", name)
+	}
+
+	f, err := os.CreateTemp("", name+".*.part")
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3Writer{ctx: ctx, store: s, key: s.Prefix + name, f: f, hash: sha256.New()}, nil
+}
+
+// Open looks up a stored archive, its content is fetched with ranged GETs as
+// it is read
+func (s *S3Backups) Open(ctx context.Context, name string) (io.ReadSeekCloser, BackupInfo, error) {
+	if !validBackupName(name) {
+		return nil, BackupInfo{}, ErrBackupNotFound
+	}
+
+	resp, err := s.do(ctx, s3Request{method: http.MethodHead, key: s.Prefix + name})
+	if err != nil {
+		return nil, BackupInfo{}, err
+	}
+	resp.Body.Close()
+
+	info := BackupInfo{
+		Name: name,
+		Size: resp.ContentLength,
+		ETag: resp.Header.Get("ETag"),
+	}
+	info.CreatedAt, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+
+	return &s3Object{ctx: ctx, store: s, key: s.Prefix + name, size: info.Size}, info, nil
+}
+
+// List returns the stored archives, newest first
+func (s *S3Backups) List(ctx context.Context) ([]BackupInfo, error) {
+	var backups []BackupInfo
+
+	query := url.Values{"list-type": {"2"}, "prefix": {s.Prefix}}
+
+	for {
+		resp, err := s.do(ctx, s3Request{method: http.MethodGet, query: query})
+		if errors.Is(err, ErrBackupNotFound) {
+			// no bucket yet, nothing was backed up
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var result listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range result.Contents {
+			name := strings.TrimPrefix(object.Key, s.Prefix)
+			if !validBackupName(name) {
+				continue
+			}
+
+			backups = append(backups, BackupInfo{
+				Name:      name,
+				Size:      object.Size,
+				CreatedAt: object.LastModified,
+				ETag:      object.ETag,
+			})
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+
+	sortBackups(backups)
+
+	return backups, nil
+}
+
+// s3Object reads an object from its offset on, a seek drops the open body so
+// the next read starts a GET at the new offset
+type s3Object struct {
+	ctx    context.Context
+	store  *S3Backups
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+func (o *s3Object) Read(p []byte) (int, error) {
+	if o.offset >= o.size {
+		return 0, io.EOF
+	}
+
+	if o.body == nil {
+		resp, err := o.store.do(o.ctx, s3Request{
+			method: http.MethodGet,
+			key:    o.key,
+			header: http.Header{"Range": {fmt.Sprintf("bytes=%d-", o.offset)}},
+		})
+		if err != nil {
+			return 0, err
+		}
+		o.body = resp.Body
+	}
+
+	n, err := o.body.Read(p)
+	o.offset += int64(n)
+	return n, err
+}
+
+func (o *s3Object) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += o.offset
+	case io.SeekEnd:
+		offset += o.size
+	}
+	if offset < 0 {
+		return 0, errors.New("seek before the start of the archive")
+	}
+
+	if offset != o.offset && o.body != nil {
+		o.body.Close()
+		o.body = nil
+	}
+	o.offset = offset
+
+	return offset, nil
+}
+
+func (o *s3Object) Close() error {
+	if o.body == nil {
+		return nil
+	}
+	return o.body.Close()
+}
+
+// s3Escape encodes a path segment, or a key with its slashes kept, the way
+// the signature expects: everything but unreserved characters is escaped
+func s3Escape(s string, keepSlash bool) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && keepSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+// s3Query encodes a query sorted by name, the canonical form of the signature
+func s3Query(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var parts []string
+	for _, name := range names {
+		for _, value := range query[name] {
+			parts = append(parts, s3Escape(name, false)+"="+s3Escape(value, false))
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// signV4 signs a request for service s3 with AWS signature version 4. The
+// host, the range and the x-amz headers are signed, the payload by its hash.
+func signV4(req *http.Request, payloadHash, region, accessKey, secretKey string, now time.Time) {
+	now = now.UTC()
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-") || name == "range" {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + now.Format("20060102T150405Z") + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+
+		",SignedHeaders="+signedHeaders+",Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,99 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// alertingID is the id of the alerting settings in the settings collection
+const alertingID = "alerting"
+
+// AlertingSettings are the objectives and thresholds the logger alerts on.
+// They start out from the environment; once imported they are stored and take
+// precedence, so they can be promoted from one environment to the next.
+type AlertingSettings struct {
+	Objectives      []Objective   `bson:"slo_objectives" json:"slo_objectives"`
+	SLOWindow       time.Duration `bson:"slo_window" json:"slo_window"`
+	HeartbeatMisses int           `bson:"heartbeat_misses" json:"heartbeat_misses"`
+	UpdatedAt       time.Time     `bson:"updated_at" json:"updated_at"`
+}
+
+// Validate checks the settings before they are stored
+func (s *AlertingSettings) Validate() error {
+	if s.SLOWindow <= 0 {
+		return errors.New("slo_window must be positive")
+	}
+	if s.HeartbeatMisses <= 0 {
+		return errors.New("heartbeat_misses must be positive")
+	}
+
+	seen := make(map[string]bool, len(s.Objectives))
+	for _, o := range s.Objectives {
+		switch {
+		case o.Service == "":
+			return errors.New("objectives need a service")
+		case seen[o.Service]:
+			return fmt.Errorf("service %s has two objectives", o.Service)
+		case o.Availability <= 0 || o.Availability >= 100:
+			return fmt.Errorf("availability of %s must be between 0 and 100", o.Service)
+		case o.LatencyTarget <= 0 || o.LatencyTarget > 100:
+			return fmt.Errorf("latency target of %s must be between 0 and 100", o.Service)
+		case bucketIndex(o.LatencyThreshold) < 0:
+			return fmt.Errorf("latency threshold of %s must be one of %v", o.Service, LatencyBuckets)
+		}
+		seen[o.Service] = true
+	}
+
+	return nil
+}
+
+func settingsCollection() *mongo.Collection {
+	return client.Database("logs").Collection("settings")
+}
+
+// Get returns the stored alerting settings, nil when none were imported
+func (s *AlertingSettings) Get() (*AlertingSettings, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var settings AlertingSettings
+
+	err := settingsCollection().FindOne(ctx, bson.M{"_id": alertingID}).Decode(&settings)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &settings, nil
+}
+
+// Save stores the alerting settings in place of the previous ones
+func (s *AlertingSettings) Save(settings AlertingSettings) (*AlertingSettings, error) {
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	settings.UpdatedAt = time.Now().UTC()
+
+	_, err := settingsCollection().ReplaceOne(ctx,
+		bson.M{"_id": alertingID},
+		settings,
+		options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &settings, nil
+}
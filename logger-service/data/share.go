@@ -0,0 +1,115 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrShareNotFound is returned for unknown share links
+var ErrShareNotFound = errors.New("share link not found")
+
+// ShareLink lets whoever holds its URL read one resource of the admin API
+// until it expires or is revoked. Target is the path and query it is valid
+// for. Links are removed a day after they expired.
+type ShareLink struct {
+	ID        string     `bson:"_id" json:"id"`
+	Target    string     `bson:"target" json:"target"`
+	Note      string     `bson:"note,omitempty" json:"note,omitempty"`
+	CreatedBy string     `bson:"created_by" json:"created_by"`
+	CreatedAt time.Time  `bson:"created_at" json:"created_at"`
+	ExpiresAt time.Time  `bson:"expires_at" json:"expires_at"`
+	RevokedAt *time.Time `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+	Uses      int64      `bson:"uses" json:"uses"`
+	LastUsed  *time.Time `bson:"last_used,omitempty" json:"last_used,omitempty"`
+}
+
+func sharesCollection() *mongo.Collection {
+	return client.Database("logs").Collection("share_links")
+}
+
+// ensureShareIndexes removes share links a day after they expired
+func ensureShareIndexes(ctx context.Context) error {
+	_, err := sharesCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(int32((24 * time.Hour) / time.Second)),
+	})
+	return err
+}
+
+// Insert stores a new share link
+func (s *ShareLink) Insert(link ShareLink) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	_, err := sharesCollection().InsertOne(ctx, link)
+	return err
+}
+
+// All returns the share links that have not expired yet, the newest first
+func (s *ShareLink) All() ([]ShareLink, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	cursor, err := sharesCollection().Find(ctx,
+		bson.M{"expires_at": bson.M{"$gt": time.Now()}},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	links := []ShareLink{}
+	if err := cursor.All(ctx, &links); err != nil {
+		return nil, err
+	}
+
+	return links, nil
+}
+
+// Use counts a use of the link and returns it, ErrShareNotFound when it is
+// unknown, revoked or expired
+func (s *ShareLink) Use(ctx context.Context, id string) (*ShareLink, error) {
+	now := time.Now()
+
+	var link ShareLink
+	err := sharesCollection().FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "revoked_at": nil, "expires_at": bson.M{"$gt": now}},
+		bson.M{"$inc": bson.M{"uses": 1}, "$set": bson.M{"last_used": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&link)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrShareNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &link, nil
+}
+
+// Revoke stops a link from working at once, revoking it again keeps the
+// time it was first revoked
+func (s *ShareLink) Revoke(id string) (*ShareLink, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	var link ShareLink
+	err := sharesCollection().FindOneAndUpdate(ctx,
+		bson.M{"_id": id},
+		bson.A{bson.M{"$set": bson.M{"revoked_at": bson.M{"$ifNull": bson.A{"$revoked_at", time.Now()}}}}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&link)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrShareNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &link, nil
+}
@@ -0,0 +1,264 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LatencyBuckets are the upper bounds of the latency histograms services send
+// with their heartbeats. The last bucket holds everything slower.
+var LatencyBuckets = []time.Duration{
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+}
+
+// RequestStats are the request counts of a service over some period
+type RequestStats struct {
+	Total   int64   `bson:"total" json:"total"`
+	Errors  int64   `bson:"errors" json:"errors"`
+	Buckets []int64 `bson:"buckets" json:"buckets"`
+}
+
+// Objective is the SLO of one service: Availability percent of requests must
+// not fail, and LatencyTarget percent must finish within LatencyThreshold
+type Objective struct {
+	Service          string        `json:"service"`
+	Availability     float64       `json:"availability"`
+	LatencyThreshold time.Duration `json:"latency_threshold"`
+	LatencyTarget    float64       `json:"latency_target"`
+}
+
+// ParseObjectives reads a list like "authentication:99.9:250ms:99,broker:99.5:500ms:95".
+// The latency threshold must be one of LatencyBuckets.
+func ParseObjectives(s string) ([]Objective, error) {
+	var objectives []Objective
+
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		parts := strings.Split(item, ":")
+		if len(parts) != 4 {
+			return nil, fmt.Errorf("invalid SLO %q", item)
+		}
+
+		availability, err1 := strconv.ParseFloat(parts[1], 64)
+		threshold, err2 := time.ParseDuration(parts[2])
+		latency, err3 := strconv.ParseFloat(parts[3], 64)
+		if err := errors.Join(err1, err2, err3); err != nil {
+			return nil, fmt.Errorf("invalid SLO %q: %w", item, err)
+		}
+
+		if bucketIndex(threshold) < 0 {
+			return nil, fmt.Errorf("invalid SLO %q: latency threshold must be one of %v", item, LatencyBuckets)
+		}
+
+		objectives = append(objectives, Objective{
+			Service:          parts[0],
+			Availability:     availability,
+			LatencyThreshold: threshold,
+			LatencyTarget:    latency,
+		})
+	}
+
+	return objectives, nil
+}
+
+func bucketIndex(threshold time.Duration) int {
+	for i, bound := range LatencyBuckets {
+		if bound == threshold {
+			return i
+		}
+	}
+	return -1
+}
+
+// SLOSample holds the request counts of one service for one minute
+type SLOSample struct {
+	Service      string    `bson:"service"`
+	Minute       time.Time `bson:"minute"`
+	RequestStats `bson:",inline"`
+}
+
+// Record adds request counts of service to the current minute
+func (s *SLOSample) Record(service string, stats RequestStats) error {
+	if stats.Total == 0 {
+		return nil
+	}
+
+	collection := client.Database("logs").Collection("slo_samples")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	inc := bson.M{"total": stats.Total, "errors": stats.Errors}
+	for i, n := range stats.Buckets {
+		if i <= len(LatencyBuckets) {
+			inc[fmt.Sprintf("buckets.%d", i)] = n
+		}
+	}
+
+	minute := time.Now().UTC().Truncate(time.Minute)
+
+	_, err := collection.UpdateOne(ctx,
+		bson.M{"service": service, "minute": minute},
+		bson.M{"$inc": inc},
+		options.Update().SetUpsert(true),
+	)
+
+	return err
+}
+
+// Sum adds up the counts of service since the given time
+func (s *SLOSample) Sum(service string, since time.Time) (RequestStats, error) {
+	collection := client.Database("logs").Collection("slo_samples")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	sum := RequestStats{Buckets: make([]int64, len(LatencyBuckets)+1)}
+
+	cursor, err := collection.Find(ctx, bson.M{"service": service, "minute": bson.M{"$gte": since}})
+	if err != nil {
+		return sum, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var sample SLOSample
+		if err := cursor.Decode(&sample); err != nil {
+			return sum, err
+		}
+
+		sum.Total += sample.Total
+		sum.Errors += sample.Errors
+		for i, n := range sample.Buckets {
+			if i < len(sum.Buckets) {
+				sum.Buckets[i] += n
+			}
+		}
+	}
+
+	return sum, cursor.Err()
+}
+
+// SLOReport is the state of one objective over the SLO window
+type SLOReport struct {
+	Service   string    `bson:"service" json:"service"`
+	Window    string    `bson:"window" json:"window"`
+	Requests  int64     `bson:"requests" json:"requests"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+
+	Availability           float64 `bson:"availability" json:"availability"`
+	AvailabilityTarget     float64 `bson:"availability_target" json:"availability_target"`
+	AvailabilityBudgetLeft float64 `bson:"availability_budget_left" json:"availability_budget_left"`
+
+	Latency           float64 `bson:"latency" json:"latency"`
+	LatencyTarget     float64 `bson:"latency_target" json:"latency_target"`
+	LatencyThreshold  string  `bson:"latency_threshold" json:"latency_threshold"`
+	LatencyBudgetLeft float64 `bson:"latency_budget_left" json:"latency_budget_left"`
+}
+
+// badRatios returns the share of failed and of slow requests
+func (o Objective) badRatios(stats RequestStats) (float64, float64) {
+	if stats.Total == 0 {
+		return 0, 0
+	}
+
+	var fast int64
+	idx := bucketIndex(o.LatencyThreshold)
+	for i := 0; i <= idx && i < len(stats.Buckets); i++ {
+		fast += stats.Buckets[i]
+	}
+
+	total := float64(stats.Total)
+	return float64(stats.Errors) / total, float64(stats.Total-fast) / total
+}
+
+// BurnRates returns how fast the availability and latency budgets are being
+// spent, 1 being exactly on budget for the whole window
+func (o Objective) BurnRates(stats RequestStats) (float64, float64) {
+	failed, slow := o.badRatios(stats)
+	return burn(failed, o.Availability), burn(slow, o.LatencyTarget)
+}
+
+func burn(bad, target float64) float64 {
+	budget := 1 - target/100
+	if budget <= 0 {
+		if bad > 0 {
+			return math.Inf(1)
+		}
+		return 0
+	}
+	return bad / budget
+}
+
+// Report computes the objective over stats collected during window
+func (o Objective) Report(stats RequestStats, window time.Duration) SLOReport {
+	failed, slow := o.badRatios(stats)
+	availabilityBurn, latencyBurn := o.BurnRates(stats)
+
+	return SLOReport{
+		Service:   o.Service,
+		Window:    window.String(),
+		Requests:  stats.Total,
+		CreatedAt: time.Now().UTC(),
+
+		Availability:           100 * (1 - failed),
+		AvailabilityTarget:     o.Availability,
+		AvailabilityBudgetLeft: 100 * (1 - availabilityBurn),
+
+		Latency:           100 * (1 - slow),
+		LatencyTarget:     o.LatencyTarget,
+		LatencyThreshold:  o.LatencyThreshold.String(),
+		LatencyBudgetLeft: 100 * (1 - latencyBurn),
+	}
+}
+
+// StoreBudget keeps the latest report of a service, so the error budget can be
+// followed over time
+func (r *SLOReport) StoreBudget() error {
+	collection := client.Database("logs").Collection("slo_budgets")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := collection.InsertOne(ctx, r)
+	return err
+}
+
+// BudgetHistory returns the stored reports of service since the given time, oldest first
+func (r *SLOReport) BudgetHistory(service string, since time.Time) ([]*SLOReport, error) {
+	collection := client.Database("logs").Collection("slo_budgets")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+
+	cursor, err := collection.Find(ctx, bson.M{"service": service, "created_at": bson.M{"$gte": since}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var reports []*SLOReport
+	if err := cursor.All(ctx, &reports); err != nil {
+		return nil, err
+	}
+
+	return reports, nil
+}
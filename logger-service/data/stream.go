@@ -0,0 +1,198 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// streamPollInterval is how often a stream without change streams looks
+	// for new entries
+	streamPollInterval = time.Second
+	// streamCatchUp bounds the entries a resumed stream sends again
+	streamCatchUp = 1000
+)
+
+// StreamFilter narrows a stream to some levels and services, empty lists let
+// every entry through
+type StreamFilter struct {
+	Levels   []string
+	Services []string
+}
+
+// match returns the conditions of the filter on entries stored under prefix,
+// fullDocument. for change events
+func (f StreamFilter) match(prefix string) bson.M {
+	m := bson.M{}
+	if len(f.Levels) > 0 {
+		m[prefix+"level"] = bson.M{"$in": f.Levels}
+	}
+	if len(f.Services) > 0 {
+		m[prefix+"service"] = bson.M{"$in": f.Services}
+	}
+	return m
+}
+
+// LogStream yields the entries stored after it was opened, in the order they
+// were stored. Next blocks until there is one.
+type LogStream struct {
+	filter StreamFilter
+
+	// changes is nil when the store has no change streams, the stream polls
+	changes *mongo.ChangeStream
+
+	// pending are the entries read but not returned yet, last the id of the
+	// last entry returned
+	pending []*LogEntry
+	last    primitive.ObjectID
+}
+
+// Stream opens a stream of the new entries matching filter. With after, the id
+// of an entry, it first returns the entries stored since that one, at most
+// streamCatchUp of them, so a client that lost its connection misses none.
+// Mongo reports new entries through change streams on replica sets; a
+// standalone server is polled instead.
+func (l *LogEntry) Stream(ctx context.Context, filter StreamFilter, after string) (*LogStream, error) {
+	collection := client.Database("logs").Collection("logs")
+
+	s := &LogStream{filter: filter}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"operationType": "insert"}}},
+	}
+	if m := filter.match("fullDocument."); len(m) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: m}})
+	}
+
+	changes, err := collection.Watch(ctx, pipeline)
+	switch {
+	case err == nil:
+		s.changes = changes
+	case isChangeStreamUnsupported(err):
+		// the first poll starts from the newest entry
+	default:
+		return nil, err
+	}
+
+	if after != "" {
+		id, err := primitive.ObjectIDFromHex(after)
+		if err != nil {
+			s.Close(ctx)
+			return nil, ErrInvalidCursor
+		}
+		s.last = id
+
+		if err := s.poll(ctx, streamCatchUp); err != nil {
+			s.Close(ctx)
+			return nil, err
+		}
+		return s, nil
+	}
+
+	if s.changes == nil {
+		var newest LogEntry
+		err := collection.FindOne(ctx, bson.M{}, options.FindOne().SetSort(bson.D{{Key: "_id", Value: -1}})).Decode(&newest)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, err
+		}
+		if newest.ID != "" {
+			s.last, _ = primitive.ObjectIDFromHex(newest.ID)
+		}
+	}
+
+	return s, nil
+}
+
+// isChangeStreamUnsupported tells the errors of servers that are not part of
+// a replica set
+func isChangeStreamUnsupported(err error) bool {
+	var cmdErr mongo.CommandError
+	if !errors.As(err, &cmdErr) {
+		return false
+	}
+	// 40573: $changeStream is only supported on replica sets
+	return cmdErr.Code == 40573 || cmdErr.Name == "IllegalOperation"
+}
+
+// Next returns the next entry, or the error of ctx once it is done
+func (s *LogStream) Next(ctx context.Context) (*LogEntry, error) {
+	for len(s.pending) == 0 {
+		if s.changes == nil {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(streamPollInterval):
+			}
+			if err := s.poll(ctx, 500); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if !s.changes.Next(ctx) {
+			if err := s.changes.Err(); err != nil {
+				return nil, err
+			}
+			return nil, ctx.Err()
+		}
+
+		var change struct {
+			FullDocument LogEntry `bson:"fullDocument"`
+		}
+		if err := s.changes.Decode(&change); err != nil {
+			return nil, err
+		}
+
+		// entries sent while catching up come again from the change stream
+		id, err := primitive.ObjectIDFromHex(change.FullDocument.ID)
+		if err == nil && !s.last.IsZero() && bytes.Compare(id[:], s.last[:]) <= 0 {
+			continue
+		}
+		s.pending = append(s.pending, &change.FullDocument)
+	}
+
+	entry := s.pending[0]
+	s.pending = s.pending[1:]
+	if id, err := primitive.ObjectIDFromHex(entry.ID); err == nil {
+		s.last = id
+	}
+
+	return entry, nil
+}
+
+// poll reads up to limit entries stored after the last one returned
+func (s *LogStream) poll(ctx context.Context, limit int64) error {
+	filter := s.filter.match("")
+	if !s.last.IsZero() {
+		filter["_id"] = bson.M{"$gt": s.last}
+	}
+
+	cursor, err := client.Database("logs").Collection("logs").Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(limit),
+	)
+	if err != nil {
+		return err
+	}
+
+	var entries []*LogEntry
+	if err := cursor.All(ctx, &entries); err != nil {
+		return err
+	}
+	s.pending = append(s.pending, entries...)
+
+	return nil
+}
+
+// Close releases the change stream
+func (s *LogStream) Close(ctx context.Context) {
+	if s.changes != nil {
+		s.changes.Close(ctx)
+	}
+}
@@ -0,0 +1,313 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// tokenPrefix marks ingest tokens so they are easy to spot in configs and leaks
+const tokenPrefix = "lgi_"
+
+// tokenCacheTTL is how long a successful token lookup is trusted before it is
+// read again from Mongo, which bounds how long a revoked token keeps working
+const tokenCacheTTL = 30 * time.Second
+
+// ErrInvalidToken is returned when an ingest token is unknown, revoked or expired
+var ErrInvalidToken = errors.New("invalid ingest token")
+
+// IngestToken is a per-producer credential for writing log entries. Only the
+// sha256 of the token is stored.
+type IngestToken struct {
+	ID        string     `bson:"_id,omitempty" json:"id,omitempty"`
+	Producer  string     `bson:"producer" json:"producer"`
+	TokenHash string     `bson:"token_hash" json:"-"`
+	Prefix    string     `bson:"prefix" json:"prefix"`
+	CreatedAt time.Time  `bson:"created_at" json:"created_at"`
+	ExpiresAt *time.Time `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	RevokedAt *time.Time `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+
+	// client addresses the token may be used from, see ipfilter
+	AllowCIDRs []string `bson:"allow_cidrs,omitempty" json:"allow_cidrs,omitempty"`
+	DenyCIDRs  []string `bson:"deny_cidrs,omitempty" json:"deny_cidrs,omitempty"`
+}
+
+type cachedToken struct {
+	token     IngestToken
+	fetchedAt time.Time
+}
+
+var tokenCache = struct {
+	sync.Mutex
+	items map[string]cachedToken
+}{items: make(map[string]cachedToken)}
+
+// active reports whether the token can be used at the given time
+func (t *IngestToken) active(now time.Time) bool {
+	if t.RevokedAt != nil {
+		return false
+	}
+	return t.ExpiresAt == nil || now.Before(*t.ExpiresAt)
+}
+
+func newTokenValue() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return tokenPrefix + hex.EncodeToString(b), nil
+}
+
+// Issue creates a new token for a producer and returns it together with the
+// plain text value, which is never stored and cannot be shown again
+func (t *IngestToken) Issue(producer string) (*IngestToken, string, error) {
+	plain, err := newTokenValue()
+	if err != nil {
+		return nil, "", err
+	}
+
+	token, err := t.store(producer, plain)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return token, plain, nil
+}
+
+func (t *IngestToken) store(producer, plain string) (*IngestToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	collection := client.Database("logs").Collection("ingest_tokens")
+
+	token := IngestToken{
+		Producer:  producer,
+		TokenHash: digest(plain),
+		Prefix:    plain[:len(tokenPrefix)+6],
+		CreatedAt: time.Now(),
+	}
+
+	res, err := collection.InsertOne(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if id, ok := res.InsertedID.(primitive.ObjectID); ok {
+		token.ID = id.Hex()
+	}
+
+	return &token, nil
+}
+
+// Bootstrap makes sure the given producer tokens exist, so producers configured
+// through the environment can log as soon as the service starts. The value is a
+// comma separated list of producer:token pairs.
+func (t *IngestToken) Bootstrap(pairs string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	collection := client.Database("logs").Collection("ingest_tokens")
+
+	for _, pair := range strings.Split(pairs, ",") {
+		producer, plain, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || producer == "" || plain == "" {
+			continue
+		}
+
+		count, err := collection.CountDocuments(ctx, bson.M{"token_hash": digest(plain)})
+		if err != nil {
+			return err
+		}
+
+		if count > 0 {
+			continue
+		}
+
+		if _, err := t.store(producer, plain); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Authenticate resolves a plain text token to the producer it was issued to
+func (t *IngestToken) Authenticate(plain string) (*IngestToken, error) {
+	if plain == "" {
+		return nil, ErrInvalidToken
+	}
+
+	hash := digest(plain)
+	now := time.Now()
+
+	tokenCache.Lock()
+	cached, ok := tokenCache.items[hash]
+	tokenCache.Unlock()
+
+	if ok && now.Sub(cached.fetchedAt) < tokenCacheTTL {
+		if !cached.token.active(now) {
+			return nil, ErrInvalidToken
+		}
+		return &cached.token, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database("logs").Collection("ingest_tokens")
+
+	var token IngestToken
+	err := collection.FindOne(ctx, bson.M{"token_hash": hash}).Decode(&token)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	tokenCache.Lock()
+	tokenCache.items[hash] = cachedToken{token: token, fetchedAt: now}
+	tokenCache.Unlock()
+
+	if !token.active(now) {
+		return nil, ErrInvalidToken
+	}
+
+	return &token, nil
+}
+
+// AllTokens returns every token, newest first
+func (t *IngestToken) AllTokens() ([]*IngestToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	collection := client.Database("logs").Collection("ingest_tokens")
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+
+	cursor, err := collection.Find(ctx, bson.D{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var tokens []*IngestToken
+	if err := cursor.All(ctx, &tokens); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// Rotate issues a new token for the same producer and lets the old one expire
+// after the grace period, so producers can switch over without dropping logs
+func (t *IngestToken) Rotate(id string, grace time.Duration) (*IngestToken, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	collection := client.Database("logs").Collection("ingest_tokens")
+
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var old IngestToken
+	if err := collection.FindOne(ctx, bson.M{"_id": docID}).Decode(&old); err != nil {
+		return nil, "", err
+	}
+
+	if !old.active(time.Now()) {
+		return nil, "", ErrInvalidToken
+	}
+
+	token, plain, err := t.Issue(old.Producer)
+	if err != nil {
+		return nil, "", err
+	}
+
+	expires := time.Now().Add(grace)
+	_, err = collection.UpdateOne(ctx,
+		bson.M{"_id": docID},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "expires_at", Value: expires}}}},
+	)
+	if err != nil {
+		return nil, "", err
+	}
+
+	forgetToken(old.TokenHash)
+
+	return token, plain, nil
+}
+
+// Revoke disables a token immediately
+func (t *IngestToken) Revoke(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	collection := client.Database("logs").Collection("ingest_tokens")
+
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	var token IngestToken
+	err = collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": docID},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "revoked_at", Value: time.Now()}}}},
+	).Decode(&token)
+	if err != nil {
+		return err
+	}
+
+	forgetToken(token.TokenHash)
+
+	return nil
+}
+
+func forgetToken(hash string) {
+	tokenCache.Lock()
+	delete(tokenCache.items, hash)
+	tokenCache.Unlock()
+}
+
+// SetIPRules replaces the address lists of a token. Empty lists remove the
+// restriction.
+func (t *IngestToken) SetIPRules(id string, allow, deny []string) (*IngestToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	collection := client.Database("logs").Collection("ingest_tokens")
+
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var token IngestToken
+	err = collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": docID},
+		bson.M{"$set": bson.M{"allow_cidrs": allow, "deny_cidrs": deny}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&token)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	forgetToken(token.TokenHash)
+
+	return &token, nil
+}
@@ -0,0 +1,65 @@
+package data
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	traceIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+	spanIDPattern  = regexp.MustCompile(`^[0-9a-f]{16}$`)
+)
+
+// ValidTraceID reports whether id is a W3C trace id
+func ValidTraceID(id string) bool {
+	return traceIDPattern.MatchString(id) && id != strings.Repeat("0", 32)
+}
+
+// ValidSpanID reports whether id is a W3C span id
+func ValidSpanID(id string) bool {
+	return spanIDPattern.MatchString(id) && id != strings.Repeat("0", 16)
+}
+
+// ParseTraceparent returns the trace and span id of a W3C traceparent header,
+// e.g. 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func ParseTraceparent(header string) (string, string, bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 {
+		return "", "", false
+	}
+
+	traceID, spanID := strings.ToLower(parts[1]), strings.ToLower(parts[2])
+	if !ValidTraceID(traceID) || !ValidSpanID(spanID) {
+		return "", "", false
+	}
+
+	return traceID, spanID, true
+}
+
+// ByTrace returns the entries of one trace in the order they were written
+func (l *LogEntry) ByTrace(traceID string) ([]*LogEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	collection := client.Database("logs").Collection("logs")
+
+	opts := options.Find().SetSort(bson.D{{Key: "seq", Value: 1}}).SetLimit(1000)
+
+	cursor, err := collection.Find(ctx, bson.M{"trace_id": traceID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var logs []*LogEntry
+	if err := cursor.All(ctx, &logs); err != nil {
+		return nil, err
+	}
+
+	return logs, nil
+}
@@ -0,0 +1,222 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrBackpressure is returned when the write queue stays full for longer than
+// the enqueue timeout. Callers should ask the producer to retry later.
+var ErrBackpressure = errors.New("log writer is saturated, retry later")
+
+// ErrWriterStopped is returned when entries are written after StopWriter
+var ErrWriterStopped = errors.New("log writer is stopped")
+
+// WriterConfig controls how the bulk writer groups entries
+type WriterConfig struct {
+	// FlushInterval is the longest an entry waits before its batch is written
+	FlushInterval time.Duration
+	// MaxBatch is the number of entries that triggers an immediate flush
+	MaxBatch int
+	// QueueSize bounds the number of entries waiting to be written
+	QueueSize int
+	// EnqueueTimeout is how long Insert waits for room in the queue
+	EnqueueTimeout time.Duration
+}
+
+type pendingEntry struct {
+	entry *LogEntry
+	done  chan error
+}
+
+// bulkWriter collects entries from concurrent requests and writes them to Mongo
+// with a single InsertMany per batch
+type bulkWriter struct {
+	cfg   WriterConfig
+	queue chan pendingEntry
+	stop  chan struct{}
+	wg    sync.WaitGroup
+
+	// mu is held for reading while an entry is handed to the queue and for
+	// writing while the writer closes, so no entry lands in the queue after
+	// run drained it
+	mu     sync.RWMutex
+	closed bool
+
+	// write stores a batch in order and returns how many entries it stored
+	write func(ctx context.Context, entries []*LogEntry) (int, error)
+}
+
+// writer is the bulk writer of Insert, it stays in place once stopped so that
+// late entries get ErrWriterStopped
+var writer atomic.Pointer[bulkWriter]
+
+// StartWriter starts the bulk writer used by Insert. Zero values in the config
+// are replaced by defaults.
+func StartWriter(cfg WriterConfig) {
+	writer.Store(newBulkWriter(cfg, chain.appendMany))
+}
+
+func newBulkWriter(cfg WriterConfig, write func(ctx context.Context, entries []*LogEntry) (int, error)) *bulkWriter {
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 50 * time.Millisecond
+	}
+	if cfg.MaxBatch <= 0 {
+		cfg.MaxBatch = 500
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 10 * cfg.MaxBatch
+	}
+	if cfg.EnqueueTimeout <= 0 {
+		cfg.EnqueueTimeout = time.Second
+	}
+
+	b := &bulkWriter{
+		cfg:   cfg,
+		queue: make(chan pendingEntry, cfg.QueueSize),
+		stop:  make(chan struct{}),
+		write: write,
+	}
+
+	b.wg.Add(1)
+	go b.run()
+
+	return b
+}
+
+// StopWriter flushes everything still queued and stops the writer. Entries
+// inserted afterwards, e.g. by connections still open past the shutdown
+// timeout, are refused with ErrWriterStopped.
+func StopWriter() {
+	if b := writer.Load(); b != nil {
+		b.close()
+	}
+}
+
+// close flushes everything still queued and stops the writer, it waits for
+// the entries being queued and returns at once when the writer is closed
+func (b *bulkWriter) close() {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.closed = true
+	b.mu.Unlock()
+
+	close(b.stop)
+	b.wg.Wait()
+}
+
+// enqueue hands an entry to the writer and waits until its batch is written
+func (b *bulkWriter) enqueue(e *LogEntry) error {
+	p := pendingEntry{entry: e, done: make(chan error, 1)}
+
+	timer := time.NewTimer(b.cfg.EnqueueTimeout)
+	defer timer.Stop()
+
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		return ErrWriterStopped
+	}
+	select {
+	case b.queue <- p:
+	case <-timer.C:
+		b.mu.RUnlock()
+		return ErrBackpressure
+	}
+	b.mu.RUnlock()
+
+	return <-p.done
+}
+
+func (b *bulkWriter) run() {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(b.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]pendingEntry, 0, b.cfg.MaxBatch)
+
+	for {
+		select {
+		case p := <-b.queue:
+			batch = append(batch, p)
+			if len(batch) >= b.cfg.MaxBatch {
+				b.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				b.flush(batch)
+				batch = batch[:0]
+			}
+		case <-b.stop:
+			// drain whatever made it into the queue before stopping
+			for {
+				select {
+				case p := <-b.queue:
+					batch = append(batch, p)
+					if len(batch) >= b.cfg.MaxBatch {
+						b.flush(batch)
+						batch = batch[:0]
+					}
+				default:
+					if len(batch) > 0 {
+						b.flush(batch)
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+func (b *bulkWriter) flush(batch []pendingEntry) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	entries := make([]*LogEntry, len(batch))
+	for i, p := range batch {
+		entries[i] = p.entry
+	}
+
+	inserted, err := b.write(ctx, entries)
+	if err != nil {
+		log.Printf("Error writing batch of %d log entries, %d written: %v", len(batch), inserted, err)
+	}
+
+	for i, p := range batch {
+		if i < inserted {
+			p.done <- nil
+		} else {
+			p.done <- err
+		}
+	}
+}
+
+// insertedCount works out how many documents of an ordered InsertMany made it
+// into the collection before the first failure
+func insertedCount(res *mongo.InsertManyResult, err error, total int) int {
+	if err == nil {
+		return total
+	}
+
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && len(bulkErr.WriteErrors) > 0 {
+		return bulkErr.WriteErrors[0].Index
+	}
+
+	if res != nil {
+		return len(res.InsertedIDs)
+	}
+
+	return 0
+}
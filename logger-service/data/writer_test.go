@@ -0,0 +1,147 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBulkWriterPartialFailure(t *testing.T) {
+	failed := errors.New("duplicate key")
+
+	b := newBulkWriter(WriterConfig{FlushInterval: time.Hour, MaxBatch: 4}, func(ctx context.Context, entries []*LogEntry) (int, error) {
+		return 2, failed
+	})
+	defer b.close()
+
+	errs := make([]error, 4)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = b.enqueue(&LogEntry{Name: fmt.Sprint(i)})
+		}()
+	}
+	wg.Wait()
+
+	// the batch is written in queue order, which entries made it depends on
+	// the order they were queued in
+	ok := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			ok++
+		case !errors.Is(err, failed):
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	if ok != 2 {
+		t.Fatalf("%d entries reported written, want 2", ok)
+	}
+}
+
+// TestBulkWriterStopWhileEnqueueing stops the writer under concurrent
+// entries: each one is either written or refused, none waits forever
+func TestBulkWriterStopWhileEnqueueing(t *testing.T) {
+	var mu sync.Mutex
+	written := 0
+
+	b := newBulkWriter(WriterConfig{FlushInterval: time.Millisecond, MaxBatch: 8, QueueSize: 16}, func(ctx context.Context, entries []*LogEntry) (int, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		written += len(entries)
+		return len(entries), nil
+	})
+
+	const producers = 32
+	accepted := make([]int, producers)
+	var wg sync.WaitGroup
+	for i := range producers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				err := b.enqueue(&LogEntry{Name: fmt.Sprint(i)})
+				if errors.Is(err, ErrWriterStopped) {
+					return
+				}
+				if err != nil {
+					t.Errorf("unexpected error %v", err)
+					return
+				}
+				accepted[i]++
+			}
+		}()
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	b.close()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("entries still waiting after the writer stopped")
+	}
+
+	total := 0
+	for _, n := range accepted {
+		total += n
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if written != total {
+		t.Errorf("%d entries written, %d reported written", written, total)
+	}
+
+	if err := b.enqueue(&LogEntry{Name: "late"}); !errors.Is(err, ErrWriterStopped) {
+		t.Errorf("entry after close got %v, want ErrWriterStopped", err)
+	}
+}
+
+// BenchmarkBulkWriter measures the batching around the Mongo writes, which
+// are left out, with enough concurrent requests to fill the batches
+func BenchmarkBulkWriter(b *testing.B) {
+	w := newBulkWriter(WriterConfig{FlushInterval: time.Millisecond, MaxBatch: 16}, func(ctx context.Context, entries []*LogEntry) (int, error) {
+		return len(entries), nil
+	})
+	defer w.close()
+
+	b.SetParallelism(16)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := w.enqueue(&LogEntry{Name: "bench", Data: "entry"}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkHashEntry(b *testing.B) {
+	e := LogEntry{
+		Seq:       1234567,
+		PrevHash:  "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		Name:      "authentication",
+		Data:      "Logged in user ada@example.com",
+		Producer:  "authentication",
+		Level:     "info",
+		Service:   "api",
+		Fields:    map[string]string{"method": "POST", "path": "/authenticate", "status": "202"},
+		CreatedAt: time.Now(),
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		hashEntry(e)
+	}
+}
@@ -0,0 +1,96 @@
+package ipfilter
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// MaxRanges bounds the ranges of one list
+const MaxRanges = 1000
+
+// Filter is an allowlist and a denylist. An address is allowed when it is in
+// no denied range and, if the allowlist is not empty, in an allowed one.
+type Filter struct {
+	allow [2]Trie // IPv4, IPv6
+	deny  [2]Trie
+}
+
+// New builds a filter from lists of CIDR ranges or single addresses
+func New(allow, deny []string) (*Filter, error) {
+	if len(allow) > MaxRanges || len(deny) > MaxRanges {
+		return nil, fmt.Errorf("at most %d ranges per list", MaxRanges)
+	}
+
+	f := &Filter{}
+
+	if err := insertAll(&f.allow, allow); err != nil {
+		return nil, err
+	}
+	if err := insertAll(&f.deny, deny); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Allowed reports whether addr passes the filter. A nil filter allows all.
+func (f *Filter) Allowed(addr netip.Addr) bool {
+	if f == nil {
+		return true
+	}
+
+	addr = addr.Unmap()
+	family := familyOf(addr)
+
+	if f.deny[family].Contains(addr) {
+		return false
+	}
+	if f.allow[0].Len()+f.allow[1].Len() == 0 {
+		return true
+	}
+
+	return f.allow[family].Contains(addr)
+}
+
+// Parse reads a CIDR range, or a single address as a range of one
+func Parse(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil || (prefix.Addr().Is4In6() && prefix.Bits() < 96) {
+			return netip.Prefix{}, fmt.Errorf("invalid range %q", s)
+		}
+		if prefix.Addr().Is4In6() {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		return prefix, nil
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid address %q", s)
+	}
+	addr = addr.Unmap()
+
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+func insertAll(tries *[2]Trie, ranges []string) error {
+	for _, s := range ranges {
+		prefix, err := Parse(s)
+		if err != nil {
+			return err
+		}
+		tries[familyOf(prefix.Addr())].Insert(prefix)
+	}
+	return nil
+}
+
+func familyOf(addr netip.Addr) int {
+	if addr.Is4() {
+		return 0
+	}
+	return 1
+}
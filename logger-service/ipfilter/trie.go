@@ -0,0 +1,67 @@
+// Package ipfilter decides whether a client address is allowed by lists of
+// CIDR ranges. The ranges are kept in binary radix trees, so a lookup costs at
+// most one step per address bit however long the lists are.
+package ipfilter
+
+import "net/netip"
+
+type node struct {
+	child [2]*node
+	// end marks that a range ends at this node
+	end bool
+}
+
+// Trie holds a set of CIDR ranges of one address family
+type Trie struct {
+	root node
+	size int
+}
+
+// Insert adds a range. Ranges covered by a shorter one are kept but never
+// reached, since lookups stop at the first range they find.
+func (t *Trie) Insert(prefix netip.Prefix) {
+	prefix = prefix.Masked()
+	addr := prefix.Addr().AsSlice()
+
+	n := &t.root
+	for i := 0; i < prefix.Bits(); i++ {
+		b := bit(addr, i)
+		if n.child[b] == nil {
+			n.child[b] = &node{}
+		}
+		n = n.child[b]
+	}
+
+	if !n.end {
+		n.end = true
+		t.size++
+	}
+}
+
+// Contains reports whether addr is in one of the ranges
+func (t *Trie) Contains(addr netip.Addr) bool {
+	b := addr.AsSlice()
+
+	n := &t.root
+	for i := 0; ; i++ {
+		if n.end {
+			return true
+		}
+		if i == len(b)*8 {
+			return false
+		}
+		n = n.child[bit(b, i)]
+		if n == nil {
+			return false
+		}
+	}
+}
+
+// Len returns the number of ranges
+func (t *Trie) Len() int {
+	return t.size
+}
+
+func bit(b []byte, i int) int {
+	return int(b[i/8]>>(7-uint(i%8))) & 1
+}
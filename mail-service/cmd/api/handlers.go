@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"strings"
+)
+
+// sendRequest is the body of POST /send. Template names a pair of templates,
+// "mail" when empty, and Data fills them in.
+type sendRequest struct {
+	From     string         `json:"from"`
+	To       string         `json:"to"`
+	Subject  string         `json:"subject"`
+	Template string         `json:"template"`
+	Data     map[string]any `json:"data"`
+}
+
+// SendMail renders the templates of a request and sends the mail. Bad
+// addresses, unknown templates and data the template cannot use are the
+// caller's mistake, a mail server that refuses the mail is a 502.
+func (app *Config) SendMail(w http.ResponseWriter, r *http.Request) {
+	var req sendRequest
+
+	if err := app.readJson(w, r, &req); err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	if err := req.validate(); err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	html, plain, err := render(req.Template, req.Data)
+	if err != nil {
+		app.errorJson(w, fmt.Errorf("rendering %s: %w", req.Template, err))
+		return
+	}
+
+	msg := Message{
+		From:    req.From,
+		To:      req.To,
+		Subject: req.Subject,
+		HTML:    html,
+		Plain:   plain,
+	}
+
+	if err := app.Mailer.Send(r.Context(), msg); err != nil {
+		log.Printf("Error sending %s mail to %s: %v", req.Template, req.To, err)
+		app.errorJson(w, errors.New("the mail server did not take the mail"), http.StatusBadGateway)
+		return
+	}
+
+	app.writeJson(w, http.StatusAccepted, jsonResponse{
+		Error:   false,
+		Message: "sent mail to " + req.To,
+	})
+}
+
+func (req *sendRequest) validate() error {
+	if req.Template == "" {
+		req.Template = "mail"
+	}
+
+	to, err := mail.ParseAddress(req.To)
+	if err != nil {
+		return fmt.Errorf("invalid to: %w", err)
+	}
+	req.To = to.Address
+
+	if req.From != "" {
+		from, err := mail.ParseAddress(req.From)
+		if err != nil {
+			return fmt.Errorf("invalid from: %w", err)
+		}
+		req.From = from.Address
+	}
+
+	if strings.TrimSpace(req.Subject) == "" {
+		return errors.New("subject is required")
+	}
+	if strings.ContainsAny(req.Subject, "\r\n") {
+		return errors.New("subject must be a single line")
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+type jsonResponse struct {
+	Error   bool   `json:"error"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+// maxBodyBytes bounds the request bodies, mails with their data are small
+const maxBodyBytes = 1048576 // one mega byte
+
+// readJson decodes a single JSON value from the request body into data
+func (app *Config) readJson(w http.ResponseWriter, r *http.Request, data any) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(data); err != nil {
+		return err
+	}
+
+	if err := dec.Decode(&struct{}{}); err != io.EOF {
+		return errors.New("Body must have only a single JSON value")
+	}
+
+	return nil
+}
+
+func (app *Config) writeJson(w http.ResponseWriter, status int, data any) error {
+	out, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err = w.Write(out)
+
+	return err
+}
+
+func (app *Config) errorJson(w http.ResponseWriter, err error, status ...int) error {
+	statusCode := http.StatusBadRequest
+	if len(status) > 0 {
+		statusCode = status[0]
+	}
+
+	return app.writeJson(w, statusCode, jsonResponse{Error: true, Message: err.Error()})
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"path"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// templateFS holds the templates of the mails, <name>.html.gohtml and
+// <name>.plain.gohtml. The data of a request is the dot of both.
+//
+//go:embed templates
+var templateFS embed.FS
+
+// templates are parsed once, a key the data lacks is an error instead of
+// "<no value>" in a mail
+var templates = parseTemplates()
+
+type mailTemplate struct {
+	html  *htmltemplate.Template
+	plain *texttemplate.Template
+}
+
+func parseTemplates() map[string]*mailTemplate {
+	templates := make(map[string]*mailTemplate)
+
+	files, err := fs.Glob(templateFS, "templates/*.html.gohtml")
+	if err != nil {
+		panic(err)
+	}
+
+	for _, file := range files {
+		name := strings.TrimSuffix(path.Base(file), ".html.gohtml")
+
+		t := &mailTemplate{}
+		t.html, err = htmltemplate.New(name).Option("missingkey=error").ParseFS(templateFS, file)
+		if err != nil {
+			panic(err)
+		}
+		t.plain, err = texttemplate.New(name).Option("missingkey=error").ParseFS(templateFS, "templates/"+name+".plain.gohtml")
+		if err != nil {
+			panic(err)
+		}
+
+		templates[name] = t
+	}
+
+	return templates
+}
+
+// errUnknownTemplate is returned for templates that do not exist
+var errUnknownTemplate = errors.New("unknown template")
+
+// render returns the HTML and the plain text of the template name for data
+func render(name string, data map[string]any) (html, plain string, err error) {
+	t, ok := templates[name]
+	if !ok {
+		return "", "", fmt.Errorf("%w %q", errUnknownTemplate, name)
+	}
+
+	var htmlBuf, plainBuf bytes.Buffer
+	if err := t.html.ExecuteTemplate(&htmlBuf, name+".html.gohtml", data); err != nil {
+		return "", "", err
+	}
+	if err := t.plain.ExecuteTemplate(&plainBuf, name+".plain.gohtml", data); err != nil {
+		return "", "", err
+	}
+
+	return htmlBuf.String(), plainBuf.String(), nil
+}
+
+// Mail sends mails through one SMTP server. Encryption is "tls" for servers
+// that speak TLS from the start, "starttls" to require STARTTLS, "none" for
+// plain connections and empty to use STARTTLS whenever the server offers it.
+// Credentials are only sent over encrypted connections, or to localhost.
+type Mail struct {
+	Host       string
+	Port       int
+	Username   string
+	Password   string
+	Encryption string
+
+	FromAddress string
+	FromName    string
+}
+
+// Message is one mail, From empty for the address of the service
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	HTML    string
+	Plain   string
+}
+
+// check validates the settings and fills in the default port
+func (m *Mail) check() error {
+	if m.Host == "" {
+		return errors.New("MAIL_HOST is not set")
+	}
+
+	switch m.Encryption {
+	case "", "none", "starttls", "tls":
+	default:
+		return fmt.Errorf("invalid MAIL_ENCRYPTION %q, expected none, starttls or tls", m.Encryption)
+	}
+
+	if m.Port == 0 {
+		m.Port = 587
+		if m.Encryption == "tls" {
+			m.Port = 465
+		}
+	}
+
+	if m.FromAddress == "" {
+		m.FromAddress = "no-reply@" + m.Host
+	}
+	if _, err := mail.ParseAddress(m.FromAddress); err != nil {
+		return fmt.Errorf("invalid MAIL_FROM_ADDRESS: %w", err)
+	}
+
+	return nil
+}
+
+func (m *Mail) addr() string {
+	return net.JoinHostPort(m.Host, strconv.Itoa(m.Port))
+}
+
+// Send sends msg on a connection of its own
+func (m *Mail) Send(ctx context.Context, msg Message) error {
+	from := mail.Address{Name: m.FromName, Address: m.FromAddress}
+	if msg.From != "" {
+		from = mail.Address{Address: msg.From}
+	}
+
+	body, err := msg.encode(from)
+	if err != nil {
+		return err
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", m.addr())
+	if err != nil {
+		return err
+	}
+	if m.Encryption == "tls" {
+		conn = tls.Client(conn, &tls.Config{ServerName: m.Host})
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, m.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if m.Encryption == "" || m.Encryption == "starttls" {
+		ok, _ := client.Extension("STARTTLS")
+		switch {
+		case ok:
+			if err := client.StartTLS(&tls.Config{ServerName: m.Host}); err != nil {
+				return err
+			}
+		case m.Encryption == "starttls":
+			return errors.New("smtp: server does not support STARTTLS")
+		}
+	}
+
+	if m.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.Username, m.Password, m.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return err
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// encode returns the message as sent, the HTML as an alternative to the text
+func (msg Message) encode(from mail.Address) ([]byte, error) {
+	if strings.ContainsAny(msg.To+msg.Subject, "\r\n") {
+		return nil, errors.New("invalid mail header")
+	}
+
+	id := make([]byte, 16)
+	rand.Read(id)
+	domain := from.Address[strings.LastIndex(from.Address, "@")+1:]
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=UTF-8", msg.Plain},
+		{"text/html; charset=UTF-8", msg.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := io.WriteString(qp, part.content); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", parts.Boundary())
+	buf.Write(body.Bytes())
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"contracts/config"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+type Config struct {
+	Mailer Mail
+
+	// Token is the bearer token callers of /send present, empty when the
+	// service is only reachable on the internal network
+	Token string
+}
+
+func main() {
+	// every setting is an environment variable or a flag named after it,
+	// -mail-host for MAIL_HOST
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Panic(err)
+	}
+
+	// PORT is where the API listens, 80 by default
+	webPort := cfg.Port("PORT", "80")
+
+	// MAIL_PORT is the port of the SMTP server, by default 465 with tls and
+	// 587 otherwise
+	port, _ := strconv.Atoi(cfg.Port("MAIL_PORT", ""))
+
+	app := Config{
+		Mailer: Mail{
+			Host:       cfg.Required("MAIL_HOST"),
+			Port:       port,
+			Username:   cfg.String("MAIL_USERNAME", ""),
+			Password:   cfg.String("MAIL_PASSWORD", ""),
+			Encryption: cfg.String("MAIL_ENCRYPTION", ""),
+			// the sender of mails that name none
+			FromAddress: cfg.String("MAIL_FROM_ADDRESS", ""),
+			FromName:    cfg.String("MAIL_FROM_NAME", ""),
+		},
+		Token: cfg.String("MAIL_SERVICE_TOKEN", ""),
+	}
+
+	// SHUTDOWN_TIMEOUT is how long mails being sent may take after SIGTERM,
+	// 30 seconds by default
+	shutdownTimeout := cfg.Duration("SHUTDOWN_TIMEOUT", 30*time.Second, time.Second)
+
+	if err := cfg.Err(); err != nil {
+		log.Panicf("Invalid configuration:\n%v", err)
+	}
+	if err := app.Mailer.check(); err != nil {
+		log.Panic(err)
+	}
+
+	log.Printf("Starting mail service on port %s, sending through %s", webPort, app.Mailer.addr())
+
+	srv := &http.Server{
+		Addr:    fmt.Sprintf(":%s", webPort),
+		Handler: app.routes(),
+	}
+
+	if err := serve(srv, shutdownTimeout); err != nil {
+		log.Panic(err)
+	}
+}
+
+// serve runs srv until SIGTERM or SIGINT, then stops accepting connections
+// and waits up to timeout for the mails being sent
+func serve(srv *http.Server, timeout time.Duration) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	stop()
+
+	log.Printf("Shutting down, waiting up to %s for mails being sent", timeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Println("Mails still being sent at the shutdown deadline:", err)
+		return srv.Close()
+	}
+
+	log.Println("Shutdown complete")
+	return nil
+}
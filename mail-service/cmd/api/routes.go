@@ -0,0 +1,38 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+func (app *Config) routes() http.Handler {
+	mux := chi.NewRouter()
+
+	mux.Use(middleware.Heartbeat("/ping"))
+
+	mux.With(app.requireToken, middleware.Timeout(30*time.Second)).Post("/send", app.SendMail)
+
+	return mux
+}
+
+// requireToken lets through the requests that carry the service token, all of
+// them when no token is configured
+func (app *Config) requireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.Token != "" {
+			got := []byte(r.Header.Get("Authorization"))
+			want := []byte("Bearer " + app.Token)
+			if subtle.ConstantTimeCompare(got, want) != 1 {
+				app.errorJson(w, errors.New("invalid or missing token"), http.StatusUnauthorized)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
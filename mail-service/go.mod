@@ -0,0 +1,10 @@
+module mail
+
+go 1.23
+
+require (
+	contracts v0.0.0
+	github.com/go-chi/chi/v5 v5.1.0
+)
+
+replace contracts => ../contracts
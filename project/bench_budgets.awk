@@ -0,0 +1,47 @@
+# Checks `go test -bench -benchmem` output against bench_budgets.txt:
+#
+#	awk -f bench_budgets.awk bench_budgets.txt bench_output.txt
+#
+# and exits 1 when a benchmark left its budget or did not run.
+
+FNR == NR {
+	if ($0 ~ /^#/ || NF == 0)
+		next
+	min[$1] = $2; max[$1] = $3; allocs[$1] = $4
+	next
+}
+
+/^Benchmark/ {
+	name = $1
+	sub(/-[0-9]+$/, "", name)
+
+	ns = ""; a = ""
+	for (i = 2; i <= NF; i++) {
+		if ($i == "ns/op") ns = $(i - 1)
+		if ($i == "allocs/op") a = $(i - 1)
+	}
+
+	if (!(name in max)) {
+		printf "%-26s %14s ns/op  no budget\n", name, ns
+		next
+	}
+	seen[name] = 1
+
+	verdict = "ok"
+	if (ns + 0 > max[name] + 0) verdict = sprintf("slower than %d ns/op", max[name])
+	else if (ns + 0 < min[name] + 0) verdict = sprintf("faster than %d ns/op", min[name])
+	else if (a + 0 > allocs[name] + 0) verdict = sprintf("more than %d allocs/op", allocs[name])
+
+	if (verdict != "ok") failed = 1
+	printf "%-26s %14s ns/op %6s allocs/op  %s\n", name, ns, a, verdict
+}
+
+END {
+	for (name in max) {
+		if (!(name in seen)) {
+			printf "%-26s did not run\n", name
+			failed = 1
+		}
+	}
+	exit failed
+}